@@ -0,0 +1,95 @@
+// ascii.go — "fsm ascii" subcommand.
+//
+// Prints a character-cell diagram drawn like the fsmedit canvas, for CI
+// logs, code review comments, and terminals without a graphical viewer.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const asciiUsage = `Usage: fsm ascii <input> [-o output.txt] [-m machine] [--use-layout] [--plain] [--width N] [--height N]
+
+Draw the machine with box-drawing characters and arrows, as fsmedit
+shows it, without starting the editor.
+
+Options:
+  -o, --output    Output file (default: stdout)
+  -m, --machine   Select machine from bundle
+  --use-layout    Place states where fsmedit saved them (.fsm input)
+  --plain         Use only 7-bit ASCII (- | + > < ^ v)
+  --width N       Layout width in columns (default: 80)
+  --height N      Layout height in rows (default: 24)
+
+The diagram grows beyond --width and --height if the machine needs more
+room.
+
+Examples:
+  fsm ascii turnstile.json
+  fsm ascii bundle.fsm -m parser --use-layout --plain
+`
+
+func cmdASCII(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", asciiUsage)
+	}
+
+	var output, machineName string
+	var useLayout, plain bool
+	width, height := 80, 24
+	fs := newFlagSet("ascii")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&useLayout, "--use-layout")
+	fs.Bool(&plain, "--plain")
+	fs.Int(&width, "--width")
+	fs.Int(&height, "--height")
+	positional := fs.parseOrExit(args, asciiUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	var layout *fsmfile.Layout
+	if useLayout {
+		layout = loadLayoutWithMachine(input, machineName)
+		if layout == nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s has no saved layout; using automatic layout\n", input)
+		}
+	}
+
+	ctx := fsmfile.WithLogger(context.Background(), debugLogger())
+	diagram, err := fsmfile.RenderASCIIContext(ctx, f, layout, width, height)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if plain {
+		diagram = fsmfile.PlainASCII(diagram)
+	}
+
+	if output == "" {
+		output = stdioPath
+	}
+	w, err := createOutput(output)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", output, err)
+	}
+	if _, err := io.WriteString(w, diagram); err != nil {
+		w.Close()
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if err := w.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+}
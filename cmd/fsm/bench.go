@@ -0,0 +1,177 @@
+// bench.go — "fsm bench" subcommand.
+//
+// Times layout and rendering on random machines of growing size, the same
+// work as the Go benchmarks in pkg/fsmfile, so that a slowdown in routing
+// or label placement shows without a Go toolchain. With --budget the
+// command fails if any operation takes longer, for use in CI.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const benchUsage = `Usage: fsm bench [--sizes N,N,...] [--runs N] [--seed N] [--only OP,...]
+                 [--budget DURATION]
+
+Time layout and rendering on random machines of the given sizes. Each
+operation is run several times on each machine and the fastest run is
+reported.
+
+Operations:
+  smart-layout    The default layout
+  sugiyama        The layered layout, with routing boxes
+  png             The native PNG renderer at 800x600
+  svg             The native SVG renderer at 800x600
+
+Options:
+  --sizes     State counts to time (default: 10,100,1000)
+  -r, --runs  Runs of each operation per size (default: 3)
+  -s, --seed  Random seed for the machines (default: 1)
+  --only      Operations to time (default: all)
+  --budget    Fail if any operation takes longer, e.g. 2s or 500ms
+
+Examples:
+  fsm bench
+  fsm bench --sizes 50,200 --only png,svg --runs 5
+  fsm bench --sizes 100 --budget 1s --json
+`
+
+// benchResult is the time of one operation on one machine.
+type benchResult struct {
+	Op     string        `json:"op"`
+	States int           `json:"states"`
+	Time   time.Duration `json:"time_ns"`
+	Over   bool          `json:"over_budget,omitempty"`
+}
+
+func cmdBench(args []string) {
+	var sizesArg, budgetArg string
+	var only []string
+	runs, seed := 3, 1
+	fs := newFlagSet("bench")
+	fs.String(&sizesArg, "--sizes")
+	fs.Int(&runs, "-r", "--runs")
+	fs.Int(&seed, "-s", "--seed")
+	fs.Strings(&only, "--only")
+	fs.String(&budgetArg, "--budget")
+	positional := fs.parseOrExit(args, benchUsage)
+
+	if len(positional) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n\n", positional[0])
+		fatalf(exitUsage, "%s", benchUsage)
+	}
+	if runs < 1 {
+		fatalf(exitUsage, "Error: --runs must be at least 1")
+	}
+
+	sizes := fsmfile.BenchSizes
+	if sizesArg != "" {
+		sizes = nil
+		for _, s := range strings.Split(sizesArg, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n < 1 {
+				fatalf(exitUsage, "Error: invalid size %q in --sizes", s)
+			}
+			sizes = append(sizes, n)
+		}
+	}
+
+	var budget time.Duration
+	if budgetArg != "" {
+		d, err := time.ParseDuration(budgetArg)
+		if err != nil || d <= 0 {
+			fatalf(exitUsage, "Error: invalid --budget %q (use e.g. 2s or 500ms)", budgetArg)
+		}
+		budget = d
+	}
+
+	ops := fsmfile.BenchOps()
+	if len(only) > 0 {
+		want := make(map[string]bool)
+		for _, o := range only {
+			for _, name := range strings.Split(o, ",") {
+				want[strings.TrimSpace(name)] = true
+			}
+		}
+		var chosen []fsmfile.BenchOp
+		for _, op := range ops {
+			if want[op.Name] {
+				chosen = append(chosen, op)
+				delete(want, op.Name)
+			}
+		}
+		for name := range want {
+			fatalf(exitUsage, "Error: unknown operation %q (use smart-layout, sugiyama, png, svg)", name)
+		}
+		ops = chosen
+	}
+
+	var results []benchResult
+	over := false
+	for _, n := range sizes {
+		f, err := fsmfile.BenchMachine(n, int64(seed))
+		if err != nil {
+			fatalf(exitFailure, "Error: %v", err)
+		}
+		if !opts.quiet && !opts.json {
+			fmt.Fprintf(os.Stderr, "bench: %d states, %d transitions\n", len(f.States), len(f.Transitions))
+		}
+		for _, op := range ops {
+			var best time.Duration
+			for i := 0; i < runs; i++ {
+				start := time.Now()
+				op.Run(f)
+				if d := time.Since(start); i == 0 || d < best {
+					best = d
+				}
+			}
+			r := benchResult{Op: op.Name, States: n, Time: best}
+			if budget > 0 && best > budget {
+				r.Over = true
+				over = true
+			}
+			results = append(results, r)
+		}
+	}
+
+	if opts.json {
+		printJSON(results)
+	} else {
+		printBench(results, budget)
+	}
+	if over {
+		os.Exit(exitInvalid)
+	}
+}
+
+func printBench(results []benchResult, budget time.Duration) {
+	fmt.Printf("%-14s  %8s  %12s\n", "Operation", "States", "Time")
+	for _, r := range results {
+		mark := ""
+		if r.Over {
+			mark = "  over budget"
+		}
+		fmt.Printf("%-14s  %8d  %12s%s\n", r.Op, r.States, r.Time.Round(time.Microsecond), mark)
+	}
+	if budget > 0 {
+		n := 0
+		for _, r := range results {
+			if r.Over {
+				n++
+			}
+		}
+		fmt.Printf("\nBudget %s: ", budget)
+		if n == 0 {
+			fmt.Println("all within")
+		} else {
+			fmt.Printf("%d over\n", n)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// build.go — "fsm build" subcommand.
+//
+// Reads a .fsmproj project manifest and builds every output it lists:
+// code from each [[generate]] target and diagrams from each [[render]]
+// target, for the machines they select. Each output is produced by a
+// child fsm process, as "fsm watch" runs its actions, several at once
+// (see jobs.go), and outputs newer than their machine file and the
+// manifest are left alone.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const buildUsage = `Usage: fsm build [project.fsmproj] [-m NAME]... [--force] [--dry-run] [--jobs N]
+
+Build the code and diagrams listed in a project manifest. Without an
+argument, the one .fsmproj file in the current directory is used. Paths
+in the manifest are relative to its directory, and outputs go in its
+output_dir.
+
+Before anything is built, each machine is loaded and, if it names a
+shared alphabet, its inputs are checked against it. An output is rebuilt
+only when it is missing or older than its machine file or the manifest.
+Exits with status 1 if any machine or output fails.
+
+Options:
+  -m, --machine   Build only this machine's outputs (repeatable)
+  -B, --force     Rebuild outputs that are up to date
+  -n, --dry-run   Print the fsm commands that would run, and run nothing
+  -j, --jobs N    Run N fsm commands at once (default: one per CPU)
+
+Manifest:
+  name = "controllers"
+  output_dir = "build"
+
+  [alphabets]
+  buttons = ["press", "release", "hold"]
+
+  [[machine]]
+  file = "machines/door.fsm"
+  alphabet = "buttons"
+
+  [[generate]]
+  lang = "c"
+  output = "include/{name}.h"
+  options = ["--misra"]
+
+  [[render]]
+  format = "svg"
+  renderer = "native"
+
+Examples:
+  fsm build
+  fsm build controllers.fsmproj --force
+  fsm build -m door --dry-run
+`
+
+// buildStep is one output of a build: the fsm arguments that produce it.
+type buildStep struct {
+	machine fsmfile.ProjectMachine
+	output  string
+	args    []string
+}
+
+func cmdBuild(args []string) {
+	var only []string
+	var force, dryRun bool
+	var jobs int
+	fs := newFlagSet("build")
+	fs.Strings(&only, "-m", "--machine")
+	fs.Bool(&force, "-B", "--force")
+	fs.Bool(&dryRun, "-n", "--dry-run")
+	fs.Int(&jobs, "-j", "--jobs")
+	positional := fs.parseOrExit(args, buildUsage)
+	checkJobs(jobs)
+
+	var path string
+	switch len(positional) {
+	case 0:
+		matches, _ := filepath.Glob("*" + fsmfile.ProjectExt)
+		if len(matches) != 1 {
+			fatalf(exitUsage, "Error: found %d %s files in the current directory; name the project to build", len(matches), fsmfile.ProjectExt)
+		}
+		path = matches[0]
+	case 1:
+		path = positional[0]
+	default:
+		fatalf(exitUsage, "Error: one project file expected")
+	}
+
+	p, err := fsmfile.LoadProject(path)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error: %v", err)
+	}
+	dir := filepath.Dir(path)
+	selected := make(map[string]bool)
+	for _, name := range only {
+		if len(p.Select([]string{name})) == 0 {
+			fatalf(exitFailure, "Error: no machine named %q in %s", name, path)
+		}
+		selected[name] = true
+	}
+
+	// Load every selected machine, checking its shared alphabet.
+	failed := 0
+	broken := make(map[string]bool)
+	for _, m := range p.Machines {
+		if len(selected) > 0 && !selected[m.Name] {
+			continue
+		}
+		f, err := loadFSMWithMachine(filepath.Join(dir, m.File), m.Machine)
+		if err == nil && m.Alphabet != "" {
+			err = checkSharedAlphabet(f.Alphabet, m.Alphabet, p.Alphabets[m.Alphabet])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: machine %s: %v\n", m.Name, err)
+			broken[m.Name] = true
+			failed++
+		}
+	}
+
+	var steps []buildStep
+	for _, g := range p.Generate {
+		for _, m := range p.Select(g.Machines) {
+			out := g.OutputPath(p, m)
+			argv := []string{"generate", m.File, "--lang", g.Lang}
+			if g.Package != "" {
+				argv = append(argv, "--package", g.Package)
+			}
+			steps = append(steps, buildStep{m, out, append(argv, g.Options...)})
+		}
+	}
+	for _, r := range p.Render {
+		for _, m := range p.Select(r.Machines) {
+			out := r.OutputPath(p, m)
+			argv := []string{r.Format, m.File}
+			if r.Renderer != "" {
+				argv = append(argv, "--renderer", r.Renderer)
+			}
+			if r.Theme != "" {
+				argv = append(argv, "--theme", r.Theme)
+			}
+			steps = append(steps, buildStep{m, out, append(argv, r.Options...)})
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf(exitFailure, "Error: cannot locate fsm executable: %v", err)
+	}
+	manifestTime := modTime(path)
+	current := 0
+	var todo []buildStep
+	for _, s := range steps {
+		if len(selected) > 0 && !selected[s.machine.Name] || broken[s.machine.Name] {
+			continue
+		}
+		if s.machine.Machine != "" {
+			s.args = append(s.args, "-m", s.machine.Machine)
+		}
+		s.args = append(s.args, "-o", s.output)
+
+		out := filepath.Join(dir, s.output)
+		if !force {
+			t := modTime(out)
+			if !t.IsZero() && t.After(manifestTime) && t.After(modTime(filepath.Join(dir, s.machine.File))) {
+				current++
+				continue
+			}
+		}
+		if dryRun {
+			fmt.Printf("fsm %s\n", quoteArgs(s.args))
+			continue
+		}
+		todo = append(todo, s)
+	}
+
+	// Each step's output is kept and shown after all have run, in order.
+	ran := make([]buildRun, len(todo))
+	runJobs(len(todo), jobs, func(i int) {
+		ran[i] = runBuildStep(exe, dir, todo[i])
+	})
+	built := 0
+	for i, r := range ran {
+		infof("fsm %s\n", quoteArgs(todo[i].args))
+		os.Stdout.Write(r.stdout.Bytes())
+		os.Stderr.Write(r.stderr.Bytes())
+		switch {
+		case r.mkdirErr != nil:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", r.mkdirErr)
+			failed++
+		case r.err != nil:
+			fmt.Fprintf(os.Stderr, "   %s failed: %v\n", todo[i].args[0], r.err)
+			failed++
+		default:
+			built++
+		}
+	}
+
+	if !dryRun {
+		infof("build: %d built, %d up to date, %d failed\n", built, current, failed)
+	}
+	if failed > 0 {
+		os.Exit(exitFailure)
+	}
+}
+
+// buildRun is the outcome of one build step.
+type buildRun struct {
+	stdout, stderr bytes.Buffer
+	mkdirErr, err  error
+}
+
+// runBuildStep runs the child fsm process for s in the project directory,
+// keeping what it prints.
+func runBuildStep(exe, dir string, s buildStep) buildRun {
+	var r buildRun
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, s.output)), 0755); err != nil {
+		r.mkdirErr = err
+		return r
+	}
+	cmd := exec.Command(exe, append(globalFlagArgs(), append([]string{"--quiet"}, s.args...)...)...)
+	cmd.Dir = dir
+	cmd.Stdout = &r.stdout
+	cmd.Stderr = &r.stderr
+	r.err = cmd.Run()
+	return r
+}
+
+// checkSharedAlphabet reports the inputs of a machine that are not in the
+// shared alphabet it is declared to use.
+func checkSharedAlphabet(inputs []string, name string, shared []string) error {
+	allowed := make(map[string]bool, len(shared))
+	for _, s := range shared {
+		allowed[s] = true
+	}
+	var extra []string
+	for _, s := range inputs {
+		if !allowed[s] {
+			extra = append(extra, s)
+		}
+	}
+	if len(extra) > 0 {
+		return fmt.Errorf("inputs not in alphabet %s: %s", name, strings.Join(extra, ", "))
+	}
+	return nil
+}
+
+// modTime returns the modification time of path, or the zero time if it
+// cannot be read.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// quoteArgs joins command arguments for display, quoting those with
+// spaces.
+func quoteArgs(args []string) string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\"'") {
+			a = fmt.Sprintf("%q", a)
+		}
+		out[i] = a
+	}
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,148 @@
+// check.go — "fsm check" subcommand.
+//
+// Model-checks CTL properties against a machine's transition graph and
+// prints PASS or FAIL for each, with a counterexample path when one
+// shows the failure. With --json the fsm.CTLResult of each property is
+// printed as an array.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const checkUsage = `Usage: fsm check <input|-> --prop FORMULA [--prop FORMULA...] [-m machine]
+
+Check temporal properties, written in CTL (computation tree logic),
+against every path through the machine from its initial state. A
+failing property is reported with a counterexample path where one
+exists, and a property that holds for an existential reason (EF, EG,
+EX, E[U]) with a witness. Exits with status 3 if any property fails.
+
+Atoms:
+  NAME, "NAME"    The machine is in state NAME (quote names with spaces
+                  or that clash with keywords)
+  true, false     Always, never
+  initial         The initial state
+  accepting       An accepting state
+  deadlock        A state with no transitions out
+
+Operators (loosest last):
+  !p  EX p  AX p  EF p  AF p  EG p  AG p  E[p U q]  A[p U q]
+  p & q
+  p | q
+  p -> q
+EX/AX: in some/every next state. EF/AF: eventually, on some/every path.
+EG/AG: always, on some/every path. E[p U q]/A[p U q]: p holds until q
+does, on some/every path.
+
+Every transition is an edge, whatever its input; a deadlocked state
+stays where it is. A pushdown automaton's stack is ignored.
+
+Options:
+  -p, --prop      Property to check (repeatable)
+  -m, --machine   Select machine from bundle
+
+Examples:
+  fsm check door.fsm --prop "AG(error -> AF idle)"
+  fsm check protocol.fsmt --prop "AG EF idle" --prop "AG !deadlock"
+`
+
+func cmdCheck(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", checkUsage)
+	}
+
+	var machineName string
+	var props []string
+	fs := newFlagSet("check")
+	fs.Strings(&props, "-p", "--prop")
+	fs.String(&machineName, "-m", "--machine")
+	positional := fs.parseOrExit(args, checkUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	if len(props) == 0 {
+		fatalf(exitUsage, "Error: at least one --prop required")
+	}
+	input := positional[0]
+
+	formulas := make([]*fsm.CTL, len(props))
+	for i, p := range props {
+		c, err := fsm.ParseCTL(p)
+		if err != nil {
+			fatalf(exitUsage, "Error in property %q: %v", p, err)
+		}
+		formulas[i] = c
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	results := make([]fsm.CTLResult, len(formulas))
+	failed := 0
+	for i, c := range formulas {
+		res, err := fsm.CheckCTL(f, c)
+		if err != nil {
+			fatalf(exitUsage, "Error in property %q: %v", props[i], err)
+		}
+		results[i] = res
+		if !res.Holds {
+			failed++
+		}
+	}
+
+	if opts.json {
+		printJSON(results)
+	} else {
+		for i, res := range results {
+			verdict := "PASS"
+			if !res.Holds {
+				verdict = "FAIL"
+			}
+			fmt.Printf("%s  %s\n", verdict, props[i])
+			if len(res.Path) > 0 {
+				label := "witness"
+				if !res.Holds {
+					label = "counterexample"
+				}
+				fmt.Printf("  %s: %s\n", label, formatCTLPath(res))
+			}
+		}
+	}
+	if failed > 0 {
+		os.Exit(exitInvalid)
+	}
+}
+
+// formatCTLPath renders a path as "idle --go--> busy ..., then back to
+// busy" for a path ending in a loop.
+func formatCTLPath(res fsm.CTLResult) string {
+	var b strings.Builder
+	for i, s := range res.Path {
+		if i > 0 {
+			if s.Input != "" {
+				fmt.Fprintf(&b, " --%s--> ", s.Input)
+			} else {
+				b.WriteString(" --> ")
+			}
+		}
+		b.WriteString(s.State)
+	}
+	if res.Loop >= 0 {
+		last := res.Path[len(res.Path)-1].State
+		if back := res.Path[res.Loop].State; back == last && res.Loop == len(res.Path)-1 {
+			fmt.Fprintf(&b, ", then stays in %s", back)
+		} else {
+			fmt.Fprintf(&b, ", then back to %s", back)
+		}
+	}
+	return b.String()
+}
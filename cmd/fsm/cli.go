@@ -0,0 +1,417 @@
+// cli.go — command table, global flags, and shared flag parsing.
+//
+// Global flags may appear anywhere on the command line and are removed
+// before the subcommand sees its arguments:
+//
+//   --quiet, -q   Suppress informational messages (errors are still shown)
+//   --json        Emit machine-readable JSON (info, stats, analyse, lint,
+//                 validate, convert, properties, simulate, cost, replay,
+//                 bench)
+//   --no-color    Disable ANSI colour; also honoured via NO_COLOR or when
+//                 stdout is not a terminal
+//   --no-config   Ignore the config file (see config.go)
+//   --error-format text|json
+//                 Print errors as text or as JSON on stderr (see exitcode.go)
+//   --debug       Trace layout, edge routing, runs, simulation, and serving
+//                 on stderr (see debugLogger)
+//
+// --config PATH, which chooses the config file, is only recognised before
+// the command name, since "fsm lint --config" names a lint config.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// globalOptions holds flags that apply to every command.
+type globalOptions struct {
+	quiet       bool
+	json        bool
+	noColor     bool
+	configPath  string
+	noConfig    bool
+	errorFormat string
+	debug       bool
+}
+
+var opts globalOptions
+
+// command is an entry in the subcommand table.
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	run     func(args []string)
+}
+
+// commands lists every subcommand in the order shown by "fsm --help".
+var commands = []command{
+	{"convert", nil, "Convert between formats (json, text, hex, fsm)", cmdConvert},
+	{"dot", nil, "Generate Graphviz DOT output", cmdDot},
+	{"tikz", nil, "Generate LaTeX/TikZ automata code", cmdTikZ},
+	{"xstate", nil, "Export an XState machine config (JSON)", cmdXState},
+	{"ascii", nil, "Draw a text diagram for terminals and logs", cmdASCII},
+	{"png", nil, "Generate PNG image (requires Graphviz)", func(a []string) { cmdImage(a, "png") }},
+	{"svg", nil, "Generate SVG image (requires Graphviz)", func(a []string) { cmdImage(a, "svg") }},
+	{"animate", nil, "Render an animated GIF of a run", cmdAnimate},
+	{"html", nil, "Export an interactive HTML page", cmdHTML},
+	{"report", nil, "Write a Markdown or HTML design document", cmdReport},
+	{"generate", nil, "Generate code (C, Rust, Go/TinyGo)", cmdGenerate},
+	{"info", nil, "Show FSM information", cmdInfo},
+	{"table", nil, "Print the transition table (text, csv, md, html)", cmdTable},
+	{"machines", nil, "List machines in a bundle", cmdMachines},
+	{"stats", nil, "Report size and complexity metrics", cmdStats},
+	{"analyse", []string{"analyze"}, "Analyse FSM for potential issues", cmdAnalyse},
+	{"lint", nil, "Check against configurable rules (.fsmlint.toml)", cmdLint},
+	{"run", nil, "Run FSM interactively", cmdRun},
+	{"validate", nil, "Validate FSM file", cmdValidate},
+	{"schema", nil, "Print the JSON Schema for the JSON format", cmdSchema},
+	{"view", nil, "Visualise FSM (generates PNG and opens it)", cmdView},
+	{"edit", nil, "Open visual editor (invokes fsmedit)", cmdEdit},
+	{"bundle", nil, "Create bundle from multiple FSM files", cmdBundle},
+	{"extract", nil, "Extract a machine from a bundle, or a subgraph", cmdExtract},
+	{"netlist", nil, "Export structural netlist (text, kicad, json)", cmdNetlist},
+	{"properties", nil, "Query state class assignments and property values", cmdProperties},
+	{"random", nil, "Generate a random valid machine", cmdRandom},
+	{"bench", nil, "Time layout and rendering on generated machines", cmdBench},
+	{"simulate", nil, "Run random walks and report where they go", cmdSimulate},
+	{"cost", nil, "Find cheapest and expected-cost paths between states", cmdCost},
+	{"replay", nil, "Check a log of real events against a machine", cmdReplay},
+	{"compare-behavior", nil, "Find where two machines behave differently on random inputs", cmdCompareBehavior},
+	{"isomorphic", nil, "Check whether two machines are identical up to state renaming", cmdIsomorphic},
+	{"gen-tests", nil, "Generate a test suite (transition tour, W-method)", cmdGenTests},
+	{"test", nil, "Run a test suite against a machine", cmdTest},
+	{"check", nil, "Check CTL temporal properties (AG, AF, EU...)", cmdCheck},
+	{"lsp", nil, "Language server for .fsmt text machines", cmdLSP},
+	{"serve", nil, "Serve cached diagrams over HTTP", cmdServe},
+	{"watch", nil, "Re-run commands whenever an FSM file changes", cmdWatch},
+	{"build", nil, "Build the code and diagrams listed in a .fsmproj project", cmdBuild},
+	{"shell", nil, "Interactive session for transforming machines in memory", cmdShell},
+	{"minimize", []string{"minimise"}, "Minimise a machine", cmdMinimize},
+	{"determinize", []string{"determinise"}, "Convert an NFA to a DFA", cmdDeterminize},
+	{"sync", nil, "Compose two machines in parallel, synchronising on shared inputs", cmdSync},
+	{"scanner", nil, "Combine token acceptors into one scanner for code generation", cmdScanner},
+	{"rename-state", nil, "Rename states, by name or regular expression", cmdRenameState},
+	{"rename-symbol", nil, "Rename or merge input/output symbols", cmdRenameSymbol},
+	{"prune-alphabet", nil, "Remove unused symbols and merge equivalent inputs", cmdPruneAlphabet},
+}
+
+// findCommand looks up a subcommand by name or alias.
+func findCommand(name string) *command {
+	for i := range commands {
+		c := &commands[i]
+		if c.name == name {
+			return c
+		}
+		for _, a := range c.aliases {
+			if a == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// commandList renders the Commands section of the top-level usage.
+func commandList() string {
+	width := 0
+	for _, c := range commands {
+		if len(c.name) > width {
+			width = len(c.name)
+		}
+	}
+	var sb strings.Builder
+	for _, c := range commands {
+		summary := c.summary
+		if len(c.aliases) > 0 {
+			summary += " (alias: " + strings.Join(c.aliases, ", ") + ")"
+		}
+		fmt.Fprintf(&sb, "  %-*s  %s\n", width, c.name, summary)
+	}
+	return sb.String()
+}
+
+// parseGlobalFlags strips global flags from args and records them in opts.
+// Everything after a bare "--" is left untouched.
+func parseGlobalFlags(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			out = append(out, args[i:]...)
+			break
+		}
+		// Before the command name, --config chooses the config file.
+		if len(out) == 0 && (a == "--config" || strings.HasPrefix(a, "--config=")) {
+			if path, ok := strings.CutPrefix(a, "--config="); ok {
+				opts.configPath = path
+			} else if i+1 < len(args) {
+				i++
+				opts.configPath = args[i]
+			}
+			continue
+		}
+		// --error-format takes a value, as the one global flag that does.
+		if a == "--error-format" || strings.HasPrefix(a, "--error-format=") {
+			format, ok := strings.CutPrefix(a, "--error-format=")
+			if !ok && i+1 < len(args) {
+				i++
+				format = args[i]
+			}
+			if format != "text" && format != "json" {
+				fmt.Fprintf(os.Stderr, "Error: unknown --error-format %q (use text or json)\n", format)
+				os.Exit(exitUsage)
+			}
+			opts.errorFormat = format
+			continue
+		}
+		switch a {
+		case "--quiet", "-q":
+			opts.quiet = true
+		case "--json":
+			opts.json = true
+		case "--no-color", "--no-colour":
+			opts.noColor = true
+		case "--no-config":
+			opts.noConfig = true
+		case "--debug":
+			opts.debug = true
+		default:
+			out = append(out, a)
+		}
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		opts.noColor = true
+	}
+	return out
+}
+
+// globalFlagArgs returns the global flags in effect, for passing on to a
+// child fsm process.
+func globalFlagArgs() []string {
+	var out []string
+	if opts.quiet {
+		out = append(out, "--quiet")
+	}
+	if opts.json {
+		out = append(out, "--json")
+	}
+	if opts.noColor {
+		out = append(out, "--no-color")
+	}
+	if opts.errorFormat != "" {
+		out = append(out, "--error-format", opts.errorFormat)
+	}
+	if opts.debug {
+		out = append(out, "--debug")
+	}
+	if opts.noConfig {
+		out = append(out, "--no-config")
+	} else if opts.configPath != "" {
+		out = append(out, "--config", opts.configPath)
+	}
+	return out
+}
+
+// debugLogger returns the logger for --debug, which writes the debug
+// traces of the libraries (layout and edge routing, runner steps,
+// simulated walks, and server requests) to stderr as text, or nil, which
+// logs nothing, without --debug.
+func debugLogger() *slog.Logger {
+	if !opts.debug {
+		return nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// infof prints an informational message to stdout unless --quiet is set.
+func infof(format string, a ...interface{}) {
+	if !opts.quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fatalf(exitFailure, "Error encoding JSON: %v", err)
+	}
+}
+
+// ANSI colour codes used by the text output.
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+)
+
+// colorize wraps s in an ANSI colour sequence when stdout is a terminal and
+// colour has not been disabled.
+func colorize(code, s string) string {
+	if opts.noColor {
+		return s
+	}
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// errHelp is returned by flagSet.Parse when -h or --help is given.
+var errHelp = errors.New("help requested")
+
+// flagSet is a small declarative parser for subcommand flags. Flags may be
+// given as "--name value" or "--name=value"; anything that is not a flag
+// (including "-" for stdin) is returned as a positional argument.
+type flagSet struct {
+	cmd   string
+	flags map[string]*flagDef
+	seen  map[string]bool
+}
+
+type flagDef struct {
+	str  *string
+	strs *[]string
+	b    *bool
+	n    *int
+	x    *float64
+}
+
+func newFlagSet(cmd string) *flagSet {
+	return &flagSet{cmd: cmd, flags: make(map[string]*flagDef), seen: make(map[string]bool)}
+}
+
+// Seen reports whether any of the named flags was given, for flags whose
+// mere presence matters even when their value is the default.
+func (fs *flagSet) Seen(names ...string) bool {
+	for _, n := range names {
+		if fs.seen[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// String registers a flag that takes a value.
+func (fs *flagSet) String(p *string, names ...string) {
+	for _, n := range names {
+		fs.flags[n] = &flagDef{str: p}
+	}
+}
+
+// Strings registers a flag that takes a value and may be repeated.
+func (fs *flagSet) Strings(p *[]string, names ...string) {
+	for _, n := range names {
+		fs.flags[n] = &flagDef{strs: p}
+	}
+}
+
+// Bool registers a flag that takes no value.
+func (fs *flagSet) Bool(p *bool, names ...string) {
+	for _, n := range names {
+		fs.flags[n] = &flagDef{b: p}
+	}
+}
+
+// Int registers a flag that takes an integer value.
+func (fs *flagSet) Int(p *int, names ...string) {
+	for _, n := range names {
+		fs.flags[n] = &flagDef{n: p}
+	}
+}
+
+// Float registers a flag that takes a decimal value.
+func (fs *flagSet) Float(p *float64, names ...string) {
+	for _, n := range names {
+		fs.flags[n] = &flagDef{x: p}
+	}
+}
+
+// Parse processes args and returns the positional arguments.
+func (fs *flagSet) Parse(args []string) ([]string, error) {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if isInputArg(a) {
+			positional = append(positional, a)
+			continue
+		}
+		if a == "-h" || a == "--help" {
+			return nil, errHelp
+		}
+
+		name, value, hasValue := a, "", false
+		if eq := strings.IndexByte(a, '='); eq > 0 && strings.HasPrefix(a, "--") {
+			name, value, hasValue = a[:eq], a[eq+1:], true
+		}
+		def, ok := fs.flags[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown flag %s for fsm %s", name, fs.cmd)
+		}
+		fs.seen[name] = true
+
+		if def.b != nil {
+			if hasValue {
+				return nil, fmt.Errorf("flag %s does not take a value", name)
+			}
+			*def.b = true
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag %s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if def.n != nil {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("flag %s: invalid number %q", name, value)
+			}
+			*def.n = v
+			continue
+		}
+		if def.x != nil {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("flag %s: invalid number %q", name, value)
+			}
+			*def.x = v
+			continue
+		}
+		if def.strs != nil {
+			*def.strs = append(*def.strs, value)
+			continue
+		}
+		*def.str = value
+	}
+	return positional, nil
+}
+
+// parseOrExit parses args, printing usage and exiting on error. On -h it
+// prints usage to stdout and exits successfully.
+func (fs *flagSet) parseOrExit(args []string, usage string) []string {
+	positional, err := fs.Parse(args)
+	if err == errHelp {
+		fmt.Print(usage)
+		os.Exit(0)
+	}
+	if err != nil {
+		fatalf(exitUsage, "Error: %v\n\n%s", err, usage)
+	}
+	return positional
+}
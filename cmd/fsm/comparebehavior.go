@@ -0,0 +1,135 @@
+// comparebehavior.go — "fsm compare-behavior" subcommand.
+//
+// Runs seeded random input sequences through two machines side by side
+// and reports the first sequence after which they differ in acceptance
+// or output. With --json the fsm.CompareResult is printed as an object.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const compareUsage = `Usage: fsm compare-behavior <a> <b> [--runs N] [--max-len N] [--seed N]
+                            [--machine-a NAME] [--machine-b NAME]
+
+Differential testing: run the same random input sequences through two
+machines and report the first sequence after which one accepts and the
+other does not, or they give different outputs. Exits with status 3 if
+the machines diverge.
+
+This finds differences by simulation, so it works for every machine
+type, pushdown automata included, where the exact equivalence check
+(the shell's diff command) does not apply. Finding no divergence is
+evidence, not proof, that the machines behave alike.
+
+Each input is drawn at random from those either machine can take next.
+A machine with no transition on an input is stuck, and from then on
+rejects with no output.
+
+Options:
+  -r, --runs      Number of input sequences (default: 1000)
+  -l, --max-len   Inputs per sequence (default: 20)
+  -s, --seed      Random seed (default: 1)
+  --machine-a     Select machine from bundle a
+  --machine-b     Select machine from bundle b
+
+Examples:
+  fsm compare-behavior handwritten.fsm generated.json
+  fsm compare-behavior old.fsm new.fsm --runs 10000 --max-len 50 --seed 7
+`
+
+func cmdCompareBehavior(args []string) {
+	if len(args) < 2 {
+		fatalf(exitUsage, "%s", compareUsage)
+	}
+
+	var machineA, machineB string
+	co := fsm.CompareOptions{}
+	seed := 1
+	fs := newFlagSet("compare-behavior")
+	fs.Int(&co.Runs, "-r", "--runs")
+	fs.Int(&co.MaxLen, "-l", "--max-len")
+	fs.Int(&seed, "-s", "--seed")
+	fs.String(&machineA, "--machine-a")
+	fs.String(&machineB, "--machine-b")
+	positional := fs.parseOrExit(args, compareUsage)
+
+	if len(positional) != 2 {
+		fatalf(exitUsage, "Error: two input files required")
+	}
+	if positional[0] == stdioPath && positional[1] == stdioPath {
+		fatalf(exitUsage, "Error: only one machine can be read from standard input")
+	}
+	co.Seed = int64(seed)
+
+	a, err := loadFSMWithMachine(positional[0], machineA)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", positional[0], err)
+	}
+	b, err := loadFSMWithMachine(positional[1], machineB)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", positional[1], err)
+	}
+
+	res, err := fsm.CompareBehavior(a, b, co)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if opts.json {
+		printJSON(res)
+	} else {
+		printCompare(positional[0], positional[1], res)
+	}
+	if res.Divergence != nil {
+		os.Exit(exitInvalid)
+	}
+}
+
+func printCompare(nameA, nameB string, res fsm.CompareResult) {
+	d := res.Divergence
+	if d == nil {
+		fmt.Printf("No divergence in %d sequences of up to %d inputs (%d steps, seed %d)\n", res.Runs, res.MaxLen, res.Steps, res.Seed)
+		return
+	}
+
+	if len(d.Inputs) == 0 {
+		fmt.Printf("Diverged from the start (sequence %d, seed %d)\n", d.Run, res.Seed)
+	} else {
+		inputs := "inputs"
+		if len(d.Inputs) == 1 {
+			inputs = "input"
+		}
+		fmt.Printf("Diverged after %d %s (sequence %d, seed %d):\n", len(d.Inputs), inputs, d.Run, res.Seed)
+		fmt.Printf("  %s\n", strings.Join(d.Inputs, " "))
+	}
+	fmt.Println()
+
+	width := len(nameA)
+	if len(nameB) > width {
+		width = len(nameB)
+	}
+	for _, side := range []struct {
+		name string
+		o    fsm.Observation
+	}{{nameA, d.A}, {nameB, d.B}} {
+		o := side.o
+		state := o.State
+		if o.Stuck {
+			state = "stuck (no transition)"
+		}
+		accept := "rejects"
+		if o.Accepting {
+			accept = "accepts"
+		}
+		line := fmt.Sprintf("  %-*s  %s, %s", width, side.name, state, accept)
+		if o.Output != "" {
+			line += fmt.Sprintf(", output %q", o.Output)
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,69 @@
+// config.go — defaults read from the fsm config file.
+//
+// The config file, ~/.config/fsm/config.toml unless --config names
+// another, holds defaults for flags that would otherwise be retyped on
+// every invocation: the renderer and theme for png, svg, and view, where
+// output files go, the code generator's language and options, and the
+// path to fsmedit. Flags given on the command line take precedence, and
+// --no-config ignores the file altogether.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// config holds the defaults loaded by loadConfig.
+var config fsmfile.CLIConfig
+
+// loadConfig reads the config file into config. A missing default config
+// file is not an error; a missing file named with --config is.
+func loadConfig() {
+	if opts.noConfig {
+		return
+	}
+	path := opts.configPath
+	if path == "" {
+		path = fsmfile.DefaultCLIConfigPath()
+		if _, err := os.Stat(path); path == "" || err != nil {
+			return
+		}
+	}
+	cfg, err := fsmfile.LoadCLIConfig(expandHome(path))
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading config: %v", err)
+	}
+	cfg.OutputDir = expandHome(cfg.OutputDir)
+	cfg.Editor = expandHome(cfg.Editor)
+	config = cfg
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
+
+// defaultOutputPath places an output file that was named after its input
+// in the configured output directory, creating the directory if needed.
+// Without an output_dir setting name is returned unchanged.
+func defaultOutputPath(name string) string {
+	if config.OutputDir == "" {
+		return name
+	}
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		fatalf(exitIO, "Error creating output directory: %v", err)
+	}
+	return filepath.Join(config.OutputDir, name)
+}
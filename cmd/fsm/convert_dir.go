@@ -0,0 +1,113 @@
+// convert_dir.go — directory inputs and image outputs for "fsm convert".
+//
+// A directory given to convert stands for every machine file beneath it,
+// so that "fsm convert machines/ --to svg --out-dir build" regenerates
+// the diagrams of a whole repository in one command. --out-dir mirrors
+// the layout of the directory under the output directory.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// convertInput is a file for convert, with its path relative to the
+// directory it was found in, or its base name if it was named itself.
+type convertInput struct {
+	path string
+	rel  string
+}
+
+// convertImageFormats are the --to formats that are drawn rather than
+// written as a machine file.
+var convertImageFormats = []string{"svg", "png", "dot"}
+
+// convertExtension returns the extension convert gives output in the
+// named --to format.
+func convertExtension(format string) (string, bool) {
+	if ft := fsmfile.FormatByName(format); ft != nil {
+		return ft.Extensions()[0], true
+	}
+	for _, name := range convertImageFormats {
+		if name == format {
+			return "." + name, true
+		}
+	}
+	return "", false
+}
+
+// machineFilesIn returns the machine files under dir, by extension,
+// skipping hidden directories and skip, the output directory.
+func machineFilesIn(dir, skip string) ([]convertInput, error) {
+	skipAbs := ""
+	if skip != "" {
+		skipAbs, _ = filepath.Abs(skip)
+	}
+	var found []convertInput
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if abs, _ := filepath.Abs(path); skipAbs != "" && abs == skipAbs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fsmfile.IsMachineFile(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		found = append(found, convertInput{path: path, rel: rel})
+		return nil
+	})
+	return found, err
+}
+
+// writeConverted writes f to path, drawing it with the native renderer
+// if the extension is an image's, and otherwise in the machine format
+// the extension names.
+func writeConverted(path string, f *fsm.FSM, pretty, labels bool) error {
+	title := f.Name
+	if title == "" {
+		title = fmt.Sprintf("%s: %d states", strings.ToUpper(string(f.Type)), len(f.States))
+	}
+	switch filepath.Ext(path) {
+	case ".svg":
+		opts := fsmfile.DefaultSVGOptions()
+		opts.Title = title
+		opts.Logger = debugLogger()
+		return os.WriteFile(path, []byte(fsmfile.GenerateSVGNative(f, opts)), 0644)
+	case ".png":
+		opts := fsmfile.DefaultPNGOptions()
+		opts.Title = title
+		opts.Logger = debugLogger()
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := fsmfile.RenderPNG(f, out, opts); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	case ".dot":
+		opts := fsmfile.DefaultDOTOptions()
+		opts.Title = title
+		return os.WriteFile(path, []byte(fsmfile.GenerateDOTWithOptions(f, opts)), 0644)
+	}
+	return saveFSM(path, f, pretty, labels)
+}
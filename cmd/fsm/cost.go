@@ -0,0 +1,152 @@
+// cost.go — "fsm cost" subcommand.
+//
+// Finds the cheapest path between two states, with each transition
+// costing its weight, and the expected cost of getting there on a
+// random run. With --json the result is printed as an object.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const costUsage = `Usage: fsm cost <input|-> [-m machine] [--from STATE] [--to STATE]
+
+Find the cheapest path from one state to another, where each transition
+costs its "weight" (1 if it has none), and the expected cost of reaching
+the target on a random run, where each input is equally likely and a
+state's transitions on an input are chosen by their probabilities.
+Without --to, list the cheapest cost of reaching every state.
+
+Options:
+  -m, --machine   Select machine from bundle
+  --from          Start state (default: the initial state)
+  --to            Target state
+
+Examples:
+  fsm cost network.fsm --from idle --to connected
+  fsm cost network.fsm --json | jq '.paths.connected.cost'
+`
+
+// costReport is the --json form of fsm cost.
+type costReport struct {
+	From         string                  `json:"from"`
+	To           string                  `json:"to,omitempty"`
+	Path         *fsm.CostPath           `json:"path,omitempty"`
+	ExpectedCost *float64                `json:"expected_cost,omitempty"` // absent if the target may never be reached
+	Paths        map[string]fsm.CostPath `json:"paths,omitempty"`
+}
+
+func cmdCost(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", costUsage)
+	}
+
+	var machineName, from, to string
+	fs := newFlagSet("cost")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&from, "--from")
+	fs.String(&to, "--to")
+	positional := fs.parseOrExit(args, costUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	if from == "" {
+		from = f.Initial
+	}
+
+	paths, err := f.CheapestPaths(from)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	report := costReport{From: from, To: to}
+	if to == "" {
+		report.Paths = paths
+		if opts.json {
+			printJSON(report)
+			return
+		}
+		printCostTable(f, from, paths)
+		return
+	}
+
+	expected, err := f.ExpectedCosts(to)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if path, ok := paths[to]; ok {
+		report.Path = &path
+	}
+	if e := expected[from]; !math.IsInf(e, 1) {
+		report.ExpectedCost = &e
+	}
+	if opts.json {
+		printJSON(report)
+	} else {
+		printCostPath(report)
+	}
+	if report.Path == nil {
+		os.Exit(exitFailure)
+	}
+}
+
+func printCostPath(r costReport) {
+	if r.Path == nil {
+		fmt.Printf("No path from %s to %s\n", r.From, r.To)
+		return
+	}
+	fmt.Printf("Cheapest path from %s to %s: cost %s\n", r.From, r.To, formatCost(r.Path.Cost))
+	for _, s := range r.Path.Steps {
+		in := "ε"
+		if s.Input != nil {
+			in = *s.Input
+		}
+		fmt.Printf("  %s --%s--> %s  (%s)\n", s.From, in, s.To, formatCost(s.Cost))
+	}
+	fmt.Println()
+	if r.ExpectedCost == nil {
+		fmt.Printf("Expected cost: infinite (a random run from %s may never reach %s)\n", r.From, r.To)
+	} else {
+		fmt.Printf("Expected cost: %s (random run from %s)\n", formatCost(*r.ExpectedCost), r.From)
+	}
+}
+
+func printCostTable(f *fsm.FSM, from string, paths map[string]fsm.CostPath) {
+	v := f.Vocab()
+	width := len(v.State)
+	for _, s := range f.States {
+		if len(s) > width {
+			width = len(s)
+		}
+	}
+	fmt.Printf("Cheapest costs from %s\n\n", from)
+	fmt.Printf("%-*s  %10s  %5s\n", width, v.State, "Cost", "Steps")
+	for _, s := range f.States {
+		p, ok := paths[s]
+		if !ok {
+			fmt.Printf("%-*s  %10s  %5s\n", width, s, "-", "-")
+			continue
+		}
+		fmt.Printf("%-*s  %10s  %5d\n", width, s, formatCost(p.Cost), len(p.Steps))
+	}
+}
+
+// formatCost prints whole costs without decimals and others to two
+// places.
+func formatCost(c float64) string {
+	if c == math.Trunc(c) && math.Abs(c) < 1e15 {
+		return fmt.Sprintf("%.0f", c)
+	}
+	return fmt.Sprintf("%.2f", c)
+}
@@ -0,0 +1,87 @@
+// exitcode.go — exit codes and the --error-format json error report.
+//
+// Every command exits with one of the codes below when it fails, so that
+// a script can tell a machine that failed validation from one that could
+// not be read without parsing the message. With --error-format json the
+// message is also written to stderr as a JSON object:
+//
+//   {"error": {"kind": "parse", "code": 4, "message": "..."}}
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Exit codes. Anything that is not one of the more specific kinds exits
+// with exitFailure.
+const (
+	exitFailure    = 1 // any other error
+	exitUsage      = 2 // bad command line: unknown flag, missing or conflicting arguments
+	exitInvalid    = 3 // a machine failed a check: validate, lint, test, check, replay
+	exitParse      = 4 // an input could not be parsed
+	exitDependency = 5 // a program the command needs, such as Graphviz, was not found
+	exitIO         = 6 // a file could not be read or written
+)
+
+// exitKinds names each exit code in the JSON error report.
+var exitKinds = map[int]string{
+	exitFailure:    "error",
+	exitUsage:      "usage",
+	exitInvalid:    "invalid",
+	exitParse:      "parse",
+	exitDependency: "dependency",
+	exitIO:         "io",
+}
+
+// errorReport is the JSON written to stderr by fatalf with
+// --error-format json.
+type errorReport struct {
+	Error struct {
+		Kind    string `json:"kind"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Detail  string `json:"detail,omitempty"`
+	} `json:"error"`
+}
+
+// fatalf prints an error message to stderr and exits with code. The
+// message is printed as given, with a newline added if it has none, or
+// with --error-format json as an errorReport whose message is its first
+// line, without any "Error: " prefix, and whose detail is the rest.
+func fatalf(code int, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if opts.errorFormat != "json" {
+		if !strings.HasSuffix(msg, "\n") {
+			msg += "\n"
+		}
+		fmt.Fprint(os.Stderr, msg)
+		os.Exit(code)
+	}
+
+	var r errorReport
+	first, rest, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+	r.Error.Kind = exitKinds[code]
+	r.Error.Code = code
+	r.Error.Message = strings.TrimPrefix(first, "Error: ")
+	r.Error.Detail = strings.TrimSpace(rest)
+	enc := json.NewEncoder(os.Stderr)
+	enc.SetEscapeHTML(false)
+	enc.Encode(r)
+	os.Exit(code)
+}
+
+// loadErrorCode returns the exit code for err, an error from loading an
+// input: exitIO if the file could not be read, and exitParse otherwise.
+func loadErrorCode(err error) int {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return exitIO
+	}
+	return exitParse
+}
@@ -0,0 +1,167 @@
+// extract.go — "fsm extract" subcommand.
+//
+// Extracts either a whole machine from a bundle, or a subgraph (chosen
+// states, optionally with everything reachable from them) from any
+// machine, for documenting one subsystem of a large controller.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const extractUsage = `Usage: fsm extract <bundle.fsm> --machine <name> [-o output.fsm]
+       fsm extract <input|-> --states a,b,c [--closure] [-m machine] [-o output]
+
+Extract a single machine from a bundle, keeping its layout and labels.
+
+With --states, extract the named states instead, as a machine of their
+own: transitions between them are kept, and transitions leading out of
+the subgraph are dropped. --closure adds every state reachable from the
+named ones. The initial state is kept if it is included; otherwise the
+first named state becomes initial.
+
+Options:
+  -m, --machine   Machine to extract from a bundle (required without --states)
+  -o, --output    Output file (default: <name>.fsm; with --states, stdout)
+  --states LIST   Comma-separated states to extract
+  --closure       Also extract every state reachable from them
+  -f, --format    Stdout format with --states: json (default), fsm, text, hex
+
+Examples:
+  fsm extract system.fsm --machine parser -o parser.fsm
+  fsm extract controller.fsm --states idle,run,stop -o motion.fsm
+  fsm extract controller.json --states run --closure | fsm report - -o run.md
+`
+
+func cmdExtract(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", extractUsage)
+	}
+
+	var machineName, output, stateList, format string
+	var closure bool
+	fs := newFlagSet("extract")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&output, "-o", "--output")
+	fs.String(&stateList, "--states")
+	fs.Bool(&closure, "--closure")
+	fs.String(&format, "-f", "--format")
+	positional := fs.parseOrExit(args, extractUsage)
+	format = strings.ToLower(format)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file is required")
+	}
+	input := positional[0]
+
+	if stateList != "" {
+		extractSubgraph(input, machineName, output, format, stateList, closure)
+		return
+	}
+	if closure {
+		fatalf(exitUsage, "Error: --closure needs --states")
+	}
+
+	if machineName == "" {
+		fatalf(exitUsage, "Error: --machine name is required")
+	}
+
+	if output == "" {
+		output = machineName + ".fsm"
+	}
+
+	// Extract machine
+	f, layout, err := fsmfile.ReadMachineFromBundle(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error extracting %s: %v", machineName, err)
+	}
+
+	// Write to output
+	var positions map[string][2]int
+	var offsetX, offsetY int
+	if layout != nil {
+		positions = make(map[string][2]int)
+		for name, pos := range layout.States {
+			positions[name] = [2]int{pos.X, pos.Y}
+		}
+		offsetX = layout.Editor.CanvasOffsetX
+		offsetY = layout.Editor.CanvasOffsetY
+	}
+
+	err = fsmfile.WriteFSMFileWithLayout(output, f, true, positions, offsetX, offsetY)
+	if err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+
+	fmt.Printf("Extracted %s to %s\n", machineName, output)
+}
+
+// extractSubgraph writes the part of a machine made up of the states in
+// stateList (and, with closure, those reachable from them), keeping the
+// layout of the states that remain.
+func extractSubgraph(input, machineName, output, format, stateList string, closure bool) {
+	var states []string
+	for _, s := range strings.Split(stateList, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			states = append(states, s)
+		}
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	sub, err := f.Subgraph(states, closure)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+
+	layout := loadLayoutWithMachine(input, machineName)
+	if layout != nil {
+		kept := make(map[string]fsmfile.StateLayout, len(sub.States))
+		for _, s := range sub.States {
+			if sl, ok := layout.States[s]; ok {
+				kept[s] = sl
+			}
+		}
+		layout.States = kept
+	}
+
+	if err := writeFSMOutputWithLayout(output, format, sub, layout); err != nil {
+		fatalf(exitIO, "Error writing output: %v", err)
+	}
+
+	if !opts.quiet {
+		fmt.Fprintf(os.Stderr, "extract: %d of %d states, %d of %d transitions\n",
+			len(sub.States), len(f.States), len(sub.Transitions), len(f.Transitions))
+		if dangling := danglingCount(f, sub); dangling > 0 {
+			fmt.Fprintf(os.Stderr, "extract: dropped %d transitions leaving the subgraph\n", dangling)
+		}
+	}
+}
+
+// danglingCount returns how many transitions from states in sub led only
+// to states outside it, and so were dropped.
+func danglingCount(f, sub *fsm.FSM) int {
+	n := 0
+	for _, t := range f.Transitions {
+		if !sub.HasState(t.From) {
+			continue
+		}
+		inside := false
+		for _, to := range t.To {
+			inside = inside || sub.HasState(to)
+		}
+		if !inside {
+			n++
+		}
+	}
+	return n
+}
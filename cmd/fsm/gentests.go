@@ -0,0 +1,237 @@
+// gentests.go — "fsm gen-tests" and "fsm test" subcommands.
+//
+// gen-tests writes a test suite (.fsmtest) for a machine: input
+// sequences chosen by a transition tour or the W-method, each with the
+// verdict and outputs the machine gives it. test runs a suite against a
+// machine, such as a revised or hand-written version, and reports the
+// cases it fails. With --json, test prints the failures as an array.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const genTestsUsage = `Usage: fsm gen-tests <input|-> [--method transition-tour|w-method]
+                     [--extra-states N] [-o tests.fsmtest] [-m machine]
+
+Generate a test suite: input sequences, each with the verdict (accept,
+reject, or stuck) and the outputs the machine gives it, in the .fsmtest
+format read by "fsm test".
+
+Methods:
+  transition-tour   Take every reachable transition at least once, in
+                    as few sequences as a greedy tour allows (default)
+  w-method          Chow's W-method: every transition followed by
+                    sequences telling its target from every other state.
+                    An implementation passing the suite behaves like a
+                    minimal machine, unless it has more states than it
+                    (allow for them with --extra-states)
+
+Options:
+  --method        Test selection method (default: transition-tour)
+  --extra-states  Extra implementation states the W-method allows for
+                  (default: 0); each multiplies the suite by the
+                  alphabet size
+  -o, --output    Output file (default: stdout)
+  -m, --machine   Select machine from bundle
+
+Examples:
+  fsm gen-tests turnstile.fsm -o turnstile.fsmtest
+  fsm gen-tests protocol.json --method w-method --extra-states 1 -o protocol.fsmtest
+`
+
+const testUsage = `Usage: fsm test <input|-> <tests.fsmtest> [-m machine]
+
+Run a test suite against a machine and report the cases it fails. Each
+line of the suite is an input sequence and the expected verdict, with
+optional outputs:
+
+  coin push => accept / click ""
+  push coin coin => stuck / alarm click
+
+A case passes when the machine, run from its initial state, ends with
+the same verdict, stuck on the same input if stuck, and gives the same
+outputs. Exits with status 3 if any case fails.
+
+Options:
+  -m, --machine   Select machine from bundle
+
+Examples:
+  fsm gen-tests spec.fsm -o spec.fsmtest && fsm test impl.fsm spec.fsmtest
+`
+
+func cmdGenTests(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", genTestsUsage)
+	}
+
+	var output, machineName, method string
+	var to fsm.TestGenOptions
+	fs := newFlagSet("gen-tests")
+	fs.String(&method, "--method")
+	fs.Int(&to.ExtraStates, "--extra-states")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	positional := fs.parseOrExit(args, genTestsUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	to.Method = fsm.TestMethod(method)
+	if to.Method == "" {
+		to.Method = fsm.TestTransitionTour
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	cases, err := fsm.GenerateTests(f, to)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+
+	name := f.Name
+	if name == "" {
+		name = input
+	}
+	noun := "cases"
+	if len(cases) == 1 {
+		noun = "case"
+	}
+	comment := fmt.Sprintf("%s: %d %s, %s", name, len(cases), noun, to.Method)
+	if to.Method == fsm.TestWMethod && to.ExtraStates > 0 {
+		comment += fmt.Sprintf(" with %d extra states", to.ExtraStates)
+	}
+
+	if output == "" {
+		output = stdioPath
+	}
+	w, err := createOutput(output)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", output, err)
+	}
+	if _, err := w.Write(fsmfile.FormatTests(cases, comment)); err != nil {
+		w.Close()
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if err := w.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if output != stdioPath {
+		infof("Wrote %d test cases to %s\n", len(cases), output)
+	}
+}
+
+// testFailure is a failed test case and what the machine did instead.
+type testFailure struct {
+	Line     int          `json:"line"`
+	Expected fsm.TestCase `json:"expected"`
+	Got      fsm.TestCase `json:"got"`
+}
+
+func cmdTest(args []string) {
+	if len(args) < 2 {
+		fatalf(exitUsage, "%s", testUsage)
+	}
+
+	var machineName string
+	fs := newFlagSet("test")
+	fs.String(&machineName, "-m", "--machine")
+	positional := fs.parseOrExit(args, testUsage)
+
+	if len(positional) != 2 {
+		fatalf(exitUsage, "Error: a machine and a test suite are required")
+	}
+	input, suite := positional[0], positional[1]
+	if suite == stdioPath {
+		fatalf(exitUsage, "Error: the test suite must be a file")
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	data, err := os.ReadFile(suite)
+	if err != nil {
+		fatalf(exitIO, "Error: %v", err)
+	}
+	cases, err := fsmfile.ParseTests(data)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error in %s: %v", suite, err)
+	}
+	lines := testCaseLines(data)
+
+	failures := []testFailure{}
+	for i, tc := range cases {
+		got, err := fsm.RunTestCase(f, tc.Inputs)
+		if err != nil {
+			fatalf(exitFailure, "Error: %v", err)
+		}
+		if !tc.Matches(got) {
+			failures = append(failures, testFailure{Line: lines[i], Expected: tc, Got: got})
+		}
+	}
+
+	if opts.json {
+		printJSON(failures)
+	} else {
+		for _, fl := range failures {
+			fmt.Printf("FAIL %s:%d: %s\n", suite, fl.Line, formatInputSeq(fl.Expected.Inputs))
+			fmt.Printf("  expected %s\n", describeTestCase(fl.Expected))
+			fmt.Printf("  got      %s\n", describeTestCase(fl.Got))
+		}
+		fmt.Printf("%d of %d cases passed\n", len(cases)-len(failures), len(cases))
+	}
+	if len(failures) > 0 {
+		os.Exit(exitInvalid)
+	}
+}
+
+// testCaseLines returns the line number of each test case in a suite
+// ParseTests has read.
+func testCaseLines(data []byte) []int {
+	var lines []int
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, n+1)
+		}
+	}
+	return lines
+}
+
+func formatInputSeq(inputs []string) string {
+	if len(inputs) == 0 {
+		return "(no inputs)"
+	}
+	return strings.Join(inputs, " ")
+}
+
+// describeTestCase renders a verdict and outputs for a failure report.
+func describeTestCase(tc fsm.TestCase) string {
+	var s string
+	switch {
+	case tc.Stuck:
+		s = fmt.Sprintf("stuck on input %d (%s)", len(tc.Inputs), tc.Inputs[len(tc.Inputs)-1])
+	case tc.Accept:
+		s = "accept"
+	default:
+		s = "reject"
+	}
+	if len(tc.Outputs) > 0 {
+		quoted := make([]string, len(tc.Outputs))
+		for i, o := range tc.Outputs {
+			quoted[i] = fmt.Sprintf("%q", o)
+		}
+		s += ", outputs " + strings.Join(quoted, " ")
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+// gogenerate.go — "fsm generate --go-generate" support.
+//
+// In go:generate mode the output is a gofmt-formatted Go file next to the
+// package that uses it, the package name is inferred from the target
+// directory, and the file is only rewritten when its content changes, so
+// repeated runs leave the tree untouched. --check compares instead of
+// writing, for CI.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// goGenerateOutput is the default output file for go:generate mode:
+// the input's base name with an _fsm.go suffix, in the current
+// directory, which go generate sets to the package's directory.
+func goGenerateOutput(input string) string {
+	base := filepath.Base(input)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return base + "_fsm.go"
+}
+
+// inferGoPackage returns the package name for a Go file written to dir:
+// $GOPACKAGE when go generate runs in dir, else the package of the
+// other Go files there (skipping skip, the file being generated), else
+// the directory's name made into an identifier.
+func inferGoPackage(dir, skip string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	if pkg := os.Getenv("GOPACKAGE"); pkg != "" {
+		if wd, err := os.Getwd(); err == nil && wd == abs {
+			return pkg
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") || filepath.Base(path) == filepath.Base(skip) {
+			continue
+		}
+		if file, err := parser.ParseFile(fset, path, nil, parser.PackageClauseOnly); err == nil {
+			return file.Name.Name
+		}
+	}
+
+	var sb strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(abs)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			sb.WriteRune(r)
+		}
+	}
+	name := sb.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return "fsm"
+	}
+	return name
+}
+
+// formatGo runs generated Go source through gofmt.
+func formatGo(code string) (string, error) {
+	formatted, err := format.Source([]byte(code))
+	if err != nil {
+		return "", fmt.Errorf("formatting generated code: %w", err)
+	}
+	return string(formatted), nil
+}
+
+// errNotGenerated is wrapped by the errors writeGenerated returns with
+// check for a file that is out of date or missing.
+var errNotGenerated = errors.New("run go generate")
+
+// writeGenerated writes code to path unless the file already holds
+// exactly that content. With check, nothing is written and an
+// out-of-date or missing file is an error wrapping errNotGenerated.
+func writeGenerated(path, code string, check bool) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch {
+	case err == nil && bytes.Equal(existing, []byte(code)):
+		infof("Up to date: %s\n", path)
+		return nil
+	case check && err != nil:
+		return fmt.Errorf("%s does not exist; %w", path, errNotGenerated)
+	case check:
+		return fmt.Errorf("%s is out of date; %w", path, errNotGenerated)
+	}
+	if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+		return err
+	}
+	infof("Generated: %s\n", path)
+	return nil
+}
+
+// generatedErrorCode returns the exit code for err, an error from
+// writeGenerated: exitInvalid if --check found the file out of date, and
+// exitIO otherwise.
+func generatedErrorCode(err error) int {
+	if errors.Is(err, errNotGenerated) {
+		return exitInvalid
+	}
+	return exitIO
+}
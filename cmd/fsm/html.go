@@ -0,0 +1,118 @@
+// html.go — "fsm html" subcommand.
+//
+// Writes a single self-contained HTML page with the native SVG diagram
+// and input buttons that step the machine in the browser, so that people
+// without the toolkit can review a machine's behaviour.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const htmlUsage = `Usage: fsm html <input> [-o output.html] [-t title] [-m machine] [options]
+
+Write a self-contained HTML page showing the machine's diagram with one
+button per input symbol. Clicking a button steps the machine and
+highlights the active states and the transition taken. The page works
+offline and can be opened directly from disk.
+
+Options:
+  -o, --output    Output file (default: input name with .html extension)
+  -t, --title     Page heading (default: FSM name)
+  -m, --machine   Select machine from bundle
+  --theme NAME    Diagram colour theme (default, dark, mono, print)
+  --use-layout    Place states where fsmedit saved them (.fsm input)
+  --width N       Diagram width in pixels (default: 800)
+  --height N      Diagram height in pixels (default: 600)
+
+Examples:
+  fsm html turnstile.json -o turnstile.html
+  fsm html bundle.fsm -m parser --use-layout
+`
+
+func cmdHTML(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", htmlUsage)
+	}
+
+	var output, title, machineName, themeName string
+	var useLayout bool
+	var width, height int
+	fs := newFlagSet("html")
+	fs.String(&output, "-o", "--output")
+	fs.String(&title, "-t", "--title")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&themeName, "--theme")
+	fs.Bool(&useLayout, "--use-layout")
+	fs.Int(&width, "--width")
+	fs.Int(&height, "--height")
+	positional := fs.parseOrExit(args, htmlUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	htmlOpts := fsmfile.DefaultHTMLOptions()
+	htmlOpts.Title = title
+	if themeName != "" {
+		theme, ok := fsmfile.ThemeByName(themeName)
+		if !ok {
+			fatalf(exitUsage, "Error: unknown theme %q (available: %s)", themeName, strings.Join(fsmfile.ThemeNames(), ", "))
+		}
+		htmlOpts.SVG.Theme = theme
+	}
+	if width > 0 {
+		htmlOpts.SVG.Width = width
+	}
+	if height > 0 {
+		htmlOpts.SVG.Height = height
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	if useLayout {
+		htmlOpts.SVG.UseLayout = loadLayoutWithMachine(input, machineName)
+		if htmlOpts.SVG.UseLayout == nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s has no saved layout; using automatic layout\n", input)
+		}
+	}
+
+	page, err := fsmfile.GenerateHTML(f, htmlOpts)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+
+	if output == "" && input == stdioPath {
+		output = stdioPath
+	} else if output == "" {
+		base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+		if machineName != "" {
+			base = machineName
+		}
+		output = base + ".html"
+	}
+	w, err := createOutput(output)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", output, err)
+	}
+	if _, err := io.WriteString(w, page); err != nil {
+		w.Close()
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if err := w.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if output != stdioPath {
+		infof("Generated: %s\n", output)
+	}
+}
@@ -0,0 +1,93 @@
+// isomorphic.go — "fsm isomorphic" subcommand.
+//
+// Checks whether two machines are the same up to the names of their
+// states, and prints the renaming that maps one onto the other. With
+// --json the verdict, mapping, and reason are printed as an object.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const isomorphicUsage = `Usage: fsm isomorphic <a> <b> [--machine-a NAME] [--machine-b NAME]
+
+Check whether two machines are identical up to state renaming, and print
+the renaming. They must have the same type and alphabets, and a one-to-one
+mapping of states must carry a's initial state, accepting states, state
+outputs, and every transition (input, output, targets, probability,
+weight, stack operations) exactly onto b's. Layout, names, descriptions,
+classes, and metadata are ignored. Exits with status 3 if the machines
+are not isomorphic.
+
+This is stricter than equivalence of behaviour: a machine and its
+minimised form behave alike but are not isomorphic. Use it to check that
+a generated model is a hand-written one with different names.
+
+Options:
+  --machine-a     Select machine from bundle a
+  --machine-b     Select machine from bundle b
+
+Examples:
+  fsm isomorphic handwritten.fsm generated.json
+  fsm isomorphic system.fsm system.fsm --machine-a door --machine-b door_v2
+`
+
+// isomorphicReport is the --json output of "fsm isomorphic".
+type isomorphicReport struct {
+	Isomorphic bool              `json:"isomorphic"`
+	Mapping    map[string]string `json:"mapping,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+}
+
+func cmdIsomorphic(args []string) {
+	if len(args) < 2 {
+		fatalf(exitUsage, "%s", isomorphicUsage)
+	}
+
+	var machineA, machineB string
+	fs := newFlagSet("isomorphic")
+	fs.String(&machineA, "--machine-a")
+	fs.String(&machineB, "--machine-b")
+	positional := fs.parseOrExit(args, isomorphicUsage)
+
+	if len(positional) != 2 {
+		fatalf(exitUsage, "Error: two input files required")
+	}
+	if positional[0] == stdioPath && positional[1] == stdioPath {
+		fatalf(exitUsage, "Error: only one machine can be read from standard input")
+	}
+
+	a, err := loadFSMWithMachine(positional[0], machineA)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", positional[0], err)
+	}
+	b, err := loadFSMWithMachine(positional[1], machineB)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", positional[1], err)
+	}
+
+	mapping, reason := fsm.Isomorphism(a, b)
+	if opts.json {
+		printJSON(isomorphicReport{Isomorphic: mapping != nil, Mapping: mapping, Reason: reason})
+	} else if mapping == nil {
+		fmt.Printf("Not isomorphic: %s\n", reason)
+	} else {
+		fmt.Println("Isomorphic:")
+		width := 0
+		for _, s := range a.States {
+			if len(s) > width {
+				width = len(s)
+			}
+		}
+		for _, s := range a.States {
+			fmt.Printf("  %-*s -> %s\n", width, s, mapping[s])
+		}
+	}
+	if mapping == nil {
+		os.Exit(exitInvalid)
+	}
+}
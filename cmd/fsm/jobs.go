@@ -0,0 +1,57 @@
+// jobs.go — the worker pool behind --jobs.
+//
+// Commands that process many files (convert, build, and png or svg with
+// --all) run them on a bounded number of goroutines. Each job keeps its
+// result in a slot of its own, and the command reports them in input
+// order once all are done, so the output is the same whatever the number
+// of jobs.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// runJobs calls do for each index below n, running at most jobs calls at
+// once, and returns when every call has. With jobs below 1 it runs one
+// call per CPU.
+func runJobs(n, jobs int, do func(i int)) {
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > n {
+		jobs = n
+	}
+	if jobs <= 1 {
+		for i := 0; i < n; i++ {
+			do(i)
+		}
+		return
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				do(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// checkJobs exits with an error if n, the value of --jobs, is negative.
+// Zero, the default, means one job per CPU.
+func checkJobs(n int) {
+	if n < 0 {
+		fatalf(exitUsage, "Error: --jobs must be at least 1 (or 0 for one per CPU)")
+	}
+}
@@ -0,0 +1,191 @@
+// lint.go — "fsm lint" subcommand.
+//
+// Runs Validate and Analyse with severities taken from .fsmlint.toml
+// (searched from the input's directory upwards, or given with --config),
+// plus naming-convention checks. Exits 3 if any error-level issue is found,
+// or any issue at all with --strict, so it can gate CI.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const lintUsage = `Usage: fsm lint <input|-> [-m machine] [--all] [--config file] [--strict]
+
+Check a machine against configurable rules and exit non-zero on errors.
+
+Rules (default severity):
+  invalid            Structural validation failed (error)
+  unreachable        States not reachable from the initial state (warning)
+  dead               Non-accepting states with no way out (warning)
+  nondeterministic   DFA with several transitions on one input (warning)
+  incomplete         DFA states missing transitions (warning)
+  unused_input       Inputs never used (warning)
+  unused_output      Outputs never used (warning)
+  state_naming       State names not matching [naming] states (error)
+  input_naming       Inputs not matching [naming] inputs (error)
+  output_naming      Outputs not matching [naming] outputs (error)
+
+Options:
+  -m, --machine   Select machine from bundle
+  --all           Lint every machine in a bundle
+  -c, --config    Config file (default: nearest .fsmlint.toml)
+  --strict        Treat warnings as errors
+
+Example .fsmlint.toml:
+  [rules]
+  nondeterministic = "error"
+  unreachable = "error"
+  unused_output = "off"
+
+  [naming]
+  states = '^[a-z_]+$'
+`
+
+// lintResult is the --json output for one machine.
+type lintResult struct {
+	Machine  string          `json:"machine,omitempty"`
+	Issues   []fsm.LintIssue `json:"issues"`
+	Errors   int             `json:"errors"`
+	Warnings int             `json:"warnings"`
+}
+
+func cmdLint(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", lintUsage)
+	}
+
+	var machineName, configPath string
+	var all, strict bool
+	fs := newFlagSet("lint")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&configPath, "-c", "--config")
+	fs.Bool(&all, "--all")
+	fs.Bool(&strict, "--strict")
+	positional := fs.parseOrExit(args, lintUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	if configPath == "" {
+		dir := "."
+		if input != stdioPath {
+			dir = filepath.Dir(input)
+		}
+		configPath = fsmfile.FindLintConfig(dir)
+	}
+	var cfg fsm.LintConfig
+	if configPath != "" {
+		var err error
+		cfg, err = fsmfile.LoadLintConfig(configPath)
+		if err != nil {
+			fatalf(loadErrorCode(err), "Error reading lint config: %v", err)
+		}
+		if !opts.json {
+			infof("Using %s\n\n", configPath)
+		}
+	}
+
+	machines := map[string]*fsm.FSM{}
+	var order []string
+	if all {
+		list, err := fsmfile.ListMachines(input)
+		if err != nil {
+			fatalf(loadErrorCode(err), "Error listing machines: %v", err)
+		}
+		for _, m := range list {
+			f, _, err := fsmfile.ReadMachineFromBundle(input, m.Name)
+			if err != nil {
+				fatalf(loadErrorCode(err), "Error loading machine %s: %v", m.Name, err)
+			}
+			machines[m.Name] = f
+			order = append(order, m.Name)
+		}
+	} else {
+		f, err := loadFSMWithMachine(input, machineName)
+		if err != nil {
+			fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+		}
+		machines[machineName] = f
+		order = append(order, machineName)
+	}
+
+	var results []lintResult
+	failed := false
+	for _, name := range order {
+		issues, err := machines[name].Lint(cfg)
+		if err != nil {
+			fatalf(exitFailure, "Error: %v", err)
+		}
+		r := lintResult{Machine: name, Issues: issues}
+		if r.Issues == nil {
+			r.Issues = []fsm.LintIssue{}
+		}
+		for _, is := range issues {
+			switch is.Severity {
+			case fsm.SeverityError:
+				r.Errors++
+			case fsm.SeverityWarning:
+				r.Warnings++
+			}
+		}
+		if r.Errors > 0 || (strict && r.Warnings > 0) {
+			failed = true
+		}
+		results = append(results, r)
+	}
+
+	if opts.json {
+		if all {
+			printJSON(results)
+		} else {
+			printJSON(results[0])
+		}
+	} else {
+		for i, r := range results {
+			if all {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("=== %s ===\n", r.Machine)
+			}
+			printLintResult(r)
+		}
+	}
+
+	if failed {
+		os.Exit(exitInvalid)
+	}
+}
+
+func printLintResult(r lintResult) {
+	if len(r.Issues) == 0 {
+		fmt.Println(colorize(colorGreen, "No issues found."))
+		return
+	}
+	for _, is := range r.Issues {
+		label := fmt.Sprintf("%-7s", is.Severity)
+		switch is.Severity {
+		case fsm.SeverityError:
+			label = colorize(colorRed, label)
+		case fsm.SeverityWarning:
+			label = colorize(colorYellow, label)
+		}
+		fmt.Printf("  %s [%s] %s\n", label, is.Rule, is.Message)
+		if len(is.States) > 0 {
+			fmt.Printf("          States: %v\n", is.States)
+		}
+		if len(is.Symbols) > 0 {
+			fmt.Printf("          Symbols: %v\n", is.Symbols)
+		}
+	}
+	fmt.Printf("\n%d error(s), %d warning(s)\n", r.Errors, r.Warnings)
+}
@@ -0,0 +1,39 @@
+// lsp.go — "fsm lsp" subcommand.
+//
+// Runs the language server for the text format (see package lsp) on
+// stdin and stdout, for editors such as VS Code and Neovim.
+
+package main
+
+import (
+	"os"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/lsp"
+)
+
+const lspUsage = `Usage: fsm lsp
+
+Run a Language Server Protocol server for .fsmt text machines on stdin
+and stdout. Editors start it themselves; it is not run by hand.
+
+Features:
+  Diagnostics       Syntax errors, and fsm lint findings (with the nearest
+                    .fsmlint.toml), on the lines they are about
+  Go to definition  The state line of a state, or the inputs or outputs
+                    line of a symbol
+  Find references   Every use of a state, symbol, or class
+  Rename            A state, symbol, or class, everywhere in the file
+  Completion        States, inputs after "on", outputs after "/"
+
+See the manual for editor set-up.
+`
+
+func cmdLSP(args []string) {
+	fs := newFlagSet("lsp")
+	if positional := fs.parseOrExit(args, lspUsage); len(positional) > 0 {
+		fatalf(exitUsage, "%s", lspUsage)
+	}
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+}
@@ -3,14 +3,21 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/codegen"
 	"github.com/ha1tch/fsm-toolkit/pkg/export"
@@ -19,28 +26,29 @@ import (
 	"github.com/ha1tch/fsm-toolkit/pkg/version"
 )
 
-const usage = `fsm - Finite State Machine toolkit
+const usageHeader = `fsm - Finite State Machine toolkit
 
 Usage:
-  fsm <command> [options]
+  fsm [global options] <command> [options]
 
 Commands:
-  convert    Convert between formats (json, hex, fsm)
-  dot        Generate Graphviz DOT output
-  png        Generate PNG image (requires Graphviz)
-  svg        Generate SVG image (requires Graphviz)
-  generate   Generate code (C, Rust, Go/TinyGo)
-  info       Show FSM information
-  machines   List machines in a bundle
-  analyse    Analyse FSM for potential issues (alias: analyze)
-  run        Run FSM interactively
-  validate   Validate FSM file
-  view       Visualise FSM (generates PNG and opens it)
-  edit       Open visual editor (invokes fsmedit)
-  bundle     Create bundle from multiple FSM files
-  extract    Extract machine from bundle
-  netlist    Export structural netlist (text, kicad, json)
-  properties Query state class assignments and property values
+`
+
+const usageFooter = `
+Global options:
+  -q, --quiet     Suppress informational messages
+  --json          Emit JSON (info, stats, analyse, lint, validate, convert,
+                  properties)
+  --no-color      Disable coloured output (also honours NO_COLOR)
+  --config PATH   Read defaults from PATH instead of ~/.config/fsm/config.toml
+                  (before the command name only)
+  --no-config     Ignore the config file
+  --error-format text|json
+                  Print errors on stderr as text or JSON; the exit code
+                  tells usage (2), check failed (3), parse (4), missing
+                  dependency (5), and I/O (6) errors apart
+  --debug         Trace layout and edge routing decisions, runner steps,
+                  simulated walks, and server requests on stderr
 
 Examples:
   fsm convert input.json -o output.fsm
@@ -50,7 +58,10 @@ Examples:
   fsm generate input.fsm --lang c -o fsm.h
   fsm generate bundle.fsm --all --lang go
   fsm analyse input.fsm
+  fsm --json info input.fsm | jq .states
+  fsm stats input.fsm --json
   fsm analyze bundle.fsm --all
+  fsm lint input.fsm --strict
   fsm view input.fsm
   fsm edit input.fsm
   fsm run input.fsm
@@ -59,201 +70,318 @@ Examples:
   fsm bundle main.fsm child.fsm -o combined.fsm
   fsm extract bundle.fsm --machine child -o child.fsm
   fsm netlist circuit.json --format kicad -o circuit.net
+  fsm determinize - < nfa.json | fsm minimize - | fsm dot -
+  fsm watch machine.json --do "svg --native,generate --lang go"
+
+Commands that read a machine accept - for stdin; the format is detected
+from the content. Use -o - to write to stdout.
 
 Use "fsm <command> -h" for more information about a command.
 `
 
+func usage() string {
+	return usageHeader + commandList() + usageFooter
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Print(usage)
-		os.Exit(1)
+	args := parseGlobalFlags(os.Args[1:])
+	if len(args) < 1 {
+		fmt.Print(usage())
+		os.Exit(exitUsage)
 	}
 
-	cmd := os.Args[1]
-	args := os.Args[2:]
+	cmd := args[0]
+	args = args[1:]
 
 	switch cmd {
-	case "convert":
-		cmdConvert(args)
-	case "dot":
-		cmdDot(args)
-	case "png":
-		cmdImage(args, "png")
-	case "svg":
-		cmdImage(args, "svg")
-	case "generate":
-		cmdGenerate(args)
-	case "info":
-		cmdInfo(args)
-	case "machines":
-		cmdMachines(args)
-	case "bundle":
-		cmdBundle(args)
-	case "extract":
-		cmdExtract(args)
-	case "analyse", "analyze":
-		cmdAnalyse(args)
-	case "run":
-		cmdRun(args)
-	case "validate":
-		cmdValidate(args)
-	case "netlist":
-		cmdNetlist(args)
-	case "properties":
-		cmdProperties(args)
-	case "view":
-		cmdView(args)
-	case "edit":
-		cmdEdit(args)
 	case "-h", "--help", "help":
-		fmt.Print(usage)
+		fmt.Print(usage())
+		return
 	case "-v", "--version", "version":
 		fmt.Printf("fsm %s\n", version.Version)
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
-		fmt.Print(usage)
-		os.Exit(1)
+		return
+	}
+
+	c := findCommand(cmd)
+	if c == nil {
+		fmt.Print(usage())
+		fatalf(exitUsage, "Unknown command: %s", cmd)
 	}
+	loadConfig()
+	c.run(args)
 }
 
+const convertUsage = `Usage: fsm convert <input>... [-o output] [--to FORMAT] [--out-dir DIR]
+                   [--jobs N] [--pretty] [--no-labels] [--format json|fsm|text|hex]
+
+Supports wildcards: fsm convert *.json -o .fsm
+When converting multiple files, -o specifies the output extension.
+A directory stands for every machine file beneath it.
+Use - as input to read stdin and -o - to write stdout (format from --format).
+
+Options:
+  -o, --output    Output file, or extension for multiple inputs
+  --to FORMAT     Output format for every input: json, fsm, text, hex, or
+                  svg, png, dot to draw each machine
+  --out-dir DIR   Write outputs under DIR, keeping the layout of directories
+  -j, --jobs N    Convert N files at once (default: one per CPU)
+  --pretty        Pretty-print JSON output
+  --no-labels     Omit labels.toml from .fsm output
+  -f, --format    Format when writing to stdout: json (default), fsm, text, hex
+
+Examples:
+  fsm convert *.json -o .fsm
+  fsm convert ./machines/ --to svg --out-dir build/diagrams
+`
+
 func cmdConvert(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm convert <input>... [-o output] [--pretty] [--no-labels]")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Supports wildcards: fsm convert *.json -o .fsm")
-		fmt.Fprintln(os.Stderr, "When converting multiple files, -o specifies the output extension")
-		os.Exit(1)
-	}
-
-	var inputs []string
-	var outputSpec string
-	pretty := false
-	noLabels := false
-
-	// Parse arguments
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-o", "--output":
-			if i+1 < len(args) {
-				outputSpec = args[i+1]
-				i++
-			}
-		case "--pretty":
-			pretty = true
-		case "--no-labels":
-			noLabels = true
-		default:
-			// Expand wildcards
-			matches, err := filepath.Glob(args[i])
-			if err != nil || len(matches) == 0 {
-				// Not a glob or no matches - use as-is
-				inputs = append(inputs, args[i])
-			} else {
-				inputs = append(inputs, matches...)
+		fatalf(exitUsage, "%s", convertUsage)
+	}
+
+	var outputSpec, format, toFormat, outDir string
+	var pretty, noLabels bool
+	var jobs int
+	fs := newFlagSet("convert")
+	fs.String(&outputSpec, "-o", "--output")
+	fs.String(&format, "-f", "--format")
+	fs.String(&toFormat, "--to")
+	fs.String(&outDir, "--out-dir")
+	fs.Bool(&pretty, "--pretty")
+	fs.Bool(&noLabels, "--no-labels")
+	fs.Int(&jobs, "-j", "--jobs")
+	positional := fs.parseOrExit(args, convertUsage)
+	format = strings.ToLower(format)
+	toFormat = strings.ToLower(toFormat)
+	checkJobs(jobs)
+
+	var toExt string
+	if toFormat != "" {
+		if outputSpec != "" {
+			fatalf(exitUsage, "Error: use either -o or --to, not both")
+		}
+		ext, ok := convertExtension(toFormat)
+		if !ok {
+			fatalf(exitUsage, "Error: unknown --to format %q (use json, fsm, text, hex, svg, png, or dot)", toFormat)
+		}
+		toExt = ext
+	}
+	if outDir != "" && outputSpec == stdioPath {
+		fatalf(exitUsage, "Error: --out-dir cannot be combined with -o -")
+	}
+
+	// Expand wildcards and directories
+	var inputs []convertInput
+	batch := false
+	for _, arg := range positional {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			found, err := machineFilesIn(arg, outDir)
+			if err != nil {
+				fatalf(loadErrorCode(err), "Error reading %s: %v", arg, err)
 			}
+			if len(found) == 0 {
+				fatalf(exitFailure, "Error: no machine files in %s", arg)
+			}
+			inputs = append(inputs, found...)
+			batch = true
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			// Not a glob or no matches - use as-is
+			matches = []string{arg}
+		}
+		for _, m := range matches {
+			inputs = append(inputs, convertInput{path: m, rel: filepath.Base(m)})
 		}
 	}
 
 	if len(inputs) == 0 {
-		fmt.Fprintln(os.Stderr, "No input files specified")
-		os.Exit(1)
-	}
-
-	// Process each input file
-	for _, input := range inputs {
-		output := outputSpec
-
-		// Determine output filename
-		if output == "" {
-			// Default: change extension
-			ext := filepath.Ext(input)
-			base := strings.TrimSuffix(input, ext)
-			switch ext {
-			case ".json":
-				output = base + ".fsm"
-			case ".fsm", ".hex":
-				output = base + ".json"
-			default:
-				output = base + ".fsm"
-			}
-		} else if strings.HasPrefix(output, ".") {
-			// Output is just an extension - apply to input basename
-			ext := filepath.Ext(input)
-			base := strings.TrimSuffix(input, ext)
-			output = base + outputSpec
-		}
-		// else: output is a full filename (only valid for single input)
-
-		// Load input
-		f, err := loadFSM(input)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
+		fatalf(exitUsage, "No input files specified")
+	}
+	batch = batch || len(inputs) > 1
+
+	outputs := make([]string, len(inputs))
+	toStdout := false
+	for i, in := range inputs {
+		outputs[i] = convertOutputPath(in, outputSpec, toExt, outDir)
+		toStdout = toStdout || outputs[i] == stdioPath
+	}
+	if toStdout {
+		// Machines written to stdout would run into each other.
+		jobs = 1
+	}
+	converted := make([]convertResult, len(inputs))
+	runJobs(len(inputs), jobs, func(i int) {
+		converted[i] = convertFile(inputs[i].path, outputs[i], format, pretty, !noLabels, outDir != "")
+	})
+
+	var results []convertResult
+	failed := 0
+	for i, r := range converted {
+		switch {
+		case r.Error != "" && r.Output == "":
+			fmt.Fprintf(os.Stderr, "Error loading %s: %s\n", r.Input, r.Error)
+		case r.Error != "" && r.Output == stdioPath:
+			fmt.Fprintf(os.Stderr, "Error writing stdout: %s\n", r.Error)
+		case r.Error != "":
+			fmt.Fprintf(os.Stderr, "Error writing %s: %s\n", r.Output, r.Error)
+		case outputs[i] == stdioPath:
 			continue
+		case !opts.json:
+			infof("Converted: %s -> %s\n", r.Input, r.Output)
+		}
+		if r.Error != "" {
+			failed++
 		}
+		results = append(results, r)
+	}
+
+	// The JSON summary would corrupt a machine written to stdout.
+	if opts.json && !toStdout {
+		printJSON(results)
+	} else if batch && !toStdout {
+		printConvertSummary(results, failed)
+	}
+	if failed > 0 {
+		os.Exit(exitFailure)
+	}
+}
 
-		// Write output
-		outExt := filepath.Ext(output)
-		switch outExt {
-		case ".fsm":
-			err = fsmfile.WriteFSMFile(output, f, !noLabels)
+// convertOutputPath returns where convert writes in, given the -o, --to
+// extension, and --out-dir options.
+func convertOutputPath(in convertInput, outputSpec, toExt, outDir string) string {
+	input := in.path
+	output := outputSpec
+	if output == "" && input == stdioPath && outDir == "" {
+		return stdioPath
+	} else if toExt != "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + toExt
+	} else if output == "" {
+		// Default: change extension
+		ext := filepath.Ext(input)
+		base := strings.TrimSuffix(input, ext)
+		switch ext {
 		case ".json":
-			data, jerr := fsmfile.ToJSON(f, pretty)
-			if jerr != nil {
-				err = jerr
-			} else {
-				err = os.WriteFile(output, data, 0644)
-			}
-		case ".hex":
-			records, _, _, _ := fsmfile.FSMToRecords(f)
-			hex := fsmfile.FormatHex(records, 4)
-			err = os.WriteFile(output, []byte(hex+"\n"), 0644)
+			output = base + ".fsm"
+		case ".fsm", ".hex":
+			output = base + ".json"
 		default:
-			fmt.Fprintf(os.Stderr, "Unknown output format: %s\n", outExt)
-			continue
+			output = base + ".fsm"
+		}
+	} else if output != stdioPath && strings.HasPrefix(output, ".") {
+		// Output is just an extension - apply to input basename
+		ext := filepath.Ext(input)
+		base := strings.TrimSuffix(input, ext)
+		output = base + outputSpec
+	}
+	// else: output is a full filename (only valid for single input)
+	if outDir != "" {
+		name := filepath.Base(output)
+		if input == stdioPath {
+			name = "stdin" + filepath.Ext(output)
 		}
+		output = filepath.Join(outDir, filepath.Dir(in.rel), name)
+	}
+	return output
+}
 
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
-			continue
+// convertFile converts one input for convert, making the output's
+// directory first if mkdir is set. A failure to load leaves Output empty
+// in the result.
+func convertFile(input, output, format string, pretty, labels, mkdir bool) convertResult {
+	f, err := loadFSM(input)
+	if err != nil {
+		return convertResult{Input: input, Error: err.Error()}
+	}
+	if output == stdioPath {
+		err = writeFSMOutput(output, format, f)
+	} else {
+		if mkdir {
+			err = os.MkdirAll(filepath.Dir(output), 0755)
 		}
+		if err == nil {
+			err = writeConverted(output, f, pretty, labels)
+		}
+	}
+	if err != nil {
+		return convertResult{Input: input, Output: output, Error: err.Error()}
+	}
+	return convertResult{Input: input, Output: output}
+}
 
-		fmt.Printf("Converted: %s -> %s\n", input, output)
+// printConvertSummary reports how many of a batch of inputs converted,
+// and lists those that did not, after the per-file messages.
+func printConvertSummary(results []convertResult, failed int) {
+	infof("\nConverted %d of %d files\n", len(results)-failed, len(results))
+	if failed == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d failed:\n", failed)
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", r.Input, r.Error)
+		}
 	}
 }
 
+const dotUsage = `Usage: fsm dot <input> [-o output] [-t title] [-m machine] [--rankdir LR|TB] [--cluster-by KEY] [--fill-by KEY] [--font NAME] [--font-size N]
+
+Generate Graphviz DOT output.
+
+Options:
+  -o, --output    Output file (default: stdout)
+  -t, --title     Graph title (default: FSM name or type summary)
+  -m, --machine   Select machine from bundle
+  --rankdir DIR   Layout direction: LR (default), TB, RL, or BT
+  --cluster-by K  Group states into clusters by their K metadata
+  --fill-by K     Fill states with the colour in their K metadata
+  --font NAME     Font for states, transitions, and title (default: Helvetica)
+  --font-size N   State label size in points (default: 11)
+
+Examples:
+  fsm dot input.fsm | dot -Tpng -o output.png
+  fsm dot protocol.json --rankdir TB --cluster-by tag -o protocol.dot
+`
+
 func cmdDot(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm dot <input> [-o output] [-t title] [-m machine]")
-		os.Exit(1)
+		fatalf(exitUsage, "%s", dotUsage)
 	}
 
-	input := args[0]
 	var output, title, machineName string
+	opts := fsmfile.DefaultDOTOptions()
+	fs := newFlagSet("dot")
+	fs.String(&output, "-o", "--output")
+	fs.String(&title, "-t", "--title")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&opts.RankDir, "--rankdir")
+	fs.String(&opts.ClusterBy, "--cluster-by")
+	fs.String(&opts.FillBy, "--fill-by")
+	fs.String(&opts.FontName, "--font")
+	fs.Int(&opts.FontSize, "--font-size")
+	positional := fs.parseOrExit(args, dotUsage)
+	opts.RankDir = strings.ToUpper(opts.RankDir)
 
-	for i := 1; i < len(args); i++ {
-		switch args[i] {
-		case "-o", "--output":
-			if i+1 < len(args) {
-				output = args[i+1]
-				i++
-			}
-		case "-t", "--title":
-			if i+1 < len(args) {
-				title = args[i+1]
-				i++
-			}
-		case "-m", "--machine":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		}
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	if opts.FontSize < 1 {
+		fatalf(exitUsage, "Error: --font-size must be positive, not %d", opts.FontSize)
+	}
+
+	validRankDir := false
+	for _, dir := range fsmfile.DOTRankDirs() {
+		validRankDir = validRankDir || opts.RankDir == dir
+	}
+	if !validRankDir {
+		fatalf(exitUsage, "Error: unknown rankdir %q (available: %s)", opts.RankDir, strings.Join(fsmfile.DOTRankDirs(), ", "))
 	}
 
 	f, err := loadFSMWithMachine(input, machineName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
 	}
 
 	if title == "" {
@@ -263,132 +391,210 @@ func cmdDot(args []string) {
 			title = fmt.Sprintf("%s: %d states", strings.ToUpper(string(f.Type)), len(f.States))
 		}
 	}
+	opts.Title = title
 
-	dot := fsmfile.GenerateDOT(f, title)
+	dot := fsmfile.GenerateDOTWithOptions(f, opts)
 
-	if output != "" {
+	if output != "" && output != stdioPath {
 		err = os.WriteFile(output, []byte(dot), 0644)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
-			os.Exit(1)
+			fatalf(exitIO, "Error writing %s: %v", output, err)
 		}
 	} else {
 		fmt.Print(dot)
 	}
 }
 
+// imageUsage returns the usage of "fsm png" or "fsm svg", whose native
+// renderer options differ by format.
+func imageUsage(format string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Usage: fsm %s <input> [-o output] [-t title] [--renderer native|graphviz] [--open] [native options...]\n", format)
+	sb.WriteString("\n")
+	fmt.Fprintf(&sb, "Generates a %s image from the FSM.\n", strings.ToUpper(format))
+	sb.WriteString(`
+Options:
+  -o, --output    Output file (default: input name with new extension)
+  -t, --title     Set diagram title (default: FSM name or type)
+  -m, --machine   Select machine from bundle
+  --all           Render all machines in bundle (tiled output)
+  -j, --jobs N    With --all, render N machines at once (default: one per CPU)
+  --renderer R    Renderer: graphviz (default) or native, the built-in
+                  renderer (no Graphviz required)
+  --native        Same as --renderer native
+  --open          Open the image with the system viewer once written
+  --trace "a b"   Highlight the path taken by an input word (implies --native)
+  --max-size N    Keep each image within N×N pixels (implies --native)
+  --tile          Split a large diagram into pages of --max-size (default: 2000)
+                  plus an overview page (implies --native)
+
+Native renderer options (only with --renderer native):
+  --font-size N   Base font size in pixels (default: 14)
+  --spacing N     Node spacing multiplier (default: 1.5)
+  --width N       Canvas width in pixels (default: 800)
+  --height N      Canvas height in pixels (default: 600)
+`)
+	fmt.Fprintf(&sb, "  --layout NAME   Layout engine: %s (default: auto)\n", strings.Join(fsmfile.LayoutEngineNames(), ", "))
+	sb.WriteString(`  --separate-edges
+                  Draw each transition between two states as a curve of
+                  its own instead of joining the labels with commas
+  --bundle-edges  Merge transitions from many states into one, such as
+                  an error state, into a single arrow
+`)
+	if format == "png" {
+		sb.WriteString(`  --scale N       Pixels per canvas pixel, up to 4, e.g. 2 for retina (default: 1)
+  --dpi N         Resolution recorded in the PNG; without --scale, also
+                  scales the image by N/96
+  --transparent   Leave the background transparent instead of white
+`)
+		fmt.Fprintf(&sb, "  --font NAME     Typeface: %s (default: regular)\n", strings.Join(fsmfile.PNGFontNames(), ", "))
+	}
+	if format == "svg" {
+		sb.WriteString("  --shape SHAPE   State shape: circle, ellipse, rect, roundrect, diamond\n")
+		fmt.Fprintf(&sb, "  --theme NAME    Colour theme: %s\n", strings.Join(fsmfile.ThemeNames(), ", "))
+		sb.WriteString("  --use-layout    Place states where fsmedit saved them (.fsm input)\n")
+	}
+	sb.WriteString(`
+With the graphviz renderer, requires Graphviz 'dot' to be installed:
+  https://graphviz.org/download/
+`)
+	return sb.String()
+}
+
 func cmdImage(args []string, format string) {
+	usage := imageUsage(format)
 	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "Usage: fsm %s <input> [-o output] [-t title]\n", format)
-		os.Exit(1)
+		fatalf(exitUsage, "%s", usage)
+	}
+
+	var output, title, machineName, renderer string
+	var native, openAfter, renderAll, useLayout, tile, transparent bool
+	var separateEdges, bundleEdges bool
+	var shape, themeName, layoutName, trace, fontName string
+	var fontSize, canvasWidth, canvasHeight, maxSize, dpi, jobs int
+	var spacing, pixelScale float64
+	fs := newFlagSet(format)
+	fs.String(&output, "-o", "--output")
+	fs.String(&title, "-t", "--title")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&renderAll, "--all")
+	fs.Int(&jobs, "-j", "--jobs")
+	fs.Bool(&native, "--native")
+	fs.String(&renderer, "--renderer")
+	fs.Bool(&openAfter, "--open")
+	fs.String(&trace, "--trace")
+	fs.Int(&maxSize, "--max-size")
+	fs.Bool(&tile, "--tile")
+	fs.Int(&fontSize, "--font-size")
+	fs.Float(&spacing, "--spacing")
+	fs.Int(&canvasWidth, "--width")
+	fs.Int(&canvasHeight, "--height")
+	fs.String(&layoutName, "--layout")
+	fs.Bool(&separateEdges, "--separate-edges")
+	fs.Bool(&bundleEdges, "--bundle-edges")
+	fs.Float(&pixelScale, "--scale")
+	fs.Int(&dpi, "--dpi")
+	fs.Bool(&transparent, "--transparent")
+	fs.String(&fontName, "--font")
+	fs.String(&shape, "--shape")
+	fs.String(&themeName, "--theme")
+	fs.Bool(&useLayout, "--use-layout")
+	positional := fs.parseOrExit(args, usage)
+	renderer = strings.ToLower(renderer)
+	layoutName = strings.ToLower(layoutName)
+	fontName = strings.ToLower(fontName)
+	shape = strings.ToLower(shape)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	tracing := fs.Seen("--trace")
+	native = native || fs.Seen("--trace", "--max-size", "--tile", "--layout", "--separate-edges",
+		"--bundle-edges", "--scale", "--dpi", "--transparent", "--font")
+	if fontSize < 0 || spacing < 0 || canvasWidth < 0 || canvasHeight < 0 || maxSize < 0 {
+		fatalf(exitUsage, "Error: --font-size, --spacing, --width, --height, and --max-size cannot be negative")
+	}
+	checkJobs(jobs)
+
+	if renderer == "" && !native {
+		renderer = config.Renderer
+	}
+	switch renderer {
+	case "", "graphviz":
+		if renderer == "graphviz" && native {
+			fatalf(exitUsage, "Error: --native, --trace, --layout, --max-size, --tile, --scale, --dpi, --transparent, --font, --separate-edges, and --bundle-edges need --renderer native")
+		}
+	case "native":
+		native = true
+	default:
+		fatalf(exitUsage, "Error: unknown renderer %q (use native or graphviz)", renderer)
 	}
-
-	// Check for help flag
-	if args[0] == "-h" || args[0] == "--help" {
-		fmt.Printf("Usage: fsm %s <input> [-o output] [-t title] [--native] [native options...]\n", format)
-		fmt.Println("")
-		fmt.Printf("Generates a %s image from the FSM.\n", strings.ToUpper(format))
-		fmt.Println("")
-		fmt.Println("Options:")
-		fmt.Println("  -o, --output    Output file (default: input name with new extension)")
-		fmt.Println("  -t, --title     Set diagram title (default: FSM name or type)")
-		fmt.Println("  -m, --machine   Select machine from bundle")
-		fmt.Println("  --all           Render all machines in bundle (tiled output)")
-		fmt.Println("  --native        Use built-in renderer (no Graphviz required)")
-		fmt.Println("")
-		fmt.Println("Native renderer options (only with --native):")
-		fmt.Println("  --font-size N   Base font size in pixels (default: 14)")
-		fmt.Println("  --spacing N     Node spacing multiplier (default: 1.5)")
-		fmt.Println("  --width N       Canvas width in pixels (default: 800)")
-		fmt.Println("  --height N      Canvas height in pixels (default: 600)")
-		if format == "svg" {
-			fmt.Println("  --shape SHAPE   State shape: circle, ellipse, rect, roundrect, diamond")
-		}
-		fmt.Println("")
-		fmt.Println("Without --native, requires Graphviz 'dot' to be installed:")
-		fmt.Println("  https://graphviz.org/download/")
-		return
+	if openAfter && (tile || renderAll) {
+		fatalf(exitUsage, "Error: --open shows a single image and cannot be used with --tile or --all")
 	}
 
-	input := args[0]
-	var output, title, machineName string
-	native := false
-	renderAll := false
-	fontSize := 0
-	shape := ""
-	spacing := 0.0
-	canvasWidth := 0
-	canvasHeight := 0
-
-	for i := 1; i < len(args); i++ {
-		switch args[i] {
-		case "-o", "--output":
-			if i+1 < len(args) {
-				output = args[i+1]
-				i++
-			}
-		case "-t", "--title":
-			if i+1 < len(args) {
-				title = args[i+1]
-				i++
-			}
-		case "-m", "--machine":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		case "--all":
-			renderAll = true
-		case "--native":
-			native = true
-		case "--font-size":
-			if i+1 < len(args) {
-				fmt.Sscanf(args[i+1], "%d", &fontSize)
-				i++
-			}
-		case "--shape":
-			if i+1 < len(args) {
-				shape = strings.ToLower(args[i+1])
-				i++
-			}
-		case "--spacing":
-			if i+1 < len(args) {
-				fmt.Sscanf(args[i+1], "%f", &spacing)
-				i++
-			}
-		case "--width":
-			if i+1 < len(args) {
-				fmt.Sscanf(args[i+1], "%d", &canvasWidth)
-				i++
-			}
-		case "--height":
-			if i+1 < len(args) {
-				fmt.Sscanf(args[i+1], "%d", &canvasHeight)
-				i++
-			}
+	if themeName == "" {
+		themeName = config.Theme
+	}
+	theme := fsmfile.DefaultTheme()
+	if themeName != "" {
+		var ok bool
+		if theme, ok = fsmfile.ThemeByName(themeName); !ok {
+			fatalf(exitUsage, "Error: unknown theme %q (available: %s)", themeName, strings.Join(fsmfile.ThemeNames(), ", "))
 		}
 	}
+	engine, ok := fsmfile.LayoutEngineByName(layoutName)
+	if !ok {
+		fatalf(exitUsage, "Error: unknown layout %q (available: %s)", layoutName, strings.Join(fsmfile.LayoutEngineNames(), ", "))
+	}
+	if format != "png" && (pixelScale != 0 || dpi != 0 || transparent || fontName != "") {
+		fatalf(exitUsage, "Error: --scale, --dpi, --transparent, and --font apply to PNG output only")
+	}
+	pngFont, ok := fsmfile.PNGFontByName(fontName)
+	if !ok {
+		fatalf(exitUsage, "Error: unknown font %q (available: %s)", fontName, strings.Join(fsmfile.PNGFontNames(), ", "))
+	}
+	if dpi < 0 {
+		fatalf(exitUsage, "Error: --dpi must be positive, not %d", dpi)
+	}
+	if pixelScale == 0 && dpi > 0 {
+		pixelScale = float64(dpi) / 96 // 96 dpi is the 1x reference
+	}
+	if pixelScale < 0 || pixelScale > 4 {
+		fatalf(exitUsage, "Error: --scale must be greater than 0 and at most 4, not %g", pixelScale)
+	}
 
 	// Handle --all flag for bundles
+	if renderAll && tracing {
+		fatalf(exitUsage, "Error: --trace renders a single machine and cannot be used with --all")
+	}
+	if renderAll && tile {
+		fatalf(exitUsage, "Error: --tile renders a single machine and cannot be used with --all")
+	}
 	if renderAll && filepath.Ext(input) == ".fsm" {
-		renderAllMachines(input, output, format, native, fontSize, spacing, canvasWidth, canvasHeight, shape)
+		renderAllMachines(input, output, format, native, fontSize, spacing, canvasWidth, canvasHeight, shape, theme, engine, useLayout, pixelScale, dpi, transparent, pngFont, separateEdges, bundleEdges, jobs)
 		return
 	}
 
-	// Default output filename
-	if output == "" {
+	// Default output filename; stdin input defaults to stdout
+	if output == "" && input == stdioPath {
+		output = stdioPath
+	} else if output == "" {
 		base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
 		if machineName != "" {
 			base = machineName
 		}
-		output = base + "." + format
+		output = defaultOutputPath(base + "." + format)
+	}
+	if openAfter && output == stdioPath {
+		fatalf(exitUsage, "Error: --open needs an output file, not stdout")
 	}
 
 	// Load FSM first
 	f, err := loadFSMWithMachine(input, machineName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
 	}
 
 	// Generate title
@@ -400,11 +606,66 @@ func cmdImage(args []string, format string) {
 		}
 	}
 
+	// Highlight the path taken by the traced input word
+	var highlight *fsmfile.Highlight
+	if tracing {
+		highlight, err = fsmfile.TraceHighlight(f, strings.Fields(trace))
+		if highlight == nil {
+			fatalf(exitFailure, "Error: %v", err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: trace stopped at %v\n", err)
+		}
+	}
+
+	// Size the canvas for tiling, or fit it within the pixel budget,
+	// which --scale shares out over fewer canvas pixels
+	if tile && maxSize <= 0 {
+		maxSize = defaultTileSize
+	}
+	canvasMax := maxSize
+	if pixelScale > 0 {
+		canvasMax = int(float64(maxSize) / pixelScale)
+	}
+	if tile {
+		if output == stdioPath {
+			fatalf(exitUsage, "Error: --tile writes several files and cannot write to stdout")
+		}
+		autoWidth, autoHeight := fsmfile.CanvasSizeFor(f)
+		if canvasWidth <= 0 {
+			canvasWidth = autoWidth
+		}
+		if canvasHeight <= 0 {
+			canvasHeight = autoHeight
+		}
+	} else if maxSize > 0 {
+		if canvasWidth <= 0 {
+			canvasWidth = 800
+		}
+		if canvasHeight <= 0 {
+			canvasHeight = 600
+		}
+		canvasWidth, canvasHeight = fsmfile.FitSize(canvasWidth, canvasHeight, canvasMax)
+	}
+	tiled := tile && (canvasWidth > canvasMax || canvasHeight > canvasMax)
+
 	// Native SVG rendering (no Graphviz needed)
 	if native {
 		if format == "svg" {
 			opts := fsmfile.DefaultSVGOptions()
 			opts.Title = title
+			opts.Theme = theme
+			opts.Highlight = highlight
+			opts.LayoutEngine = engine
+			opts.Logger = debugLogger()
+			opts.SeparateEdges = separateEdges
+			opts.BundleEdges = bundleEdges
+			if useLayout {
+				opts.UseLayout = loadLayoutWithMachine(input, machineName)
+				if opts.UseLayout == nil {
+					fmt.Fprintf(os.Stderr, "Warning: %s has no saved layout; using automatic layout\n", input)
+				}
+			}
 			
 			// Apply custom options
 			if fontSize > 0 {
@@ -434,17 +695,39 @@ func cmdImage(args []string, format string) {
 				opts.StateShape = fsmfile.ShapeDiamond
 			}
 			
+			if tiled {
+				writeTiledSVG(f, opts, maxSize, output)
+				return
+			}
+
 			svg := fsmfile.GenerateSVGNative(f, opts)
 
-			if err := os.WriteFile(output, []byte(svg), 0644); err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
-				os.Exit(1)
+			outFile, err := createOutput(output)
+			if err != nil {
+				fatalf(exitIO, "Error creating %s: %v", output, err)
+			}
+			defer outFile.Close()
+
+			if _, err := io.WriteString(outFile, svg); err != nil {
+				fatalf(exitIO, "Error writing %s: %v", output, err)
+			}
+			if output != stdioPath {
+				infof("Generated: %s (native)\n", output)
 			}
-			fmt.Printf("Generated: %s (native)\n", output)
+			openRendered(output, openAfter)
 			return
 		} else if format == "png" {
 			opts := fsmfile.DefaultPNGOptions()
 			opts.Title = title
+			opts.Highlight = highlight
+			opts.LayoutEngine = engine
+			opts.Logger = debugLogger()
+			opts.Scale = pixelScale
+			opts.DPI = dpi
+			opts.Transparent = transparent
+			opts.Font = pngFont
+			opts.SeparateEdges = separateEdges
+			opts.BundleEdges = bundleEdges
 			
 			// Apply custom options
 			if fontSize > 0 {
@@ -459,19 +742,25 @@ func cmdImage(args []string, format string) {
 			if canvasHeight > 0 {
 				opts.Height = canvasHeight
 			}
+
+			if tiled {
+				writeTiledPNG(f, opts, maxSize, output)
+				return
+			}
 			
-			outFile, err := os.Create(output)
+			outFile, err := createOutput(output)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", output, err)
-				os.Exit(1)
+				fatalf(exitIO, "Error creating %s: %v", output, err)
 			}
 			defer outFile.Close()
 			
 			if err := fsmfile.RenderPNG(f, outFile, opts); err != nil {
-				fmt.Fprintf(os.Stderr, "Error rendering PNG: %v\n", err)
-				os.Exit(1)
+				fatalf(exitFailure, "Error rendering PNG: %v", err)
+			}
+			if output != stdioPath {
+				infof("Generated: %s (native)\n", output)
 			}
-			fmt.Printf("Generated: %s (native)\n", output)
+			openRendered(output, openAfter)
 			return
 		}
 	}
@@ -479,18 +768,7 @@ func cmdImage(args []string, format string) {
 	// Check if dot is available
 	dotPath, err := exec.LookPath("dot")
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error: Graphviz 'dot' command not found in PATH.")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Tip: Use --native flag for built-in rendering without Graphviz:")
-		fmt.Fprintf(os.Stderr, "  fsm %s %s --native\n", format, input)
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Or install Graphviz from: https://graphviz.org/download/")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Installation:")
-		fmt.Fprintln(os.Stderr, "  macOS:   brew install graphviz")
-		fmt.Fprintln(os.Stderr, "  Ubuntu:  sudo apt install graphviz")
-		fmt.Fprintln(os.Stderr, "  Windows: choco install graphviz")
-		os.Exit(1)
+		graphvizMissing(format + " " + input)
 	}
 
 	// Generate DOT
@@ -500,10 +778,9 @@ func cmdImage(args []string, format string) {
 	cmd := exec.Command(dotPath, "-T"+format)
 	cmd.Stdin = strings.NewReader(dot)
 
-	outFile, err := os.Create(output)
+	outFile, err := createOutput(output)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", output, err)
-		os.Exit(1)
+		fatalf(exitIO, "Error creating %s: %v", output, err)
 	}
 	defer outFile.Close()
 
@@ -511,67 +788,77 @@ func cmdImage(args []string, format string) {
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error running dot: %v\n", err)
-		os.Exit(1)
+		fatalf(exitFailure, "Error running dot: %v", err)
 	}
 
-	fmt.Printf("Generated: %s\n", output)
+	if output != stdioPath {
+		infof("Generated: %s\n", output)
+	}
+	openRendered(output, openAfter)
+}
+
+// openRendered opens an image written by cmdImage when --open is given.
+func openRendered(path string, open bool) {
+	if !open {
+		return
+	}
+	if err := openFile(path); err != nil {
+		fatalf(exitFailure, "Error opening viewer: %v", err)
+	}
 }
 
+const infoUsage = `Usage: fsm info <input> [-m machine]
+
+Show a summary of a machine: type, states, alphabet, linked states,
+classes, and nets. With --json, the summary is emitted as a JSON object.
+
+Options:
+  -m, --machine   Select machine from bundle
+`
+
 func cmdInfo(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm info <input> [--machine <name>]")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "For bundles, use --machine to select a specific machine.")
-		os.Exit(1)
+		fatalf(exitUsage, "%s", infoUsage)
 	}
 
-	var input, machineName string
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--machine", "-m":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		default:
-			if !strings.HasPrefix(args[i], "-") && input == "" {
-				input = args[i]
-			}
-		}
-	}
+	var machineName string
+	fs := newFlagSet("info")
+	fs.String(&machineName, "-m", "--machine")
+	positional := fs.parseOrExit(args, infoUsage)
 
-	if input == "" {
-		fmt.Fprintln(os.Stderr, "Error: input file required")
-		os.Exit(1)
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
 	}
+	input := positional[0]
 
 	// Bundle detection: show summary when no --machine specified
+	var bundleMachines []string
 	if machineName == "" && filepath.Ext(input) == ".fsm" {
 		if isBundle, _ := fsmfile.IsBundle(input); isBundle {
 			machines, err := fsmfile.ListMachines(input)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", input, err)
-				os.Exit(1)
-			}
-			fmt.Printf("Bundle:      %s (%d machines)\n", filepath.Base(input), len(machines))
-			fmt.Printf("Machines:    ")
-			for i, m := range machines {
-				if i > 0 {
-					fmt.Printf(", ")
-				}
-				fmt.Printf("%s", m.Name)
+				fatalf(loadErrorCode(err), "Error reading %s: %v", input, err)
+			}
+			for _, m := range machines {
+				bundleMachines = append(bundleMachines, m.Name)
+			}
+			if !opts.json {
+				fmt.Printf("Bundle:      %s (%d machines)\n", filepath.Base(input), len(machines))
+				fmt.Printf("Machines:    %s\n", strings.Join(bundleMachines, ", "))
+				fmt.Println()
+				fmt.Printf("Showing: %s (use -m to select a machine, or 'fsm machines' to list all)\n\n", machines[0].Name)
 			}
-			fmt.Println()
-			fmt.Println()
-			fmt.Printf("Showing: %s (use -m to select a machine, or 'fsm machines' to list all)\n\n", machines[0].Name)
 		}
 	}
 
 	f, err := loadFSMWithMachine(input, machineName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	if opts.json {
+		printJSON(newInfoReport(f, bundleMachines))
+		return
 	}
 
 	fmt.Printf("Type:        %s\n", f.Type)
@@ -587,11 +874,15 @@ func cmdInfo(args []string) {
 	if len(f.OutputAlphabet) > 0 {
 		fmt.Printf("%-12s %d\n", v.Output+"s:", len(f.OutputAlphabet))
 	}
+	if len(f.StackAlphabet) > 0 {
+		fmt.Printf("%-12s %d\n", "Stack:", len(f.StackAlphabet))
+	}
 	fmt.Printf("%-12s %d\n", v.Transition+"s:", len(f.Transitions))
 	fmt.Printf("%-12s %s\n", v.Initial+":", f.Initial)
 	if len(f.Accepting) > 0 {
 		fmt.Printf("%-12s %v\n", v.Accepting+":", f.Accepting)
 	}
+	fmt.Printf("%-12s %s\n", "Fingerprint:", f.Fingerprint())
 	
 	// Display linked states
 	if f.HasLinkedStates() {
@@ -662,100 +953,136 @@ func cmdInfo(args []string) {
 	}
 }
 
+const analyseUsage = `Usage: fsm analyse <input> [-m machine] [--all] [--ignore RULE]...
+       fsm analyze <input> [-m machine] [--all] [--ignore RULE]...
+
+Analyse FSM for potential issues:
+  A001 unreachable       States not reachable from the initial state
+  A002 dead              States with no outgoing transitions, not accepting
+  A003 trap              States that cannot reach an accepting state
+  A004 livelock          Cycles with no way out and no accepting state
+  A005 nondeterministic  Multiple transitions on the same input in a DFA
+  A006 incomplete        DFA states missing transitions for some inputs
+  A007 unused_input      Inputs defined but never used (info)
+  A008 unused_output     Outputs defined but never used (info)
+
+A state whose "suppress" metadata names a rule, as in suppress = "dead",
+is left out of that rule's findings; on the machine, it drops the rule.
+
+Bundle analysis (--all) also checks:
+  - Cross-machine alphabet conflicts
+  - Orphaned machines (not linked from any other)
+  - Missing linked machine targets
+
+Options:
+  -m, --machine   Select machine from bundle
+  --all           Analyse all machines in bundle
+  --ignore RULE   Leave out a rule's findings, by name or ID (repeatable,
+                  or comma-separated)
+`
+
 func cmdAnalyse(args []string) {
-	if len(args) < 1 || args[0] == "-h" || args[0] == "--help" {
-		fmt.Println("Usage: fsm analyse <input> [-m machine] [--all]")
-		fmt.Println("       fsm analyze <input> [-m machine] [--all]")
-		fmt.Println("")
-		fmt.Println("Analyse FSM for potential issues:")
-		fmt.Println("  - Unreachable states (not reachable from initial)")
-		fmt.Println("  - Dead states (no outgoing transitions, not accepting)")
-		fmt.Println("  - Non-determinism in DFA (multiple transitions on same input)")
-		fmt.Println("  - Incomplete DFA (missing transitions for some inputs)")
-		fmt.Println("  - Unused inputs (defined but never used)")
-		fmt.Println("  - Unused outputs (defined but never used)")
-		fmt.Println("")
-		fmt.Println("Bundle analysis (--all) also checks:")
-		fmt.Println("  - Cross-machine alphabet conflicts")
-		fmt.Println("  - Orphaned machines (not linked from any other)")
-		fmt.Println("  - Missing linked machine targets")
-		fmt.Println("")
-		fmt.Println("Options:")
-		fmt.Println("  -m, --machine   Select machine from bundle")
-		fmt.Println("  --all           Analyse all machines in bundle")
-		if len(args) < 1 {
-			os.Exit(1)
-		}
-		return
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", analyseUsage)
 	}
 
-	var input, machineName string
+	var machineName string
 	var analyseAll bool
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-m", "--machine":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		case "--all":
-			analyseAll = true
-		default:
-			if !strings.HasPrefix(args[i], "-") && input == "" {
-				input = args[i]
-			}
-		}
+	var ignoreFlags []string
+	fs := newFlagSet("analyse")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&analyseAll, "--all")
+	fs.Strings(&ignoreFlags, "--ignore")
+	positional := fs.parseOrExit(args, analyseUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
 	}
+	input := positional[0]
+	ignore := analysisRules(ignoreFlags)
 
 	// Handle --all for bundles
 	if analyseAll {
-		analyseAllMachines(input)
+		analyseAllMachines(input, ignore)
 		return
 	}
 
 	f, err := loadFSMWithMachine(input, machineName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
 	}
 
-	warnings := f.Analyse()
+	warnings := fsm.IgnoreWarnings(f.Analyse(), ignore)
+
+	if opts.json {
+		printJSON(analyseReport{Issues: toAnalyseIssues(warnings), Total: len(warnings)})
+		return
+	}
 
 	if len(warnings) == 0 {
-		fmt.Println("No issues found.")
+		fmt.Println(colorize(colorGreen, "No issues found."))
 		return
 	}
 
 	fmt.Printf("Found %d issue(s):\n\n", len(warnings))
+	printWarnings(warnings)
+}
+
+// analysisRules splits the values of --ignore at commas, exiting with an
+// error if one is not an analysis rule's name or ID.
+func analysisRules(values []string) []string {
+	var rules []string
+	for _, v := range values {
+		for _, r := range strings.Split(v, ",") {
+			r = strings.TrimSpace(r)
+			if _, ok := fsm.AnalysisRule(r); !ok {
+				fatalf(exitUsage, "Error: unknown analysis rule %q (see fsm analyse --help)", r)
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// printWarnings prints analysis warnings in the indented text format shared
+// by single-machine and bundle analysis, coloured by severity.
+func printWarnings(warnings []fsm.ValidationWarning) {
 	for _, w := range warnings {
-		fmt.Printf("  [%s] %s\n", w.Type, w.Message)
+		tag := "[" + w.ID + " " + w.Type + "]"
+		switch w.Severity {
+		case fsm.SeverityError:
+			tag = colorize(colorRed, tag)
+		case fsm.SeverityWarning:
+			tag = colorize(colorYellow, tag)
+		}
+		fmt.Printf("  %s %s\n", tag, w.Message)
 		if len(w.States) > 0 {
 			fmt.Printf("    States: %v\n", w.States)
 		}
 		if len(w.Symbols) > 0 {
 			fmt.Printf("    Symbols: %v\n", w.Symbols)
 		}
+		if len(w.Path) > 0 {
+			fmt.Printf("    Path: %s\n", strings.Join(w.Path, " -> "))
+		}
 	}
 }
 
 // analyseAllMachines analyses all machines in a bundle plus cross-machine issues
-func analyseAllMachines(input string) {
+func analyseAllMachines(input string, ignore []string) {
 	// Check if it's a bundle
 	isBundle, err := fsmfile.IsBundle(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error reading %s: %v", input, err)
 	}
 	if !isBundle {
-		fmt.Fprintln(os.Stderr, "Error: --all requires a bundle file with multiple machines")
-		os.Exit(1)
+		fatalf(exitUsage, "Error: --all requires a bundle file with multiple machines")
 	}
 
 	// List all machines
 	machines, err := fsmfile.ListMachines(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing machines: %v\n", err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error listing machines: %v", err)
 	}
 
 	// Load all FSMs
@@ -770,6 +1097,7 @@ func analyseAllMachines(input string) {
 	}
 
 	totalIssues := 0
+	report := analyseReport{Machines: make(map[string][]analyseIssue)}
 
 	// Analyse each machine individually
 	for _, m := range machines {
@@ -778,37 +1106,38 @@ func analyseAllMachines(input string) {
 			continue
 		}
 
-		warnings := f.Analyse()
-		if len(warnings) > 0 {
+		warnings := fsm.IgnoreWarnings(f.Analyse(), ignore)
+		report.Machines[m.Name] = toAnalyseIssues(warnings)
+		if len(warnings) > 0 && !opts.json {
 			fmt.Printf("=== %s ===\n", m.Name)
-			for _, w := range warnings {
-				fmt.Printf("  [%s] %s\n", w.Type, w.Message)
-				if len(w.States) > 0 {
-					fmt.Printf("    States: %v\n", w.States)
-				}
-				if len(w.Symbols) > 0 {
-					fmt.Printf("    Symbols: %v\n", w.Symbols)
-				}
-			}
+			printWarnings(warnings)
 			fmt.Println()
-			totalIssues += len(warnings)
 		}
+		totalIssues += len(warnings)
 	}
 
 	// Cross-machine analysis
 	crossIssues := analyseCrossMachine(fsms)
+	totalIssues += len(crossIssues)
+
+	if opts.json {
+		report.CrossMachine = crossIssues
+		report.Total = totalIssues
+		printJSON(report)
+		return
+	}
+
 	if len(crossIssues) > 0 {
 		fmt.Println("=== Cross-Machine Issues ===")
 		for _, issue := range crossIssues {
 			fmt.Printf("  %s\n", issue)
 		}
 		fmt.Println()
-		totalIssues += len(crossIssues)
 	}
 
 	// Summary
 	if totalIssues == 0 {
-		fmt.Printf("No issues found in %d machines.\n", len(machines))
+		fmt.Println(colorize(colorGreen, fmt.Sprintf("No issues found in %d machines.", len(machines))))
 	} else {
 		fmt.Printf("Total: %d issue(s) across %d machines.\n", totalIssues, len(machines))
 	}
@@ -876,116 +1205,207 @@ func analyseCrossMachine(fsms map[string]*fsm.FSM) []string {
 	return issues
 }
 
+const validateUsage = `Usage: fsm validate <input>... [-m machine] [--bundle] [--strict] [--max-warnings N]
+
+Options:
+  -m, --machine     Select machine from bundle
+  --bundle          Validate linked state references across bundle
+  --strict          Reject JSON with unknown fields or malformed values (see fsm schema)
+  --max-warnings N  Also fail if analysis finds more than N warnings
+
+Given several files or a directory, each file is validated and a table
+of the results is printed.
+`
+
 func cmdValidate(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm validate <input> [-m machine] [--bundle]")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Options:")
-		fmt.Fprintln(os.Stderr, "  -m, --machine   Select machine from bundle")
-		fmt.Fprintln(os.Stderr, "  --bundle        Validate linked state references across bundle")
-		os.Exit(1)
-	}
-
-	var input, machineName string
-	var validateBundle bool
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-m", "--machine":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		case "--bundle":
-			validateBundle = true
-		default:
-			if !strings.HasPrefix(args[i], "-") && input == "" {
-				input = args[i]
-			}
-		}
+		fatalf(exitUsage, "%s", validateUsage)
+	}
+
+	var machineName string
+	var validateBundle, strict bool
+	maxWarnings := -1
+	fs := newFlagSet("validate")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&validateBundle, "--bundle")
+	fs.Bool(&strict, "--strict")
+	fs.Int(&maxWarnings, "--max-warnings")
+	positional := fs.parseOrExit(args, validateUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
 	}
+	inputs, many := validateInputs(positional)
+	if many {
+		validateMany(inputs, machineName, validateBundle, strict, maxWarnings)
+		return
+	}
+	input := inputs[0]
 
 	// Bundle validation mode
 	if validateBundle {
 		result, err := fsmfile.ValidateBundleLinks(input)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error validating bundle: %v\n", err)
-			os.Exit(1)
+			fatalf(loadErrorCode(err), "Error validating bundle: %v", err)
 		}
-		
+
+		report := validateReport{
+			Input:    input,
+			Valid:    result.Valid,
+			Errors:   result.Errors,
+			Warnings: result.Warnings,
+		}
+		if maxWarnings >= 0 {
+			report.WarningCount = len(result.Warnings)
+			checkWarnings(&report, maxWarnings)
+		}
+		if opts.json {
+			printJSON(report)
+			if !result.Valid || report.TooManyWarnings {
+				os.Exit(exitInvalid)
+			}
+			return
+		}
+
 		if len(result.Warnings) > 0 {
 			fmt.Println("Warnings:")
 			for _, w := range result.Warnings {
-				fmt.Printf("  ⚠ %s\n", w)
+				fmt.Printf("  %s %s\n", colorize(colorYellow, "⚠"), w)
 			}
 			fmt.Println()
 		}
-		
+
 		if len(result.Errors) > 0 {
 			fmt.Println("Errors:")
 			for _, e := range result.Errors {
-				fmt.Printf("  ✗ %s\n", e)
+				fmt.Printf("  %s %s\n", colorize(colorRed, "✗"), e)
 			}
 			fmt.Println()
 		}
-		
-		if result.Valid {
-			fmt.Printf("%s: bundle links valid\n", input)
-		} else {
-			fmt.Fprintf(os.Stderr, "%s: bundle validation failed\n", input)
-			os.Exit(1)
+
+		if !result.Valid {
+			fatalf(exitInvalid, "%s: bundle validation failed", input)
+		}
+		if report.TooManyWarnings {
+			fatalf(exitInvalid, "%s: %s", input, report.Error)
 		}
+		infof("%s: bundle links %s\n", input, colorize(colorGreen, "valid"))
 		return
 	}
 
-	f, err := loadFSMWithMachine(input, machineName)
+	var f *fsm.FSM
+	var err error
+	if strict {
+		f, err = loadFSMStrict(input, machineName)
+	} else {
+		f, err = loadFSMWithMachine(input, machineName)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		if opts.json {
+			printJSON(validateReport{Input: input, Error: err.Error()})
+			os.Exit(loadErrorCode(err))
+		}
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
 	}
 
 	err = f.Validate()
+	report := validateReport{
+		Input:       input,
+		Valid:       err == nil,
+		Type:        string(f.Type),
+		States:      len(f.States),
+		Transitions: len(f.Transitions),
+	}
+	if err != nil {
+		report.Error = err.Error()
+	} else if maxWarnings >= 0 {
+		report.WarningCount = len(f.Analyse())
+		checkWarnings(&report, maxWarnings)
+	}
+	if opts.json {
+		printJSON(report)
+		if !report.Valid || report.TooManyWarnings {
+			os.Exit(exitInvalid)
+		}
+		return
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Validation failed: %v\n", err)
-		os.Exit(1)
+		fatalf(exitInvalid, "Validation failed: %v", err)
+	}
+	if report.TooManyWarnings {
+		fatalf(exitInvalid, "%s: %s (see fsm analyse)", input, report.Error)
 	}
 
 	v := f.Vocab()
-	fmt.Printf("%s: valid %s with %d %s, %d %s\n",
-		input, f.Type, len(f.States), strings.ToLower(v.States), len(f.Transitions), strings.ToLower(v.Transition)+"s")
+	infof("%s: %s %s with %d %s, %d %s\n",
+		input, colorize(colorGreen, "valid"), f.Type, len(f.States), strings.ToLower(v.States), len(f.Transitions), strings.ToLower(v.Transition)+"s")
 }
 
+const runUsage = `Usage: fsm run <input> [-m machine] [--random] [--seed N]
+
+Run an FSM interactively: type input symbols to advance it, or "help"
+for the built-in commands.
+
+Options:
+  -m, --machine   Select the main machine from a bundle
+  --random        Random mode: each input takes one transition, chosen by
+                  probability
+  --seed N        Random seed for random mode (implies --random; default:
+                  current time)
+`
+
 func cmdRun(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm run <input> [-m machine]")
-		os.Exit(1)
+		fatalf(exitUsage, "%s", runUsage)
 	}
 
-	var input, machineName string
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-m", "--machine":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		default:
-			if !strings.HasPrefix(args[i], "-") && input == "" {
-				input = args[i]
-			}
+	var machineName, seedArg string
+	var random bool
+	seed := int64(-1)
+	fs := newFlagSet("run")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&random, "--random")
+	fs.String(&seedArg, "--seed")
+	positional := fs.parseOrExit(args, runUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	if fs.Seen("--seed") {
+		n, err := strconv.ParseInt(seedArg, 10, 64)
+		if err != nil || n < 0 {
+			fatalf(exitUsage, "Error: invalid seed %q", seedArg)
 		}
+		seed = n
+		random = true
+	}
+
+	if input == stdioPath {
+		fatalf(exitUsage, "Error: run reads commands from stdin; pass the machine as a file")
 	}
 
 	// Check if this is a bundle with linked states
 	isBundle, _ := fsmfile.IsBundle(input)
 	if isBundle {
+		if random {
+			fatalf(exitUsage, "Error: --random is not supported for bundles")
+		}
 		runBundle(input, machineName)
 		return
 	}
 
 	f, err := loadFSMWithMachine(input, machineName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	if f.Type == fsm.TypePDA {
+		if random {
+			fatalf(exitUsage, "Error: --random is not supported for PDAs")
+		}
+		runPDA(f)
+		return
 	}
 
 	// Check if single machine has linked states (warn user)
@@ -997,12 +1417,20 @@ func cmdRun(args []string) {
 
 	runner, err := fsm.NewRunner(f)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating runner: %v\n", err)
-		os.Exit(1)
+		fatalf(exitFailure, "Error creating runner: %v", err)
 	}
+	runner.SetLogger(debugLogger())
 
 	fmt.Printf("FSM: %s (%s)\n", f.Name, f.Type)
-	fmt.Printf("Commands: <input>, reset, status, history, inputs, quit\n")
+	if random {
+		if seed < 0 {
+			seed = time.Now().UnixNano() % 1000000
+		}
+		runner.SetRandom(rand.New(rand.NewSource(seed)))
+		runner.Reset()
+		fmt.Printf("Random mode (seed %d): each input takes one transition, weighted by probability\n", seed)
+	}
+	fmt.Printf("Commands: <input>, reset, status, history, inputs, set, vars, quit\n")
 	fmt.Println()
 
 	printStatus(runner, f)
@@ -1044,8 +1472,25 @@ func cmdRun(args []string) {
 			fmt.Println("  status   - Show current status")
 			fmt.Println("  history  - Show execution history")
 			fmt.Println("  inputs   - Show available inputs")
+			fmt.Println("  set N V  - Set variable N to V, for outputs such as grant(%N%)")
+			fmt.Println("  vars     - Show variables")
 			fmt.Println("  quit     - Exit")
+		case "vars":
+			names := runner.Vars()
+			if len(names) == 0 {
+				fmt.Println("No variables set")
+			}
+			for _, n := range names {
+				v, _ := runner.Var(n)
+				fmt.Printf("  %s = %s\n", n, v)
+			}
 		default:
+			if rest, ok := strings.CutPrefix(cmd, "set "); ok {
+				name, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+				runner.SetVar(name, strings.TrimSpace(value))
+				fmt.Printf("%s = %s\n", name, strings.TrimSpace(value))
+				continue
+			}
 			// Treat as input
 			output, err := runner.Step(cmd)
 			if err != nil {
@@ -1061,32 +1506,112 @@ func cmdRun(args []string) {
 	}
 }
 
-// runBundle runs a bundle with linked state support.
-func runBundle(path, mainMachine string) {
-	// Load all machines from bundle
-	machines, err := fsmfile.ListMachines(path)
+// runPDA runs a pushdown automaton interactively, showing the stack of
+// every configuration it could be in.
+func runPDA(f *fsm.FSM) {
+	runner, err := fsm.NewPDARunner(f)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing machines: %v\n", err)
-		os.Exit(1)
+		fatalf(exitFailure, "Error creating runner: %v", err)
 	}
 
-	if len(machines) == 0 {
-		fmt.Fprintf(os.Stderr, "No machines found in bundle\n")
-		os.Exit(1)
-	}
+	fmt.Printf("FSM: %s (%s)\n", f.Name, f.Type)
+	fmt.Printf("Commands: <input>, reset, status, history, inputs, quit\n")
+	fmt.Println()
 
-	// If no main specified, use first machine
-	if mainMachine == "" {
-		mainMachine = machines[0].Name
-	}
+	printPDAStatus(runner, f)
 
-	// Load all FSMs
-	fsmMap := make(map[string]*fsm.FSM)
-	for _, m := range machines {
-		f, _, err := fsmfile.ReadMachineFromBundle(path, m.Name)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading machine %s: %v\n", m.Name, err)
-			os.Exit(1)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			break
+		}
+
+		cmd := strings.TrimSpace(scanner.Text())
+		if cmd == "" {
+			continue
+		}
+
+		switch cmd {
+		case "quit", "exit", "q":
+			return
+		case "reset":
+			runner.Reset()
+			fmt.Println("Reset to initial state")
+			printPDAStatus(runner, f)
+		case "status":
+			printPDAStatus(runner, f)
+		case "history":
+			history := runner.History()
+			if len(history) == 0 {
+				fmt.Println("No history yet")
+				continue
+			}
+			fmt.Println("History:")
+			for i, step := range history {
+				fmt.Printf("  %d: %s --%s--> %s\n", i+1, step.FromState, step.Input, step.ToState)
+			}
+		case "inputs":
+			inputs := runner.AvailableInputs()
+			if len(inputs) == 0 {
+				fmt.Println("No inputs available from current state")
+			} else {
+				fmt.Printf("Available inputs: %v\n", inputs)
+			}
+		case "help", "?":
+			fmt.Println("Commands:")
+			fmt.Println("  <input>  - Send input to FSM")
+			fmt.Println("  reset    - Reset to initial state")
+			fmt.Println("  status   - Show current status and stacks")
+			fmt.Println("  history  - Show execution history")
+			fmt.Println("  inputs   - Show available inputs")
+			fmt.Println("  quit     - Exit")
+		default:
+			if err := runner.Step(cmd); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			printPDAStatus(runner, f)
+		}
+	}
+}
+
+// printPDAStatus prints the current states and, below, each
+// configuration's stack from bottom to top.
+func printPDAStatus(r *fsm.PDARunner, f *fsm.FSM) {
+	status := fmt.Sprintf("%s: %s", f.Vocab().State, r.CurrentState())
+	if r.IsAccepting() {
+		status += " [accepting]"
+	}
+	fmt.Println(status)
+	for _, c := range r.Configurations() {
+		fmt.Printf("  %s\n", c)
+	}
+}
+
+// runBundle runs a bundle with linked state support.
+func runBundle(path, mainMachine string) {
+	// Load all machines from bundle
+	machines, err := fsmfile.ListMachines(path)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error listing machines: %v", err)
+	}
+
+	if len(machines) == 0 {
+		fatalf(exitFailure, "No machines found in bundle")
+	}
+
+	// If no main specified, use first machine
+	if mainMachine == "" {
+		mainMachine = machines[0].Name
+	}
+
+	// Load all FSMs
+	fsmMap := make(map[string]*fsm.FSM)
+	for _, m := range machines {
+		f, _, err := fsmfile.ReadMachineFromBundle(path, m.Name)
+		if err != nil {
+			fatalf(loadErrorCode(err), "Error loading machine %s: %v", m.Name, err)
 		}
 		fsmMap[m.Name] = f
 	}
@@ -1103,8 +1628,7 @@ func runBundle(path, mainMachine string) {
 	// Create bundle runner
 	bundleRunner, err := fsm.NewBundleRunner(fsmMap, mainMachine)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating bundle runner: %v\n", err)
-		os.Exit(1)
+		fatalf(exitFailure, "Error creating bundle runner: %v", err)
 	}
 
 	mainFSM := fsmMap[mainMachine]
@@ -1241,62 +1765,91 @@ func printHistory(r *fsm.Runner) {
 	}
 }
 
+const viewUsage = `Usage: fsm view <input> [-t title] [--renderer native|graphviz] [--inline [--protocol kitty|iterm|sixel]]
+
+Generates a PNG visualisation of the FSM and opens it with the
+system's default image viewer.
+
+Options:
+  -t, --title    Set diagram title (default: FSM name or type)
+  --renderer R   Renderer: graphviz (default) or native, the built-in
+                 renderer (no Graphviz required)
+  --native       Same as --renderer native
+  --inline       Draw the image in the terminal instead, with the
+                 kitty, iTerm2, or sixel graphics protocol (works
+                 over SSH)
+  --protocol P   Graphics protocol for --inline: kitty, iterm, or
+                 sixel (default: detected from the environment)
+
+With the graphviz renderer, requires Graphviz 'dot' to be installed:
+  https://graphviz.org/download/
+`
+
 func cmdView(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm view <input> [-t title]")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Generates a PNG visualisation and opens it with the system viewer.")
-		fmt.Fprintln(os.Stderr, "Requires Graphviz 'dot' to be installed.")
-		os.Exit(1)
+		fatalf(exitUsage, "%s", viewUsage)
 	}
 
-	// Check for help flag
-	if args[0] == "-h" || args[0] == "--help" {
-		fmt.Println("Usage: fsm view <input> [-t title]")
-		fmt.Println("")
-		fmt.Println("Generates a PNG visualisation of the FSM and opens it with the")
-		fmt.Println("system's default image viewer.")
-		fmt.Println("")
-		fmt.Println("Options:")
-		fmt.Println("  -t, --title    Set diagram title (default: FSM name or type)")
-		fmt.Println("")
-		fmt.Println("Requires Graphviz 'dot' to be installed:")
-		fmt.Println("  https://graphviz.org/download/")
-		return
+	var title, protocol, renderer string
+	var nativeFlag, inline bool
+	fs := newFlagSet("view")
+	fs.String(&title, "-t", "--title")
+	fs.String(&renderer, "--renderer")
+	fs.Bool(&nativeFlag, "--native")
+	fs.Bool(&inline, "--inline")
+	fs.String(&protocol, "--protocol")
+	positional := fs.parseOrExit(args, viewUsage)
+	renderer = strings.ToLower(renderer)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	inline = inline || fs.Seen("--protocol")
+	if nativeFlag {
+		if renderer != "" && renderer != "native" {
+			fatalf(exitUsage, "Error: --native cannot be combined with --renderer %s", renderer)
+		}
+		renderer = "native"
 	}
 
-	input := args[0]
-	var title string
+	if renderer == "" {
+		renderer = config.Renderer
+	}
+	if renderer != "" && renderer != "native" && renderer != "graphviz" {
+		fatalf(exitUsage, "Error: unknown renderer %q (use native or graphviz)", renderer)
+	}
+	native := renderer == "native"
 
-	for i := 1; i < len(args); i++ {
-		switch args[i] {
-		case "-t", "--title":
-			if i+1 < len(args) {
-				title = args[i+1]
-				i++
-			}
+	var proto fsmfile.GraphicsProtocol
+	if inline {
+		proto = fsmfile.GraphicsProtocol(strings.ToLower(protocol))
+		if proto == fsmfile.GraphicsNone {
+			proto = fsmfile.DetectGraphicsProtocol(os.Getenv)
+		}
+		if proto == fsmfile.GraphicsNone {
+			fatalf(exitUsage, "Error: cannot tell which graphics protocol this terminal supports.\n"+
+				"Choose one with --protocol kitty, --protocol iterm, or --protocol sixel.")
+		}
+		known := false
+		for _, p := range fsmfile.GraphicsProtocols {
+			known = known || p == proto
+		}
+		if !known {
+			fatalf(exitUsage, "Error: unknown graphics protocol %q (use kitty, iterm, or sixel)", protocol)
 		}
 	}
 
 	// Check if dot is available
 	dotPath, err := exec.LookPath("dot")
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error: Graphviz 'dot' command not found in PATH.")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Please install Graphviz from: https://graphviz.org/download/")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Installation:")
-		fmt.Fprintln(os.Stderr, "  macOS:   brew install graphviz")
-		fmt.Fprintln(os.Stderr, "  Ubuntu:  sudo apt install graphviz")
-		fmt.Fprintln(os.Stderr, "  Windows: choco install graphviz")
-		os.Exit(1)
+	if err != nil && !native {
+		graphvizMissing("view " + input)
 	}
 
 	// Load FSM
 	f, err := loadFSM(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
 	}
 
 	// Generate title
@@ -1308,34 +1861,57 @@ func cmdView(args []string) {
 		}
 	}
 
-	// Generate DOT
-	dot := fsmfile.GenerateDOT(f, title)
-
 	// Create temp files
 	baseName := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
 	dotFile := filepath.Join(os.TempDir(), baseName+".dot")
 	pngFile := filepath.Join(os.TempDir(), baseName+".png")
 
-	// Write DOT file
-	if err := os.WriteFile(dotFile, []byte(dot), 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing DOT file: %v\n", err)
-		os.Exit(1)
+	if native {
+		out, err := os.Create(pngFile)
+		if err != nil {
+			fatalf(exitIO, "Error creating %s: %v", pngFile, err)
+		}
+		opts := fsmfile.DefaultPNGOptions()
+		opts.Title = title
+		opts.Logger = debugLogger()
+		err = fsmfile.RenderPNG(f, out, opts)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fatalf(exitFailure, "Error rendering PNG: %v", err)
+		}
+	} else {
+		// Write DOT file
+		dot := fsmfile.GenerateDOT(f, title)
+		if err := os.WriteFile(dotFile, []byte(dot), 0644); err != nil {
+			fatalf(exitIO, "Error writing DOT file: %v", err)
+		}
+
+		// Run dot to generate PNG
+		cmd := exec.Command(dotPath, "-Tpng", dotFile, "-o", pngFile)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			fatalf(exitFailure, "Error running dot: %v\n%s", err, output)
+		}
 	}
 
-	// Run dot to generate PNG
-	cmd := exec.Command(dotPath, "-Tpng", dotFile, "-o", pngFile)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error running dot: %v\n%s\n", err, output)
-		os.Exit(1)
+	if inline {
+		data, err := os.ReadFile(pngFile)
+		if err != nil {
+			fatalf(exitIO, "Error: %v", err)
+		}
+		if err := fsmfile.WriteInlineImage(os.Stdout, data, proto); err != nil {
+			fatalf(exitFailure, "Error drawing image: %v", err)
+		}
+		fmt.Println()
+		return
 	}
 
-	fmt.Printf("Generated: %s\n", pngFile)
+	infof("Generated: %s\n", pngFile)
 
 	// Open with system viewer
 	if err := openFile(pngFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening viewer: %v\n", err)
-		fmt.Fprintf(os.Stderr, "PNG file available at: %s\n", pngFile)
-		os.Exit(1)
+		fatalf(exitFailure, "Error opening viewer: %v\nPNG file available at: %s", err, pngFile)
 	}
 }
 
@@ -1346,7 +1922,8 @@ func cmdEdit(args []string) {
 		fmt.Println("")
 		fmt.Println("Open the visual FSM editor (fsmedit).")
 		fmt.Println("")
-		fmt.Println("Searches for fsmedit in:")
+		fmt.Println("Runs the editor named by \"editor\" in the config file, or searches")
+		fmt.Println("for fsmedit in:")
 		fmt.Println("  1. PATH")
 		fmt.Println("  2. Current working directory")
 		fmt.Println("  3. Same directory as fsm executable")
@@ -1356,15 +1933,14 @@ func cmdEdit(args []string) {
 	// Find fsmedit executable
 	editorPath := findEditor()
 	if editorPath == "" {
-		fmt.Fprintln(os.Stderr, "Error: fsmedit not found.")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Build it with: go build -o fsmedit ./cmd/fsmedit/")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Searched in:")
-		fmt.Fprintln(os.Stderr, "  - PATH")
-		fmt.Fprintln(os.Stderr, "  - Current working directory")
-		fmt.Fprintln(os.Stderr, "  - Same directory as fsm executable")
-		os.Exit(1)
+		fatalf(exitDependency, `Error: fsmedit not found.
+
+Build it with: go build -o fsmedit ./cmd/fsmedit/
+
+Searched in:
+  - PATH
+  - Current working directory
+  - Same directory as fsm executable`)
 	}
 
 	// Build command with args
@@ -1377,13 +1953,17 @@ func cmdEdit(args []string) {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			os.Exit(exitErr.ExitCode())
 		}
-		fmt.Fprintf(os.Stderr, "Error running fsmedit: %v\n", err)
-		os.Exit(1)
+		fatalf(exitFailure, "Error running fsmedit: %v", err)
 	}
 }
 
-// findEditor searches for fsmedit in PATH, pwd, and fsm's directory
+// findEditor returns the editor set in the config file, or searches for
+// fsmedit in PATH, pwd, and fsm's directory
 func findEditor() string {
+	if config.Editor != "" {
+		return config.Editor
+	}
+
 	editorName := "fsmedit"
 	if runtime.GOOS == "windows" {
 		editorName = "fsmedit.exe"
@@ -1414,141 +1994,438 @@ func findEditor() string {
 	return ""
 }
 
+const generateUsage = `Usage: fsm generate <input> --lang <language> [-o output] [--package name] [-m machine] [--all]
+                    [--mode monitor|scanner] [--history N] [--go-generate] [--check]
+                    [--prefix name] [--split] [--misra] [--no-std] [--defmt]
+                    [--doc-header] [--with-docs]
+
+Generates code from FSM definition.
+
+Languages:
+  c        C with header-only implementation
+  rust     Rust module
+  go       Go package (also works with TinyGo)
+  tinygo   Alias for go
+  external:PROGRAM
+           Run PROGRAM, which reads the machine as JSON on stdin
+           and writes the code to stdout; the package and input
+           file are in FSM_PACKAGE and FSM_SOURCE
+
+Options:
+  --lang, -l      Target language (required unless the config file sets it)
+  -o, --output    Output file (default: stdout)
+  --package, -p   Package name (Go only, default: fsm)
+  -m, --machine   Select machine from bundle
+  --all           Generate code for all machines in bundle
+                  Output files named: <machine>.<ext>
+  --mode          machine (default); monitor: add a conformance
+                  monitor that observes inputs and reports those the
+                  machine does not allow; or scanner: add a next-token
+                  function to a scanner from fsm scanner (C and Go only)
+  --history N     Events the monitor keeps for diagnostics (default: 16)
+  --go-generate   For //go:generate lines: Go output, gofmt-formatted,
+                  written to <input>_fsm.go unless -o is given, package
+                  inferred from the target directory, and the file only
+                  rewritten when it changes
+  --check         Write nothing; exit 3 if the output file is missing or
+                  out of date (for CI)
+  --prefix NAME   C only: identifier prefix (default: the machine name)
+  --split         C only: write <output>.h with the declarations and
+                  <output>.c with the implementation, not a header-only
+                  library
+  --misra         C only: MISRA-friendly style (U suffixes, single exit,
+                  break-terminated switch clauses, const read-only pointers)
+  --no-std        Rust only: code for #![no_std] crates, using core and
+                  const transition tables, with no allocation
+  --defmt         Rust only: derive defmt::Format and trace transitions,
+                  behind the crate's "defmt" feature
+  --doc-header    Start the code with a comment summarising the model:
+                  source file, fingerprint, states, and transition table
+  --with-docs     Also write Markdown documentation beside the code: the
+                  output path with a .md extension, describing the states,
+                  transitions, and symbols, with a Mermaid diagram
+
+Examples:
+  fsm generate machine.fsm --lang c -o machine.h
+  fsm generate machine.fsm --lang rust -o machine.rs
+  fsm generate machine.fsm --lang go --package myfsm -o myfsm.go
+  fsm generate bundle.fsm --machine child --lang c -o child.h
+  fsm generate bundle.fsm --all --lang go --package fsms
+  fsm generate protocol.fsm --lang c --mode monitor --history 32 -o monitor.h
+  fsm generate lexer.fsm --lang go --mode scanner --package lexer -o lexer.go
+  fsm generate machine.fsm --lang c --split --misra --prefix door -o door.c
+  fsm generate machine.fsm --lang rust --no-std --defmt -o machine.rs
+  fsm generate machine.fsm --lang c --doc-header -o machine.h
+  fsm generate machine.fsm --lang go --with-docs -o machine.go
+  fsm generate machine.fsm --lang external:plcgen -o machine.st
+
+  //go:generate go run github.com/ha1tch/fsm-toolkit/cmd/fsm generate --go-generate traffic.fsm
+  fsm generate --go-generate --check traffic.fsm
+`
+
 func cmdGenerate(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm generate <input> --lang <c|rust|go|tinygo> [-o output] [--package name] [-m machine] [--all]")
-		os.Exit(1)
+		fatalf(exitUsage, "%s", generateUsage)
 	}
 
-	// Check for help flag
-	if args[0] == "-h" || args[0] == "--help" {
-		fmt.Println("Usage: fsm generate <input> --lang <language> [-o output] [--package name] [-m machine] [--all]")
-		fmt.Println("")
-		fmt.Println("Generates code from FSM definition.")
-		fmt.Println("")
-		fmt.Println("Languages:")
-		fmt.Println("  c        C with header-only implementation")
-		fmt.Println("  rust     Rust module")
-		fmt.Println("  go       Go package (also works with TinyGo)")
-		fmt.Println("  tinygo   Alias for go")
-		fmt.Println("")
-		fmt.Println("Options:")
-		fmt.Println("  --lang, -l      Target language (required)")
-		fmt.Println("  -o, --output    Output file (default: stdout)")
-		fmt.Println("  --package, -p   Package name (Go only, default: fsm)")
-		fmt.Println("  -m, --machine   Select machine from bundle")
-		fmt.Println("  --all           Generate code for all machines in bundle")
-		fmt.Println("                  Output files named: <machine>.<ext>")
-		fmt.Println("")
-		fmt.Println("Examples:")
-		fmt.Println("  fsm generate machine.fsm --lang c -o machine.h")
-		fmt.Println("  fsm generate machine.fsm --lang rust -o machine.rs")
-		fmt.Println("  fsm generate machine.fsm --lang go --package myfsm -o myfsm.go")
-		fmt.Println("  fsm generate bundle.fsm --machine child --lang c -o child.h")
-		fmt.Println("  fsm generate bundle.fsm --all --lang go --package fsms")
-		return
-	}
-
-	input := args[0]
 	var output, lang, packageName, machineName string
-	var generateAll bool
-
-	for i := 1; i < len(args); i++ {
-		switch args[i] {
-		case "-o", "--output":
-			if i+1 < len(args) {
-				output = args[i+1]
-				i++
-			}
-		case "-l", "--lang":
-			if i+1 < len(args) {
-				lang = strings.ToLower(args[i+1])
-				i++
-			}
-		case "-p", "--package":
-			if i+1 < len(args) {
-				packageName = args[i+1]
-				i++
-			}
-		case "-m", "--machine":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
+	var generateAll, goGenerate, check, docHeader, withDocs bool
+	var cOpts codegen.COptions
+	var rustOpts codegen.RustOptions
+	mode := "machine"
+	history := codegen.DefaultMonitorHistory
+	fs := newFlagSet("generate")
+	fs.String(&output, "-o", "--output")
+	fs.String(&lang, "-l", "--lang")
+	fs.String(&packageName, "-p", "--package")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&generateAll, "--all")
+	fs.String(&mode, "--mode")
+	fs.Int(&history, "--history")
+	fs.Bool(&goGenerate, "--go-generate")
+	fs.Bool(&check, "--check")
+	fs.String(&cOpts.Prefix, "--prefix")
+	fs.Bool(&cOpts.Split, "--split")
+	fs.Bool(&cOpts.MISRA, "--misra")
+	fs.Bool(&rustOpts.NoStd, "--no-std")
+	fs.Bool(&rustOpts.Defmt, "--defmt")
+	fs.Bool(&docHeader, "--doc-header")
+	fs.Bool(&withDocs, "--with-docs")
+	positional := fs.parseOrExit(args, generateUsage)
+	if !strings.HasPrefix(lang, "external:") {
+		lang = strings.ToLower(lang)
+	}
+	mode = strings.ToLower(mode)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	if history < 1 {
+		fatalf(exitUsage, "Error: --history must be a positive number, got %d", history)
+	}
+
+	// Defaults from the config file; --go-generate settles the language
+	// and package itself.
+	if !goGenerate {
+		if lang == "" {
+			lang = config.Generate.Lang
+		}
+		if packageName == "" && (lang == "go" || lang == "tinygo") {
+			packageName = config.Generate.Package
+		}
+	}
+	docHeader = docHeader || (config.Generate.DocHeader && builtinLang(lang))
+	if lang == "c" && mode == "machine" {
+		cOpts.MISRA = cOpts.MISRA || config.Generate.MISRA
+	}
+	if lang == "rust" {
+		rustOpts.NoStd = rustOpts.NoStd || config.Generate.NoStd
+	}
+
+	if goGenerate {
+		if lang != "" && lang != "go" && lang != "tinygo" {
+			fatalf(exitUsage, "Error: --go-generate generates Go")
+		}
+		if generateAll {
+			fatalf(exitUsage, "Error: --go-generate generates one machine; use -m to pick it")
+		}
+		lang = "go"
+		if output == "" {
+			if input == stdioPath {
+				fatalf(exitUsage, "Error: --go-generate needs -o when reading standard input")
 			}
-		case "--all":
-			generateAll = true
+			output = goGenerateOutput(input)
 		}
+		if packageName == "" {
+			packageName = inferGoPackage(filepath.Dir(output), output)
+		}
+	}
+	if check && (output == "" || output == stdioPath) {
+		fatalf(exitUsage, "Error: --check needs an output file")
 	}
 
 	if lang == "" {
-		fmt.Fprintln(os.Stderr, "Error: --lang is required")
-		fmt.Fprintln(os.Stderr, "Use: fsm generate --help")
-		os.Exit(1)
+		fatalf(exitUsage, "Error: --lang is required\nUse: fsm generate --help")
+	}
+	plugin := pluginGenerator(lang)
+	if plugin == nil && !builtinLang(lang) {
+		fatalf(exitUsage, "Error: unknown language: %s\nSupported: %s", lang, strings.Join(generatorNames(), ", "))
+	}
+	if plugin != nil && docHeader {
+		fatalf(exitUsage, "Error: --doc-header applies to c, rust, go, and tinygo")
+	}
+	switch mode {
+	case "machine":
+	case "monitor", "scanner":
+		if lang != "c" && lang != "go" && lang != "tinygo" {
+			fatalf(exitUsage, "Error: --mode %s supports c, go, and tinygo", mode)
+		}
+	default:
+		fatalf(exitUsage, "Error: unknown mode: %s (use machine, monitor, or scanner)", mode)
+	}
+	if mode != "monitor" {
+		history = 0
+	}
+	if (rustOpts.NoStd || rustOpts.Defmt) && lang != "rust" {
+		fatalf(exitUsage, "Error: --no-std and --defmt apply to Rust only")
+	}
+	if cOpts != (codegen.COptions{}) && lang != "c" {
+		fatalf(exitUsage, "Error: --prefix, --split, and --misra apply to C only")
+	}
+	if cOpts.Prefix != "" && !cIdentifier.MatchString(cOpts.Prefix) {
+		fatalf(exitUsage, "Error: --prefix must be a C identifier, got %q", cOpts.Prefix)
+	}
+	if cOpts.Prefix != "" && generateAll {
+		fatalf(exitUsage, "Error: --prefix would give every machine the same identifiers; it cannot be used with --all")
+	}
+	if cOpts.MISRA && history > 0 {
+		fatalf(exitUsage, "Error: --misra does not apply to monitors, which use stdio.h")
+	}
+	if cOpts.Split && !generateAll && (output == "" || output == stdioPath) {
+		fatalf(exitUsage, "Error: --split needs -o to name the .h and .c files")
+	}
+	if withDocs && !generateAll {
+		if output == "" || output == stdioPath {
+			fatalf(exitUsage, "Error: --with-docs needs -o to name the documentation")
+		}
+		if !cOpts.Split && docsPath(output) == output {
+			fatalf(exitUsage, "Error: --with-docs would write the documentation over %s", output)
+		}
 	}
 
 	// Handle --all for bundles
 	if generateAll {
-		generateAllMachines(input, lang, packageName)
+		generateAllMachines(input, lang, packageName, mode, history, docHeader, withDocs, cOpts, rustOpts)
 		return
 	}
 
 	// Load FSM
 	f, err := loadFSMWithMachine(input, machineName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	if f.Type == fsm.TypePDA && plugin == nil {
+		fatalf(exitFailure, "Error: code generation does not support PDAs")
+	}
+	if _, err := f.Encodings(); err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if _, err := f.InputClasses(); err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if mode == "scanner" {
+		if err := f.ValidateScanner(); err != nil {
+			fatalf(exitFailure, "Error: not a scanner: %v", err)
+		}
 	}
 
 	// Generate code
-	var code string
+	var code, source string
 	switch lang {
 	case "c":
-		code = codegen.GenerateC(f)
+		if cOpts.Split {
+			cOpts.Header = filepath.Base(splitCBase(output)) + ".h"
+		}
+		code, source = generateCCode(f, mode, history, cOpts)
 	case "rust":
-		code = codegen.GenerateRust(f)
+		code = codegen.GenerateRustWithOptions(f, rustOpts)
 	case "go", "tinygo":
-		code = codegen.GenerateGo(f, packageName)
+		code = generateGoCode(f, packageName, mode, history)
 	default:
-		fmt.Fprintf(os.Stderr, "Error: unknown language: %s\n", lang)
-		fmt.Fprintln(os.Stderr, "Supported: c, rust, go, tinygo")
-		os.Exit(1)
+		code, err = plugin.Generate(f, codegen.Options{Package: packageName, Source: sourceName(input)})
+		if err != nil {
+			fatalf(pluginErrorCode(err), "Error: %v", err)
+		}
+	}
+	if docHeader {
+		code, source = withDocHeader(f, input, code, source)
 	}
 
 	// Output
-	if output != "" {
+	if withDocs {
+		// The documentation is checked or written first, so that it is
+		// there before code that refers to it.
+		docs := docsPath(output)
+		if cOpts.Split {
+			docs = splitCBase(output) + ".md"
+		}
+		if err := writeDocs(f, docs, check); err != nil {
+			fatalf(generatedErrorCode(err), "Error: %v", err)
+		}
+	}
+	if cOpts.Split {
+		base := splitCBase(output)
+		if err := writeSplitC(base, code, source, check); err != nil {
+			fatalf(generatedErrorCode(err), "Error: %v", err)
+		}
+		return
+	}
+	if goGenerate {
+		if code, err = formatGo(code); err != nil {
+			fatalf(exitFailure, "Error: %v", err)
+		}
+	}
+	if goGenerate || check {
+		if err := writeGenerated(output, code, check); err != nil {
+			fatalf(generatedErrorCode(err), "Error: %v", err)
+		}
+	} else if output != "" && output != stdioPath {
 		err := os.WriteFile(output, []byte(code), 0644)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
-			os.Exit(1)
+			fatalf(exitIO, "Error writing %s: %v", output, err)
 		}
-		fmt.Printf("Generated: %s\n", output)
+		infof("Generated: %s\n", output)
 	} else {
 		fmt.Print(code)
 	}
 }
 
-// generateAllMachines generates code for all machines in a bundle
-func generateAllMachines(input, lang, packageName string) {
+// builtinLang reports whether lang is one of the languages fsm generate
+// supports itself, with its modes and options.
+func builtinLang(lang string) bool {
+	switch lang {
+	case "c", "rust", "go", "tinygo":
+		return true
+	}
+	return false
+}
+
+// pluginGenerator returns the generator for a --lang that is not built
+// in: a program for external:<program>, or a generator registered with
+// codegen.Register. It returns nil for built-in and unknown languages.
+func pluginGenerator(lang string) codegen.Generator {
+	if program, ok := strings.CutPrefix(lang, "external:"); ok && program != "" {
+		return codegen.External(program)
+	}
+	if builtinLang(lang) {
+		return nil
+	}
+	return codegen.GeneratorByName(lang)
+}
+
+// generatorNames lists the languages --lang accepts, for errors.
+func generatorNames() []string {
+	var names []string
+	for _, g := range codegen.Generators() {
+		names = append(names, g.Name())
+	}
+	return append(names, "external:PROGRAM")
+}
+
+// pluginErrorCode returns the exit code for an error from a plugin
+// generator: a missing external program is a missing dependency.
+func pluginErrorCode(err error) int {
+	if errors.Is(err, exec.ErrNotFound) {
+		return exitDependency
+	}
+	return exitFailure
+}
+
+// sourceName names input in generated code and documentation.
+func sourceName(input string) string {
+	if input == stdioPath {
+		return "standard input"
+	}
+	return input
+}
+
+// withDocHeader prepends a summary of f, read from input, to generated
+// code and, for split C, to its source file.
+func withDocHeader(f *fsm.FSM, input, code, source string) (string, string) {
+	doc := codegen.DocHeader(f, sourceName(input))
+	if source != "" {
+		source = doc + source
+	}
+	return doc + code, source
+}
+
+// docsPath returns the path --with-docs writes the documentation of the
+// code at output to: output with its extension replaced by .md.
+func docsPath(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".md"
+}
+
+// writeDocs writes the Markdown documentation of f, a report with a
+// Mermaid diagram, to path, leaving the file alone if it is up to date;
+// with check, it writes nothing and reports a missing or out-of-date file
+// as an error.
+func writeDocs(f *fsm.FSM, path string, check bool) error {
+	opts := fsmfile.DefaultReportOptions()
+	opts.Mermaid = true
+	return writeGenerated(path, fsmfile.GenerateMarkdownReport(f, opts), check)
+}
+
+// cIdentifier matches a valid C identifier, as --prefix requires.
+var cIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// generateCCode generates C for f in mode, with a monitor keeping
+// history events in monitor mode. The source is empty unless opts.Split
+// is set.
+func generateCCode(f *fsm.FSM, mode string, history int, opts codegen.COptions) (header, source string) {
+	switch mode {
+	case "monitor":
+		return codegen.GenerateCMonitorWithOptions(f, history, opts)
+	case "scanner":
+		return codegen.GenerateCScannerWithOptions(f, opts)
+	}
+	return codegen.GenerateCWithOptions(f, opts)
+}
+
+// generateGoCode is generateCCode for Go.
+func generateGoCode(f *fsm.FSM, packageName, mode string, history int) string {
+	switch mode {
+	case "monitor":
+		return codegen.GenerateGoMonitor(f, packageName, history)
+	case "scanner":
+		return codegen.GenerateGoScanner(f, packageName)
+	}
+	return codegen.GenerateGo(f, packageName)
+}
+
+// splitCBase returns the path --split output is written to, without the
+// extension: "door.c", "door.h", and "door" all give "door".
+func splitCBase(output string) string {
+	switch filepath.Ext(output) {
+	case ".c", ".h":
+		return strings.TrimSuffix(output, filepath.Ext(output))
+	}
+	return output
+}
+
+// writeSplitC writes header and source to base.h and base.c, leaving a
+// file alone if it is up to date; with check, it writes nothing and
+// reports a missing or out-of-date file as an error.
+func writeSplitC(base, header, source string, check bool) error {
+	if err := writeGenerated(base+".h", header, check); err != nil {
+		return err
+	}
+	return writeGenerated(base+".c", source, check)
+}
+
+// generateAllMachines generates code for all machines in a bundle in
+// mode, with monitors keeping history events in monitor mode, each file
+// starting with a summary of its machine if docHeader is set, and
+// <machine>.md beside it if withDocs is.
+func generateAllMachines(input, lang, packageName, mode string, history int, docHeader, withDocs bool, cOpts codegen.COptions, rustOpts codegen.RustOptions) {
 	// Check if it's a bundle
 	isBundle, err := fsmfile.IsBundle(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error reading %s: %v", input, err)
 	}
 	if !isBundle {
-		fmt.Fprintln(os.Stderr, "Error: --all requires a bundle file with multiple machines")
-		os.Exit(1)
+		fatalf(exitUsage, "Error: --all requires a bundle file with multiple machines")
 	}
 
 	// List all machines
 	machines, err := fsmfile.ListMachines(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing machines: %v\n", err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error listing machines: %v", err)
 	}
 
 	// Determine file extension
 	var ext string
+	plugin := pluginGenerator(lang)
 	switch lang {
 	case "c":
 		ext = ".h"
@@ -1557,8 +2434,10 @@ func generateAllMachines(input, lang, packageName string) {
 	case "go", "tinygo":
 		ext = ".go"
 	default:
-		fmt.Fprintf(os.Stderr, "Error: unknown language: %s\n", lang)
-		os.Exit(1)
+		ext = plugin.Extension()
+		if ext == "" {
+			fatalf(exitUsage, "Error: --all names files by extension, and %s's is not known; generate each machine with -m and -o", lang)
+		}
 	}
 
 	// Generate code for each machine
@@ -1568,31 +2447,88 @@ func generateAllMachines(input, lang, packageName string) {
 			fmt.Fprintf(os.Stderr, "Error loading machine %s: %v\n", m.Name, err)
 			continue
 		}
+		if f.Type == fsm.TypePDA && plugin == nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: code generation does not support PDAs\n", m.Name)
+			continue
+		}
+		if _, err := f.Encodings(); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", m.Name, err)
+			continue
+		}
+		if _, err := f.InputClasses(); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", m.Name, err)
+			continue
+		}
+		if mode == "scanner" {
+			if err := f.ValidateScanner(); err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping %s: not a scanner: %v\n", m.Name, err)
+				continue
+			}
+		}
 
-		var code string
+		var code, source string
 		switch lang {
 		case "c":
-			code = codegen.GenerateC(f)
+			opts := cOpts
+			opts.Header = m.Name + ".h"
+			code, source = generateCCode(f, mode, history, opts)
 		case "rust":
-			code = codegen.GenerateRust(f)
+			code = codegen.GenerateRustWithOptions(f, rustOpts)
 		case "go", "tinygo":
 			// Use machine name as package if not specified
 			pkg := packageName
 			if pkg == "" {
 				pkg = m.Name
 			}
-			code = codegen.GenerateGo(f, pkg)
+			code = generateGoCode(f, pkg, mode, history)
+		default:
+			code, err = plugin.Generate(f, codegen.Options{Package: packageName, Source: sourceName(input)})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", m.Name, err)
+				continue
+			}
+		}
+		if docHeader {
+			code, source = withDocHeader(f, input, code, source)
+		}
+		if withDocs {
+			if err := writeDocs(f, defaultOutputPath(m.Name+".md"), false); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+		}
+
+		if cOpts.Split {
+			if err := writeSplitC(defaultOutputPath(m.Name), code, source, false); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			continue
 		}
 
-		outputFile := m.Name + ext
+		outputFile := defaultOutputPath(m.Name + ext)
 		if err := os.WriteFile(outputFile, []byte(code), 0644); err != nil {
 			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outputFile, err)
 			continue
 		}
-		fmt.Printf("Generated: %s\n", outputFile)
+		infof("Generated: %s\n", outputFile)
 	}
 }
 
+// graphvizMissing reports that Graphviz's dot is not installed, suggesting
+// "fsm <command> --renderer native" instead, and exits.
+func graphvizMissing(command string) {
+	fatalf(exitDependency, `Error: Graphviz 'dot' command not found in PATH.
+
+Tip: Use the built-in renderer, which needs no Graphviz:
+  fsm %s --renderer native
+
+Or install Graphviz from: https://graphviz.org/download/
+
+Installation:
+  macOS:   brew install graphviz
+  Ubuntu:  sudo apt install graphviz
+  Windows: choco install graphviz`, command)
+}
+
 // openFile opens a file with the system's default application.
 func openFile(path string) error {
 	var cmd *exec.Cmd
@@ -1612,35 +2548,101 @@ func openFile(path string) error {
 }
 
 func loadFSM(path string) (*fsm.FSM, error) {
-	ext := filepath.Ext(path)
-
-	switch ext {
-	case ".fsm":
-		return fsmfile.ReadFSMFile(path)
-	case ".json":
-		data, err := os.ReadFile(path)
+	if path == stdioPath {
+		data, err := readStdin()
 		if err != nil {
 			return nil, err
 		}
-		return fsmfile.ParseJSON(data)
-	case ".hex":
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return nil, err
+		return parseFSMData(data, "")
+	}
+
+	// The extension picks the format; unknown extensions are sniffed.
+	f, _, err := fsmfile.ReadMachineFile(path)
+	return f, err
+}
+
+// loadFSMStrict is loadFSMWithMachine, except that JSON input is parsed
+// with fsmfile.ParseJSONStrict. Other formats have no free-form fields
+// to misspell and load as usual.
+func loadFSMStrict(path, machineName string) (*fsm.FSM, error) {
+	var data []byte
+	var err error
+	switch {
+	case path == stdioPath:
+		data, err = readStdin()
+	case filepath.Ext(path) == ".fsm" || filepath.Ext(path) == ".fsmt" || filepath.Ext(path) == ".hex":
+		return loadFSMWithMachine(path, machineName)
+	default:
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sniffFormat(data) != "json" {
+		return parseFSMData(data, machineName)
+	}
+	f, err := fsmfile.ParseJSONStrict(data)
+	if err != nil {
+		return nil, err
+	}
+	dir := "."
+	if path != stdioPath {
+		dir = filepath.Dir(path)
+	}
+	return f, fsmfile.ResolveIncludes(f, data, dir)
+}
+
+// saveFSM writes an FSM to path, choosing the format from the extension.
+func saveFSM(path string, f *fsm.FSM, pretty, includeLabels bool) error {
+	return fsmfile.WriteMachineFile(path, f, fsmfile.WriteOptions{Pretty: pretty, Labels: includeLabels})
+}
+
+// loadLayoutWithMachine returns the editor layout saved with a machine in
+// a .fsm file or bundle, or nil if there is none.
+func loadLayoutWithMachine(path, machineName string) *fsmfile.Layout {
+	var layout *fsmfile.Layout
+	var err error
+	switch {
+	case path == stdioPath:
+		data, rerr := readStdin()
+		if rerr != nil || sniffFormat(data) != "fsm" {
+			return nil
+		}
+		_, layout, err = fsmfile.ReadFSMBytesWithLayout(data)
+	case filepath.Ext(path) != ".fsm":
+		return nil
+	default:
+		isBundle, _ := fsmfile.IsBundle(path)
+		if !isBundle {
+			_, layout, err = fsmfile.ReadFSMFileWithLayout(path)
+			break
 		}
-		records, err := fsmfile.ParseHex(string(data))
-		if err != nil {
-			return nil, err
+		if machineName == "" {
+			machines, lerr := fsmfile.ListMachines(path)
+			if lerr != nil || len(machines) == 0 {
+				return nil
+			}
+			machineName = machines[0].Name
 		}
-		return fsmfile.RecordsToFSM(records, nil)
-	default:
-		return nil, fmt.Errorf("unknown file format: %s", ext)
+		_, layout, err = fsmfile.ReadMachineFromBundle(path, machineName)
 	}
+	if err != nil || layout == nil || len(layout.States) == 0 {
+		return nil
+	}
+	return layout
 }
 
 // loadFSMWithMachine loads an FSM, optionally selecting a specific machine from a bundle.
 // If machineName is empty and the file is a bundle, loads the first machine.
 func loadFSMWithMachine(path string, machineName string) (*fsm.FSM, error) {
+	if path == stdioPath {
+		data, err := readStdin()
+		if err != nil {
+			return nil, err
+		}
+		return parseFSMData(data, machineName)
+	}
+
 	ext := filepath.Ext(path)
 
 	if ext == ".fsm" {
@@ -1675,25 +2677,29 @@ func loadFSMWithMachine(path string, machineName string) (*fsm.FSM, error) {
 	return loadFSM(path)
 }
 
+const machinesUsage = `Usage: fsm machines <bundle.fsm>
+
+Lists all machines contained in a bundle.
+`
+
 func cmdMachines(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm machines <bundle.fsm>")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Lists all machines contained in a bundle.")
-		os.Exit(1)
+		fatalf(exitUsage, "%s", machinesUsage)
 	}
 
-	input := args[0]
+	positional := newFlagSet("machines").parseOrExit(args, machinesUsage)
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
 	
 	if filepath.Ext(input) != ".fsm" {
-		fmt.Fprintf(os.Stderr, "Error: %s is not a .fsm file\n", input)
-		os.Exit(1)
+		fatalf(exitUsage, "Error: %s is not a .fsm file", input)
 	}
 
 	machines, err := fsmfile.ListMachines(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error reading %s: %v", input, err)
 	}
 
 	if len(machines) == 1 {
@@ -1715,137 +2721,66 @@ func cmdMachines(args []string) {
 	}
 }
 
+const bundleUsage = `Usage: fsm bundle <input1.fsm> <input2.fsm> ... -o <output.fsm>
+
+Combines multiple .fsm files into a single bundle.
+Each input becomes a named machine in the bundle.
+
+Options:
+  -o, --output    Output bundle (required)
+`
+
 func cmdBundle(args []string) {
 	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm bundle <input1.fsm> <input2.fsm> ... -o <output.fsm>")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Combines multiple .fsm files into a single bundle.")
-		fmt.Fprintln(os.Stderr, "Each input becomes a named machine in the bundle.")
-		os.Exit(1)
+		fatalf(exitUsage, "%s", bundleUsage)
 	}
 
-	var inputs []string
 	var output string
-
-	for i := 0; i < len(args); i++ {
-		if args[i] == "-o" && i+1 < len(args) {
-			output = args[i+1]
-			i++
-		} else if !strings.HasPrefix(args[i], "-") {
-			inputs = append(inputs, args[i])
-		}
-	}
+	fs := newFlagSet("bundle")
+	fs.String(&output, "-o", "--output")
+	inputs := fs.parseOrExit(args, bundleUsage)
 
 	if output == "" {
-		fmt.Fprintln(os.Stderr, "Error: -o output.fsm is required")
-		os.Exit(1)
+		fatalf(exitUsage, "Error: -o output.fsm is required")
 	}
 
 	if len(inputs) < 1 {
-		fmt.Fprintln(os.Stderr, "Error: at least one input file is required")
-		os.Exit(1)
+		fatalf(exitUsage, "Error: at least one input file is required")
 	}
 
 	// Create bundle
 	err := fsmfile.CreateBundle(inputs, output)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating bundle: %v\n", err)
-		os.Exit(1)
+		fatalf(exitIO, "Error creating bundle: %v", err)
 	}
 
 	fmt.Printf("Created bundle: %s (%d machines)\n", output, len(inputs))
 }
 
-func cmdExtract(args []string) {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: fsm extract <bundle.fsm> --machine <name> [-o output.fsm]")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Extracts a single machine from a bundle.")
-		os.Exit(1)
-	}
-
-	var input, machineName, output string
-
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--machine", "-m":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		case "-o":
-			if i+1 < len(args) {
-				output = args[i+1]
-				i++
-			}
-		default:
-			if !strings.HasPrefix(args[i], "-") && input == "" {
-				input = args[i]
-			}
-		}
-	}
-
-	if input == "" {
-		fmt.Fprintln(os.Stderr, "Error: input bundle is required")
-		os.Exit(1)
-	}
-
-	if machineName == "" {
-		fmt.Fprintln(os.Stderr, "Error: --machine name is required")
-		os.Exit(1)
-	}
-
-	if output == "" {
-		output = machineName + ".fsm"
-	}
-
-	// Extract machine
-	f, layout, err := fsmfile.ReadMachineFromBundle(input, machineName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error extracting %s: %v\n", machineName, err)
-		os.Exit(1)
-	}
-
-	// Write to output
-	var positions map[string][2]int
-	var offsetX, offsetY int
-	if layout != nil {
-		positions = make(map[string][2]int)
-		for name, pos := range layout.States {
-			positions[name] = [2]int{pos.X, pos.Y}
-		}
-		offsetX = layout.Editor.CanvasOffsetX
-		offsetY = layout.Editor.CanvasOffsetY
-	}
-
-	err = fsmfile.WriteFSMFileWithLayout(output, f, true, positions, offsetX, offsetY)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
-		os.Exit(1)
-	}
-
-	fmt.Printf("Extracted %s to %s\n", machineName, output)
-}
-
 // renderAllMachines renders all machines in a bundle to separate files or a tiled image
-func renderAllMachines(input, outputPattern, format string, native bool, fontSize int, spacing float64, canvasWidth, canvasHeight int, shape string) {
+func renderAllMachines(input, outputPattern, format string, native bool, fontSize int, spacing float64, canvasWidth, canvasHeight int, shape string, theme fsmfile.Theme, engine fsmfile.LayoutEngine, useLayout bool, pixelScale float64, dpi int, transparent bool, pngFont fsmfile.PNGFont, separateEdges, bundleEdges bool, jobs int) {
 	machines, err := fsmfile.ListMachines(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing machines: %v\n", err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error listing machines: %v", err)
 	}
 
 	if len(machines) == 0 {
-		fmt.Fprintln(os.Stderr, "No machines found in bundle")
-		os.Exit(1)
+		fatalf(exitFailure, "No machines found in bundle")
 	}
 
-	// Render each machine to a separate file
-	for _, m := range machines {
-		f, _, err := fsmfile.ReadMachineFromBundle(input, m.Name)
+	var dotPath string
+	if !native {
+		dotPath, err = exec.LookPath("dot")
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading machine %s: %v\n", m.Name, err)
-			continue
+			fatalf(exitDependency, "Error: Graphviz 'dot' not found. Use --native flag.")
+		}
+	}
+
+	// Render each machine to a separate file, several at once
+	renderOne := func(m fsmfile.MachineInfo) (string, error) {
+		f, layout, err := fsmfile.ReadMachineFromBundle(input, m.Name)
+		if err != nil {
+			return "", fmt.Errorf("loading machine %s: %v", m.Name, err)
 		}
 
 		// Generate output filename
@@ -1861,14 +2796,13 @@ func renderAllMachines(input, outputPattern, format string, native bool, fontSiz
 				output = filepath.Join(dir, base+"_"+m.Name+"."+format)
 			}
 		} else {
-			output = m.Name + "." + format
+			output = defaultOutputPath(m.Name + "." + format)
 		}
 
 		// Ensure output directory exists
 		if dir := filepath.Dir(output); dir != "" && dir != "." {
 			if err := os.MkdirAll(dir, 0755); err != nil {
-				fmt.Fprintf(os.Stderr, "Error creating directory %s: %v\n", dir, err)
-				continue
+				return output, fmt.Errorf("creating directory %s: %v", dir, err)
 			}
 		}
 
@@ -1882,6 +2816,14 @@ func renderAllMachines(input, outputPattern, format string, native bool, fontSiz
 			if format == "png" {
 				opts := fsmfile.DefaultPNGOptions()
 				opts.Title = title
+				opts.LayoutEngine = engine
+				opts.Scale = pixelScale
+				opts.Logger = debugLogger()
+				opts.DPI = dpi
+				opts.Transparent = transparent
+				opts.Font = pngFont
+				opts.SeparateEdges = separateEdges
+				opts.BundleEdges = bundleEdges
 				if fontSize > 0 {
 					opts.FontSize = fontSize
 				}
@@ -1897,18 +2839,24 @@ func renderAllMachines(input, outputPattern, format string, native bool, fontSiz
 
 				outFile, err := os.Create(output)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", output, err)
-					continue
+					return output, fmt.Errorf("creating %s: %v", output, err)
 				}
 				if err := fsmfile.RenderPNG(f, outFile, opts); err != nil {
 					outFile.Close()
-					fmt.Fprintf(os.Stderr, "Error rendering %s: %v\n", m.Name, err)
-					continue
+					return output, fmt.Errorf("rendering %s: %v", m.Name, err)
 				}
 				outFile.Close()
 			} else if format == "svg" {
 				opts := fsmfile.DefaultSVGOptions()
 				opts.Title = title
+				opts.Theme = theme
+				opts.LayoutEngine = engine
+				opts.Logger = debugLogger()
+				opts.SeparateEdges = separateEdges
+				opts.BundleEdges = bundleEdges
+				if useLayout {
+					opts.UseLayout = layout
+				}
 				if fontSize > 0 {
 					opts.FontSize = fontSize
 				}
@@ -1938,109 +2886,102 @@ func renderAllMachines(input, outputPattern, format string, native bool, fontSiz
 
 				svg := fsmfile.GenerateSVGNative(f, opts)
 				if err := os.WriteFile(output, []byte(svg), 0644); err != nil {
-					fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", output, err)
-					continue
+					return output, fmt.Errorf("writing %s: %v", output, err)
 				}
 			}
 		} else {
 			// Use Graphviz
-			dotPath, err := exec.LookPath("dot")
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "Error: Graphviz 'dot' not found. Use --native flag.")
-				os.Exit(1)
-			}
-
 			dot := fsmfile.GenerateDOT(f, title)
 			cmd := exec.Command(dotPath, "-T"+format)
 			cmd.Stdin = strings.NewReader(dot)
 
 			outFile, err := os.Create(output)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", output, err)
-				continue
+				return output, fmt.Errorf("creating %s: %v", output, err)
 			}
 
 			cmd.Stdout = outFile
-			cmd.Stderr = os.Stderr
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
 
 			if err := cmd.Run(); err != nil {
 				outFile.Close()
-				fmt.Fprintf(os.Stderr, "Error running dot for %s: %v\n", m.Name, err)
-				continue
+				if msg := strings.TrimSpace(stderr.String()); msg != "" {
+					err = fmt.Errorf("%v: %s", err, msg)
+				}
+				return output, fmt.Errorf("running dot for %s: %v", m.Name, err)
 			}
 			outFile.Close()
 		}
 
-		fmt.Printf("Generated: %s\n", output)
+		return output, nil
 	}
+	outputs := make([]string, len(machines))
+	errs := make([]error, len(machines))
+	runJobs(len(machines), jobs, func(i int) {
+		outputs[i], errs[i] = renderOne(machines[i])
+	})
 
-	fmt.Printf("\nRendered %d machines from %s\n", len(machines), input)
+	failed := 0
+	for i := range machines {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", errs[i])
+			failed++
+			continue
+		}
+		infof("Generated: %s\n", outputs[i])
+	}
+
+	if failed > 0 {
+		fmt.Printf("\nRendered %d of %d machines from %s\n", len(machines)-failed, len(machines), input)
+	} else {
+		fmt.Printf("\nRendered %d machines from %s\n", len(machines), input)
+	}
 }
 
+const netlistUsage = `Usage: fsm netlist <input> [options]
+
+Export structural netlist from an FSM with port/net data.
+
+Formats:
+  text     Human-readable netlist (default)
+  kicad    KiCad legacy S-expression (.net)
+  json     Structured JSON netlist
+
+Options:
+  -f, --format   Output format: text, kicad, json (default: text)
+  -o, --output   Output file (default: stdout)
+  -m, --machine  Select machine from bundle
+  --bake         Write derived KiCad fields into source file classes
+                 (kicad_part, kicad_footprint). Only for JSON files.
+                 Does not overwrite existing values.
+
+Examples:
+  fsm netlist circuit.json
+  fsm netlist circuit.fsm --format kicad -o circuit.net
+  fsm netlist bundle.fsm -m controller --format json
+  fsm netlist circuit.json --bake
+`
+
 func cmdNetlist(args []string) {
-	if len(args) < 1 || args[0] == "-h" || args[0] == "--help" {
-		fmt.Println("Usage: fsm netlist <input> [options]")
-		fmt.Println("")
-		fmt.Println("Export structural netlist from an FSM with port/net data.")
-		fmt.Println("")
-		fmt.Println("Formats:")
-		fmt.Println("  text     Human-readable netlist (default)")
-		fmt.Println("  kicad    KiCad legacy S-expression (.net)")
-		fmt.Println("  json     Structured JSON netlist")
-		fmt.Println("")
-		fmt.Println("Options:")
-		fmt.Println("  -f, --format   Output format: text, kicad, json (default: text)")
-		fmt.Println("  -o, --output   Output file (default: stdout)")
-		fmt.Println("  -m, --machine  Select machine from bundle")
-		fmt.Println("  --bake         Write derived KiCad fields into source file classes")
-		fmt.Println("                 (kicad_part, kicad_footprint). Only for JSON files.")
-		fmt.Println("                 Does not overwrite existing values.")
-		fmt.Println("")
-		fmt.Println("Examples:")
-		fmt.Println("  fsm netlist circuit.json")
-		fmt.Println("  fsm netlist circuit.fsm --format kicad -o circuit.net")
-		fmt.Println("  fsm netlist bundle.fsm -m controller --format json")
-		fmt.Println("  fsm netlist circuit.json --bake")
-		if len(args) < 1 {
-			os.Exit(1)
-		}
-		return
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", netlistUsage)
 	}
 
-	var input, output, format, machineName string
+	var output, machineName string
 	var bake bool
-	format = "text"
-
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-f", "--format":
-			if i+1 < len(args) {
-				format = args[i+1]
-				i++
-			}
-		case "-o", "--output":
-			if i+1 < len(args) {
-				output = args[i+1]
-				i++
-			}
-		case "-m", "--machine":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		case "--bake":
-			bake = true
-		default:
-			if !strings.HasPrefix(args[i], "-") && input == "" {
-				input = args[i]
-			}
-		}
-	}
+	format := "text"
+	fs := newFlagSet("netlist")
+	fs.String(&format, "-f", "--format")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&bake, "--bake")
+	positional := fs.parseOrExit(args, netlistUsage)
 
-	if input == "" {
-		fmt.Fprintln(os.Stderr, "Error: input file required")
-		os.Exit(1)
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
 	}
+	input := positional[0]
 
 	// Handle --bake: write KiCad fields into source file, then exit.
 	if bake {
@@ -2051,8 +2992,7 @@ func cmdNetlist(args []string) {
 	// Load FSM.
 	f, err := loadFSMWithMachine(input, machineName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
 	}
 
 	// Build the netlist.
@@ -2069,8 +3009,7 @@ func cmdNetlist(args []string) {
 	} else {
 		w, err = os.Create(output)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", output, err)
-			os.Exit(1)
+			fatalf(exitIO, "Error creating %s: %v", output, err)
 		}
 		defer w.Close()
 	}
@@ -2084,13 +3023,11 @@ func cmdNetlist(args []string) {
 	case "json":
 		err = export.WriteJSON(w, nl)
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown format: %s (use text, kicad, or json)\n", format)
-		os.Exit(1)
+		fatalf(exitUsage, "Unknown format: %s (use text, kicad, or json)", format)
 	}
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing netlist: %v\n", err)
-		os.Exit(1)
+		fatalf(exitIO, "Error writing netlist: %v", err)
 	}
 
 	// Summary to stderr (so stdout can be piped).
@@ -2112,8 +3049,7 @@ func cmdNetlist(args []string) {
 func cmdNetlistBake(input string) {
 	data, err := os.ReadFile(input)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", input, err)
-		os.Exit(1)
+		fatalf(loadErrorCode(err), "Error reading %s: %v", input, err)
 	}
 
 	if strings.HasSuffix(input, ".classes.json") {
@@ -2121,8 +3057,7 @@ func cmdNetlistBake(input string) {
 	} else if strings.HasSuffix(input, ".json") {
 		bakeFSMJSON(input, data)
 	} else {
-		fmt.Fprintln(os.Stderr, "Error: --bake only supports .json and .classes.json files")
-		os.Exit(1)
+		fatalf(exitUsage, "Error: --bake only supports .json and .classes.json files")
 	}
 }
 
@@ -2130,8 +3065,7 @@ func cmdNetlistBake(input string) {
 func bakeClassLibrary(path string, data []byte) {
 	var lib map[string]*fsm.Class
 	if err := json.Unmarshal(data, &lib); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", path, err)
-		os.Exit(1)
+		fatalf(exitParse, "Error parsing %s: %v", path, err)
 	}
 
 	changed := 0
@@ -2171,14 +3105,12 @@ func bakeClassLibrary(path string, data []byte) {
 
 	out, err := json.MarshalIndent(outLib, "", "  ")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error encoding: %v\n", err)
-		os.Exit(1)
+		fatalf(exitFailure, "Error encoding: %v", err)
 	}
 	out = append(out, '\n')
 
 	if err := os.WriteFile(path, out, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
-		os.Exit(1)
+		fatalf(exitIO, "Error writing %s: %v", path, err)
 	}
 
 	fmt.Fprintf(os.Stderr, "Baked KiCad fields into %d classes in %s\n", changed, path)
@@ -2188,8 +3120,7 @@ func bakeClassLibrary(path string, data []byte) {
 func bakeFSMJSON(path string, data []byte) {
 	f, err := fsmfile.ParseJSON(data)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", path, err)
-		os.Exit(1)
+		fatalf(exitParse, "Error parsing %s: %v", path, err)
 	}
 
 	changed := 0
@@ -2211,14 +3142,12 @@ func bakeFSMJSON(path string, data []byte) {
 
 	out, err := fsmfile.ToJSON(f, true)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error encoding: %v\n", err)
-		os.Exit(1)
+		fatalf(exitFailure, "Error encoding: %v", err)
 	}
 	out = append(out, '\n')
 
 	if err := os.WriteFile(path, out, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
-		os.Exit(1)
+		fatalf(exitIO, "Error writing %s: %v", path, err)
 	}
 
 	fmt.Fprintf(os.Stderr, "Baked KiCad fields into %d classes in %s\n", changed, path)
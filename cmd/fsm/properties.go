@@ -56,65 +56,39 @@ Examples:
   fsm properties bundle.fsm --all --format json
 `
 	if len(args) < 1 {
-		fmt.Fprint(os.Stderr, usageMsg)
-		os.Exit(1)
+		fatalf(exitUsage, "%s", usageMsg)
 	}
 
 	var (
-		input       string
 		machineName string
 		allMachines bool
 		filterState string
 		filterClass string
 		format      = "text"
 	)
-
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--machine", "-m":
-			if i+1 < len(args) {
-				machineName = args[i+1]
-				i++
-			}
-		case "--all", "-a":
-			allMachines = true
-		case "--state", "-s":
-			if i+1 < len(args) {
-				filterState = args[i+1]
-				i++
-			}
-		case "--class", "-c":
-			if i+1 < len(args) {
-				filterClass = args[i+1]
-				i++
-			}
-		case "--format", "-f":
-			if i+1 < len(args) {
-				format = args[i+1]
-				i++
-			}
-		case "-h", "--help":
-			fmt.Print(usageMsg)
-			os.Exit(0)
-		default:
-			if !strings.HasPrefix(args[i], "-") && input == "" {
-				input = args[i]
-			}
-		}
+	if opts.json {
+		format = "json"
 	}
 
-	if input == "" {
-		fmt.Fprintln(os.Stderr, "Error: input file required")
-		os.Exit(1)
+	fs := newFlagSet("properties")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&allMachines, "-a", "--all")
+	fs.String(&filterState, "-s", "--state")
+	fs.String(&filterClass, "-c", "--class")
+	fs.String(&format, "-f", "--format")
+	positional := fs.parseOrExit(args, usageMsg)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
 	}
+	input := positional[0]
 
 	validFormats := map[string]bool{
 		"text": true, "json": true,
 		"csv": true, "asciitable": true, "htmltable": true,
 	}
 	if !validFormats[format] {
-		fmt.Fprintf(os.Stderr, "Error: unknown format %q (valid: text, json, csv, asciitable, htmltable)\n", format)
-		os.Exit(1)
+		fatalf(exitUsage, "Error: unknown format %q (valid: text, json, csv, asciitable, htmltable)", format)
 	}
 
 	// Collect rows from one or all machines.
@@ -125,22 +99,19 @@ Examples:
 	if isBundle && allMachines {
 		machines, err := fsmfile.ListMachines(input)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing machines: %v\n", err)
-			os.Exit(1)
+			fatalf(loadErrorCode(err), "Error listing machines: %v", err)
 		}
 		for _, m := range machines {
 			f, _, err := fsmfile.ReadMachineFromBundle(input, m.Name)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error loading machine %q: %v\n", m.Name, err)
-				os.Exit(1)
+				fatalf(loadErrorCode(err), "Error loading machine %q: %v", m.Name, err)
 			}
 			rows = append(rows, extractRows(f, m.Name, filterState, filterClass)...)
 		}
 	} else {
 		f, err := loadFSMWithMachine(input, machineName)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", input, err)
-			os.Exit(1)
+			fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
 		}
 		name := machineName
 		if name == "" {
@@ -314,41 +285,11 @@ func renderASCIITable(rows []propRow) {
 		return
 	}
 
-	headers := []string{"Machine", "State", "Class", "Property", "Value"}
-	cols := len(headers)
-	widths := make([]int, cols)
-	for i, h := range headers {
-		widths[i] = len(h)
-	}
-	for _, r := range rows {
-		cells := []string{r.Machine, r.State, r.Class, r.Property, r.Value}
-		for i, c := range cells {
-			if len(c) > widths[i] {
-				widths[i] = len(c)
-			}
-		}
-	}
-
-	sep := "+"
-	for _, w := range widths {
-		sep += strings.Repeat("-", w+2) + "+"
-	}
-
-	printRow := func(cells []string) {
-		fmt.Print("|")
-		for i, c := range cells {
-			fmt.Printf(" %-*s |", widths[i], c)
-		}
-		fmt.Println()
-	}
-
-	fmt.Println(sep)
-	printRow(headers)
-	fmt.Println(sep)
+	var cells [][]string
 	for _, r := range rows {
-		printRow([]string{r.Machine, r.State, r.Class, r.Property, r.Value})
+		cells = append(cells, []string{r.Machine, r.State, r.Class, r.Property, r.Value})
 	}
-	fmt.Println(sep)
+	printASCIITable([]string{"Machine", "State", "Class", "Property", "Value"}, cells)
 }
 
 func renderHTMLTable(rows []propRow) {
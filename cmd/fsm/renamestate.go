@@ -0,0 +1,128 @@
+// renamestate.go — "fsm rename-state" subcommand.
+//
+// Renames states with a literal name or a regular expression, carrying
+// the new names through everything that refers to a state (the same
+// cascade fsmedit performs when a state is renamed) and through the
+// editor layout of .fsm files.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const renameStateUsage = `Usage: fsm rename-state <input|-> --from OLD --to NEW [options]
+       fsm rename-state <input|-> --map 'PATTERN=REPLACEMENT' [options]
+
+Rename states everywhere they are referenced: the state list, initial
+and accepting states, transitions, Moore outputs, linked machines,
+classes and properties, metadata, nets, and the saved editor layout.
+
+With --map, every state whose whole name matches the regular expression
+PATTERN is renamed to REPLACEMENT, in which $1 or ${1} refers to a
+capture group (write ${1}x rather than $1x when letters follow). The
+rule is split at its last "=". Renaming two states to the same name, or
+a state to the name of one that is not renamed, is an error.
+
+Options:
+  --from OLD      State to rename
+  --to NEW        Its new name
+  --map RULE      Regular expression rename: PATTERN=REPLACEMENT
+  --dry-run       List the renames without writing anything
+  -o, --output    Output file (default: stdout; format from extension)
+  -m, --machine   Select machine from bundle
+  -f, --format    Stdout format: json (default), fsm, text, hex
+
+Examples:
+  fsm rename-state door.json --from open --to OPEN -o door.json
+  fsm rename-state counter.fsm --map 'S(\d+)=state_$1' -o counter.fsm
+  fsm rename-state counter.fsm --map '(.*)_old=${1}' --dry-run
+`
+
+func cmdRenameState(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", renameStateUsage)
+	}
+
+	var from, to, rule, output, machineName, format string
+	var dryRun bool
+	fs := newFlagSet("rename-state")
+	fs.String(&from, "--from")
+	fs.String(&to, "--to")
+	fs.String(&rule, "--map")
+	fs.Bool(&dryRun, "--dry-run")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&format, "-f", "--format")
+	positional := fs.parseOrExit(args, renameStateUsage)
+	format = strings.ToLower(format)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required (use - for stdin)")
+	}
+	input := positional[0]
+
+	if (rule == "") == (from == "" && to == "") {
+		fatalf(exitUsage, "Error: give either --from and --to, or --map")
+	}
+	if rule == "" && (from == "" || to == "") {
+		fatalf(exitUsage, "Error: --from and --to must be given together")
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	mapping := map[string]string{from: to}
+	if rule != "" {
+		i := strings.LastIndex(rule, "=")
+		if i <= 0 {
+			fatalf(exitUsage, "Error: invalid --map %q (want PATTERN=REPLACEMENT)", rule)
+		}
+		mapping, err = f.StateRenames(rule[:i], rule[i+1:])
+		if err != nil {
+			fatalf(exitUsage, "Error: invalid pattern: %v", err)
+		}
+	} else if from == to {
+		mapping = map[string]string{}
+	}
+
+	layout := loadLayoutWithMachine(input, machineName)
+	if err := f.RenameStates(mapping); err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if layout != nil {
+		layout.RenameStates(mapping)
+	}
+
+	if dryRun || !opts.quiet {
+		printStateRenames(mapping)
+	}
+	if dryRun {
+		return
+	}
+
+	if err := writeFSMOutputWithLayout(output, format, f, layout); err != nil {
+		fatalf(exitIO, "Error writing output: %v", err)
+	}
+}
+
+// printStateRenames lists the renames on stderr, in state-name order.
+func printStateRenames(mapping map[string]string) {
+	if len(mapping) == 0 {
+		fmt.Fprintln(os.Stderr, "rename-state: no states renamed")
+		return
+	}
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "rename-state: %s -> %s\n", name, mapping[name])
+	}
+}
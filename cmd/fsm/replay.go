@@ -0,0 +1,146 @@
+// replay.go — "fsm replay" subcommand.
+//
+// Feeds a real event log through a machine, translating log lines into
+// inputs with a TOML event map, and reports whether the log is accepted
+// and where the first violation occurs. With --json the
+// fsm.ReplayResult is printed as an object.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const replayUsage = `Usage: fsm replay <input|-> --log FILE --map FILE [-m machine] [--prefix]
+
+Check a log against a machine. Each log line is translated into an input
+by the event map, and the inputs are run from the initial state. Reports
+whether the log is accepted and, if not, the first line the machine
+could not take. Exits with status 3 unless the log is accepted.
+
+The event map is a TOML file whose [events] table maps each input to a
+regular expression, or an array of them; each line takes the input of
+the first pattern that matches it. Lines matching nothing are skipped,
+or are violations with unmatched = "error" in an [options] table:
+
+  [events]
+  login  = 'POST /login .* 200'
+  logout = ['GET /logout', 'session expired']
+
+Options:
+  -l, --log       Log file ("-" for standard input)
+  --map           Event map file
+  -m, --machine   Select machine from bundle
+  --prefix        Accept a log that ends outside an accepting state
+
+Examples:
+  fsm replay session.fsm --log access.log --map events.toml
+  tail -n 1000 app.log | fsm replay session.fsm --log - --map events.toml --prefix
+`
+
+func cmdReplay(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", replayUsage)
+	}
+
+	var machineName, logPath, mapPath string
+	prefix := false
+	fs := newFlagSet("replay")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&logPath, "-l", "--log")
+	fs.String(&mapPath, "--map")
+	fs.Bool(&prefix, "--prefix")
+	positional := fs.parseOrExit(args, replayUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	if logPath == "" || mapPath == "" {
+		fatalf(exitUsage, "Error: --log and --map are required")
+	}
+	if input == stdioPath && logPath == stdioPath {
+		fatalf(exitUsage, "Error: the machine and the log cannot both be read from standard input")
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	events, err := fsmfile.LoadEventMap(mapPath)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading event map: %v", err)
+	}
+
+	var log io.Reader = os.Stdin
+	if logPath != stdioPath {
+		file, err := os.Open(logPath)
+		if err != nil {
+			fatalf(exitIO, "Error: %v", err)
+		}
+		defer file.Close()
+		log = file
+	}
+
+	runner, err := fsm.NewRunner(f)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	runner.SetLogger(debugLogger())
+	res, err := runner.Replay(log, events)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if prefix && res.Violation == nil {
+		res.Accepted = true
+	}
+
+	if opts.json {
+		printJSON(res)
+	} else {
+		printReplay(f, res)
+	}
+	if !res.Accepted {
+		os.Exit(exitInvalid)
+	}
+}
+
+func printReplay(f *fsm.FSM, res fsm.ReplayResult) {
+	v := f.Vocab()
+	fmt.Printf("Replayed %d lines: %d events, %d skipped\n", res.Lines, res.Events, res.Skipped)
+	if vi := res.Violation; vi != nil {
+		if vi.Input == "" {
+			fmt.Printf("Violation at line %d: no event matches the line\n", vi.Line)
+		} else {
+			fmt.Printf("Violation at line %d: %s %q not allowed in %s %s\n",
+				vi.Line, strings.ToLower(v.Input), vi.Input, strings.ToLower(v.State), formatStates(vi.States))
+		}
+		fmt.Printf("  %s\n", vi.Text)
+		if len(vi.Expected) == 0 {
+			fmt.Println("  Expected: nothing (no way out)")
+		} else {
+			fmt.Printf("  Expected: %s\n", strings.Join(vi.Expected, ", "))
+		}
+		return
+	}
+	if res.Accepted {
+		fmt.Printf("Accepted in %s\n", formatStates(res.States))
+	} else {
+		fmt.Printf("Not accepted: ended in %s, which is not %s\n", formatStates(res.States), strings.ToLower(v.Accepting))
+	}
+}
+
+// formatStates renders a set of current states as a single name when
+// there is one, and as {a, b} otherwise.
+func formatStates(states []string) string {
+	if len(states) == 1 {
+		return states[0]
+	}
+	return "{" + strings.Join(states, ", ") + "}"
+}
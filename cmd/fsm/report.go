@@ -0,0 +1,141 @@
+// report.go — JSON report types emitted by --json.
+//
+// Field names are snake_case and stable; scripts may rely on them. Empty
+// optional fields are omitted.
+
+package main
+
+import "github.com/ha1tch/fsm-toolkit/pkg/fsm"
+
+// infoReport is the --json output of "fsm info".
+type infoReport struct {
+	Bundle         []string          `json:"bundle,omitempty"` // machines in the bundle, when the input is one
+	Type           string            `json:"type"`
+	Name           string            `json:"name,omitempty"`
+	Description    string            `json:"description,omitempty"`
+	States         []string          `json:"states"`
+	Alphabet       []string          `json:"alphabet"`
+	OutputAlphabet []string          `json:"output_alphabet,omitempty"`
+	Initial        string            `json:"initial"`
+	Accepting      []string          `json:"accepting,omitempty"`
+	Transitions    int               `json:"transitions"`
+	Fingerprint    string            `json:"fingerprint"` // see fsm.FSM.Fingerprint
+	LinkedMachines map[string]string `json:"linked_machines,omitempty"`
+	Classes        map[string]int    `json:"classes,omitempty"` // class name -> property count
+	StateClasses   map[string]string `json:"state_classes,omitempty"`
+	Nets           []infoNet         `json:"nets,omitempty"`
+}
+
+type infoNet struct {
+	Name      string   `json:"name"`
+	Endpoints []string `json:"endpoints"`
+	Power     bool     `json:"power,omitempty"`
+}
+
+func newInfoReport(f *fsm.FSM, bundle []string) infoReport {
+	r := infoReport{
+		Bundle:         bundle,
+		Type:           string(f.Type),
+		Name:           f.Name,
+		Description:    f.Description,
+		States:         nonNil(f.States),
+		Alphabet:       nonNil(f.Alphabet),
+		OutputAlphabet: f.OutputAlphabet,
+		Initial:        f.Initial,
+		Accepting:      f.Accepting,
+		Transitions:    len(f.Transitions),
+		Fingerprint:    f.Fingerprint(),
+	}
+	if len(f.LinkedMachines) > 0 {
+		r.LinkedMachines = f.LinkedMachines
+	}
+	for name, cls := range f.Classes {
+		if name == "default_state" {
+			continue
+		}
+		if r.Classes == nil {
+			r.Classes = make(map[string]int)
+		}
+		r.Classes[name] = len(cls.Properties)
+	}
+	if len(f.StateClasses) > 0 {
+		r.StateClasses = f.StateClasses
+	}
+	for _, n := range f.Nets {
+		net := infoNet{Name: n.Name, Endpoints: []string{}, Power: f.IsPowerNet(n)}
+		for _, ep := range n.Endpoints {
+			net.Endpoints = append(net.Endpoints, ep.Instance+"."+ep.Port)
+		}
+		r.Nets = append(r.Nets, net)
+	}
+	return r
+}
+
+// analyseIssue is a single warning in the --json output of "fsm analyse".
+type analyseIssue struct {
+	Type     string       `json:"type"`
+	ID       string       `json:"id"`
+	Severity fsm.Severity `json:"severity"`
+	Message  string       `json:"message"`
+	States   []string     `json:"states,omitempty"`
+	Symbols  []string     `json:"symbols,omitempty"`
+	Path     []string     `json:"path,omitempty"`
+}
+
+// analyseReport is the --json output of "fsm analyse". For --all, Machines
+// holds per-machine issues and CrossMachine the bundle-level ones.
+type analyseReport struct {
+	Issues       []analyseIssue            `json:"issues,omitempty"`
+	Machines     map[string][]analyseIssue `json:"machines,omitempty"`
+	CrossMachine []string                  `json:"cross_machine,omitempty"`
+	Total        int                       `json:"total"`
+}
+
+func toAnalyseIssues(warnings []fsm.ValidationWarning) []analyseIssue {
+	issues := make([]analyseIssue, 0, len(warnings))
+	for _, w := range warnings {
+		issues = append(issues, analyseIssue{
+			Type:     w.Type,
+			ID:       w.ID,
+			Severity: w.Severity,
+			Message:  w.Message,
+			States:   w.States,
+			Symbols:  w.Symbols,
+			Path:     w.Path,
+		})
+	}
+	return issues
+}
+
+// validateReport is the --json output of "fsm validate".
+type validateReport struct {
+	Input       string   `json:"input"`
+	Valid       bool     `json:"valid"`
+	Error       string   `json:"error,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	States      int      `json:"states,omitempty"`
+	Transitions int      `json:"transitions,omitempty"`
+	Errors      []string `json:"errors,omitempty"`   // bundle mode
+	Warnings    []string `json:"warnings,omitempty"` // bundle mode
+
+	// Analysis warnings (link warnings in bundle mode), counted when
+	// validating several files or with --max-warnings.
+	WarningCount    int  `json:"warning_count,omitempty"`
+	TooManyWarnings bool `json:"too_many_warnings,omitempty"`
+}
+
+// convertResult is one entry in the --json output of "fsm convert".
+type convertResult struct {
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// nonNil returns s, or an empty slice if s is nil, so that JSON encodes
+// required lists as [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
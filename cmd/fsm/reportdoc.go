@@ -0,0 +1,188 @@
+// reportdoc.go — "fsm report" subcommand.
+//
+// Writes a Markdown or HTML document describing a machine (summary,
+// diagram, transition table, analysis, and per-state notes) for
+// committing alongside the code as design documentation.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const reportUsage = `Usage: fsm report <input> [-o output.md|output.html] [-t title] [-m machine] [options]
+
+Write a document describing the machine: its type, metadata, and size,
+the diagram, the transition table, the warnings from "fsm analyse", and
+each state's role and notes (Moore output, class properties, and state
+metadata). The format follows the output extension: .html for a
+self-contained page, Markdown otherwise.
+
+A Markdown report embeds the diagram as inline SVG. Some renderers,
+GitHub's among them, strip inline SVG; use --diagram to write the
+diagram to its own file and link it from the report instead, or
+--mermaid to draw it as a Mermaid code block.
+
+Options:
+  -o, --output    Output file, or - for stdout (default: input name with .md extension)
+  -f, --format    md or html (default: from the output extension)
+  -t, --title     Document heading (default: FSM name)
+  -m, --machine   Select machine from bundle
+  --diagram FILE  Write the diagram to FILE (.svg) and link it (Markdown only)
+  --mermaid       Draw the diagram as a Mermaid code block (Markdown only)
+  --theme NAME    Diagram colour theme (default, dark, mono, print)
+  --use-layout    Place states where fsmedit saved them (.fsm input)
+  --width N       Diagram width in pixels (default: 800)
+  --height N      Diagram height in pixels (default: 600)
+
+Examples:
+  fsm report turnstile.json -o docs/turnstile.md
+  fsm report turnstile.json -o docs/turnstile.md --diagram docs/turnstile.svg
+  fsm report turnstile.json -o docs/turnstile.md --mermaid
+  fsm report bundle.fsm -m parser -o parser.html --use-layout
+`
+
+func cmdReport(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", reportUsage)
+	}
+
+	var output, format, title, machineName, diagram, themeName string
+	var useLayout, mermaid bool
+	var width, height int
+	fs := newFlagSet("report")
+	fs.String(&output, "-o", "--output")
+	fs.String(&format, "-f", "--format")
+	fs.String(&title, "-t", "--title")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&diagram, "--diagram")
+	fs.Bool(&mermaid, "--mermaid")
+	fs.String(&themeName, "--theme")
+	fs.Bool(&useLayout, "--use-layout")
+	fs.Int(&width, "--width")
+	fs.Int(&height, "--height")
+	positional := fs.parseOrExit(args, reportUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	format = strings.ToLower(format)
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(output)) {
+		case ".html", ".htm":
+			format = "html"
+		default:
+			format = "md"
+		}
+	}
+	if format == "markdown" {
+		format = "md"
+	}
+	if format != "md" && format != "html" {
+		fatalf(exitUsage, "Error: unknown format %q (use md or html)", format)
+	}
+	if diagram != "" && format != "md" {
+		fatalf(exitUsage, "Error: --diagram is for Markdown reports; HTML reports embed the diagram")
+	}
+	if mermaid && format != "md" {
+		fatalf(exitUsage, "Error: --mermaid is for Markdown reports; HTML reports embed the diagram")
+	}
+	if mermaid && diagram != "" {
+		fatalf(exitUsage, "Error: --mermaid and --diagram cannot be combined")
+	}
+
+	reportOpts := fsmfile.DefaultReportOptions()
+	reportOpts.Title = title
+	reportOpts.Mermaid = mermaid
+	if themeName != "" {
+		theme, ok := fsmfile.ThemeByName(themeName)
+		if !ok {
+			fatalf(exitUsage, "Error: unknown theme %q (available: %s)", themeName, strings.Join(fsmfile.ThemeNames(), ", "))
+		}
+		reportOpts.SVG.Theme = theme
+	}
+	if width > 0 {
+		reportOpts.SVG.Width = width
+	}
+	if height > 0 {
+		reportOpts.SVG.Height = height
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	if useLayout {
+		reportOpts.SVG.UseLayout = loadLayoutWithMachine(input, machineName)
+		if reportOpts.SVG.UseLayout == nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s has no saved layout; using automatic layout\n", input)
+		}
+	}
+
+	if output == "" && input == stdioPath {
+		output = stdioPath
+	} else if output == "" {
+		base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+		if machineName != "" {
+			base = machineName
+		}
+		output = base + "." + format
+	}
+
+	if diagram != "" {
+		svgOpts := reportOpts.SVG
+		svgOpts.Title = ""
+		if err := os.WriteFile(diagram, []byte(fsmfile.GenerateSVGNative(f, svgOpts)), 0644); err != nil {
+			fatalf(exitIO, "Error writing %s: %v", diagram, err)
+		}
+		infof("Generated: %s\n", diagram)
+		reportOpts.DiagramPath = diagramLink(output, diagram)
+	}
+
+	var doc string
+	if format == "html" {
+		doc, err = fsmfile.GenerateHTMLReport(f, reportOpts)
+		if err != nil {
+			fatalf(exitFailure, "Error: %v", err)
+		}
+	} else {
+		doc = fsmfile.GenerateMarkdownReport(f, reportOpts)
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", output, err)
+	}
+	if _, err := io.WriteString(w, doc); err != nil {
+		w.Close()
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if err := w.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if output != stdioPath {
+		infof("Generated: %s\n", output)
+	}
+}
+
+// diagramLink returns the path of the diagram relative to the report's
+// directory, with forward slashes, for linking from the report.
+func diagramLink(report, diagram string) string {
+	dir := "."
+	if report != stdioPath {
+		dir = filepath.Dir(report)
+	}
+	rel, err := filepath.Rel(dir, diagram)
+	if err != nil {
+		rel = diagram
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,52 @@
+// schema.go — "fsm schema" subcommand.
+//
+// Prints the JSON Schema for the FSM JSON format, for editors and
+// external validators. "fsm validate --strict" applies the same rules.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const schemaUsage = `Usage: fsm schema [-o output]
+
+Print the JSON Schema (draft 2020-12) for the FSM JSON format.
+
+Options:
+  -o, --output    Output file (default: stdout)
+
+Examples:
+  fsm schema -o fsm.schema.json
+  fsm validate --strict machine.json
+`
+
+func cmdSchema(args []string) {
+	var output string
+	fs := newFlagSet("schema")
+	fs.String(&output, "-o", "--output")
+	positional := fs.parseOrExit(args, schemaUsage)
+
+	if len(positional) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n\n", positional[0])
+		fatalf(exitUsage, "%s", schemaUsage)
+	}
+
+	if output == "" {
+		output = stdioPath
+	}
+	w, err := createOutput(output)
+	if err != nil {
+		fatalf(exitIO, "Error: %v", err)
+	}
+	if _, err := w.Write(fsmfile.JSONSchema()); err != nil {
+		w.Close()
+		fatalf(exitIO, "Error writing output: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		fatalf(exitIO, "Error writing output: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+// serve.go — "fsm serve" subcommand.
+//
+// Serves diagrams of the machine files in a directory over HTTP (see
+// package server), so that wikis and dashboards can link to diagrams
+// that are redrawn only when the model changes.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/server"
+)
+
+const serveUsage = `Usage: fsm serve [dir] [--addr ADDR] [--cache N] [--timeout D]
+
+Serve diagrams of the machine files under dir (default: the current
+directory) over HTTP.
+
+Options:
+  --addr ADDR     Address to listen on (default: localhost:8080)
+  --cache N       Number of renderings to keep (default: 128)
+  --timeout D     Longest time to spend drawing one diagram, e.g. 10s or
+                  500ms; slower requests get 503 (default: 30s, 0 for
+                  no limit)
+
+Endpoints:
+  GET /render?file=path&machine=name&format=svg&theme=dark
+      file is relative to dir; machine selects a machine from a bundle;
+      format is svg (default), png, dot, or ascii; theme (svg only) is
+      default, dark, mono, or print.
+
+Responses carry an ETag derived from the machine's fingerprint and the
+options, and renderings are cached, so a diagram is redrawn only when
+the model changes.
+
+Examples:
+  fsm serve docs/machines --addr :8080
+  curl 'http://localhost:8080/render?file=turnstile.json&theme=dark'
+`
+
+func cmdServe(args []string) {
+	addr := "localhost:8080"
+	var cacheSize int
+	timeoutArg := "30s"
+	fs := newFlagSet("serve")
+	fs.String(&addr, "--addr")
+	fs.Int(&cacheSize, "--cache")
+	fs.String(&timeoutArg, "--timeout")
+	positional := fs.parseOrExit(args, serveUsage)
+
+	timeout, err := time.ParseDuration(timeoutArg)
+	if err != nil || timeout < 0 {
+		fatalf(exitUsage, "Error: invalid --timeout %q (use e.g. 10s or 500ms, or 0 for no limit)", timeoutArg)
+	}
+
+	root := "."
+	if len(positional) > 0 {
+		root = positional[0]
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fatalf(exitUsage, "Error: %s is not a directory", root)
+	}
+
+	srv := server.New(server.Options{Root: root, CacheSize: cacheSize, RenderTimeout: timeout, Logger: debugLogger()})
+	if !opts.quiet {
+		fmt.Fprintf(os.Stderr, "Serving %s on http://%s/render\n", root, addr)
+	}
+	if err := http.ListenAndServe(addr, srv); err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+}
@@ -0,0 +1,450 @@
+// shell.go — "fsm shell" subcommand.
+//
+// An interactive REPL that holds any number of named machines in memory and
+// applies transformations to them, so multi-step pipelines (determinise,
+// minimise, compare, render) don't need temporary files between stages.
+//
+// Usage:
+//   fsm shell [file...]
+//
+// Each file given on the command line is loaded under its base name.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const shellHelp = `Commands:
+  load <path> [as <name>] [-m machine]   Load a machine (name defaults to file base name)
+  save <name> <path>                     Write a machine (.json, .fsmt, .fsm, .hex)
+  list                                   List loaded machines
+  info <name>                            Show a machine summary
+  minimize <name> [as <new>]             Minimise (alias: minimise)
+  determinize <name> [as <new>]          Convert NFA to DFA (alias: determinise)
+  copy <name> <new>                      Duplicate a machine
+  drop <name>                            Remove a machine from the session
+  test <name> <input>...                 Run an input sequence and report the result
+  diff <a> <b>                           Compare structure and behaviour
+  render <name> <path>                   Render natively (.svg, .png, .dot)
+  analyse <name>                         Show analysis warnings (alias: analyze)
+  help                                   Show this help
+  quit                                   Exit (also: exit, q)
+`
+
+// shellSession holds the named machines for one REPL session.
+type shellSession struct {
+	machines map[string]*fsm.FSM
+	out      io.Writer
+}
+
+func cmdShell(args []string) {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		fmt.Println("Usage: fsm shell [file...]")
+		fmt.Println("")
+		fmt.Println("Interactive session for transforming machines held in memory.")
+		fmt.Println("")
+		fmt.Print(shellHelp)
+		return
+	}
+
+	sh := &shellSession{
+		machines: make(map[string]*fsm.FSM),
+		out:      os.Stdout,
+	}
+
+	for _, path := range args {
+		if err := sh.exec([]string{"load", path}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+
+	fmt.Println("fsm shell — type 'help' for commands")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("fsm> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "quit", "exit", "q":
+			return
+		}
+		if err := sh.exec(fields); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+}
+
+// exec runs a single shell command.
+func (sh *shellSession) exec(fields []string) error {
+	cmd, args := fields[0], fields[1:]
+
+	switch cmd {
+	case "help", "?":
+		fmt.Fprint(sh.out, shellHelp)
+		return nil
+
+	case "load":
+		return sh.load(args)
+
+	case "save":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: save <name> <path>")
+		}
+		f, err := sh.get(args[0])
+		if err != nil {
+			return err
+		}
+		if err := saveFSM(args[1], f, true, true); err != nil {
+			return err
+		}
+		fmt.Fprintf(sh.out, "Saved %s -> %s\n", args[0], args[1])
+		return nil
+
+	case "list", "ls":
+		if len(sh.machines) == 0 {
+			fmt.Fprintln(sh.out, "(no machines loaded)")
+			return nil
+		}
+		for _, name := range sh.names() {
+			f := sh.machines[name]
+			fmt.Fprintf(sh.out, "  %-20s %-6s %4d states %5d transitions\n",
+				name, f.Type, len(f.States), len(f.Transitions))
+		}
+		return nil
+
+	case "info":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: info <name>")
+		}
+		f, err := sh.get(args[0])
+		if err != nil {
+			return err
+		}
+		v := f.Vocab()
+		fmt.Fprintf(sh.out, "%-12s %s\n", "Type:", f.Type)
+		if f.Name != "" {
+			fmt.Fprintf(sh.out, "%-12s %s\n", "Name:", f.Name)
+		}
+		fmt.Fprintf(sh.out, "%-12s %d %v\n", v.States+":", len(f.States), f.States)
+		fmt.Fprintf(sh.out, "%-12s %d %v\n", v.Alphabet+":", len(f.Alphabet), f.Alphabet)
+		fmt.Fprintf(sh.out, "%-12s %d\n", v.Transition+"s:", len(f.Transitions))
+		fmt.Fprintf(sh.out, "%-12s %s\n", v.Initial+":", f.Initial)
+		if len(f.Accepting) > 0 {
+			fmt.Fprintf(sh.out, "%-12s %v\n", v.Accepting+":", f.Accepting)
+		}
+		return nil
+
+	case "minimize", "minimise":
+		return sh.transform(cmd, args, func(f *fsm.FSM) (*fsm.FSM, error) {
+			return f.Minimize()
+		})
+
+	case "determinize", "determinise":
+		return sh.transform(cmd, args, func(f *fsm.FSM) (*fsm.FSM, error) {
+			return f.ToDFA(), nil
+		})
+
+	case "copy", "cp":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: copy <name> <new>")
+		}
+		f, err := sh.get(args[0])
+		if err != nil {
+			return err
+		}
+		sh.machines[args[1]] = f.Clone()
+		fmt.Fprintf(sh.out, "%s -> %s\n", args[0], args[1])
+		return nil
+
+	case "drop", "rm":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: drop <name>")
+		}
+		if _, err := sh.get(args[0]); err != nil {
+			return err
+		}
+		delete(sh.machines, args[0])
+		return nil
+
+	case "test", "run":
+		if len(args) < 1 {
+			return fmt.Errorf("usage: test <name> <input>...")
+		}
+		f, err := sh.get(args[0])
+		if err != nil {
+			return err
+		}
+		return sh.test(f, args[1:])
+
+	case "diff":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: diff <a> <b>")
+		}
+		a, err := sh.get(args[0])
+		if err != nil {
+			return err
+		}
+		b, err := sh.get(args[1])
+		if err != nil {
+			return err
+		}
+		sh.diff(args[0], a, args[1], b)
+		return nil
+
+	case "render":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: render <name> <path>")
+		}
+		f, err := sh.get(args[0])
+		if err != nil {
+			return err
+		}
+		if err := renderNative(f, args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(sh.out, "Rendered %s -> %s\n", args[0], args[1])
+		return nil
+
+	case "analyse", "analyze":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: analyse <name>")
+		}
+		f, err := sh.get(args[0])
+		if err != nil {
+			return err
+		}
+		warnings := f.Analyse()
+		if len(warnings) == 0 {
+			fmt.Fprintln(sh.out, "No issues found.")
+			return nil
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(sh.out, "  [%s %s] %s\n", w.ID, w.Type, w.Message)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q (type 'help')", cmd)
+}
+
+// load handles "load <path> [as <name>] [-m machine]".
+func (sh *shellSession) load(args []string) error {
+	var path, name, machine string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "as":
+			if i+1 < len(args) {
+				name = args[i+1]
+				i++
+			}
+		case "-m", "--machine":
+			if i+1 < len(args) {
+				machine = args[i+1]
+				i++
+			}
+		default:
+			if path == "" {
+				path = args[i]
+			}
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("usage: load <path> [as <name>] [-m machine]")
+	}
+	if name == "" {
+		name = machine
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	f, err := loadFSMWithMachine(path, machine)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", path, err)
+	}
+	sh.machines[name] = f
+	fmt.Fprintf(sh.out, "Loaded %s (%s, %d states)\n", name, f.Type, len(f.States))
+	return nil
+}
+
+// transform applies fn to a machine and stores the result under the
+// "as <new>" name, or back under the original name.
+func (sh *shellSession) transform(cmd string, args []string, fn func(*fsm.FSM) (*fsm.FSM, error)) error {
+	if len(args) != 1 && !(len(args) == 3 && args[1] == "as") {
+		return fmt.Errorf("usage: %s <name> [as <new>]", cmd)
+	}
+	f, err := sh.get(args[0])
+	if err != nil {
+		return err
+	}
+	result, err := fn(f)
+	if err != nil {
+		return err
+	}
+	dst := args[0]
+	if len(args) == 3 {
+		dst = args[2]
+	}
+	sh.machines[dst] = result
+	fmt.Fprintf(sh.out, "%s: %d states -> %s: %d states\n",
+		args[0], len(f.States), dst, len(result.States))
+	return nil
+}
+
+// test runs an input sequence from the initial state.
+func (sh *shellSession) test(f *fsm.FSM, inputs []string) error {
+	runner, err := fsm.NewRunner(f)
+	if err != nil {
+		return err
+	}
+	outputs, runErr := runner.Run(inputs)
+	var shown []string
+	for _, o := range outputs {
+		if o != "" {
+			shown = append(shown, o)
+		}
+	}
+	if runErr != nil {
+		fmt.Fprintf(sh.out, "REJECT (stuck after %d inputs: %v)\n", len(outputs), runErr)
+		return nil
+	}
+	verdict := "REJECT"
+	if runner.IsAccepting() {
+		verdict = "ACCEPT"
+	}
+	fmt.Fprintf(sh.out, "%s  final: %s\n", verdict, runner.CurrentState())
+	if len(shown) > 0 {
+		fmt.Fprintf(sh.out, "Outputs: %s\n", strings.Join(shown, " "))
+	}
+	return nil
+}
+
+// diff prints structural differences followed by a behavioural verdict.
+func (sh *shellSession) diff(nameA string, a *fsm.FSM, nameB string, b *fsm.FSM) {
+	printSetDiff := func(label string, x, y []string) {
+		onlyA, onlyB := setDifference(x, y), setDifference(y, x)
+		if len(onlyA) == 0 && len(onlyB) == 0 {
+			return
+		}
+		fmt.Fprintf(sh.out, "%s:\n", label)
+		for _, s := range onlyA {
+			fmt.Fprintf(sh.out, "  - %s (only in %s)\n", s, nameA)
+		}
+		for _, s := range onlyB {
+			fmt.Fprintf(sh.out, "  + %s (only in %s)\n", s, nameB)
+		}
+	}
+
+	if a.Type != b.Type {
+		fmt.Fprintf(sh.out, "Type: %s vs %s\n", a.Type, b.Type)
+	}
+	if a.Initial != b.Initial {
+		fmt.Fprintf(sh.out, "Initial: %s vs %s\n", a.Initial, b.Initial)
+	}
+	printSetDiff("States", a.States, b.States)
+	printSetDiff("Alphabet", a.Alphabet, b.Alphabet)
+	printSetDiff("Accepting", a.Accepting, b.Accepting)
+	printSetDiff("Transitions", transitionKeys(a), transitionKeys(b))
+
+	if eq, cex := fsm.Equivalent(a, b); eq {
+		fmt.Fprintln(sh.out, "Behaviour: equivalent")
+	} else {
+		fmt.Fprintf(sh.out, "Behaviour: differ on input [%s]\n", strings.Join(cex, " "))
+	}
+}
+
+func (sh *shellSession) get(name string) (*fsm.FSM, error) {
+	f, ok := sh.machines[name]
+	if !ok {
+		return nil, fmt.Errorf("no machine named %q", name)
+	}
+	return f, nil
+}
+
+func (sh *shellSession) names() []string {
+	names := make([]string, 0, len(sh.machines))
+	for n := range sh.machines {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// transitionKeys renders each transition as a comparable string.
+func transitionKeys(f *fsm.FSM) []string {
+	keys := make([]string, 0, len(f.Transitions))
+	for _, t := range f.Transitions {
+		in := "ε"
+		if t.Input != nil {
+			in = *t.Input
+		}
+		k := fmt.Sprintf("%s --%s--> %s", t.From, in, strings.Join(t.To, ","))
+		if t.Output != nil {
+			k += " / " + *t.Output
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// setDifference returns the elements of a not present in b, sorted.
+func setDifference(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+	}
+	var out []string
+	for _, s := range a {
+		if !inB[s] {
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// renderNative renders an FSM with the built-in renderers, choosing the
+// format from the output extension.
+func renderNative(f *fsm.FSM, path string) error {
+	title := f.Name
+	if title == "" {
+		title = fmt.Sprintf("%s: %d states", strings.ToUpper(string(f.Type)), len(f.States))
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".svg":
+		opts := fsmfile.DefaultSVGOptions()
+		opts.Title = title
+		return os.WriteFile(path, []byte(fsmfile.GenerateSVGNative(f, opts)), 0644)
+	case ".png":
+		opts := fsmfile.DefaultPNGOptions()
+		opts.Title = title
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		return fsmfile.RenderPNG(f, out, opts)
+	case ".dot", ".gv":
+		return os.WriteFile(path, []byte(fsmfile.GenerateDOT(f, title)), 0644)
+	default:
+		return fmt.Errorf("unsupported render format %q (use .svg, .png, or .dot)", ext)
+	}
+}
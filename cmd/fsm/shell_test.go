@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestShellCopyKeepsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "door.json")
+	err := os.WriteFile(in, []byte(`{
+  "type": "dfa",
+  "name": "door",
+  "states": ["closed", "open"],
+  "alphabet": ["push"],
+  "initial": "closed",
+  "accepting": ["open"],
+  "transitions": [
+    {"from": "closed", "input": "push", "to": "open", "metadata": {"guard": "unlocked"}}
+  ],
+  "metadata": {"author": "ops"},
+  "state_metadata": {"open": {"colour": "green"}}
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sh := &shellSession{machines: make(map[string]*fsm.FSM), out: io.Discard}
+	orig, dup := filepath.Join(dir, "orig.json"), filepath.Join(dir, "copy.json")
+	for _, line := range [][]string{
+		{"load", in, "as", "m"},
+		{"copy", "m", "n"},
+		{"save", "m", orig},
+		{"save", "n", dup},
+	} {
+		if err := sh.exec(line); err != nil {
+			t.Fatalf("%v: %v", line, err)
+		}
+	}
+
+	want, err := os.ReadFile(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("saved copy differs from the original:\n%s\nwant:\n%s", got, want)
+	}
+	for _, s := range []string{"guard", "author", "colour"} {
+		if !bytes.Contains(got, []byte(s)) {
+			t.Errorf("saved copy lost %q", s)
+		}
+	}
+}
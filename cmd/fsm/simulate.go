@@ -0,0 +1,148 @@
+// simulate.go — "fsm simulate" subcommand.
+//
+// Runs seeded random walks over a machine and reports how often each
+// state is visited, where walks end up, and how long they take. With
+// --json the fsm.SimulationResult is printed as an object. --stationary
+// prints the machine's exact stationary distribution instead.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const simulateUsage = `Usage: fsm simulate <input|-> [-m machine] [--walks N] [--max-len N]
+                    [--seed N] [--weight-key KEY] [--stationary]
+
+Run random walks from the initial state, following one transition at a
+time, and report state visitation frequencies, absorption probabilities
+(the share of walks ending in each state with no way out), and average
+walk lengths.
+
+Each step picks a transition at random, weighted by its probability, or
+else by the number in its "probability" metadata (1 if absent).
+
+With --stationary, no walks are run: the exact long-run share of time
+spent in each state is computed instead, treating every input as
+equally likely and choosing among a state's transitions on an input by
+their probabilities.
+
+Options:
+  -m, --machine   Select machine from bundle
+  -w, --walks     Number of walks (default: 1000)
+  -l, --max-len   Transitions per walk before it is cut off (default: 50)
+  -s, --seed      Random seed (default: 1)
+  --weight-key    Transition metadata key holding the weight (default: probability)
+  --stationary    Print the stationary distribution instead of simulating
+
+Examples:
+  fsm simulate protocol.fsm --walks 10000 --max-len 50 --seed 1
+  fsm simulate protocol.json --json | jq '.states[] | select(.absorbing)'
+  fsm simulate weather.fsm --stationary
+`
+
+func cmdSimulate(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", simulateUsage)
+	}
+
+	var machineName string
+	so := fsm.SimulateOptions{Seed: 1}
+	seed := 1
+	stationary := false
+	fs := newFlagSet("simulate")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Int(&so.Walks, "-w", "--walks")
+	fs.Int(&so.MaxLen, "-l", "--max-len")
+	fs.Int(&seed, "-s", "--seed")
+	fs.String(&so.WeightKey, "--weight-key")
+	fs.Bool(&stationary, "--stationary")
+	positional := fs.parseOrExit(args, simulateUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	so.Seed = int64(seed)
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	if stationary {
+		dist, err := f.StationaryDistribution()
+		if err != nil {
+			fatalf(exitFailure, "Error: %v", err)
+		}
+		if opts.json {
+			printJSON(dist)
+			return
+		}
+		printStationary(f, dist)
+		return
+	}
+
+	so.Logger = debugLogger()
+	res, err := fsm.Simulate(f, so)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+	if opts.json {
+		printJSON(res)
+		return
+	}
+	printSimulation(f, res)
+}
+
+func printSimulation(f *fsm.FSM, res fsm.SimulationResult) {
+	v := f.Vocab()
+	fmt.Printf("%d walks of up to %d steps from %s (seed %d)\n\n", res.Walks, res.MaxLen, f.Initial, res.Seed)
+
+	width := len(v.State)
+	for _, s := range res.States {
+		if len(s.State) > width {
+			width = len(s.State)
+		}
+	}
+	fmt.Printf("%-*s  %9s  %9s  %10s\n", width, v.State, "Visits", "Frequency", "Absorption")
+	for _, s := range res.States {
+		absorption := "-"
+		if s.Absorbing {
+			absorption = fmt.Sprintf("%.1f%%", s.Absorption*100)
+		}
+		fmt.Printf("%-*s  %9d  %8.1f%%  %10s\n", width, s.State, s.Visits, s.Frequency*100, absorption)
+	}
+	fmt.Println()
+
+	percent := func(n int) string {
+		return fmt.Sprintf("%d (%.1f%%)", n, float64(n)*100/float64(res.Walks))
+	}
+	row := func(label string, value interface{}) {
+		fmt.Printf("%-16s %v\n", label+":", value)
+	}
+	row("Absorbed", percent(res.Absorbed))
+	row("Cut off", percent(res.Truncated))
+	row("Ended "+strings.ToLower(v.Accepting), percent(res.Accepted))
+	row("Mean length", fmt.Sprintf("%.2f", res.MeanLength))
+	if res.Absorbed > 0 {
+		row("Mean to absorb", fmt.Sprintf("%.2f", res.MeanAbsorptionLength))
+	}
+}
+
+func printStationary(f *fsm.FSM, dist map[string]float64) {
+	v := f.Vocab()
+	width := len(v.State)
+	for _, s := range f.States {
+		if len(s) > width {
+			width = len(s)
+		}
+	}
+	fmt.Printf("%-*s  %11s\n", width, v.State, "Probability")
+	for _, s := range f.States {
+		fmt.Printf("%-*s  %11.6f\n", width, s, dist[s])
+	}
+}
@@ -0,0 +1,121 @@
+// stats.go — "fsm stats" subcommand.
+//
+// Reports size and complexity metrics for a machine, or for every machine
+// in a bundle with --all. With --json the metrics are emitted as an object
+// (or, for --all, an object keyed by machine name) for dashboards.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const statsUsage = `Usage: fsm stats <input|-> [-m machine] [--all]
+
+Report size and complexity metrics: state, transition, and alphabet counts,
+determinism and completeness percentages, maximum fan-out and fan-in,
+graph diameter, strongly connected components, and cyclomatic complexity.
+
+Options:
+  -m, --machine   Select machine from bundle
+  --all           Report every machine in a bundle
+`
+
+func cmdStats(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", statsUsage)
+	}
+
+	var machineName string
+	var all bool
+	fs := newFlagSet("stats")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&all, "--all")
+	positional := fs.parseOrExit(args, statsUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	if all {
+		machines, err := fsmfile.ListMachines(input)
+		if err != nil {
+			fatalf(loadErrorCode(err), "Error listing machines: %v", err)
+		}
+		report := make(map[string]fsm.Stats)
+		for i, m := range machines {
+			f, _, err := fsmfile.ReadMachineFromBundle(input, m.Name)
+			if err != nil {
+				fatalf(loadErrorCode(err), "Error loading machine %s: %v", m.Name, err)
+			}
+			s := f.ComputeStats()
+			if opts.json {
+				report[m.Name] = s
+				continue
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("=== %s ===\n", m.Name)
+			printStats(f, s)
+		}
+		if opts.json {
+			printJSON(report)
+		}
+		return
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	s := f.ComputeStats()
+	if opts.json {
+		printJSON(s)
+		return
+	}
+	printStats(f, s)
+}
+
+func printStats(f *fsm.FSM, s fsm.Stats) {
+	v := f.Vocab()
+	row := func(label string, value interface{}) {
+		fmt.Printf("%-16s %v\n", label+":", value)
+	}
+
+	row(v.States, s.States)
+	row(v.Transition+"s", s.Transitions)
+	if s.Edges != s.Transitions {
+		row("Edges", s.Edges)
+	}
+	row(v.Alphabet, s.Inputs)
+	if s.Outputs > 0 {
+		row(v.Output+"s", s.Outputs)
+	}
+	row(v.Accepting, s.Accepting)
+	if s.Epsilon > 0 {
+		row("Epsilon", s.Epsilon)
+	}
+	fmt.Println()
+	row("Determinism", fmt.Sprintf("%.1f%%", s.Determinism))
+	row("Completeness", fmt.Sprintf("%.1f%%", s.Completeness))
+	row("Reachable", fmt.Sprintf("%d of %d", s.Reachable, s.States))
+	row("Max fan-out", fanLabel(s.MaxFanOut, s.MaxFanOutState))
+	row("Max fan-in", fanLabel(s.MaxFanIn, s.MaxFanInState))
+	row("Diameter", s.Diameter)
+	row("SCCs", fmt.Sprintf("%d (largest %d)", s.SCCs, s.LargestSCC))
+	row("Components", s.Components)
+	row("Cyclomatic", s.Cyclomatic)
+}
+
+func fanLabel(n int, state string) string {
+	if state == "" {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%d (%s)", n, state)
+}
@@ -0,0 +1,217 @@
+// symbols.go — "fsm rename-symbol" and "fsm prune-alphabet" subcommands.
+//
+// Both rewrite a machine's alphabets and write the result out like the
+// transforms in transform.go. Labels and hex mappings are derived from
+// the alphabets on save, so they follow the change automatically.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const renameSymbolUsage = `Usage: fsm rename-symbol <input|-> --from OLD --to NEW [options]
+       fsm rename-symbol <input|-> --merge A,B=NEW [options]
+
+Rename a symbol, or merge several symbols into one, in every transition
+and in the alphabet. Transitions that become identical after a merge are
+kept once. The result is validated before it is written: a merge that
+leaves a DFA, Mealy, or Moore machine with two transitions on the same
+symbol from one state is refused.
+
+Options:
+  --from OLD      Symbol to rename
+  --to NEW        New name (must not already be in the alphabet)
+  --merge SPEC    Merge symbols: A,B=NEW (NEW may be A, B, or a new name)
+  --outputs       Act on the output alphabet instead of the inputs
+  -o, --output    Output file (default: stdout; format from extension)
+  -m, --machine   Select machine from bundle
+  -f, --format    Stdout format: json (default), fsm, text, hex
+
+Examples:
+  fsm rename-symbol timer.json --from tick --to clk -o timer.json
+  fsm rename-symbol timer.json --merge tick,tock=clk -o timer.json
+  fsm rename-symbol vending.json --outputs --from vend --to dispense
+`
+
+func cmdRenameSymbol(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", renameSymbolUsage)
+	}
+
+	var from, to, merge, output, machineName, format string
+	var outputs bool
+	fs := newFlagSet("rename-symbol")
+	fs.String(&from, "--from")
+	fs.String(&to, "--to")
+	fs.String(&merge, "--merge")
+	fs.Bool(&outputs, "--outputs")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&format, "-f", "--format")
+	positional := fs.parseOrExit(args, renameSymbolUsage)
+	format = strings.ToLower(format)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required (use - for stdin)")
+	}
+	input := positional[0]
+
+	if (merge == "") == (from == "" && to == "") {
+		fatalf(exitUsage, "Error: give either --from and --to, or --merge")
+	}
+	if merge == "" && (from == "" || to == "") {
+		fatalf(exitUsage, "Error: --from and --to must be given together")
+	}
+	var mergeFrom []string
+	if merge != "" {
+		var err error
+		mergeFrom, to, err = parseMergeSpec(merge)
+		if err != nil {
+			fatalf(exitUsage, "Error: %v", err)
+		}
+	}
+
+	kind := fsm.InputSymbol
+	if outputs {
+		kind = fsm.OutputSymbol
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	before := len(f.Transitions)
+
+	if merge != "" {
+		err = f.MergeSymbols(kind, mergeFrom, to)
+	} else {
+		err = f.RenameSymbol(kind, from, to)
+	}
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+
+	if err := f.Validate(); err != nil {
+		fatalf(exitInvalid, "Error: result is invalid: %v", err)
+	}
+	if f.Type != fsm.TypeNFA && f.Type != fsm.TypePDA {
+		if nondet := f.NonDeterministicStates(); len(nondet) > 0 {
+			fatalf(exitFailure, "Error: merging %s makes the %s nondeterministic in: %s",
+				strings.Join(mergeFrom, ", "), f.Type, strings.Join(nondet, ", "))
+		}
+	}
+
+	if err := writeFSMOutput(output, format, f); err != nil {
+		fatalf(exitIO, "Error writing output: %v", err)
+	}
+
+	if !opts.quiet {
+		if merge != "" {
+			fmt.Fprintf(os.Stderr, "rename-symbol: merged %s into %s (%d transitions -> %d)\n",
+				strings.Join(mergeFrom, ", "), to, before, len(f.Transitions))
+		} else {
+			fmt.Fprintf(os.Stderr, "rename-symbol: %s %s -> %s\n", kind, from, to)
+		}
+	}
+}
+
+// parseMergeSpec splits "a,b=ab" into the symbols to merge and the
+// symbol they become.
+func parseMergeSpec(spec string) ([]string, string, error) {
+	lhs, into, ok := strings.Cut(spec, "=")
+	into = strings.TrimSpace(into)
+	if !ok || into == "" {
+		return nil, "", fmt.Errorf("invalid --merge %q (want A,B=NEW)", spec)
+	}
+	var from []string
+	for _, s := range strings.Split(lhs, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			from = append(from, s)
+		}
+	}
+	if len(from) == 0 {
+		return nil, "", fmt.Errorf("invalid --merge %q (want A,B=NEW)", spec)
+	}
+	return from, into, nil
+}
+
+const pruneAlphabetUsage = `Usage: fsm prune-alphabet <input|-> [--merge-equivalent] [-o output] [-m machine] [--format json|fsm|text|hex]
+
+Remove inputs that no transition uses and outputs that nothing produces.
+With --merge-equivalent, also merge inputs that behave identically in
+every state (same targets, outputs, and other transition data) into the
+first of them, so the machine's behaviour is unchanged but generated
+code has fewer columns in its tables. Merging changes the input names
+callers use, so it is not done by default.
+
+Options:
+  --merge-equivalent  Merge indistinguishable inputs
+  -o, --output        Output file (default: stdout; format from extension)
+  -m, --machine       Select machine from bundle
+  -f, --format        Stdout format: json (default), fsm, text, hex
+
+Examples:
+  fsm prune-alphabet controller.json -o controller.json
+  fsm prune-alphabet controller.json --merge-equivalent | fsm generate - --lang c
+`
+
+func cmdPruneAlphabet(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", pruneAlphabetUsage)
+	}
+
+	var output, machineName, format string
+	var mergeEquivalent bool
+	fs := newFlagSet("prune-alphabet")
+	fs.Bool(&mergeEquivalent, "--merge-equivalent")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&format, "-f", "--format")
+	positional := fs.parseOrExit(args, pruneAlphabetUsage)
+	format = strings.ToLower(format)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required (use - for stdin)")
+	}
+	input := positional[0]
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	inputsBefore, outputsBefore := len(f.Alphabet), len(f.OutputAlphabet)
+
+	unusedInputs, unusedOutputs := f.PruneAlphabet()
+	var merged [][]string
+	if mergeEquivalent {
+		merged = f.EquivalentInputs()
+		for _, group := range merged {
+			if err := f.MergeSymbols(fsm.InputSymbol, group, group[0]); err != nil {
+				fatalf(exitFailure, "Error: %v", err)
+			}
+		}
+	}
+
+	if err := writeFSMOutput(output, format, f); err != nil {
+		fatalf(exitIO, "Error writing output: %v", err)
+	}
+
+	if !opts.quiet {
+		if len(unusedInputs) > 0 {
+			fmt.Fprintf(os.Stderr, "prune-alphabet: removed unused inputs: %s\n", strings.Join(unusedInputs, ", "))
+		}
+		if len(unusedOutputs) > 0 {
+			fmt.Fprintf(os.Stderr, "prune-alphabet: removed unused outputs: %s\n", strings.Join(unusedOutputs, ", "))
+		}
+		for _, group := range merged {
+			fmt.Fprintf(os.Stderr, "prune-alphabet: merged %s into %s\n", strings.Join(group[1:], ", "), group[0])
+		}
+		fmt.Fprintf(os.Stderr, "prune-alphabet: %d inputs -> %d, %d outputs -> %d\n",
+			inputsBefore, len(f.Alphabet), outputsBefore, len(f.OutputAlphabet))
+	}
+}
@@ -0,0 +1,266 @@
+// table.go — "fsm table" subcommand.
+//
+// Prints the transition function as a state × input matrix, with the
+// targets (and Mealy outputs) of each state on each input. For dense,
+// complete machines a table is often easier to review than a diagram.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const tableUsage = `Usage: fsm table <input> [--format text|csv|md|html] [-m machine]
+
+Print the transition table: one row per state, one column per input
+(plus ε when the machine has epsilon transitions). Each cell holds the
+target state, or {a, b} for several, followed by /output for Mealy
+machines and the stack operation for PDAs; - means no transition.
+Moore outputs have a column of their own. Initial states are marked →
+and accepting states *.
+
+Options:
+  -f, --format    text (default), csv, md (Markdown), or html
+  -m, --machine   Select machine from bundle
+
+Examples:
+  fsm table turnstile.json
+  fsm table parser.fsm --format md > docs/parser-table.md
+`
+
+func cmdTable(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", tableUsage)
+	}
+
+	var machineName string
+	format := "text"
+	fs := newFlagSet("table")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&format, "-f", "--format")
+	positional := fs.parseOrExit(args, tableUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	format = strings.ToLower(format)
+	if format == "markdown" {
+		format = "md"
+	}
+	switch format {
+	case "text", "csv", "md", "html":
+	default:
+		fatalf(exitUsage, "Error: unknown format %q (use text, csv, md, or html)", format)
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	headers, rows := transitionTable(f)
+	switch format {
+	case "text":
+		printASCIITable(headers, rows)
+		v := f.Vocab()
+		fmt.Printf("→ %s, * %s\n", strings.ToLower(v.Initial), strings.ToLower(v.Accepting))
+	case "csv":
+		printCSVTable(headers, rows)
+	case "md":
+		printMarkdownTable(headers, rows)
+	case "html":
+		printHTMLTable(headers, rows)
+	}
+}
+
+// transitionTable returns the header and rows of f's transition table.
+func transitionTable(f *fsm.FSM) ([]string, [][]string) {
+	v := f.Vocab()
+	moore := f.Type == fsm.TypeMoore
+
+	// One column per input, in alphabet order, then ε if used.
+	inputs := append([]string(nil), f.Alphabet...)
+	hasEpsilon := false
+	for _, t := range f.Transitions {
+		hasEpsilon = hasEpsilon || t.Input == nil
+	}
+
+	headers := []string{v.State}
+	if moore {
+		headers = append(headers, v.Output)
+	}
+	headers = append(headers, inputs...)
+	if hasEpsilon {
+		headers = append(headers, "ε")
+	}
+
+	var rows [][]string
+	for _, s := range f.States {
+		mark := ""
+		if s == f.Initial {
+			mark += "→"
+		}
+		if f.IsAccepting(s) {
+			mark += "*"
+		}
+		if mark != "" {
+			mark += " "
+		}
+		row := []string{mark + s}
+		if moore {
+			row = append(row, f.StateOutputs[s])
+		}
+		for _, in := range inputs {
+			in := in
+			row = append(row, tableCell(f, s, &in))
+		}
+		if hasEpsilon {
+			row = append(row, tableCell(f, s, nil))
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows
+}
+
+// tableCell describes the transitions from state on input (nil for ε).
+// Plain transitions are merged into one target set; those carrying an
+// output, stack operation, or probability are listed one by one.
+func tableCell(f *fsm.FSM, state string, input *string) string {
+	var targets []string
+	seen := make(map[string]bool)
+	var detailed []string
+	for _, t := range f.Transitions {
+		if t.From != state || (t.Input == nil) != (input == nil) || (input != nil && *t.Input != *input) {
+			continue
+		}
+		if t.Output == nil && t.Pop == nil && t.Push == nil && t.Probability == nil {
+			for _, to := range t.To {
+				if !seen[to] {
+					seen[to] = true
+					targets = append(targets, to)
+				}
+			}
+			continue
+		}
+		cell := formatStates(t.To)
+		if t.Output != nil {
+			cell += "/" + *t.Output
+		}
+		if f.Type == fsm.TypePDA {
+			cell += " [" + t.StackLabel() + "]"
+		}
+		if t.Probability != nil {
+			cell += " (" + strconv.FormatFloat(*t.Probability, 'g', -1, 64) + ")"
+		}
+		detailed = append(detailed, cell)
+	}
+
+	var parts []string
+	if len(targets) > 0 {
+		parts = append(parts, formatStates(targets))
+	}
+	parts = append(parts, detailed...)
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// printASCIITable prints a bordered table with columns sized to fit.
+func printASCIITable(headers []string, rows [][]string) {
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, r := range rows {
+		for i, c := range r {
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	sep := "+"
+	for _, w := range widths {
+		sep += strings.Repeat("-", w+2) + "+"
+	}
+
+	printRow := func(cells []string) {
+		fmt.Print("|")
+		for i, c := range cells {
+			fmt.Printf(" %s%s |", c, strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c)))
+		}
+		fmt.Println()
+	}
+
+	fmt.Println(sep)
+	printRow(headers)
+	fmt.Println(sep)
+	for _, r := range rows {
+		printRow(r)
+	}
+	fmt.Println(sep)
+}
+
+// printCSVTable prints a table as CSV with a header line.
+func printCSVTable(headers []string, rows [][]string) {
+	line := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for i, c := range cells {
+			escaped[i] = csvEscape(c)
+		}
+		fmt.Println(strings.Join(escaped, ","))
+	}
+	line(headers)
+	for _, r := range rows {
+		line(r)
+	}
+}
+
+// printMarkdownTable prints a Markdown pipe table.
+func printMarkdownTable(headers []string, rows [][]string) {
+	line := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for i, c := range cells {
+			escaped[i] = strings.NewReplacer("|", `\|`, "*", `\*`).Replace(c)
+		}
+		fmt.Println("| " + strings.Join(escaped, " | ") + " |")
+	}
+	line(headers)
+	fmt.Println("|" + strings.Repeat(" --- |", len(headers)))
+	for _, r := range rows {
+		line(r)
+	}
+}
+
+// printHTMLTable prints a table as an HTML fragment.
+func printHTMLTable(headers []string, rows [][]string) {
+	fmt.Println("<table>")
+	fmt.Print("  <thead><tr>")
+	for _, h := range headers {
+		fmt.Printf("<th>%s</th>", html.EscapeString(h))
+	}
+	fmt.Println("</tr></thead>")
+	fmt.Println("  <tbody>")
+	for _, r := range rows {
+		fmt.Print("    <tr>")
+		for i, c := range r {
+			tag := "td"
+			if i == 0 {
+				tag = "th"
+			}
+			fmt.Printf("<%s>%s</%s>", tag, html.EscapeString(c), tag)
+		}
+		fmt.Println("</tr>")
+	}
+	fmt.Println("  </tbody>")
+	fmt.Println("</table>")
+}
@@ -0,0 +1,82 @@
+// tikz.go — "fsm tikz" subcommand.
+//
+// Exports a machine as TikZ code for the automata library, for papers
+// and lecture notes.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const tikzUsage = `Usage: fsm tikz <input> [-o output.tex] [-m machine] [--standalone] [--use-layout] [--scale N]
+
+Write a tikzpicture using the TikZ automata library, with states at the
+positions computed by the native layout.
+
+Options:
+  -o, --output    Output file (default: stdout)
+  -m, --machine   Select machine from bundle
+  --standalone    Emit a complete document (\documentclass{standalone})
+  --use-layout    Place states where fsmedit saved them (.fsm input)
+  --scale N       Centimetres per layout column (default: 0.2)
+
+Without --standalone, include the output with \input in a document that
+loads \usepackage{tikz} and \usetikzlibrary{automata}.
+
+Examples:
+  fsm tikz turnstile.json -o turnstile.tex
+  fsm tikz turnstile.json --standalone | pdflatex
+`
+
+func cmdTikZ(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", tikzUsage)
+	}
+
+	var output, machineName string
+	tikzOpts := fsmfile.DefaultTikZOptions()
+	var useLayout bool
+	fs := newFlagSet("tikz")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.Bool(&tikzOpts.Standalone, "--standalone")
+	fs.Bool(&useLayout, "--use-layout")
+	fs.Float(&tikzOpts.Scale, "--scale")
+	positional := fs.parseOrExit(args, tikzUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	if useLayout {
+		tikzOpts.UseLayout = loadLayoutWithMachine(input, machineName)
+		if tikzOpts.UseLayout == nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s has no saved layout; using automatic layout\n", input)
+		}
+	}
+
+	if output == "" {
+		output = stdioPath
+	}
+	w, err := createOutput(output)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", output, err)
+	}
+	if _, err := io.WriteString(w, fsmfile.GenerateTikZ(f, tikzOpts)); err != nil {
+		w.Close()
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if err := w.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+}
@@ -0,0 +1,93 @@
+// tile.go — tiled output for "fsm png" and "fsm svg" (--tile).
+//
+// A machine with hundreds of states needs a canvas far larger than any
+// viewer handles well, so the canvas is split into pages of at most
+// --max-size pixels, written beside an overview page that shows where
+// each one belongs.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// defaultTileSize is the page size for --tile without --max-size.
+const defaultTileSize = 2000
+
+// tilePath names a tile's file after the overview: turnstile.png has
+// tiles turnstile-1-1.png, turnstile-1-2.png, ...
+func tilePath(output string, t fsmfile.Tile) string {
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + "-" + t.Label() + ext
+}
+
+// writeTiledPNG writes the tiles of opts's canvas and an overview at
+// output, then exits on error.
+func writeTiledPNG(f *fsm.FSM, opts fsmfile.PNGOptions, maxSize int, output string) {
+	count := 0
+	overview, err := fsmfile.RenderTiledPNG(f, opts, maxSize, func(t fsmfile.Tile, img image.Image) error {
+		path := tilePath(output, t)
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := fsmfile.EncodePNG(out, img, opts.DPI); err != nil {
+			out.Close()
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+		count++
+		return out.Close()
+	})
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", output, err)
+	}
+	if err := fsmfile.EncodePNG(out, overview, opts.DPI); err != nil {
+		out.Close()
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if err := out.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	infof("Generated: %s (overview of %d tiles, %dx%d canvas)\n", output, count, opts.Width, opts.Height)
+}
+
+// writeTiledSVG writes the tiles of opts's canvas and an overview at
+// output whose tiles link to the tile files, then exits on error.
+func writeTiledSVG(f *fsm.FSM, opts fsmfile.SVGOptions, maxSize int, output string) {
+	tiles := fsmfile.TileGrid(opts.Width, opts.Height, maxSize)
+	pages, overview := fsmfile.GenerateTiledSVG(f, opts, maxSize, func(t fsmfile.Tile) string {
+		return filepath.Base(tilePath(output, t))
+	})
+	for i, t := range tiles {
+		writeFileOrExit(tilePath(output, t), pages[i])
+	}
+	writeFileOrExit(output, overview)
+	infof("Generated: %s (overview of %d tiles, %dx%d canvas)\n", output, len(tiles), opts.Width, opts.Height)
+}
+
+func writeFileOrExit(path, content string) {
+	out, err := os.Create(path)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", path, err)
+	}
+	if _, err := io.WriteString(out, content); err != nil {
+		out.Close()
+		fatalf(exitIO, "Error writing %s: %v", path, err)
+	}
+	if err := out.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", path, err)
+	}
+}
@@ -0,0 +1,76 @@
+// transform.go — "fsm minimize" and "fsm determinize" subcommands.
+//
+// Both read a machine (from a file or "-" for stdin), transform it, and
+// write the result to stdout as JSON unless -o is given, so they compose
+// in shell pipelines:
+//
+//   fsm determinize - < nfa.json | fsm minimize - | fsm dot -
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func cmdMinimize(args []string) {
+	runTransform("minimize", "Minimise a machine (NFAs are determinised first).", args,
+		func(f *fsm.FSM) (*fsm.FSM, error) { return f.Minimize() })
+}
+
+func cmdDeterminize(args []string) {
+	runTransform("determinize", "Convert an NFA to an equivalent DFA (powerset construction).", args,
+		func(f *fsm.FSM) (*fsm.FSM, error) { return f.ToDFA(), nil })
+}
+
+// runTransform implements the shared argument handling for single-machine
+// transformations.
+func runTransform(name, summary string, args []string, fn func(*fsm.FSM) (*fsm.FSM, error)) {
+	usageMsg := fmt.Sprintf(`Usage: fsm %s <input|-> [-o output] [-m machine] [--format json|fsm|text|hex]
+
+%s
+
+Options:
+  -o, --output    Output file (default: stdout; format from extension)
+  -m, --machine   Select machine from bundle
+  -f, --format    Stdout format: json (default), fsm, text, hex
+`, name, summary)
+
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", usageMsg)
+	}
+
+	var output, machineName, format string
+	fs := newFlagSet(name)
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&format, "-f", "--format")
+	positional := fs.parseOrExit(args, usageMsg)
+	format = strings.ToLower(format)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required (use - for stdin)")
+	}
+	input := positional[0]
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+
+	result, err := fn(f)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+
+	if err := writeFSMOutput(output, format, result); err != nil {
+		fatalf(exitIO, "Error writing output: %v", err)
+	}
+
+	if !opts.quiet {
+		fmt.Fprintf(os.Stderr, "%s: %d states -> %d states\n", name, len(f.States), len(result.States))
+	}
+}
@@ -0,0 +1,171 @@
+// validate_many.go — "fsm validate" over several files.
+//
+// Given more than one input, or a directory, validate checks every
+// machine file instead of stopping at the first failure, and prints a
+// table of the results, so that a whole project can be checked in one
+// command rather than a shell loop.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// validateInputs expands the arguments to validate: a directory stands for
+// the machine files beneath it, and a pattern for the files it matches.
+// many is true when there is more than one file or a directory was given.
+func validateInputs(args []string) (inputs []string, many bool) {
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			found, err := machineFilesIn(arg, "")
+			if err != nil {
+				fatalf(loadErrorCode(err), "Error reading %s: %v", arg, err)
+			}
+			if len(found) == 0 {
+				fatalf(exitFailure, "Error: no machine files in %s", arg)
+			}
+			for _, in := range found {
+				inputs = append(inputs, in.path)
+			}
+			many = true
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			matches = []string{arg}
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, many || len(inputs) > 1
+}
+
+// validateFile validates one file as cmdValidate does for a single input,
+// and returns the result with the exit code it calls for, 0 if it passed.
+// Machines are also analysed, and fail if they have more than maxWarnings
+// analysis warnings (unless maxWarnings is negative); bundles checked with
+// --bundle count their link warnings instead.
+func validateFile(input, machineName string, bundle, strict bool, maxWarnings int) (validateReport, int) {
+	report := validateReport{Input: input}
+	if bundle {
+		result, err := fsmfile.ValidateBundleLinks(input)
+		if err != nil {
+			report.Error = err.Error()
+			return report, loadErrorCode(err)
+		}
+		report.Valid = result.Valid
+		report.Errors = result.Errors
+		report.Warnings = result.Warnings
+		report.WarningCount = len(result.Warnings)
+		if !result.Valid {
+			return report, exitInvalid
+		}
+		return report, checkWarnings(&report, maxWarnings)
+	}
+
+	var f *fsm.FSM
+	var err error
+	if strict {
+		f, err = loadFSMStrict(input, machineName)
+	} else {
+		f, err = loadFSMWithMachine(input, machineName)
+	}
+	if err != nil {
+		report.Error = err.Error()
+		return report, loadErrorCode(err)
+	}
+	report.Type = string(f.Type)
+	report.States = len(f.States)
+	report.Transitions = len(f.Transitions)
+	if err := f.Validate(); err != nil {
+		report.Error = err.Error()
+		return report, exitInvalid
+	}
+	report.Valid = true
+	report.WarningCount = len(f.Analyse())
+	return report, checkWarnings(&report, maxWarnings)
+}
+
+// checkWarnings marks report as over the limit if it has more than
+// maxWarnings warnings, returning exitInvalid if so and 0 otherwise.
+func checkWarnings(report *validateReport, maxWarnings int) int {
+	if maxWarnings < 0 || report.WarningCount <= maxWarnings {
+		return 0
+	}
+	report.TooManyWarnings = true
+	report.Error = fmt.Sprintf("%d warnings, more than --max-warnings %d", report.WarningCount, maxWarnings)
+	return exitInvalid
+}
+
+// validateMany validates each input and prints a table of the results, or
+// with --json a list of reports. It exits with the code of the first input
+// that failed, if any did.
+func validateMany(inputs []string, machineName string, bundle, strict bool, maxWarnings int) {
+	reports := make([]validateReport, len(inputs))
+	codes := make([]int, len(inputs))
+	code, failed := 0, 0
+	for i, input := range inputs {
+		reports[i], codes[i] = validateFile(input, machineName, bundle, strict, maxWarnings)
+		if codes[i] != 0 {
+			failed++
+			if code == 0 {
+				code = codes[i]
+			}
+		}
+	}
+
+	if opts.json {
+		printJSON(reports)
+	} else {
+		printValidateTable(reports, codes)
+		infof("\n%d of %d files passed\n", len(reports)-failed, len(reports))
+	}
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// printValidateTable prints one row per report, with the exit code
+// validateFile gave it: the file, whether it passed, its type and size,
+// its warning count, and why it failed.
+func printValidateTable(reports []validateReport, codes []int) {
+	width := len("FILE")
+	for _, r := range reports {
+		width = max(width, len(r.Input))
+	}
+	fmt.Printf("%-*s  %-8s  %-5s  %6s  %8s\n", width, "FILE", "RESULT", "TYPE", "STATES", "WARNINGS")
+	for i, r := range reports {
+		result, color := "pass", colorGreen
+		switch {
+		case r.TooManyWarnings:
+			result, color = "warnings", colorYellow
+		case codes[i] == exitInvalid:
+			result, color = "invalid", colorRed
+		case codes[i] != 0:
+			result, color = "error", colorRed
+		}
+		// Pad before colouring, so that the escape codes do not
+		// upset the columns.
+		result = colorize(color, fmt.Sprintf("%-8s", result))
+		typ, states, warnings := "-", "-", "-"
+		if r.Type != "" {
+			typ, states = r.Type, strconv.Itoa(r.States)
+		}
+		if r.Valid {
+			warnings = strconv.Itoa(r.WarningCount)
+		}
+		fmt.Printf("%-*s  %s  %-5s  %6s  %8s", width, r.Input, result, typ, states, warnings)
+		if r.Error != "" {
+			fmt.Printf("  %s", r.Error)
+		}
+		for _, e := range r.Errors {
+			fmt.Printf("  %s", e)
+		}
+		fmt.Println()
+	}
+}
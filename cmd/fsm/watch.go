@@ -0,0 +1,175 @@
+// watch.go — "fsm watch" subcommand.
+//
+// Monitors an FSM file and re-runs a list of fsm subcommands against it
+// whenever the file changes on disk. This gives a live-preview workflow
+// when editing JSON definitions in a text editor.
+//
+// Usage:
+//   fsm watch <input> --do "<action>[,<action>...]" [options]
+//
+// Each action is an fsm subcommand with optional arguments. The watched
+// file is inserted as the first argument, so "generate --lang go" runs
+// "fsm generate <input> --lang go".
+//
+// Options:
+//   --do <actions>      Comma-separated actions to run (required)
+//   --interval <ms>     Polling interval in milliseconds (default: 500)
+//   --once              Run the actions once and exit (no watching)
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// watchActions lists the subcommands that accept an input file as their
+// first argument and are therefore usable with --do.
+var watchActions = map[string]bool{
+	"convert": true, "dot": true, "png": true, "svg": true,
+	"generate": true, "info": true, "analyse": true, "analyze": true,
+	"validate": true, "netlist": true, "properties": true,
+}
+
+// watchAction is a single subcommand invocation to repeat on change.
+type watchAction struct {
+	Command string
+	Args    []string
+}
+
+// fileStamp captures the attributes used to detect a change.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// ---- command entry point -----------------------------------------------------
+
+func cmdWatch(args []string) {
+	const usageMsg = `Usage: fsm watch <input> --do "<action>[,<action>...]" [options]
+
+Watches an FSM file and re-runs the given fsm subcommands whenever it changes.
+The watched file is passed as the first argument of each action.
+
+Options:
+  --do <actions>     Comma-separated actions, e.g. "svg --native,generate --lang go"
+  --interval <ms>    Polling interval in milliseconds (default: 500)
+  --once             Run the actions once and exit
+
+Actions:
+  convert, dot, png, svg, generate, info, analyse, validate, netlist, properties
+
+Examples:
+  fsm watch machine.json --do "svg --native"
+  fsm watch machine.json --do "svg --native,generate --lang go -o machine.go"
+  fsm watch machine.fsm --do "validate,analyse" --interval 1000
+`
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", usageMsg)
+	}
+
+	var doSpec string
+	var once bool
+	interval := 500
+	fs := newFlagSet("watch")
+	fs.String(&doSpec, "--do")
+	fs.Int(&interval, "--interval")
+	fs.Bool(&once, "--once")
+	positional := fs.parseOrExit(args, usageMsg)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	if doSpec == "" {
+		fatalf(exitUsage, "Error: --do is required")
+	}
+	if interval < 50 {
+		interval = 50
+	}
+
+	actions, err := parseWatchActions(doSpec)
+	if err != nil {
+		fatalf(exitUsage, "Error: %v", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf(exitFailure, "Error locating fsm executable: %v", err)
+	}
+
+	last, err := statFile(input)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error reading %s: %v", input, err)
+	}
+
+	runWatchActions(exe, input, actions)
+	if once {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Watching %s (every %dms, Ctrl-C to stop)\n", input, interval)
+
+	for {
+		time.Sleep(time.Duration(interval) * time.Millisecond)
+
+		cur, err := statFile(input)
+		if err != nil {
+			// Editors often write via rename; the file may be briefly absent.
+			continue
+		}
+		if cur.modTime.Equal(last.modTime) && cur.size == last.size {
+			continue
+		}
+		last = cur
+
+		fmt.Fprintf(os.Stderr, "\n[%s] %s changed\n", time.Now().Format("15:04:05"), input)
+		runWatchActions(exe, input, actions)
+	}
+}
+
+// parseWatchActions splits a --do specification into individual actions.
+func parseWatchActions(spec string) ([]watchAction, error) {
+	var actions []watchAction
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		if !watchActions[fields[0]] {
+			return nil, fmt.Errorf("unsupported watch action %q", fields[0])
+		}
+		actions = append(actions, watchAction{Command: fields[0], Args: fields[1:]})
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("no actions given in --do")
+	}
+	return actions, nil
+}
+
+// runWatchActions runs each action as a child fsm process so that a failing
+// action (which calls os.Exit) does not terminate the watcher.
+func runWatchActions(exe, input string, actions []watchAction) {
+	for _, a := range actions {
+		argv := append([]string{a.Command, input}, a.Args...)
+		fmt.Fprintf(os.Stderr, "-> fsm %s\n", strings.Join(argv, " "))
+
+		cmd := exec.Command(exe, append(globalFlagArgs(), argv...)...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "   %s failed: %v\n", a.Command, err)
+		}
+	}
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
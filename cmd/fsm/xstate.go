@@ -0,0 +1,156 @@
+// xstate.go — "fsm xstate" subcommand.
+//
+// Exports a machine as an XState machine config, so that web front ends
+// can run the same model, and imports one. Linked states of a bundle
+// become nested states, and nested states linked states.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+const xstateUsage = `Usage: fsm xstate <input> [-o output.json] [-m machine] [--id ID] [--flat]
+       fsm xstate --import <config.json|-> [-o output]
+
+Write an XState (v5) machine config as JSON, for createMachine, or with
+--import read one (v4 or v5) into a machine.
+
+Options:
+  -o, --output    Output file (default: stdout)
+  -m, --machine   Select machine from bundle (default: the first)
+  --id ID         Machine id (default: the machine name)
+  --flat          Leave linked states atomic instead of nesting the
+                  states of their machines
+  --import        Read an XState config; a config with nested states
+                  becomes a bundle, and needs a .fsm output file
+
+Inputs become events and accepting states are tagged "accepting". Mealy
+and Moore outputs become actions, and the xstate.guard, xstate.actions,
+xstate.entry, and xstate.exit metadata keys add guards and actions.
+
+Examples:
+  fsm xstate turnstile.json -o turnstile.json
+  fsm xstate system.fsm -m main -o main.machine.json
+  fsm xstate --import toggle.machine.json -o toggle.fsm
+`
+
+func cmdXState(args []string) {
+	if len(args) < 1 {
+		fatalf(exitUsage, "%s", xstateUsage)
+	}
+
+	var output, machineName string
+	var xopts fsmfile.XStateOptions
+	var flat, imp bool
+	fs := newFlagSet("xstate")
+	fs.String(&output, "-o", "--output")
+	fs.String(&machineName, "-m", "--machine")
+	fs.String(&xopts.ID, "--id")
+	fs.Bool(&flat, "--flat")
+	fs.Bool(&imp, "--import")
+	positional := fs.parseOrExit(args, xstateUsage)
+
+	if len(positional) == 0 {
+		fatalf(exitUsage, "Error: input file required")
+	}
+	input := positional[0]
+	if imp {
+		importXState(input, output)
+		return
+	}
+
+	f, err := loadFSMWithMachine(input, machineName)
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+	}
+	if !flat && f.HasLinkedStates() && filepath.Ext(input) == ".fsm" {
+		if isBundle, _ := fsmfile.IsBundle(input); isBundle {
+			xopts.Machines, err = loadBundleMachines(input)
+			if err != nil {
+				fatalf(loadErrorCode(err), "Error loading %s: %v", input, err)
+			}
+		}
+	}
+
+	data, err := fsmfile.GenerateXState(f, xopts)
+	if err != nil {
+		fatalf(exitFailure, "Error: %v", err)
+	}
+
+	if output == "" {
+		output = stdioPath
+	}
+	w, err := createOutput(output)
+	if err != nil {
+		fatalf(exitIO, "Error creating %s: %v", output, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if err := w.Close(); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+}
+
+// loadBundleMachines loads every machine of a bundle, by name.
+func loadBundleMachines(path string) (map[string]*fsm.FSM, error) {
+	list, err := fsmfile.ListMachines(path)
+	if err != nil {
+		return nil, err
+	}
+	machines := make(map[string]*fsm.FSM, len(list))
+	for _, m := range list {
+		f, _, err := fsmfile.ReadMachineFromBundle(path, m.Name)
+		if err != nil {
+			return nil, fmt.Errorf("machine %s: %w", m.Name, err)
+		}
+		machines[m.Name] = f
+	}
+	return machines, nil
+}
+
+// importXState reads the XState config at input and writes its machines
+// to output.
+func importXState(input, output string) {
+	var data []byte
+	var err error
+	if input == stdioPath {
+		data, err = readStdin()
+	} else {
+		data, err = os.ReadFile(input)
+	}
+	if err != nil {
+		fatalf(loadErrorCode(err), "Error reading %s: %v", input, err)
+	}
+	machines, err := fsmfile.ParseXState(data)
+	if err != nil {
+		fatalf(exitParse, "Error: %v", err)
+	}
+
+	if len(machines) == 1 {
+		if err := writeFSMOutput(output, "", machines[0]); err != nil {
+			fatalf(exitIO, "Error writing output: %v", err)
+		}
+		return
+	}
+	if filepath.Ext(output) != ".fsm" {
+		fatalf(exitUsage, "Error: %s has nested states, which become %d machines; write them to a .fsm bundle with -o", input, len(machines))
+	}
+	bundle := make(map[string]fsmfile.BundleMachineData, len(machines))
+	for _, f := range machines {
+		bundle[f.Name] = fsmfile.BundleMachineData{FSM: f}
+	}
+	if err := fsmfile.WriteBundleFromData(output, bundle); err != nil {
+		fatalf(exitIO, "Error writing %s: %v", output, err)
+	}
+	if !opts.quiet {
+		fmt.Printf("Wrote %d machines to %s; the main machine is %s\n", len(machines), output, machines[0].Name)
+	}
+}
@@ -0,0 +1,271 @@
+// Acceptance panel for fsmedit.
+// Opened via 'y' on the canvas, keeps a list of candidate input
+// sequences, each optionally with the verdict it should get, and shows
+// what the machine does with each. The candidates are run again every
+// time the panel is drawn, so the list stays current as the machine is
+// edited on the canvas, in the text pane, or by undo.
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+var (
+	styleAcceptPass = tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	styleAcceptFail = tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true)
+)
+
+// acceptanceCase is a candidate in the acceptance panel: the line as
+// typed, in the .fsmtest syntax with the verdict optional, and what it
+// expects, if anything.
+type acceptanceCase struct {
+	Text   string
+	Inputs []string
+	Expect *fsm.TestCase // nil when the line gives no verdict
+}
+
+// parseAcceptanceLine reads a candidate: inputs separated by spaces,
+// quoted as in the text format, and optionally "=> accept", "=> reject",
+// or "=> stuck" with the outputs expected, as in a .fsmtest line.
+func parseAcceptanceLine(line string) (acceptanceCase, error) {
+	cases, err := fsmfile.ParseTests([]byte(line))
+	if err == nil && len(cases) == 1 {
+		return acceptanceCase{Text: line, Inputs: cases[0].Inputs, Expect: &cases[0]}, nil
+	}
+	if err == nil {
+		return acceptanceCase{}, errors.New("type the inputs, or => accept for the empty sequence")
+	}
+	// Without a verdict, any verdict will do to read the inputs.
+	if plain, err2 := fsmfile.ParseTests([]byte(line + " => reject")); err2 == nil && len(plain) == 1 {
+		return acceptanceCase{Text: line, Inputs: plain[0].Inputs}, nil
+	}
+	var te *fsmfile.TextError
+	if errors.As(err, &te) {
+		return acceptanceCase{}, errors.New(te.Msg)
+	}
+	return acceptanceCase{}, err
+}
+
+// acceptanceResult runs c through f and returns what f does, as a
+// verdict to show, and whether that is what c expects (always, if it
+// expects nothing).
+func acceptanceResult(f *fsm.FSM, c acceptanceCase) (verdict string, pass bool, err error) {
+	got, err := fsm.RunTestCase(f, c.Inputs)
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case got.Stuck:
+		verdict = fmt.Sprintf("stuck on %s (#%d)", got.Inputs[len(got.Inputs)-1], len(got.Inputs))
+	case got.Accept:
+		verdict = "accept"
+	default:
+		verdict = "reject"
+	}
+	return verdict, c.Expect == nil || c.Expect.Matches(got), nil
+}
+
+// acceptanceSummary counts the candidates that expect a verdict and
+// those of them that get it.
+func (ed *Editor) acceptanceSummary() (passed, checked int) {
+	for _, c := range ed.acceptance {
+		if c.Expect == nil {
+			continue
+		}
+		checked++
+		if _, pass, err := acceptanceResult(ed.fsm, c); err == nil && pass {
+			passed++
+		}
+	}
+	return passed, checked
+}
+
+// openAcceptance shows the acceptance panel and gives it the keyboard.
+func (ed *Editor) openAcceptance() {
+	ed.showAcceptance = true
+	if ed.acceptanceInput == "" {
+		ed.acceptanceEdit = -1
+	}
+	ed.acceptanceSel = len(ed.acceptance) // the entry line
+	ed.mode = ModeAcceptance
+}
+
+// commitAcceptanceInput adds the entry line as a candidate, or puts it
+// back in place of the one being edited.
+func (ed *Editor) commitAcceptanceInput() {
+	c, err := parseAcceptanceLine(ed.acceptanceInput)
+	if err != nil {
+		ed.showMessage(err.Error(), MsgError)
+		return
+	}
+	if ed.acceptanceEdit >= 0 && ed.acceptanceEdit < len(ed.acceptance) {
+		ed.acceptance[ed.acceptanceEdit] = c
+		ed.acceptanceEdit = -1
+	} else {
+		ed.acceptance = append(ed.acceptance, c)
+	}
+	ed.acceptanceInput = ""
+	ed.acceptanceSel = len(ed.acceptance)
+}
+
+func (ed *Editor) handleAcceptanceKey(ev *tcell.EventKey) bool {
+	onEntry := ed.acceptanceSel >= len(ed.acceptance)
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		ed.showAcceptance = false
+		ed.acceptanceEdit = -1
+		ed.mode = ModeCanvas
+	case tcell.KeyTab:
+		// Back to the canvas, leaving the panel open.
+		ed.mode = ModeCanvas
+	case tcell.KeyUp:
+		if ed.acceptanceSel > 0 {
+			ed.acceptanceSel--
+		}
+	case tcell.KeyDown:
+		if ed.acceptanceSel < len(ed.acceptance) {
+			ed.acceptanceSel++
+		}
+	case tcell.KeyEnter:
+		if onEntry {
+			if ed.acceptanceInput != "" {
+				ed.commitAcceptanceInput()
+			}
+			break
+		}
+		// Edit the selected candidate on the entry line.
+		ed.acceptanceEdit = ed.acceptanceSel
+		ed.acceptanceInput = ed.acceptance[ed.acceptanceSel].Text
+		ed.acceptanceSel = len(ed.acceptance)
+	case tcell.KeyDelete:
+		if !onEntry {
+			ed.acceptance = append(ed.acceptance[:ed.acceptanceSel], ed.acceptance[ed.acceptanceSel+1:]...)
+			ed.acceptanceEdit = -1
+		}
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if onEntry && ed.acceptanceInput != "" {
+			r := []rune(ed.acceptanceInput)
+			ed.acceptanceInput = string(r[:len(r)-1])
+		}
+	case tcell.KeyRune:
+		ed.acceptanceSel = len(ed.acceptance)
+		ed.acceptanceInput += string(ev.Rune())
+	}
+	return false
+}
+
+// drawAcceptance draws the panel at the bottom left of the canvas: a row
+// per candidate with its verdict, marked ✓ or ✗ against the verdict it
+// expects, and the entry line.
+func (ed *Editor) drawAcceptance(w, h int) {
+	canvasW := w - ed.sidebarWidth
+	boxW := 56
+	if boxW > canvasW-2 {
+		boxW = canvasW - 2
+	}
+	rows := len(ed.acceptance)
+	if maxRows := (h - 4) / 3; rows > maxRows {
+		rows = maxRows
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	boxH := rows + 4 // border, rows, entry line, border
+	x0, y0 := 1, h-3-boxH
+	if boxW < 20 || y0 < 1 {
+		return
+	}
+
+	title := " Acceptance "
+	if passed, checked := ed.acceptanceSummary(); checked > 0 {
+		title = fmt.Sprintf(" Acceptance %d/%d ", passed, checked)
+	}
+	ed.drawTitledBox(x0, y0, boxW, boxH, title)
+	focused := ed.mode == ModeAcceptance
+
+	if len(ed.acceptance) == 0 {
+		ed.drawRunes(x0+2, y0+1, "Type inputs, e.g. coin push => accept", boxW-4, styleHelp)
+	}
+	scroll := 0
+	if ed.acceptanceSel < len(ed.acceptance) && ed.acceptanceSel >= rows {
+		scroll = ed.acceptanceSel - rows + 1
+	} else if len(ed.acceptance) > rows && ed.acceptanceSel >= len(ed.acceptance) {
+		scroll = len(ed.acceptance) - rows
+	}
+	for i := 0; i < rows && i+scroll < len(ed.acceptance); i++ {
+		idx := i + scroll
+		c := ed.acceptance[idx]
+		y := y0 + 1 + i
+
+		mark, markStyle := "·", styleHelp
+		verdict, pass, err := acceptanceResult(ed.fsm, c)
+		verdictStyle := styleAcceptPass
+		switch {
+		case err != nil:
+			verdict, verdictStyle = err.Error(), styleAcceptFail
+			mark, markStyle = "✗", styleAcceptFail
+		case c.Expect != nil && pass:
+			mark, markStyle = "✓", styleAcceptPass
+		case c.Expect != nil:
+			mark, markStyle = "✗", styleAcceptFail
+		}
+		if err == nil && verdict != "accept" {
+			verdictStyle = styleHelp
+			if !pass {
+				verdictStyle = styleAcceptFail
+			}
+		}
+
+		textStyle := styleMenu
+		if focused && idx == ed.acceptanceSel {
+			textStyle = styleMenuSel
+		}
+		if idx == ed.acceptanceEdit {
+			textStyle = styleHelp
+		}
+		ed.drawRunes(x0+2, y, mark, 1, markStyle)
+		verdictW := len([]rune(verdict))
+		if verdictW > (boxW-8)/2 {
+			verdictW = (boxW - 8) / 2
+		}
+		textW := boxW - 8 - verdictW
+		ed.drawRunes(x0+4, y, c.Text, textW, textStyle)
+		ed.drawRunes(x0+boxW-2-verdictW, y, verdict, verdictW, verdictStyle)
+	}
+
+	// Entry line, with live feedback on what has been typed.
+	y := y0 + boxH - 2
+	entryStyle := styleHelp
+	if focused {
+		entryStyle = styleInput
+	}
+	prompt := "> " + ed.acceptanceInput
+	if focused && ed.acceptanceSel >= len(ed.acceptance) {
+		prompt += "_"
+	}
+	ed.drawRunes(x0+2, y, prompt, boxW-4, entryStyle)
+	if ed.acceptanceInput != "" {
+		if _, err := parseAcceptanceLine(ed.acceptanceInput); err != nil {
+			ed.drawRunes(x0+2, y0+boxH-1, " ✗ "+err.Error()+" ", boxW-4, styleMsgError)
+		}
+	}
+}
+
+// drawRunes draws s from x, one cell per character, cut to width cells.
+func (ed *Editor) drawRunes(x, y int, s string, width int, style tcell.Style) {
+	r := []rune(s)
+	if len(r) > width {
+		if width < 1 {
+			return
+		}
+		r = append(r[:width-1], '…')
+	}
+	for i, c := range r {
+		ed.screen.SetContent(x+i, y, c, nil, style)
+	}
+}
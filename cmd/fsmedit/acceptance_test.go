@@ -0,0 +1,145 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// turnstileEditor returns an editor on a turnstile that accepts in
+// open, with no transition on push from locked.
+func turnstileEditor() *Editor {
+	ed := newTestEditorWithStates([]string{"locked", "open"})
+	ed.fsm.Alphabet = []string{"coin", "push"}
+	coin, push := "coin", "push"
+	ed.fsm.AddTransition("locked", &coin, []string{"open"}, nil)
+	ed.fsm.AddTransition("open", &push, []string{"locked"}, nil)
+	ed.fsm.Accepting = []string{"open"}
+	return ed
+}
+
+func typeAcceptance(ed *Editor, s string) {
+	for _, r := range s {
+		ed.handleAcceptanceKey(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+	ed.handleAcceptanceKey(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+}
+
+func TestParseAcceptanceLine(t *testing.T) {
+	c, err := parseAcceptanceLine(`coin "push" => accept`)
+	if err != nil || len(c.Inputs) != 2 || c.Inputs[1] != "push" || c.Expect == nil || !c.Expect.Accept {
+		t.Errorf("with verdict: %+v, %v", c, err)
+	}
+	c, err = parseAcceptanceLine("coin push")
+	if err != nil || len(c.Inputs) != 2 || c.Expect != nil {
+		t.Errorf("without verdict: %+v, %v", c, err)
+	}
+	c, err = parseAcceptanceLine("=> reject")
+	if err != nil || len(c.Inputs) != 0 || c.Expect == nil {
+		t.Errorf("empty sequence: %+v, %v", c, err)
+	}
+	if _, err := parseAcceptanceLine("  "); err == nil {
+		t.Error("blank line accepted")
+	}
+	if _, err := parseAcceptanceLine(`coin "push`); err == nil {
+		t.Error("unterminated quote accepted")
+	}
+	if _, err := parseAcceptanceLine("coin => maybe"); err == nil {
+		t.Error("unknown verdict accepted")
+	}
+}
+
+func TestAcceptanceResult(t *testing.T) {
+	ed := turnstileEditor()
+	tests := []struct {
+		line    string
+		verdict string
+		pass    bool
+	}{
+		{"coin", "accept", true},
+		{"coin push", "reject", true},
+		{"coin => accept", "accept", true},
+		{"coin push => accept", "reject", false},
+		{"push coin", "stuck on push (#1)", true},
+		{"push => stuck", "stuck on push (#1)", true},
+		{"push => reject", "stuck on push (#1)", false},
+	}
+	for _, tt := range tests {
+		c, err := parseAcceptanceLine(tt.line)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		verdict, pass, err := acceptanceResult(ed.fsm, c)
+		if err != nil || verdict != tt.verdict || pass != tt.pass {
+			t.Errorf("%s: got %q, %v, %v; want %q, %v", tt.line, verdict, pass, err, tt.verdict, tt.pass)
+		}
+	}
+}
+
+func TestAcceptance_FollowsEdits(t *testing.T) {
+	ed := turnstileEditor()
+	ed.openAcceptance()
+	typeAcceptance(ed, "coin push coin => accept")
+	typeAcceptance(ed, "push => accept")
+	typeAcceptance(ed, "coin")
+
+	if len(ed.acceptance) != 3 {
+		t.Fatalf("candidates = %+v", ed.acceptance)
+	}
+	if passed, checked := ed.acceptanceSummary(); passed != 1 || checked != 2 {
+		t.Errorf("summary = %d/%d, want 1/2", passed, checked)
+	}
+
+	// Let push keep the turnstile locked: the second candidate is now
+	// rejected rather than stuck, and still fails.
+	push := "push"
+	ed.fsm.AddTransition("locked", &push, []string{"locked"}, nil)
+	if passed, _ := ed.acceptanceSummary(); passed != 1 {
+		t.Errorf("after adding a transition, %d passed", passed)
+	}
+	ed.fsm.Accepting = []string{"open", "locked"}
+	if passed, checked := ed.acceptanceSummary(); passed != 2 || checked != 2 {
+		t.Errorf("after making locked accepting, summary = %d/%d", passed, checked)
+	}
+}
+
+func TestAcceptance_EditAndDelete(t *testing.T) {
+	ed := turnstileEditor()
+	ed.openAcceptance()
+	typeAcceptance(ed, "coin")
+	typeAcceptance(ed, "push")
+
+	// Edit the first candidate: Up twice from the entry line, Enter
+	// brings it back to the entry line, and Enter puts it back.
+	up := tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+	ed.handleAcceptanceKey(up)
+	ed.handleAcceptanceKey(up)
+	ed.handleAcceptanceKey(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	if ed.acceptanceInput != "coin" || ed.acceptanceEdit != 0 {
+		t.Fatalf("editing: input %q, edit %d", ed.acceptanceInput, ed.acceptanceEdit)
+	}
+	typeAcceptance(ed, " => accept")
+	if len(ed.acceptance) != 2 || ed.acceptance[0].Text != "coin => accept" || ed.acceptance[0].Expect == nil {
+		t.Fatalf("after editing: %+v", ed.acceptance)
+	}
+
+	// A line that does not parse stays on the entry line.
+	typeAcceptance(ed, `"coin`)
+	if len(ed.acceptance) != 2 || ed.acceptanceInput != `"coin` || ed.messageType != MsgError {
+		t.Errorf("bad line: %+v, input %q", ed.acceptance, ed.acceptanceInput)
+	}
+
+	ed.handleAcceptanceKey(up)
+	ed.handleAcceptanceKey(tcell.NewEventKey(tcell.KeyDelete, 0, tcell.ModNone))
+	if len(ed.acceptance) != 1 || ed.acceptance[0].Text != "coin => accept" {
+		t.Errorf("after deleting: %+v", ed.acceptance)
+	}
+
+	ed.handleAcceptanceKey(tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone))
+	if ed.showAcceptance || ed.mode != ModeCanvas {
+		t.Error("Esc did not close the panel")
+	}
+	if len(ed.acceptance) != 1 {
+		t.Error("closing the panel lost the candidates")
+	}
+}
@@ -15,29 +15,13 @@ import (
 
 
 func (ed *Editor) copyToClipboard() {
-	// Generate hex representation of the FSM
-	records, stateNames, inputNames, outputNames := fsmfile.FSMToRecords(ed.fsm)
-	hex := fsmfile.FormatHex(records, 1) // width=1 means one record per line
-
-	// Generate labels.toml content
-	labels := fsmfile.GenerateLabels(ed.fsm, stateNames, inputNames, outputNames)
-
-	// Generate layout.toml content from current state positions
+	// Collect current state positions for the layout section
 	positions := make(map[string][2]int)
 	for _, sp := range ed.states {
 		positions[sp.Name] = [2]int{sp.X, sp.Y}
 	}
-	layout := fsmfile.GenerateLayout(positions, ed.canvasOffsetX, ed.canvasOffsetY)
-
-	// Combine all content with separators
-	var sb strings.Builder
-	sb.WriteString(hex)
-	sb.WriteString("\n# ---- labels.toml -----------------------------------\n")
-	sb.WriteString(labels)
-	sb.WriteString("# ---- layout.toml -----------------------------------\n")
-	sb.WriteString(layout)
-
-	content := sb.String()
+	content := fsmfile.FormatClipboard(ed.fsm, positions, ed.canvasOffsetX, ed.canvasOffsetY)
+	records, _, _, _ := fsmfile.FSMToRecords(ed.fsm)
 
 	// Find appropriate clipboard command for the OS
 	var cmd *exec.Cmd
@@ -118,94 +102,137 @@ func (ed *Editor) pasteFromClipboard() {
 		return
 	}
 
-	content := string(output)
-	
-	// Remove BOM if present (UTF-8 BOM: EF BB BF)
-	content = strings.TrimPrefix(content, "\xef\xbb\xbf")
-	// Remove any leading/trailing whitespace
-	content = strings.TrimSpace(content)
-	// Normalize line endings to \n
-	content = strings.ReplaceAll(content, "\r\n", "\n")
-	content = strings.ReplaceAll(content, "\r", "\n")
-	
-	if content == "" {
-		ed.showMessage("Clipboard is empty", MsgError)
+	pastedFSM, layout, err := fsmfile.ParseClipboard(string(output))
+	if err != nil {
+		ed.showMessage("Cannot paste: "+err.Error(), MsgError)
 		return
 	}
 
-	// Parse the clipboard content - look for our format with separators
-	hexPart := ""
-	labelsPart := ""
-	layoutPart := ""
+	if len(pastedFSM.States) == 0 {
+		ed.showMessage("No states in clipboard data", MsgError)
+		return
+	}
 
-	labelsMarker := "# ---- labels.toml -----------------------------------"
-	layoutMarker := "# ---- layout.toml -----------------------------------"
+	// Save current state for undo
+	ed.saveSnapshot(fmt.Sprintf("Pasted %d states", len(pastedFSM.States)))
 
-	labelsIdx := strings.Index(content, labelsMarker)
-	layoutIdx := strings.Index(content, layoutMarker)
+	offsetX, offsetY := ed.pastePlacement(pastedFSM, layout)
+	statesAdded, transAdded, renamed := ed.mergeMachine(pastedFSM, layout, offsetX, offsetY)
 
-	if labelsIdx == -1 || layoutIdx == -1 {
-		// Try to parse as just hex records (legacy format)
-		hexPart = strings.TrimSpace(content)
-	} else {
-		hexPart = strings.TrimSpace(content[:labelsIdx])
-		labelsPart = strings.TrimSpace(content[labelsIdx+len(labelsMarker) : layoutIdx])
-		layoutPart = strings.TrimSpace(content[layoutIdx+len(layoutMarker):])
+	msg := fmt.Sprintf("Pasted %d states, %d transitions", statesAdded, transAdded)
+	if renamed > 0 {
+		msg += fmt.Sprintf(" (%d renamed)", renamed)
 	}
+	ed.showMessage(msg, MsgSuccess)
+}
 
-	// Validate hex format - check we have content and first char looks like hex
-	if len(hexPart) < 4 {
-		ed.showMessage("Invalid clipboard format (no hex data found)", MsgError)
-		return
+// pastedBounds returns the top-left corner and the size of a machine about
+// to be merged, from its layout or, without one, estimated for the grid
+// mergeMachine places it on.
+func pastedBounds(pastedFSM *fsm.FSM, layout *fsmfile.Layout) (minX, minY, width, height int) {
+	if layout != nil && len(layout.States) > 0 {
+		maxX, maxY := 0, 0
+		first := true
+		for stateName, pos := range layout.States {
+			// Account for full state box width plus padding
+			stateWidth := len(stateName) + 10
+			if first {
+				minX, minY = pos.X, pos.Y
+				maxX, maxY = pos.X+stateWidth, pos.Y
+				first = false
+			} else {
+				if pos.X < minX {
+					minX = pos.X
+				}
+				if pos.Y < minY {
+					minY = pos.Y
+				}
+				if pos.X+stateWidth > maxX {
+					maxX = pos.X + stateWidth
+				}
+				if pos.Y > maxY {
+					maxY = pos.Y
+				}
+			}
+		}
+		return minX, minY, maxX - minX, maxY - minY + 1
 	}
+	// Estimate size for auto-layout (5 states per row, 15 chars apart)
+	cols := 5
+	rows := (len(pastedFSM.States) + cols - 1) / cols
+	return 0, 0, cols * 15, rows * 4
+}
 
-	// Parse hex records
-	records, err := fsmfile.ParseHex(hexPart)
-	if err != nil {
-		ed.showMessage("Invalid hex data: "+err.Error(), MsgError)
-		return
+// pastePlacement finds where pasted content goes: beside the existing
+// states if a row of them has room, otherwise in a new row below.
+func (ed *Editor) pastePlacement(pastedFSM *fsm.FSM, layout *fsmfile.Layout) (offsetX, offsetY int) {
+	if len(ed.states) == 0 {
+		// Empty canvas, place at default position
+		return 5, 3
 	}
 
-	if len(records) == 0 {
-		ed.showMessage("No valid hex records found", MsgError)
-		return
+	// Track the rightmost edge at each "row band" (group of Y coordinates)
+	type rowBand struct {
+		minY, maxY int
+		maxX       int
 	}
+	var bands []rowBand
 
-	// Parse labels if present
-	var labels *fsmfile.Labels
-	if labelsPart != "" {
-		labels, err = fsmfile.ParseLabels(labelsPart)
-		if err != nil {
-			ed.showMessage("Invalid labels: "+err.Error(), MsgError)
-			return
+	// Group states into row bands (states within the height of a typical FSM of each other)
+	for _, sp := range ed.states {
+		// State box width: prefix (2) + "[" + name + "]" + suffix (1) + padding for labels
+		// "→ [name]*" worst case, plus some space for transition labels
+		rightEdge := sp.X + len(sp.Name) + 10
+		found := false
+		for i := range bands {
+			// Use larger tolerance for band grouping to handle taller FSMs
+			if sp.Y >= bands[i].minY-2 && sp.Y <= bands[i].maxY+2 {
+				// Belongs to this band
+				if sp.Y < bands[i].minY {
+					bands[i].minY = sp.Y
+				}
+				if sp.Y > bands[i].maxY {
+					bands[i].maxY = sp.Y
+				}
+				if rightEdge > bands[i].maxX {
+					bands[i].maxX = rightEdge
+				}
+				found = true
+				break
+			}
 		}
-	}
-
-	// Parse layout if present
-	var layout *fsmfile.Layout
-	if layoutPart != "" {
-		layout, err = fsmfile.ParseLayout(layoutPart)
-		if err != nil {
-			// Layout errors are non-fatal, just ignore layout
-			layout = nil
+		if !found {
+			bands = append(bands, rowBand{minY: sp.Y, maxY: sp.Y, maxX: rightEdge})
 		}
 	}
 
-	// Convert records to FSM
-	pastedFSM, err := fsmfile.RecordsToFSM(records, labels)
-	if err != nil {
-		ed.showMessage("Invalid FSM data: "+err.Error(), MsgError)
-		return
-	}
+	_, _, pastedWidth, _ := pastedBounds(pastedFSM, layout)
 
-	if len(pastedFSM.States) == 0 {
-		ed.showMessage("No states in clipboard data", MsgError)
-		return
+	// Try to fit in existing row bands first, then create new band below
+	canvasWidthThreshold := 150
+	for _, band := range bands {
+		if band.maxX+6+pastedWidth <= canvasWidthThreshold {
+			// Fits in this band - place right next to existing content
+			return band.maxX + 6, band.minY
+		}
 	}
+	// Create new row below all existing content
+	maxY := 0
+	for _, band := range bands {
+		if band.maxY > maxY {
+			maxY = band.maxY
+		}
+	}
+	// Place just below the previous row with small padding (2 rows gap)
+	return 5, maxY + 3
+}
 
-	// Save current state for undo
-	ed.saveSnapshot()
-
+// mergeMachine adds the states, transitions, and nets of pastedFSM to the
+// current machine, with its top-left state at (offsetX, offsetY). States
+// whose names are taken get a numeric suffix; inputs and outputs of the
+// same name are shared. It returns the numbers of states and transitions
+// added and of states renamed. The caller saves the undo snapshot.
+func (ed *Editor) mergeMachine(pastedFSM *fsm.FSM, layout *fsmfile.Layout, offsetX, offsetY int) (statesAdded, transAdded, renamed int) {
 	// Build name mapping for conflicts (old name -> new name)
 	stateRename := make(map[string]string)
 	inputRename := make(map[string]string)
@@ -261,117 +288,9 @@ func (ed *Editor) pasteFromClipboard() {
 		}
 	}
 
-	// Find bounds of existing states to place pasted content
-	// Track the rightmost edge at each "row band" (group of Y coordinates)
-	type rowBand struct {
-		minY, maxY int
-		maxX       int
-	}
-	var bands []rowBand
-
-	// Group states into row bands (states within the height of a typical FSM of each other)
-	for _, sp := range ed.states {
-		// State box width: prefix (2) + "[" + name + "]" + suffix (1) + padding for labels
-		// "→ [name]*" worst case, plus some space for transition labels
-		rightEdge := sp.X + len(sp.Name) + 10
-		found := false
-		for i := range bands {
-			// Use larger tolerance for band grouping to handle taller FSMs
-			if sp.Y >= bands[i].minY-2 && sp.Y <= bands[i].maxY+2 {
-				// Belongs to this band
-				if sp.Y < bands[i].minY {
-					bands[i].minY = sp.Y
-				}
-				if sp.Y > bands[i].maxY {
-					bands[i].maxY = sp.Y
-				}
-				if rightEdge > bands[i].maxX {
-					bands[i].maxX = rightEdge
-				}
-				found = true
-				break
-			}
-		}
-		if !found {
-			bands = append(bands, rowBand{minY: sp.Y, maxY: sp.Y, maxX: rightEdge})
-		}
-	}
-
-	// Calculate pasted FSM bounds from layout
-	pastedMinX, pastedMinY := 0, 0
-	pastedMaxX, pastedMaxY := 0, 0
-	pastedWidth, pastedHeight := 0, 0
-	if layout != nil && len(layout.States) > 0 {
-		first := true
-		for stateName, pos := range layout.States {
-			// Account for full state box width plus padding
-			stateWidth := len(stateName) + 10
-			if first {
-				pastedMinX, pastedMinY = pos.X, pos.Y
-				pastedMaxX, pastedMaxY = pos.X+stateWidth, pos.Y
-				first = false
-			} else {
-				if pos.X < pastedMinX {
-					pastedMinX = pos.X
-				}
-				if pos.Y < pastedMinY {
-					pastedMinY = pos.Y
-				}
-				if pos.X+stateWidth > pastedMaxX {
-					pastedMaxX = pos.X + stateWidth
-				}
-				if pos.Y > pastedMaxY {
-					pastedMaxY = pos.Y
-				}
-			}
-		}
-		pastedWidth = pastedMaxX - pastedMinX
-		pastedHeight = pastedMaxY - pastedMinY + 1
-	} else {
-		// Estimate size for auto-layout (5 states per row, 15 chars apart)
-		cols := 5
-		rows := (len(pastedFSM.States) + cols - 1) / cols
-		pastedWidth = cols * 15
-		pastedHeight = rows * 4
-	}
-
-	// Find placement: try to fit in existing row bands first, then create new band below
-	canvasWidthThreshold := 150
-	var offsetX, offsetY int
-
-	if len(ed.states) == 0 {
-		// Empty canvas, place at default position
-		offsetX = 5
-		offsetY = 3
-	} else {
-		placed := false
-		// Try each existing band
-		for _, band := range bands {
-			if band.maxX+6+pastedWidth <= canvasWidthThreshold {
-				// Fits in this band - place right next to existing content
-				offsetX = band.maxX + 6
-				offsetY = band.minY
-				placed = true
-				break
-			}
-		}
-		if !placed {
-			// Create new row below all existing content
-			maxY := 0
-			for _, band := range bands {
-				if band.maxY > maxY {
-					maxY = band.maxY
-				}
-			}
-			offsetX = 5
-			// Place just below the previous row with small padding (2 rows gap)
-			offsetY = maxY + 3
-		}
-	}
-	_ = pastedHeight // Used for width threshold calculation
+	pastedMinX, pastedMinY, _, _ := pastedBounds(pastedFSM, layout)
 
 	// Add states with renamed names and adjusted positions
-	statesAdded := 0
 	for _, oldName := range pastedFSM.States {
 		newName := stateRename[oldName]
 		ed.fsm.States = append(ed.fsm.States, newName)
@@ -400,7 +319,6 @@ func (ed *Editor) pasteFromClipboard() {
 	}
 
 	// Add transitions with renamed states and symbols
-	transAdded := 0
 	for _, t := range pastedFSM.Transitions {
 		newFrom := stateRename[t.From]
 		newTo := make([]string, len(t.To))
@@ -441,7 +359,6 @@ func (ed *Editor) pasteFromClipboard() {
 	}
 
 	// Add nets with renamed state references
-	netsAdded := 0
 	for _, net := range pastedFSM.Nets {
 		newEndpoints := make([]fsm.NetEndpoint, len(net.Endpoints))
 		for i, ep := range net.Endpoints {
@@ -460,7 +377,6 @@ func (ed *Editor) pasteFromClipboard() {
 			Name:      netName,
 			Endpoints: newEndpoints,
 		})
-		netsAdded++
 	}
 
 	// Note: We don't merge accepting states or initial state from pasted FSM
@@ -473,23 +389,18 @@ func (ed *Editor) pasteFromClipboard() {
 	ed.updateMenuItems()
 
 	// Count renamed states for message
-	renamed := 0
 	for old, new := range stateRename {
 		if old != new {
 			renamed++
 		}
 	}
-
-	msg := fmt.Sprintf("Pasted %d states, %d transitions", statesAdded, transAdded)
-	if renamed > 0 {
-		msg += fmt.Sprintf(" (%d renamed)", renamed)
-	}
-	ed.showMessage(msg, MsgSuccess)
+	return statesAdded, transAdded, renamed
 }
 
 func (ed *Editor) addStateAtCursor() {
 	ed.inputPrompt = "State name: "
 	ed.inputBuffer = fmt.Sprintf("S%d", len(ed.fsm.States))
+	ed.inputValidate = ed.nameValidator("state", ed.fsm.States, "")
 	ed.inputAction = func(name string) {
 		if name == "" {
 			ed.mode = ModeCanvas
@@ -503,7 +414,7 @@ func (ed *Editor) addStateAtCursor() {
 				return
 			}
 		}
-		ed.saveSnapshot()
+		ed.saveSnapshot("Added state " + name)
 		ed.fsm.AddState(name)
 		ed.states = append(ed.states, StatePos{
 			Name: name,
@@ -543,7 +454,7 @@ func (ed *Editor) addStateAtPosition(posX, posY int) {
 		name = fmt.Sprintf("S%d", len(ed.fsm.States)+1)
 	}
 
-	ed.saveSnapshot()
+	ed.saveSnapshot("Added state " + name)
 	ed.fsm.AddState(name)
 	ed.states = append(ed.states, StatePos{
 		Name: name,
@@ -567,6 +478,7 @@ func (ed *Editor) editStateName(stateIdx int) {
 	oldName := ed.states[stateIdx].Name
 	ed.inputPrompt = "Rename state: "
 	ed.inputBuffer = oldName
+	ed.inputValidate = ed.nameValidator("state", ed.fsm.States, oldName)
 	ed.inputAction = func(newName string) {
 		if newName == "" || newName == oldName {
 			ed.mode = ModeCanvas
@@ -580,52 +492,15 @@ func (ed *Editor) editStateName(stateIdx int) {
 				return
 			}
 		}
-		ed.saveSnapshot()
-
-		// Update state name in FSM
-		for i, s := range ed.fsm.States {
-			if s == oldName {
-				ed.fsm.States[i] = newName
-				break
-			}
-		}
-
-		// Update initial state if needed
-		if ed.fsm.Initial == oldName {
-			ed.fsm.Initial = newName
-		}
+		ed.saveSnapshot("Renamed " + oldName + " to " + newName)
 
-		// Update accepting states
-		for i, s := range ed.fsm.Accepting {
-			if s == oldName {
-				ed.fsm.Accepting[i] = newName
-			}
-		}
-
-		// Update transitions
-		for i := range ed.fsm.Transitions {
-			if ed.fsm.Transitions[i].From == oldName {
-				ed.fsm.Transitions[i].From = newName
-			}
-			// To is a slice
-			for j, to := range ed.fsm.Transitions[i].To {
-				if to == oldName {
-					ed.fsm.Transitions[i].To[j] = newName
-				}
-			}
-		}
-
-		// Update Moore outputs (StateOutputs)
-		if ed.fsm.StateOutputs != nil {
-			if out, ok := ed.fsm.StateOutputs[oldName]; ok {
-				delete(ed.fsm.StateOutputs, oldName)
-				ed.fsm.StateOutputs[newName] = out
-			}
+		// Rename everywhere the machine refers to the state
+		if err := ed.fsm.RenameState(oldName, newName); err != nil {
+			ed.showMessage(err.Error(), MsgError)
+			ed.mode = ModeCanvas
+			return
 		}
 
-		// Cascade rename through nets
-		ed.fsm.CascadeRenameState(oldName, newName)
-
 		// Update position record
 		ed.states[stateIdx].Name = newName
 
@@ -638,8 +513,8 @@ func (ed *Editor) editStateName(stateIdx int) {
 
 func (ed *Editor) deleteSelected() {
 	if ed.selectedState >= 0 && ed.selectedState < len(ed.states) {
-		ed.saveSnapshot()
 		name := ed.states[ed.selectedState].Name
+		ed.saveSnapshot("Deleted state " + name)
 		// Remove from FSM
 		newStates := make([]string, 0)
 		for _, s := range ed.fsm.States {
@@ -687,6 +562,7 @@ func (ed *Editor) deleteSelected() {
 
 		// Remove from state outputs
 		delete(ed.fsm.StateOutputs, name)
+		delete(ed.fsm.StateMetadata, name)
 
 		// Cascade delete through nets
 		ed.fsm.CascadeDeleteState(name)
@@ -709,12 +585,70 @@ func (ed *Editor) cycleSelection() {
 	}
 }
 
+// arrangeStates moves every state to the position chosen by the
+// auto-layout engine selected in Settings, as if the machine had been
+// opened without a saved layout.
+func (ed *Editor) arrangeStates() {
+	if len(ed.states) == 0 {
+		ed.showMessage("Canvas is empty - nothing to arrange", MsgError)
+		return
+	}
+	w, h := 80, 24
+	if ed.screen != nil {
+		w, h = ed.screen.Size()
+		w = w - ed.sidebarWidth - 5
+		h = h - 4
+	}
+	engine := ed.layoutEngine()
+	positions := fsmfile.EngineLayoutTUI(ed.fsm, engine, w, h)
+
+	ed.saveSnapshot("Arranged states")
+	for i := range ed.states {
+		if pos, ok := positions[ed.states[i].Name]; ok {
+			ed.states[i].X = pos[0]
+			ed.states[i].Y = pos[1]
+		}
+	}
+	ed.canvasOffsetX = 0
+	ed.canvasOffsetY = 0
+	ed.modified = true
+	ed.showMessage("Arranged states ("+engine.Name()+" layout)", MsgSuccess)
+}
+
+// placeStates returns positions for f's states: those in saved stay where
+// they are, and the rest go next to the states they have transitions
+// with, so that a state added outside the canvas, in the text pane or by
+// editing the file, does not disturb an arrangement.
+func (ed *Editor) placeStates(f *fsm.FSM, saved map[string][2]int) []StatePos {
+	w, h := 80, 24
+	if ed.screen != nil {
+		w, h = ed.screen.Size()
+		w = w - ed.sidebarWidth - 5
+		h = h - 4
+	}
+	positions := fsmfile.IncrementalLayoutTUI(f, saved, w, h)
+	states := make([]StatePos, len(f.States))
+	for i, name := range f.States {
+		p := positions[name]
+		states[i] = StatePos{Name: name, X: p[0], Y: p[1]}
+	}
+	return states
+}
+
+// layoutPositions returns the state positions saved in l.
+func layoutPositions(l *fsmfile.Layout) map[string][2]int {
+	positions := make(map[string][2]int, len(l.States))
+	for name, sl := range l.States {
+		positions[name] = [2]int{sl.X, sl.Y}
+	}
+	return positions
+}
+
 func (ed *Editor) startMoveMode() {
 	if ed.selectedState < 0 || ed.selectedState >= len(ed.states) {
 		return
 	}
 	// Use the same dragging mechanism as mouse, but keyboard-driven
-	ed.saveSnapshot()
 	ed.dragging = true
 	ed.dragStateIdx = ed.selectedState
 	ed.dragOffsetX = 0
@@ -736,22 +670,20 @@ func (ed *Editor) handleMoveKey(ev *tcell.EventKey) bool {
 
 	switch ev.Key() {
 	case tcell.KeyEscape:
-		// Restore original position and undo the snapshot
+		// Restore original position; nothing was recorded for undo
 		ed.states[ed.dragStateIdx].X = ed.moveOrigX
 		ed.states[ed.dragStateIdx].Y = ed.moveOrigY
 		ed.dragging = false
 		ed.mode = ModeCanvas
-		// Pop the snapshot we saved
-		if len(ed.undoStack) > 0 {
-			ed.undoStack = ed.undoStack[:len(ed.undoStack)-1]
-		}
 		ed.showMessage("Move cancelled", MsgInfo)
 	case tcell.KeyEnter:
-		// Confirm move - snapshot already saved
+		// Confirm move, recording it for undo
 		ed.dragging = false
-		ed.modified = true
 		ed.mode = ModeCanvas
-		ed.showMessage("State moved", MsgInfo)
+		if ed.commitMove(ed.dragStateIdx, ed.moveOrigX, ed.moveOrigY) {
+			ed.modified = true
+			ed.showMessage("State moved", MsgInfo)
+		}
 	case tcell.KeyUp:
 		if ed.states[ed.dragStateIdx].Y > 0 {
 			ed.states[ed.dragStateIdx].Y--
@@ -941,22 +873,42 @@ func (ed *Editor) completeSelectInput() {
 		ed.mode = ModeSelectOutput
 	} else {
 		// Add transition
-		ed.saveSnapshot()
+		ed.saveSnapshot(fmt.Sprintf("Added transition %s → %s", ed.pendingTransFrom, ed.pendingTransTo))
 		ed.fsm.AddTransition(ed.pendingTransFrom, inputPtr, []string{ed.pendingTransTo}, nil)
 		ed.modified = true
-		ed.showMessage(fmt.Sprintf("Added transition: %s -> %s", ed.pendingTransFrom, ed.pendingTransTo), MsgSuccess)
+		if inputPtr == nil && ed.fsm.Type == fsm.TypeDFA {
+			ed.showMessage(fmt.Sprintf("Added ε-transition %s -> %s, which a DFA cannot have: make it an NFA", ed.pendingTransFrom, ed.pendingTransTo), MsgWarning)
+		} else {
+			ed.showMessage(fmt.Sprintf("Added transition: %s -> %s", ed.pendingTransFrom, ed.pendingTransTo), MsgSuccess)
+		}
 		ed.mode = ModeCanvas
 	}
 }
 
+// toggleClosure turns the highlighting of the selected state's epsilon
+// closure, the states an NFA entering it is also in, on or off.
+func (ed *Editor) toggleClosure() {
+	ed.showClosure = !ed.showClosure
+	if !ed.showClosure {
+		ed.showMessage("ε-closures hidden", MsgInfo)
+		return
+	}
+	if ed.selectedState < 0 || ed.selectedState >= len(ed.states) {
+		ed.showMessage("ε-closures shown: select a state", MsgInfo)
+		return
+	}
+	closure := ed.fsm.EpsilonClosure(ed.states[ed.selectedState].Name)
+	ed.showMessage("ε-closure: {"+strings.Join(closure, ", ")+"}", MsgInfo)
+}
+
 func (ed *Editor) completeSelectOutput() {
 	out := ed.fsm.OutputAlphabet[ed.menuSelected]
 	
-	ed.saveSnapshot()
 	if ed.mooreOutputMode {
 		// Setting Moore output for a state
 		if ed.selectedState >= 0 && ed.selectedState < len(ed.states) {
 			name := ed.states[ed.selectedState].Name
+			ed.saveSnapshot(fmt.Sprintf("Set %s output to %s", name, out))
 			ed.fsm.SetStateOutput(name, out)
 			ed.modified = true
 			ed.showMessage(fmt.Sprintf("Set %s output to %s", name, out), MsgSuccess)
@@ -964,6 +916,7 @@ func (ed *Editor) completeSelectOutput() {
 		ed.mooreOutputMode = false
 	} else {
 		// Adding Mealy transition output
+		ed.saveSnapshot(fmt.Sprintf("Added transition %s → %s", ed.pendingTransFrom, ed.pendingTransTo))
 		ed.fsm.AddTransition(ed.pendingTransFrom, ed.pendingInput, []string{ed.pendingTransTo}, &out)
 		ed.modified = true
 		ed.showMessage(fmt.Sprintf("Added transition: %s -> %s", ed.pendingTransFrom, ed.pendingTransTo), MsgSuccess)
@@ -974,12 +927,13 @@ func (ed *Editor) completeSelectOutput() {
 func (ed *Editor) addInput() {
 	ed.inputPrompt = "Input symbol: "
 	ed.inputBuffer = ""
+	ed.inputValidate = ed.nameValidator("input", ed.fsm.Alphabet, "")
 	ed.inputAction = func(name string) {
 		if name == "" {
 			ed.mode = ModeCanvas
 			return
 		}
-		ed.saveSnapshot()
+		ed.saveSnapshot("Added input " + name)
 		ed.fsm.AddInput(name)
 		ed.modified = true
 		ed.showMessage("Added input: "+name, MsgSuccess)
@@ -996,12 +950,13 @@ func (ed *Editor) addOutput() {
 	}
 	ed.inputPrompt = "Output symbol: "
 	ed.inputBuffer = ""
+	ed.inputValidate = ed.nameValidator("output", ed.fsm.OutputAlphabet, "")
 	ed.inputAction = func(name string) {
 		if name == "" {
 			ed.mode = ModeCanvas
 			return
 		}
-		ed.saveSnapshot()
+		ed.saveSnapshot("Added output " + name)
 		ed.fsm.AddOutput(name)
 		ed.modified = true
 		ed.showMessage("Added output: "+name, MsgSuccess)
@@ -1012,8 +967,8 @@ func (ed *Editor) addOutput() {
 
 func (ed *Editor) setInitialState() {
 	if ed.selectedState >= 0 && ed.selectedState < len(ed.states) {
-		ed.saveSnapshot()
 		name := ed.states[ed.selectedState].Name
+		ed.saveSnapshot("Set initial state " + name)
 		ed.fsm.SetInitial(name)
 		ed.modified = true
 		ed.showMessage("Initial state: "+name, MsgSuccess)
@@ -1022,8 +977,8 @@ func (ed *Editor) setInitialState() {
 
 func (ed *Editor) toggleAccepting() {
 	if ed.selectedState >= 0 && ed.selectedState < len(ed.states) {
-		ed.saveSnapshot()
 		name := ed.states[ed.selectedState].Name
+		ed.saveSnapshot("Toggled accepting on " + name)
 		isAcc := false
 		for _, a := range ed.fsm.Accepting {
 			if a == name {
@@ -1076,7 +1031,7 @@ func (ed *Editor) setLinkedMachine() {
 		ed.inputBuffer = ""
 		ed.inputAction = func(answer string) {
 			if answer == "y" || answer == "Y" {
-				ed.saveSnapshot()
+				ed.saveSnapshot("Unlinked " + name)
 				ed.fsm.SetLinkedMachine(name, "")
 				ed.showMessage(name+" unlinked", MsgSuccess)
 				ed.modified = true
@@ -26,6 +26,10 @@ func (ed *Editor) runAnalysis() {
 			issues = append(issues, fmt.Sprintf("%d nondet", len(w.States)))
 		case "incomplete":
 			issues = append(issues, fmt.Sprintf("%d incomplete", len(w.States)))
+		case "trap":
+			issues = append(issues, fmt.Sprintf("%d trapped", len(w.States)))
+		case "livelock":
+			issues = append(issues, fmt.Sprintf("livelock of %d", len(w.States)))
 		case "unused_input":
 			issues = append(issues, "unused inputs")
 		case "unused_output":
@@ -42,6 +42,7 @@ func (ed *Editor) renderView() {
 
 			opts := fsmfile.DefaultSVGOptions()
 			opts.Title = title
+			opts.LayoutEngine = ed.layoutEngine()
 			svg := fsmfile.GenerateSVGNative(ed.fsm, opts)
 
 			if err := os.WriteFile(tmpPath, []byte(svg), 0644); err != nil {
@@ -60,6 +61,7 @@ func (ed *Editor) renderView() {
 
 			opts := fsmfile.DefaultPNGOptions()
 			opts.Title = title
+			opts.LayoutEngine = ed.layoutEngine()
 			if err := fsmfile.RenderPNG(ed.fsm, tmpFile, opts); err != nil {
 				tmpFile.Close()
 				ed.showMessage("Failed to generate PNG: "+err.Error(), MsgError)
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
 )
 
 // --- addStateAtPosition ---
@@ -231,6 +232,110 @@ func TestCycleSelection_EmptyStates(t *testing.T) {
 	ed.cycleSelection()
 }
 
+// --- arrangeStates ---
+
+func TestArrangeStates(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"a", "b", "c", "d"})
+	ed.fsm.Alphabet = []string{"x"}
+	ed.fsm.AddTransition("a", strPtr("x"), []string{"b"}, nil)
+	ed.fsm.AddTransition("b", strPtr("x"), []string{"c"}, nil)
+	ed.fsm.AddTransition("c", strPtr("x"), []string{"d"}, nil)
+	before := append([]StatePos(nil), ed.states...)
+
+	ed.config.Layout = "circular"
+	ed.arrangeStates()
+
+	want := fsmfile.EngineLayoutTUI(ed.fsm, fsmfile.EngineCircular, 80, 24) // no screen: default size
+	for _, sp := range ed.states {
+		if p := want[sp.Name]; sp.X != p[0] || sp.Y != p[1] {
+			t.Errorf("%s at (%d,%d), want %v", sp.Name, sp.X, sp.Y, p)
+		}
+	}
+	if !ed.modified {
+		t.Error("arranging should mark the machine modified")
+	}
+
+	ed.undo()
+	for i, sp := range ed.states {
+		if sp != before[i] {
+			t.Errorf("after undo %s at (%d,%d), want (%d,%d)", sp.Name, sp.X, sp.Y, before[i].X, before[i].Y)
+		}
+	}
+}
+
+func TestArrangeStates_Empty(t *testing.T) {
+	ed := newTestEditor()
+	ed.arrangeStates()
+	if ed.messageType != MsgError {
+		t.Error("arranging an empty canvas should report an error")
+	}
+	if len(ed.undoStack) != 0 {
+		t.Error("arranging an empty canvas should not save a snapshot")
+	}
+}
+
+// --- epsilon transitions ---
+
+func TestCompleteSelectInput_EpsilonInDFAWarns(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"a", "b"})
+	ed.fsm.Alphabet = []string{"x"}
+	ed.pendingTransFrom, ed.pendingTransTo = "a", "b"
+	ed.menuSelected = len(ed.fsm.Alphabet) // ε
+	ed.completeSelectInput()
+	if len(ed.fsm.Transitions) != 1 || ed.fsm.Transitions[0].Input != nil {
+		t.Fatalf("transitions %+v", ed.fsm.Transitions)
+	}
+	if ed.messageType != MsgWarning {
+		t.Errorf("adding ε to a DFA: %q, want a warning", ed.message)
+	}
+
+	ed.fsm.Type = fsm.TypeNFA
+	ed.pendingTransFrom, ed.pendingTransTo = "b", "a"
+	ed.menuSelected = len(ed.fsm.Alphabet)
+	ed.completeSelectInput()
+	if ed.messageType != MsgSuccess {
+		t.Errorf("adding ε to an NFA: %q, want success", ed.message)
+	}
+}
+
+func TestToggleClosure(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"a", "b", "c"})
+	ed.fsm.Type = fsm.TypeNFA
+	ed.fsm.AddTransition("a", nil, []string{"b"}, nil)
+	x := "x"
+	ed.fsm.AddTransition("b", &x, []string{"c"}, nil)
+
+	if ed.closureHighlight() != nil {
+		t.Error("closure highlighted before toggling it on")
+	}
+	ed.toggleClosure()
+	if ed.message != "ε-closure: {a, b}" {
+		t.Errorf("message %q", ed.message)
+	}
+	if got := ed.closureHighlight(); len(got) != 2 || !got["a"] || !got["b"] {
+		t.Errorf("closure %v, want a and b", got)
+	}
+	ed.selectedState = -1
+	if ed.closureHighlight() != nil {
+		t.Error("closure highlighted with no state selected")
+	}
+	ed.toggleClosure()
+	if ed.showClosure {
+		t.Error("second toggle left closures on")
+	}
+}
+
+func TestDashedCells(t *testing.T) {
+	var got []rune
+	set := dashedCells(func(x, y int, r rune) { got = append(got, r) })
+	for _, r := range "─│→ε" {
+		set(0, 0, r)
+	}
+	if string(got) != "╌╎→ε" {
+		t.Errorf("dashed %q", string(got))
+	}
+}
+
 // --- findStateAtCursor ---
 
 func TestFindStateAtCursor_Hit(t *testing.T) {
@@ -119,24 +119,20 @@ func (ed *Editor) handleImportFile(path string) {
 		}
 		baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 		ed.importSingleMachine(baseName, f, layout)
-	case ".json":
-		data, err := os.ReadFile(path)
-		if err != nil {
-			ed.showMessage("Error: "+err.Error(), MsgError)
+	default:
+		if !fsmfile.IsMachineFile(path) {
+			ed.showMessage("Unsupported file type", MsgError)
 			ed.mode = ModeMenu
 			return
 		}
-		f, err := fsmfile.ParseJSON(data)
+		f, layout, err := fsmfile.ReadMachineFile(path)
 		if err != nil {
 			ed.showMessage("Error: "+err.Error(), MsgError)
 			ed.mode = ModeMenu
 			return
 		}
 		baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
-		ed.importSingleMachine(baseName, f, nil)
-	default:
-		ed.showMessage("Unsupported file type", MsgError)
-		ed.mode = ModeMenu
+		ed.importSingleMachine(baseName, f, layout)
 	}
 }
 
@@ -241,15 +237,7 @@ func (ed *Editor) addMachineToBundle(name string, f *fsm.FSM, layout *fsmfile.La
 	// Generate state positions from layout or auto-layout
 	states := make([]StatePos, len(f.States))
 	if layout != nil && len(layout.States) > 0 {
-		for i, sName := range f.States {
-			if sl, ok := layout.States[sName]; ok {
-				states[i] = StatePos{Name: sName, X: sl.X, Y: sl.Y}
-			} else {
-				col := i % 5
-				row := i / 5
-				states[i] = StatePos{Name: sName, X: 5 + col*15, Y: 2 + row*4}
-			}
-		}
+		states = ed.placeStates(f, layoutPositions(layout))
 		if layout.Editor.CanvasOffsetX != 0 || layout.Editor.CanvasOffsetY != 0 {
 			ed.bundleOffsets[name] = [2]int{layout.Editor.CanvasOffsetX, layout.Editor.CanvasOffsetY}
 		}
@@ -260,7 +248,7 @@ func (ed *Editor) addMachineToBundle(name string, f *fsm.FSM, layout *fsmfile.La
 			w = w - ed.sidebarWidth - 5
 			h = h - 4
 		}
-		autoPositions := fsmfile.SmartLayoutTUI(f, w, h)
+		autoPositions := fsmfile.EngineLayoutTUI(f, ed.layoutEngine(), w, h)
 		for i, sName := range f.States {
 			if pos, ok := autoPositions[sName]; ok {
 				states[i] = StatePos{Name: sName, X: pos[0], Y: pos[1]}
@@ -341,6 +329,7 @@ func (ed *Editor) loadMachineFromBundle(machineName string) error {
 				ed.canvasOffsetY = 0
 			}
 			ed.selectedState = -1
+			ed.markedStates = nil
 			ed.mode = ModeCanvas
 			return nil
 		}
@@ -363,23 +352,7 @@ func (ed *Editor) loadMachineFromBundle(machineName string) error {
 		ed.canvasOffsetX = layout.Editor.CanvasOffsetX
 		ed.canvasOffsetY = layout.Editor.CanvasOffsetY
 
-		for i, name := range f.States {
-			if sl, ok := layout.States[name]; ok {
-				ed.states[i] = StatePos{
-					Name: name,
-					X:    sl.X,
-					Y:    sl.Y,
-				}
-			} else {
-				col := i % 5
-				row := i / 5
-				ed.states[i] = StatePos{
-					Name: name,
-					X:    5 + col*15,
-					Y:    2 + row*4,
-				}
-			}
-		}
+		ed.states = ed.placeStates(f, layoutPositions(layout))
 	} else {
 		// Generate smart layout
 		w, h := 80, 24
@@ -389,7 +362,7 @@ func (ed *Editor) loadMachineFromBundle(machineName string) error {
 			h = h - 4
 		}
 
-		autoPositions := fsmfile.SmartLayoutTUI(f, w, h)
+		autoPositions := fsmfile.EngineLayoutTUI(f, ed.layoutEngine(), w, h)
 		for i, name := range f.States {
 			if pos, ok := autoPositions[name]; ok {
 				ed.states[i] = StatePos{
@@ -413,6 +386,7 @@ func (ed *Editor) loadMachineFromBundle(machineName string) error {
 	ed.saveMachineToCache()
 	
 	ed.selectedState = -1
+	ed.markedStates = nil
 	ed.mode = ModeCanvas
 	return nil
 }
@@ -591,6 +565,7 @@ func (ed *Editor) loadMachineFromCache(machineName string) {
 	}
 	ed.currentMachine = machineName
 	ed.selectedState = -1
+	ed.markedStates = nil
 }
 
 // generateStatesForMachine creates state positions for a machine.
@@ -615,17 +590,7 @@ func (ed *Editor) generateStatesForMachine(machineName string) []StatePos {
 				ed.canvasOffsetY = offsets[1]
 			}
 			
-			states := make([]StatePos, len(f.States))
-			for i, name := range f.States {
-				if sl, ok := layout.States[name]; ok {
-					states[i] = StatePos{Name: name, X: sl.X, Y: sl.Y}
-				} else {
-					col := i % 5
-					row := i / 5
-					states[i] = StatePos{Name: name, X: 5 + col*15, Y: 2 + row*4}
-				}
-			}
-			return states
+			return ed.placeStates(f, layoutPositions(layout))
 		}
 	}
 	
@@ -638,7 +603,7 @@ func (ed *Editor) generateStatesForMachine(machineName string) []StatePos {
 	}
 	
 	states := make([]StatePos, len(f.States))
-	autoPositions := fsmfile.SmartLayoutTUI(f, w, h)
+	autoPositions := fsmfile.EngineLayoutTUI(f, ed.layoutEngine(), w, h)
 	for i, name := range f.States {
 		if pos, ok := autoPositions[name]; ok {
 			states[i] = StatePos{Name: name, X: pos[0], Y: pos[1]}
@@ -736,7 +701,7 @@ func (ed *Editor) offerCreateMachineForLink(stateName string) {
 			ed.updateMenuItems()
 
 			// Set the link.
-			ed.saveSnapshot()
+			ed.saveSnapshot("Linked " + stateName + " to " + name)
 			ed.fsm.SetLinkedMachine(stateName, name)
 			ed.modified = true
 			ed.showMessage(stateName+" → "+name+" (new machine created)", MsgSuccess)
@@ -751,3 +716,149 @@ func (ed *Editor) offerCreateMachineForLink(stateName string) {
 	}
 	ed.mode = ModeInput
 }
+
+// toggleMark adds a state to the states marked for grouping, or removes
+// it if it is already marked.
+func (ed *Editor) toggleMark(stateIdx int) {
+	if stateIdx < 0 || stateIdx >= len(ed.states) {
+		return
+	}
+	name := ed.states[stateIdx].Name
+	if ed.markedStates == nil {
+		ed.markedStates = make(map[string]bool)
+	}
+	if ed.markedStates[name] {
+		delete(ed.markedStates, name)
+	} else {
+		ed.markedStates[name] = true
+	}
+	ed.showMessage(fmt.Sprintf("%d state(s) marked - J to group", len(ed.markedStateNames())), MsgInfo)
+}
+
+// markedStateNames returns the marked states in the machine's order, or
+// the selected state if none are marked.
+func (ed *Editor) markedStateNames() []string {
+	var names []string
+	for _, s := range ed.fsm.States {
+		if ed.markedStates[s] {
+			names = append(names, s)
+		}
+	}
+	if len(names) == 0 && ed.selectedState >= 0 && ed.selectedState < len(ed.states) {
+		names = []string{ed.states[ed.selectedState].Name}
+	}
+	return names
+}
+
+// groupMarkedStates prompts for a name and groups the marked states
+// into a new machine of that name, linked from a composite state of the
+// same name. Promotes to a bundle first if needed.
+func (ed *Editor) groupMarkedStates() {
+	names := ed.markedStateNames()
+	if len(names) == 0 {
+		ed.showMessage("Mark states with + or Ctrl+click first", MsgInfo)
+		return
+	}
+	ed.inputPrompt = fmt.Sprintf("Group %d state(s) as: ", len(names))
+	ed.inputBuffer = ed.uniqueGroupName()
+	ed.inputAction = func(name string) {
+		ed.mode = ModeCanvas
+		if name == "" {
+			ed.showMessage("Cancelled", MsgInfo)
+			return
+		}
+		ed.promoteIfNeeded(func() {
+			ed.mode = ModeCanvas
+			if err := ed.groupStates(names, name); err != nil {
+				ed.showMessage("Error: "+err.Error(), MsgError)
+				return
+			}
+			ed.showMessage(fmt.Sprintf("Grouped %d state(s) into %s", len(names), name), MsgSuccess)
+		})
+	}
+	ed.mode = ModeInput
+}
+
+// uniqueGroupName proposes a name that is neither a state nor a machine.
+func (ed *Editor) uniqueGroupName() string {
+	name := "group"
+	for i := 2; ed.fsm.HasState(name) || ed.machineNameExists(name); i++ {
+		name = fmt.Sprintf("group_%d", i)
+	}
+	return name
+}
+
+// groupStates moves the named states into a new machine called name and
+// replaces them with a composite state of the same name linked to it
+// (see fsm.FSM.GroupStates). The composite takes the centre of the
+// grouped states, which keep their arrangement in the new machine.
+func (ed *Editor) groupStates(names []string, name string) error {
+	if ed.machineNameExists(name) {
+		return fmt.Errorf("machine %q already exists", name)
+	}
+	parent := ed.fsm.Clone()
+	child, err := parent.GroupStates(names, name, name)
+	if err != nil {
+		return err
+	}
+
+	grouped := make(map[string]bool, len(names))
+	for _, n := range names {
+		grouped[n] = true
+	}
+	positions := make(map[string]StatePos, len(ed.states))
+	var inner []StatePos
+	sumX, sumY := 0, 0
+	minX, minY := CanvasMaxWidth, CanvasMaxHeight
+	for _, sp := range ed.states {
+		if !grouped[sp.Name] {
+			positions[sp.Name] = sp
+			continue
+		}
+		inner = append(inner, sp)
+		sumX += sp.X
+		sumY += sp.Y
+		minX = min(minX, sp.X)
+		minY = min(minY, sp.Y)
+	}
+	if len(inner) > 0 {
+		positions[name] = StatePos{Name: name, X: sumX / len(inner), Y: sumY / len(inner)}
+	}
+	layout := &fsmfile.Layout{States: make(map[string]fsmfile.StateLayout, len(inner))}
+	for _, sp := range inner {
+		layout.States[sp.Name] = fsmfile.StateLayout{X: 5 + sp.X - minX, Y: 2 + sp.Y - minY}
+	}
+
+	ed.saveSnapshot(fmt.Sprintf("Grouped %d states into %s", len(names), name))
+	*ed.fsm = *parent
+	ed.states = make([]StatePos, len(ed.fsm.States))
+	ed.selectedState = -1
+	for i, s := range ed.fsm.States {
+		sp, ok := positions[s]
+		if !ok {
+			sp = StatePos{Name: s, X: 5 + (i%5)*15, Y: 2 + (i/5)*4}
+		}
+		ed.states[i] = sp
+		if s == name {
+			ed.selectedState = i
+		}
+	}
+	ed.markedStates = nil
+	ed.modified = true
+	ed.saveMachineToCache()
+	ed.addMachineToBundle(name, child, layout)
+	return nil
+}
+
+// linkedStateCount returns the number of states in a machine of the
+// bundle, for showing on the states linked to it.
+func (ed *Editor) linkedStateCount(machine string) (int, bool) {
+	f, ok := ed.bundleFSMs[machine]
+	if !ok || f == nil {
+		return 0, false
+	}
+	if machine == ed.currentMachine {
+		f = ed.fsm
+	}
+	return len(f.States), true
+}
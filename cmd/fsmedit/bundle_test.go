@@ -516,9 +516,9 @@ func TestUndoStack_PerMachineIsolation(t *testing.T) {
 	// Build up undo history on m1
 	ed.saveMachineToCache()
 	ed.loadMachineFromCache("m1")
-	ed.saveSnapshot() // undo entry 1
+	ed.saveSnapshot("edit") // undo entry 1
 	ed.fsm.States = append(ed.fsm.States, "m1_extra")
-	ed.saveSnapshot() // undo entry 2
+	ed.saveSnapshot("edit") // undo entry 2
 	if len(ed.undoStack) != 2 {
 		t.Fatalf("m1 should have 2 undo entries, got %d", len(ed.undoStack))
 	}
@@ -531,7 +531,7 @@ func TestUndoStack_PerMachineIsolation(t *testing.T) {
 	}
 
 	// Push one undo on m2
-	ed.saveSnapshot()
+	ed.saveSnapshot("edit")
 	ed.saveMachineToCache()
 
 	// Back to m1 — should still have 2
@@ -1008,3 +1008,70 @@ func TestPromoteThenAddMachine(t *testing.T) {
 		t.Errorf("original should have 1 transition, got %d", len(ed.fsm.Transitions))
 	}
 }
+
+// --- Grouping states into a composite ---
+
+func TestGroupStates(t *testing.T) {
+	ed := newTestBundle([]string{"root"})
+	ed.fsm.States = append(ed.fsm.States, "root_s2")
+	ed.states = append(ed.states, StatePos{Name: "root_s2", X: 30, Y: 9})
+	ed.fsm.AddTransition("root_s1", strPtr("b"), []string{"root_s2"}, nil)
+
+	ed.toggleMark(1)
+	ed.toggleMark(2)
+	names := ed.markedStateNames()
+	if fmt.Sprint(names) != "[root_s1 root_s2]" {
+		t.Fatalf("marked %v", names)
+	}
+	if err := ed.groupStates(names, "inner"); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(ed.fsm.States) != "[root_s0 inner]" || ed.fsm.GetLinkedMachine("inner") != "inner" {
+		t.Errorf("parent states %v, links %v", ed.fsm.States, ed.fsm.LinkedMachines)
+	}
+	if ed.bundleFSMs["root"] != ed.fsm {
+		t.Error("cache does not hold the edited machine")
+	}
+	if len(ed.states) != 2 || ed.states[1] != (StatePos{Name: "inner", X: 25, Y: 7}) {
+		t.Errorf("positions %v; composite should be at the centre of the group", ed.states)
+	}
+	if ed.selectedState != 1 || ed.markedStates != nil {
+		t.Errorf("selected %d, marked %v", ed.selectedState, ed.markedStates)
+	}
+	child := ed.bundleFSMs["inner"]
+	if child == nil || len(child.States) != 2 || len(child.Transitions) != 1 {
+		t.Fatalf("child machine %+v", child)
+	}
+	if pos := ed.bundleStates["inner"]; pos[0] != (StatePos{Name: "root_s1", X: 5, Y: 2}) {
+		t.Errorf("child positions %v", pos)
+	}
+	if got := ed.compositeLabel("inner"); got != "→inner (2 states)" {
+		t.Errorf("composite label %q", got)
+	}
+
+	ed.undo()
+	if len(ed.fsm.States) != 3 {
+		t.Errorf("undo left states %v", ed.fsm.States)
+	}
+}
+
+func TestGroupStates_NameTaken(t *testing.T) {
+	ed := newTestBundle([]string{"root", "child"})
+	before := ed.fsm.Clone()
+	if err := ed.groupStates([]string{"root_s1"}, "child"); err == nil {
+		t.Error("grouped into an existing machine")
+	}
+	if err := ed.groupStates([]string{"root_s1"}, "root_s0"); err == nil {
+		t.Error("grouped under an existing state name")
+	}
+	if !ed.fsm.StructurallyEqual(before) || len(ed.undoStack) != 0 {
+		t.Error("failed grouping changed the machine")
+	}
+
+	// With nothing marked, the selected state is grouped.
+	ed.selectedState = 1
+	if names := ed.markedStateNames(); fmt.Sprint(names) != "[root_s1]" {
+		t.Errorf("marked %v", names)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
 )
 
 
@@ -16,6 +19,9 @@ type Config struct {
 	LastDir     string // last used directory
 	Vocabulary  string // "fsm" (default), "circuit", "generic"
 	ClassLibDir string // directory for .classes.json library files
+	Layout      string // auto-layout engine: "auto", "sugiyama", "force", "circular"
+	NameRule    string // naming rule for typed names: "identifier", "relaxed", "any"
+	NameMaxLength int  // longest name allowed, in characters; 0 for no limit
 }
 
 // DefaultConfig returns default configuration
@@ -26,6 +32,9 @@ func DefaultConfig() Config {
 		FileType:   "png",
 		LastDir:    cwd,
 		Vocabulary: "fsm",
+		Layout:     "auto",
+		NameRule:   "identifier",
+		NameMaxLength: 32,
 	}
 }
 
@@ -76,6 +85,20 @@ func LoadConfig() Config {
 			}
 		case "class_lib_dir":
 			cfg.ClassLibDir = val
+		case "layout":
+			if _, ok := fsmfile.LayoutEngineByName(val); ok && val != "" {
+				cfg.Layout = val
+			}
+		case "name_rule":
+			for _, r := range nameRules {
+				if val == r {
+					cfg.NameRule = val
+				}
+			}
+		case "name_max_length":
+			if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+				cfg.NameMaxLength = n
+			}
 		}
 	}
 	return cfg
@@ -83,7 +106,7 @@ func LoadConfig() Config {
 
 // SaveConfig saves configuration to TOML file
 func SaveConfig(cfg Config) error {
-	content := fmt.Sprintf("# fsmedit configuration\nrenderer = \"%s\"\nfile_type = \"%s\"\nlast_dir = \"%s\"\nvocabulary = \"%s\"\nclass_lib_dir = \"%s\"\n",
-		cfg.Renderer, cfg.FileType, cfg.LastDir, cfg.Vocabulary, cfg.ClassLibDir)
+	content := fmt.Sprintf("# fsmedit configuration\nrenderer = \"%s\"\nfile_type = \"%s\"\nlast_dir = \"%s\"\nvocabulary = \"%s\"\nclass_lib_dir = \"%s\"\nlayout = \"%s\"\nname_rule = \"%s\"\nname_max_length = %d\n",
+		cfg.Renderer, cfg.FileType, cfg.LastDir, cfg.Vocabulary, cfg.ClassLibDir, cfg.Layout, cfg.NameRule, cfg.NameMaxLength)
 	return os.WriteFile(ConfigPath(), []byte(content), 0644)
 }
@@ -20,6 +20,9 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.LastDir == "" {
 		t.Error("default LastDir should not be empty")
 	}
+	if cfg.Layout != "auto" {
+		t.Errorf("default layout: expected 'auto', got %q", cfg.Layout)
+	}
 }
 
 func TestConfigPath_NotEmpty(t *testing.T) {
@@ -28,12 +28,17 @@ func (ed *Editor) draw() {
 	}
 
 	// Draw canvas and sidebar in canvas-related modes, even if empty
-	if ed.mode == ModeCanvas || ed.mode == ModeMove || 
+	if ed.mode == ModeCanvas || ed.mode == ModeMove || ed.mode == ModeAcceptance ||
 	   (ed.fsm != nil && len(ed.states) > 0) {
 		ed.drawCanvas(w, h)
 		ed.drawSidebar(w, h)
 	}
 
+	// The acceptance panel stays open over the canvas while editing
+	if ed.showAcceptance && (ed.mode == ModeCanvas || ed.mode == ModeMove || ed.mode == ModeAcceptance) {
+		ed.drawAcceptance(w, h)
+	}
+
 	switch ed.mode {
 	case ModeMenu:
 		ed.drawMenuOverlay(w, h)
@@ -106,6 +111,18 @@ func (ed *Editor) draw() {
 		ed.drawCanvas(w, h)
 		ed.drawSidebar(w, h)
 		ed.drawNetDetailPeerPicker(w, h)
+	case ModeText:
+		ed.drawCanvas(w, h)
+		ed.drawSidebar(w, h)
+		ed.drawTextPane(w, h)
+	case ModeTemplatePicker:
+		ed.drawCanvas(w, h)
+		ed.drawSidebar(w, h)
+		ed.drawTemplatePicker(w, h)
+	case ModeUndoHistory:
+		ed.drawCanvas(w, h)
+		ed.drawSidebar(w, h)
+		ed.drawUndoHistory(w, h)
 	}
 
 	// Check drawer animation completion.
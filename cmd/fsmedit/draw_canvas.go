@@ -9,6 +9,7 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
 )
 
 func (ed *Editor) drawCanvas(w, h int) {
@@ -30,7 +31,15 @@ func (ed *Editor) drawCanvas(w, h int) {
 		ed.drawNets(canvasW, canvasH)
 	}
 
+	// Draw composite boxes around linked states, under the states
+	for _, sp := range ed.states {
+		if ed.fsm.IsLinked(sp.Name) {
+			ed.drawCompositeBox(sp, canvasW, canvasH)
+		}
+	}
+
 	// Draw states LAST (on top of arcs)
+	closure := ed.closureHighlight()
 	for i, sp := range ed.states {
 		x := sp.X - ed.canvasOffsetX
 		y := sp.Y - ed.canvasOffsetY
@@ -41,24 +50,21 @@ func (ed *Editor) drawCanvas(w, h int) {
 
 		// Determine style
 		style := styleState
-		prefix := "○"
-		suffix := ""
-
 		isLinked := ed.fsm.IsLinked(sp.Name)
-		
 		if isLinked {
 			style = styleStateLinked
-			suffix = "↗" // Arrow indicating link to another machine
 		}
 		if ed.fsm.Initial == sp.Name {
 			style = styleStateInit
-			prefix = "→"
 		}
-		if ed.fsm.IsAccepting(sp.Name) {
-			if !isLinked {
-				style = styleStateAcc
-			}
-			suffix = "*"
+		if ed.fsm.IsAccepting(sp.Name) && !isLinked {
+			style = styleStateAcc
+		}
+		if ed.markedStates[sp.Name] {
+			style = styleStateMarked
+		}
+		if closure[sp.Name] {
+			style = styleStateClosure
 		}
 		if i == ed.selectedState {
 			style = styleStateSel
@@ -68,14 +74,14 @@ func (ed *Editor) drawCanvas(w, h int) {
 			style = styleDragging
 		}
 
-		label := fmt.Sprintf("%s[%s]%s", prefix, sp.Name, suffix)
-		ed.drawString(x, y, label, style)
+		ed.drawString(x, y, fsmfile.ASCIIStateLabel(ed.fsm, sp.Name), style)
 
 		// Draw linked machine name below state if linked
 		if isLinked {
-			targetMachine := ed.fsm.GetLinkedMachine(sp.Name)
-			if targetMachine != "" && y+1 < canvasH {
-				ed.drawString(x+2, y+1, "→"+targetMachine, styleStateLinked)
+			if y+1 < canvasH {
+				if sub := ed.compositeLabel(sp.Name); sub != "" {
+					ed.drawString(x+2, y+1, sub, styleStateLinked)
+				}
 			}
 		} else if ed.fsm.Type == fsm.TypeMoore {
 			// Draw Moore output if applicable
@@ -96,6 +102,55 @@ func (ed *Editor) drawCanvas(w, h int) {
 	ed.drawScrollIndicators(canvasW, canvasH)
 }
 
+// compositeLabel returns the line shown under a linked state: the
+// machine it links to and, if the machine is in the bundle, how many
+// states it has.
+func (ed *Editor) compositeLabel(state string) string {
+	target := ed.fsm.GetLinkedMachine(state)
+	if target == "" {
+		return ""
+	}
+	n, ok := ed.linkedStateCount(target)
+	if !ok {
+		return "→" + target
+	}
+	if n == 1 {
+		return fmt.Sprintf("→%s (1 state)", target)
+	}
+	return fmt.Sprintf("→%s (%d states)", target, n)
+}
+
+// drawCompositeBox draws a box around a linked state and the line under
+// it, showing it as a collapsed composite state.
+func (ed *Editor) drawCompositeBox(sp StatePos, canvasW, canvasH int) {
+	x := sp.X - ed.canvasOffsetX
+	y := sp.Y - ed.canvasOffsetY
+	// drawString advances one cell per byte, so byte lengths are the
+	// widths drawn.
+	width := len(fsmfile.ASCIIStateLabel(ed.fsm, sp.Name))
+	if sub := ed.compositeLabel(sp.Name); len(sub)+2 > width {
+		width = len(sub) + 2
+	}
+	left, right, top, bottom := x-1, x+width, y-1, y+2
+	set := func(cx, cy int, r rune) {
+		if cx >= 0 && cx < canvasW && cy >= 0 && cy < canvasH {
+			ed.screen.SetContent(cx, cy, r, nil, styleComposite)
+		}
+	}
+	for cx := left + 1; cx < right; cx++ {
+		set(cx, top, '─')
+		set(cx, bottom, '─')
+	}
+	for cy := top + 1; cy < bottom; cy++ {
+		set(left, cy, '│')
+		set(right, cy, '│')
+	}
+	set(left, top, '┌')
+	set(right, top, '┐')
+	set(left, bottom, '└')
+	set(right, bottom, '┘')
+}
+
 // drawScrollIndicators shows arrows at edges when content exists off-screen
 func (ed *Editor) drawScrollIndicators(canvasW, canvasH int) {
 	styleIndicator := tcell.StyleDefault.Foreground(tcell.ColorYellow).Bold(true)
@@ -234,8 +289,12 @@ func (ed *Editor) drawTransitions(canvasW, canvasH int) {
 				label += "/" + *t.Output
 			}
 
-			// Determine style - flash if this transition matches any flash criteria
+			// Determine style - flash if this transition matches any flash
+			// criteria; otherwise epsilon transitions are dimmed
 			arcStyle := lineStyle
+			if t.Input == nil && !ed.dragging {
+				arcStyle = styleTransEpsilon
+			}
 			if flashingInput != "" && t.Input != nil && *t.Input == flashingInput {
 				arcStyle = getFlashStyle(ed.flashInputTime)
 			} else if flashingOutput != "" && t.Output != nil && *t.Output == flashingOutput {
@@ -244,29 +303,25 @@ func (ed *Editor) drawTransitions(canvasW, canvasH int) {
 				arcStyle = getFlashStyle(ed.flashTransTime)
 			}
 
+			// Epsilon transitions are also dashed
+			set := ed.cells(arcStyle)
+			if t.Input == nil {
+				set = dashedCells(set)
+			}
+
 			// Self-loop
 			if t.From == to {
-				ed.drawSelfLoop(fromX, fromY-1, label, canvasW, canvasH, arcStyle)
+				fsmfile.DrawASCIISelfLoop(set, fromX, fromY-1, label, canvasW, canvasH)
 				continue
 			}
 
 			// Calculate offset for parallel arcs
 			key := normalizePairKey(t.From, to)
-			total := pairCount[key]
-			idx := pairIndex[key]
+			offset := fsmfile.ASCIIArcOffset(pairIndex[key], pairCount[key])
 			pairIndex[key]++
 
-			// Offset: center around 0, spread by 2 units
-			offset := 0
-			if total > 1 {
-				offset = (idx - (total-1)/2) * 2
-				if total%2 == 0 {
-					offset = (idx - total/2) * 2 + 1
-				}
-			}
-
 			// Draw the arc with offset
-			ed.drawArcWithOffset(fromX, fromY, toX, toY, label, offset, canvasW, canvasH, arcStyle)
+			fsmfile.DrawASCIIArc(set, fromX, fromY, toX, toY, label, offset, canvasW, canvasH)
 		}
 	}
 }
@@ -481,237 +536,39 @@ func (ed *Editor) drawNetVStub(x, startY, endY int, canvasW, canvasH int, style
 	}
 }
 
-func (ed *Editor) drawSelfLoop(x, y int, label string, canvasW, canvasH int, style tcell.Style) {
-	// Draw a loop above the state with label to the right
-	//  ╭──╮
-	//  ╰─→╯ label
-	if y < 2 || x < 1 || x >= canvasW-6 {
-		return
-	}
-	
-	loopY := y - 2
-	
-	// Top of loop
-	if loopY >= 0 {
-		ed.screen.SetContent(x, loopY, '╭', nil, style)
-		ed.screen.SetContent(x+1, loopY, '─', nil, style)
-		ed.screen.SetContent(x+2, loopY, '─', nil, style)
-		ed.screen.SetContent(x+3, loopY, '╮', nil, style)
-	}
-	
-	// Sides
-	if loopY+1 >= 0 && loopY+1 < canvasH {
-		ed.screen.SetContent(x, loopY+1, '│', nil, style)
-		ed.screen.SetContent(x+3, loopY+1, '│', nil, style)
-		
-		// Draw label to the right of the loop
-		labelX := x + 5
-		for i, r := range label {
-			if labelX+i < canvasW {
-				ed.screen.SetContent(labelX+i, loopY+1, r, nil, style)
-			}
-		}
-	}
-	
-	// Bottom connects back with arrow
-	if loopY+2 >= 0 && loopY+2 < canvasH {
-		ed.screen.SetContent(x, loopY+2, '╰', nil, style)
-		ed.screen.SetContent(x+1, loopY+2, '─', nil, style)
-		ed.screen.SetContent(x+2, loopY+2, '→', nil, style)
-		ed.screen.SetContent(x+3, loopY+2, '╯', nil, style)
-	}
-}
-
-func (ed *Editor) drawArc(fromX, fromY, toX, toY int, label string, canvasW, canvasH int, style tcell.Style) {
-	ed.drawArcWithOffset(fromX, fromY, toX, toY, label, 0, canvasW, canvasH, style)
-}
-
-func (ed *Editor) drawArcWithOffset(fromX, fromY, toX, toY int, label string, offset int, canvasW, canvasH int, style tcell.Style) {
-	// Determine direction
-	dx := toX - fromX
-	dy := toY - fromY
-
-	if dy == 0 {
-		// Horizontal line - offset vertically
-		ed.drawHorizontalArc(fromX, fromY+offset, toX, label, canvasW, canvasH, style)
-	} else if dx == 0 {
-		// Vertical line - offset horizontally
-		ed.drawVerticalArc(fromX+offset, fromY, toY, label, canvasW, canvasH, style)
-	} else {
-		// Diagonal - use L-shaped path with offset
-		ed.drawLShapedArcWithOffset(fromX, fromY, toX, toY, label, offset, canvasW, canvasH, style)
-	}
-}
-
-func (ed *Editor) drawHorizontalArc(fromX, y, toX int, label string, canvasW, canvasH int, style tcell.Style) {
-	if y < 0 || y >= canvasH {
-		return
-	}
-
-	minX, maxX := fromX, toX
-	goingRight := true
-	if fromX > toX {
-		minX, maxX = toX, fromX
-		goingRight = false
-	}
-
-	// Draw line
-	for x := minX + 1; x < maxX; x++ {
-		if x >= 0 && x < canvasW {
-			ed.screen.SetContent(x, y, '─', nil, style)
-		}
-	}
-
-	// Draw arrow at destination
-	if goingRight {
-		if maxX-1 >= 0 && maxX-1 < canvasW {
-			ed.screen.SetContent(maxX-1, y, '→', nil, style)
-		}
-	} else {
-		if minX+1 >= 0 && minX+1 < canvasW {
-			ed.screen.SetContent(minX+1, y, '←', nil, style)
-		}
-	}
-
-	// Draw label at midpoint
-	midX := (minX + maxX) / 2 - len(label)/2
-	if y > 0 {
-		ed.drawLabel(midX, y-1, label, canvasW, canvasH, style)
+// cells returns a cell setter for the shared fsmfile drawing functions
+// that draws on the screen in style.
+func (ed *Editor) cells(style tcell.Style) fsmfile.CellFunc {
+	return func(x, y int, r rune) {
+		ed.screen.SetContent(x, y, r, nil, style)
 	}
 }
 
-func (ed *Editor) drawVerticalArc(x, fromY, toY int, label string, canvasW, canvasH int, style tcell.Style) {
-	if x < 0 || x >= canvasW {
-		return
-	}
-
-	minY, maxY := fromY, toY
-	goingDown := true
-	if fromY > toY {
-		minY, maxY = toY, fromY
-		goingDown = false
-	}
-
-	// Draw line
-	for y := minY + 1; y < maxY; y++ {
-		if y >= 0 && y < canvasH {
-			ed.screen.SetContent(x, y, '│', nil, style)
-		}
-	}
-
-	// Draw arrow at destination
-	if goingDown {
-		if maxY-1 >= 0 && maxY-1 < canvasH {
-			ed.screen.SetContent(x, maxY-1, '↓', nil, style)
-		}
-	} else {
-		if minY+1 >= 0 && minY+1 < canvasH {
-			ed.screen.SetContent(x, minY+1, '↑', nil, style)
+// dashedCells wraps set so that the straight lines of arcs it draws are
+// dashed.
+func dashedCells(set fsmfile.CellFunc) fsmfile.CellFunc {
+	return func(x, y int, r rune) {
+		switch r {
+		case '─':
+			r = '╌'
+		case '│':
+			r = '╎'
 		}
+		set(x, y, r)
 	}
-
-	// Draw label beside midpoint
-	midY := (minY + maxY) / 2
-	ed.drawLabel(x+1, midY, label, canvasW, canvasH, style)
-}
-
-func (ed *Editor) drawLShapedArc(fromX, fromY, toX, toY int, label string, canvasW, canvasH int, style tcell.Style) {
-	ed.drawLShapedArcWithOffset(fromX, fromY, toX, toY, label, 0, canvasW, canvasH, style)
 }
 
-func (ed *Editor) drawLShapedArcWithOffset(fromX, fromY, toX, toY int, label string, offset int, canvasW, canvasH int, style tcell.Style) {
-	// Decide corner position - go horizontal first, then vertical
-	// Apply offset to the corner to separate parallel arcs
-	cornerX := toX + offset
-	cornerY := fromY
-
-	// Horizontal segment
-	if fromX != cornerX {
-		minX, maxX := fromX, cornerX
-		if fromX > cornerX {
-			minX, maxX = cornerX, fromX
-		}
-		for x := minX + 1; x < maxX; x++ {
-			if x >= 0 && x < canvasW && cornerY >= 0 && cornerY < canvasH {
-				ed.screen.SetContent(x, cornerY, '─', nil, style)
-			}
-		}
-	}
-
-	// Corner
-	if cornerX >= 0 && cornerX < canvasW && cornerY >= 0 && cornerY < canvasH {
-		var cornerChar rune
-		if toX > fromX && toY > fromY {
-			cornerChar = '╮' // going right then down
-		} else if toX > fromX && toY < fromY {
-			cornerChar = '╯' // going right then up
-		} else if toX < fromX && toY > fromY {
-			cornerChar = '╭' // going left then down
-		} else {
-			cornerChar = '╰' // going left then up
-		}
-		ed.screen.SetContent(cornerX, cornerY, cornerChar, nil, style)
-	}
-
-	// Vertical segment from corner to target
-	targetX := toX
-	if cornerY != toY {
-		minY, maxY := cornerY, toY
-		goingDown := true
-		if cornerY > toY {
-			minY, maxY = toY, cornerY
-			goingDown = false
-		}
-		for y := minY + 1; y < maxY; y++ {
-			if cornerX >= 0 && cornerX < canvasW && y >= 0 && y < canvasH {
-				ed.screen.SetContent(cornerX, y, '│', nil, style)
-			}
-		}
-
-		// If offset, need a horizontal segment to reach target
-		if offset != 0 && cornerX != targetX {
-			// Draw connector from corner column to target column at target row
-			connY := toY
-			if goingDown {
-				connY = maxY - 1
-			} else {
-				connY = minY + 1
-			}
-			
-			minCX, maxCX := cornerX, targetX
-			if cornerX > targetX {
-				minCX, maxCX = targetX, cornerX
-			}
-			for cx := minCX; cx <= maxCX; cx++ {
-				if cx >= 0 && cx < canvasW && connY >= 0 && connY < canvasH {
-					if cx == minCX || cx == maxCX {
-						// corners or endpoints
-						continue
-					}
-					ed.screen.SetContent(cx, connY, '─', nil, style)
-				}
-			}
-		}
-
-		// Arrow at end
-		if goingDown {
-			if cornerX >= 0 && cornerX < canvasW && maxY-1 >= 0 && maxY-1 < canvasH {
-				ed.screen.SetContent(cornerX, maxY-1, '↓', nil, style)
-			}
-		} else {
-			if cornerX >= 0 && cornerX < canvasW && minY+1 >= 0 && minY+1 < canvasH {
-				ed.screen.SetContent(cornerX, minY+1, '↑', nil, style)
-			}
-		}
+// closureHighlight returns the states to highlight as the epsilon
+// closure of the selected state, when that display is on, or nil.
+func (ed *Editor) closureHighlight() map[string]bool {
+	if !ed.showClosure || ed.selectedState < 0 || ed.selectedState >= len(ed.states) {
+		return nil
 	}
-
-	// Label near the corner
-	labelX := (fromX + cornerX) / 2 - len(label)/2
-	labelY := cornerY - 1
-	if labelY < 0 {
-		labelY = cornerY + 1
+	closure := make(map[string]bool)
+	for _, s := range ed.fsm.EpsilonClosure(ed.states[ed.selectedState].Name) {
+		closure[s] = true
 	}
-	ed.drawLabel(labelX, labelY, label, canvasW, canvasH, style)
+	return closure
 }
 
 func (ed *Editor) drawSidebar(w, h int) {
@@ -8,6 +8,11 @@ import (
 func (ed *Editor) drawInputBox(w, h int) {
 	boxW := 50
 	boxH := 3
+	problem := ""
+	if ed.inputValidate != nil {
+		problem = ed.inputValidate(ed.inputBuffer)
+		boxH = 4 // room for live feedback
+	}
 	boxX := (w - boxW) / 2
 	boxY := (h - boxH) / 2
 
@@ -17,6 +22,9 @@ func (ed *Editor) drawInputBox(w, h int) {
 	// Draw prompt and input
 	ed.drawString(boxX+2, boxY+1, ed.inputPrompt, styleInput)
 	ed.drawString(boxX+2+len(ed.inputPrompt), boxY+1, ed.inputBuffer+"_", styleInput)
+	if problem != "" {
+		ed.drawString(boxX+2, boxY+2, truncate("✗ "+problem, boxW-4), styleMsgError)
+	}
 }
 
 func (ed *Editor) drawFilePicker(w, h int) {
@@ -332,6 +340,10 @@ func (ed *Editor) drawHelpOverlay(w, h int) {
 				{"Double-click", "Dive into linked state"},
 				{"◀ button", "Click breadcrumb bar to navigate back"},
 				{"", "  Breadcrumbs show: main › child › grandchild"},
+				{"+", "Mark the state under the cursor for grouping"},
+				{"Ctrl+click", "Mark or unmark a state for grouping"},
+				{"J", "Group the marked states into a linked machine"},
+				{"", "  Esc clears the marks"},
 			},
 		},
 		{
@@ -340,6 +352,8 @@ func (ed *Editor) drawHelpOverlay(w, h int) {
 				{"G", "Grab selected state for keyboard movement"},
 				{"", "  Then use ↑↓←→ to move, Enter to confirm, Esc to cancel"},
 				{"Left-drag", "Drag a state to a new position with the mouse"},
+				{"F", "Re-arrange all states with the auto-layout engine"},
+				{"", "  Choose the engine (sugiyama, force, circular...) in Settings"},
 			},
 		},
 		{
@@ -347,6 +361,7 @@ func (ed *Editor) drawHelpOverlay(w, h int) {
 			items: [][2]string{
 				{"T", "Add a transition from the selected state"},
 				{"", "  Select target state, then choose input symbol"},
+				{"", "  ε-transitions are drawn dashed and dimmed"},
 				{"I", "Add a new input symbol to the alphabet"},
 				{"O", "Add a new output symbol (Mealy/Moore)"},
 			},
@@ -356,7 +371,10 @@ func (ed *Editor) drawHelpOverlay(w, h int) {
 			items: [][2]string{
 				{"W", "Toggle visibility of transition arcs on the canvas"},
 				{"N", "Toggle visibility of structural nets on the canvas"},
+				{"Z", "Highlight the ε-closure of the selected state (NFA)"},
 				{"R", "Render the FSM to an image file and open viewer"},
+				{"D", "Edit the machine as text in a side pane"},
+				{"", "  Edits apply as soon as the text parses; Esc closes"},
 				{"\\", "Toggle sidebar collapse/expand"},
 				{"", "  Drag divider to resize, snaps at default width"},
 			},
@@ -389,6 +407,8 @@ func (ed *Editor) drawHelpOverlay(w, h int) {
 			items: [][2]string{
 				{"V", "Validate the FSM structure (check for errors)"},
 				{"L", "Run analysis (reachability, dead states, etc.)"},
+				{"Y", "Open the acceptance panel: inputs and their verdicts"},
+				{"", "  Re-run on every edit; => accept|reject marks ✓ or ✗"},
 			},
 		},
 		{
@@ -399,6 +419,7 @@ func (ed *Editor) drawHelpOverlay(w, h int) {
 				{"Ctrl+S", "Save the current file"},
 				{"Ctrl+Z", "Undo the last action"},
 				{"Ctrl+Y", "Redo a previously undone action"},
+				{"U", "Browse the undo history and jump to any point"},
 			},
 		},
 		{
@@ -408,6 +429,7 @@ func (ed *Editor) drawHelpOverlay(w, h int) {
 				{"Left-drag", "Move a state by dragging"},
 				{"Right-click", "Add a new state at mouse position"},
 				{"Double-click", "Rename a state"},
+				{"Ctrl+click", "Mark or unmark a state for grouping"},
 			},
 		},
 		{
@@ -105,19 +105,14 @@ func (ed *Editor) refreshFilePicker() {
 	}
 	ed.dirSelected = 0
 	
-	// Get files
+	// Get files in every machine format, grouped by format
 	ed.fileList = nil
-	fsmPattern := filepath.Join(ed.currentDir, "*.fsm")
-	jsonPattern := filepath.Join(ed.currentDir, "*.json")
-	fsmFiles, _ := filepath.Glob(fsmPattern)
-	jsonFiles, _ := filepath.Glob(jsonPattern)
-	
-	// Store just filenames, not full paths
-	for _, f := range fsmFiles {
-		ed.fileList = append(ed.fileList, filepath.Base(f))
-	}
-	for _, f := range jsonFiles {
-		ed.fileList = append(ed.fileList, filepath.Base(f))
+	for _, ext := range fsmfile.MachineExtensions() {
+		files, _ := filepath.Glob(filepath.Join(ed.currentDir, "*"+ext))
+		// Store just filenames, not full paths
+		for _, f := range files {
+			ed.fileList = append(ed.fileList, filepath.Base(f))
+		}
 	}
 	ed.fileSelected = 0
 }
@@ -174,7 +169,7 @@ func (ed *Editor) doSave() {
 		if ed.isBundle {
 			ed.showMessage("Saved bundle: "+filepath.Base(ed.filename), MsgSuccess)
 		} else {
-			ed.showMessage("Saved: "+ed.filename, MsgSuccess)
+			ed.showMessage(savedMessage(ed.filename), MsgSuccess)
 		}
 	}
 }
@@ -188,23 +183,37 @@ func (ed *Editor) saveAs() {
 			ed.mode = ModeMenu
 			return
 		}
-		// Add .fsm extension if none
+		// Add .fsm extension if none; otherwise the extension picks the format
 		if filepath.Ext(name) == "" {
 			name += ".fsm"
 		}
+		if !fsmfile.IsMachineFile(name) {
+			ed.showMessage("Unknown format: "+filepath.Ext(name)+" (use "+strings.Join(fsmfile.MachineExtensions(), ", ")+")", MsgError)
+			ed.mode = ModeMenu
+			return
+		}
 		ed.filename = name
 		ed.promotedFromSingle = false // new filename, no more promotion concern
 		if err := ed.saveFile(ed.filename); err != nil {
 			ed.showMessage("Error: "+err.Error(), MsgError)
 		} else {
 			ed.modified = false
-			ed.showMessage("Saved: "+ed.filename, MsgSuccess)
+			ed.showMessage(savedMessage(ed.filename), MsgSuccess)
 		}
 		ed.mode = ModeMenu
 	}
 	ed.mode = ModeInput
 }
 
+// savedMessage is the status message after saving a single machine,
+// warning when the format drops the names and layout.
+func savedMessage(path string) string {
+	if filepath.Ext(path) == ".hex" {
+		return "Saved: " + path + " (hex keeps no names or layout)"
+	}
+	return "Saved: " + path
+}
+
 // File operations
 
 func (ed *Editor) loadFile(path string) error {
@@ -212,13 +221,11 @@ func (ed *Editor) loadFile(path string) error {
 	ed.resetBundleState()
 	
 	ext := filepath.Ext(path)
+	if !fsmfile.IsMachineFile(path) {
+		return fmt.Errorf("unknown format: %s", ext)
+	}
 
-	var f *fsm.FSM
-	var layout *fsmfile.Layout
-	var err error
-
-	switch ext {
-	case ".fsm":
+	if ext == ".fsm" {
 		// Check if this is a bundle with multiple machines
 		machines, listErr := fsmfile.ListMachines(path)
 		if listErr == nil && len(machines) > 1 {
@@ -252,37 +259,15 @@ func (ed *Editor) loadFile(path string) error {
 			ed.mode = ModeSelectMachine
 			return nil
 		}
-		// Single machine - load normally
-		f, layout, err = fsmfile.ReadFSMFileWithLayout(path)
-		ed.isBundle = false
-		ed.currentMachine = ""
-	case ".json":
-		data, rerr := os.ReadFile(path)
-		if rerr != nil {
-			return rerr
-		}
-		f, err = fsmfile.ParseJSON(data)
-		ed.isBundle = false
-		ed.currentMachine = ""
-	case ".hex":
-		data, rerr := os.ReadFile(path)
-		if rerr != nil {
-			return rerr
-		}
-		records, perr := fsmfile.ParseHex(string(data))
-		if perr != nil {
-			return perr
-		}
-		f, err = fsmfile.RecordsToFSM(records, nil)
-		ed.isBundle = false
-		ed.currentMachine = ""
-	default:
-		return fmt.Errorf("unknown format: %s", ext)
 	}
 
+	// Single machine - load in the format given by the extension
+	f, layout, err := fsmfile.ReadMachineFile(path)
 	if err != nil {
 		return err
 	}
+	ed.isBundle = false
+	ed.currentMachine = ""
 
 	ed.fsm = f
 	ed.modified = false
@@ -295,24 +280,8 @@ func (ed *Editor) loadFile(path string) error {
 		ed.canvasOffsetX = layout.Editor.CanvasOffsetX
 		ed.canvasOffsetY = layout.Editor.CanvasOffsetY
 		
-		for i, name := range f.States {
-			if sl, ok := layout.States[name]; ok {
-				ed.states[i] = StatePos{
-					Name: name,
-					X:    sl.X,
-					Y:    sl.Y,
-				}
-			} else {
-				// Fallback for states not in layout
-				col := i % 5
-				row := i / 5
-				ed.states[i] = StatePos{
-					Name: name,
-					X:    5 + col*15,
-					Y:    2 + row*4,
-				}
-			}
-		}
+		// States the layout lacks go next to their neighbours.
+		ed.states = ed.placeStates(f, layoutPositions(layout))
 	} else {
 		// Generate smart layout based on FSM structure
 		// Use canvas dimensions for layout calculation
@@ -323,7 +292,7 @@ func (ed *Editor) loadFile(path string) error {
 			h = h - 4                    // account for status bars
 		}
 		
-		autoPositions := fsmfile.SmartLayoutTUI(f, w, h)
+		autoPositions := fsmfile.EngineLayoutTUI(f, ed.layoutEngine(), w, h)
 		for i, name := range f.States {
 			if pos, ok := autoPositions[name]; ok {
 				ed.states[i] = StatePos{
@@ -363,18 +332,16 @@ func (ed *Editor) saveFile(path string) error {
 		positions[sp.Name] = [2]int{sp.X, sp.Y}
 	}
 	
-	switch ext {
-	case ".fsm":
-		return fsmfile.WriteFSMFileWithLayout(path, ed.fsm, true, positions, ed.canvasOffsetX, ed.canvasOffsetY)
-	case ".json":
-		data, err := fsmfile.ToJSON(ed.fsm, true)
-		if err != nil {
-			return err
-		}
-		return os.WriteFile(path, data, 0644)
-	default:
-		return fsmfile.WriteFSMFileWithLayout(path, ed.fsm, true, positions, ed.canvasOffsetX, ed.canvasOffsetY)
+	if !fsmfile.IsMachineFile(path) {
+		return fmt.Errorf("unknown format: %s", ext)
 	}
+	return fsmfile.WriteMachineFile(path, ed.fsm, fsmfile.WriteOptions{
+		Pretty:    true,
+		Labels:    true,
+		Positions: positions,
+		OffsetX:   ed.canvasOffsetX,
+		OffsetY:   ed.canvasOffsetY,
+	})
 }
 
 // saveBundleFile saves the bundle. If the target file exists, only modified
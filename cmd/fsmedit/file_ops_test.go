@@ -190,6 +190,69 @@ func TestSaveLoadRoundTrip_Bundle(t *testing.T) {
 	}
 }
 
+func TestSaveLoadRoundTrip_Hex(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"s0", "s1"})
+	ed.fsm.Alphabet = []string{"a"}
+	ed.fsm.Accepting = []string{"s1"}
+	ed.fsm.AddTransition("s0", strPtr("a"), []string{"s1"}, nil)
+
+	path := filepath.Join(t.TempDir(), "test.hex")
+	if err := ed.saveFile(path); err != nil {
+		t.Fatalf("saveFile failed: %v", err)
+	}
+
+	ed2 := newTestEditor()
+	if err := ed2.loadFile(path); err != nil {
+		t.Fatalf("loadFile failed: %v", err)
+	}
+	// Hex keeps the structure but not the names.
+	if len(ed2.fsm.States) != 2 {
+		t.Errorf("states: expected 2, got %d", len(ed2.fsm.States))
+	}
+	if len(ed2.fsm.Transitions) != 1 {
+		t.Errorf("transitions: expected 1, got %d", len(ed2.fsm.Transitions))
+	}
+	if len(ed2.fsm.Accepting) != 1 {
+		t.Errorf("accepting: expected 1 state, got %v", ed2.fsm.Accepting)
+	}
+}
+
+func TestSaveFile_UnknownExtension(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"s0"})
+	path := filepath.Join(t.TempDir(), "test.txt")
+	if err := ed.saveFile(path); err == nil {
+		t.Error("expected an error for an unknown extension")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("no file should be written for an unknown extension")
+	}
+}
+
+// --- file picker ---
+
+func TestRefreshFilePicker_AllFormats(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.fsm", "b.json", "c.hex", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ed := newTestEditor()
+	ed.currentDir = dir
+	ed.refreshFilePicker()
+
+	want := []string{"a.fsm", "b.json", "c.hex"}
+	if len(ed.fileList) != len(want) {
+		t.Fatalf("fileList: expected %v, got %v", want, ed.fileList)
+	}
+	for i := range want {
+		if ed.fileList[i] != want[i] {
+			t.Errorf("fileList[%d]: expected %q, got %q", i, want[i], ed.fileList[i])
+		}
+	}
+}
+
 // --- resetBundleState via newFSM path ---
 
 func TestNewFSMResetsBundle(t *testing.T) {
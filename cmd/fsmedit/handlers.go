@@ -33,6 +33,11 @@ func (ed *Editor) handleKey(ev *tcell.EventKey) bool {
 	// Clear any active flash on keypress
 	ed.clearFlash()
 
+	// The text pane takes every key, shortcuts included, as typing.
+	if ed.mode == ModeText {
+		return ed.handleTextKey(ev)
+	}
+
 	if isCtrlOrCmd(tcell.KeyCtrlC, 'c') {
 		ed.copyToClipboard()
 		return false
@@ -107,6 +112,12 @@ func (ed *Editor) handleKey(ev *tcell.EventKey) bool {
 		return ed.handleNetDetailKey(ev)
 	case ModeNetDetailPeer:
 		return ed.handleNetDetailPeerKey(ev)
+	case ModeTemplatePicker:
+		return ed.handleTemplatePickerKey(ev)
+	case ModeUndoHistory:
+		return ed.handleUndoHistoryKey(ev)
+	case ModeAcceptance:
+		return ed.handleAcceptanceKey(ev)
 	}
 	return false
 }
@@ -149,6 +160,8 @@ func (ed *Editor) executeMenuItem() bool {
 		ed.saveAs()
 	case item == "Edit Canvas":
 		ed.mode = ModeCanvas
+	case item == "Insert Template":
+		ed.openTemplatePicker()
 	case item == "Render":
 		if len(ed.fsm.States) == 0 {
 			ed.showMessage("Canvas is empty - nothing to render", MsgError)
@@ -171,6 +171,10 @@ func (ed *Editor) handleCanvasKey(ev *tcell.EventKey) bool {
 
 	switch ev.Key() {
 	case tcell.KeyEscape:
+		if len(ed.markedStates) > 0 {
+			ed.markedStates = nil
+			break
+		}
 		ed.mode = ModeMenu
 		ed.selectedState = -1
 	case tcell.KeyUp:
@@ -254,6 +258,10 @@ func (ed *Editor) handleCanvasKey(ev *tcell.EventKey) bool {
 			} else {
 				ed.showMessage("Nets hidden", MsgInfo)
 			}
+		case 'z', 'Z':
+			ed.toggleClosure()
+		case 'y', 'Y':
+			ed.openAcceptance()
 		case 'g', 'G':
 			// Check if cursor is on a state - if so, select it first
 			stateUnderCursor := ed.findStateAtCursor()
@@ -265,6 +273,8 @@ func (ed *Editor) handleCanvasKey(ev *tcell.EventKey) bool {
 			} else {
 				ed.showMessage("Select a state first (Tab to cycle)", MsgInfo)
 			}
+		case 'f', 'F':
+			ed.arrangeStates()
 		case 'l', 'L':
 			ed.runAnalysis()
 		case 'v', 'V':
@@ -296,6 +306,24 @@ func (ed *Editor) handleCanvasKey(ev *tcell.EventKey) bool {
 			ed.openClassAssign()
 		case 'b', 'B':
 			ed.openMachineManager()
+		case 'd', 'D':
+			ed.openTextPane()
+		case 'u', 'U':
+			ed.openUndoHistory()
+		case '+':
+			// Mark the state under the cursor, or the selected state,
+			// for grouping
+			stateIdx := ed.findStateAtCursor()
+			if stateIdx < 0 {
+				stateIdx = ed.selectedState
+			}
+			if stateIdx >= 0 {
+				ed.toggleMark(stateIdx)
+			} else {
+				ed.showMessage("Select a state first", MsgInfo)
+			}
+		case 'j', 'J':
+			ed.groupMarkedStates()
 		case '\\':
 			// Toggle sidebar collapse
 			ed.toggleSidebarCollapse()
@@ -332,8 +360,14 @@ func (ed *Editor) handleMouse(ev *tcell.EventMouse) {
 		ModeAddTransition, ModeSelectInput, ModeSelectOutput,
 		ModeHelp, ModeSelectMachine, ModeSelectLinkTarget,
 		ModeImportMachineSelect, ModeClassAssign,
-		ModePropertyEditor, ModeListEditor, ModeSettings:
+		ModePropertyEditor, ModeListEditor, ModeSettings, ModeText,
+		ModeTemplatePicker, ModeUndoHistory:
 		return // Consume mouse events — don't let them reach canvas.
+	case ModeAcceptance:
+		// The panel is not modal: using the mouse returns to the canvas.
+		if ev.Buttons() != tcell.ButtonNone {
+			ed.mode = ModeCanvas
+		}
 	}
 
 	// Handle breadcrumb bar clicks (if visible)
@@ -579,8 +613,10 @@ func (ed *Editor) handleMouse(ev *tcell.EventMouse) {
 	// Handle drag release (all buttons released)
 	if ed.dragging && allReleased {
 		ed.dragging = false
-		ed.modified = true
-		ed.showMessage("State moved", MsgInfo)
+		if ed.commitMove(ed.dragStateIdx, ed.moveOrigX, ed.moveOrigY) {
+			ed.modified = true
+			ed.showMessage("State moved", MsgInfo)
+		}
 		ed.leftMouseDown = false
 		ed.rightMouseDown = false
 		return
@@ -800,12 +836,13 @@ func (ed *Editor) handleMouse(ev *tcell.EventMouse) {
 					dx := x - ed.leftDownX
 					dy := y - ed.leftDownY
 					if (dx != 0 || dy != 0) && ed.leftDownStateIdx >= 0 {
-						// Started dragging a state
-						ed.saveSnapshot()
+						// Started dragging a state; the move is
+						// recorded for undo when it is released
 						ed.dragging = true
 						ed.dragStateIdx = ed.leftDownStateIdx
 						ed.selectedState = ed.leftDownStateIdx
 						sp := ed.states[ed.leftDownStateIdx]
+						ed.moveOrigX, ed.moveOrigY = sp.X, sp.Y
 						stateX := sp.X - ed.canvasOffsetX
 						stateY := sp.Y - ed.canvasOffsetY
 						ed.dragOffsetX = ed.leftDownX - stateX
@@ -869,6 +906,9 @@ func (ed *Editor) handleMouse(ev *tcell.EventMouse) {
 						ed.editStateName(clickedState)
 						ed.lastClickTime = 0 // Reset to prevent triple-click
 						ed.lastClickState = -1
+					} else if ev.Modifiers()&tcell.ModCtrl != 0 && clickedState >= 0 {
+						// Ctrl+click - mark state for grouping
+						ed.toggleMark(clickedState)
 					} else {
 						// Single click - select state
 						ed.selectedState = clickedState
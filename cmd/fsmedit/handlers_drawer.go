@@ -178,7 +178,7 @@ func (ed *Editor) instantiateComponent(cls *fsm.Class, canvasX, canvasY int) {
 	}
 
 	// Snapshot for undo.
-	ed.saveSnapshot()
+	ed.saveSnapshot("Added state " + name)
 
 	// Add state.
 	ed.fsm.AddState(name)
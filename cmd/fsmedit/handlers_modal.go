@@ -22,7 +22,7 @@ func (ed *Editor) handleSelectLinkTargetKey(ev *tcell.EventKey) bool {
 		if ed.linkTargetSelected >= 0 && ed.linkTargetSelected < len(ed.linkTargetMachines) {
 			targetMachine := ed.linkTargetMachines[ed.linkTargetSelected]
 			stateName := ed.states[ed.selectedState].Name
-			ed.saveSnapshot()
+			ed.saveSnapshot("Linked " + stateName + " to " + targetMachine)
 			ed.fsm.SetLinkedMachine(stateName, targetMachine)
 			ed.showMessage(stateName+" → "+targetMachine, MsgSuccess)
 			ed.modified = true
@@ -114,8 +114,17 @@ func (ed *Editor) handleSelectMachineKey(ev *tcell.EventKey) bool {
 func (ed *Editor) handleInputKey(ev *tcell.EventKey) bool {
 	switch ev.Key() {
 	case tcell.KeyEscape:
+		ed.inputValidate = nil
 		ed.mode = ModeMenu
 	case tcell.KeyEnter:
+		if ed.inputValidate != nil {
+			if msg := ed.inputValidate(ed.inputBuffer); msg != "" {
+				ed.showMessage(msg, MsgError)
+				return false
+			}
+		}
+		// The action may open another prompt, with its own validator.
+		ed.inputValidate = nil
 		if ed.inputAction != nil {
 			ed.inputAction(ed.inputBuffer)
 		}
@@ -0,0 +1,322 @@
+// Undo history browser for fsmedit.
+// Opened via 'u' on the canvas, lists the edits on the undo and redo
+// stacks with the label each was saved with, or else a description worked
+// out by comparing the snapshots either side of it, and jumps to any
+// point among them.
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// historyEntry is one row of the history panel: a point the machine can
+// be returned to, described by the edit that led to it.
+type historyEntry struct {
+	Label string
+	Time  time.Time // when the edit was made; zero for the start
+	Redo  bool      // undone, and reachable by redo
+}
+
+// undoHistory returns the points in the undo history, oldest first, and
+// the index of the current one. Entries before it are reached by undo,
+// those after it by redo.
+func (ed *Editor) undoHistory() ([]historyEntry, int) {
+	current := len(ed.undoStack)
+	snaps := make([]Snapshot, 0, current+1+len(ed.redoStack))
+	snaps = append(snaps, ed.undoStack...)
+	snaps = append(snaps, Snapshot{FSM: ed.fsm, States: ed.states})
+	for i := len(ed.redoStack) - 1; i >= 0; i-- {
+		snaps = append(snaps, ed.redoStack[i])
+	}
+
+	entries := []historyEntry{{Label: "Start"}}
+	for k := 1; k < len(snaps); k++ {
+		// Undo snapshots carry the details of the edit after them, redo
+		// snapshots those of the edit before them.
+		edit := snaps[k-1]
+		if k > current {
+			edit = snaps[k]
+		}
+		label := edit.Label
+		if label == "" {
+			label = describeChange(snaps[k-1], snaps[k])
+		}
+		entries = append(entries, historyEntry{
+			Label: label,
+			Time:  edit.Time,
+			Redo:  k > current,
+		})
+	}
+	return entries, current
+}
+
+// jumpToHistory undoes or redoes edits until the machine is at point i of
+// undoHistory.
+func (ed *Editor) jumpToHistory(i int) {
+	steps := 0
+	for len(ed.undoStack) > i && ed.stepUndo() {
+		steps--
+	}
+	for len(ed.undoStack) < i && ed.stepRedo() {
+		steps++
+	}
+	verb := "Redid"
+	if steps < 0 {
+		verb, steps = "Undid", -steps
+	}
+	switch {
+	case steps == 1:
+		ed.showMessage(verb+" 1 edit", MsgInfo)
+	case steps > 1:
+		ed.showMessage(fmt.Sprintf("%s %d edits", verb, steps), MsgInfo)
+	}
+}
+
+func (ed *Editor) openUndoHistory() {
+	if len(ed.undoStack) == 0 && len(ed.redoStack) == 0 {
+		ed.showMessage("No undo history yet", MsgInfo)
+		return
+	}
+	ed.historySelected = len(ed.undoStack)
+	ed.mode = ModeUndoHistory
+}
+
+func (ed *Editor) handleUndoHistoryKey(ev *tcell.EventKey) bool {
+	entries, _ := ed.undoHistory()
+	switch ev.Key() {
+	case tcell.KeyUp:
+		if ed.historySelected > 0 {
+			ed.historySelected--
+		}
+	case tcell.KeyDown:
+		if ed.historySelected < len(entries)-1 {
+			ed.historySelected++
+		}
+	case tcell.KeyHome:
+		ed.historySelected = 0
+	case tcell.KeyEnd:
+		ed.historySelected = len(entries) - 1
+	case tcell.KeyEnter:
+		ed.jumpToHistory(ed.historySelected)
+		ed.mode = ModeCanvas
+	case tcell.KeyEscape:
+		ed.mode = ModeCanvas
+	case tcell.KeyRune:
+		if ev.Rune() == 'u' || ev.Rune() == 'U' || ev.Rune() == 'q' {
+			ed.mode = ModeCanvas
+		}
+	}
+	return false
+}
+
+func (ed *Editor) drawUndoHistory(w, h int) {
+	entries, current := ed.undoHistory()
+
+	boxWidth := 56
+	boxHeight := len(entries) + 6
+	if boxHeight > h-4 {
+		boxHeight = h - 4
+	}
+	if boxWidth > w-4 {
+		boxWidth = w - 4
+	}
+
+	startX := (w - boxWidth) / 2
+	startY := (h - boxHeight) / 2
+
+	title := fmt.Sprintf(" Undo history (%d undo, %d redo) ", len(ed.undoStack), len(ed.redoStack))
+	ed.drawTitledBox(startX, startY, boxWidth, boxHeight, title)
+
+	visibleHeight := boxHeight - 4
+	scrollOffset := 0
+	if ed.historySelected >= visibleHeight {
+		scrollOffset = ed.historySelected - visibleHeight + 1
+	}
+
+	for i := 0; i < visibleHeight && i+scrollOffset < len(entries); i++ {
+		idx := i + scrollOffset
+		e := entries[idx]
+		y := startY + 2 + i
+
+		style := styleMenu
+		if e.Redo {
+			style = styleHelp
+		}
+		if idx == ed.historySelected {
+			style = styleMenuSel
+		}
+
+		for x := startX + 1; x < startX+boxWidth-1; x++ {
+			ed.screen.SetContent(x, y, ' ', nil, style)
+		}
+		marker := "  "
+		if idx == current {
+			marker = "▶ "
+		}
+		stamp := "        "
+		if !e.Time.IsZero() {
+			stamp = e.Time.Format("15:04:05")
+		}
+		ed.drawString(startX+2, y, marker+stamp+"  "+truncate(e.Label, boxWidth-16), style)
+	}
+
+	footer := "↑↓: Select   Enter: Jump   Esc: Close"
+	footerX := startX + (boxWidth-len(footer))/2
+	ed.drawString(footerX, startY+boxHeight-2, footer, styleHelp)
+}
+
+// describeChange names the edit that turned one snapshot into the next,
+// for the history panel, from the most telling difference between them.
+func describeChange(before, after Snapshot) string {
+	b, a := before.FSM, after.FSM
+
+	added, removed := stringDiff(b.States, a.States)
+	switch {
+	case len(added) == 1 && len(removed) == 1:
+		return fmt.Sprintf("Renamed %s to %s", removed[0], added[0])
+	case len(added) > 0 && len(removed) > 0:
+		return "Changed states"
+	case len(added) == 1:
+		return "Added state " + added[0]
+	case len(added) > 1:
+		return fmt.Sprintf("Added %d states", len(added))
+	case len(removed) == 1:
+		return "Deleted state " + removed[0]
+	case len(removed) > 1:
+		return fmt.Sprintf("Deleted %d states", len(removed))
+	}
+
+	addedT, removedT := stringDiff(transitionKeys(b), transitionKeys(a))
+	switch {
+	case len(addedT) == 1 && len(removedT) == 1:
+		return "Edited transition " + addedT[0]
+	case len(addedT) == 1 && len(removedT) == 0:
+		return "Added transition " + addedT[0]
+	case len(removedT) == 1 && len(addedT) == 0:
+		return "Deleted transition " + removedT[0]
+	case len(addedT) > 0 && len(removedT) > 0:
+		return "Changed transitions"
+	case len(addedT) > 0:
+		return fmt.Sprintf("Added %d transitions", len(addedT))
+	case len(removedT) > 0:
+		return fmt.Sprintf("Deleted %d transitions", len(removedT))
+	}
+
+	if b.Initial != a.Initial {
+		if a.Initial == "" {
+			return "Cleared initial state"
+		}
+		return "Set initial state " + a.Initial
+	}
+	if added, removed := stringDiff(b.Accepting, a.Accepting); len(added)+len(removed) == 1 {
+		if len(added) == 1 {
+			return "Made " + added[0] + " accepting"
+		}
+		return "Made " + removed[0] + " non-accepting"
+	} else if len(added)+len(removed) > 1 {
+		return "Changed accepting states"
+	}
+
+	var moved []string
+	pos := make(map[string]StatePos, len(before.States))
+	for _, sp := range before.States {
+		pos[sp.Name] = sp
+	}
+	for _, sp := range after.States {
+		if old, ok := pos[sp.Name]; ok && (old.X != sp.X || old.Y != sp.Y) {
+			moved = append(moved, sp.Name)
+		}
+	}
+	switch {
+	case len(moved) == 1:
+		return "Moved " + moved[0]
+	case len(moved) > 1:
+		return fmt.Sprintf("Moved %d states", len(moved))
+	}
+
+	if added, removed := stringDiff(b.Alphabet, a.Alphabet); len(added) == 1 && len(removed) == 0 {
+		return "Added input " + added[0]
+	} else if len(removed) == 1 && len(added) == 0 {
+		return "Deleted input " + removed[0]
+	} else if len(added)+len(removed) > 0 {
+		return "Changed inputs"
+	}
+	if added, removed := stringDiff(b.OutputAlphabet, a.OutputAlphabet); len(added) == 1 && len(removed) == 0 {
+		return "Added output " + added[0]
+	} else if len(removed) == 1 && len(added) == 0 {
+		return "Deleted output " + removed[0]
+	} else if len(added)+len(removed) > 0 {
+		return "Changed outputs"
+	}
+
+	switch {
+	case b.Type != a.Type:
+		return "Changed type to " + string(a.Type)
+	case differ(b.StateOutputs, a.StateOutputs):
+		return "Set Moore outputs"
+	case differ(b.LinkedMachines, a.LinkedMachines):
+		return "Changed linked machines"
+	case differ(b.Classes, a.Classes):
+		return "Edited classes"
+	case differ(b.StateClasses, a.StateClasses):
+		return "Assigned classes"
+	case differ(b.StateProperties, a.StateProperties):
+		return "Edited properties"
+	case differ(b.Nets, a.Nets):
+		return "Edited connections"
+	}
+	return "Edited machine"
+}
+
+// stringDiff returns the strings of b not in a, and those of a not in b,
+// each in order.
+func stringDiff(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, s := range a {
+		inA[s] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+		if !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// transitionKeys describes each transition of f as "from → to on input".
+func transitionKeys(f *fsm.FSM) []string {
+	keys := make([]string, len(f.Transitions))
+	for i, t := range f.Transitions {
+		key := t.From + " → " + strings.Join(t.To, ",")
+		if t.Input != nil {
+			key += " on " + *t.Input
+		}
+		if t.Output != nil {
+			key += " / " + *t.Output
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// differ reports whether two maps or slices hold different contents,
+// counting nil and empty as the same.
+func differ(a, b interface{}) bool {
+	if reflect.ValueOf(a).Len() == 0 && reflect.ValueOf(b).Len() == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(a, b)
+}
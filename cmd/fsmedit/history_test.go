@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUndoHistory_LabelsAndJump(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"q0", "q1"})
+	ed.fsm.Alphabet = []string{"a"}
+
+	ed.addStateAtPosition(40, 10) // S2
+	ed.states[0].X = 12
+	ed.commitMove(0, 5, 5)
+	ed.saveSnapshot("") // unlabelled: described from the change
+	ed.fsm.AddTransition("q0", strPtr("a"), []string{"q1"}, nil)
+	ed.saveSnapshot("Cleared transitions")
+	ed.fsm.Transitions = nil
+
+	entries, current := ed.undoHistory()
+	want := []string{"Start", "Added state S2", "Moved q0", "Added transition q0 → q1 on a", "Cleared transitions"}
+	if len(entries) != len(want) || current != len(want)-1 {
+		t.Fatalf("%d entries, current %d; want %d, %d", len(entries), current, len(want), len(want)-1)
+	}
+	for i, e := range entries {
+		if e.Label != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, e.Label, want[i])
+		}
+		if (i == 0) != e.Time.IsZero() {
+			t.Errorf("entry %d time = %v", i, e.Time)
+		}
+	}
+
+	ed.jumpToHistory(1)
+	if len(ed.fsm.States) != 3 || ed.states[0].X != 5 || len(ed.fsm.Transitions) != 0 {
+		t.Errorf("after jumping to 1: states %v, q0 at x=%d, %d transitions", ed.fsm.States, ed.states[0].X, len(ed.fsm.Transitions))
+	}
+	entries, current = ed.undoHistory()
+	if current != 1 || len(entries) != len(want) || !entries[4].Redo || entries[1].Redo {
+		t.Errorf("after jumping back: current %d of %d entries", current, len(entries))
+	}
+	for i, e := range entries {
+		if e.Label != want[i] {
+			t.Errorf("after jump, entry %d = %q, want %q", i, e.Label, want[i])
+		}
+	}
+
+	ed.jumpToHistory(3)
+	if len(ed.fsm.Transitions) != 1 || ed.states[0].X != 12 {
+		t.Errorf("after jumping forward to 3: %d transitions, q0 at x=%d", len(ed.fsm.Transitions), ed.states[0].X)
+	}
+
+	ed.jumpToHistory(0)
+	if len(ed.fsm.States) != 2 || len(ed.undoStack) != 0 {
+		t.Errorf("after jumping to the start: states %v, %d undo snapshots", ed.fsm.States, len(ed.undoStack))
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"a", "b"})
+	before := Snapshot{FSM: ed.fsm.Clone(), States: append([]StatePos(nil), ed.states...)}
+
+	ed.fsm.States[1] = "c"
+	ed.states[1].Name = "c"
+	if got := describeChange(before, Snapshot{FSM: ed.fsm, States: ed.states}); got != "Renamed b to c" {
+		t.Errorf("rename described as %q", got)
+	}
+
+	ed.fsm.States[1] = "b"
+	ed.states[1].Name = "b"
+	ed.fsm.Accepting = []string{"b"}
+	if got := describeChange(before, Snapshot{FSM: ed.fsm, States: ed.states}); got != "Made b accepting" {
+		t.Errorf("accepting described as %q", got)
+	}
+
+	ed.fsm.Accepting = nil
+	ed.fsm.SetStateOutput("a", "x")
+	if got := describeChange(before, Snapshot{FSM: ed.fsm, States: ed.states}); got != "Set Moore outputs" {
+		t.Errorf("Moore output described as %q", got)
+	}
+}
@@ -56,6 +56,12 @@ type Editor struct {
 	// Link target selection
 	linkTargetMachines []string // available machines to link to
 	linkTargetSelected int      // selected index in linkTargetMachines
+
+	// Template picker
+	templateSelected int // selected index in builtinTemplates
+
+	// Undo history browser
+	historySelected int // selected index in undoHistory
 	
 	// Zoom animation state
 	animating       bool    // true during zoom animation
@@ -76,6 +82,7 @@ type Editor struct {
 	// Selection
 	selectedState int // -1 = none
 	selectedTrans int // -1 = none
+	markedStates  map[string]bool // states marked for grouping into a composite
 
 	// Dragging state (mouse)
 	dragging      bool
@@ -120,8 +127,16 @@ type Editor struct {
 	moveOrigY    int
 
 	// Display options
-	showArcs bool // toggle arc visibility with 'w'
-	showNets bool // toggle net visibility with 'n'
+	showArcs    bool // toggle arc visibility with 'w'
+	showNets    bool // toggle net visibility with 'n'
+	showClosure bool // highlight the selected state's ε-closure with 'z'
+
+	// Acceptance panel ('y'): candidate input sequences run live
+	showAcceptance  bool
+	acceptance      []acceptanceCase
+	acceptanceSel   int    // selected row; len(acceptance) is the entry line
+	acceptanceInput string // entry line
+	acceptanceEdit  int    // candidate being edited on the entry line, or -1
 
 	// Flash effects (when clicking items in sidebar)
 	flashInput      string // input symbol being flashed, empty if none
@@ -155,6 +170,7 @@ type Editor struct {
 	inputBuffer string
 	inputPrompt string
 	inputAction func(string)
+	inputValidate func(string) string // why the input is not acceptable, or ""; nil accepts anything
 
 	// File picker state
 	fileList        []string
@@ -259,12 +275,25 @@ type Editor struct {
 	netDetailPeers       []string           // available peers
 	netDetailPeerCursor  int                // selection in peer picker
 	netDetailPeerStateA  string             // the state we're finding peers for
+
+	// Text pane state.
+	textLines            []string           // the machine as .fsmt, being edited
+	textRow              int                // cursor line
+	textCol              int                // cursor byte offset in the line
+	textScrollY          int                // first visible line
+	textScrollX          int                // first visible column
+	textErr              string             // parse error, or "" when the text applies
+	textErrLine          int                // line of textErr, 1-based, or 0
+	textSnapshotted      bool               // undo snapshot taken for this session
 }
 
 // Snapshot captures editor state for undo/redo
 type Snapshot struct {
 	FSM    *fsm.FSM
 	States []StatePos
+	Label  string    // description of the edit between this snapshot and its neighbour nearer the present
+	Time   time.Time // when that edit was made
+	Key    string    // edits with the same key in a row are coalesced into one undo step
 }
 
 // StatePos tracks state position on canvas
@@ -324,6 +353,10 @@ const (
 	ModeMachineManager      // bundle machine management overlay
 	ModeNetDetail           // connection detail window
 	ModeNetDetailPeer       // peer picker for connection detail
+	ModeText                // text pane editing the machine as .fsmt
+	ModeTemplatePicker      // built-in template picker
+	ModeUndoHistory         // undo history browser
+	ModeAcceptance          // acceptance panel has the keyboard
 )
 
 // MessageType for status messages
@@ -406,6 +439,7 @@ func (ed *Editor) updateMenuItems() {
 		"Save",
 		"Save As",
 		"Edit Canvas",
+		"Insert Template",
 		"Render",
 		"Settings",
 		"Quit",
@@ -0,0 +1,89 @@
+// Naming rules for state and symbol names typed into fsmedit's prompts.
+// Names end up as identifiers in generated code and DOT, so the input box
+// checks them as they are typed, and will not accept one that breaks the
+// rule chosen in Settings or is already taken.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// nameRules are the values of the name rule setting:
+//
+//	identifier  letters, digits, and _, not starting with a digit
+//	relaxed     anything but whitespace, quotes, and backslashes
+//	any         anything
+var nameRules = []string{"identifier", "relaxed", "any"}
+
+// nameMaxLengths are the choices offered in Settings for the longest name
+// allowed; 0 is no limit.
+var nameMaxLengths = []int{16, 32, 64, 0}
+
+// checkName returns why name breaks the configured naming rule, or "" if
+// it does not.
+func (cfg Config) checkName(name string) string {
+	if n := len([]rune(name)); cfg.NameMaxLength > 0 && n > cfg.NameMaxLength {
+		return fmt.Sprintf("longer than %d characters", cfg.NameMaxLength)
+	}
+	switch cfg.NameRule {
+	case "any":
+		return ""
+	case "relaxed":
+		for _, r := range name {
+			switch {
+			case unicode.IsSpace(r):
+				return "contains whitespace"
+			case strings.ContainsRune("\"'`\\", r):
+				return fmt.Sprintf("contains %q", r)
+			}
+		}
+		return ""
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			return "contains whitespace"
+		case r > unicode.MaxASCII || !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)):
+			return fmt.Sprintf("%q not allowed (letters, digits, _)", r)
+		case i == 0 && unicode.IsDigit(r):
+			return "starts with a digit"
+		}
+	}
+	return ""
+}
+
+// nameValidator returns an input validator for a new name of the given
+// kind ("state", "input", ...) that reports breaches of the naming rule
+// and names already in taken. keep is the name being replaced, if any,
+// which is not taken; an empty name cancels the prompt, so is not
+// reported either.
+func (ed *Editor) nameValidator(kind string, taken []string, keep string) func(string) string {
+	return func(name string) string {
+		if name == "" || name == keep {
+			return ""
+		}
+		if msg := ed.config.checkName(name); msg != "" {
+			return msg
+		}
+		for _, s := range taken {
+			if s == name {
+				return fmt.Sprintf("%s %s already exists", kind, name)
+			}
+		}
+		return ""
+	}
+}
+
+// nameMaxLengthLabels returns nameMaxLengths as Settings shows them.
+func nameMaxLengthLabels() []string {
+	labels := make([]string, len(nameMaxLengths))
+	for i, n := range nameMaxLengths {
+		labels[i] = fmt.Sprint(n)
+		if n == 0 {
+			labels[i] = "none"
+		}
+	}
+	return labels
+}
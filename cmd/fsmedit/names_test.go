@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		rule string
+		max  int
+		name string
+		ok   bool
+	}{
+		{"identifier", 32, "door_open", true},
+		{"identifier", 32, "_q1", true},
+		{"identifier", 32, "door open", false},
+		{"identifier", 32, "1st", false},
+		{"identifier", 32, "a-b", false},
+		{"identifier", 32, "café", false},
+		{"identifier", 4, "abcde", false},
+		{"identifier", 0, "a_very_long_name_with_no_limit_at_all", true},
+		{"relaxed", 32, "a-b.c", true},
+		{"relaxed", 32, "café", true},
+		{"relaxed", 32, "a b", false},
+		{"relaxed", 32, `say"hi"`, false},
+		{"any", 32, "door open", true},
+		{"any", 3, "door", false},
+	}
+	for _, tt := range tests {
+		cfg := Config{NameRule: tt.rule, NameMaxLength: tt.max}
+		if msg := cfg.checkName(tt.name); (msg == "") != tt.ok {
+			t.Errorf("%s, max %d: checkName(%q) = %q, want ok = %v", tt.rule, tt.max, tt.name, msg, tt.ok)
+		}
+	}
+}
+
+func TestNameValidator(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"idle", "busy"})
+	validate := ed.nameValidator("state", ed.fsm.States, "busy")
+	for name, ok := range map[string]bool{
+		"":      true, // cancels
+		"busy":  true, // the name being replaced
+		"idle":  false,
+		"ready": true,
+		"re dy": false,
+	} {
+		if msg := validate(name); (msg == "") != ok {
+			t.Errorf("validate(%q) = %q, want ok = %v", name, msg, ok)
+		}
+	}
+}
+
+func TestInputPrompt_RejectsInvalidName(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"S0"})
+	ed.addStateAtCursor()
+	enter := tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)
+
+	ed.inputBuffer = "S0"
+	ed.handleInputKey(enter)
+	if ed.mode != ModeInput || len(ed.fsm.States) != 1 {
+		t.Fatalf("duplicate name accepted: mode %v, states %v", ed.mode, ed.fsm.States)
+	}
+
+	ed.inputBuffer = "two words"
+	ed.handleInputKey(enter)
+	if ed.mode != ModeInput || len(ed.fsm.States) != 1 {
+		t.Fatalf("name with a space accepted: states %v", ed.fsm.States)
+	}
+
+	ed.inputBuffer = "S1"
+	ed.handleInputKey(enter)
+	if ed.mode != ModeCanvas || !ed.fsm.HasState("S1") {
+		t.Errorf("valid name rejected: mode %v, states %v", ed.mode, ed.fsm.States)
+	}
+	if ed.inputValidate != nil {
+		t.Error("validator should be cleared once the prompt is done")
+	}
+}
+
+func TestCycleNameMaxLength(t *testing.T) {
+	ed := newTestEditor()
+	items := ed.buildSettingsItems()
+	for i, item := range items {
+		if item.Key == "name_max_length" {
+			ed.settingsCursor = i
+		}
+	}
+	ed.cycleSettingValue(items, 1)
+	if ed.config.NameMaxLength != 64 {
+		t.Errorf("after cycling from 32: %d, want 64", ed.config.NameMaxLength)
+	}
+	ed.cycleSettingValue(ed.buildSettingsItems(), 1)
+	if ed.config.NameMaxLength != 0 {
+		t.Errorf("after cycling from 64: %d, want 0 (none)", ed.config.NameMaxLength)
+	}
+}
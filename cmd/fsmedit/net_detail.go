@@ -671,7 +671,7 @@ func (ed *Editor) netDetailAddConnection() {
 					return
 				}
 
-				ed.saveSnapshot()
+				ed.saveSnapshot(fmt.Sprintf("Connected %s.%s to %s.%s", stateA, portA, stateB, portB))
 
 				// Check if net already exists — if so, add endpoint(s) to it.
 				existing := ed.fsm.GetNet(netName)
@@ -731,7 +731,7 @@ func (ed *Editor) netDetailDeleteConnection() {
 			return
 		}
 
-		ed.saveSnapshot()
+		ed.saveSnapshot("Deleted connection " + row.Net)
 
 		net := ed.fsm.GetNet(row.Net)
 		if net == nil {
@@ -805,7 +805,7 @@ func (ed *Editor) netDetailRenameNet() {
 			return
 		}
 
-		ed.saveSnapshot()
+		ed.saveSnapshot("Renamed net " + oldName + " to " + newName)
 
 		if err := ed.fsm.RenameNet(oldName, newName); err != nil {
 			ed.showMessage(err.Error(), MsgError)
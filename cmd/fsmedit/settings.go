@@ -8,6 +8,7 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
 )
 
 // ====================================================================
@@ -71,6 +72,21 @@ func (ed *Editor) buildSettingsItems() []settingsItem {
 			Key:    "class_lib_dir",
 			Values: nil, // text input, not a cycle
 		},
+		{
+			Label:  "Auto Layout",
+			Key:    "layout",
+			Values: fsmfile.LayoutEngineNames(),
+		},
+		{
+			Label:  "Name Rule",
+			Key:    "name_rule",
+			Values: nameRules,
+		},
+		{
+			Label:  "Max Name Length",
+			Key:    "name_max_length",
+			Values: nameMaxLengthLabels(),
+		},
 	}
 
 	// Set current indices.
@@ -108,6 +124,24 @@ func (ed *Editor) buildSettingsItems() []settingsItem {
 					items[i].CurrentIdx = j
 				}
 			}
+		case "layout":
+			for j, v := range items[i].Values {
+				if v == ed.layoutEngine().Name() {
+					items[i].CurrentIdx = j
+				}
+			}
+		case "name_rule":
+			for j, v := range items[i].Values {
+				if v == ed.config.NameRule {
+					items[i].CurrentIdx = j
+				}
+			}
+		case "name_max_length":
+			for j, n := range nameMaxLengths {
+				if n == ed.config.NameMaxLength {
+					items[i].CurrentIdx = j
+				}
+			}
 		}
 	}
 
@@ -305,9 +339,21 @@ func (ed *Editor) cycleSettingValue(items []settingsItem, dir int) {
 			ed.modified = true
 		}
 		ed.config.Vocabulary = newVal
+	case "layout":
+		ed.config.Layout = newVal
+	case "name_rule":
+		ed.config.NameRule = newVal
+	case "name_max_length":
+		ed.config.NameMaxLength = nameMaxLengths[newIdx]
 	}
 }
 
+// layoutEngine returns the auto-layout engine chosen in Settings.
+func (ed *Editor) layoutEngine() fsmfile.LayoutEngine {
+	engine, _ := fsmfile.LayoutEngineByName(ed.config.Layout)
+	return engine
+}
+
 // promptClassLibDir opens the file picker in directory-only mode.
 func (ed *Editor) promptClassLibDir() {
 	// Start from current class lib dir, or working directory.
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
 )
 
 func TestVocabularies(t *testing.T) {
@@ -312,9 +313,9 @@ func TestBuildSettingsItems(t *testing.T) {
 
 	items := ed.buildSettingsItems()
 
-	// Should have 5 settings.
-	if len(items) != 5 {
-		t.Fatalf("expected 5 settings items, got %d", len(items))
+	// Should have 8 settings.
+	if len(items) != 8 {
+		t.Fatalf("expected 8 settings items, got %d", len(items))
 	}
 
 	// Check keys.
@@ -322,7 +323,7 @@ func TestBuildSettingsItems(t *testing.T) {
 	for i, item := range items {
 		keys[i] = item.Key
 	}
-	expected := []string{"renderer", "file_type", "fsm_type", "vocabulary", "class_lib_dir"}
+	expected := []string{"renderer", "file_type", "fsm_type", "vocabulary", "class_lib_dir", "layout", "name_rule", "name_max_length"}
 	for i, k := range expected {
 		if keys[i] != k {
 			t.Errorf("item[%d].Key = %q, want %q", i, keys[i], k)
@@ -341,6 +342,27 @@ func TestBuildSettingsItems(t *testing.T) {
 	}
 }
 
+func TestCycleLayoutSetting(t *testing.T) {
+	ed := &Editor{}
+	ed.config = DefaultConfig()
+	ed.fsm = fsm.New(fsm.TypeDFA)
+
+	if ed.layoutEngine() != fsmfile.EngineAuto {
+		t.Fatalf("default engine = %q, want auto", ed.layoutEngine())
+	}
+	ed.settingsCursor = 5 // layout row
+	ed.cycleSettingValue(ed.buildSettingsItems(), 1)
+	if ed.config.Layout != "sugiyama" || ed.layoutEngine() != fsmfile.EngineSugiyama {
+		t.Errorf("after cycling: config %q, engine %q; want sugiyama", ed.config.Layout, ed.layoutEngine())
+	}
+	ed.cycleSettingValue(ed.buildSettingsItems(), -1)
+	ed.cycleSettingValue(ed.buildSettingsItems(), -1)
+	names := fsmfile.LayoutEngineNames()
+	if last := names[len(names)-1]; ed.config.Layout != last {
+		t.Errorf("cycling back past auto: got %q, want %q", ed.config.Layout, last)
+	}
+}
+
 func TestIntToStr(t *testing.T) {
 	cases := []struct {
 		in   int
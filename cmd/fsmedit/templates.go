@@ -0,0 +1,241 @@
+// Built-in template machines for fsmedit.
+// "Insert Template" on the main menu opens a picker; the chosen machine is
+// merged into the current one at the canvas cursor, as a paste would be.
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// machineTemplate is a starting point for a common kind of design.
+type machineTemplate struct {
+	Name        string
+	Description string
+	Source      string // the machine in the text format
+}
+
+// builtinTemplates are the templates offered by the picker, in order.
+// They are DFAs, so they can be inserted into a machine of any type.
+var builtinTemplates = []machineTemplate{
+	{
+		Name:        "Traffic light",
+		Description: "Timed cycle with a flashing fault mode",
+		Source: `type dfa
+inputs timer fault reset
+
+state red initial
+state green
+state amber
+state flashing
+
+red -> green on timer
+green -> amber on timer
+amber -> red on timer
+red -> flashing on fault
+green -> flashing on fault
+amber -> flashing on fault
+flashing -> red on reset
+`,
+	},
+	{
+		Name:        "Elevator",
+		Description: "Car that moves to calls and opens its doors",
+		Source: `type dfa
+inputs call_up call_down arrived door_timeout
+
+state idle initial
+state moving_up
+state moving_down
+state doors_open
+
+idle -> moving_up on call_up
+idle -> moving_down on call_down
+idle -> doors_open on arrived
+moving_up -> doors_open on arrived
+moving_down -> doors_open on arrived
+doors_open -> idle on door_timeout
+`,
+	},
+	{
+		Name:        "Handshake",
+		Description: "TCP-like open, accept, and close",
+		Source: `type dfa
+inputs open listen syn syn_ack ack close fin timeout
+
+state closed initial
+state listen
+state syn_sent
+state syn_received
+state established
+state fin_wait
+state close_wait
+state time_wait
+
+closed -> syn_sent on open
+closed -> listen on listen
+listen -> syn_received on syn
+syn_sent -> established on syn_ack
+syn_sent -> closed on timeout
+syn_received -> established on ack
+established -> fin_wait on close
+established -> close_wait on fin
+fin_wait -> time_wait on fin
+close_wait -> closed on close
+time_wait -> closed on timeout
+`,
+	},
+	{
+		Name:        "Debounce",
+		Description: "Button input that must be stable for a tick",
+		Source: `type dfa
+inputs press release tick
+
+state released initial
+state pressing
+state pressed
+state releasing
+
+released -> pressing on press
+pressing -> released on release
+pressing -> pressed on tick
+pressed -> releasing on release
+releasing -> pressed on press
+releasing -> released on tick
+`,
+	},
+	{
+		Name:        "Retry with backoff",
+		Description: "Attempt, wait, and retry until success or giving up",
+		Source: `type dfa
+inputs start ok error backoff_elapsed give_up
+
+state idle initial
+state attempting
+state waiting
+state succeeded accepting
+state failed accepting
+
+idle -> attempting on start
+attempting -> succeeded on ok
+attempting -> waiting on error
+waiting -> attempting on backoff_elapsed
+waiting -> failed on give_up
+`,
+	},
+}
+
+// machine parses the template's source.
+func (t machineTemplate) machine() (*fsm.FSM, error) {
+	return fsmfile.ParseText([]byte(t.Source))
+}
+
+// Size of the area a template is laid out in before it is placed at the
+// cursor; templates are small, so this keeps their states close together.
+const (
+	templateLayoutWidth  = 60
+	templateLayoutHeight = 16
+)
+
+func (ed *Editor) openTemplatePicker() {
+	ed.templateSelected = 0
+	ed.mode = ModeTemplatePicker
+}
+
+// insertTemplate merges a template into the current machine with its
+// top-left state at the canvas cursor. States whose names are taken are
+// renamed, as for a paste. On an empty canvas the template's initial and
+// accepting states are kept too, so that it is a complete starting design.
+func (ed *Editor) insertTemplate(t machineTemplate) {
+	tf, err := t.machine()
+	if err != nil {
+		ed.showMessage("Template error: "+err.Error(), MsgError)
+		return
+	}
+
+	positions := fsmfile.EngineLayoutTUI(tf, ed.layoutEngine(), templateLayoutWidth, templateLayoutHeight)
+	layout := &fsmfile.Layout{States: make(map[string]fsmfile.StateLayout, len(positions))}
+	for name, pos := range positions {
+		layout.States[name] = fsmfile.StateLayout{X: pos[0], Y: pos[1]}
+	}
+
+	empty := len(ed.fsm.States) == 0
+	ed.saveSnapshot("Inserted template " + t.Name)
+	statesAdded, transAdded, renamed := ed.mergeMachine(tf, layout, ed.canvasCursorX, ed.canvasCursorY)
+	if empty {
+		ed.fsm.SetInitial(tf.Initial)
+		ed.fsm.Accepting = append(ed.fsm.Accepting, tf.Accepting...)
+	}
+
+	msg := fmt.Sprintf("Inserted %s: %d states, %d transitions", t.Name, statesAdded, transAdded)
+	if renamed > 0 {
+		msg += fmt.Sprintf(" (%d renamed)", renamed)
+	}
+	ed.showMessage(msg, MsgSuccess)
+}
+
+func (ed *Editor) handleTemplatePickerKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyUp:
+		if ed.templateSelected > 0 {
+			ed.templateSelected--
+		}
+	case tcell.KeyDown:
+		if ed.templateSelected < len(builtinTemplates)-1 {
+			ed.templateSelected++
+		}
+	case tcell.KeyEnter:
+		if ed.templateSelected >= 0 && ed.templateSelected < len(builtinTemplates) {
+			ed.insertTemplate(builtinTemplates[ed.templateSelected])
+		}
+	case tcell.KeyEscape:
+		ed.mode = ModeMenu
+	}
+	return false
+}
+
+func (ed *Editor) drawTemplatePicker(w, h int) {
+	boxWidth := 60
+	boxHeight := len(builtinTemplates) + 6
+	if boxHeight > h-4 {
+		boxHeight = h - 4
+	}
+	if boxWidth > w-4 {
+		boxWidth = w - 4
+	}
+
+	startX := (w - boxWidth) / 2
+	startY := (h - boxHeight) / 2
+
+	title := fmt.Sprintf(" Insert template at %d,%d ", ed.canvasCursorX, ed.canvasCursorY)
+	ed.drawTitledBox(startX, startY, boxWidth, boxHeight, title)
+
+	visibleHeight := boxHeight - 4
+	scrollOffset := 0
+	if ed.templateSelected >= visibleHeight {
+		scrollOffset = ed.templateSelected - visibleHeight + 1
+	}
+
+	for i := 0; i < visibleHeight && i+scrollOffset < len(builtinTemplates); i++ {
+		t := builtinTemplates[i+scrollOffset]
+		y := startY + 2 + i
+
+		style := styleMenu
+		if i+scrollOffset == ed.templateSelected {
+			style = styleMenuSel
+		}
+
+		for x := startX + 1; x < startX+boxWidth-1; x++ {
+			ed.screen.SetContent(x, y, ' ', nil, style)
+		}
+		ed.drawString(startX+3, y, fmt.Sprintf("%-20s", t.Name), style)
+		ed.drawString(startX+24, y, truncate(t.Description, boxWidth-27), style)
+	}
+
+	footer := "↑↓: Select   Enter: Insert   Esc: Cancel"
+	footerX := startX + (boxWidth-len(footer))/2
+	ed.drawString(footerX, startY+boxHeight-2, footer, styleHelp)
+}
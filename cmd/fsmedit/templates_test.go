@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBuiltinTemplates_Valid(t *testing.T) {
+	for _, tmpl := range builtinTemplates {
+		f, err := tmpl.machine()
+		if err != nil {
+			t.Errorf("%s: %v", tmpl.Name, err)
+			continue
+		}
+		if err := f.Validate(); err != nil {
+			t.Errorf("%s does not validate: %v", tmpl.Name, err)
+		}
+	}
+}
+
+func TestInsertTemplate_EmptyCanvas(t *testing.T) {
+	ed := newTestEditor()
+	ed.canvasCursorX, ed.canvasCursorY = 20, 10
+	retry := builtinTemplates[len(builtinTemplates)-1]
+	ed.insertTemplate(retry)
+
+	want, _ := retry.machine()
+	if len(ed.fsm.States) != len(want.States) || len(ed.states) != len(want.States) {
+		t.Fatalf("inserted %d states (%d positions), want %d", len(ed.fsm.States), len(ed.states), len(want.States))
+	}
+	if ed.fsm.Initial != "idle" {
+		t.Errorf("initial = %q, want the template's on an empty canvas", ed.fsm.Initial)
+	}
+	if !ed.fsm.IsAccepting("succeeded") || !ed.fsm.IsAccepting("failed") {
+		t.Errorf("accepting = %v", ed.fsm.Accepting)
+	}
+	minX, minY := ed.states[0].X, ed.states[0].Y
+	for _, sp := range ed.states {
+		minX, minY = min(minX, sp.X), min(minY, sp.Y)
+	}
+	if minX != 20 || minY != 10 {
+		t.Errorf("top-left state at (%d,%d), want the cursor (20,10)", minX, minY)
+	}
+	if ed.mode != ModeCanvas || !ed.modified {
+		t.Errorf("mode = %v, modified = %v", ed.mode, ed.modified)
+	}
+}
+
+func TestInsertTemplate_MergesAndUndoes(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"idle", "busy"})
+	ed.fsm.Alphabet = []string{"start"}
+	ed.insertTemplate(builtinTemplates[len(builtinTemplates)-1])
+
+	if ed.fsm.Initial != "idle" || len(ed.fsm.Accepting) != 0 {
+		t.Errorf("initial %q, accepting %v: a non-empty machine keeps its own", ed.fsm.Initial, ed.fsm.Accepting)
+	}
+	if !ed.fsm.HasState("idle_1") {
+		t.Errorf("states %v: the template's idle should be renamed idle_1", ed.fsm.States)
+	}
+	if len(ed.fsm.Alphabet) != 5 {
+		t.Errorf("alphabet = %v; start should be shared", ed.fsm.Alphabet)
+	}
+
+	ed.undo()
+	if len(ed.fsm.States) != 2 || len(ed.states) != 2 {
+		t.Errorf("after undo %d states, want 2", len(ed.fsm.States))
+	}
+}
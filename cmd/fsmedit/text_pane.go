@@ -0,0 +1,439 @@
+// Text pane: the current machine in the .fsmt text format, editable in
+// place. Edits are parsed as they are typed and, when the text reads as
+// a machine, replace the model, so transitions can be typed rather than
+// picked from selectors.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// Text pane syntax highlighting, on the overlay background.
+var (
+	styleTextKeyword = styleOverlayHdr
+	styleTextComment = styleOverlayDim
+	styleTextState   = styleOverlay.Foreground(tcell.ColorGreen)
+	styleTextInput   = styleOverlay.Foreground(tcell.PaletteColor(73))
+	styleTextOutput  = styleOverlay.Foreground(tcell.PaletteColor(172))
+	styleTextClass   = styleOverlay.Foreground(tcell.ColorFuchsia)
+	styleTextStack   = styleOverlay.Foreground(tcell.PaletteColor(117))
+	styleTextString  = styleOverlay.Foreground(tcell.PaletteColor(180))
+	styleTextError   = styleOverlay.Foreground(tcell.ColorRed).Bold(true)
+)
+
+// openTextPane shows the current machine as text.
+func (ed *Editor) openTextPane() {
+	text := strings.TrimSuffix(string(fsmfile.ToText(ed.fsm)), "\n")
+	ed.textLines = strings.Split(text, "\n")
+	ed.textRow, ed.textCol = 0, 0
+	ed.textScrollY, ed.textScrollX = 0, 0
+	ed.textErr, ed.textErrLine = "", 0
+	ed.textSnapshotted = false
+	ed.mode = ModeText
+}
+
+// closeTextPane returns to the canvas. Text that does not parse was never
+// applied, so the machine is as of the last edit that did.
+func (ed *Editor) closeTextPane() {
+	ed.mode = ModeCanvas
+	if ed.textErr != "" {
+		ed.showMessage("Text has errors; kept the last valid machine", MsgWarning)
+	}
+}
+
+// applyText parses the pane and, if the machine it describes differs
+// from the current one, makes it current. Positions of states that keep
+// their names are kept; new states are placed next to their neighbours.
+func (ed *Editor) applyText() {
+	f, err := fsmfile.ParseText([]byte(strings.Join(ed.textLines, "\n")))
+	if err != nil {
+		ed.textErr, ed.textErrLine = err.Error(), 0
+		var te *fsmfile.TextError
+		if errors.As(err, &te) {
+			ed.textErr, ed.textErrLine = te.Msg, te.Line
+		}
+		return
+	}
+	ed.textErr, ed.textErrLine = "", 0
+	if ed.isBundle {
+		// Bundle machines are renamed in the machine manager, which
+		// keeps links in step.
+		f.Name = ed.fsm.Name
+	}
+	if f.StructurallyEqual(ed.fsm) {
+		return
+	}
+
+	// One undo step for the whole session in the pane.
+	if !ed.textSnapshotted {
+		ed.saveSnapshot("Edited as text")
+		ed.textSnapshotted = true
+	}
+
+	selected := ""
+	if ed.selectedState >= 0 && ed.selectedState < len(ed.states) {
+		selected = ed.states[ed.selectedState].Name
+	}
+	positions := make(map[string][2]int, len(ed.states))
+	for _, sp := range ed.states {
+		positions[sp.Name] = [2]int{sp.X, sp.Y}
+	}
+	if dfaEpsilons(f) > dfaEpsilons(ed.fsm) {
+		ed.showMessage("A DFA cannot have ε-transitions (without \"on\"): make it an NFA", MsgWarning)
+	}
+	ed.states = ed.placeStates(f, positions)
+	ed.selectedState = -1
+	for i, sp := range ed.states {
+		if sp.Name == selected {
+			ed.selectedState = i
+		}
+	}
+	ed.fsm = f
+	ed.selectedTrans = -1
+	ed.modified = true
+	if ed.isBundle {
+		ed.saveMachineToCache()
+	}
+}
+
+// dfaEpsilons counts f's epsilon transitions if it is a DFA, which
+// cannot have them.
+func dfaEpsilons(f *fsm.FSM) int {
+	if f.Type != fsm.TypeDFA {
+		return 0
+	}
+	n := 0
+	for _, t := range f.Transitions {
+		if t.Input == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (ed *Editor) handleTextKey(ev *tcell.EventKey) bool {
+	line := ed.textLines[ed.textRow]
+	edited := false
+
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		ed.closeTextPane()
+		return false
+	case tcell.KeyCtrlS:
+		if ed.textErr != "" {
+			ed.showMessage("Not saved: the text has errors", MsgError)
+			return false
+		}
+		ed.save()
+		return false
+	case tcell.KeyEnter:
+		// The new line keeps the indentation of this one, so the details
+		// of a state or transition can be typed one after another.
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if len(indent) > ed.textCol {
+			indent = indent[:ed.textCol]
+		}
+		rest := indent + line[ed.textCol:]
+		ed.textLines[ed.textRow] = line[:ed.textCol]
+		ed.textLines = append(ed.textLines[:ed.textRow+1], append([]string{rest}, ed.textLines[ed.textRow+1:]...)...)
+		ed.textRow++
+		ed.textCol = len(indent)
+		edited = true
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if ed.textCol > 0 {
+			_, size := utf8.DecodeLastRuneInString(line[:ed.textCol])
+			ed.textLines[ed.textRow] = line[:ed.textCol-size] + line[ed.textCol:]
+			ed.textCol -= size
+			edited = true
+		} else if ed.textRow > 0 {
+			prev := ed.textLines[ed.textRow-1]
+			ed.textLines[ed.textRow-1] = prev + line
+			ed.textLines = append(ed.textLines[:ed.textRow], ed.textLines[ed.textRow+1:]...)
+			ed.textRow--
+			ed.textCol = len(prev)
+			edited = true
+		}
+	case tcell.KeyDelete:
+		if ed.textCol < len(line) {
+			_, size := utf8.DecodeRuneInString(line[ed.textCol:])
+			ed.textLines[ed.textRow] = line[:ed.textCol] + line[ed.textCol+size:]
+			edited = true
+		} else if ed.textRow < len(ed.textLines)-1 {
+			ed.textLines[ed.textRow] = line + ed.textLines[ed.textRow+1]
+			ed.textLines = append(ed.textLines[:ed.textRow+1], ed.textLines[ed.textRow+2:]...)
+			edited = true
+		}
+	case tcell.KeyTab:
+		ed.insertText("  ")
+		edited = true
+	case tcell.KeyLeft:
+		if ed.textCol > 0 {
+			_, size := utf8.DecodeLastRuneInString(line[:ed.textCol])
+			ed.textCol -= size
+		} else if ed.textRow > 0 {
+			ed.textRow--
+			ed.textCol = len(ed.textLines[ed.textRow])
+		}
+	case tcell.KeyRight:
+		if ed.textCol < len(line) {
+			_, size := utf8.DecodeRuneInString(line[ed.textCol:])
+			ed.textCol += size
+		} else if ed.textRow < len(ed.textLines)-1 {
+			ed.textRow++
+			ed.textCol = 0
+		}
+	case tcell.KeyUp:
+		ed.moveTextRow(-1)
+	case tcell.KeyDown:
+		ed.moveTextRow(1)
+	case tcell.KeyPgUp:
+		ed.moveTextRow(-ed.textPageSize())
+	case tcell.KeyPgDn:
+		ed.moveTextRow(ed.textPageSize())
+	case tcell.KeyHome:
+		ed.textCol = 0
+	case tcell.KeyEnd:
+		ed.textCol = len(line)
+	case tcell.KeyRune:
+		ed.insertText(string(ev.Rune()))
+		edited = true
+	}
+
+	if edited {
+		ed.applyText()
+	}
+	return false
+}
+
+// insertText inserts s at the cursor.
+func (ed *Editor) insertText(s string) {
+	line := ed.textLines[ed.textRow]
+	ed.textLines[ed.textRow] = line[:ed.textCol] + s + line[ed.textCol:]
+	ed.textCol += len(s)
+}
+
+// moveTextRow moves the cursor by n lines, keeping its column where the
+// line is long enough.
+func (ed *Editor) moveTextRow(n int) {
+	col := utf8.RuneCountInString(ed.textLines[ed.textRow][:ed.textCol])
+	ed.textRow += n
+	if ed.textRow < 0 {
+		ed.textRow = 0
+	}
+	if ed.textRow > len(ed.textLines)-1 {
+		ed.textRow = len(ed.textLines) - 1
+	}
+	line := ed.textLines[ed.textRow]
+	ed.textCol = 0
+	for i := 0; i < col && ed.textCol < len(line); i++ {
+		_, size := utf8.DecodeRuneInString(line[ed.textCol:])
+		ed.textCol += size
+	}
+}
+
+// textPageSize is the number of lines PgUp and PgDn move.
+func (ed *Editor) textPageSize() int {
+	if ed.screen == nil {
+		return 10
+	}
+	_, h := ed.screen.Size()
+	if h < 12 {
+		return 1
+	}
+	return h - 10
+}
+
+// textLineStyles returns the style of each byte of line n (1-based) of
+// the pane: names by kind, keywords, strings, and comments.
+func textLineStyles(line string, n int, refs []fsmfile.TextRef) []tcell.Style {
+	styles := make([]tcell.Style, len(line))
+	for i := range styles {
+		styles[i] = styleOverlay
+	}
+
+	// Words that are not names are keywords, strings, or values; a
+	// comment runs from a # that starts a word.
+	inQuote, wordStart := false, true
+	first := true
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuote:
+			styles[i] = styleTextString
+			if c == '\\' && i+1 < len(line) {
+				i++
+				styles[i] = styleTextString
+			} else if c == '"' {
+				inQuote = false
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			wordStart = true
+			continue
+		case wordStart && c == '#':
+			for j := i; j < len(line); j++ {
+				styles[j] = styleTextComment
+			}
+			i = len(line)
+			continue
+		case wordStart && c == '"':
+			inQuote = true
+			styles[i] = styleTextString
+		}
+		if wordStart {
+			end := i
+			for end < len(line) && line[end] != ' ' && line[end] != '\t' && line[end] != '\r' {
+				end++
+			}
+			word := line[i:end]
+			if first || word == "->" || word == "on" || word == "/" || word == "initial" || word == "accepting" {
+				for j := i; j < end && !inQuote; j++ {
+					styles[j] = styleTextKeyword
+				}
+			}
+			first = false
+		}
+		wordStart = false
+	}
+
+	// Names override the keyword guess: a transition line starts with a
+	// state, and a state may be called "on".
+	for _, r := range refs {
+		if r.Line != n || r.End > len(line) {
+			continue
+		}
+		style := styleTextState
+		switch r.Kind {
+		case fsmfile.TextInput:
+			style = styleTextInput
+		case fsmfile.TextOutput:
+			style = styleTextOutput
+		case fsmfile.TextClass:
+			style = styleTextClass
+		case fsmfile.TextStackSymbol:
+			style = styleTextStack
+		}
+		for j := r.Start; j < r.End; j++ {
+			styles[j] = style
+		}
+	}
+	return styles
+}
+
+// drawTextPane draws the text pane over the right of the canvas and the
+// sidebar.
+func (ed *Editor) drawTextPane(w, h int) {
+	paneW := w * 2 / 5
+	if paneW < ed.sidebarWidth {
+		paneW = ed.sidebarWidth
+	}
+	if paneW < 30 {
+		paneW = 30
+	}
+	if paneW > w {
+		paneW = w
+	}
+	x0 := w - paneW
+	top := 0
+	if len(ed.navStack) > 0 && ed.isBundle {
+		top = 1 // breadcrumb bar
+	}
+	bottom := h - 3 // above the help and status bars
+	if bottom-top < 4 {
+		return
+	}
+
+	// Border and fill.
+	for y := top; y <= bottom; y++ {
+		for x := x0; x < w; x++ {
+			ch, style := ' ', styleOverlay
+			switch {
+			case x == x0 && y == top:
+				ch, style = '┌', styleOverlayBrd
+			case x == x0 && y == bottom:
+				ch, style = '└', styleOverlayBrd
+			case x == x0:
+				ch, style = '│', styleOverlayBrd
+			case y == top || y == bottom:
+				ch, style = '─', styleOverlayBrd
+			}
+			ed.screen.SetContent(x, y, ch, nil, style)
+		}
+	}
+	ed.drawString(x0+2, top, " Text ", styleOverlayHdr)
+
+	// Interior: a gutter of line numbers, the lines, and a status line.
+	gutter := len(fmt.Sprint(len(ed.textLines))) + 1
+	textX := x0 + 1 + gutter + 1
+	textW := w - textX
+	rows := bottom - top - 2
+	if textW < 1 || rows < 1 {
+		return
+	}
+
+	// Keep the cursor in view.
+	if ed.textRow < ed.textScrollY {
+		ed.textScrollY = ed.textRow
+	}
+	if ed.textRow >= ed.textScrollY+rows {
+		ed.textScrollY = ed.textRow - rows + 1
+	}
+	cursorCol := utf8.RuneCountInString(ed.textLines[ed.textRow][:ed.textCol])
+	if cursorCol < ed.textScrollX {
+		ed.textScrollX = cursorCol
+	}
+	if cursorCol >= ed.textScrollX+textW {
+		ed.textScrollX = cursorCol - textW + 1
+	}
+
+	refs := fsmfile.TextRefs([]byte(strings.Join(ed.textLines, "\n")))
+	for row := 0; row < rows; row++ {
+		i := ed.textScrollY + row
+		if i >= len(ed.textLines) {
+			break
+		}
+		y := top + 1 + row
+		numStyle := styleOverlayDim
+		if i+1 == ed.textErrLine {
+			numStyle = styleTextError
+		}
+		num := fmt.Sprint(i + 1)
+		ed.drawString(x0+1+gutter-len(num), y, num, numStyle)
+
+		line := ed.textLines[i]
+		styles := textLineStyles(line, i+1, refs)
+		col := 0
+		for b, r := range line {
+			if col >= ed.textScrollX && col-ed.textScrollX < textW {
+				ed.screen.SetContent(textX+col-ed.textScrollX, y, r, nil, styles[b])
+			}
+			col++
+		}
+	}
+
+	// The cursor cell.
+	if cy := ed.textRow - ed.textScrollY; cy >= 0 && cy < rows {
+		line := ed.textLines[ed.textRow]
+		r := ' '
+		if ed.textCol < len(line) {
+			r, _ = utf8.DecodeRuneInString(line[ed.textCol:])
+		}
+		ed.screen.SetContent(textX+cursorCol-ed.textScrollX, top+1+cy, r, nil, styleOverlayEdt)
+	}
+
+	status, style := fmt.Sprintf("%d:%d", ed.textRow+1, cursorCol+1), styleOverlayDim
+	if ed.textErr != "" {
+		status, style = ed.textErr, styleTextError
+		if ed.textErrLine > 0 {
+			status = fmt.Sprintf("line %d: %s", ed.textErrLine, ed.textErr)
+		}
+	}
+	ed.drawString(x0+2, bottom-1, truncate(status, paneW-3), style)
+}
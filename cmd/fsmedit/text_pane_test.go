@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func typeText(ed *Editor, s string) {
+	for _, r := range s {
+		if r == '\n' {
+			ed.handleTextKey(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+			continue
+		}
+		ed.handleTextKey(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+}
+
+func TestTextPane_AppliesEdits(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"idle", "busy"})
+	ed.fsm.Alphabet = []string{"go"}
+	ed.openTextPane()
+
+	// Type a new transition and state at the end.
+	ed.textRow = len(ed.textLines) - 1
+	ed.textCol = len(ed.textLines[ed.textRow])
+	typeText(ed, "\nidle -> busy on go\nbusy -> done on go")
+
+	if ed.textErr != "" {
+		t.Fatalf("line %d: %s\n%q", ed.textErrLine, ed.textErr, ed.textLines)
+	}
+	if len(ed.fsm.Transitions) != 2 || len(ed.fsm.States) != 3 {
+		t.Fatalf("states %v, transitions %+v", ed.fsm.States, ed.fsm.Transitions)
+	}
+	if ed.states[0] != (StatePos{Name: "idle", X: 5, Y: 5}) || ed.states[1] != (StatePos{Name: "busy", X: 20, Y: 9}) {
+		t.Errorf("positions not kept: %+v", ed.states)
+	}
+	// done goes next to busy, the only state it has a transition with.
+	if d := ed.states[2]; d.Name != "done" || d.X < 10 || d.X > 36 || d.Y < 5 || d.Y > 13 {
+		t.Errorf("new state not placed next to busy: %+v", ed.states)
+	}
+	if !ed.modified {
+		t.Error("not marked modified")
+	}
+	// The session is one undo step.
+	if len(ed.undoStack) != 1 {
+		t.Errorf("undo stack has %d entries", len(ed.undoStack))
+	}
+	ed.undo()
+	if len(ed.fsm.Transitions) != 0 || len(ed.states) != 2 {
+		t.Errorf("undo left %v, %+v", ed.fsm.States, ed.fsm.Transitions)
+	}
+}
+
+func TestTextPane_KeepsModelOnError(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"idle"})
+	ed.openTextPane()
+	ed.textRow = len(ed.textLines) - 1
+	ed.textCol = len(ed.textLines[ed.textRow])
+	typeText(ed, "\nstate \"idle")
+
+	if ed.textErr == "" || ed.textErrLine != len(ed.textLines) {
+		t.Errorf("error %q at line %d", ed.textErr, ed.textErrLine)
+	}
+	// "state " alone does not parse either, so nothing applied.
+	if len(ed.fsm.States) != 1 || ed.modified || len(ed.undoStack) != 0 {
+		t.Errorf("model changed: %v", ed.fsm.States)
+	}
+
+	ed.handleTextKey(tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone))
+	if ed.mode != ModeCanvas {
+		t.Errorf("mode %v after Esc", ed.mode)
+	}
+}
+
+func TestTextPane_WarnsOfEpsilonInDFA(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"idle", "busy"})
+	ed.openTextPane()
+	ed.textRow = len(ed.textLines) - 1
+	ed.textCol = len(ed.textLines[ed.textRow])
+	typeText(ed, "\nidle -> busy")
+
+	if len(ed.fsm.Transitions) != 1 {
+		t.Fatalf("transitions %+v", ed.fsm.Transitions)
+	}
+	if ed.messageType != MsgWarning {
+		t.Errorf("message %q, want a warning", ed.message)
+	}
+}
@@ -42,8 +42,12 @@ var (
 	styleStateInit  = tcell.StyleDefault.Foreground(tcell.ColorYellow).Bold(true)
 	styleStateAcc   = tcell.StyleDefault.Foreground(tcell.ColorPurple)
 	styleStateLinked = tcell.StyleDefault.Foreground(tcell.ColorFuchsia).Bold(true)
+	styleStateMarked = tcell.StyleDefault.Background(tcell.ColorOlive).Foreground(tcell.ColorBlack)
+	styleStateClosure = tcell.StyleDefault.Background(tcell.ColorTeal).Foreground(tcell.ColorBlack)
+	styleComposite   = tcell.StyleDefault.Foreground(tcell.ColorFuchsia)
 	styleTrans      = tcell.StyleDefault.Foreground(tcell.ColorTeal)
 	styleTransDrag  = tcell.StyleDefault.Foreground(tcell.NewRGBColor(200, 162, 200)) // Lilac
+	styleTransEpsilon = tcell.StyleDefault.Foreground(tcell.ColorTeal).Dim(true)
 	styleNet        = tcell.StyleDefault.Foreground(tcell.ColorOrange)
 	styleNetPower   = tcell.StyleDefault.Foreground(tcell.NewRGBColor(120, 90, 60))   // Dim brown
 	styleNetLabel   = tcell.StyleDefault.Foreground(tcell.ColorOrange).Bold(true)
@@ -119,17 +123,6 @@ func normalizePairKey(a, b string) string {
 	return b + "->" + a
 }
 
-func (ed *Editor) drawLabel(x, y int, label string, canvasW, canvasH int, style tcell.Style) {
-	if y < 0 || y >= canvasH {
-		return
-	}
-	for i, r := range label {
-		if x+i >= 0 && x+i < canvasW {
-			ed.screen.SetContent(x+i, y, r, nil, style)
-		}
-	}
-}
-
 func (ed *Editor) drawBox(x, y, w, h int, style tcell.Style) {
 	// Corners
 	ed.screen.SetContent(x, y, '┌', nil, styleBorder)
@@ -244,6 +237,10 @@ func (ed *Editor) modeString() string {
 		return "SELECT OUTPUT"
 	case ModeHelp:
 		return "HELP"
+	case ModeText:
+		return "TEXT"
+	case ModeAcceptance:
+		return "ACCEPTANCE"
 	default:
 		return ""
 	}
@@ -255,10 +252,10 @@ func (ed *Editor) helpString() string {
 		return "↑↓:Select  Enter:Confirm  Esc:Canvas"
 	case ModeCanvas:
 		if len(ed.navStack) > 0 {
-			return "H:Help  Shift+←:Back  Space:Dive  Tab:Cycle  T:Trans  K:Link  G:Move  Del:Del  Esc:Menu"
+			return "H:Help  Shift+←:Back  Space:Dive  Tab:Cycle  T:Trans  K:Link  +:Mark  J:Group  G:Move  Esc:Menu"
 		}
 		if ed.isBundle {
-			return "H:Help  Space:Dive  Tab:Cycle  T:Trans  S:Initial  A:Accept  K:Link  G:Move  Del:Del  Esc:Menu"
+			return "H:Help  Space:Dive  Tab:Cycle  T:Trans  S:Initial  A:Accept  K:Link  +:Mark  J:Group  Esc:Menu"
 		}
 		return "H:Help  Enter:Add  Tab:Cycle  T:Trans  S:Initial  A:Accept  K:Link  G:Move  Del:Del  Esc:Menu"
 	case ModeInput:
@@ -280,6 +277,14 @@ func (ed *Editor) helpString() string {
 		return "↑↓:Select  Enter:Link  Esc:Cancel"
 	case ModeImportMachineSelect:
 		return "↑↓:Navigate  Space:Toggle  A:All  Enter:Import  Esc:Cancel"
+	case ModeUndoHistory:
+		return "↑↓:Select  Enter:Jump  Esc:Close"
+	case ModeTemplatePicker:
+		return "↑↓:Select  Enter:Insert at cursor  Esc:Cancel"
+	case ModeText:
+		return "Type to edit, applied as it parses  Ctrl+S:Save  Esc:Close"
+	case ModeAcceptance:
+		return "Type inputs [=> accept|reject]  Enter:Add/Edit  ↑↓:Select  Del:Remove  Tab:Canvas  Esc:Close"
 	default:
 		return "Ctrl+Z:Undo  Ctrl+Y:Redo"
 	}
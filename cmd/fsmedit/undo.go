@@ -2,6 +2,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
 
@@ -10,59 +12,15 @@ import (
 
 const maxUndoLevels = 50
 
-// saveSnapshot saves current state for undo
-func (ed *Editor) saveSnapshot() {
-	// Deep copy FSM
-	fsmCopy := &fsm.FSM{
-		Type:           ed.fsm.Type,
-		Name:           ed.fsm.Name,
-		Description:    ed.fsm.Description,
-		States:         make([]string, len(ed.fsm.States)),
-		Alphabet:       make([]string, len(ed.fsm.Alphabet)),
-		OutputAlphabet: make([]string, len(ed.fsm.OutputAlphabet)),
-		Transitions:    make([]fsm.Transition, len(ed.fsm.Transitions)),
-		Initial:        ed.fsm.Initial,
-		Accepting:      make([]string, len(ed.fsm.Accepting)),
-		StateOutputs:   make(map[string]string),
-		LinkedMachines: make(map[string]string),
-	}
-	copy(fsmCopy.States, ed.fsm.States)
-	copy(fsmCopy.Alphabet, ed.fsm.Alphabet)
-	copy(fsmCopy.OutputAlphabet, ed.fsm.OutputAlphabet)
-	copy(fsmCopy.Accepting, ed.fsm.Accepting)
-	for i, t := range ed.fsm.Transitions {
-		fsmCopy.Transitions[i] = fsm.Transition{
-			From: t.From,
-			To:   make([]string, len(t.To)),
-		}
-		copy(fsmCopy.Transitions[i].To, t.To)
-		if t.Input != nil {
-			inp := *t.Input
-			fsmCopy.Transitions[i].Input = &inp
-		}
-		if t.Output != nil {
-			out := *t.Output
-			fsmCopy.Transitions[i].Output = &out
-		}
-	}
-	for k, v := range ed.fsm.StateOutputs {
-		fsmCopy.StateOutputs[k] = v
-	}
-	for k, v := range ed.fsm.LinkedMachines {
-		fsmCopy.LinkedMachines[k] = v
-	}
+// saveSnapshot saves current state for undo, before the edit that label
+// describes (shown in the undo history)
+func (ed *Editor) saveSnapshot(label string) {
+	ed.pushSnapshot(label, "")
+}
 
-	// Deep copy nets
-	if len(ed.fsm.Nets) > 0 {
-		fsmCopy.Nets = make([]fsm.Net, len(ed.fsm.Nets))
-		for i, n := range ed.fsm.Nets {
-			fsmCopy.Nets[i] = fsm.Net{
-				Name:      n.Name,
-				Endpoints: make([]fsm.NetEndpoint, len(n.Endpoints)),
-			}
-			copy(fsmCopy.Nets[i].Endpoints, n.Endpoints)
-		}
-	}
+// pushSnapshot is saveSnapshot, with a key for coalescing.
+func (ed *Editor) pushSnapshot(label, key string) {
+	fsmCopy := ed.copyFSM()
 
 	// Copy state positions
 	statesCopy := make([]StatePos, len(ed.states))
@@ -71,6 +29,9 @@ func (ed *Editor) saveSnapshot() {
 	snapshot := Snapshot{
 		FSM:    fsmCopy,
 		States: statesCopy,
+		Label:  label,
+		Time:   time.Now(),
+		Key:    key,
 	}
 
 	ed.undoStack = append(ed.undoStack, snapshot)
@@ -82,111 +43,119 @@ func (ed *Editor) saveSnapshot() {
 	ed.redoStack = nil
 }
 
+// commitMove records the move of state idx from (origX, origY) to where
+// it is now as an undo step, once the drag or keyboard move is over, and
+// reports whether it moved. Moving a state again straight after extends
+// the same step rather than adding another, and a move that ends where it
+// began adds nothing, so the redo stack survives it.
+func (ed *Editor) commitMove(idx, origX, origY int) bool {
+	if idx < 0 || idx >= len(ed.states) {
+		return false
+	}
+	sp := ed.states[idx]
+	if sp.X == origX && sp.Y == origY {
+		return false
+	}
+	key := "move " + sp.Name
+	if n := len(ed.undoStack); n > 0 && len(ed.redoStack) == 0 && ed.undoStack[n-1].Key == key {
+		ed.undoStack[n-1].Time = time.Now()
+		return true
+	}
+	ed.states[idx].X, ed.states[idx].Y = origX, origY
+	ed.pushSnapshot("Moved "+sp.Name, key)
+	ed.states[idx] = sp
+	return true
+}
+
 func (ed *Editor) undo() {
-	if len(ed.undoStack) == 0 {
+	if !ed.stepUndo() {
 		ed.showMessage("Nothing to undo", MsgInfo)
 		return
 	}
+	ed.showMessage("Undo", MsgInfo)
+}
 
-	// Save current state to redo stack
-	ed.saveToRedo()
+func (ed *Editor) redo() {
+	if !ed.stepRedo() {
+		ed.showMessage("Nothing to redo", MsgInfo)
+		return
+	}
+	ed.showMessage("Redo", MsgInfo)
+}
+
+// stepUndo restores the newest undo snapshot, reporting whether there was
+// one. The current state goes on the redo stack, carrying the label and
+// time of the edit being undone.
+func (ed *Editor) stepUndo() bool {
+	if len(ed.undoStack) == 0 {
+		return false
+	}
 
 	// Pop from undo stack
 	snapshot := ed.undoStack[len(ed.undoStack)-1]
 	ed.undoStack = ed.undoStack[:len(ed.undoStack)-1]
 
+	// Save current state to redo stack
+	ed.saveToRedo(snapshot)
+
 	// Restore
 	ed.fsm = snapshot.FSM
 	ed.states = snapshot.States
 	ed.modified = true
 	ed.selectedState = -1
-
-	ed.showMessage("Undo", MsgInfo)
+	return true
 }
 
-func (ed *Editor) redo() {
+// stepRedo restores the newest redo snapshot, reporting whether there was
+// one.
+func (ed *Editor) stepRedo() bool {
 	if len(ed.redoStack) == 0 {
-		ed.showMessage("Nothing to redo", MsgInfo)
-		return
+		return false
 	}
 
-	// Save current state to undo stack (without clearing redo)
-	ed.saveToUndo()
-
 	// Pop from redo stack
 	snapshot := ed.redoStack[len(ed.redoStack)-1]
 	ed.redoStack = ed.redoStack[:len(ed.redoStack)-1]
 
+	// Save current state to undo stack (without clearing redo)
+	ed.saveToUndo(snapshot)
+
 	// Restore
 	ed.fsm = snapshot.FSM
 	ed.states = snapshot.States
 	ed.modified = true
 	ed.selectedState = -1
+	return true
+}
 
-	ed.showMessage("Redo", MsgInfo)
+// saveToUndo pushes the current state on the undo stack, with the label,
+// time, and key of the edit from (the redo snapshot) to.
+func (ed *Editor) saveToUndo(to Snapshot) {
+	ed.undoStack = append(ed.undoStack, ed.currentSnapshot(to))
 }
 
-func (ed *Editor) saveToUndo() {
-	fsmCopy := ed.copyFSM()
-	statesCopy := make([]StatePos, len(ed.states))
-	copy(statesCopy, ed.states)
-	ed.undoStack = append(ed.undoStack, Snapshot{FSM: fsmCopy, States: statesCopy})
+// saveToRedo pushes the current state on the redo stack, with the label,
+// time, and key of the edit from (the undo snapshot) from.
+func (ed *Editor) saveToRedo(from Snapshot) {
+	ed.redoStack = append(ed.redoStack, ed.currentSnapshot(from))
 }
 
-func (ed *Editor) saveToRedo() {
-	fsmCopy := ed.copyFSM()
+// currentSnapshot copies the current state, taking the edit details of
+// the snapshot next to it.
+func (ed *Editor) currentSnapshot(edit Snapshot) Snapshot {
 	statesCopy := make([]StatePos, len(ed.states))
 	copy(statesCopy, ed.states)
-	ed.redoStack = append(ed.redoStack, Snapshot{FSM: fsmCopy, States: statesCopy})
+	return Snapshot{
+		FSM:    ed.copyFSM(),
+		States: statesCopy,
+		Label:  edit.Label,
+		Time:   edit.Time,
+		Key:    edit.Key,
+	}
 }
 
+// copyFSM deep-copies the machine for an undo or redo snapshot,
+// including classes, properties, and nets.
 func (ed *Editor) copyFSM() *fsm.FSM {
-	fsmCopy := &fsm.FSM{
-		Type:           ed.fsm.Type,
-		Name:           ed.fsm.Name,
-		Description:    ed.fsm.Description,
-		States:         make([]string, len(ed.fsm.States)),
-		Alphabet:       make([]string, len(ed.fsm.Alphabet)),
-		OutputAlphabet: make([]string, len(ed.fsm.OutputAlphabet)),
-		Transitions:    make([]fsm.Transition, len(ed.fsm.Transitions)),
-		Initial:        ed.fsm.Initial,
-		Accepting:      make([]string, len(ed.fsm.Accepting)),
-		StateOutputs:   make(map[string]string),
-	}
-	copy(fsmCopy.States, ed.fsm.States)
-	copy(fsmCopy.Alphabet, ed.fsm.Alphabet)
-	copy(fsmCopy.OutputAlphabet, ed.fsm.OutputAlphabet)
-	copy(fsmCopy.Accepting, ed.fsm.Accepting)
-	for i, t := range ed.fsm.Transitions {
-		fsmCopy.Transitions[i] = fsm.Transition{
-			From: t.From,
-			To:   make([]string, len(t.To)),
-		}
-		copy(fsmCopy.Transitions[i].To, t.To)
-		if t.Input != nil {
-			inp := *t.Input
-			fsmCopy.Transitions[i].Input = &inp
-		}
-		if t.Output != nil {
-			out := *t.Output
-			fsmCopy.Transitions[i].Output = &out
-		}
-	}
-	for k, v := range ed.fsm.StateOutputs {
-		fsmCopy.StateOutputs[k] = v
-	}
-
-	// Deep copy nets
-	if len(ed.fsm.Nets) > 0 {
-		fsmCopy.Nets = make([]fsm.Net, len(ed.fsm.Nets))
-		for i, n := range ed.fsm.Nets {
-			fsmCopy.Nets[i] = fsm.Net{
-				Name:      n.Name,
-				Endpoints: make([]fsm.NetEndpoint, len(n.Endpoints)),
-			}
-			copy(fsmCopy.Nets[i].Endpoints, n.Endpoints)
-		}
-	}
-
-	return fsmCopy
+	return ed.fsm.Clone()
 }
@@ -11,7 +11,7 @@ func TestEditorUndo_Basic(t *testing.T) {
 	ed.fsm.AddTransition("s0", strPtr("a"), []string{"s1"}, nil)
 
 	// Take snapshot, then modify
-	ed.saveSnapshot()
+	ed.saveSnapshot("edit")
 	ed.fsm.States = append(ed.fsm.States, "s2")
 	ed.states = append(ed.states, StatePos{Name: "s2", X: 40, Y: 10})
 
@@ -32,7 +32,7 @@ func TestEditorUndo_Basic(t *testing.T) {
 func TestEditorRedo(t *testing.T) {
 	ed := newTestEditorWithStates([]string{"s0", "s1"})
 
-	ed.saveSnapshot()
+	ed.saveSnapshot("edit")
 	ed.fsm.States = append(ed.fsm.States, "s2")
 	ed.states = append(ed.states, StatePos{Name: "s2", X: 40, Y: 10})
 
@@ -52,7 +52,7 @@ func TestEditorUndo_StackLimit(t *testing.T) {
 
 	// Push more than maxUndoLevels snapshots
 	for i := 0; i < maxUndoLevels+10; i++ {
-		ed.saveSnapshot()
+		ed.saveSnapshot("edit")
 	}
 
 	if len(ed.undoStack) > maxUndoLevels {
@@ -63,13 +63,13 @@ func TestEditorUndo_StackLimit(t *testing.T) {
 func TestEditorUndo_NewActionClearsRedo(t *testing.T) {
 	ed := newTestEditorWithStates([]string{"s0", "s1"})
 
-	ed.saveSnapshot()
+	ed.saveSnapshot("edit")
 	ed.fsm.States = append(ed.fsm.States, "s2")
 
 	ed.undo()
 
 	// Now take a new action (should clear redo stack)
-	ed.saveSnapshot()
+	ed.saveSnapshot("edit")
 	ed.fsm.States = append(ed.fsm.States, "s3")
 
 	if len(ed.redoStack) != 0 {
@@ -124,7 +124,7 @@ func TestEditorUndo_PreservesPositions(t *testing.T) {
 	ed.states[0] = StatePos{Name: "s0", X: 10, Y: 20}
 	ed.states[1] = StatePos{Name: "s1", X: 30, Y: 40}
 
-	ed.saveSnapshot()
+	ed.saveSnapshot("edit")
 
 	// Move s0
 	ed.states[0] = StatePos{Name: "s0", X: 50, Y: 60}
@@ -135,3 +135,67 @@ func TestEditorUndo_PreservesPositions(t *testing.T) {
 		t.Errorf("s0 position not restored: got (%d,%d), want (10,20)", ed.states[0].X, ed.states[0].Y)
 	}
 }
+
+// moveState moves state i to (x, y) as a drag would, recording the move.
+func moveState(ed *Editor, i, x, y int) {
+	origX, origY := ed.states[i].X, ed.states[i].Y
+	ed.states[i].X, ed.states[i].Y = x, y
+	ed.commitMove(i, origX, origY)
+}
+
+func TestCommitMove_CoalescesSameState(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"s0", "s1"})
+	moveState(ed, 0, 10, 10)
+	moveState(ed, 0, 20, 12)
+	moveState(ed, 0, 30, 14)
+	if len(ed.undoStack) != 1 {
+		t.Fatalf("three moves of s0 made %d undo steps, want 1", len(ed.undoStack))
+	}
+	if got := ed.undoStack[0].Label; got != "Moved s0" {
+		t.Errorf("label = %q", got)
+	}
+
+	moveState(ed, 1, 40, 40)
+	moveState(ed, 0, 50, 50)
+	if len(ed.undoStack) != 3 {
+		t.Errorf("moves of s0, s1, s0 made %d undo steps, want 3", len(ed.undoStack))
+	}
+
+	ed.undo()
+	ed.undo()
+	ed.undo()
+	if sp := ed.states[0]; sp.X != 5 || sp.Y != 5 {
+		t.Errorf("s0 at (%d,%d) after undoing every move, want (5,5)", sp.X, sp.Y)
+	}
+}
+
+func TestCommitMove_KeepsRedo(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"s0"})
+	moveState(ed, 0, 10, 10)
+	ed.undo()
+
+	// A drag that ends where it began records nothing.
+	moveState(ed, 0, 5, 5)
+	if len(ed.redoStack) != 1 || len(ed.undoStack) != 0 {
+		t.Fatalf("no-op move left %d undo, %d redo; want 0, 1", len(ed.undoStack), len(ed.redoStack))
+	}
+
+	// A real move after an undo is a new step, not part of the undone one.
+	moveState(ed, 0, 20, 20)
+	if len(ed.undoStack) != 1 || len(ed.redoStack) != 0 {
+		t.Errorf("move after undo left %d undo, %d redo; want 1, 0", len(ed.undoStack), len(ed.redoStack))
+	}
+}
+
+func TestUndoRedo_CarryLabels(t *testing.T) {
+	ed := newTestEditorWithStates([]string{"s0"})
+	ed.addStateAtPosition(20, 5)
+	ed.undo()
+	if got := ed.redoStack[0].Label; got != "Added state S1" {
+		t.Errorf("redo label = %q", got)
+	}
+	ed.redo()
+	if got := ed.undoStack[0].Label; got != "Added state S1" {
+		t.Errorf("undo label after redo = %q", got)
+	}
+}
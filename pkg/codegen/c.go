@@ -4,25 +4,84 @@ package codegen
 import (
 	"fmt"
 	"strings"
-	"unicode"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
 
+// COptions control the C generator.
+type COptions struct {
+	// Prefix replaces the machine name at the start of every generated
+	// identifier: lower case as given for types and functions, upper
+	// case for macros. It is sanitised like machine names.
+	Prefix string
+
+	// Split generates a header with the declarations and a separate
+	// source file with the implementation, instead of a single
+	// header-only library.
+	Split bool
+
+	// Header is the file name the source file includes when Split is
+	// set (default: "<prefix>.h").
+	Header string
+
+	// MISRA generates code in a style suited to MISRA C reviews:
+	// unsigned constants carry a U suffix, every function has a single
+	// exit, every switch clause ends in break, every if body is braced,
+	// and functions that only read the machine take a const pointer.
+	MISRA bool
+}
+
 // GenerateC generates C code for the FSM.
 // If the FSM is an NFA, it is first converted to a DFA.
 func GenerateC(f *fsm.FSM) string {
+	header, _ := generateC(f, 0, false, COptions{})
+	return header
+}
+
+// GenerateCWithOptions is GenerateC with options. It returns the header
+// and, if opts.Split is set, the source file implementing it; otherwise
+// the header is a header-only library and source is empty.
+func GenerateCWithOptions(f *fsm.FSM, opts COptions) (header, source string) {
+	return generateC(f, 0, false, opts)
+}
+
+// generateC generates C code for the FSM, with a conformance monitor
+// keeping historySize events if historySize is positive, and with
+// next_token if scanner is set.
+func generateC(f *fsm.FSM, historySize int, scanner bool, opts COptions) (string, string) {
 	// Convert NFA to DFA for code generation
 	if f.Type == fsm.TypeNFA {
 		f = f.ToDFA()
 	}
+	f, classes := inputClasses(f)
 
 	var sb strings.Builder
 	name := sanitizeName(f.Name)
+	if opts.Prefix != "" {
+		name = sanitizeName(opts.Prefix)
+	}
 	if name == "" {
 		name = "fsm"
 	}
 	NAME := strings.ToUpper(name)
+	ix := fsm.NewTransitionIndex(f)
+	ids := newIdentifiers(f, cIdent)
+	// Unknown names get 0 so that generated code stays compilable.
+	enc, note := encoding(f)
+
+	// lit writes a value as a C constant.
+	lit := func(v int) string {
+		if opts.MISRA {
+			return fmt.Sprintf("%dU", v)
+		}
+		return fmt.Sprint(v)
+	}
+	// Functions that only read the machine take a const pointer in
+	// MISRA style.
+	readOnly := ""
+	if opts.MISRA {
+		readOnly = "const "
+	}
 
 	// Header
 	sb.WriteString(fmt.Sprintf(`// Generated FSM: %s
@@ -33,8 +92,17 @@ func GenerateC(f *fsm.FSM) string {
 
 #include <stdint.h>
 #include <stdbool.h>
-
-`, f.Name, f.Type, NAME, NAME))
+`, commentSafe(f.Name), f.Type, NAME, NAME))
+	if opts.MISRA || scanner {
+		sb.WriteString("#include <stddef.h>\n")
+	}
+	sb.WriteString("\n")
+	if note != "" {
+		sb.WriteString("// Note: " + note + "\n\n")
+	}
+	ids.writeTable(&sb, func(kind, ident string) string {
+		return NAME + "_" + strings.ToUpper(kind) + "_" + ident
+	})
 
 	// Types - simple uint16_t
 	sb.WriteString(fmt.Sprintf("typedef uint16_t %s_state_t;\n", name))
@@ -46,23 +114,23 @@ func GenerateC(f *fsm.FSM) string {
 
 	// State constants
 	sb.WriteString("// States\n")
-	for i, state := range f.States {
-		sb.WriteString(fmt.Sprintf("#define %s_STATE_%s %d\n", NAME, strings.ToUpper(sanitizeName(state)), i))
+	for _, state := range f.States {
+		sb.WriteString(fmt.Sprintf("#define %s_STATE_%s %s\n", NAME, ids.States[state], lit(enc.States[state])))
 	}
 	sb.WriteString("\n")
 
 	// Input constants
 	sb.WriteString("// Inputs\n")
-	for i, input := range f.Alphabet {
-		sb.WriteString(fmt.Sprintf("#define %s_INPUT_%s %d\n", NAME, strings.ToUpper(sanitizeName(input)), i))
+	for _, input := range f.Alphabet {
+		sb.WriteString(fmt.Sprintf("#define %s_INPUT_%s %s\n", NAME, ids.Inputs[input], lit(enc.Inputs[input])))
 	}
 	sb.WriteString("\n")
 
 	// Output constants (if applicable)
 	if len(f.OutputAlphabet) > 0 {
 		sb.WriteString("// Outputs\n")
-		for i, output := range f.OutputAlphabet {
-			sb.WriteString(fmt.Sprintf("#define %s_OUTPUT_%s %d\n", NAME, strings.ToUpper(sanitizeName(output)), i))
+		for _, output := range f.OutputAlphabet {
+			sb.WriteString(fmt.Sprintf("#define %s_OUTPUT_%s %s\n", NAME, ids.Outputs[output], lit(enc.Outputs[output])))
 		}
 		sb.WriteString("\n")
 	}
@@ -78,10 +146,10 @@ func GenerateC(f *fsm.FSM) string {
 
 	// Counts
 	sb.WriteString("// Counts\n")
-	sb.WriteString(fmt.Sprintf("#define %s_STATE_COUNT %d\n", NAME, len(f.States)))
-	sb.WriteString(fmt.Sprintf("#define %s_INPUT_COUNT %d\n", NAME, len(f.Alphabet)))
+	sb.WriteString(fmt.Sprintf("#define %s_STATE_COUNT %s\n", NAME, lit(len(f.States))))
+	sb.WriteString(fmt.Sprintf("#define %s_INPUT_COUNT %s\n", NAME, lit(len(f.Alphabet))))
 	if len(f.OutputAlphabet) > 0 {
-		sb.WriteString(fmt.Sprintf("#define %s_OUTPUT_COUNT %d\n", NAME, len(f.OutputAlphabet)))
+		sb.WriteString(fmt.Sprintf("#define %s_OUTPUT_COUNT %s\n", NAME, lit(len(f.OutputAlphabet))))
 	}
 	sb.WriteString("\n")
 
@@ -96,17 +164,17 @@ func GenerateC(f *fsm.FSM) string {
 	sb.WriteString(fmt.Sprintf("bool %s_step(%s_t *fsm, %s_input_t input);\n\n", name, name, name))
 
 	sb.WriteString("// Check if input is valid from current state (without transitioning)\n")
-	sb.WriteString(fmt.Sprintf("bool %s_can_step(%s_t *fsm, %s_input_t input);\n\n", name, name, name))
+	sb.WriteString(fmt.Sprintf("bool %s_can_step(%s%s_t *fsm, %s_input_t input);\n\n", name, readOnly, name, name))
 
 	sb.WriteString("// Check if current state is accepting\n")
-	sb.WriteString(fmt.Sprintf("bool %s_is_accepting(%s_t *fsm);\n\n", name, name))
+	sb.WriteString(fmt.Sprintf("bool %s_is_accepting(%s%s_t *fsm);\n\n", name, readOnly, name))
 
 	sb.WriteString("// Get current state\n")
-	sb.WriteString(fmt.Sprintf("%s_state_t %s_get_state(%s_t *fsm);\n\n", name, name, name))
+	sb.WriteString(fmt.Sprintf("%s_state_t %s_get_state(%s%s_t *fsm);\n\n", name, name, readOnly, name))
 
 	if f.Type == fsm.TypeMoore || f.Type == fsm.TypeMealy {
 		sb.WriteString("// Get current output\n")
-		sb.WriteString(fmt.Sprintf("%s_output_t %s_get_output(%s_t *fsm);\n\n", name, name, name))
+		sb.WriteString(fmt.Sprintf("%s_output_t %s_get_output(%s%s_t *fsm);\n\n", name, name, readOnly, name))
 	}
 
 	sb.WriteString("// Get state name (for debugging)\n")
@@ -120,60 +188,129 @@ func GenerateC(f *fsm.FSM) string {
 		sb.WriteString(fmt.Sprintf("const char* %s_output_name(%s_output_t output);\n\n", name, name))
 	}
 
-	sb.WriteString("#endif // " + NAME + "_H\n\n")
+	if classes != nil || scanner {
+		writeCClassifyDecls(&sb, name)
+	}
+	if scanner {
+		writeCScannerDecls(&sb, name)
+	}
+
+	if historySize > 0 {
+		writeCMonitorDecls(&sb, name, NAME, historySize)
+	}
 
-	// Implementation
-	sb.WriteString("// ---- Implementation ----\n")
-	sb.WriteString("#ifdef " + NAME + "_IMPLEMENTATION\n\n")
+	var header string
+	if opts.Split {
+		sb.WriteString("#endif // " + NAME + "_H\n")
+		header = sb.String()
+		sb.Reset()
 
+		include := opts.Header
+		if include == "" {
+			include = name + ".h"
+		}
+		sb.WriteString(fmt.Sprintf("// Generated FSM: %s\n// Type: %s\n\n", commentSafe(f.Name), f.Type))
+		sb.WriteString(fmt.Sprintf("#include \"%s\"\n\n", include))
+	} else {
+		sb.WriteString("#endif // " + NAME + "_H\n\n")
+
+		// Implementation
+		sb.WriteString("// ---- Implementation ----\n")
+		sb.WriteString("#ifdef " + NAME + "_IMPLEMENTATION\n\n")
+	}
 	// Init function
 	sb.WriteString(fmt.Sprintf("void %s_init(%s_t *fsm) {\n", name, name))
-	initialIdx := stateIndex(f, f.Initial)
-	sb.WriteString(fmt.Sprintf("    fsm->state = %d;\n", initialIdx))
+	initialIdx := enc.States[f.Initial]
+	sb.WriteString(fmt.Sprintf("    fsm->state = %s;\n", lit(initialIdx)))
 	if f.Type == fsm.TypeMoore {
 		if out, ok := f.StateOutputs[f.Initial]; ok {
-			outIdx := outputIndex(f, out)
-			sb.WriteString(fmt.Sprintf("    fsm->output = %d;\n", outIdx))
+			outIdx := enc.Outputs[out]
+			sb.WriteString(fmt.Sprintf("    fsm->output = %s;\n", lit(outIdx)))
 		} else {
-			sb.WriteString("    fsm->output = 0;\n")
+			sb.WriteString(fmt.Sprintf("    fsm->output = %s;\n", lit(0)))
 		}
 	} else if f.Type == fsm.TypeMealy {
-		sb.WriteString("    fsm->output = 0;\n")
+		sb.WriteString(fmt.Sprintf("    fsm->output = %s;\n", lit(0)))
+	}
+	sb.WriteString("}\n\n")
+
+	if opts.MISRA {
+		writeCMISRADispatch(&sb, f, ix, enc, name)
+	} else {
+		writeCDispatch(&sb, f, ix, enc, name)
+	}
+
+	// Get state function
+	sb.WriteString(fmt.Sprintf("%s_state_t %s_get_state(%s%s_t *fsm) {\n", name, name, readOnly, name))
+	sb.WriteString("    return fsm->state;\n")
+	sb.WriteString("}\n\n")
+
+	// Get output function
+	if f.Type == fsm.TypeMoore || f.Type == fsm.TypeMealy {
+		sb.WriteString(fmt.Sprintf("%s_output_t %s_get_output(%s%s_t *fsm) {\n", name, name, readOnly, name))
+		sb.WriteString("    return fsm->output;\n")
+		sb.WriteString("}\n\n")
 	}
+
+	// Reset function
+	sb.WriteString(fmt.Sprintf("void %s_reset(%s_t *fsm) {\n", name, name))
+	sb.WriteString(fmt.Sprintf("    %s_init(fsm);\n", name))
 	sb.WriteString("}\n\n")
 
+	if classes != nil || scanner {
+		writeCClassify(&sb, f, ids, name, classes, opts.MISRA)
+	}
+	if scanner {
+		writeCScanner(&sb, name, opts.MISRA)
+	}
+
+	// Name lookups
+	writeCNames(&sb, name, "state", f.States, enc.States, opts.MISRA)
+	writeCNames(&sb, name, "input", f.Alphabet, enc.Inputs, opts.MISRA)
+	if len(f.OutputAlphabet) > 0 {
+		writeCNames(&sb, name, "output", f.OutputAlphabet, enc.Outputs, opts.MISRA)
+	}
+
+	if historySize > 0 {
+		writeCMonitorImpl(&sb, name, NAME)
+	}
+
+	if opts.Split {
+		return header, strings.TrimSuffix(sb.String(), "\n")
+	}
+	sb.WriteString("#endif // " + NAME + "_IMPLEMENTATION\n")
+	return sb.String(), ""
+}
+
+// writeCDispatch writes the step, can_step, and is_accepting functions
+// as switches that return from each case.
+func writeCDispatch(sb *strings.Builder, f *fsm.FSM, ix *fsm.TransitionIndex, enc *fsm.Encoding, name string) {
 	// Step function
 	sb.WriteString(fmt.Sprintf("bool %s_step(%s_t *fsm, %s_input_t input) {\n", name, name, name))
 	sb.WriteString("    switch (fsm->state) {\n")
 
-	// Group transitions by from state
-	transByState := make(map[string][]fsm.Transition)
-	for _, t := range f.Transitions {
-		transByState[t.From] = append(transByState[t.From], t)
-	}
-
 	for _, state := range f.States {
-		stateIdx := stateIndex(f, state)
-		sb.WriteString(fmt.Sprintf("    case %d: // %s\n", stateIdx, state))
+		stateIdx := enc.States[state]
+		sb.WriteString(fmt.Sprintf("    case %d: // %s\n", stateIdx, commentSafe(state)))
 		sb.WriteString("        switch (input) {\n")
 
-		if trans, ok := transByState[state]; ok {
+		if trans := ix.From(state); len(trans) > 0 {
 			for _, t := range trans {
 				if t.Input == nil {
 					continue // skip epsilon transitions
 				}
 				if len(t.To) > 0 {
-					inputIdx := inputIndex(f, *t.Input)
-					toIdx := stateIndex(f, t.To[0])
-					sb.WriteString(fmt.Sprintf("        case %d: // %s\n", inputIdx, *t.Input))
+					inputIdx := enc.Inputs[*t.Input]
+					toIdx := enc.States[t.To[0]]
+					sb.WriteString(fmt.Sprintf("        case %d: // %s\n", inputIdx, commentSafe(*t.Input)))
 					sb.WriteString(fmt.Sprintf("            fsm->state = %d;\n", toIdx))
 					if f.Type == fsm.TypeMoore {
 						if out, ok := f.StateOutputs[t.To[0]]; ok {
-							outIdx := outputIndex(f, out)
+							outIdx := enc.Outputs[out]
 							sb.WriteString(fmt.Sprintf("            fsm->output = %d;\n", outIdx))
 						}
 					} else if f.Type == fsm.TypeMealy && t.Output != nil {
-						outIdx := outputIndex(f, *t.Output)
+						outIdx := enc.Outputs[*t.Output]
 						sb.WriteString(fmt.Sprintf("            fsm->output = %d;\n", outIdx))
 					}
 					sb.WriteString("            return true;\n")
@@ -196,16 +333,16 @@ func GenerateC(f *fsm.FSM) string {
 	sb.WriteString("    switch (fsm->state) {\n")
 
 	for _, state := range f.States {
-		stateIdx := stateIndex(f, state)
+		stateIdx := enc.States[state]
 		sb.WriteString(fmt.Sprintf("    case %d:\n", stateIdx))
 		sb.WriteString("        switch (input) {\n")
 
-		if trans, ok := transByState[state]; ok {
+		if trans := ix.From(state); len(trans) > 0 {
 			for _, t := range trans {
 				if t.Input == nil || len(t.To) == 0 {
 					continue
 				}
-				inputIdx := inputIndex(f, *t.Input)
+				inputIdx := enc.Inputs[*t.Input]
 				sb.WriteString(fmt.Sprintf("        case %d: return true;\n", inputIdx))
 			}
 		}
@@ -224,8 +361,8 @@ func GenerateC(f *fsm.FSM) string {
 	if len(f.Accepting) > 0 {
 		sb.WriteString("    switch (fsm->state) {\n")
 		for _, acc := range f.Accepting {
-			accIdx := stateIndex(f, acc)
-			sb.WriteString(fmt.Sprintf("    case %d: // %s\n", accIdx, acc))
+			accIdx := enc.States[acc]
+			sb.WriteString(fmt.Sprintf("    case %d: // %s\n", accIdx, commentSafe(acc)))
 		}
 		sb.WriteString("        return true;\n")
 		sb.WriteString("    default:\n")
@@ -235,115 +372,176 @@ func GenerateC(f *fsm.FSM) string {
 		sb.WriteString("    return false;\n")
 	}
 	sb.WriteString("}\n\n")
+}
 
-	// Get state function
-	sb.WriteString(fmt.Sprintf("%s_state_t %s_get_state(%s_t *fsm) {\n", name, name, name))
-	sb.WriteString("    return fsm->state;\n")
-	sb.WriteString("}\n\n")
-
-	// Get output function
-	if f.Type == fsm.TypeMoore || f.Type == fsm.TypeMealy {
-		sb.WriteString(fmt.Sprintf("%s_output_t %s_get_output(%s_t *fsm) {\n", name, name, name))
-		sb.WriteString("    return fsm->output;\n")
-		sb.WriteString("}\n\n")
+// writeCMISRADispatch writes the step, can_step, and is_accepting
+// functions in MISRA style: a single exit, and a break at the end of
+// every switch clause.
+func writeCMISRADispatch(sb *strings.Builder, f *fsm.FSM, ix *fsm.TransitionIndex, enc *fsm.Encoding, name string) {
+	// Step function
+	sb.WriteString(fmt.Sprintf("bool %s_step(%s_t *fsm, %s_input_t input) {\n", name, name, name))
+	sb.WriteString("    bool moved = false;\n\n")
+	sb.WriteString("    switch (fsm->state) {\n")
+	for _, state := range f.States {
+		sb.WriteString(fmt.Sprintf("    case %dU: // %s\n", enc.States[state], commentSafe(state)))
+		var cases []string
+		for _, t := range ix.From(state) {
+			if t.Input == nil || len(t.To) == 0 {
+				continue // skip epsilon transitions
+			}
+			var c strings.Builder
+			c.WriteString(fmt.Sprintf("        case %dU: // %s\n", enc.Inputs[*t.Input], commentSafe(*t.Input)))
+			c.WriteString(fmt.Sprintf("            fsm->state = %dU;\n", enc.States[t.To[0]]))
+			if f.Type == fsm.TypeMoore {
+				if out, ok := f.StateOutputs[t.To[0]]; ok {
+					c.WriteString(fmt.Sprintf("            fsm->output = %dU;\n", enc.Outputs[out]))
+				}
+			} else if f.Type == fsm.TypeMealy && t.Output != nil {
+				c.WriteString(fmt.Sprintf("            fsm->output = %dU;\n", enc.Outputs[*t.Output]))
+			}
+			c.WriteString("            moved = true;\n")
+			c.WriteString("            break;\n")
+			cases = append(cases, c.String())
+		}
+		writeCMISRAInputSwitch(sb, cases)
+		sb.WriteString("        break;\n")
 	}
-
-	// Reset function
-	sb.WriteString(fmt.Sprintf("void %s_reset(%s_t *fsm) {\n", name, name))
-	sb.WriteString(fmt.Sprintf("    %s_init(fsm);\n", name))
+	sb.WriteString("    default:\n")
+	sb.WriteString("        break;\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("    return moved;\n")
 	sb.WriteString("}\n\n")
 
-	// State name lookup
-	sb.WriteString(fmt.Sprintf("static const char* %s_state_names[] = {\n", name))
+	// Can step function (same logic as step but without side effects)
+	sb.WriteString(fmt.Sprintf("bool %s_can_step(const %s_t *fsm, %s_input_t input) {\n", name, name, name))
+	sb.WriteString("    bool valid = false;\n\n")
+	sb.WriteString("    switch (fsm->state) {\n")
 	for _, state := range f.States {
-		sb.WriteString(fmt.Sprintf("    \"%s\",\n", state))
+		sb.WriteString(fmt.Sprintf("    case %dU: // %s\n", enc.States[state], commentSafe(state)))
+		var cases []string
+		for _, t := range ix.From(state) {
+			if t.Input == nil || len(t.To) == 0 {
+				continue
+			}
+			cases = append(cases, fmt.Sprintf("        case %dU:\n            valid = true;\n            break;\n", enc.Inputs[*t.Input]))
+		}
+		writeCMISRAInputSwitch(sb, cases)
+		sb.WriteString("        break;\n")
 	}
-	sb.WriteString("};\n\n")
-
-	sb.WriteString(fmt.Sprintf("const char* %s_state_name(%s_state_t state) {\n", name, name))
-	sb.WriteString(fmt.Sprintf("    if (state < %s_STATE_COUNT) return %s_state_names[state];\n", NAME, name))
-	sb.WriteString("    return \"unknown\";\n")
+	sb.WriteString("    default:\n")
+	sb.WriteString("        break;\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("    return valid;\n")
 	sb.WriteString("}\n\n")
 
-	// Input name lookup
-	sb.WriteString(fmt.Sprintf("static const char* %s_input_names[] = {\n", name))
-	for _, input := range f.Alphabet {
-		sb.WriteString(fmt.Sprintf("    \"%s\",\n", input))
+	// Is accepting function
+	sb.WriteString(fmt.Sprintf("bool %s_is_accepting(const %s_t *fsm) {\n", name, name))
+	if len(f.Accepting) > 0 {
+		sb.WriteString("    bool accepting = false;\n\n")
+		sb.WriteString("    switch (fsm->state) {\n")
+		for _, acc := range f.Accepting {
+			sb.WriteString(fmt.Sprintf("    case %dU: // %s\n", enc.States[acc], commentSafe(acc)))
+		}
+		sb.WriteString("        accepting = true;\n")
+		sb.WriteString("        break;\n")
+		sb.WriteString("    default:\n")
+		sb.WriteString("        break;\n")
+		sb.WriteString("    }\n")
+		sb.WriteString("    return accepting;\n")
+	} else {
+		sb.WriteString("    (void)fsm;\n")
+		sb.WriteString("    return false;\n")
 	}
-	sb.WriteString("};\n\n")
-
-	sb.WriteString(fmt.Sprintf("const char* %s_input_name(%s_input_t input) {\n", name, name))
-	sb.WriteString(fmt.Sprintf("    if (input < %s_INPUT_COUNT) return %s_input_names[input];\n", NAME, name))
-	sb.WriteString("    return \"unknown\";\n")
 	sb.WriteString("}\n\n")
+}
 
-	// Output name lookup
-	if len(f.OutputAlphabet) > 0 {
-		sb.WriteString(fmt.Sprintf("static const char* %s_output_names[] = {\n", name))
-		for _, output := range f.OutputAlphabet {
-			sb.WriteString(fmt.Sprintf("    \"%s\",\n", output))
-		}
-		sb.WriteString("};\n\n")
-
-		sb.WriteString(fmt.Sprintf("const char* %s_output_name(%s_output_t output) {\n", name, name))
-		sb.WriteString(fmt.Sprintf("    if (output < %s_OUTPUT_COUNT) return %s_output_names[output];\n", NAME, name))
-		sb.WriteString("    return \"unknown\";\n")
-		sb.WriteString("}\n\n")
+// writeCMISRAInputSwitch writes the switch on the input within one state,
+// given its cases. A state without transitions gets no switch, since a
+// switch with only a default clause is itself a MISRA violation.
+func writeCMISRAInputSwitch(sb *strings.Builder, cases []string) {
+	if len(cases) == 0 {
+		return
 	}
-
-	sb.WriteString("#endif // " + NAME + "_IMPLEMENTATION\n")
-
-	return sb.String()
+	sb.WriteString("        switch (input) {\n")
+	for _, c := range cases {
+		sb.WriteString(c)
+	}
+	sb.WriteString("        default:\n")
+	sb.WriteString("            break;\n")
+	sb.WriteString("        }\n")
 }
 
 // Helper functions
 
+// sanitizeName makes a machine name or prefix into a C identifier: its
+// words (see nameWords) joined by underscores, case kept.
 func sanitizeName(s string) string {
-	if s == "" {
-		return "unnamed"
-	}
-	var result strings.Builder
-	for i, r := range s {
-		if unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) || r == '_' {
-			result.WriteRune(r)
-		} else if r == ' ' || r == '-' {
-			result.WriteRune('_')
-		}
-	}
-	name := result.String()
+	name := strings.Join(nameWords(s, true), "_")
 	if name == "" {
 		return "unnamed"
 	}
-	// Ensure starts with letter
-	if unicode.IsDigit(rune(name[0])) {
-		name = "_" + name
-	}
-	return name
+	return identStart(name)
 }
 
-func stateIndex(f *fsm.FSM, state string) int {
-	for i, s := range f.States {
-		if s == state {
-			return i
+// writeCNames writes the name table and lookup function for one kind of
+// value ("state", "input", or "output"). When values are not positions
+// the table uses designated initializers and has gaps, which the lookup
+// reports as unknown. In MISRA style the lookup has a single exit.
+func writeCNames(sb *strings.Builder, name, kind string, names []string, values map[string]int, misra bool) {
+	NAME := strings.ToUpper(name)
+	positional := isPositional(names, values)
+	size := maxValue(names, values) + 1
+
+	if misra {
+		if positional {
+			sb.WriteString(fmt.Sprintf("static const char* const %s_%s_names[%s_%s_COUNT] = {\n", name, kind, NAME, strings.ToUpper(kind)))
+			for _, n := range names {
+				sb.WriteString(fmt.Sprintf("    %s,\n", cString(n)))
+			}
+		} else {
+			sb.WriteString(fmt.Sprintf("static const char* const %s_%s_names[%dU] = {\n", name, kind, size))
+			for _, n := range names {
+				sb.WriteString(fmt.Sprintf("    [%dU] = %s,\n", values[n], cString(n)))
+			}
 		}
-	}
-	return 0
-}
+		sb.WriteString("};\n\n")
 
-func inputIndex(f *fsm.FSM, input string) int {
-	for i, inp := range f.Alphabet {
-		if inp == input {
-			return i
+		sb.WriteString(fmt.Sprintf("const char* %s_%s_name(%s_%s_t %s) {\n", name, kind, name, kind, kind))
+		sb.WriteString("    const char* name = \"unknown\";\n\n")
+		if positional {
+			sb.WriteString(fmt.Sprintf("    if (%s < %s_%s_COUNT) {\n", kind, NAME, strings.ToUpper(kind)))
+		} else {
+			sb.WriteString(fmt.Sprintf("    if ((%s < %dU) && (%s_%s_names[%s] != NULL)) {\n", kind, size, name, kind, kind))
 		}
+		sb.WriteString(fmt.Sprintf("        name = %s_%s_names[%s];\n", name, kind, kind))
+		sb.WriteString("    }\n")
+		sb.WriteString("    return name;\n")
+		sb.WriteString("}\n\n")
+		return
 	}
-	return 0
-}
 
-func outputIndex(f *fsm.FSM, output string) int {
-	for i, out := range f.OutputAlphabet {
-		if out == output {
-			return i
+	if positional {
+		sb.WriteString(fmt.Sprintf("static const char* %s_%s_names[] = {\n", name, kind))
+		for _, n := range names {
+			sb.WriteString(fmt.Sprintf("    %s,\n", cString(n)))
 		}
+		sb.WriteString("};\n\n")
+
+		sb.WriteString(fmt.Sprintf("const char* %s_%s_name(%s_%s_t %s) {\n", name, kind, name, kind, kind))
+		sb.WriteString(fmt.Sprintf("    if (%s < %s_%s_COUNT) return %s_%s_names[%s];\n", kind, NAME, strings.ToUpper(kind), name, kind, kind))
+		sb.WriteString("    return \"unknown\";\n")
+		sb.WriteString("}\n\n")
+		return
+	}
+
+	sb.WriteString(fmt.Sprintf("static const char* %s_%s_names[%d] = {\n", name, kind, size))
+	for _, n := range names {
+		sb.WriteString(fmt.Sprintf("    [%d] = %s,\n", values[n], cString(n)))
 	}
-	return 0
+	sb.WriteString("};\n\n")
+
+	sb.WriteString(fmt.Sprintf("const char* %s_%s_name(%s_%s_t %s) {\n", name, kind, name, kind, kind))
+	sb.WriteString(fmt.Sprintf("    if (%s < %d && %s_%s_names[%s]) return %s_%s_names[%s];\n", kind, size, name, kind, kind, name, kind, kind))
+	sb.WriteString("    return \"unknown\";\n")
+	sb.WriteString("}\n\n")
 }
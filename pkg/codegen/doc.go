@@ -0,0 +1,127 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// DocHeader returns a comment block summarising f, for the top of code
+// generated from it, so that reviewers can check which model the code
+// corresponds to: the source file (if source is not empty), the machine's
+// fingerprint (see fsm.FSM.Fingerprint), its type, states, inputs, and
+// outputs, and its transition table. The summary describes f as given,
+// before any NFA is converted to a DFA.
+//
+// The block uses // line comments, which C, Go, and Rust all accept, and
+// ends with a blank line; prepend it to the generated code. In Go it
+// precedes the "Code generated" line, which is still recognised there.
+func DocHeader(f *fsm.FSM, source string) string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	add("Model summary")
+	if source != "" {
+		add("Source:      %s", commentSafe(source))
+	}
+	if f.Name != "" {
+		add("Machine:     %s", commentSafe(f.Name))
+	}
+	add("Fingerprint: %s", f.Fingerprint())
+	add("Type:        %s", f.Type)
+	add("Initial:     %s", commentSafe(f.Initial))
+	add("States:      %s", commentList(f.States))
+	if len(f.Accepting) > 0 {
+		add("Accepting:   %s", commentList(f.Accepting))
+	}
+	add("Inputs:      %s", commentList(f.Alphabet))
+	if len(f.OutputAlphabet) > 0 {
+		add("Outputs:     %s", commentList(f.OutputAlphabet))
+	}
+	if f.Type == fsm.TypeMoore && len(f.StateOutputs) > 0 {
+		add("")
+		add("State outputs:")
+		var tb strings.Builder
+		tw := tabwriter.NewWriter(&tb, 0, 0, 2, ' ', 0)
+		for _, s := range f.States {
+			if out, ok := f.StateOutputs[s]; ok {
+				fmt.Fprintf(tw, "  %s\t%s\n", commentSafe(s), commentSafe(out))
+			}
+		}
+		tw.Flush()
+		lines = append(lines, tableLines(tb.String())...)
+	}
+
+	add("")
+	add("Transitions:")
+	var tb strings.Builder
+	tw := tabwriter.NewWriter(&tb, 0, 0, 2, ' ', 0)
+	mealy := f.Type == fsm.TypeMealy
+	if mealy {
+		fmt.Fprintln(tw, "  From\tInput\tTo\tOutput")
+	} else {
+		fmt.Fprintln(tw, "  From\tInput\tTo")
+	}
+	for _, t := range f.Transitions {
+		input := "ε"
+		if t.Input != nil {
+			input = commentSafe(*t.Input)
+		}
+		row := fmt.Sprintf("  %s\t%s\t%s", commentSafe(t.From), input, commentList(t.To))
+		if mealy {
+			out := "-"
+			if t.Output != nil {
+				out = commentSafe(*t.Output)
+			}
+			row += "\t" + out
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+	lines = append(lines, tableLines(tb.String())...)
+
+	var sb strings.Builder
+	for _, l := range lines {
+		if l == "" {
+			sb.WriteString("//\n")
+			continue
+		}
+		sb.WriteString("// " + l + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// tableLines splits tabwriter output into lines without trailing space.
+func tableLines(s string) []string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return lines
+}
+
+// commentList joins names for a comment.
+func commentList(names []string) string {
+	safe := make([]string, len(names))
+	for i, n := range names {
+		safe[i] = commentSafe(n)
+	}
+	return strings.Join(safe, ", ")
+}
+
+// commentSafe makes a name safe to write in a line comment. Names with
+// control characters, which could end the comment, or backslashes, which
+// C reads as line continuations at the end of a line, are quoted.
+func commentSafe(s string) string {
+	if strings.ContainsRune(s, '\\') || strings.IndexFunc(s, unicode.IsControl) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,56 @@
+package codegen
+
+import (
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// encoding returns the values generated code gives f's states, inputs,
+// and outputs (see fsm.FSM.Encodings). If the pinned encodings are
+// invalid it falls back to positions and returns a note saying so, which
+// the generators write at the top of their output; fsm generate checks
+// the encodings first and refuses to generate instead.
+func encoding(f *fsm.FSM) (*fsm.Encoding, string) {
+	enc, err := f.Encodings()
+	if err == nil {
+		return enc, ""
+	}
+	enc = &fsm.Encoding{
+		States:  positions(f.States),
+		Inputs:  positions(f.Alphabet),
+		Outputs: positions(f.OutputAlphabet),
+	}
+	return enc, "encoding metadata ignored: " + err.Error()
+}
+
+// positions maps each name to its index.
+func positions(names []string) map[string]int {
+	m := make(map[string]int, len(names))
+	for i, n := range names {
+		if _, dup := m[n]; !dup {
+			m[n] = i
+		}
+	}
+	return m
+}
+
+// isPositional reports whether values gives every name its position, so
+// that tables indexed by value can be written as plain lists.
+func isPositional(names []string, values map[string]int) bool {
+	for i, n := range names {
+		if values[n] != i {
+			return false
+		}
+	}
+	return true
+}
+
+// maxValue returns the largest of the values of names.
+func maxValue(names []string, values map[string]int) int {
+	m := 0
+	for _, n := range names {
+		if values[n] > m {
+			m = values[n]
+		}
+	}
+	return m
+}
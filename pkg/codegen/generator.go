@@ -0,0 +1,153 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// Generator is a code generation target. The built-in targets are
+// registered as c, rust, go, and tinygo; Register adds others, such as
+// in-house languages, so that tools built on this package can offer
+// them by name, and External runs a separate program as a target.
+type Generator interface {
+	// Name is the name the target is registered and chosen by, such as
+	// "c".
+	Name() string
+	// Extension is the extension of the files the target writes, with
+	// its leading dot, or "" if it is not known.
+	Extension() string
+	// Generate returns the code for f. NFAs are passed as they are;
+	// targets that need a DFA convert them with fsm.FSM.ToDFA.
+	Generate(f *fsm.FSM, opts Options) (string, error)
+}
+
+// Options are the settings every target receives. Targets ignore the
+// ones they have no use for.
+type Options struct {
+	// Package is the package or module the code belongs to, for
+	// languages that have them. The go target defaults it to "fsm".
+	Package string
+
+	// Source names where the machine was read from, such as its file,
+	// for targets that record it in the code.
+	Source string
+}
+
+var (
+	generatorsMu sync.RWMutex
+	generators   = make(map[string]Generator)
+)
+
+func init() {
+	for _, g := range []Generator{
+		builtinGenerator{"c", ".h", func(f *fsm.FSM, _ Options) string { return GenerateC(f) }},
+		builtinGenerator{"rust", ".rs", func(f *fsm.FSM, _ Options) string { return GenerateRust(f) }},
+		builtinGenerator{"go", ".go", func(f *fsm.FSM, opts Options) string { return GenerateGo(f, opts.Package) }},
+		builtinGenerator{"tinygo", ".go", func(f *fsm.FSM, opts Options) string { return GenerateTinyGo(f, opts.Package) }},
+	} {
+		Register(g)
+	}
+}
+
+// Register makes a generator available by its name. Like
+// database/sql.Register, it is meant to be called from an init function,
+// and panics if the name is empty or already registered.
+func Register(g Generator) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+	name := g.Name()
+	if name == "" {
+		panic("codegen: Register of a generator with no name")
+	}
+	if _, dup := generators[name]; dup {
+		panic("codegen: Register called twice for generator " + name)
+	}
+	generators[name] = g
+}
+
+// GeneratorByName returns the generator registered as name, or nil.
+func GeneratorByName(name string) Generator {
+	generatorsMu.RLock()
+	defer generatorsMu.RUnlock()
+	return generators[name]
+}
+
+// Generators returns the registered generators, sorted by name.
+func Generators() []Generator {
+	generatorsMu.RLock()
+	defer generatorsMu.RUnlock()
+	gens := make([]Generator, 0, len(generators))
+	for _, g := range generators {
+		gens = append(gens, g)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].Name() < gens[j].Name() })
+	return gens
+}
+
+// builtinGenerator adapts one of this package's generators, with its
+// default options, to Generator.
+type builtinGenerator struct {
+	name, ext string
+	generate  func(f *fsm.FSM, opts Options) string
+}
+
+func (g builtinGenerator) Name() string      { return g.name }
+func (g builtinGenerator) Extension() string { return g.ext }
+
+func (g builtinGenerator) Generate(f *fsm.FSM, opts Options) (string, error) {
+	if f.Type == fsm.TypePDA {
+		return "", fmt.Errorf("%s: code generation does not support PDAs", g.name)
+	}
+	return g.generate(f, opts), nil
+}
+
+// External returns a generator that runs a program to generate code, so
+// that a target can be written in any language and kept outside the
+// toolkit. The program, found as exec.Command finds it, reads the
+// machine as JSON (the format fsmfile.ToJSON writes) on its standard
+// input and writes the code to its standard output. The options are in
+// its environment, as FSM_PACKAGE and FSM_SOURCE. A program that exits
+// with a non-zero status, or writes no code, fails, with whatever it
+// wrote to its standard error as the reason. The generator is named
+// "external:" followed by program, and its extension is not known.
+func External(program string) Generator {
+	return externalGenerator{program}
+}
+
+type externalGenerator struct {
+	program string
+}
+
+func (g externalGenerator) Name() string      { return "external:" + g.program }
+func (g externalGenerator) Extension() string { return "" }
+
+func (g externalGenerator) Generate(f *fsm.FSM, opts Options) (string, error) {
+	data, err := fsmfile.ToJSON(f, true)
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(g.program)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "FSM_PACKAGE="+opts.Package, "FSM_SOURCE="+opts.Source)
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", g.program, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", g.program, err)
+	}
+	if stdout.Len() == 0 {
+		return "", fmt.Errorf("%s wrote no code", g.program)
+	}
+	return stdout.String(), nil
+}
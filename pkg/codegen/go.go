@@ -11,13 +11,21 @@ import (
 // The generated code is compatible with both standard Go and TinyGo.
 // If the FSM is an NFA, it is first converted to a DFA.
 func GenerateGo(f *fsm.FSM, packageName string) string {
+	return generateGo(f, packageName, 0, false)
+}
+
+// generateGo generates Go code for the FSM, with a conformance monitor
+// keeping historySize events if historySize is positive, and with
+// Next<Type>Token if scanner is set.
+func generateGo(f *fsm.FSM, packageName string, historySize int, scanner bool) string {
 	// Convert NFA to DFA for code generation
 	if f.Type == fsm.TypeNFA {
 		f = f.ToDFA()
 	}
+	f, classes := inputClasses(f)
 
 	var sb strings.Builder
-	typeName := toPascalCase(sanitizeName(f.Name))
+	typeName := identStart(toPascalCase(sanitizeName(f.Name)))
 	if typeName == "" {
 		typeName = "FSM"
 	}
@@ -32,98 +40,20 @@ func GenerateGo(f *fsm.FSM, packageName string) string {
 
 package %s
 
-`, f.Name, f.Type, packageName))
-
-	// State type
-	sb.WriteString(fmt.Sprintf("// %sState represents FSM states\n", typeName))
-	sb.WriteString(fmt.Sprintf("type %sState uint16\n\n", typeName))
-
-	// State constants
-	sb.WriteString("const (\n")
-	for i, state := range f.States {
-		constName := fmt.Sprintf("%sState%s", typeName, toPascalCase(state))
-		if i == 0 {
-			sb.WriteString(fmt.Sprintf("\t%s %sState = iota\n", constName, typeName))
-		} else {
-			sb.WriteString(fmt.Sprintf("\t%s\n", constName))
-		}
-	}
-	sb.WriteString(")\n\n")
-
-	// State names for debugging
-	sb.WriteString(fmt.Sprintf("var %sStateNames = [...]string{\n", strings.ToLower(typeName)))
-	for _, state := range f.States {
-		sb.WriteString(fmt.Sprintf("\t%q,\n", state))
-	}
-	sb.WriteString("}\n\n")
-
-	sb.WriteString(fmt.Sprintf("func (s %sState) String() string {\n", typeName))
-	sb.WriteString(fmt.Sprintf("\tif int(s) < len(%sStateNames) {\n", strings.ToLower(typeName)))
-	sb.WriteString(fmt.Sprintf("\t\treturn %sStateNames[s]\n", strings.ToLower(typeName)))
-	sb.WriteString("\t}\n")
-	sb.WriteString("\treturn \"unknown\"\n")
-	sb.WriteString("}\n\n")
-
-	// Input type
-	sb.WriteString(fmt.Sprintf("// %sInput represents FSM inputs\n", typeName))
-	sb.WriteString(fmt.Sprintf("type %sInput uint16\n\n", typeName))
-
-	// Input constants
-	sb.WriteString("const (\n")
-	for i, input := range f.Alphabet {
-		constName := fmt.Sprintf("%sInput%s", typeName, toPascalCase(input))
-		if i == 0 {
-			sb.WriteString(fmt.Sprintf("\t%s %sInput = iota\n", constName, typeName))
-		} else {
-			sb.WriteString(fmt.Sprintf("\t%s\n", constName))
-		}
+`, commentSafe(f.Name), f.Type, packageName))
+	enc, note := encoding(f)
+	if note != "" {
+		sb.WriteString("// Note: " + note + "\n\n")
 	}
-	sb.WriteString(")\n\n")
+	ids := newIdentifiers(f, toPascalCase)
+	ids.writeTable(&sb, func(kind, ident string) string {
+		return typeName + toPascalCase(kind) + ident
+	})
 
-	// Input names
-	sb.WriteString(fmt.Sprintf("var %sInputNames = [...]string{\n", strings.ToLower(typeName)))
-	for _, input := range f.Alphabet {
-		sb.WriteString(fmt.Sprintf("\t%q,\n", input))
-	}
-	sb.WriteString("}\n\n")
-
-	sb.WriteString(fmt.Sprintf("func (i %sInput) String() string {\n", typeName))
-	sb.WriteString(fmt.Sprintf("\tif int(i) < len(%sInputNames) {\n", strings.ToLower(typeName)))
-	sb.WriteString(fmt.Sprintf("\t\treturn %sInputNames[i]\n", strings.ToLower(typeName)))
-	sb.WriteString("\t}\n")
-	sb.WriteString("\treturn \"unknown\"\n")
-	sb.WriteString("}\n\n")
-
-	// Output type (if applicable)
+	writeGoEnum(&sb, typeName, "State", "states", "s", f.States, ids.States, enc.States)
+	writeGoEnum(&sb, typeName, "Input", "inputs", "i", f.Alphabet, ids.Inputs, enc.Inputs)
 	if len(f.OutputAlphabet) > 0 {
-		sb.WriteString(fmt.Sprintf("// %sOutput represents FSM outputs\n", typeName))
-		sb.WriteString(fmt.Sprintf("type %sOutput uint16\n\n", typeName))
-
-		// Output constants
-		sb.WriteString("const (\n")
-		for i, output := range f.OutputAlphabet {
-			constName := fmt.Sprintf("%sOutput%s", typeName, toPascalCase(output))
-			if i == 0 {
-				sb.WriteString(fmt.Sprintf("\t%s %sOutput = iota\n", constName, typeName))
-			} else {
-				sb.WriteString(fmt.Sprintf("\t%s\n", constName))
-			}
-		}
-		sb.WriteString(")\n\n")
-
-		// Output names
-		sb.WriteString(fmt.Sprintf("var %sOutputNames = [...]string{\n", strings.ToLower(typeName)))
-		for _, output := range f.OutputAlphabet {
-			sb.WriteString(fmt.Sprintf("\t%q,\n", output))
-		}
-		sb.WriteString("}\n\n")
-
-		sb.WriteString(fmt.Sprintf("func (o %sOutput) String() string {\n", typeName))
-		sb.WriteString(fmt.Sprintf("\tif int(o) < len(%sOutputNames) {\n", strings.ToLower(typeName)))
-		sb.WriteString(fmt.Sprintf("\t\treturn %sOutputNames[o]\n", strings.ToLower(typeName)))
-		sb.WriteString("\t}\n")
-		sb.WriteString("\treturn \"unknown\"\n")
-		sb.WriteString("}\n\n")
+		writeGoEnum(&sb, typeName, "Output", "outputs", "o", f.OutputAlphabet, ids.Outputs, enc.Outputs)
 	}
 
 	// FSM struct
@@ -140,10 +70,10 @@ package %s
 	sb.WriteString(fmt.Sprintf("// New%s creates a new FSM in its initial state\n", typeName))
 	sb.WriteString(fmt.Sprintf("func New%s() *%s {\n", typeName, typeName))
 	sb.WriteString(fmt.Sprintf("\tf := &%s{\n", typeName))
-	sb.WriteString(fmt.Sprintf("\t\tstate: %sState%s,\n", typeName, toPascalCase(f.Initial)))
+	sb.WriteString(fmt.Sprintf("\t\tstate: %sState%s,\n", typeName, ids.States[f.Initial]))
 	if f.Type == fsm.TypeMoore {
 		if out, ok := f.StateOutputs[f.Initial]; ok {
-			sb.WriteString(fmt.Sprintf("\t\toutput: %sOutput%s,\n", typeName, toPascalCase(out)))
+			sb.WriteString(fmt.Sprintf("\t\toutput: %sOutput%s,\n", typeName, ids.Outputs[out]))
 			sb.WriteString("\t\thasOutput: true,\n")
 		}
 	}
@@ -163,33 +93,35 @@ package %s
 	sb.WriteString(fmt.Sprintf("func (f *%s) Step(input %sInput) bool {\n", typeName, typeName))
 	sb.WriteString("\tswitch f.state {\n")
 
-	// Group transitions by from state
-	transByState := make(map[string][]fsm.Transition)
-	for _, t := range f.Transitions {
-		transByState[t.From] = append(transByState[t.From], t)
-	}
+	ix := fsm.NewTransitionIndex(f)
 
 	for _, state := range f.States {
-		sb.WriteString(fmt.Sprintf("\tcase %sState%s:\n", typeName, toPascalCase(state)))
+		sb.WriteString(fmt.Sprintf("\tcase %sState%s:\n", typeName, ids.States[state]))
 		sb.WriteString("\t\tswitch input {\n")
 
-		if trans, ok := transByState[state]; ok {
+		if trans := ix.From(state); len(trans) > 0 {
 			for _, t := range trans {
 				if t.Input == nil || len(t.To) == 0 {
 					continue
 				}
 
-				sb.WriteString(fmt.Sprintf("\t\tcase %sInput%s:\n", typeName, toPascalCase(*t.Input)))
-				sb.WriteString(fmt.Sprintf("\t\t\tf.state = %sState%s\n", typeName, toPascalCase(t.To[0])))
+				sb.WriteString(fmt.Sprintf("\t\tcase %sInput%s:\n", typeName, ids.Inputs[*t.Input]))
+				sb.WriteString(fmt.Sprintf("\t\t\tf.state = %sState%s\n", typeName, ids.States[t.To[0]]))
 
+				// A step with no output clears the last one, as
+				// fsm.CompiledRunner does.
 				if f.Type == fsm.TypeMoore {
 					if out, ok := f.StateOutputs[t.To[0]]; ok {
-						sb.WriteString(fmt.Sprintf("\t\t\tf.output = %sOutput%s\n", typeName, toPascalCase(out)))
+						sb.WriteString(fmt.Sprintf("\t\t\tf.output = %sOutput%s\n", typeName, ids.Outputs[out]))
 						sb.WriteString("\t\t\tf.hasOutput = true\n")
+					} else {
+						sb.WriteString("\t\t\tf.hasOutput = false\n")
 					}
 				} else if f.Type == fsm.TypeMealy && t.Output != nil {
-					sb.WriteString(fmt.Sprintf("\t\t\tf.output = %sOutput%s\n", typeName, toPascalCase(*t.Output)))
+					sb.WriteString(fmt.Sprintf("\t\t\tf.output = %sOutput%s\n", typeName, ids.Outputs[*t.Output]))
 					sb.WriteString("\t\t\tf.hasOutput = true\n")
+				} else if f.Type == fsm.TypeMealy {
+					sb.WriteString("\t\t\tf.hasOutput = false\n")
 				}
 
 				sb.WriteString("\t\t\treturn true\n")
@@ -209,15 +141,15 @@ package %s
 	sb.WriteString("\tswitch f.state {\n")
 
 	for _, state := range f.States {
-		sb.WriteString(fmt.Sprintf("\tcase %sState%s:\n", typeName, toPascalCase(state)))
+		sb.WriteString(fmt.Sprintf("\tcase %sState%s:\n", typeName, ids.States[state]))
 		sb.WriteString("\t\tswitch input {\n")
 
-		if trans, ok := transByState[state]; ok {
+		if trans := ix.From(state); len(trans) > 0 {
 			for _, t := range trans {
 				if t.Input == nil || len(t.To) == 0 {
 					continue
 				}
-				sb.WriteString(fmt.Sprintf("\t\tcase %sInput%s:\n", typeName, toPascalCase(*t.Input)))
+				sb.WriteString(fmt.Sprintf("\t\tcase %sInput%s:\n", typeName, ids.Inputs[*t.Input]))
 				sb.WriteString("\t\t\treturn true\n")
 			}
 		}
@@ -239,7 +171,7 @@ package %s
 			if i > 0 {
 				sb.WriteString(", ")
 			}
-			sb.WriteString(fmt.Sprintf("%sState%s", typeName, toPascalCase(acc)))
+			sb.WriteString(fmt.Sprintf("%sState%s", typeName, ids.States[acc]))
 		}
 		sb.WriteString(":\n")
 		sb.WriteString("\t\treturn true\n")
@@ -259,10 +191,10 @@ package %s
 	// Reset function
 	sb.WriteString("// Reset returns the FSM to its initial state\n")
 	sb.WriteString(fmt.Sprintf("func (f *%s) Reset() {\n", typeName))
-	sb.WriteString(fmt.Sprintf("\tf.state = %sState%s\n", typeName, toPascalCase(f.Initial)))
+	sb.WriteString(fmt.Sprintf("\tf.state = %sState%s\n", typeName, ids.States[f.Initial]))
 	if f.Type == fsm.TypeMoore {
 		if out, ok := f.StateOutputs[f.Initial]; ok {
-			sb.WriteString(fmt.Sprintf("\tf.output = %sOutput%s\n", typeName, toPascalCase(out)))
+			sb.WriteString(fmt.Sprintf("\tf.output = %sOutput%s\n", typeName, ids.Outputs[out]))
 			sb.WriteString("\tf.hasOutput = true\n")
 		} else {
 			sb.WriteString("\tf.hasOutput = false\n")
@@ -272,9 +204,83 @@ package %s
 	}
 	sb.WriteString("}\n")
 
+	if classes != nil || scanner {
+		writeGoClassify(&sb, f, ids, typeName, classes)
+	}
+	if scanner {
+		writeGoScanner(&sb, typeName)
+	}
+
+	if historySize > 0 {
+		writeGoMonitor(&sb, typeName, historySize)
+	}
+
 	return sb.String()
 }
 
+// writeGoEnum writes the type, constants, name table, and String method
+// for one kind of value, whose constants are named with idents. The constants count up with iota when values
+// are positions, and are given explicitly otherwise.
+func writeGoEnum(sb *strings.Builder, typeName, kind, plural, recv string, names []string, idents map[string]string, values map[string]int) {
+	t := typeName + kind
+	table := strings.ToLower(typeName) + kind + "Names"
+	positional := isPositional(names, values)
+
+	sb.WriteString(fmt.Sprintf("// %s represents FSM %s\n", t, plural))
+	sb.WriteString(fmt.Sprintf("type %s uint16\n\n", t))
+
+	sb.WriteString("const (\n")
+	for i, n := range names {
+		constName := t + idents[n]
+		switch {
+		case !positional:
+			sb.WriteString(fmt.Sprintf("\t%s %s = %d\n", constName, t, values[n]))
+		case i == 0:
+			sb.WriteString(fmt.Sprintf("\t%s %s = iota\n", constName, t))
+		default:
+			sb.WriteString(fmt.Sprintf("\t%s\n", constName))
+		}
+	}
+	sb.WriteString(")\n\n")
+
+	sb.WriteString(fmt.Sprintf("var %s = [...]string{\n", table))
+	for _, n := range names {
+		if positional {
+			sb.WriteString(fmt.Sprintf("\t%q,\n", n))
+		} else {
+			sb.WriteString(fmt.Sprintf("\t%d: %q,\n", values[n], n))
+		}
+	}
+	sb.WriteString("}\n\n")
+
+	sb.WriteString(fmt.Sprintf("func (%s %s) String() string {\n", recv, t))
+	if positional {
+		sb.WriteString(fmt.Sprintf("\tif int(%s) < len(%s) {\n", recv, table))
+	} else {
+		sb.WriteString(fmt.Sprintf("\tif int(%s) < len(%s) && %s[%s] != \"\" {\n", recv, table, table, recv))
+	}
+	sb.WriteString(fmt.Sprintf("\t\treturn %s[%s]\n", table, recv))
+	sb.WriteString("\t}\n")
+	sb.WriteString("\treturn \"unknown\"\n")
+	sb.WriteString("}\n\n")
+}
+
+// BuildGo is GenerateGo without the generate-compile cycle: it compiles
+// f into table-driven form at run time, so a program can embed a machine
+// it loads from a .fsm file. The result behaves like the generated code.
+// NFAs are converted to DFAs in the same way, and state, input, and
+// output IDs are the values of the generated constants, except that
+// BuildGo ignores encodings pinned in metadata (see fsm.FSM.Encodings)
+// and always numbers by position. Runners'
+// Step, IsAccepting, and Reset match the generated methods of the same
+// names. A runner's Output is -1 where the generated Output reports no
+// output. Unlike GenerateGo, BuildGo reports a machine the generated code
+// could not express, such as a DFA with two transitions on one input, as
+// an error.
+func BuildGo(f *fsm.FSM) (*fsm.CompiledMachine, error) {
+	return fsm.Compile(f)
+}
+
 // GenerateTinyGo is an alias for GenerateGo as the output is compatible.
 // TinyGo-specific optimizations:
 // - Uses uint16 for state/input/output types (matches FSM format capacity)
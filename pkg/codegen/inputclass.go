@@ -0,0 +1,259 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// inputClasses returns f with its input class fallbacks written out as
+// transitions (see fsm.FSM.ExpandInputClasses), so that the generated
+// dispatch follows them, and its classes, most specific first. Without
+// valid input classes it returns f and nil; fsm generate checks the
+// classes first and refuses to generate instead.
+func inputClasses(f *fsm.FSM) (*fsm.FSM, []fsm.InputClass) {
+	if !f.HasInputClasses() {
+		return f, nil
+	}
+	classes, err := f.InputClasses()
+	if err != nil || len(classes) == 0 {
+		return f, nil
+	}
+	expanded, err := f.ExpandInputClasses()
+	if err != nil {
+		return f, nil
+	}
+	return expanded, classes
+}
+
+// classifierCase is one test of a generated classify function: the
+// characters that are read as input.
+type classifierCase struct {
+	input  string
+	ranges []fsm.RuneRange // nil for the "*" class
+}
+
+// classifierCases returns the tests a classify function makes, in
+// order: the single-character symbols of the alphabet that are not
+// classes, then the classes, most specific first, and the "*" class
+// last.
+func classifierCases(f *fsm.FSM, classes []fsm.InputClass) []classifierCase {
+	isClass := make(map[string]bool, len(classes))
+	for _, c := range classes {
+		isClass[c.Symbol] = true
+	}
+	var cases []classifierCase
+	for _, sym := range f.Alphabet {
+		if isClass[sym] || utf8.RuneCountInString(sym) != 1 {
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(sym)
+		cases = append(cases, classifierCase{input: sym, ranges: []fsm.RuneRange{{Lo: r, Hi: r}}})
+	}
+	for _, c := range classes {
+		cases = append(cases, classifierCase{input: c.Symbol, ranges: c.Ranges})
+	}
+	return cases
+}
+
+// rangeCondition writes a test that variable v is in one of ranges,
+// using lit to write characters. With paren, each comparison and each
+// range of two comparisons is parenthesised, as MISRA style asks.
+func rangeCondition(v string, ranges []fsm.RuneRange, lit func(rune) string, paren bool) string {
+	// A lone comparison needs no parentheses.
+	if len(ranges) == 1 && (ranges[0].Lo == ranges[0].Hi || ranges[0].Lo == 0 || ranges[0].Hi == unicode.MaxRune) {
+		paren = false
+	}
+	cmp := func(op string, r rune) string {
+		c := fmt.Sprintf("%s %s %s", v, op, lit(r))
+		if paren {
+			c = "(" + c + ")"
+		}
+		return c
+	}
+	var parts []string
+	for _, rg := range ranges {
+		switch {
+		case rg.Lo == rg.Hi:
+			parts = append(parts, cmp("==", rg.Lo))
+		case rg.Lo == 0:
+			parts = append(parts, cmp("<=", rg.Hi))
+		case rg.Hi == unicode.MaxRune:
+			parts = append(parts, cmp(">=", rg.Lo))
+		default:
+			both := cmp(">=", rg.Lo) + " && " + cmp("<=", rg.Hi)
+			if paren && len(ranges) > 1 {
+				both = "(" + both + ")"
+			}
+			parts = append(parts, both)
+		}
+	}
+	return strings.Join(parts, " || ")
+}
+
+// writeGoClassify writes Classify<Type>Input, which reads a character as
+// an input, and StepRune.
+func writeGoClassify(sb *strings.Builder, f *fsm.FSM, ids *identifiers, typeName string, classes []fsm.InputClass) {
+	goRune := func(r rune) string { return fmt.Sprintf("%q", r) }
+	any := ""
+	sb.WriteString(fmt.Sprintf("\n// Classify%sInput returns the input a character is read as: the input\n", typeName))
+	sb.WriteString("// it is, or else the most specific input class containing it.\n")
+	sb.WriteString(fmt.Sprintf("func Classify%sInput(c rune) (%sInput, bool) {\n", typeName, typeName))
+	sb.WriteString("\tswitch {\n")
+	for _, c := range classifierCases(f, classes) {
+		if c.ranges == nil {
+			any = c.input
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\tcase %s:\n", rangeCondition("c", c.ranges, goRune, false)))
+		sb.WriteString(fmt.Sprintf("\t\treturn %sInput%s, true\n", typeName, ids.Inputs[c.input]))
+	}
+	sb.WriteString("\t}\n")
+	if any != "" {
+		sb.WriteString(fmt.Sprintf("\treturn %sInput%s, true\n", typeName, ids.Inputs[any]))
+	} else {
+		sb.WriteString("\treturn 0, false\n")
+	}
+	sb.WriteString("}\n\n")
+
+	sb.WriteString("// StepRune reads a character as an input and processes it.\n")
+	sb.WriteString("// Returns true if a valid transition occurred.\n")
+	sb.WriteString(fmt.Sprintf("func (f *%s) StepRune(c rune) bool {\n", typeName))
+	sb.WriteString(fmt.Sprintf("\tinput, ok := Classify%sInput(c)\n", typeName))
+	sb.WriteString("\treturn ok && f.Step(input)\n")
+	sb.WriteString("}\n")
+}
+
+// writeCClassifyDecls writes the declarations of the C classify and
+// step_char functions.
+func writeCClassifyDecls(sb *strings.Builder, name string) {
+	sb.WriteString("// Read a character as an input: the input it is, or else the most\n")
+	sb.WriteString("// specific input class containing it. Returns false if none does.\n")
+	sb.WriteString(fmt.Sprintf("bool %s_classify(uint32_t c, %s_input_t *input);\n\n", name, name))
+	sb.WriteString("// Classify a character and process the input, returns true if\n")
+	sb.WriteString("// transition occurred\n")
+	sb.WriteString(fmt.Sprintf("bool %s_step_char(%s_t *fsm, uint32_t c);\n\n", name, name))
+}
+
+// writeCClassify writes the C classify and step_char functions, with a
+// single exit so that they suit MISRA style too.
+func writeCClassify(sb *strings.Builder, f *fsm.FSM, ids *identifiers, name string, classes []fsm.InputClass, misra bool) {
+	NAME := strings.ToUpper(name)
+	suffix := ""
+	if misra {
+		suffix = "U"
+	}
+	cRune := func(r rune) string { return fmt.Sprintf("0x%X%s", r, suffix) }
+
+	sb.WriteString(fmt.Sprintf("bool %s_classify(uint32_t c, %s_input_t *input) {\n", name, name))
+	sb.WriteString("    bool found = true;\n\n")
+	any := ""
+	first := true
+	for _, c := range classifierCases(f, classes) {
+		if c.ranges == nil {
+			any = c.input
+			continue
+		}
+		cond := rangeCondition("c", c.ranges, cRune, misra)
+		keyword := "    } else if"
+		if first {
+			keyword = "    if"
+			first = false
+		}
+		sb.WriteString(fmt.Sprintf("%s (%s) {\n", keyword, cond))
+		sb.WriteString(fmt.Sprintf("        *input = %s_INPUT_%s; // %s\n", NAME, ids.Inputs[c.input], commentSafe(c.input)))
+	}
+	fallback := "        found = false;\n"
+	if any != "" {
+		fallback = fmt.Sprintf("        *input = %s_INPUT_%s; // %s\n", NAME, ids.Inputs[any], commentSafe(any))
+	}
+	if first {
+		// Only a "*" class: every character is read as it.
+		sb.WriteString("    (void)c;\n")
+		sb.WriteString(strings.TrimPrefix(fallback, "    "))
+	} else {
+		sb.WriteString("    } else {\n")
+		sb.WriteString(fallback)
+		sb.WriteString("    }\n")
+	}
+	sb.WriteString("    return found;\n")
+	sb.WriteString("}\n\n")
+
+	sb.WriteString(fmt.Sprintf("bool %s_step_char(%s_t *fsm, uint32_t c) {\n", name, name))
+	sb.WriteString(fmt.Sprintf("    %s_input_t input = 0%s;\n", name, suffix))
+	sb.WriteString("    bool moved = false;\n\n")
+	sb.WriteString(fmt.Sprintf("    if (%s_classify(c, &input)) {\n", name))
+	sb.WriteString(fmt.Sprintf("        moved = %s_step(fsm, input);\n", name))
+	sb.WriteString("    }\n")
+	sb.WriteString("    return moved;\n")
+	sb.WriteString("}\n\n")
+}
+
+// rustChar writes a Rust char literal.
+func rustChar(r rune) string {
+	if r >= ' ' && r <= '~' && r != '\'' && r != '\\' {
+		return fmt.Sprintf("'%c'", r)
+	}
+	return fmt.Sprintf("'\\u{%X}'", r)
+}
+
+// rustPatterns writes ranges as the alternatives of a Rust char pattern,
+// leaving out the surrogates, which are not chars.
+func rustPatterns(ranges []fsm.RuneRange) string {
+	const surrogateLo, surrogateHi = 0xD800, 0xDFFF
+	var parts []string
+	add := func(lo, hi rune) {
+		if lo == hi {
+			parts = append(parts, rustChar(lo))
+		} else {
+			parts = append(parts, rustChar(lo)+"..="+rustChar(hi))
+		}
+	}
+	for _, rg := range ranges {
+		if rg.Lo < surrogateLo {
+			add(rg.Lo, min(rg.Hi, surrogateLo-1))
+		}
+		if rg.Hi > surrogateHi {
+			add(max(rg.Lo, surrogateHi+1), rg.Hi)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// writeRustStepChar writes step_char(), within the machine's impl.
+func writeRustStepChar(sb *strings.Builder, typeName string) {
+	sb.WriteString("    /// Read a character as an input and process it, returns true if\n")
+	sb.WriteString("    /// transition occurred\n")
+	sb.WriteString("    pub fn step_char(&mut self, c: char) -> bool {\n")
+	sb.WriteString(fmt.Sprintf("        match %sInput::classify(c) {\n", typeName))
+	sb.WriteString("            Some(input) => self.step(input),\n")
+	sb.WriteString("            None => false,\n")
+	sb.WriteString("        }\n")
+	sb.WriteString("    }\n\n")
+}
+
+// writeRustClassify writes the input enum's classify().
+func writeRustClassify(sb *strings.Builder, f *fsm.FSM, ids *identifiers, typeName string, classes []fsm.InputClass) {
+	any := "None"
+	sb.WriteString(fmt.Sprintf("impl %sInput {\n", typeName))
+	sb.WriteString("    /// The input a character is read as: the input it is, or else the\n")
+	sb.WriteString("    /// most specific input class containing it\n")
+	sb.WriteString(fmt.Sprintf("    pub fn classify(c: char) -> Option<%sInput> {\n", typeName))
+	sb.WriteString("        match c {\n")
+	for _, c := range classifierCases(f, classes) {
+		if c.ranges == nil {
+			any = fmt.Sprintf("Some(%sInput::%s)", typeName, ids.Inputs[c.input])
+			continue
+		}
+		if p := rustPatterns(c.ranges); p != "" {
+			sb.WriteString(fmt.Sprintf("            %s => Some(%sInput::%s),\n", p, typeName, ids.Inputs[c.input]))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("            _ => %s,\n", any))
+	sb.WriteString("        }\n")
+	sb.WriteString("    }\n")
+	sb.WriteString("}\n\n")
+}
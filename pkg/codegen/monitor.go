@@ -0,0 +1,261 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// DefaultMonitorHistory is the number of recent events a generated
+// monitor keeps for diagnostics when no size is given.
+const DefaultMonitorHistory = 16
+
+// GenerateCMonitor generates C code for the FSM together with a
+// conformance monitor: rather than driving behaviour, the monitor
+// observes inputs produced elsewhere, reports those the machine does not
+// allow in its current state, and keeps a ring buffer of the last
+// historySize events (DefaultMonitorHistory if not positive) for
+// diagnostics. If the FSM is an NFA, it is first converted to a DFA.
+func GenerateCMonitor(f *fsm.FSM, historySize int) string {
+	if historySize <= 0 {
+		historySize = DefaultMonitorHistory
+	}
+	header, _ := generateC(f, historySize, false, COptions{})
+	return header
+}
+
+// GenerateCMonitorWithOptions is GenerateCMonitor with the options of
+// GenerateCWithOptions. The MISRA option affects only the machine: the
+// monitor reports violations through stdio.h.
+func GenerateCMonitorWithOptions(f *fsm.FSM, historySize int, opts COptions) (header, source string) {
+	if historySize <= 0 {
+		historySize = DefaultMonitorHistory
+	}
+	return generateC(f, historySize, false, opts)
+}
+
+// GenerateGoMonitor is GenerateCMonitor for Go; like GenerateGo, the
+// output also works with TinyGo.
+func GenerateGoMonitor(f *fsm.FSM, packageName string, historySize int) string {
+	if historySize <= 0 {
+		historySize = DefaultMonitorHistory
+	}
+	return generateGo(f, packageName, historySize, false)
+}
+
+// writeCMonitorDecls writes the monitor's declarations into the header.
+func writeCMonitorDecls(sb *strings.Builder, name, NAME string, historySize int) {
+	sb.WriteString(strings.NewReplacer("{name}", name, "{NAME}", NAME, "{SIZE}", fmt.Sprint(historySize)).Replace(`// ---- Conformance monitor ----
+// A monitor observes inputs produced elsewhere and reports those the
+// machine does not allow, instead of driving behaviour.
+
+#include <stdio.h>
+
+#define {NAME}_HISTORY_SIZE {SIZE}
+
+// One observed input
+typedef struct {
+    {name}_state_t from;
+    {name}_input_t input;
+    {name}_state_t to;
+    bool ok; // false for a violation, which leaves the state unchanged
+} {name}_event_t;
+
+typedef struct {name}_monitor {name}_monitor_t;
+
+// Called on each violation; the monitor's history ends with the violation
+typedef void (*{name}_violation_fn)(const {name}_monitor_t *mon, {name}_state_t state, {name}_input_t input, void *ctx);
+
+struct {name}_monitor {
+    {name}_t fsm;
+    {name}_event_t history[{NAME}_HISTORY_SIZE]; // ring buffer of recent events
+    uint32_t next;       // history slot for the next event
+    uint32_t filled;     // history slots in use
+    uint32_t events;     // inputs observed
+    uint32_t violations; // inputs not allowed
+    {name}_violation_fn on_violation;
+    void *ctx;
+};
+
+// Initialize (or reset) a monitor. With a NULL callback, violations are
+// reported on stderr
+void {name}_monitor_init({name}_monitor_t *mon, {name}_violation_fn on_violation, void *ctx);
+
+// Observe an input, returns false if it is a violation
+bool {name}_monitor_observe({name}_monitor_t *mon, {name}_input_t input);
+
+// Copy up to max recent events into out, oldest first, returns the count
+uint32_t {name}_monitor_history(const {name}_monitor_t *mon, {name}_event_t *out, uint32_t max);
+
+// Print the current state and recent events, marking violations
+void {name}_monitor_report(const {name}_monitor_t *mon, FILE *out);
+
+`))
+}
+
+// writeCMonitorImpl writes the monitor's implementation.
+func writeCMonitorImpl(sb *strings.Builder, name, NAME string) {
+	sb.WriteString(strings.NewReplacer("{name}", name, "{NAME}", NAME).Replace(`// Monitor
+void {name}_monitor_init({name}_monitor_t *mon, {name}_violation_fn on_violation, void *ctx) {
+    {name}_init(&mon->fsm);
+    mon->next = 0;
+    mon->filled = 0;
+    mon->events = 0;
+    mon->violations = 0;
+    mon->on_violation = on_violation;
+    mon->ctx = ctx;
+}
+
+bool {name}_monitor_observe({name}_monitor_t *mon, {name}_input_t input) {
+    {name}_event_t *ev = &mon->history[mon->next];
+    ev->from = mon->fsm.state;
+    ev->input = input;
+    ev->ok = {name}_step(&mon->fsm, input);
+    ev->to = mon->fsm.state;
+    mon->next = (mon->next + 1) % {NAME}_HISTORY_SIZE;
+    if (mon->filled < {NAME}_HISTORY_SIZE) mon->filled++;
+    mon->events++;
+    if (ev->ok) return true;
+
+    mon->violations++;
+    if (mon->on_violation) {
+        mon->on_violation(mon, ev->from, input, mon->ctx);
+    } else {
+        fprintf(stderr, "{name}: unexpected input %s in state %s\n",
+                {name}_input_name(input), {name}_state_name(ev->from));
+        {name}_monitor_report(mon, stderr);
+    }
+    return false;
+}
+
+uint32_t {name}_monitor_history(const {name}_monitor_t *mon, {name}_event_t *out, uint32_t max) {
+    uint32_t n = mon->filled < max ? mon->filled : max;
+    uint32_t start = (mon->next + {NAME}_HISTORY_SIZE - n) % {NAME}_HISTORY_SIZE;
+    for (uint32_t i = 0; i < n; i++) {
+        out[i] = mon->history[(start + i) % {NAME}_HISTORY_SIZE];
+    }
+    return n;
+}
+
+void {name}_monitor_report(const {name}_monitor_t *mon, FILE *out) {
+    {name}_event_t events[{NAME}_HISTORY_SIZE];
+    uint32_t n = {name}_monitor_history(mon, events, {NAME}_HISTORY_SIZE);
+    fprintf(out, "{name}: state %s after %lu inputs, %lu violations\n",
+            {name}_state_name(mon->fsm.state),
+            (unsigned long)mon->events, (unsigned long)mon->violations);
+    for (uint32_t i = 0; i < n; i++) {
+        if (events[i].ok) {
+            fprintf(out, "  %s --%s--> %s\n", {name}_state_name(events[i].from),
+                    {name}_input_name(events[i].input), {name}_state_name(events[i].to));
+        } else {
+            fprintf(out, "  %s --%s--> violation\n", {name}_state_name(events[i].from),
+                    {name}_input_name(events[i].input));
+        }
+    }
+}
+
+`))
+}
+
+// writeGoMonitor writes the monitor type after the machine.
+func writeGoMonitor(sb *strings.Builder, typeName string, historySize int) {
+	sb.WriteString(strings.NewReplacer("{T}", typeName, "{SIZE}", fmt.Sprint(historySize)).Replace(`
+// {T}MonitorHistory is the number of recent events a {T}Monitor keeps.
+const {T}MonitorHistory = {SIZE}
+
+// {T}Event is one input observed by a {T}Monitor.
+type {T}Event struct {
+	From  {T}State
+	Input {T}Input
+	To    {T}State
+	OK    bool // false for a violation, which leaves the state unchanged
+}
+
+// {T}Violation is an input the machine does not allow in its state.
+type {T}Violation struct {
+	State   {T}State
+	Input   {T}Input
+	History []{T}Event // recent events, oldest first, ending with this one
+}
+
+func (v *{T}Violation) Error() string {
+	return "unexpected input " + v.Input.String() + " in state " + v.State.String()
+}
+
+// {T}Monitor observes inputs produced elsewhere and reports those the
+// machine does not allow, instead of driving behaviour. It keeps the
+// last {T}MonitorHistory events for diagnostics.
+type {T}Monitor struct {
+	// OnViolation, if set, is called with each violation.
+	OnViolation func(*{T}Violation)
+
+	fsm        *{T}
+	history    [{T}MonitorHistory]{T}Event
+	next       int // history slot for the next event
+	filled     int // history slots in use
+	events     uint64
+	violations uint64
+}
+
+// New{T}Monitor creates a monitor with the machine in its initial state
+func New{T}Monitor() *{T}Monitor {
+	return &{T}Monitor{fsm: New{T}()}
+}
+
+// Observe records an input. If the machine does not allow it, the state
+// is unchanged and Observe returns a *{T}Violation.
+func (m *{T}Monitor) Observe(input {T}Input) error {
+	from := m.fsm.State()
+	ok := m.fsm.Step(input)
+	m.history[m.next] = {T}Event{From: from, Input: input, To: m.fsm.State(), OK: ok}
+	m.next = (m.next + 1) % {T}MonitorHistory
+	if m.filled < {T}MonitorHistory {
+		m.filled++
+	}
+	m.events++
+	if ok {
+		return nil
+	}
+
+	m.violations++
+	v := &{T}Violation{State: from, Input: input, History: m.History()}
+	if m.OnViolation != nil {
+		m.OnViolation(v)
+	}
+	return v
+}
+
+// History returns the recent events, oldest first
+func (m *{T}Monitor) History() []{T}Event {
+	out := make([]{T}Event, 0, m.filled)
+	start := (m.next + {T}MonitorHistory - m.filled) % {T}MonitorHistory
+	for i := 0; i < m.filled; i++ {
+		out = append(out, m.history[(start+i)%{T}MonitorHistory])
+	}
+	return out
+}
+
+// State returns the machine's current state
+func (m *{T}Monitor) State() {T}State {
+	return m.fsm.State()
+}
+
+// Events returns the number of inputs observed
+func (m *{T}Monitor) Events() uint64 {
+	return m.events
+}
+
+// Violations returns the number of inputs that were not allowed
+func (m *{T}Monitor) Violations() uint64 {
+	return m.violations
+}
+
+// Reset returns the machine to its initial state and clears the history
+// and counts
+func (m *{T}Monitor) Reset() {
+	m.fsm.Reset()
+	m.next, m.filled, m.events, m.violations = 0, 0, 0, 0
+}
+`))
+}
@@ -0,0 +1,212 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// State, input, and output names can be any string: "door open", "état",
+// "+", or the "q0,q1" names NFA-to-DFA conversion gives. The generators
+// turn each into an identifier from the words in it, number any that
+// come out the same, and list at the top of the generated code the names
+// that could not be used as written.
+
+// nameWords splits a name into the words its identifier is made from:
+// runs of letters and digits, ASCII ones only if ascii is set. Other
+// letters and digits are spelled as their code points, U00E9 for é, as
+// words of their own; anything else separates words. A name with no
+// words is spelled out in full, so that "+" gives U002B.
+func nameWords(s string, ascii bool) []string {
+	var words []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			words = append(words, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			current.WriteRune(r)
+		case !ascii && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			current.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flush()
+			words = append(words, codePoint(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	if len(words) == 0 {
+		for _, r := range s {
+			if !unicode.IsSpace(r) {
+				words = append(words, codePoint(r))
+			}
+		}
+	}
+	return words
+}
+
+// codePoint spells a character as its code point.
+func codePoint(r rune) string {
+	return fmt.Sprintf("U%04X", r)
+}
+
+// cIdent is the identifier a name gives in C macros: its words in upper
+// case, joined by underscores.
+func cIdent(s string) string {
+	words := nameWords(s, true)
+	if len(words) == 0 {
+		return "UNNAMED"
+	}
+	return strings.ToUpper(strings.Join(words, "_"))
+}
+
+// rustIdent is the enum variant a name gives in Rust: the name in Pascal
+// case, which may not start with a digit.
+func rustIdent(s string) string {
+	return identStart(toPascalCase(s))
+}
+
+// identStart makes an identifier that starts with a digit valid by
+// putting an underscore in front of it.
+func identStart(s string) string {
+	if r, _ := utf8.DecodeRuneInString(s); unicode.IsDigit(r) {
+		return "_" + s
+	}
+	return s
+}
+
+// identifiers are the identifiers generated code uses for the states,
+// inputs, and outputs of a machine, each kind in a namespace of its own.
+type identifiers struct {
+	States, Inputs, Outputs map[string]string
+
+	// listed are the names to show in the table at the top of the
+	// generated code: those that are not plain identifiers, and those
+	// numbered because they clashed.
+	listed []listedName
+}
+
+type listedName struct {
+	kind, name, ident string
+}
+
+// newIdentifiers gives each state, input, and output of f an identifier
+// made by ident. Where two names give the same identifier, or a name
+// gives one of reserved, the later one is numbered: DOOR_2, DOOR_3.
+func newIdentifiers(f *fsm.FSM, ident func(string) string, reserved ...string) *identifiers {
+	ids := &identifiers{}
+	assign := func(kind string, names []string) map[string]string {
+		m := make(map[string]string, len(names))
+		taken := make(map[string]bool, len(names)+len(reserved))
+		for _, r := range reserved {
+			taken[r] = true
+		}
+		for _, name := range names {
+			if _, done := m[name]; done {
+				continue
+			}
+			base := ident(name)
+			id := base
+			for n := 2; taken[id]; n++ {
+				id = fmt.Sprintf("%s_%d", base, n)
+			}
+			taken[id] = true
+			m[name] = id
+			if id != base || !plainName(name) {
+				ids.listed = append(ids.listed, listedName{kind, name, id})
+			}
+		}
+		return m
+	}
+	ids.States = assign("state", f.States)
+	ids.Inputs = assign("input", f.Alphabet)
+	ids.Outputs = assign("output", f.OutputAlphabet)
+	return ids
+}
+
+// plainName reports whether a name is an ASCII letter followed by
+// letters, digits, and underscores, and so needs no explaining in the
+// table.
+func plainName(s string) bool {
+	if s == "" || !(s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z') {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTable writes, as line comments, the names that are not used as
+// written and what the generated code calls them; full turns the
+// identifier of a name of the given kind into the one that appears in
+// the code. It writes nothing if every name is a plain identifier.
+func (ids *identifiers) writeTable(sb *strings.Builder, full func(kind, ident string) string) {
+	if len(ids.listed) == 0 {
+		return
+	}
+	sb.WriteString("// Identifiers: these names are not plain identifiers, or clash\n")
+	sb.WriteString("// with another, so the code calls them:\n")
+	var tb strings.Builder
+	tw := tabwriter.NewWriter(&tb, 0, 0, 2, ' ', 0)
+	for _, l := range ids.listed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", l.kind, strconv.Quote(l.name), full(l.kind, l.ident))
+	}
+	tw.Flush()
+	for _, line := range tableLines(tb.String()) {
+		sb.WriteString("//   " + line + "\n")
+	}
+	sb.WriteString("\n")
+}
+
+// cString writes s as a C string literal. Quotes, backslashes, and
+// control characters are escaped, the last in octal, which unlike \x
+// cannot run into a following character.
+func cString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// rustEscape escapes s for the inside of a Rust string literal.
+func rustEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&sb, "\\u{%x}", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -3,21 +3,42 @@ package codegen
 import (
 	"fmt"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
 
+// RustOptions control the Rust generator.
+type RustOptions struct {
+	// NoStd generates code that uses only core, for #![no_std] crates:
+	// transitions, outputs, and accepting states become const tables
+	// indexed by state and input, and nothing allocates.
+	NoStd bool
+
+	// Defmt derives defmt::Format for the generated types and traces
+	// each transition with defmt::trace!, behind the including crate's
+	// "defmt" feature.
+	Defmt bool
+}
+
 // GenerateRust generates Rust code for the FSM.
 // If the FSM is an NFA, it is first converted to a DFA.
 func GenerateRust(f *fsm.FSM) string {
+	return GenerateRustWithOptions(f, RustOptions{})
+}
+
+// GenerateRustWithOptions is GenerateRust with options.
+func GenerateRustWithOptions(f *fsm.FSM, opts RustOptions) string {
 	// Convert NFA to DFA for code generation
 	if f.Type == fsm.TypeNFA {
 		f = f.ToDFA()
 	}
+	f, classes := inputClasses(f)
 
 	var sb strings.Builder
-	name := toSnakeCase(sanitizeName(f.Name))
-	typeName := toPascalCase(sanitizeName(f.Name))
+	name := identStart(toSnakeCase(sanitizeName(f.Name)))
+	typeName := identStart(toPascalCase(sanitizeName(f.Name)))
 	if name == "" {
 		name = "fsm"
 		typeName = "Fsm"
@@ -26,40 +47,62 @@ func GenerateRust(f *fsm.FSM) string {
 	// Header
 	sb.WriteString(fmt.Sprintf(`//! Generated FSM: %s
 //! Type: %s
-
-`, f.Name, f.Type))
+`, commentSafe(f.Name), f.Type))
+	if opts.NoStd {
+		sb.WriteString("//!\n//! no_std: uses only `core` and never allocates; include it from a\n//! `#![no_std]` crate. Transitions are `const` tables.\n")
+	}
+	if opts.Defmt {
+		sb.WriteString("//!\n//! With the crate's `defmt` feature enabled, the types implement\n//! `defmt::Format` and each transition is logged with `defmt::trace!`.\n")
+	}
+	sb.WriteString("\n")
+	enc, note := encoding(f)
+	if note != "" {
+		sb.WriteString("//! Note: " + note + "\n\n")
+	}
+	ids := newIdentifiers(f, rustIdent, "Self")
+	ids.writeTable(&sb, func(kind, ident string) string {
+		return typeName + toPascalCase(kind) + "::" + ident
+	})
 
 	// State enum
 	sb.WriteString("#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]\n")
+	writeRustDefmt(&sb, opts)
 	sb.WriteString("#[repr(u16)]\n")
 	sb.WriteString(fmt.Sprintf("pub enum %sState {\n", typeName))
-	for _, state := range f.States {
-		sb.WriteString(fmt.Sprintf("    %s,\n", toPascalCase(state)))
-	}
+	writeRustVariants(&sb, f.States, ids.States, enc.States)
 	sb.WriteString("}\n\n")
 
 	// Input enum
 	sb.WriteString("#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]\n")
+	writeRustDefmt(&sb, opts)
 	sb.WriteString("#[repr(u16)]\n")
 	sb.WriteString(fmt.Sprintf("pub enum %sInput {\n", typeName))
-	for _, input := range f.Alphabet {
-		sb.WriteString(fmt.Sprintf("    %s,\n", toPascalCase(input)))
-	}
+	writeRustVariants(&sb, f.Alphabet, ids.Inputs, enc.Inputs)
 	sb.WriteString("}\n\n")
 
 	// Output enum (if applicable)
 	if len(f.OutputAlphabet) > 0 {
 		sb.WriteString("#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]\n")
+		writeRustDefmt(&sb, opts)
 		sb.WriteString("#[repr(u16)]\n")
 		sb.WriteString(fmt.Sprintf("pub enum %sOutput {\n", typeName))
-		for _, output := range f.OutputAlphabet {
-			sb.WriteString(fmt.Sprintf("    %s,\n", toPascalCase(output)))
-		}
+		writeRustVariants(&sb, f.OutputAlphabet, ids.Outputs, enc.Outputs)
 		sb.WriteString("}\n\n")
 	}
 
+	// In no_std mode transitions are looked up in const tables with one
+	// row per state and one column per input, rather than matched on.
+	fmtPath := "std::fmt"
+	if opts.NoStd {
+		fmtPath = "core::fmt"
+		writeRustIndex(&sb, typeName+"State", f.States, ids.States, enc.States)
+		writeRustIndex(&sb, typeName+"Input", f.Alphabet, ids.Inputs, enc.Inputs)
+		writeRustTables(&sb, f, ids, typeName, strings.ToUpper(name))
+	}
+
 	// FSM struct
 	sb.WriteString("#[derive(Debug, Clone)]\n")
+	writeRustDefmt(&sb, opts)
 	sb.WriteString(fmt.Sprintf("pub struct %s {\n", typeName))
 	sb.WriteString(fmt.Sprintf("    state: %sState,\n", typeName))
 	if f.Type == fsm.TypeMoore || f.Type == fsm.TypeMealy {
@@ -72,12 +115,16 @@ func GenerateRust(f *fsm.FSM) string {
 
 	// new()
 	sb.WriteString("    /// Create new FSM in initial state\n")
-	sb.WriteString(fmt.Sprintf("    pub fn new() -> Self {\n"))
+	if opts.NoStd {
+		sb.WriteString("    pub const fn new() -> Self {\n")
+	} else {
+		sb.WriteString("    pub fn new() -> Self {\n")
+	}
 	sb.WriteString(fmt.Sprintf("        Self {\n"))
-	sb.WriteString(fmt.Sprintf("            state: %sState::%s,\n", typeName, toPascalCase(f.Initial)))
+	sb.WriteString(fmt.Sprintf("            state: %sState::%s,\n", typeName, ids.States[f.Initial]))
 	if f.Type == fsm.TypeMoore {
 		if out, ok := f.StateOutputs[f.Initial]; ok {
-			sb.WriteString(fmt.Sprintf("            output: Some(%sOutput::%s),\n", typeName, toPascalCase(out)))
+			sb.WriteString(fmt.Sprintf("            output: Some(%sOutput::%s),\n", typeName, ids.Outputs[out]))
 		} else {
 			sb.WriteString("            output: None,\n")
 		}
@@ -93,73 +140,24 @@ func GenerateRust(f *fsm.FSM) string {
 	sb.WriteString("        self.state\n")
 	sb.WriteString("    }\n\n")
 
-	// step()
-	sb.WriteString("    /// Process input, returns true if transition occurred\n")
-	sb.WriteString(fmt.Sprintf("    pub fn step(&mut self, input: %sInput) -> bool {\n", typeName))
-	sb.WriteString("        match (self.state, input) {\n")
-
-	// Generate match arms
-	for _, t := range f.Transitions {
-		if t.Input == nil {
-			continue // skip epsilon
-		}
-		if len(t.To) == 0 {
-			continue
-		}
-
-		fromPascal := toPascalCase(t.From)
-		inputPascal := toPascalCase(*t.Input)
-		toPascal := toPascalCase(t.To[0])
-
-		sb.WriteString(fmt.Sprintf("            (%sState::%s, %sInput::%s) => {\n",
-			typeName, fromPascal, typeName, inputPascal))
-		sb.WriteString(fmt.Sprintf("                self.state = %sState::%s;\n", typeName, toPascal))
-
-		if f.Type == fsm.TypeMoore {
-			if out, ok := f.StateOutputs[t.To[0]]; ok {
-				sb.WriteString(fmt.Sprintf("                self.output = Some(%sOutput::%s);\n", typeName, toPascalCase(out)))
-			}
-		} else if f.Type == fsm.TypeMealy && t.Output != nil {
-			sb.WriteString(fmt.Sprintf("                self.output = Some(%sOutput::%s);\n", typeName, toPascalCase(*t.Output)))
-		}
-
-		sb.WriteString("                true\n")
-		sb.WriteString("            }\n")
-	}
-
-	sb.WriteString("            _ => false,\n")
-	sb.WriteString("        }\n")
-	sb.WriteString("    }\n\n")
-
-	// can_step()
-	sb.WriteString("    /// Check if input is valid from current state (without transitioning)\n")
-	sb.WriteString(fmt.Sprintf("    pub fn can_step(&self, input: %sInput) -> bool {\n", typeName))
-	sb.WriteString("        match (self.state, input) {\n")
-
-	for _, t := range f.Transitions {
-		if t.Input == nil || len(t.To) == 0 {
-			continue
-		}
-		fromPascal := toPascalCase(t.From)
-		inputPascal := toPascalCase(*t.Input)
-		sb.WriteString(fmt.Sprintf("            (%sState::%s, %sInput::%s) => true,\n",
-			typeName, fromPascal, typeName, inputPascal))
+	if opts.NoStd {
+		writeRustTableMethods(&sb, f, typeName, strings.ToUpper(name), opts)
+	} else {
+		writeRustMatchMethods(&sb, f, ids, typeName, opts)
 	}
 
-	sb.WriteString("            _ => false,\n")
-	sb.WriteString("        }\n")
-	sb.WriteString("    }\n\n")
-
 	// is_accepting()
 	sb.WriteString("    /// Check if current state is accepting\n")
 	sb.WriteString("    pub fn is_accepting(&self) -> bool {\n")
-	if len(f.Accepting) > 0 {
+	if opts.NoStd {
+		sb.WriteString(fmt.Sprintf("        %s_ACCEPTING[self.state.index()]\n", strings.ToUpper(name)))
+	} else if len(f.Accepting) > 0 {
 		sb.WriteString("        matches!(self.state, ")
 		for i, acc := range f.Accepting {
 			if i > 0 {
 				sb.WriteString(" | ")
 			}
-			sb.WriteString(fmt.Sprintf("%sState::%s", typeName, toPascalCase(acc)))
+			sb.WriteString(fmt.Sprintf("%sState::%s", typeName, ids.States[acc]))
 		}
 		sb.WriteString(")\n")
 	} else {
@@ -175,13 +173,18 @@ func GenerateRust(f *fsm.FSM) string {
 		sb.WriteString("    }\n\n")
 	}
 
+	// step_char() (if the machine has input classes)
+	if classes != nil {
+		writeRustStepChar(&sb, typeName)
+	}
+
 	// reset()
 	sb.WriteString("    /// Reset to initial state\n")
 	sb.WriteString("    pub fn reset(&mut self) {\n")
-	sb.WriteString(fmt.Sprintf("        self.state = %sState::%s;\n", typeName, toPascalCase(f.Initial)))
+	sb.WriteString(fmt.Sprintf("        self.state = %sState::%s;\n", typeName, ids.States[f.Initial]))
 	if f.Type == fsm.TypeMoore {
 		if out, ok := f.StateOutputs[f.Initial]; ok {
-			sb.WriteString(fmt.Sprintf("        self.output = Some(%sOutput::%s);\n", typeName, toPascalCase(out)))
+			sb.WriteString(fmt.Sprintf("        self.output = Some(%sOutput::%s);\n", typeName, ids.Outputs[out]))
 		} else {
 			sb.WriteString("        self.output = None;\n")
 		}
@@ -199,25 +202,30 @@ func GenerateRust(f *fsm.FSM) string {
 	sb.WriteString("    }\n")
 	sb.WriteString("}\n\n")
 
+	// classify() on the input enum
+	if classes != nil {
+		writeRustClassify(&sb, f, ids, typeName, classes)
+	}
+
 	// Display impl for State
-	sb.WriteString(fmt.Sprintf("impl std::fmt::Display for %sState {\n", typeName))
-	sb.WriteString("    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {\n")
+	sb.WriteString(fmt.Sprintf("impl %s::Display for %sState {\n", fmtPath, typeName))
+	sb.WriteString(fmt.Sprintf("    fn fmt(&self, f: &mut %[1]s::Formatter<'_>) -> %[1]s::Result {\n", fmtPath))
 	sb.WriteString("        match self {\n")
 	for _, state := range f.States {
 		sb.WriteString(fmt.Sprintf("            %sState::%s => write!(f, \"%s\"),\n",
-			typeName, toPascalCase(state), state))
+			typeName, ids.States[state], rustFormat(state)))
 	}
 	sb.WriteString("        }\n")
 	sb.WriteString("    }\n")
 	sb.WriteString("}\n\n")
 
 	// Display impl for Input
-	sb.WriteString(fmt.Sprintf("impl std::fmt::Display for %sInput {\n", typeName))
-	sb.WriteString("    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {\n")
+	sb.WriteString(fmt.Sprintf("impl %s::Display for %sInput {\n", fmtPath, typeName))
+	sb.WriteString(fmt.Sprintf("    fn fmt(&self, f: &mut %[1]s::Formatter<'_>) -> %[1]s::Result {\n", fmtPath))
 	sb.WriteString("        match self {\n")
 	for _, input := range f.Alphabet {
 		sb.WriteString(fmt.Sprintf("            %sInput::%s => write!(f, \"%s\"),\n",
-			typeName, toPascalCase(input), input))
+			typeName, ids.Inputs[input], rustFormat(input)))
 	}
 	sb.WriteString("        }\n")
 	sb.WriteString("    }\n")
@@ -225,12 +233,12 @@ func GenerateRust(f *fsm.FSM) string {
 
 	// Display impl for Output
 	if len(f.OutputAlphabet) > 0 {
-		sb.WriteString(fmt.Sprintf("\nimpl std::fmt::Display for %sOutput {\n", typeName))
-		sb.WriteString("    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {\n")
+		sb.WriteString(fmt.Sprintf("\nimpl %s::Display for %sOutput {\n", fmtPath, typeName))
+		sb.WriteString(fmt.Sprintf("    fn fmt(&self, f: &mut %[1]s::Formatter<'_>) -> %[1]s::Result {\n", fmtPath))
 		sb.WriteString("        match self {\n")
 		for _, output := range f.OutputAlphabet {
 			sb.WriteString(fmt.Sprintf("            %sOutput::%s => write!(f, \"%s\"),\n",
-				typeName, toPascalCase(output), output))
+				typeName, ids.Outputs[output], rustFormat(output)))
 		}
 		sb.WriteString("        }\n")
 		sb.WriteString("    }\n")
@@ -240,22 +248,274 @@ func GenerateRust(f *fsm.FSM) string {
 	return sb.String()
 }
 
-// Helper functions
+// writeRustMatchMethods writes step() and can_step() as matches on the
+// state and input.
+func writeRustMatchMethods(sb *strings.Builder, f *fsm.FSM, ids *identifiers, typeName string, opts RustOptions) {
+	// A match covering every state and input needs no catch-all arm,
+	// which rustc would report as unreachable.
+	complete := isComplete(f)
 
-func toPascalCase(s string) string {
-	if s == "" {
-		return "Unknown"
+	// step()
+	sb.WriteString("    /// Process input, returns true if transition occurred\n")
+	sb.WriteString(fmt.Sprintf("    pub fn step(&mut self, input: %sInput) -> bool {\n", typeName))
+	sb.WriteString("        match (self.state, input) {\n")
+
+	// Generate match arms
+	for _, t := range f.Transitions {
+		if t.Input == nil {
+			continue // skip epsilon
+		}
+		if len(t.To) == 0 {
+			continue
+		}
+
+		fromPascal := ids.States[t.From]
+		inputPascal := ids.Inputs[*t.Input]
+		toPascal := ids.States[t.To[0]]
+
+		sb.WriteString(fmt.Sprintf("            (%sState::%s, %sInput::%s) => {\n",
+			typeName, fromPascal, typeName, inputPascal))
+		sb.WriteString(fmt.Sprintf("                self.state = %sState::%s;\n", typeName, toPascal))
+
+		if f.Type == fsm.TypeMoore {
+			if out, ok := f.StateOutputs[t.To[0]]; ok {
+				sb.WriteString(fmt.Sprintf("                self.output = Some(%sOutput::%s);\n", typeName, ids.Outputs[out]))
+			}
+		} else if f.Type == fsm.TypeMealy && t.Output != nil {
+			sb.WriteString(fmt.Sprintf("                self.output = Some(%sOutput::%s);\n", typeName, ids.Outputs[*t.Output]))
+		}
+
+		if opts.Defmt {
+			sb.WriteString("                #[cfg(feature = \"defmt\")]\n")
+			sb.WriteString(fmt.Sprintf("                defmt::trace!(\"%s --%s--> %s\");\n",
+				rustFormat(t.From), rustFormat(*t.Input), rustFormat(t.To[0])))
+		}
+		sb.WriteString("                true\n")
+		sb.WriteString("            }\n")
 	}
-	words := splitWords(s)
-	var result strings.Builder
-	for _, word := range words {
-		if len(word) > 0 {
-			result.WriteString(strings.ToUpper(string(word[0])))
-			if len(word) > 1 {
-				result.WriteString(strings.ToLower(word[1:]))
+
+	if !complete {
+		sb.WriteString("            _ => false,\n")
+	}
+	sb.WriteString("        }\n")
+	sb.WriteString("    }\n\n")
+
+	// can_step()
+	sb.WriteString("    /// Check if input is valid from current state (without transitioning)\n")
+	sb.WriteString(fmt.Sprintf("    pub fn can_step(&self, input: %sInput) -> bool {\n", typeName))
+	sb.WriteString("        match (self.state, input) {\n")
+
+	for _, t := range f.Transitions {
+		if t.Input == nil || len(t.To) == 0 {
+			continue
+		}
+		fromPascal := ids.States[t.From]
+		inputPascal := ids.Inputs[*t.Input]
+		sb.WriteString(fmt.Sprintf("            (%sState::%s, %sInput::%s) => true,\n",
+			typeName, fromPascal, typeName, inputPascal))
+	}
+
+	if !complete {
+		sb.WriteString("            _ => false,\n")
+	}
+	sb.WriteString("        }\n")
+	sb.WriteString("    }\n\n")
+}
+
+// isComplete reports whether f has a transition on every input from
+// every state.
+func isComplete(f *fsm.FSM) bool {
+	covered := make(map[[2]string]bool)
+	for _, t := range f.Transitions {
+		if t.Input != nil && len(t.To) > 0 {
+			covered[[2]string{t.From, *t.Input}] = true
+		}
+	}
+	return len(covered) == len(f.States)*len(f.Alphabet)
+}
+
+// writeRustTableMethods writes step() and can_step() as lookups in the
+// tables written by writeRustTables.
+func writeRustTableMethods(sb *strings.Builder, f *fsm.FSM, typeName, prefix string, opts RustOptions) {
+	// step()
+	sb.WriteString("    /// Process input, returns true if transition occurred\n")
+	sb.WriteString(fmt.Sprintf("    pub fn step(&mut self, input: %sInput) -> bool {\n", typeName))
+	sb.WriteString(fmt.Sprintf("        let next = match %s_NEXT[self.state.index()][input.index()] {\n", prefix))
+	sb.WriteString("            Some(next) => next,\n")
+	sb.WriteString("            None => return false,\n")
+	sb.WriteString("        };\n")
+	if opts.Defmt {
+		sb.WriteString("        #[cfg(feature = \"defmt\")]\n")
+		sb.WriteString("        defmt::trace!(\"{} --{}--> {}\", self.state, input, next);\n")
+	}
+	if f.Type == fsm.TypeMealy && len(f.OutputAlphabet) > 0 {
+		sb.WriteString(fmt.Sprintf("        if let Some(output) = %s_TRANSITION_OUTPUT[self.state.index()][input.index()] {\n", prefix))
+		sb.WriteString("            self.output = Some(output);\n")
+		sb.WriteString("        }\n")
+	}
+	sb.WriteString("        self.state = next;\n")
+	if f.Type == fsm.TypeMoore && len(f.OutputAlphabet) > 0 {
+		sb.WriteString(fmt.Sprintf("        if let Some(output) = %s_STATE_OUTPUT[next.index()] {\n", prefix))
+		sb.WriteString("            self.output = Some(output);\n")
+		sb.WriteString("        }\n")
+	}
+	sb.WriteString("        true\n")
+	sb.WriteString("    }\n\n")
+
+	// can_step()
+	sb.WriteString("    /// Check if input is valid from current state (without transitioning)\n")
+	sb.WriteString(fmt.Sprintf("    pub fn can_step(&self, input: %sInput) -> bool {\n", typeName))
+	sb.WriteString(fmt.Sprintf("        %s_NEXT[self.state.index()][input.index()].is_some()\n", prefix))
+	sb.WriteString("    }\n\n")
+}
+
+// writeRustIndex writes a const index() method giving each variant's row
+// or column in the transition tables.
+func writeRustIndex(sb *strings.Builder, enumName string, names []string, idents map[string]string, values map[string]int) {
+	sb.WriteString(fmt.Sprintf("impl %s {\n", enumName))
+	sb.WriteString("    /// Position in the transition tables\n")
+	sb.WriteString("    pub const fn index(self) -> usize {\n")
+	if isPositional(names, values) {
+		sb.WriteString("        self as usize\n")
+	} else {
+		sb.WriteString("        match self {\n")
+		for i, n := range names {
+			sb.WriteString(fmt.Sprintf("            %s::%s => %d,\n", enumName, idents[n], i))
+		}
+		sb.WriteString("        }\n")
+	}
+	sb.WriteString("    }\n")
+	sb.WriteString("}\n\n")
+}
+
+// writeRustTables writes the const tables used in no_std mode: the next
+// state for each state and input, the output of each transition (Mealy)
+// or state (Moore), and whether each state is accepting. As with the
+// match arms, the first transition for a state and input wins and
+// epsilon transitions are ignored.
+func writeRustTables(sb *strings.Builder, f *fsm.FSM, ids *identifiers, typeName, prefix string) {
+	stateIdx := make(map[string]int, len(f.States))
+	for i, s := range f.States {
+		stateIdx[s] = i
+	}
+	inputIdx := make(map[string]int, len(f.Alphabet))
+	for i, in := range f.Alphabet {
+		inputIdx[in] = i
+	}
+	next := make([][]string, len(f.States))
+	outputs := make([][]string, len(f.States))
+	for i := range next {
+		next[i] = make([]string, len(f.Alphabet))
+		outputs[i] = make([]string, len(f.Alphabet))
+	}
+	for _, t := range f.Transitions {
+		if t.Input == nil || len(t.To) == 0 {
+			continue
+		}
+		i, j := stateIdx[t.From], inputIdx[*t.Input]
+		if next[i][j] != "" {
+			continue
+		}
+		next[i][j] = t.To[0]
+		if t.Output != nil {
+			outputs[i][j] = *t.Output
+		}
+	}
+
+	some := func(enum string, idents map[string]string, v string) string {
+		if v == "" {
+			return "None"
+		}
+		return fmt.Sprintf("Some(%s::%s)", enum, idents[v])
+	}
+	writeRow := func(state string, cells []string, enum string, idents map[string]string) {
+		sb.WriteString("    [")
+		for j, c := range cells {
+			if j > 0 {
+				sb.WriteString(", ")
 			}
+			sb.WriteString(some(enum, idents, c))
+		}
+		sb.WriteString(fmt.Sprintf("], // %s\n", commentSafe(state)))
+	}
+
+	sb.WriteString("/// Next state, indexed by `[state.index()][input.index()]`\n")
+	sb.WriteString(fmt.Sprintf("pub const %s_NEXT: [[Option<%sState>; %d]; %d] = [\n",
+		prefix, typeName, len(f.Alphabet), len(f.States)))
+	for i, s := range f.States {
+		writeRow(s, next[i], typeName+"State", ids.States)
+	}
+	sb.WriteString("];\n\n")
+
+	if f.Type == fsm.TypeMealy && len(f.OutputAlphabet) > 0 {
+		sb.WriteString("/// Transition output, indexed by `[state.index()][input.index()]`\n")
+		sb.WriteString(fmt.Sprintf("pub const %s_TRANSITION_OUTPUT: [[Option<%sOutput>; %d]; %d] = [\n",
+			prefix, typeName, len(f.Alphabet), len(f.States)))
+		for i, s := range f.States {
+			writeRow(s, outputs[i], typeName+"Output", ids.Outputs)
+		}
+		sb.WriteString("];\n\n")
+	}
+
+	if f.Type == fsm.TypeMoore && len(f.OutputAlphabet) > 0 {
+		sb.WriteString("/// State output, indexed by `state.index()`\n")
+		sb.WriteString(fmt.Sprintf("pub const %s_STATE_OUTPUT: [Option<%sOutput>; %d] = [\n",
+			prefix, typeName, len(f.States)))
+		for _, s := range f.States {
+			sb.WriteString(fmt.Sprintf("    %s, // %s\n", some(typeName+"Output", ids.Outputs, f.StateOutputs[s]), commentSafe(s)))
+		}
+		sb.WriteString("];\n\n")
+	}
+
+	accepting := make(map[string]bool, len(f.Accepting))
+	for _, s := range f.Accepting {
+		accepting[s] = true
+	}
+	sb.WriteString("/// Accepting states, indexed by `state.index()`\n")
+	sb.WriteString(fmt.Sprintf("pub const %s_ACCEPTING: [bool; %d] = [\n", prefix, len(f.States)))
+	for _, s := range f.States {
+		sb.WriteString(fmt.Sprintf("    %t, // %s\n", accepting[s], commentSafe(s)))
+	}
+	sb.WriteString("];\n\n")
+}
+
+// writeRustDefmt derives defmt::Format behind the "defmt" feature.
+func writeRustDefmt(sb *strings.Builder, opts RustOptions) {
+	if opts.Defmt {
+		sb.WriteString("#[cfg_attr(feature = \"defmt\", derive(defmt::Format))]\n")
+	}
+}
+
+// rustFormat escapes s for the inside of a format string, for write! or
+// defmt::trace!: as for a string literal, with braces doubled.
+func rustFormat(s string) string {
+	return strings.NewReplacer("{", "{{", "}", "}}").Replace(rustEscape(s))
+}
+
+// writeRustVariants writes enum variants, named with idents, with
+// explicit discriminants when values are not positions.
+func writeRustVariants(sb *strings.Builder, names []string, idents map[string]string, values map[string]int) {
+	positional := isPositional(names, values)
+	for _, n := range names {
+		if positional {
+			sb.WriteString(fmt.Sprintf("    %s,\n", idents[n]))
+		} else {
+			sb.WriteString(fmt.Sprintf("    %s = %d,\n", idents[n], values[n]))
 		}
 	}
+}
+
+// Helper functions
+
+// toPascalCase joins the words of s (see nameWords), each with its first
+// letter in upper case and the rest in lower.
+func toPascalCase(s string) string {
+	var result strings.Builder
+	for _, word := range nameWords(s, false) {
+		first, size := utf8.DecodeRuneInString(word)
+		result.WriteRune(unicode.ToUpper(first))
+		result.WriteString(strings.ToLower(word[size:]))
+	}
 	name := result.String()
 	if name == "" {
 		return "Unknown"
@@ -264,29 +524,9 @@ func toPascalCase(s string) string {
 }
 
 func toSnakeCase(s string) string {
-	words := splitWords(s)
+	words := nameWords(s, false)
 	for i := range words {
 		words[i] = strings.ToLower(words[i])
 	}
 	return strings.Join(words, "_")
 }
-
-func splitWords(s string) []string {
-	var words []string
-	var current strings.Builder
-
-	for _, r := range s {
-		if r == '_' || r == '-' || r == ' ' {
-			if current.Len() > 0 {
-				words = append(words, current.String())
-				current.Reset()
-			}
-		} else {
-			current.WriteRune(r)
-		}
-	}
-	if current.Len() > 0 {
-		words = append(words, current.String())
-	}
-	return words
-}
@@ -0,0 +1,97 @@
+package codegen
+
+import (
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// GenerateCScanner generates C code for a scanner built by
+// fsm.BuildScanner, or any machine fsm.FSM.ValidateScanner accepts,
+// together with <name>_next_token, which reads the longest token at the
+// start of a buffer. The C scanner reads one byte per character, so its
+// classes should cover ASCII or, as with fsm.Lexer's Bytes option, byte
+// values.
+func GenerateCScanner(f *fsm.FSM) string {
+	header, _ := generateC(f, 0, true, COptions{})
+	return header
+}
+
+// GenerateCScannerWithOptions is GenerateCScanner with the options of
+// GenerateCWithOptions.
+func GenerateCScannerWithOptions(f *fsm.FSM, opts COptions) (header, source string) {
+	return generateC(f, 0, true, opts)
+}
+
+// GenerateGoScanner is GenerateCScanner for Go: Next<Type>Token reads
+// the longest token at the start of a string, one UTF-8 character at a
+// time. Like GenerateGo, the output also works with TinyGo.
+func GenerateGoScanner(f *fsm.FSM, packageName string) string {
+	return generateGo(f, packageName, 0, true)
+}
+
+// writeCScannerDecls writes the declaration of next_token.
+func writeCScannerDecls(sb *strings.Builder, name string) {
+	sb.WriteString(strings.NewReplacer("{name}", name).Replace(`// Read the longest token at the start of input, len bytes long, one byte
+// per character. Returns true and sets *token and *length if a token
+// starts there, false otherwise.
+bool {name}_next_token(const uint8_t *input, size_t len, {name}_output_t *token, size_t *length);
+
+`))
+}
+
+// writeCScanner writes next_token, with a single exit so that it suits
+// MISRA style too.
+func writeCScanner(sb *strings.Builder, name string, misra bool) {
+	zero := "0"
+	if misra {
+		zero = "0U"
+	}
+	sb.WriteString(strings.NewReplacer("{name}", name, "{0}", zero).Replace(`bool {name}_next_token(const uint8_t *input, size_t len, {name}_output_t *token, size_t *length) {
+    {name}_t fsm;
+    bool found = false;
+    size_t i = {0};
+
+    {name}_init(&fsm);
+    while ((i < len) && {name}_step_char(&fsm, (uint32_t)input[i])) {
+        i++;
+        if ({name}_is_accepting(&fsm)) {
+            *token = {name}_get_output(&fsm);
+            *length = i;
+            found = true;
+        }
+    }
+    return found;
+}
+
+`))
+}
+
+// writeGoScanner writes Next<Type>Token after the machine.
+func writeGoScanner(sb *strings.Builder, typeName string) {
+	sb.WriteString(strings.NewReplacer("{T}", typeName).Replace(`
+// Next{T}Token reads the longest token at the start of input, one
+// character at a time. It returns the token and its length in bytes, or
+// false if no token starts there.
+func Next{T}Token(input string) (token {T}Output, n int, ok bool) {
+	f := New{T}()
+	pending := false // the last token read ends before the next character
+	for i, c := range input {
+		if pending {
+			n, pending = i, false
+		}
+		if !f.StepRune(c) {
+			return token, n, ok
+		}
+		if f.IsAccepting() {
+			token, _ = f.Output()
+			ok, pending = true, true
+		}
+	}
+	if pending {
+		n = len(input)
+	}
+	return token, n, ok
+}
+`))
+}
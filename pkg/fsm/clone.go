@@ -0,0 +1,328 @@
+package fsm
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Clone returns a deep copy of the machine, including outputs, linked
+// machines, classes, state properties, nets, vocabulary, and metadata.
+// Nothing is shared with f, so either can be modified freely (for
+// example, to keep undo snapshots). Nil and empty collections are
+// preserved as they are.
+//
+// Copy, by contrast, copies only the behavioural fields.
+func (f *FSM) Clone() *FSM {
+	c := &FSM{
+		Type:           f.Type,
+		Name:           f.Name,
+		Description:    f.Description,
+		States:         cloneStrings(f.States),
+		Alphabet:       cloneStrings(f.Alphabet),
+		Initial:        f.Initial,
+		Accepting:      cloneStrings(f.Accepting),
+		StateOutputs:   cloneStringMap(f.StateOutputs),
+		OutputAlphabet: cloneStrings(f.OutputAlphabet),
+		LinkedMachines: cloneStringMap(f.LinkedMachines),
+		StackAlphabet:  cloneStrings(f.StackAlphabet),
+		StackStart:     f.StackStart,
+		StateClasses:   cloneStringMap(f.StateClasses),
+		Vocabulary:     f.Vocabulary,
+		Metadata:       cloneStringMap(f.Metadata),
+	}
+
+	if f.Transitions != nil {
+		c.Transitions = make([]Transition, len(f.Transitions))
+		for i, t := range f.Transitions {
+			c.Transitions[i] = Transition{
+				From:     t.From,
+				Input:    cloneStringPtr(t.Input),
+				To:       cloneStrings(t.To),
+				Output:   cloneStringPtr(t.Output),
+				Pop:      cloneStringPtr(t.Pop),
+				Push:     cloneStrings(t.Push),
+				Metadata: cloneStringMap(t.Metadata),
+			}
+			if t.Probability != nil {
+				p := *t.Probability
+				c.Transitions[i].Probability = &p
+			}
+			if t.Weight != nil {
+				w := *t.Weight
+				c.Transitions[i].Weight = &w
+			}
+		}
+	}
+
+	if f.StateMetadata != nil {
+		c.StateMetadata = make(map[string]map[string]string, len(f.StateMetadata))
+		for state, m := range f.StateMetadata {
+			c.StateMetadata[state] = cloneStringMap(m)
+		}
+	}
+
+	if f.Classes != nil {
+		c.Classes = make(map[string]*Class, len(f.Classes))
+		for name, cls := range f.Classes {
+			if cls == nil {
+				c.Classes[name] = nil
+				continue
+			}
+			cc := *cls
+			if cls.Properties != nil {
+				cc.Properties = append([]PropertyDef{}, cls.Properties...)
+			}
+			if cls.Ports != nil {
+				cc.Ports = append([]Port{}, cls.Ports...)
+			}
+			c.Classes[name] = &cc
+		}
+	}
+
+	if f.StateProperties != nil {
+		c.StateProperties = make(map[string]map[string]interface{}, len(f.StateProperties))
+		for state, props := range f.StateProperties {
+			if props == nil {
+				c.StateProperties[state] = nil
+				continue
+			}
+			cp := make(map[string]interface{}, len(props))
+			for k, v := range props {
+				cp[k] = clonePropertyValue(v)
+			}
+			c.StateProperties[state] = cp
+		}
+	}
+
+	if f.Nets != nil {
+		c.Nets = make([]Net, len(f.Nets))
+		for i, n := range f.Nets {
+			c.Nets[i] = Net{Name: n.Name}
+			if n.Endpoints != nil {
+				c.Nets[i].Endpoints = append([]NetEndpoint{}, n.Endpoints...)
+			}
+		}
+	}
+
+	return c
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func cloneStringPtr(p *string) *string {
+	if p == nil {
+		return nil
+	}
+	s := *p
+	return &s
+}
+
+// clonePropertyValue copies the mutable property value types (lists).
+func clonePropertyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []string:
+		return cloneStrings(x)
+	case []interface{}:
+		c := make([]interface{}, len(x))
+		for i, e := range x {
+			c[i] = clonePropertyValue(e)
+		}
+		return c
+	}
+	return v
+}
+
+// StructurallyEqual reports whether f and g describe the same machine:
+// the same type, name, description, vocabulary, initial state, and
+// stack start; the same sets of states, inputs, outputs, stack symbols,
+// and accepting states; the same transitions; and the same outputs,
+// links, classes, properties, nets, and metadata. Ordering is ignored
+// throughout (state order, transition order, and the order of targets
+// within a transition, though not of pushed stack symbols), as is the
+// difference between nil and empty collections.
+//
+// This is a comparison of the model, not of behaviour; see Equivalent
+// for language equivalence.
+func (f *FSM) StructurallyEqual(g *FSM) bool {
+	if f == nil || g == nil {
+		return f == g
+	}
+	if f.Type != g.Type || f.Name != g.Name || f.Description != g.Description ||
+		f.Vocabulary != g.Vocabulary || f.Initial != g.Initial || f.StackStart != g.StackStart {
+		return false
+	}
+	if !sameSet(f.States, g.States) || !sameSet(f.Alphabet, g.Alphabet) ||
+		!sameSet(f.OutputAlphabet, g.OutputAlphabet) || !sameSet(f.Accepting, g.Accepting) ||
+		!sameSet(f.StackAlphabet, g.StackAlphabet) {
+		return false
+	}
+	if !sameStringMap(f.StateOutputs, g.StateOutputs) ||
+		!sameStringMap(f.LinkedMachines, g.LinkedMachines) ||
+		!sameStringMap(f.StateClasses, g.StateClasses) ||
+		!sameStringMap(f.Metadata, g.Metadata) {
+		return false
+	}
+	if len(f.StateMetadata) != len(g.StateMetadata) {
+		return false
+	}
+	for state, m := range f.StateMetadata {
+		if n, ok := g.StateMetadata[state]; !ok || !sameStringMap(m, n) {
+			return false
+		}
+	}
+	if !sameTransitions(f.Transitions, g.Transitions) {
+		return false
+	}
+	if len(f.Classes) != len(g.Classes) {
+		return false
+	}
+	for name, fc := range f.Classes {
+		gc, ok := g.Classes[name]
+		if !ok || !reflect.DeepEqual(fc, gc) {
+			return false
+		}
+	}
+	if len(f.StateProperties) != len(g.StateProperties) {
+		return false
+	}
+	for state, fp := range f.StateProperties {
+		gp, ok := g.StateProperties[state]
+		if !ok || len(fp) != len(gp) {
+			return false
+		}
+		for k, v := range fp {
+			if w, ok := gp[k]; !ok || !reflect.DeepEqual(v, w) {
+				return false
+			}
+		}
+	}
+	return sameNets(f.Nets, g.Nets)
+}
+
+// sameSet reports whether a and b contain the same strings with the same
+// multiplicities, in any order.
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int, len(a))
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		if count[s] == 0 {
+			return false
+		}
+		count[s]--
+	}
+	return true
+}
+
+func sameStringMap(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// transitionKey renders a transition as a comparable string, with its
+// targets sorted.
+func transitionKey(t Transition) string {
+	to := append([]string(nil), t.To...)
+	sort.Strings(to)
+	key := t.From + "\x00"
+	if t.Input != nil {
+		key += "i" + *t.Input
+	}
+	key += "\x00"
+	for _, s := range to {
+		key += s + "\x01"
+	}
+	if t.Output != nil {
+		key += "\x00o" + *t.Output
+	}
+	if t.Probability != nil {
+		key += "\x00p" + strconv.FormatFloat(*t.Probability, 'g', -1, 64)
+	}
+	if t.Weight != nil {
+		key += "\x00w" + strconv.FormatFloat(*t.Weight, 'g', -1, 64)
+	}
+	if t.Pop != nil {
+		key += "\x00s" + *t.Pop
+	}
+	if len(t.Push) > 0 {
+		key += "\x00u" + strings.Join(t.Push, "\x01") // order matters
+	}
+	keys := make([]string, 0, len(t.Metadata))
+	for k := range t.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key += "\x00m" + k + "\x01" + t.Metadata[k]
+	}
+	return key
+}
+
+func sameTransitions(a, b []Transition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ka := make([]string, len(a))
+	kb := make([]string, len(b))
+	for i := range a {
+		ka[i] = transitionKey(a[i])
+		kb[i] = transitionKey(b[i])
+	}
+	return sameSet(ka, kb)
+}
+
+func sameNets(a, b []Net) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	byName := make(map[string]Net, len(a))
+	for _, n := range a {
+		byName[n.Name] = n
+	}
+	for _, n := range b {
+		m, ok := byName[n.Name]
+		if !ok || len(m.Endpoints) != len(n.Endpoints) {
+			return false
+		}
+		seen := make(map[NetEndpoint]int, len(m.Endpoints))
+		for _, ep := range m.Endpoints {
+			seen[ep]++
+		}
+		for _, ep := range n.Endpoints {
+			if seen[ep] == 0 {
+				return false
+			}
+			seen[ep]--
+		}
+	}
+	return true
+}
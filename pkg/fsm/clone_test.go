@@ -0,0 +1,94 @@
+package fsm
+
+import "testing"
+
+// richFSM exercises every field that Clone has to copy.
+func richFSM() *FSM {
+	f := redundantDFA()
+	f.Name = "rich"
+	f.Description = "every field set"
+	f.Vocabulary = "circuit"
+	f.OutputAlphabet = []string{"x"}
+	f.SetStateOutput("q0", "x")
+	f.SetLinkedMachine("q1", "child")
+	f.AddClass(&Class{
+		Name:       "chip",
+		Properties: []PropertyDef{{Name: "pins", Type: PropList}},
+		Ports:      []Port{{Name: "A", Direction: PortInput}, {Name: "B", Direction: PortOutput}},
+	})
+	f.StateClasses["q0"] = "chip"
+	f.StateClasses["q1"] = "chip"
+	f.StateProperties["q0"] = map[string]interface{}{"pins": []string{"1", "2"}}
+	f.Nets = []Net{{Name: "n1", Endpoints: []NetEndpoint{{Instance: "q0", Port: "B"}, {Instance: "q1", Port: "A"}}}}
+	return f
+}
+
+func TestClone_DeepCopy(t *testing.T) {
+	f := richFSM()
+	c := f.Clone()
+	if !f.StructurallyEqual(c) {
+		t.Fatal("clone is not structurally equal to the original")
+	}
+
+	// Mutate every nested collection of the clone; the original must not change.
+	c.States[0] = "changed"
+	*c.Transitions[0].Input = "changed"
+	c.Transitions[0].To[0] = "changed"
+	c.StateOutputs["q0"] = "changed"
+	c.LinkedMachines["q1"] = "changed"
+	c.Classes["chip"].Ports[0].Name = "changed"
+	c.Classes["chip"].Properties[0].Name = "changed"
+	c.StateProperties["q0"]["pins"].([]string)[0] = "changed"
+	c.Nets[0].Endpoints[0].Port = "changed"
+
+	if !f.StructurallyEqual(richFSM()) {
+		t.Error("mutating the clone changed the original")
+	}
+}
+
+func TestStructurallyEqual_IgnoresOrder(t *testing.T) {
+	f := richFSM()
+	g := richFSM()
+	g.States[0], g.States[3] = g.States[3], g.States[0]
+	g.Transitions[0], g.Transitions[5] = g.Transitions[5], g.Transitions[0]
+	g.Accepting = []string{"q2", "q1"}
+	g.StateOutputs = map[string]string{"q0": "x"}
+	if !f.StructurallyEqual(g) {
+		t.Error("reordering should not matter")
+	}
+
+	h := New(TypeDFA)
+	h.Classes, h.StateClasses, h.StateProperties, h.LinkedMachines = nil, nil, nil, nil
+	h2 := New(TypeDFA)
+	delete(h2.Classes, DefaultClassName)
+	if !h.StructurallyEqual(h2) {
+		t.Error("nil and empty maps should compare equal")
+	}
+}
+
+func TestStructurallyEqual_DetectsDifferences(t *testing.T) {
+	mutations := map[string]func(*FSM){
+		"type":        func(f *FSM) { f.Type = TypeNFA },
+		"name":        func(f *FSM) { f.Name = "other" },
+		"initial":     func(f *FSM) { f.Initial = "q1" },
+		"state":       func(f *FSM) { f.States[3] = "q4" },
+		"accepting":   func(f *FSM) { f.Accepting = []string{"q1"} },
+		"target":      func(f *FSM) { f.Transitions[0].To = []string{"q2"} },
+		"epsilon":     func(f *FSM) { f.Transitions[0].Input = nil },
+		"output":      func(f *FSM) { f.Transitions[0].Output = strp("x") },
+		"extra":       func(f *FSM) { f.AddTransition("q3", strp("b"), []string{"q0"}, nil) },
+		"state out":   func(f *FSM) { f.StateOutputs["q1"] = "x" },
+		"link":        func(f *FSM) { f.LinkedMachines["q2"] = "child" },
+		"class":       func(f *FSM) { f.Classes["chip"].KiCadPart = "74xx:7400" },
+		"state class": func(f *FSM) { delete(f.StateClasses, "q1") },
+		"property":    func(f *FSM) { f.StateProperties["q0"]["pins"] = []string{"1"} },
+		"net":         func(f *FSM) { f.Nets[0].Endpoints[1].Port = "B" },
+	}
+	for name, mutate := range mutations {
+		g := richFSM()
+		mutate(g)
+		if richFSM().StructurallyEqual(g) {
+			t.Errorf("%s: difference not detected", name)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package fsm
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// CompareOptions controls CompareBehavior.
+type CompareOptions struct {
+	Runs   int   // number of random input sequences (default 1000)
+	MaxLen int   // inputs per sequence (default 20)
+	Seed   int64 // random seed; the same options always give the same result
+}
+
+// Observation is what can be seen of a machine after some inputs.
+type Observation struct {
+	State     string `json:"state"` // current state, or set of states; "" once stuck
+	Accepting bool   `json:"accepting"`
+	Output    string `json:"output,omitempty"` // of the last step, or the initial Moore output
+	Stuck     bool   `json:"stuck,omitempty"`  // no transition on some input so far
+}
+
+// Divergence is an input sequence after which two machines are seen to
+// differ.
+type Divergence struct {
+	Run    int         `json:"run"`    // which sequence, from 1
+	Inputs []string    `json:"inputs"` // empty when the machines differ from the start
+	A      Observation `json:"a"`
+	B      Observation `json:"b"`
+}
+
+// CompareResult summarises CompareBehavior.
+type CompareResult struct {
+	Runs   int   `json:"runs"` // sequences run, up to and including a divergent one
+	MaxLen int   `json:"max_len"`
+	Seed   int64 `json:"seed"`
+	Steps  int   `json:"steps"` // inputs fed to both machines in all
+
+	// Divergence is the first divergent sequence found, or nil.
+	Divergence *Divergence `json:"divergence,omitempty"`
+}
+
+// behaviour is the part of Runner and PDARunner CompareBehavior needs.
+type behaviour interface {
+	step(input string) (string, error)
+	observe() Observation
+	AvailableInputs() []string
+	Reset()
+}
+
+type runnerBehaviour struct{ *Runner }
+
+func (r runnerBehaviour) step(input string) (string, error) { return r.Runner.step(input, false) }
+
+func (r runnerBehaviour) observe() Observation {
+	return Observation{State: r.CurrentState(), Accepting: r.IsAccepting()}
+}
+
+type pdaBehaviour struct{ *PDARunner }
+
+func (r pdaBehaviour) step(input string) (string, error) { return "", r.Step(input) }
+
+func (r pdaBehaviour) observe() Observation {
+	return Observation{State: r.CurrentState(), Accepting: r.IsAccepting()}
+}
+
+func newBehaviour(f *FSM) (behaviour, error) {
+	if f.Type == TypePDA {
+		r, err := NewPDARunner(f)
+		if err != nil {
+			return nil, err
+		}
+		return pdaBehaviour{r}, nil
+	}
+	r, err := NewRunner(f)
+	if err != nil {
+		return nil, err
+	}
+	return runnerBehaviour{r}, nil
+}
+
+// CompareBehavior runs the same random input sequences through two
+// machines side by side and reports the first point where they are seen
+// to differ: one accepts and the other does not, or they give different
+// outputs. Unlike Equivalent it proves nothing, but it works for every
+// machine type, pushdown automata included, and for machines too large
+// to determinise.
+//
+// Each sequence starts from the initial states and draws every input at
+// random from those either machine can take next, so runs follow the
+// machines' transitions rather than dying on unknown symbols. A machine
+// with no transition on an input is stuck: from then on it rejects and
+// gives no output, as if in an implicit sink (as in Equivalent). A
+// sequence ends after MaxLen inputs, or when neither machine can take
+// any input.
+func CompareBehavior(a, b *FSM, opts CompareOptions) (CompareResult, error) {
+	if opts.Runs == 0 {
+		opts.Runs = 1000
+	}
+	if opts.MaxLen == 0 {
+		opts.MaxLen = 20
+	}
+	switch {
+	case opts.Runs < 0:
+		return CompareResult{}, fmt.Errorf("runs must be positive, got %d", opts.Runs)
+	case opts.MaxLen < 0:
+		return CompareResult{}, fmt.Errorf("max length must be positive, got %d", opts.MaxLen)
+	}
+	ra, err := newBehaviour(a)
+	if err != nil {
+		return CompareResult{}, fmt.Errorf("first machine: %w", err)
+	}
+	rb, err := newBehaviour(b)
+	if err != nil {
+		return CompareResult{}, fmt.Errorf("second machine: %w", err)
+	}
+
+	initial := func(r behaviour, f *FSM) Observation {
+		o := r.observe()
+		if f.Type == TypeMoore {
+			o.Output = f.StateOutputs[f.Initial]
+		}
+		return o
+	}
+	differ := func(x, y Observation) bool {
+		return x.Accepting != y.Accepting || x.Output != y.Output
+	}
+
+	res := CompareResult{MaxLen: opts.MaxLen, Seed: opts.Seed}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	for run := 1; run <= opts.Runs; run++ {
+		res.Runs = run
+		ra.Reset()
+		rb.Reset()
+		oa, ob := initial(ra, a), initial(rb, b)
+		var inputs []string
+		for {
+			if differ(oa, ob) {
+				res.Divergence = &Divergence{Run: run, Inputs: inputs, A: oa, B: ob}
+				return res, nil
+			}
+			if len(inputs) == opts.MaxLen {
+				break
+			}
+			next := candidateInputs(ra, oa, rb, ob)
+			if len(next) == 0 {
+				break
+			}
+			in := next[rng.Intn(len(next))]
+			inputs = append(inputs, in)
+			res.Steps++
+			oa = stepObserved(ra, oa, in)
+			ob = stepObserved(rb, ob, in)
+		}
+	}
+	return res, nil
+}
+
+// candidateInputs returns the inputs either live runner can take, sorted.
+func candidateInputs(ra behaviour, oa Observation, rb behaviour, ob Observation) []string {
+	seen := make(map[string]bool)
+	var inputs []string
+	for _, p := range []struct {
+		r behaviour
+		o Observation
+	}{{ra, oa}, {rb, ob}} {
+		if p.o.Stuck {
+			continue
+		}
+		for _, in := range p.r.AvailableInputs() {
+			if !seen[in] {
+				seen[in] = true
+				inputs = append(inputs, in)
+			}
+		}
+	}
+	sort.Strings(inputs)
+	return inputs
+}
+
+// stepObserved feeds input to r, unless it is stuck already, and returns
+// what is seen afterwards.
+func stepObserved(r behaviour, prev Observation, input string) Observation {
+	if prev.Stuck {
+		return prev
+	}
+	out, err := r.step(input)
+	if err != nil {
+		return Observation{Stuck: true}
+	}
+	o := r.observe()
+	o.Output = out
+	return o
+}
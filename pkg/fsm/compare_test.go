@@ -0,0 +1,91 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// turnstile is a Mealy turnstile; alarm is its output on push when
+// locked.
+func turnstile(locked, unlocked, alarm string) *FSM {
+	f := New(TypeMealy)
+	f.States = []string{locked, unlocked}
+	f.Initial = locked
+	f.Alphabet = []string{"coin", "push"}
+	f.OutputAlphabet = []string{"click", alarm}
+	f.AddTransition(locked, strp("coin"), []string{unlocked}, strp("click"))
+	f.AddTransition(locked, strp("push"), []string{locked}, strp(alarm))
+	f.AddTransition(unlocked, strp("push"), []string{locked}, nil)
+	return f
+}
+
+func TestCompareBehavior_Mealy(t *testing.T) {
+	a := turnstile("locked", "unlocked", "alarm")
+	res, err := CompareBehavior(a, turnstile("L", "U", "alarm"), CompareOptions{Runs: 200, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Divergence != nil || res.Runs != 200 || res.Steps == 0 {
+		t.Errorf("renamed copy diverged: %+v", res)
+	}
+
+	res, err = CompareBehavior(a, turnstile("locked", "unlocked", "beep"), CompareOptions{Runs: 200, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := res.Divergence
+	if d == nil {
+		t.Fatal("no divergence found")
+	}
+	// The sequence ends at the first push while locked.
+	if last := d.Inputs[len(d.Inputs)-1]; last != "push" || d.A.Output != "alarm" || d.B.Output != "beep" {
+		t.Errorf("divergence %+v", d)
+	}
+	again, _ := CompareBehavior(a, turnstile("locked", "unlocked", "beep"), CompareOptions{Runs: 200, Seed: 1})
+	if !reflect.DeepEqual(again, res) {
+		t.Errorf("not reproducible: %+v then %+v", res, again)
+	}
+}
+
+func TestCompareBehavior_PDA(t *testing.T) {
+	// A DFA that counts only two a's agrees with the PDA up to a^2 b^2.
+	f := New(TypeDFA)
+	f.States = []string{"s", "a1", "a2", "b1", "ok"}
+	f.Initial = "s"
+	f.Alphabet = []string{"a", "b"}
+	f.Accepting = []string{"s", "ok"}
+	f.AddTransition("s", strp("a"), []string{"a1"}, nil)
+	f.AddTransition("a1", strp("a"), []string{"a2"}, nil)
+	f.AddTransition("a1", strp("b"), []string{"ok"}, nil)
+	f.AddTransition("a2", strp("b"), []string{"b1"}, nil)
+	f.AddTransition("b1", strp("b"), []string{"ok"}, nil)
+
+	res, err := CompareBehavior(anbnPDA(), f, CompareOptions{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := res.Divergence
+	if d == nil {
+		t.Fatal("no divergence found")
+	}
+	if !d.A.Accepting || d.B.Accepting || !d.B.Stuck || len(d.Inputs) < 6 {
+		t.Errorf("divergence %+v", d)
+	}
+}
+
+func TestCompareBehavior_InitialMoore(t *testing.T) {
+	a := New(TypeMoore)
+	a.States = []string{"s"}
+	a.Initial = "s"
+	a.StateOutputs = map[string]string{"s": "on"}
+	b := a.Clone()
+	b.StateOutputs = map[string]string{"s": "off"}
+
+	res, err := CompareBehavior(a, b, CompareOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := res.Divergence; d == nil || len(d.Inputs) != 0 || d.Run != 1 {
+		t.Errorf("divergence %+v", d)
+	}
+}
@@ -0,0 +1,277 @@
+package fsm
+
+import "fmt"
+
+// CompiledMachine is the immutable, integer-indexed form of a
+// deterministic machine. States, inputs, and outputs are identified by
+// their index in the lists returned by States, Inputs, and Outputs, which
+// follow the machine's own order. A CompiledMachine is safe for
+// concurrent use; each goroutine runs it through its own CompiledRunner.
+type CompiledMachine struct {
+	states   []string
+	inputs   []string
+	outputs  []string
+	stateID  map[string]int
+	inputID  map[string]int
+	outputID map[string]int
+
+	k         int     // alphabet size; row stride of next and transOut
+	next      []int32 // next[s*k+i] is the target of (s, i), or -1
+	transOut  []int32 // Mealy output of (s, i), or -1
+	stateOut  []int32 // Moore output of each state, or -1
+	accepting []bool
+	initial   int32
+	mealy     bool
+
+	classes *InputClassifier // nil without input classes
+}
+
+// CompiledRunner executes a machine from dense integer tables. States,
+// inputs, and outputs are identified by their index in the compiled
+// machine's lists (see StateID, InputID, OutputID), and Step does no
+// map lookups and no allocation, which suits processing millions of
+// symbols. For interactive use with history and NFA state sets, use
+// Runner.
+//
+// Like Runner, a CompiledRunner is not safe for concurrent use; give each
+// goroutine its own Clone. The compiled tables are immutable and shared.
+type CompiledRunner struct {
+	t      *CompiledMachine
+	state  int32
+	output int32
+}
+
+// NewCompiledRunner validates f and compiles it into a CompiledRunner
+// positioned at the initial state, as Compile does.
+func NewCompiledRunner(f *FSM) (*CompiledRunner, error) {
+	m, err := Compile(f)
+	if err != nil {
+		return nil, err
+	}
+	return m.NewRunner(), nil
+}
+
+// Compile validates f and compiles it into a CompiledMachine. An NFA is
+// first converted with ToDFA, so its state names become DFA subset names
+// and state outputs are not carried over. A DFA, Moore, or Mealy machine
+// with more than one transition for some (state, input) pair is an
+// error. Outputs used but missing from the output alphabet get IDs after
+// the declared ones. Input classes (see InputClassPrefix) are expanded
+// into the tables, so Step on a class's ID follows the fallback rules,
+// and StepSymbol classifies inputs.
+func Compile(f *FSM) (*CompiledMachine, error) {
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid FSM: %w", err)
+	}
+	if f.Type == TypePDA {
+		return nil, fmt.Errorf("cannot compile a PDA")
+	}
+	var classes *InputClassifier
+	if f.HasInputClasses() {
+		var err error
+		if classes, err = f.InputClassifier(); err != nil {
+			return nil, err
+		}
+		if f, err = f.ExpandInputClasses(); err != nil {
+			return nil, err
+		}
+	}
+	if f.Type == TypeNFA {
+		f = f.ToDFA()
+	}
+
+	ix := NewTransitionIndex(f)
+	n, k := len(f.States), len(f.Alphabet)
+	t := &CompiledMachine{
+		states:    append([]string(nil), f.States...),
+		inputs:    append([]string(nil), f.Alphabet...),
+		outputs:   append([]string(nil), f.OutputAlphabet...),
+		stateID:   ix.states,
+		inputID:   ix.inputs,
+		outputID:  ix.outputs,
+		k:         k,
+		next:      make([]int32, n*k),
+		accepting: make([]bool, n),
+		initial:   int32(ix.StateIndex(f.Initial)),
+		mealy:     f.Type == TypeMealy,
+		classes:   classes,
+	}
+	for i := range t.next {
+		t.next[i] = -1
+	}
+	if t.mealy {
+		t.transOut = make([]int32, n*k)
+		for i := range t.transOut {
+			t.transOut[i] = -1
+		}
+	}
+
+	// Outputs used but not declared get IDs after the declared ones.
+	outputID := func(o string) int32 {
+		id, ok := t.outputID[o]
+		if !ok {
+			id = len(t.outputs)
+			t.outputID[o] = id
+			t.outputs = append(t.outputs, o)
+		}
+		return int32(id)
+	}
+
+	for s, name := range f.States {
+		t.accepting[s] = ix.IsAccepting(name)
+		for _, tr := range ix.From(name) {
+			if tr.Input == nil || len(tr.To) == 0 {
+				continue
+			}
+			cell := s*k + ix.InputIndex(*tr.Input)
+			if t.next[cell] >= 0 || len(tr.To) > 1 {
+				return nil, fmt.Errorf("state %q has more than one transition on %q; use ToDFA first", name, *tr.Input)
+			}
+			t.next[cell] = int32(ix.StateIndex(tr.To[0]))
+			if t.mealy && tr.Output != nil {
+				t.transOut[cell] = outputID(*tr.Output)
+			}
+		}
+	}
+	if f.Type == TypeMoore {
+		t.stateOut = make([]int32, n)
+		for s, name := range f.States {
+			t.stateOut[s] = -1
+			if o, ok := f.StateOutputs[name]; ok {
+				t.stateOut[s] = outputID(o)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// NewRunner returns a runner for m positioned at the initial state.
+func (m *CompiledMachine) NewRunner() *CompiledRunner {
+	r := &CompiledRunner{t: m}
+	r.Reset()
+	return r
+}
+
+// States returns the state names, indexed by state ID.
+func (m *CompiledMachine) States() []string { return append([]string(nil), m.states...) }
+
+// Inputs returns the input symbols, indexed by input ID.
+func (m *CompiledMachine) Inputs() []string { return append([]string(nil), m.inputs...) }
+
+// Outputs returns the output symbols, indexed by output ID.
+func (m *CompiledMachine) Outputs() []string { return append([]string(nil), m.outputs...) }
+
+// StateID returns the ID of a state, or -1.
+func (m *CompiledMachine) StateID(name string) int { return lookup(m.stateID, name) }
+
+// InputID returns the ID of an input symbol, or -1.
+func (m *CompiledMachine) InputID(name string) int { return lookup(m.inputID, name) }
+
+// OutputID returns the ID of an output symbol, or -1.
+func (m *CompiledMachine) OutputID(name string) int { return lookup(m.outputID, name) }
+
+// Machine returns the compiled machine r runs.
+func (r *CompiledRunner) Machine() *CompiledMachine { return r.t }
+
+// Clone returns an independent runner in the same state, sharing r's
+// compiled tables. It does not allocate beyond the runner itself.
+func (r *CompiledRunner) Clone() *CompiledRunner {
+	c := *r
+	return &c
+}
+
+// Reset returns the runner to the initial state.
+func (r *CompiledRunner) Reset() {
+	r.state = r.t.initial
+	r.output = -1
+	if r.t.stateOut != nil {
+		r.output = r.t.stateOut[r.state]
+	}
+}
+
+// Step follows the transition on input ID i. It returns false, leaving
+// the runner unchanged, if the current state has no transition on i or
+// i is out of range.
+func (r *CompiledRunner) Step(i int) bool {
+	if i < 0 || i >= r.t.k {
+		return false
+	}
+	cell := int(r.state)*r.t.k + i
+	next := r.t.next[cell]
+	if next < 0 {
+		return false
+	}
+	r.state = next
+	switch {
+	case r.t.stateOut != nil:
+		r.output = r.t.stateOut[next]
+	case r.t.mealy:
+		r.output = r.t.transOut[cell]
+	}
+	return true
+}
+
+// StepSymbol is Step for an input given by name. If the machine has
+// input classes, the input is first read as the symbol covering it.
+func (r *CompiledRunner) StepSymbol(input string) bool {
+	if r.t.classes != nil {
+		if sym, ok := r.t.classes.Classify(input); ok {
+			input = sym
+		}
+	}
+	i, ok := r.t.inputID[input]
+	return ok && r.Step(i)
+}
+
+// Run steps through inputs and returns how many were consumed before
+// the first missing transition (len(inputs) if all were).
+func (r *CompiledRunner) Run(inputs []int) int {
+	for n, i := range inputs {
+		if !r.Step(i) {
+			return n
+		}
+	}
+	return len(inputs)
+}
+
+// State returns the current state ID.
+func (r *CompiledRunner) State() int { return int(r.state) }
+
+// StateName returns the name of the current state.
+func (r *CompiledRunner) StateName() string { return r.t.states[r.state] }
+
+// IsAccepting reports whether the current state is accepting.
+func (r *CompiledRunner) IsAccepting() bool { return r.t.accepting[r.state] }
+
+// Output returns the current output ID: the current state's output for
+// a Moore machine, or the last transition's for a Mealy machine. It is
+// -1 when there is none.
+func (r *CompiledRunner) Output() int { return int(r.output) }
+
+// OutputName returns the name of the current output, or "".
+func (r *CompiledRunner) OutputName() string {
+	if r.output < 0 {
+		return ""
+	}
+	return r.t.outputs[r.output]
+}
+
+// StateID returns the ID of a state in the compiled machine, or -1.
+func (r *CompiledRunner) StateID(name string) int { return r.t.StateID(name) }
+
+// InputID returns the ID of an input symbol, or -1.
+func (r *CompiledRunner) InputID(name string) int { return r.t.InputID(name) }
+
+// OutputID returns the ID of an output symbol, or -1.
+func (r *CompiledRunner) OutputID(name string) int { return r.t.OutputID(name) }
+
+// InputIDs maps a sequence of input names to IDs for use with Run.
+// Unknown names map to -1, which Run treats as a missing transition.
+func (r *CompiledRunner) InputIDs(names []string) []int {
+	ids := make([]int, len(names))
+	for n, name := range names {
+		ids[n] = r.InputID(name)
+	}
+	return ids
+}
@@ -0,0 +1,148 @@
+package fsm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestCompiledRunner_MatchesRunner drives both runners with the same
+// random inputs and checks they agree on every step.
+func TestCompiledRunner_MatchesRunner(t *testing.T) {
+	for _, typ := range []Type{TypeDFA, TypeMoore, TypeMealy} {
+		f, err := Random(RandomOptions{States: 40, Alphabet: 3, Density: 0.7, Type: typ, Seed: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewRunner(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewCompiledRunner(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rng := rand.New(rand.NewSource(1))
+		for step := 0; step < 2000; step++ {
+			in := f.Alphabet[rng.Intn(len(f.Alphabet))]
+			out, err := r.Step(in)
+			if ok := c.StepSymbol(in); ok != (err == nil) {
+				t.Fatalf("%s step %d: compiled ok=%v, runner err=%v", typ, step, ok, err)
+			}
+			if err != nil {
+				r.Reset()
+				c.Reset()
+				continue
+			}
+			if c.StateName() != r.CurrentState() {
+				t.Fatalf("%s step %d: state %s, want %s", typ, step, c.StateName(), r.CurrentState())
+			}
+			if c.OutputName() != out {
+				t.Fatalf("%s step %d: output %q, want %q", typ, step, c.OutputName(), out)
+			}
+			if c.IsAccepting() != r.IsAccepting() {
+				t.Fatalf("%s step %d: accepting disagrees", typ, step)
+			}
+		}
+	}
+}
+
+func TestCompiledRunner_NFA(t *testing.T) {
+	f, err := Random(RandomOptions{States: 12, Alphabet: 2, Type: TypeNFA, Seed: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCompiledRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(2))
+	for word := 0; word < 200; word++ {
+		inputs := make([]string, rng.Intn(8))
+		for i := range inputs {
+			inputs[i] = f.Alphabet[rng.Intn(len(f.Alphabet))]
+		}
+		r, _ := NewRunner(f)
+		_, err := r.Run(inputs)
+		want := err == nil && r.IsAccepting()
+
+		c.Reset()
+		got := c.Run(c.InputIDs(inputs)) == len(inputs) && c.IsAccepting()
+		if got != want {
+			t.Fatalf("%v: compiled accepts=%v, runner accepts=%v", inputs, got, want)
+		}
+	}
+}
+
+func TestCompiledRunner_RejectsNondeterministicDFA(t *testing.T) {
+	f := redundantDFA()
+	f.AddTransition("q0", strp("a"), []string{"q2"}, nil)
+	if _, err := NewCompiledRunner(f); err == nil {
+		t.Error("expected an error for a DFA with two transitions on the same input")
+	}
+}
+
+func TestCompiledRunner_StepIsAllocationFree(t *testing.T) {
+	c, err := NewCompiledRunner(redundantDFA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := c.InputID("a"), c.InputID("b")
+	allocs := testing.AllocsPerRun(1000, func() {
+		c.Step(a)
+		c.Step(b)
+		c.StepSymbol("a")
+	})
+	if allocs != 0 {
+		t.Errorf("Step allocated %.1f times per run", allocs)
+	}
+	if c.Step(-1) || c.Step(99) {
+		t.Error("out-of-range input IDs should not step")
+	}
+}
+
+func TestCompile_SharedMachine(t *testing.T) {
+	f := redundantDFA()
+	m, err := Compile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range f.States {
+		if m.StateID(s) != i || m.States()[i] != s {
+			t.Errorf("state %s: ID %d, want %d", s, m.StateID(s), i)
+		}
+	}
+	if m.InputID("b") != 1 || m.InputID("z") != -1 || len(m.Inputs()) != len(f.Alphabet) {
+		t.Errorf("inputs %v, b=%d", m.Inputs(), m.InputID("b"))
+	}
+
+	// Runners share the machine but not their state.
+	r1, r2 := m.NewRunner(), m.NewRunner()
+	r1.StepSymbol("a")
+	if r2.State() != m.StateID(f.Initial) || r1.State() == r2.State() {
+		t.Errorf("runners share state: %d and %d", r1.State(), r2.State())
+	}
+	if r1.Machine() != m || r2.Clone().Machine() != m {
+		t.Error("runners do not report their machine")
+	}
+	m.States()[0] = "changed"
+	if m.States()[0] == "changed" {
+		t.Error("States returned the machine's own slice")
+	}
+}
+
+func BenchmarkCompiledRunnerStep(b *testing.B) {
+	f, err := Random(RandomOptions{States: 5000, Alphabet: 4, Density: 1, Seed: 1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	c, err := NewCompiledRunner(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Step(i & 3)
+	}
+}
@@ -0,0 +1,277 @@
+package fsm
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Cost returns the cost of taking t: its Weight, or 1 if it has none.
+func (t Transition) Cost() float64 {
+	if t.Weight != nil {
+		return *t.Weight
+	}
+	return 1
+}
+
+// CostStep is one transition of a CostPath.
+type CostStep struct {
+	From  string  `json:"from"`
+	Input *string `json:"input"` // nil for epsilon
+	To    string  `json:"to"`
+	Cost  float64 `json:"cost"`
+}
+
+// CostPath is a cheapest path between two states.
+type CostPath struct {
+	Cost  float64    `json:"cost"`  // sum of the steps' costs
+	Steps []CostStep `json:"steps"` // empty for the path from a state to itself
+}
+
+// CheapestPaths finds the cheapest path from the state from to every
+// state it can reach, where each transition costs its Weight (1 if it
+// has none), using Dijkstra's algorithm. Epsilon transitions are steps
+// like any other, and an NFA transition reaches each of its targets at
+// its full cost. States that cannot be reached have no entry; from itself
+// has an empty path of cost 0. Among paths of equal cost, the one found
+// first in state and transition order is kept, so results are
+// repeatable.
+func (f *FSM) CheapestPaths(from string) (map[string]CostPath, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	ix := NewTransitionIndex(f)
+	src := ix.StateIndex(from)
+	if src < 0 {
+		v := f.Vocab()
+		return nil, fmt.Errorf("%s %q not in %s", strings.ToLower(v.State), from, strings.ToLower(v.States))
+	}
+
+	type prevStep struct {
+		state int
+		t     Transition
+	}
+	n := len(f.States)
+	dist := make([]float64, n)
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	prev := make([]*prevStep, n)
+	done := make([]bool, n)
+	dist[src] = 0
+	q := &costQueue{{src, 0}}
+	for q.Len() > 0 {
+		item := heap.Pop(q).(costItem)
+		if done[item.state] {
+			continue
+		}
+		done[item.state] = true
+		for _, t := range ix.From(f.States[item.state]) {
+			for _, to := range t.To {
+				j := ix.StateIndex(to)
+				if d := dist[item.state] + t.Cost(); d < dist[j] {
+					dist[j] = d
+					prev[j] = &prevStep{item.state, t}
+					heap.Push(q, costItem{j, d})
+				}
+			}
+		}
+	}
+
+	paths := make(map[string]CostPath)
+	for i, s := range f.States {
+		if !done[i] || ix.StateIndex(s) != i {
+			continue
+		}
+		path := CostPath{Cost: dist[i], Steps: []CostStep{}}
+		for j := i; prev[j] != nil; j = prev[j].state {
+			p := prev[j]
+			path.Steps = append(path.Steps, CostStep{
+				From:  f.States[p.state],
+				Input: p.t.Input,
+				To:    f.States[j],
+				Cost:  p.t.Cost(),
+			})
+		}
+		for a, b := 0, len(path.Steps)-1; a < b; a, b = a+1, b-1 {
+			path.Steps[a], path.Steps[b] = path.Steps[b], path.Steps[a]
+		}
+		paths[s] = path
+	}
+	return paths, nil
+}
+
+// costItem is a state waiting in CheapestPaths' queue.
+type costItem struct {
+	state int
+	dist  float64
+}
+
+// costQueue is a min-heap of costItems, ties broken by state order.
+type costQueue []costItem
+
+func (q costQueue) Len() int { return len(q) }
+func (q costQueue) Less(i, j int) bool {
+	if q[i].dist != q[j].dist {
+		return q[i].dist < q[j].dist
+	}
+	return q[i].state < q[j].state
+}
+func (q costQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *costQueue) Push(x interface{}) { *q = append(*q, x.(costItem)) }
+func (q *costQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// ExpectedCosts returns, for every state, the expected total cost of a
+// random run from that state until it first reaches the state to, when
+// the machine runs as a Markov chain (see StationaryDistribution) and
+// each transition costs its Weight (1 if it has none). A state from
+// which the run might never reach to has an expected cost of +Inf; to
+// itself has 0.
+//
+// The costs are found by solving a linear system with one equation per
+// state, which takes time cubic in the number of states.
+func (f *FSM) ExpectedCosts(to string) (map[string]float64, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	ix := NewTransitionIndex(f)
+	target := ix.StateIndex(to)
+	if target < 0 {
+		v := f.Vocab()
+		return nil, fmt.Errorf("%s %q not in %s", strings.ToLower(v.State), to, strings.ToLower(v.States))
+	}
+	out := markovChain(f, ix)
+	n := len(f.States)
+
+	// Find the states from which the run reaches the target with
+	// probability 1: those that can reach it without ever being able to
+	// step to a state that cannot.
+	sure := make([]bool, n)
+	for i := range sure {
+		sure[i] = ix.StateIndex(f.States[i]) == i
+	}
+	for {
+		reach := make([]bool, n)
+		reach[target] = true
+		for changed := true; changed; {
+			changed = false
+			for i, edges := range out {
+				if reach[i] || !sure[i] {
+					continue
+				}
+				for _, e := range edges {
+					if e.p > 0 && reach[e.to] {
+						reach[i] = true
+						changed = true
+						break
+					}
+				}
+			}
+		}
+		changed := false
+		for i, edges := range out {
+			if !sure[i] || i == target {
+				continue
+			}
+			ok := reach[i]
+			for _, e := range edges {
+				if e.p > 0 && !reach[e.to] {
+					ok = false
+				}
+			}
+			if !ok {
+				sure[i] = false
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	// E[s] = sum over moves of p * (cost + E[t]), with E[target] = 0,
+	// over the sure states other than the target.
+	var vars []int
+	col := make(map[int]int)
+	for i := range f.States {
+		if sure[i] && i != target {
+			col[i] = len(vars)
+			vars = append(vars, i)
+		}
+	}
+	m := len(vars)
+	a := make([][]float64, m)
+	for r, i := range vars {
+		a[r] = make([]float64, m+1)
+		a[r][r] = 1
+		for _, e := range out[i] {
+			a[r][m] += e.p * e.cost
+			if c, ok := col[e.to]; ok {
+				a[r][c] -= e.p
+			}
+		}
+	}
+	solution, err := solveLinear(a)
+	if err != nil {
+		return nil, err
+	}
+
+	costs := make(map[string]float64, n)
+	for i, s := range f.States {
+		if ix.StateIndex(s) != i {
+			continue
+		}
+		switch {
+		case i == target:
+			costs[s] = 0
+		case sure[i]:
+			costs[s] = solution[col[i]]
+		default:
+			costs[s] = math.Inf(1)
+		}
+	}
+	return costs, nil
+}
+
+// solveLinear solves the system whose augmented matrix is a (each row
+// holding the coefficients and then the constant) by Gaussian
+// elimination with partial pivoting. It overwrites a.
+func solveLinear(a [][]float64) ([]float64, error) {
+	m := len(a)
+	for c := 0; c < m; c++ {
+		pivot := c
+		for r := c + 1; r < m; r++ {
+			if math.Abs(a[r][c]) > math.Abs(a[pivot][c]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][c]) < 1e-12 {
+			return nil, fmt.Errorf("expected costs: singular system")
+		}
+		a[c], a[pivot] = a[pivot], a[c]
+		for r := c + 1; r < m; r++ {
+			k := a[r][c] / a[c][c]
+			if k == 0 {
+				continue
+			}
+			for j := c; j <= m; j++ {
+				a[r][j] -= k * a[c][j]
+			}
+		}
+	}
+	x := make([]float64, m)
+	for r := m - 1; r >= 0; r-- {
+		sum := a[r][m]
+		for j := r + 1; j < m; j++ {
+			sum -= a[r][j] * x[j]
+		}
+		x[r] = sum / a[r][r]
+	}
+	return x, nil
+}
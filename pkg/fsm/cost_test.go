@@ -0,0 +1,100 @@
+package fsm
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// dialFSM dials from idle; a dial connects with probability 0.8 and
+// otherwise fails, and a failure can be retried. An expensive direct
+// route from idle to connected also exists.
+func dialFSM() *FSM {
+	f := New(TypeNFA)
+	f.States = []string{"idle", "dialing", "connected", "failed"}
+	f.Alphabet = []string{"go", "retry"}
+	f.Initial = "idle"
+	for _, e := range []struct {
+		from, in, to string
+		p, w         float64
+	}{
+		{"idle", "go", "dialing", 0, 2},
+		{"dialing", "go", "connected", 0.8, 5},
+		{"dialing", "go", "failed", 0.2, 1},
+		{"failed", "retry", "dialing", 0, 3},
+		{"idle", "retry", "connected", 0, 20},
+	} {
+		in := e.in
+		f.AddTransition(e.from, &in, []string{e.to}, nil)
+		t := &f.Transitions[len(f.Transitions)-1]
+		t.Weight = probPtr(e.w)
+		if e.p > 0 {
+			t.Probability = probPtr(e.p)
+		}
+	}
+	return f
+}
+
+func TestCheapestPaths(t *testing.T) {
+	paths, err := dialFSM().CheapestPaths("idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"idle": 0, "dialing": 2, "connected": 7, "failed": 3}
+	for s, c := range want {
+		if paths[s].Cost != c {
+			t.Errorf("%s: cost %v, want %v", s, paths[s].Cost, c)
+		}
+	}
+	var route []string
+	for _, s := range paths["connected"].Steps {
+		route = append(route, s.From+">"+s.To)
+	}
+	if want := []string{"idle>dialing", "dialing>connected"}; !reflect.DeepEqual(route, want) {
+		t.Errorf("route %v, want %v", route, want)
+	}
+	if len(paths["idle"].Steps) != 0 {
+		t.Errorf("path from idle to itself: %v", paths["idle"].Steps)
+	}
+
+	paths, err = dialFSM().CheapestPaths("connected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := paths["idle"]; ok || len(paths) != 1 {
+		t.Errorf("from connected: %v, want only connected itself", paths)
+	}
+
+	if _, err := dialFSM().CheapestPaths("nowhere"); err == nil {
+		t.Error("unknown state accepted")
+	}
+	f := dialFSM()
+	f.Transitions[0].Weight = probPtr(-1)
+	if _, err := f.CheapestPaths("idle"); err == nil {
+		t.Error("negative weight accepted")
+	}
+}
+
+func TestExpectedCosts(t *testing.T) {
+	costs, err := dialFSM().ExpectedCosts("connected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// From dialing: 0.8*5 + 0.2*(1 + 3 + E[dialing]), so E = 6. From
+	// idle, go and retry are equally likely: (2 + 6)/2 + 20/2 = 14.
+	want := map[string]float64{"idle": 14, "dialing": 6, "failed": 9, "connected": 0}
+	for s, c := range want {
+		if math.Abs(costs[s]-c) > 1e-9 {
+			t.Errorf("%s: expected cost %v, want %v", s, costs[s], c)
+		}
+	}
+
+	// A run can reach connected and never come back to idle.
+	costs, err = dialFSM().ExpectedCosts("idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(costs["dialing"], 1) || costs["idle"] != 0 {
+		t.Errorf("costs to idle %v, want idle 0 and the rest infinite", costs)
+	}
+}
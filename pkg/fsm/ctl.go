@@ -0,0 +1,721 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CTL is a parsed formula of computation tree logic, checked against a
+// machine's transition graph by CheckCTL.
+//
+// Atoms are state names, true in that state, and the keywords true,
+// false, initial, accepting, and deadlock (a state with no transitions
+// out). A name that is a keyword, or contains spaces or operator
+// characters, is written in double quotes. Formulas combine with !, &,
+// |, and -> (loosest, right-associative), and with the temporal
+// operators, which bind as tightly as !:
+//
+//	EX p, AX p    p in some / every next state
+//	EF p, AF p    p eventually, on some path / on every path
+//	EG p, AG p    p always, on some path / on every path
+//	E[p U q]      on some path, p until q holds
+//	A[p U q]      on every path, p until q holds
+//
+// For example, AG(error -> AF idle) says that from every reachable error
+// state, every path returns to idle.
+type CTL struct {
+	op   ctlOp
+	name string // the state of an atom
+	l, r *CTL
+}
+
+type ctlOp int
+
+const (
+	ctlState ctlOp = iota
+	ctlTrue
+	ctlFalse
+	ctlInitial
+	ctlAccepting
+	ctlDeadlock
+	ctlNot
+	ctlAnd
+	ctlOr
+	ctlImplies
+	ctlEX
+	ctlAX
+	ctlEF
+	ctlAF
+	ctlEG
+	ctlAG
+	ctlEU
+	ctlAU
+)
+
+var ctlKeywords = map[string]ctlOp{
+	"true": ctlTrue, "false": ctlFalse, "initial": ctlInitial,
+	"accepting": ctlAccepting, "deadlock": ctlDeadlock,
+}
+
+var ctlUnary = map[string]ctlOp{
+	"EX": ctlEX, "AX": ctlAX, "EF": ctlEF, "AF": ctlAF, "EG": ctlEG, "AG": ctlAG,
+}
+
+// String returns the formula with full parentheses, as it was read.
+func (c *CTL) String() string {
+	switch c.op {
+	case ctlState:
+		for _, r := range c.name {
+			if !ctlNameRune(r) {
+				return strconv.Quote(c.name)
+			}
+		}
+		if _, ok := ctlKeywords[c.name]; ok || ctlReserved(c.name) || c.name == "" || strings.Contains(c.name, "->") {
+			return strconv.Quote(c.name)
+		}
+		return c.name
+	case ctlTrue, ctlFalse, ctlInitial, ctlAccepting, ctlDeadlock:
+		for k, op := range ctlKeywords {
+			if op == c.op {
+				return k
+			}
+		}
+	case ctlNot:
+		return "!" + c.l.String()
+	case ctlAnd:
+		return "(" + c.l.String() + " & " + c.r.String() + ")"
+	case ctlOr:
+		return "(" + c.l.String() + " | " + c.r.String() + ")"
+	case ctlImplies:
+		return "(" + c.l.String() + " -> " + c.r.String() + ")"
+	case ctlEU:
+		return "E[" + c.l.String() + " U " + c.r.String() + "]"
+	case ctlAU:
+		return "A[" + c.l.String() + " U " + c.r.String() + "]"
+	}
+	for k, op := range ctlUnary {
+		if op == c.op {
+			return k + " " + c.l.String()
+		}
+	}
+	return "?"
+}
+
+func ctlNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == ':' || r == '-'
+}
+
+// ctlReserved reports whether a bare word is an operator.
+func ctlReserved(w string) bool {
+	_, unary := ctlUnary[w]
+	return unary || w == "A" || w == "E" || w == "U"
+}
+
+// ParseCTL parses a CTL formula (see CTL).
+func ParseCTL(s string) (*CTL, error) {
+	p := &ctlParser{src: s}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	c, err := p.implies()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return c, nil
+}
+
+type ctlToken struct {
+	text   string
+	quoted bool
+}
+
+type ctlParser struct {
+	src    string
+	tokens []ctlToken
+	pos    int
+}
+
+func (p *ctlParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated string")
+			}
+			name, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return fmt.Errorf("malformed string %s", s[i:j+1])
+			}
+			p.tokens = append(p.tokens, ctlToken{name, true})
+			i = j + 1
+		case strings.HasPrefix(s[i:], "->"):
+			p.tokens = append(p.tokens, ctlToken{text: "->"})
+			i += 2
+		case strings.ContainsRune("!&|()[]", rune(c)):
+			p.tokens = append(p.tokens, ctlToken{text: string(c)})
+			i++
+		default:
+			j := i
+			for j < len(s) {
+				r := rune(s[j])
+				if r >= 0x80 || unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:", r) ||
+					r == '-' && !strings.HasPrefix(s[j:], "->") {
+					j++
+					continue
+				}
+				break
+			}
+			if j == i {
+				return fmt.Errorf("unexpected %q", string(c))
+			}
+			p.tokens = append(p.tokens, ctlToken{text: s[i:j]})
+			i = j
+		}
+	}
+	return nil
+}
+
+func (p *ctlParser) peek(text string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && p.tokens[p.pos].text == text
+}
+
+func (p *ctlParser) expect(text string) error {
+	if !p.peek(text) {
+		if p.pos < len(p.tokens) {
+			return fmt.Errorf("expected %q, found %q", text, p.tokens[p.pos].text)
+		}
+		return fmt.Errorf("expected %q at end of formula", text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *ctlParser) implies() (*CTL, error) {
+	l, err := p.binary("|")
+	if err != nil {
+		return nil, err
+	}
+	if p.peek("->") {
+		p.pos++
+		r, err := p.implies()
+		if err != nil {
+			return nil, err
+		}
+		return &CTL{op: ctlImplies, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+// binary parses a chain of | (which binds looser) or & operators.
+func (p *ctlParser) binary(op string) (*CTL, error) {
+	next, kind := p.unary, ctlAnd
+	if op == "|" {
+		next = func() (*CTL, error) { return p.binary("&") }
+		kind = ctlOr
+	}
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(op) {
+		p.pos++
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		l = &CTL{op: kind, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *ctlParser) unary() (*CTL, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of formula")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	if t.quoted {
+		return &CTL{op: ctlState, name: t.text}, nil
+	}
+	switch t.text {
+	case "!":
+		l, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &CTL{op: ctlNot, l: l}, nil
+	case "(":
+		c, err := p.implies()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	case "A", "E":
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		l, err := p.implies()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("U"); err != nil {
+			return nil, err
+		}
+		r, err := p.implies()
+		if err != nil {
+			return nil, err
+		}
+		op := ctlEU
+		if t.text == "A" {
+			op = ctlAU
+		}
+		return &CTL{op: op, l: l, r: r}, p.expect("]")
+	}
+	if op, ok := ctlUnary[t.text]; ok {
+		l, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &CTL{op: op, l: l}, nil
+	}
+	if op, ok := ctlKeywords[t.text]; ok {
+		return &CTL{op: op}, nil
+	}
+	if t.text == "U" || strings.ContainsAny(t.text, "&|()[]!") || t.text == "->" {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	return &CTL{op: ctlState, name: t.text}, nil
+}
+
+// CTLStep is one state of a path through a machine.
+type CTLStep struct {
+	State string `json:"state"`
+	// Input is the input taken to reach State, "" for the first state or
+	// an epsilon transition.
+	Input string `json:"input,omitempty"`
+}
+
+// CTLResult is the verdict of CheckCTL.
+type CTLResult struct {
+	Property string `json:"property"` // the formula, fully parenthesised
+	Holds    bool   `json:"holds"`
+	// Path shows why, when a single path can: from the initial state, a
+	// counterexample when the property fails, or a witness when it holds
+	// for an existential reason, such as EF p reaching p.
+	Path []CTLStep `json:"path,omitempty"`
+	// Loop is the index in Path of the state the last one leads back to
+	// when the path runs forever round a cycle, or -1.
+	Loop int `json:"loop"`
+}
+
+// CheckCTL checks a CTL property against f's transition graph: it holds
+// if it is true in the initial state. The graph has an edge wherever a
+// transition leads, whatever its input (epsilon transitions included),
+// and a state with no transitions out stays where it is for ever, so
+// every path is infinite. For a pushdown automaton the stack is ignored,
+// which makes the graph an over-approximation.
+func CheckCTL(f *FSM, property *CTL) (CTLResult, error) {
+	if f.Initial == "" {
+		return CTLResult{}, fmt.Errorf("machine has no initial state")
+	}
+	m := newCTLModel(f)
+	if err := m.resolve(property); err != nil {
+		return CTLResult{}, err
+	}
+	s := m.index[f.Initial]
+	res := CTLResult{Property: property.String(), Holds: m.sat(property)[s], Loop: -1}
+
+	var path []int
+	loop := -1
+	if res.Holds {
+		path, loop = m.witness(property, s)
+	} else {
+		path, loop = m.counter(property, s)
+	}
+	if len(path) > 1 || loop >= 0 {
+		res.Loop = loop
+		for i, st := range path {
+			step := CTLStep{State: m.states[st]}
+			if i > 0 {
+				step.Input = m.input[[2]int{path[i-1], st}]
+			}
+			res.Path = append(res.Path, step)
+		}
+	}
+	return res, nil
+}
+
+// ctlModel is a machine's transition graph, states by index.
+type ctlModel struct {
+	f      *FSM
+	states []string
+	index  map[string]int
+	succ   [][]int
+	pred   [][]int
+	dead   []bool            // no transitions out
+	input  map[[2]int]string // an input of the first transition on each edge
+	memo   map[*CTL][]bool
+}
+
+func newCTLModel(f *FSM) *ctlModel {
+	m := &ctlModel{f: f, index: make(map[string]int), input: make(map[[2]int]string), memo: make(map[*CTL][]bool)}
+	add := func(s string) int {
+		if i, ok := m.index[s]; ok {
+			return i
+		}
+		m.index[s] = len(m.states)
+		m.states = append(m.states, s)
+		return len(m.states) - 1
+	}
+	add(f.Initial)
+	for _, s := range f.States {
+		add(s)
+	}
+	type edge struct {
+		from, to int
+		input    string
+	}
+	var edges []edge
+	for _, t := range f.Transitions {
+		from := add(t.From)
+		in := ""
+		if t.Input != nil {
+			in = *t.Input
+		}
+		for _, to := range t.To {
+			edges = append(edges, edge{from, add(to), in})
+		}
+	}
+	m.succ = make([][]int, len(m.states))
+	m.pred = make([][]int, len(m.states))
+	m.dead = make([]bool, len(m.states))
+	for _, e := range edges {
+		key := [2]int{e.from, e.to}
+		if _, ok := m.input[key]; ok {
+			continue
+		}
+		m.input[key] = e.input
+		m.succ[e.from] = append(m.succ[e.from], e.to)
+		m.pred[e.to] = append(m.pred[e.to], e.from)
+	}
+	for i := range m.states {
+		if len(m.succ[i]) == 0 {
+			m.dead[i] = true
+			m.succ[i] = []int{i} // deadlocks stay put
+			m.pred[i] = append(m.pred[i], i)
+		}
+		sort.Ints(m.succ[i])
+	}
+	return m
+}
+
+// resolve checks that every state a formula names exists.
+func (m *ctlModel) resolve(c *CTL) error {
+	if c == nil {
+		return nil
+	}
+	if c.op == ctlState {
+		if _, ok := m.index[c.name]; !ok {
+			return fmt.Errorf("unknown state %q", c.name)
+		}
+	}
+	if err := m.resolve(c.l); err != nil {
+		return err
+	}
+	return m.resolve(c.r)
+}
+
+// sat returns, for each state, whether c holds there.
+func (m *ctlModel) sat(c *CTL) []bool {
+	if s, ok := m.memo[c]; ok {
+		return s
+	}
+	n := len(m.states)
+	s := make([]bool, n)
+	switch c.op {
+	case ctlState:
+		s[m.index[c.name]] = true
+	case ctlTrue:
+		for i := range s {
+			s[i] = true
+		}
+	case ctlFalse:
+	case ctlInitial:
+		s[m.index[m.f.Initial]] = true
+	case ctlAccepting:
+		for i, st := range m.states {
+			s[i] = m.f.IsAccepting(st)
+		}
+	case ctlDeadlock:
+		copy(s, m.dead)
+	case ctlNot:
+		l := m.sat(c.l)
+		for i := range s {
+			s[i] = !l[i]
+		}
+	case ctlAnd, ctlOr, ctlImplies:
+		l, r := m.sat(c.l), m.sat(c.r)
+		for i := range s {
+			switch c.op {
+			case ctlAnd:
+				s[i] = l[i] && r[i]
+			case ctlOr:
+				s[i] = l[i] || r[i]
+			default:
+				s[i] = !l[i] || r[i]
+			}
+		}
+	case ctlEX, ctlAX:
+		l := m.sat(c.l)
+		for i := range s {
+			any, all := false, true
+			for _, t := range m.succ[i] {
+				any = any || l[t]
+				all = all && l[t]
+			}
+			s[i] = any && c.op == ctlEX || all && c.op == ctlAX
+		}
+	case ctlEF:
+		s = m.until(allStates(n), m.sat(c.l), false)
+	case ctlAF:
+		s = m.until(allStates(n), m.sat(c.l), true)
+	case ctlEU:
+		s = m.until(m.sat(c.l), m.sat(c.r), false)
+	case ctlAU:
+		s = m.until(m.sat(c.l), m.sat(c.r), true)
+	case ctlEG:
+		s = m.globally(m.sat(c.l))
+	case ctlAG:
+		// AG p is !EF !p.
+		s = not(m.until(allStates(n), not(m.sat(c.l)), false))
+	}
+	m.memo[c] = s
+	return s
+}
+
+func allStates(n int) []bool {
+	s := make([]bool, n)
+	for i := range s {
+		s[i] = true
+	}
+	return s
+}
+
+// until returns the states satisfying E[p U q], or A[p U q] when all is
+// set: q, or p with some (every) successor in the set, to a least
+// fixpoint.
+func (m *ctlModel) until(p, q []bool, all bool) []bool {
+	n := len(m.states)
+	s := make([]bool, n)
+	pending := make([]int, n) // successors not yet in the set, for A
+	var queue []int
+	for i := 0; i < n; i++ {
+		pending[i] = len(m.succ[i])
+		if q[i] {
+			s[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		for _, i := range m.pred[t] {
+			if s[i] || !p[i] {
+				continue
+			}
+			pending[i]--
+			if !all || pending[i] == 0 {
+				s[i] = true
+				queue = append(queue, i)
+			}
+		}
+	}
+	return s
+}
+
+// globally returns the states satisfying EG p: p, with some successor
+// in the set, to a greatest fixpoint.
+func (m *ctlModel) globally(p []bool) []bool {
+	s := append([]bool{}, p...)
+	for changed := true; changed; {
+		changed = false
+		for i := range s {
+			if !s[i] {
+				continue
+			}
+			keep := false
+			for _, t := range m.succ[i] {
+				keep = keep || s[t]
+			}
+			if !keep {
+				s[i] = false
+				changed = true
+			}
+		}
+	}
+	return s
+}
+
+// pathTo returns a shortest path from s through states in within to a
+// state in target, s included, or nil.
+func (m *ctlModel) pathTo(s int, within, target []bool) []int {
+	prev := map[int]int{s: -1}
+	queue := []int{s}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if target[i] {
+			var path []int
+			for ; i >= 0; i = prev[i] {
+				path = append([]int{i}, path...)
+			}
+			return path
+		}
+		if !within[i] {
+			continue
+		}
+		for _, t := range m.succ[i] {
+			if _, ok := prev[t]; !ok {
+				prev[t] = i
+				queue = append(queue, t)
+			}
+		}
+	}
+	return nil
+}
+
+// lasso returns a path from s that stays in set for ever: a prefix and
+// a cycle, with the index where the cycle starts. s must satisfy EG of
+// set.
+func (m *ctlModel) lasso(s int, set []bool) ([]int, int) {
+	eg := m.globally(set)
+	seen := map[int]int{}
+	var path []int
+	for i := s; ; {
+		if at, ok := seen[i]; ok {
+			return path, at
+		}
+		seen[i] = len(path)
+		path = append(path, i)
+		next := -1
+		for _, t := range m.succ[i] {
+			if eg[t] {
+				next = t
+				break
+			}
+		}
+		if next < 0 {
+			return path, -1 // cannot happen when s satisfies EG set
+		}
+		i = next
+	}
+}
+
+// then appends tail, which starts at the last state of path.
+func then(path []int, tail []int, loop int) ([]int, int) {
+	if loop >= 0 {
+		loop += len(path) - 1
+	}
+	return append(path, tail[1:]...), loop
+}
+
+func not(s []bool) []bool {
+	out := make([]bool, len(s))
+	for i := range s {
+		out[i] = !s[i]
+	}
+	return out
+}
+
+// counter returns a path from s showing why c fails there.
+func (m *ctlModel) counter(c *CTL, s int) ([]int, int) {
+	switch c.op {
+	case ctlNot:
+		return m.witness(c.l, s)
+	case ctlAnd:
+		if !m.sat(c.l)[s] {
+			return m.counter(c.l, s)
+		}
+		return m.counter(c.r, s)
+	case ctlImplies:
+		return m.counter(c.r, s)
+	case ctlAX:
+		for _, t := range m.succ[s] {
+			if !m.sat(c.l)[t] {
+				tail, loop := m.counter(c.l, t)
+				return then([]int{s, t}, tail, loop)
+			}
+		}
+	case ctlAG:
+		bad := not(m.sat(c.l))
+		path := m.pathTo(s, allStates(len(m.states)), bad)
+		tail, loop := m.counter(c.l, path[len(path)-1])
+		return then(path, tail, loop)
+	case ctlAF:
+		return m.lasso(s, not(m.sat(c.l)))
+	case ctlAU:
+		p, q := m.sat(c.l), m.sat(c.r)
+		notQ := not(q)
+		stop := make([]bool, len(p))
+		for i := range stop {
+			stop[i] = !p[i] && !q[i]
+		}
+		if m.until(notQ, stop, false)[s] {
+			return m.pathTo(s, notQ, stop), -1
+		}
+		return m.lasso(s, notQ)
+	}
+	return []int{s}, -1
+}
+
+// witness returns a path from s showing why c holds there.
+func (m *ctlModel) witness(c *CTL, s int) ([]int, int) {
+	switch c.op {
+	case ctlNot:
+		return m.counter(c.l, s)
+	case ctlOr:
+		if m.sat(c.l)[s] {
+			return m.witness(c.l, s)
+		}
+		return m.witness(c.r, s)
+	case ctlImplies:
+		if m.sat(c.l)[s] {
+			return m.witness(c.r, s)
+		}
+	case ctlEX:
+		for _, t := range m.succ[s] {
+			if m.sat(c.l)[t] {
+				tail, loop := m.witness(c.l, t)
+				return then([]int{s, t}, tail, loop)
+			}
+		}
+	case ctlEF:
+		path := m.pathTo(s, allStates(len(m.states)), m.sat(c.l))
+		tail, loop := m.witness(c.l, path[len(path)-1])
+		return then(path, tail, loop)
+	case ctlEU:
+		path := m.pathTo(s, m.sat(c.l), m.sat(c.r))
+		tail, loop := m.witness(c.r, path[len(path)-1])
+		return then(path, tail, loop)
+	case ctlEG:
+		return m.lasso(s, m.sat(c.l))
+	}
+	return []int{s}, -1
+}
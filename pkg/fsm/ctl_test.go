@@ -0,0 +1,121 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+)
+
+// errorMachine is a controller that can fail and recover, and a stuck
+// state it never leaves.
+func errorMachine() *FSM {
+	f := New(TypeDFA)
+	f.States = []string{"idle", "busy", "error", "retry", "halt"}
+	f.Initial = "idle"
+	f.Alphabet = []string{"go", "done", "fail", "reset", "stop"}
+	f.Accepting = []string{"idle"}
+	f.AddTransition("idle", strp("go"), []string{"busy"}, nil)
+	f.AddTransition("busy", strp("done"), []string{"idle"}, nil)
+	f.AddTransition("busy", strp("fail"), []string{"error"}, nil)
+	f.AddTransition("error", strp("reset"), []string{"idle"}, nil)
+	f.AddTransition("error", strp("fail"), []string{"retry"}, nil)
+	f.AddTransition("retry", strp("fail"), []string{"error"}, nil)
+	f.AddTransition("retry", strp("stop"), []string{"halt"}, nil)
+	return f
+}
+
+func checkCTL(t *testing.T, f *FSM, prop string) CTLResult {
+	t.Helper()
+	c, err := ParseCTL(prop)
+	if err != nil {
+		t.Fatalf("%s: %v", prop, err)
+	}
+	res, err := CheckCTL(f, c)
+	if err != nil {
+		t.Fatalf("%s: %v", prop, err)
+	}
+	return res
+}
+
+func pathString(res CTLResult) string {
+	var parts []string
+	for i, s := range res.Path {
+		if i == res.Loop {
+			parts = append(parts, "*")
+		}
+		parts = append(parts, s.Input+":"+s.State)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestCheckCTL(t *testing.T) {
+	f := errorMachine()
+	tests := []struct {
+		prop  string
+		holds bool
+		path  string
+	}{
+		{"AG !(idle & busy)", true, ""},
+		{"EF halt", true, ":idle go:busy fail:error fail:retry stop:halt"},
+		{"AG EF idle", false, ":idle go:busy fail:error fail:retry stop:halt"},
+		// Going round error and retry for ever never reaches idle.
+		{"AG(error -> AF idle)", false, ":idle go:busy * fail:error fail:retry"},
+		{"AG(halt -> AX halt)", true, ""},
+		{"AX busy", true, ""},
+		{"EX error", false, ""},
+		{"A[!error U busy]", true, ""},
+		{"E[idle | busy U error]", true, ":idle go:busy fail:error"},
+		{"A[!halt U idle]", true, ""},
+		{"EG !halt", true, "* :idle go:busy"},
+		{"AG !deadlock", false, ":idle go:busy fail:error fail:retry stop:halt"},
+		{"initial & accepting & !false", true, ""},
+	}
+	for _, tt := range tests {
+		res := checkCTL(t, f, tt.prop)
+		if res.Holds != tt.holds || pathString(res) != tt.path {
+			t.Errorf("%s: holds %v, path %q; want %v, %q", tt.prop, res.Holds, pathString(res), tt.holds, tt.path)
+		}
+	}
+}
+
+func TestCheckCTL_AUCounterexample(t *testing.T) {
+	f := errorMachine()
+	// busy fails before reaching idle again on the path through error.
+	res := checkCTL(t, f, "AX A[busy U idle]")
+	if res.Holds || pathString(res) != ":idle go:busy fail:error" {
+		t.Errorf("got %v %q", res.Holds, pathString(res))
+	}
+	// A PDA is checked on its states alone.
+	if res := checkCTL(t, anbnPDA(), "AG EF done"); !res.Holds {
+		t.Errorf("PDA: %+v", res)
+	}
+}
+
+func TestParseCTL(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"AG(error -> AF idle)", "AG (error -> AF idle)"},
+		{"a & b | c -> d -> e", "(((a & b) | c) -> (d -> e))"},
+		{`!EX "two words" & "true"`, `(!EX "two words" & "true")`},
+		{"E[a U A[b U c]]", "E[a U A[b U c]]"},
+		{"state-1->ok", "(state-1 -> ok)"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCTL(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got := c.String(); got != tt.out {
+			t.Errorf("%s: got %s, want %s", tt.in, got, tt.out)
+		}
+	}
+
+	for _, bad := range []string{"", "AG", "a &", "(a", "E[a b]", `"a`, "a b", "a @ b", "U"} {
+		if _, err := ParseCTL(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+	c, _ := ParseCTL("AG nowhere")
+	if _, err := CheckCTL(errorMachine(), c); err == nil || !strings.Contains(err.Error(), "nowhere") {
+		t.Errorf("unknown state: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys that pin the numeric values code generators give to
+// states, inputs, and outputs, so that generated firmware keeps its
+// values (and stays compatible with log decoders and other tools that
+// know them) as the model evolves. A state's value is its "encoding"
+// state metadata; inputs and outputs, which have no metadata of their
+// own, use machine metadata keyed by prefix and name:
+//
+//	state_metadata: {"idle": {"encoding": "0x02"}}
+//	metadata:       {"encoding.input.coin": "7", "encoding.output.open": "0x10"}
+//
+// Values are decimal, or hexadecimal, octal, or binary with a 0x, 0o,
+// or 0b prefix, and must fit in 16 bits.
+const (
+	EncodingKey          = "encoding"
+	InputEncodingPrefix  = "encoding.input."
+	OutputEncodingPrefix = "encoding.output."
+)
+
+// MaxEncoding is the largest value a state, input, or output may be
+// given; generated code stores them in 16 bits.
+const MaxEncoding = 0xFFFF
+
+// Encoding holds the numeric value of each state, input, and output in
+// generated code.
+type Encoding struct {
+	States  map[string]int
+	Inputs  map[string]int
+	Outputs map[string]int
+}
+
+// Encodings returns the values code generators use: those pinned by
+// metadata (see EncodingKey), and for everything else the lowest values
+// not yet taken, in declaration order. With nothing pinned, each value
+// is the position in States, Alphabet, or OutputAlphabet. It is an error
+// for a pinned value to be malformed or out of range, for two names of a
+// kind to share a value, or for metadata to pin an input or output that
+// does not exist.
+func (f *FSM) Encodings() (*Encoding, error) {
+	statePins := make(map[string]string)
+	for _, s := range f.States {
+		if v, ok := f.StateMetadata[s][EncodingKey]; ok {
+			statePins[s] = v
+		}
+	}
+	inputPins := make(map[string]string)
+	outputPins := make(map[string]string)
+	for k, v := range f.Metadata {
+		if name, ok := strings.CutPrefix(k, InputEncodingPrefix); ok {
+			inputPins[name] = v
+		} else if name, ok := strings.CutPrefix(k, OutputEncodingPrefix); ok {
+			outputPins[name] = v
+		}
+	}
+
+	e := &Encoding{}
+	var err error
+	if e.States, err = assignEncoding("state", f.States, statePins); err != nil {
+		return nil, err
+	}
+	if e.Inputs, err = assignEncoding("input", f.Alphabet, inputPins); err != nil {
+		return nil, err
+	}
+	if e.Outputs, err = assignEncoding("output", f.OutputAlphabet, outputPins); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// assignEncoding numbers names, honouring the values in pins.
+func assignEncoding(kind string, names []string, pins map[string]string) (map[string]int, error) {
+	values := make(map[string]int, len(names))
+	owner := make(map[int]string)
+	declared := make(map[string]bool, len(names))
+	for _, name := range names {
+		declared[name] = true
+	}
+
+	// Report problems in a stable order.
+	pinned := make([]string, 0, len(pins))
+	for name := range pins {
+		pinned = append(pinned, name)
+	}
+	sort.Strings(pinned)
+	for _, name := range pinned {
+		if !declared[name] {
+			return nil, fmt.Errorf("encoding for unknown %s %q", kind, name)
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(pins[name]), 0, 64)
+		if err != nil || v < 0 || v > MaxEncoding {
+			return nil, fmt.Errorf("%s %q: invalid encoding %q (want 0 to %#x)", kind, name, pins[name], MaxEncoding)
+		}
+		if prev, taken := owner[int(v)]; taken {
+			return nil, fmt.Errorf("%ss %q and %q both have encoding %d", kind, prev, name, v)
+		}
+		values[name] = int(v)
+		owner[int(v)] = name
+	}
+
+	next := 0
+	for _, name := range names {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		for {
+			if _, taken := owner[next]; !taken {
+				break
+			}
+			next++
+		}
+		if next > MaxEncoding {
+			return nil, fmt.Errorf("too many %ss to encode in 16 bits", kind)
+		}
+		values[name] = next
+		owner[next] = name
+	}
+	return values, nil
+}
@@ -0,0 +1,58 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodings(t *testing.T) {
+	f := symbolsFSM()
+	enc, err := f.Encodings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"idle": 0, "busy": 1}; !reflect.DeepEqual(enc.States, want) {
+		t.Errorf("unpinned states = %v, want positions %v", enc.States, want)
+	}
+
+	f.SetStateMetadata("busy", EncodingKey, "0x00")
+	f.Metadata = map[string]string{
+		"encoding.input.reset": "0b101",
+		"encoding.output.none": "7",
+		"owner":                "not an encoding",
+	}
+	enc, err = f.Encodings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"idle": 1, "busy": 0}; !reflect.DeepEqual(enc.States, want) {
+		t.Errorf("states = %v, want %v", enc.States, want)
+	}
+	if want := map[string]int{"tick": 0, "tock": 1, "reset": 5}; !reflect.DeepEqual(enc.Inputs, want) {
+		t.Errorf("inputs = %v, want %v", enc.Inputs, want)
+	}
+	if want := map[string]int{"beep": 0, "none": 7}; !reflect.DeepEqual(enc.Outputs, want) {
+		t.Errorf("outputs = %v, want %v", enc.Outputs, want)
+	}
+}
+
+func TestEncodings_Errors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		state, meta map[string]string
+	}{
+		"duplicate":     {state: map[string]string{"idle": "3", "busy": "0x3"}},
+		"malformed":     {state: map[string]string{"idle": "three"}},
+		"out of range":  {state: map[string]string{"idle": "0x10000"}},
+		"negative":      {state: map[string]string{"idle": "-1"}},
+		"unknown input": {meta: map[string]string{"encoding.input.nope": "1"}},
+	} {
+		f := symbolsFSM()
+		for s, v := range tc.state {
+			f.SetStateMetadata(s, EncodingKey, v)
+		}
+		f.Metadata = tc.meta
+		if _, err := f.Encodings(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
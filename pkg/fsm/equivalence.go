@@ -0,0 +1,111 @@
+package fsm
+
+import "sort"
+
+// Equivalent reports whether two machines have the same observable
+// behaviour: the same accepted language for DFAs and NFAs, plus the same
+// output sequence for Moore and Mealy machines.
+//
+// Both machines are determinised first, with input class fallbacks
+// written out (see ExpandInputClasses); class symbols are compared by
+// name, not by the characters they stand for. The product of the two is then
+// explored breadth-first over the union of their alphabets, with missing
+// transitions leading to an implicit rejecting sink. When the machines
+// differ, the shortest distinguishing input sequence is returned.
+func Equivalent(a, b *FSM) (bool, []string) {
+	da, db := withFallbacks(a.ToDFA()), withFallbacks(b.ToDFA())
+
+	alphabet := unionSorted(da.Alphabet, db.Alphabet)
+	ta, tb := deltaTable(da), deltaTable(db)
+
+	// An empty name stands for the implicit sink.
+	type pair struct{ a, b string }
+	type node struct {
+		p    pair
+		path []string
+	}
+
+	observe := func(f *FSM, s string) (bool, string) {
+		if s == "" {
+			return false, ""
+		}
+		return f.IsAccepting(s), f.StateOutputs[s]
+	}
+
+	start := pair{da.Initial, db.Initial}
+	seen := map[pair]bool{start: true}
+	queue := []node{{p: start}}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		accA, outA := observe(da, n.p.a)
+		accB, outB := observe(db, n.p.b)
+		if accA != accB || outA != outB {
+			return false, n.path
+		}
+
+		for _, in := range alphabet {
+			ea := ta[n.p.a][in]
+			eb := tb[n.p.b][in]
+			if ea.output != eb.output {
+				return false, appendPath(n.path, in)
+			}
+			next := pair{ea.to, eb.to}
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			queue = append(queue, node{p: next, path: appendPath(n.path, in)})
+		}
+	}
+	return true, nil
+}
+
+// deltaEdge is a single deterministic transition used by Equivalent.
+type deltaEdge struct {
+	to     string
+	output string
+}
+
+// deltaTable indexes a deterministic machine's transitions by state and input.
+func deltaTable(f *FSM) map[string]map[string]deltaEdge {
+	table := make(map[string]map[string]deltaEdge)
+	for _, t := range f.Transitions {
+		if t.Input == nil || len(t.To) == 0 {
+			continue
+		}
+		if table[t.From] == nil {
+			table[t.From] = make(map[string]deltaEdge)
+		}
+		e := deltaEdge{to: t.To[0]}
+		if t.Output != nil {
+			e.output = *t.Output
+		}
+		table[t.From][*t.Input] = e
+	}
+	return table
+}
+
+func unionSorted(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, list := range [][]string{a, b} {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func appendPath(path []string, in string) []string {
+	out := make([]string, len(path)+1)
+	copy(out, path)
+	out[len(path)] = in
+	return out
+}
@@ -0,0 +1,72 @@
+package fsm
+
+import (
+	"bufio"
+	"io"
+)
+
+// FeedResult is the outcome of feeding a whole input sequence to a Runner.
+type FeedResult struct {
+	States   []string // current states after the last input consumed
+	Accepted bool     // every input was consumed and a current state is accepting
+	Rejected bool     // stopped early: the next input had no transition
+	Consumed int      // number of inputs consumed
+	Outputs  []string // non-empty outputs, in order
+}
+
+// Feed processes inputs from the current state in one call. Unlike Run,
+// it does not record history, so it can be used on long sequences. It
+// stops at the first input with no transition and reports it as
+// rejected; the runner is left in the state reached.
+func (r *Runner) Feed(inputs []string) FeedResult {
+	var res FeedResult
+	for _, in := range inputs {
+		if !r.feedOne(in, &res) {
+			break
+		}
+	}
+	return r.finishFeed(res)
+}
+
+// FeedReader is Feed over a token stream: split tokenises rd (for
+// example bufio.ScanWords, bufio.ScanLines, or bufio.ScanRunes) and each
+// token is one input. Reading stops early on rejection. The error is
+// from reading rd, not from the machine.
+func (r *Runner) FeedReader(rd io.Reader, split bufio.SplitFunc) (FeedResult, error) {
+	sc := bufio.NewScanner(rd)
+	sc.Split(split)
+	var res FeedResult
+	for sc.Scan() {
+		if !r.feedOne(sc.Text(), &res) {
+			break
+		}
+	}
+	return r.finishFeed(res), sc.Err()
+}
+
+// Accepts reports whether the machine accepts the token sequence read
+// from rd, starting from the initial state. The runner is reset first.
+func (r *Runner) Accepts(rd io.Reader, split bufio.SplitFunc) (bool, error) {
+	r.Reset()
+	res, err := r.FeedReader(rd, split)
+	return res.Accepted, err
+}
+
+func (r *Runner) feedOne(input string, res *FeedResult) bool {
+	out, err := r.step(input, false)
+	if err != nil {
+		res.Rejected = true
+		return false
+	}
+	res.Consumed++
+	if out != "" {
+		res.Outputs = append(res.Outputs, out)
+	}
+	return true
+}
+
+func (r *Runner) finishFeed(res FeedResult) FeedResult {
+	res.States = r.CurrentStates()
+	res.Accepted = !res.Rejected && r.IsAccepting()
+	return res
+}
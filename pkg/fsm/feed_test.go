@@ -0,0 +1,96 @@
+package fsm
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunner_Feed(t *testing.T) {
+	r, err := NewRunner(redundantDFA())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := r.Feed([]string{"b", "a", "b", "a"})
+	if !res.Accepted || res.Rejected || res.Consumed != 4 {
+		t.Errorf("bab a: got %+v, want accepted after 4 inputs", res)
+	}
+	if !reflect.DeepEqual(res.States, []string{"q1"}) {
+		t.Errorf("final states %v, want [q1]", res.States)
+	}
+	if len(r.History()) != 0 {
+		t.Errorf("Feed recorded %d history steps", len(r.History()))
+	}
+
+	r.Reset()
+	res = r.Feed([]string{"a", "c", "a"})
+	if res.Accepted || !res.Rejected || res.Consumed != 1 {
+		t.Errorf("a c a: got %+v, want rejected after 1 input", res)
+	}
+}
+
+func TestRunner_FeedCollectsOutputs(t *testing.T) {
+	f := New(TypeMealy)
+	f.AddState("s")
+	f.Alphabet = []string{"x", "y"}
+	f.OutputAlphabet = []string{"X", "Y"}
+	f.SetInitial("s")
+	f.AddTransition("s", strp("x"), []string{"s"}, strp("X"))
+	f.AddTransition("s", strp("y"), []string{"s"}, strp("Y"))
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := r.Feed([]string{"x", "y", "y"})
+	if !reflect.DeepEqual(res.Outputs, []string{"X", "Y", "Y"}) {
+		t.Errorf("outputs %v, want [X Y Y]", res.Outputs)
+	}
+}
+
+func TestRunner_AcceptsReader(t *testing.T) {
+	r, err := NewRunner(redundantDFA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		text  string
+		split bufio.SplitFunc
+		want  bool
+	}{
+		{"b a b a", bufio.ScanWords, true},
+		{"baba", bufio.ScanRunes, true},
+		{"a\nb\n", bufio.ScanLines, false},
+		{"a z a", bufio.ScanWords, false}, // z has no transition
+		{"", bufio.ScanWords, false},      // q0 is not accepting
+	}
+	for _, c := range cases {
+		got, err := r.Accepts(strings.NewReader(c.text), c.split)
+		if err != nil {
+			t.Fatalf("%q: %v", c.text, err)
+		}
+		if got != c.want {
+			t.Errorf("Accepts(%q) = %v, want %v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestRunner_FeedReaderStopsEarly(t *testing.T) {
+	r, err := NewRunner(redundantDFA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Everything after the rejected token is left unread.
+	rd := strings.NewReader("a z " + strings.Repeat("a ", 10000))
+	res, err := r.FeedReader(rd, bufio.ScanWords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Rejected || res.Consumed != 1 {
+		t.Errorf("got %+v, want rejected after 1 input", res)
+	}
+	if rd.Len() == 0 {
+		t.Error("reader was drained after rejection")
+	}
+}
@@ -0,0 +1,81 @@
+package fsm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fingerprint returns a SHA-256 hash, in hexadecimal, of everything that
+// determines the code generated from f: its type and name, its states,
+// inputs, and outputs in declaration order with their encodings (see
+// Encodings), the initial and accepting states, state outputs, and the
+// transitions, and input classes (see InputClasses). Layout,
+// descriptions, classes, and metadata other than pinned encodings and
+// input classes do not affect it, and neither does the order of
+// transitions or of accepting states, so re-saving a machine or moving
+// it in the editor keeps its fingerprint. Generated code can record the
+// fingerprint so that reviewers can check which model it came from.
+func (f *FSM) Fingerprint() string {
+	var sb strings.Builder
+	field := func(tag string, values ...string) {
+		sb.WriteString(tag)
+		for _, v := range values {
+			sb.WriteByte(' ')
+			sb.WriteString(strconv.Quote(v))
+		}
+		sb.WriteByte('\n')
+	}
+	// Invalid encodings leave values unpinned, as the generators do.
+	enc, err := f.Encodings()
+	if err != nil {
+		enc = &Encoding{}
+	}
+	named := func(tag string, names []string, values map[string]int) {
+		for _, n := range names {
+			if v, ok := values[n]; ok {
+				field(tag, n, strconv.Itoa(v))
+			} else {
+				field(tag, n)
+			}
+		}
+	}
+
+	field("type", string(f.Type))
+	field("name", f.Name)
+	named("state", f.States, enc.States)
+	named("input", f.Alphabet, enc.Inputs)
+	named("output", f.OutputAlphabet, enc.Outputs)
+	field("stack", f.StackAlphabet...)
+	field("stack-start", f.StackStart)
+	field("initial", f.Initial)
+	for _, in := range f.Alphabet {
+		if pattern, ok := f.Metadata[InputClassPrefix+in]; ok {
+			field("input-class", in, pattern)
+		}
+	}
+
+	accepting := append([]string(nil), f.Accepting...)
+	sort.Strings(accepting)
+	field("accepting", accepting...)
+
+	for _, s := range f.States {
+		if out, ok := f.StateOutputs[s]; ok {
+			field("state-output", s, out)
+		}
+	}
+
+	keys := make([]string, len(f.Transitions))
+	for i, t := range f.Transitions {
+		// Metadata has no semantics; transitionKey would include it.
+		t.Metadata = nil
+		keys[i] = transitionKey(t)
+	}
+	sort.Strings(keys)
+	field("transitions", keys...)
+
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
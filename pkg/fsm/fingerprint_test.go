@@ -0,0 +1,41 @@
+package fsm
+
+import "testing"
+
+func TestFingerprint_Stable(t *testing.T) {
+	f := symbolsFSM()
+	want := f.Fingerprint()
+	if len(want) != 64 {
+		t.Fatalf("fingerprint %q is not a hex SHA-256", want)
+	}
+
+	g := f.Clone()
+	g.Transitions[0], g.Transitions[4] = g.Transitions[4], g.Transitions[0]
+	g.Description = "documentation only"
+	g.Metadata = map[string]string{"owner": "team"}
+	g.SetStateMetadata("idle", "note", "x")
+	g.Transitions[1].Metadata = map[string]string{"req": "R-12"}
+	if got := g.Fingerprint(); got != want {
+		t.Errorf("fingerprint changed on reordering and annotation: %s, want %s", got, want)
+	}
+}
+
+func TestFingerprint_Changes(t *testing.T) {
+	base := symbolsFSM().Fingerprint()
+	for name, change := range map[string]func(f *FSM){
+		"name":        func(f *FSM) { f.Name = "other" },
+		"initial":     func(f *FSM) { f.Initial = "busy" },
+		"accepting":   func(f *FSM) { f.Accepting = []string{"idle"} },
+		"state order": func(f *FSM) { f.States[0], f.States[1] = f.States[1], f.States[0] },
+		"target":      func(f *FSM) { f.Transitions[0].To = []string{"idle"} },
+		"output":      func(f *FSM) { f.Transitions[0].Output = strp("none") },
+		"encoding":    func(f *FSM) { f.SetStateMetadata("busy", EncodingKey, "9") },
+		"input class": func(f *FSM) { f.Metadata = map[string]string{InputClassPrefix + f.Alphabet[0]: "*"} },
+	} {
+		f := symbolsFSM()
+		change(f)
+		if f.Fingerprint() == base {
+			t.Errorf("%s: fingerprint unchanged", name)
+		}
+	}
+}
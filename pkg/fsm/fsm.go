@@ -3,6 +3,7 @@ package fsm
 
 import (
 	"fmt"
+	"math"
 	"strings"
 )
 
@@ -14,6 +15,7 @@ const (
 	TypeNFA   Type = "nfa"
 	TypeMoore Type = "moore"
 	TypeMealy Type = "mealy"
+	TypePDA   Type = "pda" // pushdown automaton; see PDARunner
 )
 
 // Transition represents a state transition.
@@ -22,6 +24,30 @@ type Transition struct {
 	Input  *string  `json:"input"` // nil for epsilon
 	To     []string `json:"to"`    // single element for DFA, multiple for NFA
 	Output *string  `json:"output,omitempty"` // Mealy only
+
+	// Probability, if set, is the chance of taking this transition from
+	// its state on its input. The probabilities of the transitions
+	// sharing a state and input sum to 1 (see Validate). Machines that
+	// set them are Markov chains: see Runner.SetRandom and
+	// StationaryDistribution.
+	Probability *float64 `json:"probability,omitempty"`
+
+	// Weight, if set, is the cost of taking this transition, such as its
+	// latency. Transitions without one cost 1. See CheapestPaths and
+	// ExpectedCosts.
+	Weight *float64 `json:"weight,omitempty"`
+
+	// Stack operations, PDA only. Pop, if set, is the symbol that must be
+	// on top of the stack for the transition to apply; it is removed.
+	// Push lists the symbols then pushed, top first, so popping "Z" and
+	// pushing {"A", "Z"} puts an A on top of the Z.
+	Pop  *string  `json:"pop,omitempty"`
+	Push []string `json:"push,omitempty"`
+
+	// Metadata holds arbitrary tool data (IDs, owners, requirement
+	// links, UI hints). It is preserved by the file formats and ignored
+	// by every semantic operation.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // FSM represents a finite state machine.
@@ -38,6 +64,11 @@ type FSM struct {
 	OutputAlphabet []string          `json:"output_alphabet,omitempty"`
 	LinkedMachines map[string]string `json:"linked_machines,omitempty"` // state -> machine name
 
+	// PDA only: the symbols that may be on the stack, and the symbol (if
+	// any) on it when a run starts.
+	StackAlphabet []string `json:"stack_alphabet,omitempty"`
+	StackStart    string   `json:"stack_start,omitempty"`
+
 	// Class system: scoped per .fsm file.
 	Classes         map[string]*Class                    `json:"classes,omitempty"`          // class name -> definition
 	StateClasses    map[string]string                    `json:"state_classes,omitempty"`    // state name -> class name
@@ -49,6 +80,10 @@ type FSM struct {
 	// Vocabulary controls how concepts are labelled in user-facing output.
 	// Valid values: "fsm" (default), "circuit", "generic", or "" (auto).
 	Vocabulary string `json:"vocabulary,omitempty"`
+	// Metadata attached to the machine and to individual states, for
+	// downstream tools. Like Transition.Metadata it has no semantics.
+	Metadata      map[string]string            `json:"metadata,omitempty"`
+	StateMetadata map[string]map[string]string `json:"state_metadata,omitempty"` // state name -> key -> value
 }
 
 // New creates a new FSM with the given type.
@@ -140,6 +175,27 @@ func (f *FSM) SetStateOutput(state, output string) {
 	f.StateOutputs[state] = output
 }
 
+// SetStateMetadata sets a metadata key on a state. An empty value
+// removes the key.
+func (f *FSM) SetStateMetadata(state, key, value string) {
+	if value == "" {
+		if m := f.StateMetadata[state]; m != nil {
+			delete(m, key)
+			if len(m) == 0 {
+				delete(f.StateMetadata, state)
+			}
+		}
+		return
+	}
+	if f.StateMetadata == nil {
+		f.StateMetadata = make(map[string]map[string]string)
+	}
+	if f.StateMetadata[state] == nil {
+		f.StateMetadata[state] = make(map[string]string)
+	}
+	f.StateMetadata[state][key] = value
+}
+
 // Validate checks if the FSM is well-formed.
 func (f *FSM) Validate() error {
 	v := f.Vocab()
@@ -156,68 +212,35 @@ func (f *FSM) Validate() error {
 		return fmt.Errorf("FSM has no %s %s", strings.ToLower(v.Initial), sl)
 	}
 	
+	ix := NewTransitionIndex(f)
+
 	// Check initial state exists
-	found := false
-	for _, s := range f.States {
-		if s == f.Initial {
-			found = true
-			break
-		}
-	}
-	if !found {
+	if ix.StateIndex(f.Initial) < 0 {
 		return fmt.Errorf("%s %s %q not in %s", strings.ToLower(v.Initial), sl, f.Initial, sl2)
 	}
 	
 	// Check accepting states exist
 	for _, acc := range f.Accepting {
-		found = false
-		for _, s := range f.States {
-			if s == acc {
-				found = true
-				break
-			}
-		}
-		if !found {
+		if ix.StateIndex(acc) < 0 {
 			return fmt.Errorf("%s %s %q not in %s", strings.ToLower(v.Accepting), sl, acc, sl2)
 		}
 	}
 	
 	// Check transitions reference valid states and inputs
 	for i, t := range f.Transitions {
-		found = false
-		for _, s := range f.States {
-			if s == t.From {
-				found = true
-				break
-			}
-		}
-		if !found {
+		if ix.StateIndex(t.From) < 0 {
 			return fmt.Errorf("%s %d: from %s %q not in %s", tl, i, sl, t.From, sl2)
 		}
 		
 		for _, to := range t.To {
-			found = false
-			for _, s := range f.States {
-				if s == to {
-					found = true
-					break
-				}
-			}
-			if !found {
+			if ix.StateIndex(to) < 0 {
 				return fmt.Errorf("%s %d: to %s %q not in %s", tl, i, sl, to, sl2)
 			}
 		}
 		
 		// Check input against alphabet
 		if t.Input != nil {
-			found = false
-			for _, a := range f.Alphabet {
-				if a == *t.Input {
-					found = true
-					break
-				}
-			}
-			if !found {
+			if ix.InputIndex(*t.Input) < 0 {
 				return fmt.Errorf("%s %d: %s %q not in %s", tl, i, il, *t.Input, strings.ToLower(v.Alphabet))
 			}
 		} else {
@@ -227,32 +250,43 @@ func (f *FSM) Validate() error {
 			}
 		}
 
+		if t.Weight != nil && !(*t.Weight >= 0 && !math.IsInf(*t.Weight, 1)) {
+			return fmt.Errorf("%s %d: weight %v is not a non-negative number", tl, i, *t.Weight)
+		}
+
 		// Check Mealy output against OutputAlphabet
-		if t.Output != nil && len(f.OutputAlphabet) > 0 {
-			found = false
-			for _, o := range f.OutputAlphabet {
-				if o == *t.Output {
-					found = true
-					break
-				}
+		if t.Output != nil && len(f.OutputAlphabet) > 0 && ix.OutputIndex(*t.Output) < 0 {
+			return fmt.Errorf("%s %d: output %q not in output alphabet", tl, i, *t.Output)
+		}
+
+		// Check stack operations
+		if t.Pop != nil || len(t.Push) > 0 {
+			if f.Type != TypePDA {
+				return fmt.Errorf("%s %d: stack operations only allowed in PDA", tl, i)
 			}
-			if !found {
-				return fmt.Errorf("%s %d: output %q not in output alphabet", tl, i, *t.Output)
+			if t.Pop != nil && !stackSymbol(f, *t.Pop) {
+				return fmt.Errorf("%s %d: pop %q not in stack alphabet", tl, i, *t.Pop)
+			}
+			for _, sym := range t.Push {
+				if !stackSymbol(f, sym) {
+					return fmt.Errorf("%s %d: push %q not in stack alphabet", tl, i, sym)
+				}
 			}
 		}
 	}
 
+	if f.StackStart != "" && !stackSymbol(f, f.StackStart) {
+		return fmt.Errorf("stack start %q not in stack alphabet", f.StackStart)
+	}
+
+	if err := f.validateProbabilities(); err != nil {
+		return err
+	}
+
 	// Check Moore state outputs against OutputAlphabet
 	if f.Type == TypeMoore && len(f.OutputAlphabet) > 0 {
 		for state, output := range f.StateOutputs {
-			found = false
-			for _, o := range f.OutputAlphabet {
-				if o == output {
-					found = true
-					break
-				}
-			}
-			if !found {
+			if ix.OutputIndex(output) < 0 {
 				return fmt.Errorf("%s %q: output %q not in output alphabet", sl, state, output)
 			}
 		}
@@ -303,6 +337,7 @@ func (f *FSM) IsAccepting(state string) bool {
 
 // GetTransitions returns all transitions from a state on a given input.
 // For DFA, returns at most one transition. For NFA, may return multiple.
+// This scans every transition; build a TransitionIndex for repeated lookups.
 func (f *FSM) GetTransitions(from string, input *string) []Transition {
 	var result []Transition
 	for _, t := range f.Transitions {
@@ -323,6 +358,36 @@ func (f *FSM) GetEpsilonTransitions(from string) []Transition {
 	return f.GetTransitions(from, nil)
 }
 
+// EpsilonClosure returns the states reachable from states by epsilon
+// transitions alone, states themselves included, in the order of
+// f.States. This is the set an NFA is in after entering them.
+func (f *FSM) EpsilonClosure(states ...string) []string {
+	in := make(map[string]bool, len(states))
+	queue := append([]string(nil), states...)
+	for _, s := range states {
+		in[s] = true
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for _, t := range f.GetEpsilonTransitions(s) {
+			for _, to := range t.To {
+				if !in[to] {
+					in[to] = true
+					queue = append(queue, to)
+				}
+			}
+		}
+	}
+	closure := make([]string, 0, len(in))
+	for _, s := range f.States {
+		if in[s] {
+			closure = append(closure, s)
+		}
+	}
+	return closure
+}
+
 // String returns a string representation of the FSM.
 func (f *FSM) String() string {
 	var sb strings.Builder
@@ -335,25 +400,32 @@ func (f *FSM) String() string {
 	return sb.String()
 }
 
-// ValidationWarning represents a non-fatal issue with the FSM.
+// ValidationWarning represents a non-fatal issue with the FSM. Type is
+// the analysis rule that found it, ID the rule's stable ID (see
+// AnalysisID), and Severity its default severity in LintRules.
 type ValidationWarning struct {
-	Type    string
-	Message string
+	Type     string
+	ID       string
+	Severity Severity
+	Message  string
 	States  []string // affected states, if applicable
 	Symbols []string // affected symbols, if applicable
+	Path    []string // a representative path from the initial state, if applicable
 }
 
 // Analyse performs structural analysis and returns warnings.
 // This checks for issues that don't prevent the FSM from running
-// but may indicate design problems.
+// but may indicate design problems. States and machines can silence
+// rules with SuppressKey metadata.
 func (f *FSM) Analyse() []ValidationWarning {
 	var warnings []ValidationWarning
 	v := f.Vocab()
 	sl2 := strings.ToLower(v.States)
 	il2 := strings.ToLower(v.Input) + "(s)"
+	ix := NewTransitionIndex(f)
 
 	// Check for unreachable states
-	unreachable := f.UnreachableStates()
+	unreachable := f.unsuppressed(RuleUnreachable, f.unreachableStates(ix))
 	if len(unreachable) > 0 {
 		warnings = append(warnings, ValidationWarning{
 			Type:    "unreachable",
@@ -363,7 +435,7 @@ func (f *FSM) Analyse() []ValidationWarning {
 	}
 
 	// Check for dead states (no outgoing transitions)
-	dead := f.DeadStates()
+	dead := f.unsuppressed(RuleDead, f.deadStates(ix))
 	if len(dead) > 0 {
 		warnings = append(warnings, ValidationWarning{
 			Type:    "dead",
@@ -372,9 +444,33 @@ func (f *FSM) Analyse() []ValidationWarning {
 		})
 	}
 
+	// Check for trap regions and livelocks (only with accepting states)
+	g := newLivenessGraph(f, ix)
+	trapped, path := f.trapStates(g)
+	if trapped = f.unsuppressed(RuleTrap, trapped); len(trapped) > 0 {
+		warnings = append(warnings, ValidationWarning{
+			Type:    "trap",
+			Message: fmt.Sprintf("%d %s cannot reach any %s %s", len(trapped), sl2, strings.ToLower(v.Accepting), strings.ToLower(v.State)),
+			States:  trapped,
+			Path:    path,
+		})
+	}
+	for _, l := range f.livelocks(g) {
+		states := f.unsuppressed(RuleLivelock, l.states)
+		if len(states) == 0 {
+			continue
+		}
+		warnings = append(warnings, ValidationWarning{
+			Type:    "livelock",
+			Message: fmt.Sprintf("%d %s form a cycle with no way out and no %s %s", len(states), sl2, strings.ToLower(v.Accepting), strings.ToLower(v.State)),
+			States:  states,
+			Path:    l.path,
+		})
+	}
+
 	// Check for non-determinism in DFA
 	if f.Type == TypeDFA {
-		nondet := f.NonDeterministicStates()
+		nondet := f.unsuppressed(RuleNondeterministic, f.nonDeterministicStates(ix))
 		if len(nondet) > 0 {
 			warnings = append(warnings, ValidationWarning{
 				Type:    "nondeterministic",
@@ -386,7 +482,7 @@ func (f *FSM) Analyse() []ValidationWarning {
 
 	// Check for incomplete transitions (DFA should have transition for every input)
 	if f.Type == TypeDFA {
-		incomplete := f.IncompleteStates()
+		incomplete := f.unsuppressed(RuleIncomplete, f.incompleteStates(ix))
 		if len(incomplete) > 0 {
 			warnings = append(warnings, ValidationWarning{
 				Type:    "incomplete",
@@ -418,11 +514,20 @@ func (f *FSM) Analyse() []ValidationWarning {
 		}
 	}
 
-	return warnings
+	defaults := LintRules()
+	for i := range warnings {
+		warnings[i].ID = AnalysisID(warnings[i].Type)
+		warnings[i].Severity = defaults[warnings[i].Type]
+	}
+	return IgnoreWarnings(warnings, SuppressList(f.Metadata[SuppressKey]))
 }
 
 // UnreachableStates returns states not reachable from the initial state.
 func (f *FSM) UnreachableStates() []string {
+	return f.unreachableStates(NewTransitionIndex(f))
+}
+
+func (f *FSM) unreachableStates(ix *TransitionIndex) []string {
 	if f.Initial == "" {
 		return f.States // all unreachable if no initial
 	}
@@ -432,20 +537,16 @@ func (f *FSM) UnreachableStates() []string {
 	queue := []string{f.Initial}
 	reachable[f.Initial] = true
 
-	// Build adjacency for faster lookup
-	adj := make(map[string][]string)
-	for _, t := range f.Transitions {
-		adj[t.From] = append(adj[t.From], t.To...)
-	}
-
 	for len(queue) > 0 {
 		current := queue[0]
 		queue = queue[1:]
 
-		for _, next := range adj[current] {
-			if !reachable[next] {
-				reachable[next] = true
-				queue = append(queue, next)
+		for _, t := range ix.From(current) {
+			for _, next := range t.To {
+				if !reachable[next] {
+					reachable[next] = true
+					queue = append(queue, next)
+				}
 			}
 		}
 	}
@@ -463,15 +564,13 @@ func (f *FSM) UnreachableStates() []string {
 // DeadStates returns states with no outgoing transitions.
 // Accepting states without outgoing transitions are not considered dead.
 func (f *FSM) DeadStates() []string {
-	// Count outgoing transitions per state
-	outgoing := make(map[string]int)
-	for _, t := range f.Transitions {
-		outgoing[t.From]++
-	}
+	return f.deadStates(NewTransitionIndex(f))
+}
 
+func (f *FSM) deadStates(ix *TransitionIndex) []string {
 	var dead []string
 	for _, s := range f.States {
-		if outgoing[s] == 0 && !f.IsAccepting(s) {
+		if len(ix.From(s)) == 0 && !ix.IsAccepting(s) {
 			dead = append(dead, s)
 		}
 	}
@@ -480,27 +579,15 @@ func (f *FSM) DeadStates() []string {
 
 // NonDeterministicStates returns states that have multiple transitions on the same input.
 func (f *FSM) NonDeterministicStates() []string {
-	// Map: state -> input -> count
-	transitions := make(map[string]map[string]int)
-
-	for _, t := range f.Transitions {
-		if transitions[t.From] == nil {
-			transitions[t.From] = make(map[string]int)
-		}
-		inputKey := ""
-		if t.Input != nil {
-			inputKey = *t.Input
-		} else {
-			inputKey = "\x00epsilon" // special key for epsilon
-		}
-		transitions[t.From][inputKey]++
-	}
+	return f.nonDeterministicStates(NewTransitionIndex(f))
+}
 
+func (f *FSM) nonDeterministicStates(ix *TransitionIndex) []string {
 	var nondet []string
-	for state, inputs := range transitions {
-		for _, count := range inputs {
-			if count > 1 {
-				nondet = append(nondet, state)
+	for _, s := range f.States {
+		for _, t := range ix.From(s) {
+			if len(ix.Transitions(s, t.Input)) > 1 {
+				nondet = append(nondet, s)
 				break
 			}
 		}
@@ -510,23 +597,17 @@ func (f *FSM) NonDeterministicStates() []string {
 
 // IncompleteStates returns states that don't have transitions for all inputs.
 func (f *FSM) IncompleteStates() []string {
-	// Map: state -> set of inputs with transitions
-	covered := make(map[string]map[string]bool)
-
-	for _, t := range f.Transitions {
-		if t.Input == nil {
-			continue // epsilon doesn't count
-		}
-		if covered[t.From] == nil {
-			covered[t.From] = make(map[string]bool)
-		}
-		covered[t.From][*t.Input] = true
-	}
+	return f.incompleteStates(NewTransitionIndex(f))
+}
 
+func (f *FSM) incompleteStates(ix *TransitionIndex) []string {
 	var incomplete []string
 	for _, s := range f.States {
-		if len(covered[s]) < len(f.Alphabet) {
-			incomplete = append(incomplete, s)
+		for _, a := range f.Alphabet {
+			if len(ix.Transitions(s, &a)) == 0 {
+				incomplete = append(incomplete, s)
+				break
+			}
 		}
 	}
 	return incomplete
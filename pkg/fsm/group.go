@@ -0,0 +1,123 @@
+package fsm
+
+import "fmt"
+
+// GroupStates moves states into a new machine named machine and puts a
+// single state named composite, linked to that machine, in their place,
+// as a designer collapses part of a diagram into a composite state.
+//
+// The new machine is the subgraph of the grouped states (see Subgraph):
+// the transitions among them, their accepting status, outputs, classes,
+// metadata, and links. It starts where the group is entered: the initial
+// state if it is grouped, else the target of the first transition into
+// the group, else the first grouped state.
+//
+// In f, transitions into the group lead to the composite state, and
+// transitions out of it leave from the composite state, with duplicates
+// merged; transitions within the group are removed. The composite state
+// takes the place of the first grouped state in the state list, and is
+// initial if a grouped state was. Nets lose their endpoints on grouped
+// states. composite may reuse the name of a grouped state.
+//
+// f is changed only if no error is returned.
+func (f *FSM) GroupStates(states []string, composite, machine string) (*FSM, error) {
+	if composite == "" {
+		return nil, fmt.Errorf("composite state name is empty")
+	}
+	if machine == "" {
+		return nil, fmt.Errorf("machine name is empty")
+	}
+	child, err := f.Subgraph(states, false)
+	if err != nil {
+		return nil, err
+	}
+	grouped := make(map[string]bool, len(states))
+	for _, s := range states {
+		grouped[s] = true
+	}
+	if f.HasState(composite) && !grouped[composite] {
+		return nil, fmt.Errorf("state %q already exists", composite)
+	}
+
+	child.Name = machine
+	child.Description = ""
+	if !grouped[f.Initial] {
+		for _, t := range f.Transitions {
+			if grouped[t.From] {
+				continue
+			}
+			if entry := filterStates(t.To, grouped); len(entry) > 0 {
+				child.Initial = entry[0]
+				break
+			}
+		}
+	}
+
+	// Rewire the parent.
+	collapse := func(s string) string {
+		if grouped[s] {
+			return composite
+		}
+		return s
+	}
+	seen := make(map[string]bool)
+	transitions := make([]Transition, 0, len(f.Transitions))
+	for _, t := range f.Transitions {
+		if grouped[t.From] && len(filterStates(t.To, grouped)) == len(t.To) {
+			continue // within the group
+		}
+		t.From = collapse(t.From)
+		to := make([]string, 0, len(t.To))
+		for _, s := range t.To {
+			s = collapse(s)
+			if !contains(to, s) {
+				to = append(to, s)
+			}
+		}
+		t.To = to
+		key := transitionKey(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		transitions = append(transitions, t)
+	}
+
+	kept := make([]string, 0, len(f.States))
+	for _, s := range f.States {
+		switch {
+		case !grouped[s]:
+			kept = append(kept, s)
+		case !contains(kept, composite):
+			kept = append(kept, composite)
+		}
+	}
+	f.States = kept
+	f.Transitions = transitions
+	f.Initial = collapse(f.Initial)
+	notGrouped := make(map[string]bool, len(f.States))
+	for _, s := range f.States {
+		notGrouped[s] = !grouped[s]
+	}
+	f.Accepting = filterStates(f.Accepting, notGrouped)
+	f.StateOutputs = keepKeys(f.StateOutputs, notGrouped)
+	f.StateClasses = keepKeys(f.StateClasses, notGrouped)
+	f.StateProperties = keepKeys(f.StateProperties, notGrouped)
+	f.StateMetadata = keepKeys(f.StateMetadata, notGrouped)
+	f.LinkedMachines = keepKeys(f.LinkedMachines, notGrouped)
+	for _, s := range states {
+		f.CascadeDeleteState(s)
+	}
+	f.SetLinkedMachine(composite, machine)
+	return child, nil
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
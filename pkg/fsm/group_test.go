@@ -0,0 +1,80 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupStates(t *testing.T) {
+	f := subgraphFSM()
+	child, err := f.GroupStates([]string{"run", "stop"}, "working", "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if child.Name != "worker" || child.Initial != "run" {
+		t.Errorf("child %q starts at %q, want worker at run", child.Name, child.Initial)
+	}
+	if !reflect.DeepEqual(child.States, []string{"run", "stop"}) {
+		t.Errorf("child states %v", child.States)
+	}
+	if len(child.Transitions) != 1 || child.Transitions[0].From != "run" || child.Transitions[0].To[0] != "stop" {
+		t.Errorf("child transitions %v, want run --halt--> stop only", child.Transitions)
+	}
+
+	if !reflect.DeepEqual(f.States, []string{"off", "idle", "working", "fault"}) {
+		t.Errorf("parent states %v", f.States)
+	}
+	if f.GetLinkedMachine("working") != "worker" {
+		t.Errorf("working is linked to %q", f.GetLinkedMachine("working"))
+	}
+	var got []string
+	for _, tr := range f.Transitions {
+		got = append(got, tr.From+" "+*tr.Input+" "+tr.To[0])
+	}
+	want := []string{"off power idle", "idle go working", "working err fault", "working go idle"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parent transitions %v, want %v", got, want)
+	}
+	if len(f.Nets) != 1 || len(f.Nets[0].Endpoints) != 2 {
+		t.Errorf("nets %v still refer to grouped states", f.Nets)
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("parent invalid: %v", err)
+	}
+	if err := child.Validate(); err != nil {
+		t.Errorf("child invalid: %v", err)
+	}
+}
+
+func TestGroupStates_InitialAndErrors(t *testing.T) {
+	// Grouping the initial state makes the composite initial, and the
+	// composite may take a grouped state's name.
+	f := subgraphFSM()
+	child, err := f.GroupStates([]string{"idle", "off"}, "off", "startup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Initial != "off" || child.Initial != "off" || f.IsAccepting("off") {
+		t.Errorf("initial %q, child initial %q, accepting %v", f.Initial, child.Initial, f.Accepting)
+	}
+	if !reflect.DeepEqual(child.Accepting, []string{"idle"}) {
+		t.Errorf("child accepting %v", child.Accepting)
+	}
+
+	for name, call := range map[string]func(f *FSM) error{
+		"no states":       func(f *FSM) error { _, err := f.GroupStates(nil, "g", "m"); return err },
+		"unknown state":   func(f *FSM) error { _, err := f.GroupStates([]string{"nope"}, "g", "m"); return err },
+		"name taken":      func(f *FSM) error { _, err := f.GroupStates([]string{"run"}, "idle", "m"); return err },
+		"no machine name": func(f *FSM) error { _, err := f.GroupStates([]string{"run"}, "g", ""); return err },
+	} {
+		f := subgraphFSM()
+		before := f.Clone()
+		if call(f) == nil {
+			t.Errorf("%s: no error", name)
+		}
+		if !f.StructurallyEqual(before) {
+			t.Errorf("%s: machine changed", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package fsm
+
+// TransitionIndex answers "which transitions leave state s on input a"
+// and name-to-position lookups in constant time, instead of the linear
+// scans of GetTransitions, StateIndex, and friends. Build one with
+// NewTransitionIndex when a machine will be queried many times.
+//
+// The index is a snapshot: it does not see changes made to the machine
+// after it was built.
+type TransitionIndex struct {
+	byPair    map[pairKey][]Transition
+	byState   map[string][]Transition
+	states    map[string]int
+	inputs    map[string]int
+	outputs   map[string]int
+	accepting map[string]bool
+}
+
+// pairKey identifies a (state, input) pair; epsilon moves have
+// epsilon set and an empty input.
+type pairKey struct {
+	from    string
+	input   string
+	epsilon bool
+}
+
+func keyFor(from string, input *string) pairKey {
+	if input == nil {
+		return pairKey{from: from, epsilon: true}
+	}
+	return pairKey{from: from, input: *input}
+}
+
+// NewTransitionIndex indexes f's transitions, states, alphabets, and
+// accepting set. Building the index is O(transitions + states).
+func NewTransitionIndex(f *FSM) *TransitionIndex {
+	ix := &TransitionIndex{
+		byPair:    make(map[pairKey][]Transition, len(f.Transitions)),
+		byState:   make(map[string][]Transition, len(f.States)),
+		states:    firstIndex(f.States),
+		inputs:    firstIndex(f.Alphabet),
+		outputs:   firstIndex(f.OutputAlphabet),
+		accepting: make(map[string]bool, len(f.Accepting)),
+	}
+	for _, t := range f.Transitions {
+		k := keyFor(t.From, t.Input)
+		ix.byPair[k] = append(ix.byPair[k], t)
+		ix.byState[t.From] = append(ix.byState[t.From], t)
+	}
+	for _, s := range f.Accepting {
+		ix.accepting[s] = true
+	}
+	return ix
+}
+
+// firstIndex maps each name to the position of its first occurrence.
+func firstIndex(names []string) map[string]int {
+	m := make(map[string]int, len(names))
+	for i, n := range names {
+		if _, dup := m[n]; !dup {
+			m[n] = i
+		}
+	}
+	return m
+}
+
+// Transitions returns the transitions from a state on an input (nil for
+// epsilon), in the order they appear in the machine. Like GetTransitions,
+// but O(1). The returned slice must not be modified.
+func (ix *TransitionIndex) Transitions(from string, input *string) []Transition {
+	return ix.byPair[keyFor(from, input)]
+}
+
+// Epsilon returns the epsilon transitions from a state.
+func (ix *TransitionIndex) Epsilon(from string) []Transition {
+	return ix.byPair[pairKey{from: from, epsilon: true}]
+}
+
+// From returns every transition leaving a state, in machine order.
+// The returned slice must not be modified.
+func (ix *TransitionIndex) From(state string) []Transition {
+	return ix.byState[state]
+}
+
+// StateIndex returns the position of a state in f.States, or -1.
+func (ix *TransitionIndex) StateIndex(state string) int {
+	return lookup(ix.states, state)
+}
+
+// InputIndex returns the position of an input in f.Alphabet, or -1.
+func (ix *TransitionIndex) InputIndex(input string) int {
+	return lookup(ix.inputs, input)
+}
+
+// OutputIndex returns the position of an output in f.OutputAlphabet, or -1.
+func (ix *TransitionIndex) OutputIndex(output string) int {
+	return lookup(ix.outputs, output)
+}
+
+// IsAccepting reports whether a state is accepting.
+func (ix *TransitionIndex) IsAccepting(state string) bool {
+	return ix.accepting[state]
+}
+
+func lookup(m map[string]int, name string) int {
+	if i, ok := m[name]; ok {
+		return i
+	}
+	return -1
+}
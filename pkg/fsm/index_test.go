@@ -0,0 +1,86 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransitionIndex_MatchesLinearLookup(t *testing.T) {
+	for _, typ := range []Type{TypeDFA, TypeNFA, TypeMealy} {
+		f, err := Random(RandomOptions{States: 30, Alphabet: 4, Type: typ, Seed: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix := NewTransitionIndex(f)
+		for _, s := range f.States {
+			for _, a := range f.Alphabet {
+				want := f.GetTransitions(s, &a)
+				if got := ix.Transitions(s, &a); len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+					t.Errorf("%s: Transitions(%s, %s) = %v, want %v", typ, s, a, got, want)
+				}
+			}
+			want := f.GetEpsilonTransitions(s)
+			if got := ix.Epsilon(s); len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+				t.Errorf("%s: Epsilon(%s) = %v, want %v", typ, s, got, want)
+			}
+			if ix.IsAccepting(s) != f.IsAccepting(s) {
+				t.Errorf("%s: IsAccepting(%s) disagrees", typ, s)
+			}
+			if ix.StateIndex(s) != f.StateIndex(s) {
+				t.Errorf("%s: StateIndex(%s) = %d, want %d", typ, s, ix.StateIndex(s), f.StateIndex(s))
+			}
+		}
+	}
+}
+
+func TestTransitionIndex_Lookups(t *testing.T) {
+	f := redundantDFA()
+	f.OutputAlphabet = []string{"x", "y"}
+	ix := NewTransitionIndex(f)
+
+	if got := ix.InputIndex("b"); got != 1 {
+		t.Errorf("InputIndex(b) = %d, want 1", got)
+	}
+	if got := ix.OutputIndex("y"); got != 1 {
+		t.Errorf("OutputIndex(y) = %d, want 1", got)
+	}
+	for _, missing := range []int{ix.StateIndex("nope"), ix.InputIndex("c"), ix.OutputIndex("z")} {
+		if missing != -1 {
+			t.Errorf("missing name should give -1, got %d", missing)
+		}
+	}
+	if got := len(ix.From("q0")); got != 2 {
+		t.Errorf("From(q0) has %d transitions, want 2", got)
+	}
+	if got := ix.From("nope"); got != nil {
+		t.Errorf("From(unknown) = %v, want nil", got)
+	}
+}
+
+func BenchmarkRunnerStep(b *testing.B) {
+	f, err := Random(RandomOptions{States: 5000, Alphabet: 4, Seed: 1}) // ~16k transitions
+	if err != nil {
+		b.Fatal(err)
+	}
+	r, err := NewRunner(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Step(f.Alphabet[i%len(f.Alphabet)]); err != nil {
+			r.Reset()
+		}
+	}
+}
+
+func BenchmarkAnalyse(b *testing.B) {
+	f, err := Random(RandomOptions{States: 5000, Alphabet: 4, Seed: 1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Analyse()
+	}
+}
@@ -0,0 +1,422 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// InputClassPrefix is the machine metadata key prefix that makes an
+// input symbol an input class: a symbol standing for a set of
+// characters, so that one transition covers all of them. The value is a
+// bracket expression, or "*" for any input:
+//
+//	alphabet: ["digit", "sign", "other", "."]
+//	metadata: {"input_class.digit": "[0-9]", "input_class.sign": "[+\\-]",
+//	           "input_class.other": "*"}
+//
+// A bracket expression lists characters and ranges, such as [0-9a-fA-F_];
+// [^...] is its complement. Inside it, a backslash escapes the next
+// character, and \n, \t, and \r stand for newline, tab, and carriage
+// return. A class matches an input of one character in its set; "*"
+// matches any input.
+//
+// An input is read as the most specific symbol that covers it: a symbol
+// of the alphabet, such as "." above, if the input is that symbol, then
+// the smallest class matching it, then the "*" class. A state without a
+// transition on that symbol falls back to the next most specific symbol
+// it has a transition on: a literal "7" falls back to digit, digit to a
+// larger class containing it, and anything to "*". Classes other than
+// "*" must therefore be disjoint or nested. Runner, Compile, ToDFA, and
+// the code generators all follow these rules; ExpandInputClasses writes
+// the fallbacks out as transitions.
+const InputClassPrefix = "input_class."
+
+// AnyInputClass is the class pattern that matches any input.
+const AnyInputClass = "*"
+
+// RuneRange is an inclusive range of characters.
+type RuneRange struct {
+	Lo, Hi rune
+}
+
+// InputClass is a parsed input class.
+type InputClass struct {
+	Symbol  string      // the alphabet symbol naming the class
+	Pattern string      // as written in metadata
+	Any     bool        // the "*" class
+	Ranges  []RuneRange // sorted and disjoint; nil for the "*" class
+}
+
+// Matches reports whether the class covers input.
+func (c InputClass) Matches(input string) bool {
+	if c.Any {
+		return true
+	}
+	r, size := utf8.DecodeRuneInString(input)
+	if size == 0 || size != len(input) || (r == utf8.RuneError && size == 1) {
+		return false
+	}
+	return c.contains(r)
+}
+
+// contains reports whether r is in the class's ranges.
+func (c InputClass) contains(r rune) bool {
+	i := sort.Search(len(c.Ranges), func(i int) bool { return c.Ranges[i].Hi >= r })
+	return i < len(c.Ranges) && c.Ranges[i].Lo <= r
+}
+
+// size returns the number of characters in the class.
+func (c InputClass) size() int {
+	n := 0
+	for _, rg := range c.Ranges {
+		n += int(rg.Hi-rg.Lo) + 1
+	}
+	return n
+}
+
+// subsetOf reports whether every character of c is in d.
+func (c InputClass) subsetOf(d InputClass) bool {
+	if d.Any {
+		return true
+	}
+	if c.Any {
+		return false
+	}
+	for _, rg := range c.Ranges {
+		i := sort.Search(len(d.Ranges), func(i int) bool { return d.Ranges[i].Hi >= rg.Lo })
+		if i == len(d.Ranges) || d.Ranges[i].Lo > rg.Lo || d.Ranges[i].Hi < rg.Hi {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether c and d have a character in common.
+func (c InputClass) overlaps(d InputClass) bool {
+	for _, rg := range c.Ranges {
+		i := sort.Search(len(d.Ranges), func(i int) bool { return d.Ranges[i].Hi >= rg.Lo })
+		if i < len(d.Ranges) && d.Ranges[i].Lo <= rg.Hi {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseInputClass parses a class pattern: "*" or a bracket expression
+// (see InputClassPrefix).
+func ParseInputClass(pattern string) (InputClass, error) {
+	c := InputClass{Pattern: pattern}
+	if pattern == AnyInputClass {
+		c.Any = true
+		return c, nil
+	}
+	if len(pattern) < 2 || pattern[0] != '[' || pattern[len(pattern)-1] != ']' {
+		return c, fmt.Errorf("input class %q: want \"*\" or a bracket expression such as [0-9]", pattern)
+	}
+	body := []rune(pattern[1 : len(pattern)-1])
+	negate := len(body) > 0 && body[0] == '^'
+	if negate {
+		body = body[1:]
+	}
+
+	// next returns the character at body[i], unescaping it, and the
+	// position after it.
+	next := func(i int) (rune, int, error) {
+		if body[i] != '\\' {
+			if body[i] == ']' || body[i] == '[' {
+				return 0, 0, fmt.Errorf("input class %q: unescaped %q", pattern, body[i])
+			}
+			return body[i], i + 1, nil
+		}
+		if i+1 == len(body) {
+			return 0, 0, fmt.Errorf("input class %q: trailing backslash", pattern)
+		}
+		switch body[i+1] {
+		case 'n':
+			return '\n', i + 2, nil
+		case 't':
+			return '\t', i + 2, nil
+		case 'r':
+			return '\r', i + 2, nil
+		}
+		return body[i+1], i + 2, nil
+	}
+
+	var ranges []RuneRange
+	for i := 0; i < len(body); {
+		lo, j, err := next(i)
+		if err != nil {
+			return c, err
+		}
+		hi := lo
+		if j+1 < len(body) && body[j] == '-' {
+			if hi, j, err = next(j + 1); err != nil {
+				return c, err
+			}
+			if hi < lo {
+				return c, fmt.Errorf("input class %q: range %c-%c is backwards", pattern, lo, hi)
+			}
+		}
+		ranges = append(ranges, RuneRange{lo, hi})
+		i = j
+	}
+	if len(ranges) == 0 {
+		return c, fmt.Errorf("input class %q is empty", pattern)
+	}
+	c.Ranges = normaliseRanges(ranges)
+	if negate {
+		c.Ranges = complementRanges(c.Ranges)
+		if len(c.Ranges) == 0 {
+			return c, fmt.Errorf("input class %q is empty", pattern)
+		}
+	}
+	return c, nil
+}
+
+// normaliseRanges sorts ranges and merges those that overlap or touch.
+func normaliseRanges(ranges []RuneRange) []RuneRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Lo < ranges[j].Lo })
+	out := ranges[:1]
+	for _, rg := range ranges[1:] {
+		last := &out[len(out)-1]
+		if rg.Lo <= last.Hi+1 {
+			if rg.Hi > last.Hi {
+				last.Hi = rg.Hi
+			}
+			continue
+		}
+		out = append(out, rg)
+	}
+	return out
+}
+
+// complementRanges returns the characters not in the sorted, disjoint
+// ranges.
+func complementRanges(ranges []RuneRange) []RuneRange {
+	var out []RuneRange
+	lo := rune(0)
+	for _, rg := range ranges {
+		if rg.Lo > lo {
+			out = append(out, RuneRange{lo, rg.Lo - 1})
+		}
+		lo = rg.Hi + 1
+	}
+	if lo <= unicode.MaxRune {
+		out = append(out, RuneRange{lo, unicode.MaxRune})
+	}
+	return out
+}
+
+// HasInputClasses reports whether f's metadata defines input classes.
+func (f *FSM) HasInputClasses() bool {
+	for k := range f.Metadata {
+		if strings.HasPrefix(k, InputClassPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withFallbacks returns f with its input class fallbacks written out as
+// transitions, or f itself if it has no valid input classes.
+func withFallbacks(f *FSM) *FSM {
+	if !f.HasInputClasses() {
+		return f
+	}
+	g, err := f.ExpandInputClasses()
+	if err != nil {
+		return f
+	}
+	return g
+}
+
+// inputClassMetadata returns the metadata entries of f defining input
+// classes, or nil if there are none.
+func inputClassMetadata(f *FSM) map[string]string {
+	var m map[string]string
+	for k, v := range f.Metadata {
+		if strings.HasPrefix(k, InputClassPrefix) {
+			if m == nil {
+				m = make(map[string]string)
+			}
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// InputClasses returns f's input classes (see InputClassPrefix), most
+// specific first: by size, then in alphabet order, with the "*" class
+// last. It is an error for a class to be malformed, to name a symbol
+// that is not in the alphabet, for two classes other than "*" to
+// overlap without one containing the other, for two classes to be the
+// same set, or for there to be more than one "*" class.
+func (f *FSM) InputClasses() ([]InputClass, error) {
+	var classes []InputClass
+	for _, sym := range f.Alphabet {
+		pattern, ok := f.Metadata[InputClassPrefix+sym]
+		if !ok {
+			continue
+		}
+		c, err := ParseInputClass(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("input %q: %w", sym, err)
+		}
+		c.Symbol = sym
+		classes = append(classes, c)
+	}
+	for k := range f.Metadata {
+		if sym, ok := strings.CutPrefix(k, InputClassPrefix); ok && f.InputIndex(sym) < 0 {
+			return nil, fmt.Errorf("input class %q is not in the alphabet", sym)
+		}
+	}
+
+	other := ""
+	for i, c := range classes {
+		if c.Any {
+			if other != "" {
+				return nil, fmt.Errorf("inputs %q and %q are both \"*\" classes", other, c.Symbol)
+			}
+			other = c.Symbol
+			continue
+		}
+		for _, d := range classes[:i] {
+			if d.Any || !c.overlaps(d) {
+				continue
+			}
+			switch cs, ds := c.subsetOf(d), d.subsetOf(c); {
+			case cs && ds:
+				return nil, fmt.Errorf("input classes %q and %q are the same set", d.Symbol, c.Symbol)
+			case !cs && !ds:
+				return nil, fmt.Errorf("input classes %q and %q overlap; classes must be disjoint or nested", d.Symbol, c.Symbol)
+			}
+		}
+	}
+
+	sort.SliceStable(classes, func(i, j int) bool {
+		if classes[i].Any != classes[j].Any {
+			return classes[j].Any
+		}
+		return classes[i].size() < classes[j].size()
+	})
+	return classes, nil
+}
+
+// InputClassifier reads inputs as the alphabet symbols of a machine with
+// input classes. Build one with FSM.InputClassifier.
+type InputClassifier struct {
+	literals map[string]bool
+	classes  []InputClass // most specific first
+}
+
+// InputClassifier returns a classifier for f's inputs, or an error if
+// its input classes are invalid (see InputClasses).
+func (f *FSM) InputClassifier() (*InputClassifier, error) {
+	classes, err := f.InputClasses()
+	if err != nil {
+		return nil, err
+	}
+	c := &InputClassifier{literals: make(map[string]bool), classes: classes}
+	isClass := make(map[string]bool, len(classes))
+	for _, cl := range classes {
+		isClass[cl.Symbol] = true
+	}
+	for _, sym := range f.Alphabet {
+		if !isClass[sym] {
+			c.literals[sym] = true
+		}
+	}
+	return c, nil
+}
+
+// Classify returns the most specific symbol covering input: input itself
+// if it is a symbol of the alphabet that is not a class, otherwise the
+// first matching class. It reports false if nothing covers input.
+func (c *InputClassifier) Classify(input string) (string, bool) {
+	if c.literals[input] {
+		return input, true
+	}
+	for _, cl := range c.classes {
+		if cl.Matches(input) {
+			return cl.Symbol, true
+		}
+	}
+	return "", false
+}
+
+// Classes returns the classes, most specific first.
+func (c *InputClassifier) Classes() []InputClass {
+	return c.classes
+}
+
+// ExpandInputClasses returns a copy of f (see Clone) in which each
+// state's fallbacks (see InputClassPrefix) are written out: where a state
+// has no transition on a symbol, it gets copies of its transitions on
+// the most specific symbol that covers it, or failing that on the "*"
+// class. Classifying each input and then following transitions on the
+// resulting symbol alone gives the same behaviour in the copy as the
+// fallback rules in f. A machine without input classes is copied
+// unchanged.
+func (f *FSM) ExpandInputClasses() (*FSM, error) {
+	classes, err := f.InputClasses()
+	if err != nil {
+		return nil, err
+	}
+	g := f.Clone()
+	if len(classes) == 0 {
+		return g, nil
+	}
+	classOf := make(map[string]InputClass, len(classes))
+	for _, c := range classes {
+		classOf[c.Symbol] = c
+	}
+
+	// covers returns the classes, most specific first, covering sym
+	// other than sym itself.
+	covers := func(sym string) []InputClass {
+		var out []InputClass
+		self, isClass := classOf[sym]
+		for _, c := range classes {
+			switch {
+			case c.Symbol == sym:
+			case isClass && self.subsetOf(c):
+				out = append(out, c)
+			case !isClass && c.Matches(sym):
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	fallbacks := make(map[string][]InputClass, len(f.Alphabet))
+	for _, sym := range f.Alphabet {
+		fallbacks[sym] = covers(sym)
+	}
+
+	ix := NewTransitionIndex(f)
+	for _, state := range f.States {
+		for _, sym := range f.Alphabet {
+			if len(ix.Transitions(state, &sym)) > 0 {
+				continue
+			}
+			for _, c := range fallbacks[sym] {
+				ts := ix.Transitions(state, &c.Symbol)
+				if len(ts) == 0 {
+					continue
+				}
+				for _, t := range ts {
+					in := sym
+					t.Input = &in
+					t.To = cloneStrings(t.To)
+					t.Output = cloneStringPtr(t.Output)
+					t.Metadata = cloneStringMap(t.Metadata)
+					g.Transitions = append(g.Transitions, t)
+				}
+				break
+			}
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,214 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// numberFSM accepts signed decimals such as "-12.5", using input classes
+// for digits and signs, and ends up in "junk" on anything else.
+func numberFSM() *FSM {
+	f := New(TypeDFA)
+	for _, s := range []string{"start", "sign", "int", "dot", "frac", "junk"} {
+		f.AddState(s)
+	}
+	for _, in := range []string{"digit", "sign", "other", "."} {
+		f.AddInput(in)
+	}
+	f.Metadata = map[string]string{
+		InputClassPrefix + "digit": "[0-9]",
+		InputClassPrefix + "sign":  `[+\-]`,
+		InputClassPrefix + "other": "*",
+	}
+	f.SetInitial("start")
+	f.SetAccepting([]string{"int", "frac"})
+	f.AddTransition("start", strp("sign"), []string{"sign"}, nil)
+	f.AddTransition("start", strp("digit"), []string{"int"}, nil)
+	f.AddTransition("sign", strp("digit"), []string{"int"}, nil)
+	f.AddTransition("int", strp("digit"), []string{"int"}, nil)
+	f.AddTransition("int", strp("."), []string{"dot"}, nil)
+	f.AddTransition("dot", strp("digit"), []string{"frac"}, nil)
+	f.AddTransition("frac", strp("digit"), []string{"frac"}, nil)
+	for _, s := range []string{"start", "sign", "int", "dot", "frac", "junk"} {
+		f.AddTransition(s, strp("other"), []string{"junk"}, nil)
+	}
+	return f
+}
+
+func TestParseInputClass(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    []RuneRange
+	}{
+		{"[0-9]", []RuneRange{{'0', '9'}}},
+		{"[a-fA-F0-9_]", []RuneRange{{'0', '9'}, {'A', 'F'}, {'_', '_'}, {'a', 'f'}}},
+		{`[+\-]`, []RuneRange{{'+', '+'}, {'-', '-'}}},
+		{"[-a]", []RuneRange{{'-', '-'}, {'a', 'a'}}},
+		{`[ \t\n]`, []RuneRange{{'\t', '\n'}, {' ', ' '}}},
+		{"[a-cb-e]", []RuneRange{{'a', 'e'}}},
+		{`[\]]`, []RuneRange{{']', ']'}}},
+	} {
+		c, err := ParseInputClass(tc.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", tc.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.Ranges, tc.want) {
+			t.Errorf("%s: ranges %v, want %v", tc.pattern, c.Ranges, tc.want)
+		}
+	}
+
+	c, err := ParseInputClass("[^0-9]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Matches("5") || !c.Matches("x") || !c.Matches("é") || c.Matches("xy") {
+		t.Errorf("[^0-9] matches wrongly: %v", c.Ranges)
+	}
+	if c, _ := ParseInputClass("*"); !c.Any || !c.Matches("anything") {
+		t.Error(`"*" is not the any class`)
+	}
+
+	for _, bad := range []string{"", "0-9", "[]", "[^\x00-\U0010FFFF]", "[9-0]", `[a\]`, "[a]b]"} {
+		if _, err := ParseInputClass(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestInputClasses_Errors(t *testing.T) {
+	for name, meta := range map[string]map[string]string{
+		"unknown symbol": {InputClassPrefix + "hex": "[0-9a-f]"},
+		"overlap":        {InputClassPrefix + "a": "[0-5]", InputClassPrefix + "b": "[3-9]"},
+		"same set":       {InputClassPrefix + "a": "[0-9]", InputClassPrefix + "b": "[0-9]"},
+		"two anys":       {InputClassPrefix + "a": "*", InputClassPrefix + "b": "*"},
+		"malformed":      {InputClassPrefix + "a": "digits"},
+	} {
+		f := New(TypeDFA)
+		f.AddState("s")
+		f.SetInitial("s")
+		f.Alphabet = []string{"a", "b"}
+		f.Metadata = meta
+		if _, err := f.InputClasses(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+		if _, err := NewRunner(f); err == nil {
+			t.Errorf("%s: NewRunner accepted the machine", name)
+		}
+	}
+}
+
+func TestInputClassifier(t *testing.T) {
+	f := numberFSM()
+	f.AddInput("nonzero")
+	f.Metadata[InputClassPrefix+"nonzero"] = "[1-9]"
+	c, err := f.InputClassifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		"0": "digit", "7": "nonzero", "-": "sign", ".": ".", "x": "other", "..": "other",
+	} {
+		if got, ok := c.Classify(in); !ok || got != want {
+			t.Errorf("Classify(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+}
+
+func TestRunner_InputClasses(t *testing.T) {
+	f := numberFSM()
+	for input, accept := range map[string]bool{
+		"0":     true,
+		"-12.5": true,
+		"+7":    true,
+		"3.":    false,
+		"1.2.3": false,
+		"12a":   false,
+		"--1":   false,
+	} {
+		r, err := NewRunner(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.RunString(input); err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		if r.IsAccepting() != accept {
+			t.Errorf("%q: accepting %v, want %v", input, r.IsAccepting(), accept)
+		}
+		if h := r.History(); len(h) != len([]rune(input)) || h[0].Input != input[:1] {
+			t.Errorf("%q: history %v does not record the inputs", input, h)
+		}
+	}
+
+	// A literal and a nested class fall back to the classes covering
+	// them, and anything to "*".
+	f.AddInput("nonzero")
+	f.Metadata[InputClassPrefix+"nonzero"] = "[1-9]"
+	f.AddInput("e")
+	f.AddTransition("start", strp("nonzero"), []string{"frac"}, nil)
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ from, input, want string }{
+		{"start", "5", "frac"}, // nonzero, handled directly
+		{"start", "0", "int"},  // digit
+		{"sign", "5", "int"},   // nonzero falls back to digit
+		{"int", "e", "junk"},   // literal falls back to "*"
+		{"dot", "-", "junk"},   // class falls back to "*"
+	} {
+		r.currentStates = map[string]bool{tc.from: true}
+		if _, err := r.Step(tc.input); err != nil || r.CurrentState() != tc.want {
+			t.Errorf("%s on %q: %s, %v; want %s", tc.from, tc.input, r.CurrentState(), err, tc.want)
+		}
+	}
+}
+
+func TestInputClasses_CompileAndDeterminize(t *testing.T) {
+	f := numberFSM()
+	c, err := NewCompiledRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range "-12.5" {
+		if !c.StepSymbol(string(in)) {
+			t.Fatalf("compiled runner rejected %q", in)
+		}
+	}
+	if !c.IsAccepting() {
+		t.Error("compiled runner did not accept -12.5")
+	}
+
+	// Determinising an NFA keeps its classes and their fallbacks: the
+	// second 7 is read as a digit.
+	n := New(TypeNFA)
+	for _, s := range []string{"s", "a", "b"} {
+		n.AddState(s)
+	}
+	n.Alphabet = []string{"digit", "7"}
+	n.Metadata = map[string]string{InputClassPrefix + "digit": "[0-9]"}
+	n.SetInitial("s")
+	n.SetAccepting([]string{"b"})
+	n.AddTransition("s", strp("7"), []string{"a"}, nil)
+	n.AddTransition("a", strp("digit"), []string{"b"}, nil)
+	d := n.ToDFA()
+	if d.Metadata[InputClassPrefix+"digit"] != "[0-9]" {
+		t.Fatalf("ToDFA dropped the input classes: %v", d.Metadata)
+	}
+	r, err := NewRunner(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RunString("77"); err != nil || !r.IsAccepting() {
+		t.Errorf("DFA on 77: %s, %v; want accepting", r.CurrentState(), err)
+	}
+
+	m, err := f.Minimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, witness := Equivalent(f, m); !ok {
+		t.Errorf("minimised machine differs on %v", witness)
+	}
+}
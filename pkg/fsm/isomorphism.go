@@ -0,0 +1,266 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Isomorphism looks for a renaming of a's states that turns it into b.
+// Two machines are isomorphic when they have the same type, alphabets,
+// and stack start, and some one-to-one mapping of states carries the
+// initial state, accepting states, state outputs, linked machines, and
+// every transition (input, output, targets, probability, weight, and
+// stack operations) of a exactly onto b. Layout, names, descriptions,
+// classes, properties, and metadata are ignored.
+//
+// This is stricter than Equivalent, which compares behaviour: an
+// unminimised machine is equivalent to its minimal form but not
+// isomorphic to it. It is the check for a generated model that should be
+// the hand-written one with different state names.
+//
+// The mapping is returned with an empty reason, or nil with the reason
+// the machines differ.
+func Isomorphism(a, b *FSM) (map[string]string, string) {
+	switch {
+	case a.Type != b.Type:
+		return nil, fmt.Sprintf("types differ (%s, %s)", a.Type, b.Type)
+	case len(a.States) != len(b.States):
+		return nil, fmt.Sprintf("%d states against %d", len(a.States), len(b.States))
+	case len(a.Transitions) != len(b.Transitions):
+		return nil, fmt.Sprintf("%d transitions against %d", len(a.Transitions), len(b.Transitions))
+	case !sameSet(a.Alphabet, b.Alphabet):
+		return nil, "input alphabets differ"
+	case !sameSet(a.OutputAlphabet, b.OutputAlphabet):
+		return nil, "output alphabets differ"
+	case !sameSet(a.StackAlphabet, b.StackAlphabet) || a.StackStart != b.StackStart:
+		return nil, "stacks differ"
+	}
+
+	ga, gb := newIsoGraph(a), newIsoGraph(b)
+	if !ga.refine(gb) {
+		return nil, "no renaming of states matches the transitions"
+	}
+
+	// Assign a's states in order of how few candidates they have, so
+	// that forced choices come first.
+	order := append([]string(nil), a.States...)
+	size := make(map[int]int)
+	for _, s := range a.States {
+		size[ga.colour[s]]++
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return size[ga.colour[order[i]]] < size[ga.colour[order[j]]]
+	})
+
+	m := &isoMatch{a: ga, b: gb, order: order, fwd: make(map[string]string), used: make(map[string]bool)}
+	if !m.search(0) {
+		return nil, "no renaming of states matches the transitions"
+	}
+	return m.fwd, ""
+}
+
+// isoGraph is a machine's transitions keyed for matching, with a colour
+// per state from refinement: states of the same colour in either
+// machine cannot yet be told apart.
+type isoGraph struct {
+	f      *FSM
+	keys   map[string]int   // transition key -> count
+	touch  map[string][]int // state -> transitions it is an end of
+	colour map[string]int
+}
+
+func newIsoGraph(f *FSM) *isoGraph {
+	g := &isoGraph{f: f, keys: make(map[string]int), touch: make(map[string][]int)}
+	for i, t := range f.Transitions {
+		g.keys[isoKey(t, nil)]++
+		ends := map[string]bool{t.From: true}
+		for _, to := range t.To {
+			ends[to] = true
+		}
+		for s := range ends {
+			g.touch[s] = append(g.touch[s], i)
+		}
+	}
+	return g
+}
+
+// isoLabel renders what a transition does, apart from its ends.
+func isoLabel(t Transition) string {
+	var b strings.Builder
+	if t.Input != nil {
+		b.WriteString("i" + *t.Input)
+	}
+	if t.Output != nil {
+		b.WriteString("\x00o" + *t.Output)
+	}
+	if t.Probability != nil {
+		b.WriteString("\x00p" + strconv.FormatFloat(*t.Probability, 'g', -1, 64))
+	}
+	if t.Weight != nil {
+		b.WriteString("\x00w" + strconv.FormatFloat(*t.Weight, 'g', -1, 64))
+	}
+	if t.Pop != nil {
+		b.WriteString("\x00s" + *t.Pop)
+	}
+	if len(t.Push) > 0 {
+		b.WriteString("\x00u" + strings.Join(t.Push, "\x01"))
+	}
+	return b.String()
+}
+
+// isoKey renders a transition with its states renamed by rename (nil to
+// keep them), or "" if rename leaves one of them unmapped.
+func isoKey(t Transition, rename map[string]string) string {
+	name := func(s string) (string, bool) {
+		if rename == nil {
+			return s, true
+		}
+		r, ok := rename[s]
+		return r, ok
+	}
+	from, ok := name(t.From)
+	if !ok {
+		return ""
+	}
+	to := make([]string, len(t.To))
+	for i, s := range t.To {
+		if to[i], ok = name(s); !ok {
+			return ""
+		}
+	}
+	sort.Strings(to)
+	return from + "\x02" + strings.Join(to, "\x01") + "\x02" + isoLabel(t)
+}
+
+// refine colours the states of g and h together, splitting colours by
+// the colours of neighbours until no more split, and reports whether
+// each colour has as many states in g as in h.
+func (g *isoGraph) refine(h *isoGraph) bool {
+	table := make(map[string]int)
+	initial := func(f *FSM, s string) string {
+		sig := fmt.Sprintf("%t %t", s == f.Initial, f.IsAccepting(s))
+		if out, ok := f.StateOutputs[s]; ok {
+			sig += " o" + out
+		}
+		if m, ok := f.LinkedMachines[s]; ok {
+			sig += " l" + m
+		}
+		return sig
+	}
+	paint := func(x *isoGraph, sig func(s string) string) {
+		next := make(map[string]int, len(x.f.States))
+		for _, s := range x.f.States {
+			k := sig(s)
+			if _, ok := table[k]; !ok {
+				table[k] = len(table)
+			}
+			next[s] = table[k]
+		}
+		x.colour = next
+	}
+	balanced := func() bool {
+		count := make(map[int]int)
+		for _, c := range g.colour {
+			count[c]++
+		}
+		for _, c := range h.colour {
+			count[c]--
+		}
+		for _, n := range count {
+			if n != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, x := range []*isoGraph{g, h} {
+		paint(x, func(s string) string { return initial(x.f, s) })
+	}
+	colours := len(table)
+	for round := 0; round <= len(g.f.States); round++ {
+		if !balanced() {
+			return false
+		}
+		table = make(map[string]int)
+		for _, x := range []*isoGraph{g, h} {
+			old := x.colour
+			paint(x, func(s string) string {
+				var edges []string
+				for _, i := range x.touch[s] {
+					t := x.f.Transitions[i]
+					var to []string
+					for _, d := range t.To {
+						mark := ""
+						if d == s {
+							mark = "*"
+						}
+						to = append(to, strconv.Itoa(old[d])+mark)
+					}
+					sort.Strings(to)
+					from := strconv.Itoa(old[t.From])
+					if t.From == s {
+						from += "*"
+					}
+					edges = append(edges, from+">"+strings.Join(to, ",")+":"+isoLabel(t))
+				}
+				sort.Strings(edges)
+				return strconv.Itoa(old[s]) + "|" + strings.Join(edges, "|")
+			})
+		}
+		if len(table) == colours {
+			break
+		}
+		colours = len(table)
+	}
+	return balanced()
+}
+
+// isoMatch is a backtracking search for a state mapping.
+type isoMatch struct {
+	a, b  *isoGraph
+	order []string
+	fwd   map[string]string
+	used  map[string]bool
+}
+
+func (m *isoMatch) search(i int) bool {
+	if i == len(m.order) {
+		count := make(map[string]int, len(m.b.keys))
+		for _, t := range m.a.f.Transitions {
+			count[isoKey(t, m.fwd)]++
+		}
+		for k, n := range m.b.keys {
+			if count[k] != n {
+				return false
+			}
+		}
+		return true
+	}
+	s := m.order[i]
+	for _, t := range m.b.f.States {
+		if m.used[t] || m.b.colour[t] != m.a.colour[s] {
+			continue
+		}
+		m.fwd[s], m.used[t] = t, true
+		if m.consistent(s) && m.search(i+1) {
+			return true
+		}
+		delete(m.fwd, s)
+		delete(m.used, t)
+	}
+	return false
+}
+
+// consistent reports whether every transition at s whose ends are all
+// mapped has an image in b.
+func (m *isoMatch) consistent(s string) bool {
+	for _, i := range m.a.touch[s] {
+		if k := isoKey(m.a.f.Transitions[i], m.fwd); k != "" && m.b.keys[k] == 0 {
+			return false
+		}
+	}
+	return true
+}
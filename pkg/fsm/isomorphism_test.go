@@ -0,0 +1,70 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsomorphism(t *testing.T) {
+	a := turnstile("locked", "unlocked", "alarm")
+	b := turnstile("L", "U", "alarm")
+	b.Transitions[0], b.Transitions[2] = b.Transitions[2], b.Transitions[0]
+	m, reason := Isomorphism(a, b)
+	if want := map[string]string{"locked": "L", "unlocked": "U"}; !reflect.DeepEqual(m, want) || reason != "" {
+		t.Errorf("got %v %q", m, reason)
+	}
+
+	for name, c := range map[string]*FSM{
+		"output":   turnstile("L", "U", "beep"),
+		"type":     func() *FSM { f := turnstile("L", "U", "alarm"); f.Type = TypeMoore; return f }(),
+		"initial":  func() *FSM { f := turnstile("L", "U", "alarm"); f.Initial = "U"; return f }(),
+		"accepted": func() *FSM { f := turnstile("L", "U", "alarm"); f.Accepting = []string{"U"}; return f }(),
+	} {
+		if m, reason := Isomorphism(a, c); m != nil || reason == "" {
+			t.Errorf("%s: got %v %q", name, m, reason)
+		}
+	}
+}
+
+func TestIsomorphism_Symmetric(t *testing.T) {
+	// Rings whose states all look alike but for the initial one: the
+	// mapping has to be followed round the ring.
+	ring := func(names ...string) *FSM {
+		f := New(TypeNFA)
+		f.States = names
+		f.Initial = names[0]
+		f.Alphabet = []string{"x", "y"}
+		for i, s := range names {
+			f.AddTransition(s, strp("x"), []string{names[(i+1)%len(names)]}, nil)
+			f.AddTransition(s, strp("y"), []string{names[(i+2)%len(names)], names[(i+3)%len(names)]}, nil)
+		}
+		return f
+	}
+	a := ring("a", "b", "c", "d")
+	b := ring("w", "x", "y", "z")
+	m, reason := Isomorphism(a, b)
+	if want := map[string]string{"a": "w", "b": "x", "c": "y", "d": "z"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("got %v %q", m, reason)
+	}
+
+	// Two rings of two are not a ring of four, though every state looks
+	// the same locally.
+	c := New(TypeNFA)
+	c.States = []string{"p", "q", "r", "s"}
+	c.Initial = "p"
+	c.Alphabet = []string{"x"}
+	d := c.Clone()
+	for _, e := range [][2]string{{"p", "q"}, {"q", "r"}, {"r", "s"}, {"s", "p"}} {
+		c.AddTransition(e[0], strp("x"), []string{e[1]}, nil)
+	}
+	for _, e := range [][2]string{{"p", "q"}, {"q", "p"}, {"r", "s"}, {"s", "r"}} {
+		d.AddTransition(e[0], strp("x"), []string{e[1]}, nil)
+	}
+	d.Initial = "r"
+	if m, _ := Isomorphism(c, d); m != nil {
+		t.Errorf("two rings matched one: %v", m)
+	}
+	if m, _ := Isomorphism(c, c.Clone()); m == nil {
+		t.Error("ring does not match itself")
+	}
+}
@@ -0,0 +1,230 @@
+package fsm
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Lexer turns text from an io.Reader into input symbols and drives a
+// Runner with them, so that a machine drawn over characters or tokens
+// can validate config strings, protocol messages, and the like. It
+// reports where the text stopped matching the machine.
+//
+// With no tokens, each character is one input, named by the character
+// itself, which the runner then reads through any input classes the
+// machine declares: a machine with the class digit = [0-9] sees "7" as
+// digit. Map can name the inputs instead. With tokens, the text is split
+// into the longest match of any token's regular expression at each
+// point, and each match is the input named by its token.
+//
+// The zero Lexer reads one input per character. A Lexer must not be
+// changed while it is in use, but one may drive several runners at once.
+type Lexer struct {
+	// Bytes reads one input per byte rather than per UTF-8 character.
+	// Each byte is named by the character with its value, as in Latin-1,
+	// so byte 0xFF is "ÿ" and classes can cover any byte.
+	Bytes bool
+
+	// Map, if set, names the input for each character (or byte) in
+	// place of the character itself. It returns false for a character
+	// that stands for no input, which stops the lexer there, and "" for
+	// one to skip, such as whitespace. Map is not used with tokens.
+	Map func(r rune) (symbol string, ok bool)
+
+	// MaxTokenSize is the longest token, in bytes, the lexer reads;
+	// longer ones are an error. Zero means 64 KiB. With tokens, the
+	// lexer reads up to twice this far ahead of the token it is on.
+	MaxTokenSize int
+
+	tokens []lexToken
+}
+
+type lexToken struct {
+	symbol string
+	re     *regexp.Regexp
+}
+
+// defaultMaxTokenSize is the MaxTokenSize a zero Lexer uses, the same as
+// bufio.Scanner's.
+const defaultMaxTokenSize = 64 * 1024
+
+// Token adds a token: text matching pattern, a regular expression in Go's
+// syntax, is the input symbol. Where several tokens match, the longest
+// match wins, then the token added first, so a keyword token added
+// before an identifier token takes "if" but not "iffy". A symbol of ""
+// skips the text, as Skip does. Matches of no text are never tokens.
+func (l *Lexer) Token(symbol, pattern string) error {
+	re, err := regexp.Compile(`^(?:` + pattern + `)`)
+	if err != nil {
+		return fmt.Errorf("token %q: %w", symbol, err)
+	}
+	l.tokens = append(l.tokens, lexToken{symbol, re})
+	return nil
+}
+
+// Skip adds a token for text that is not an input, such as whitespace or
+// comments.
+func (l *Lexer) Skip(pattern string) error {
+	return l.Token("", pattern)
+}
+
+// LexResult is the outcome of lexing a whole input with a Lexer.
+type LexResult struct {
+	FeedResult // Rejected is also set when no token or Map covers the text
+
+	// Where lexing stopped: at the text that was rejected, or at the end
+	// of the input. Line and Column are 1-based; Column counts characters,
+	// or bytes with Bytes set.
+	Offset int64
+	Line   int
+	Column int
+
+	// Text is the token or character at which lexing stopped, or "" at
+	// the end of the input.
+	Text string
+}
+
+// Run resets r and feeds it the inputs read from rd, stopping at the
+// first one with no transition. The error is from reading rd, or a
+// token longer than MaxTokenSize, not from the machine.
+func (l *Lexer) Run(r *Runner, rd io.Reader) (LexResult, error) {
+	r.Reset()
+	return l.Feed(r, rd)
+}
+
+// Feed is Run from r's current state. Like Runner.Feed it records no
+// history.
+func (l *Lexer) Feed(r *Runner, rd io.Reader) (LexResult, error) {
+	res := LexResult{Line: 1, Column: 1}
+	src := &lexSource{rd: rd}
+	for {
+		text, symbol, ok, err := l.next(src)
+		if err != nil {
+			res.FeedResult = r.finishFeed(res.FeedResult)
+			return res, fmt.Errorf("line %d, column %d: %w", res.Line, res.Column, err)
+		}
+		if text == "" {
+			break
+		}
+		if !ok || (symbol != "" && !r.feedOne(symbol, &res.FeedResult)) {
+			res.Rejected = true
+			res.Text = text
+			break
+		}
+		res.advance(text, l.Bytes)
+		src.pos += len(text)
+	}
+	res.FeedResult = r.finishFeed(res.FeedResult)
+	return res, src.err
+}
+
+// next returns the text of the next input and its symbol, or "" at the
+// end of the input. ok is false if no token or Map covers the text, which
+// is then the next character.
+func (l *Lexer) next(src *lexSource) (text, symbol string, ok bool, err error) {
+	if len(l.tokens) == 0 {
+		src.fill(utf8.UTFMax)
+		rest := src.rest()
+		if len(rest) == 0 {
+			return "", "", false, nil
+		}
+		r, size := rune(rest[0]), 1
+		if !l.Bytes {
+			r, size = utf8.DecodeRune(rest)
+		}
+		text = string(rest[:size])
+		if l.Map != nil {
+			symbol, ok = l.Map(r)
+			return text, symbol, ok, nil
+		}
+		return text, string(r), true, nil
+	}
+
+	limit := l.MaxTokenSize
+	if limit <= 0 {
+		limit = defaultMaxTokenSize
+	}
+	// One byte past the limit, so that a match running to the end of
+	// the buffer is always too long rather than perhaps cut short.
+	src.fill(limit + 1)
+	rest := src.rest()
+	if len(rest) == 0 {
+		return "", "", false, nil
+	}
+	longest := 0
+	for _, t := range l.tokens {
+		if loc := t.re.FindIndex(rest); loc != nil && loc[1] > longest {
+			longest, symbol = loc[1], t.symbol
+		}
+	}
+	if longest == 0 {
+		_, size := utf8.DecodeRune(rest)
+		return string(rest[:size]), "", false, nil
+	}
+	if longest > limit {
+		return "", "", false, fmt.Errorf("token longer than %d bytes", limit)
+	}
+	return string(rest[:longest]), symbol, true, nil
+}
+
+// advance moves the position past text.
+func (res *LexResult) advance(text string, bytes bool) {
+	res.Offset += int64(len(text))
+	if bytes {
+		for i := 0; i < len(text); i++ {
+			res.advanceChar(rune(text[i]))
+		}
+		return
+	}
+	for _, c := range text {
+		res.advanceChar(c)
+	}
+}
+
+func (res *LexResult) advanceChar(c rune) {
+	if c == '\n' {
+		res.Line++
+		res.Column = 1
+	} else {
+		res.Column++
+	}
+}
+
+// lexSource buffers a reader so that the lexer can look ahead a whole
+// token.
+type lexSource struct {
+	rd  io.Reader
+	buf []byte
+	pos int
+	eof bool
+	err error // from rd, other than io.EOF
+}
+
+// fill makes sure at least n bytes are buffered past pos, unless the
+// input ends first. It reads ahead to twice that, so that the buffer is
+// moved down only once for every n bytes lexed.
+func (s *lexSource) fill(n int) {
+	if s.eof || len(s.buf)-s.pos >= n {
+		return
+	}
+	s.buf = append(s.buf[:0], s.buf[s.pos:]...)
+	s.pos = 0
+	for !s.eof && len(s.buf) < 2*n {
+		if len(s.buf) == cap(s.buf) {
+			s.buf = append(s.buf, make([]byte, 4096)...)[:len(s.buf)]
+		}
+		m, err := s.rd.Read(s.buf[len(s.buf):cap(s.buf)])
+		s.buf = s.buf[:len(s.buf)+m]
+		if err != nil {
+			s.eof = true
+			if err != io.EOF {
+				s.err = err
+			}
+		}
+	}
+}
+
+// rest returns the buffered bytes not yet lexed.
+func (s *lexSource) rest() []byte { return s.buf[s.pos:] }
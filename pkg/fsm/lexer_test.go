@@ -0,0 +1,223 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode"
+)
+
+// integerFSM accepts signed integers, reading digits and signs through
+// input classes, and has no transition on anything else.
+func integerFSM() *FSM {
+	f := New(TypeDFA)
+	for _, s := range []string{"start", "sign", "int"} {
+		f.AddState(s)
+	}
+	f.AddInput("digit")
+	f.AddInput("sign")
+	f.Metadata = map[string]string{
+		InputClassPrefix + "digit": "[0-9]",
+		InputClassPrefix + "sign":  `[+\-]`,
+	}
+	f.SetInitial("start")
+	f.SetAccepting([]string{"int"})
+	f.AddTransition("start", strp("sign"), []string{"sign"}, nil)
+	f.AddTransition("start", strp("digit"), []string{"int"}, nil)
+	f.AddTransition("sign", strp("digit"), []string{"int"}, nil)
+	f.AddTransition("int", strp("digit"), []string{"int"}, nil)
+	return f
+}
+
+// assignFSM accepts lines of name = value, with the tokens of
+// assignLexer.
+func assignFSM() *FSM {
+	f := New(TypeDFA)
+	for _, s := range []string{"line", "name", "eq", "value"} {
+		f.AddState(s)
+	}
+	f.Alphabet = []string{"ident", "number", "=", "newline"}
+	f.SetInitial("line")
+	f.SetAccepting([]string{"line", "value"})
+	f.AddTransition("line", strp("ident"), []string{"name"}, nil)
+	f.AddTransition("name", strp("="), []string{"eq"}, nil)
+	f.AddTransition("eq", strp("ident"), []string{"value"}, nil)
+	f.AddTransition("eq", strp("number"), []string{"value"}, nil)
+	f.AddTransition("value", strp("newline"), []string{"line"}, nil)
+	f.AddTransition("line", strp("newline"), []string{"line"}, nil)
+	return f
+}
+
+func assignLexer(t *testing.T) *Lexer {
+	t.Helper()
+	var l Lexer
+	for _, tok := range [][2]string{
+		{"ident", `[a-z_]+`},
+		{"number", `[0-9]+`},
+		{"=", `=`},
+		{"newline", `\n`},
+		{"", `[ \t]+|#[^\n]*`},
+	} {
+		if err := l.Token(tok[0], tok[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &l
+}
+
+func TestLexer_Characters(t *testing.T) {
+	r, err := NewRunner(integerFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l Lexer
+
+	res, err := l.Run(r, strings.NewReader("-1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Accepted || res.Consumed != 5 || res.Offset != 5 || res.Column != 6 || res.Text != "" {
+		t.Errorf("-1234: got %+v, want accepted at the end", res)
+	}
+
+	res, _ = l.Run(r, strings.NewReader("12é4"))
+	if res.Accepted || !res.Rejected || res.Offset != 2 || res.Column != 3 || res.Text != "é" {
+		t.Errorf("12é4: got %+v, want rejected at é", res)
+	}
+
+	res, _ = l.Run(r, strings.NewReader("+"))
+	if res.Accepted || res.Rejected || res.Offset != 1 {
+		t.Errorf("+: got %+v, want neither accepted nor rejected", res)
+	}
+}
+
+func TestLexer_Map(t *testing.T) {
+	r, err := NewRunner(integerFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Lexer{Map: func(c rune) (string, bool) {
+		switch {
+		case unicode.IsSpace(c):
+			return "", true
+		case c == 'x':
+			return "", false
+		}
+		return string(c), true
+	}}
+
+	res, _ := l.Run(r, strings.NewReader("1 2\n 3"))
+	if !res.Accepted || res.Consumed != 3 || res.Line != 2 || res.Column != 3 {
+		t.Errorf("spaced digits: got %+v, want accepted at line 2, column 3", res)
+	}
+	res, _ = l.Run(r, strings.NewReader("12\n 3x4"))
+	if !res.Rejected || res.Line != 2 || res.Column != 3 || res.Text != "x" {
+		t.Errorf("x: got %+v, want rejected at line 2, column 3", res)
+	}
+}
+
+func TestLexer_Bytes(t *testing.T) {
+	f := New(TypeDFA)
+	f.AddState("s")
+	f.AddInput("any")
+	f.Metadata = map[string]string{InputClassPrefix + "any": "*"}
+	f.SetInitial("s")
+	f.SetAccepting([]string{"s"})
+	f.AddTransition("s", strp("any"), []string{"s"}, nil)
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chars, _ := (&Lexer{}).Run(r, strings.NewReader("héllo"))
+	bytes, _ := (&Lexer{Bytes: true}).Run(r, strings.NewReader("héllo"))
+	if chars.Consumed != 5 || bytes.Consumed != 6 || bytes.Column != 7 {
+		t.Errorf("got %d characters and %d bytes (column %d), want 5 and 6", chars.Consumed, bytes.Consumed, bytes.Column)
+	}
+
+	seen := ""
+	l := Lexer{Bytes: true, Map: func(c rune) (string, bool) {
+		seen += string(c)
+		return "any", true
+	}}
+	l.Run(r, strings.NewReader("\xff"))
+	if seen != "ÿ" {
+		t.Errorf("byte 0xff read as %q, want ÿ", seen)
+	}
+}
+
+func TestLexer_Tokens(t *testing.T) {
+	r, err := NewRunner(assignFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := assignLexer(t)
+
+	text := "name = value # comment\n\ncount=42\n"
+	res, err := l.Run(r, iotest.OneByteReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Accepted || res.Consumed != 9 || res.Line != 4 {
+		t.Errorf("valid text: got %+v, want accepted after 9 tokens", res)
+	}
+
+	res, _ = l.Run(r, strings.NewReader("a = 1\nb == 2\n"))
+	if !res.Rejected || res.Line != 2 || res.Column != 4 || res.Text != "=" || res.Offset != 9 {
+		t.Errorf("==: got %+v, want rejected at line 2, column 4", res)
+	}
+
+	res, _ = l.Run(r, strings.NewReader("a = 1;\n"))
+	if !res.Rejected || res.Column != 6 || res.Text != ";" {
+		t.Errorf(";: got %+v, want no token at column 6", res)
+	}
+}
+
+func TestLexer_LongestMatch(t *testing.T) {
+	f := New(TypeDFA)
+	f.AddState("s")
+	f.AddState("kw")
+	f.AddState("id")
+	f.Alphabet = []string{"if", "ident"}
+	f.SetInitial("s")
+	f.AddTransition("s", strp("if"), []string{"kw"}, nil)
+	f.AddTransition("s", strp("ident"), []string{"id"}, nil)
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l Lexer
+	l.Token("if", `if`)
+	l.Token("ident", `[a-z]+`)
+
+	for text, want := range map[string]string{"if": "kw", "iffy": "id", "i": "id"} {
+		res, _ := l.Run(r, strings.NewReader(text))
+		if res.Rejected || len(res.States) != 1 || res.States[0] != want {
+			t.Errorf("%s: got %+v, want state %s", text, res, want)
+		}
+	}
+
+	if err := l.Token("bad", `(`); err == nil {
+		t.Error("an invalid pattern was accepted")
+	}
+}
+
+func TestLexer_TokenTooLong(t *testing.T) {
+	r, err := NewRunner(assignFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := assignLexer(t)
+	l.MaxTokenSize = 8
+
+	if _, err := l.Run(r, strings.NewReader("short = x\n")); err != nil {
+		t.Errorf("short tokens: %v", err)
+	}
+	res, err := l.Run(r, strings.NewReader("a = averyverylongvalue\n"))
+	if err == nil || !strings.Contains(err.Error(), "column 5") {
+		t.Errorf("long token: err = %v", err)
+	}
+	if res.Consumed != 2 {
+		t.Errorf("long token: consumed %d, want 2", res.Consumed)
+	}
+}
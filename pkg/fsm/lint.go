@@ -0,0 +1,150 @@
+package fsm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severity is the level at which a lint rule reports.
+type Severity string
+
+const (
+	SeverityOff     Severity = "off"
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// severityRank orders severities from most to least severe.
+var severityRank = map[Severity]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+
+// Lint rule names. The structural rules share their names with the
+// ValidationWarning types returned by Analyse.
+const (
+	RuleInvalid          = "invalid" // Validate() failed
+	RuleUnreachable      = "unreachable"
+	RuleDead             = "dead"
+	RuleNondeterministic = "nondeterministic"
+	RuleIncomplete       = "incomplete"
+	RuleTrap             = "trap"
+	RuleLivelock         = "livelock"
+	RuleUnusedInput      = "unused_input"
+	RuleUnusedOutput     = "unused_output"
+	RuleStateNaming      = "state_naming"
+	RuleInputNaming      = "input_naming"
+	RuleOutputNaming     = "output_naming"
+)
+
+// LintRules returns every rule name with its default severity.
+func LintRules() map[string]Severity {
+	return map[string]Severity{
+		RuleInvalid:          SeverityError,
+		RuleUnreachable:      SeverityWarning,
+		RuleDead:             SeverityWarning,
+		RuleNondeterministic: SeverityWarning,
+		RuleIncomplete:       SeverityWarning,
+		RuleTrap:             SeverityWarning,
+		RuleLivelock:         SeverityWarning,
+		RuleUnusedInput:      SeverityInfo,
+		RuleUnusedOutput:     SeverityInfo,
+		RuleStateNaming:      SeverityError,
+		RuleInputNaming:      SeverityError,
+		RuleOutputNaming:     SeverityError,
+	}
+}
+
+// LintConfig selects rule severities and naming conventions.
+// Rules not present in Rules use their default from LintRules. The naming
+// rules only apply when the corresponding pattern is set.
+type LintConfig struct {
+	Rules         map[string]Severity
+	StatePattern  string // regexp every state name must match
+	InputPattern  string // regexp every input symbol must match
+	OutputPattern string // regexp every output symbol must match
+}
+
+// Severity returns the effective severity of a rule under this config.
+func (c LintConfig) Severity(rule string) Severity {
+	if s, ok := c.Rules[rule]; ok {
+		return s
+	}
+	return LintRules()[rule]
+}
+
+// LintIssue is a single rule violation.
+type LintIssue struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	States   []string `json:"states,omitempty"`
+	Symbols  []string `json:"symbols,omitempty"`
+}
+
+// Lint checks the machine against the configured rules. It runs Validate
+// and Analyse, re-grades their findings by the configured severities, and
+// adds naming-convention checks. Rules set to "off" are dropped. Issues
+// are ordered by severity, errors first, then by rule name.
+//
+// An error is returned only if the config is unusable (bad pattern).
+func (f *FSM) Lint(cfg LintConfig) ([]LintIssue, error) {
+	var issues []LintIssue
+	add := func(rule, msg string, states, symbols []string) {
+		sev := cfg.Severity(rule)
+		if sev == SeverityOff {
+			return
+		}
+		issues = append(issues, LintIssue{Rule: rule, Severity: sev, Message: msg, States: states, Symbols: symbols})
+	}
+
+	if err := f.Validate(); err != nil {
+		add(RuleInvalid, err.Error(), nil, nil)
+	}
+	for _, w := range f.Analyse() {
+		add(w.Type, w.Message, w.States, w.Symbols)
+	}
+
+	v := f.Vocab()
+	naming := []struct {
+		rule, pattern, noun string
+		names               []string
+		isState             bool
+	}{
+		{RuleStateNaming, cfg.StatePattern, strings.ToLower(v.State), f.States, true},
+		{RuleInputNaming, cfg.InputPattern, strings.ToLower(v.Input), f.Alphabet, false},
+		{RuleOutputNaming, cfg.OutputPattern, strings.ToLower(v.Output), f.OutputAlphabet, false},
+	}
+	for _, n := range naming {
+		if n.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(n.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s pattern: %w", n.rule, err)
+		}
+		var bad []string
+		for _, name := range n.names {
+			if !re.MatchString(name) {
+				bad = append(bad, name)
+			}
+		}
+		if len(bad) == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("%d %s name(s) do not match %s", len(bad), n.noun, n.pattern)
+		if n.isState {
+			add(n.rule, msg, bad, nil)
+		} else {
+			add(n.rule, msg, nil, bad)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Severity != issues[j].Severity {
+			return severityRank[issues[i].Severity] < severityRank[issues[j].Severity]
+		}
+		return issues[i].Rule < issues[j].Rule
+	})
+	return issues, nil
+}
@@ -0,0 +1,59 @@
+package fsm
+
+import "testing"
+
+func TestLint_DefaultsAreWarnings(t *testing.T) {
+	issues, err := redundantDFA().Lint(LintConfig{})
+	if err != nil {
+		t.Fatalf("Lint: %v", err)
+	}
+	if len(issues) == 0 {
+		t.Fatal("expected unreachable/incomplete issues")
+	}
+	for _, is := range issues {
+		if is.Severity != SeverityWarning {
+			t.Errorf("%s: severity %s, want warning by default", is.Rule, is.Severity)
+		}
+	}
+}
+
+func TestLint_SeverityOverrides(t *testing.T) {
+	cfg := LintConfig{Rules: map[string]Severity{
+		RuleUnreachable: SeverityError,
+		RuleIncomplete:  SeverityOff,
+	}}
+	issues, err := redundantDFA().Lint(cfg)
+	if err != nil {
+		t.Fatalf("Lint: %v", err)
+	}
+	if len(issues) != 1 {
+		t.Fatalf("expected only the unreachable issue, got %+v", issues)
+	}
+	if issues[0].Rule != RuleUnreachable || issues[0].Severity != SeverityError {
+		t.Errorf("got %+v, want unreachable at error", issues[0])
+	}
+}
+
+func TestLint_Naming(t *testing.T) {
+	f := redundantDFA()
+	f.AddState("BadName")
+	cfg := LintConfig{
+		Rules:        map[string]Severity{RuleUnreachable: SeverityOff, RuleIncomplete: SeverityOff, RuleDead: SeverityOff},
+		StatePattern: "^[a-z][a-z0-9_]*$",
+	}
+	issues, err := f.Lint(cfg)
+	if err != nil {
+		t.Fatalf("Lint: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Rule != RuleStateNaming {
+		t.Fatalf("expected one state_naming issue, got %+v", issues)
+	}
+	if len(issues[0].States) != 1 || issues[0].States[0] != "BadName" {
+		t.Errorf("States = %v, want [BadName]", issues[0].States)
+	}
+
+	cfg.StatePattern = "("
+	if _, err := f.Lint(cfg); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,199 @@
+package fsm
+
+import "sort"
+
+// Liveness analyses: parts of a machine that a run can enter but never
+// leave for an accepting state. Both are only meaningful for machines
+// with accepting states.
+
+// livenessGraph is the transition graph of a machine as seen from its
+// initial state, with a shortest path to every reachable state.
+type livenessGraph struct {
+	f      *FSM
+	ix     *TransitionIndex
+	adj    map[string][]string
+	order  []string          // reachable states in breadth-first order
+	parent map[string]string // predecessor on a shortest path
+}
+
+func newLivenessGraph(f *FSM, ix *TransitionIndex) *livenessGraph {
+	g := &livenessGraph{f: f, ix: ix, adj: make(map[string][]string), parent: make(map[string]string)}
+	for _, s := range f.States {
+		seen := make(map[string]bool)
+		for _, t := range ix.From(s) {
+			for _, to := range t.To {
+				if !seen[to] {
+					seen[to] = true
+					g.adj[s] = append(g.adj[s], to)
+				}
+			}
+		}
+	}
+	reached := map[string]bool{f.Initial: true}
+	g.order = []string{f.Initial}
+	for i := 0; i < len(g.order); i++ {
+		for _, next := range g.adj[g.order[i]] {
+			if !reached[next] {
+				reached[next] = true
+				g.parent[next] = g.order[i]
+				g.order = append(g.order, next)
+			}
+		}
+	}
+	return g
+}
+
+// pathTo returns the shortest path from the initial state to s.
+func (g *livenessGraph) pathTo(s string) []string {
+	path := []string{s}
+	for s != g.f.Initial {
+		s = g.parent[s]
+		path = append([]string{s}, path...)
+	}
+	return path
+}
+
+// TrapStates returns the states reachable from the initial state from
+// which no accepting state can be reached, excluding dead states (those
+// with no outgoing transitions). A machine without accepting states has
+// none.
+func (f *FSM) TrapStates() []string {
+	states, _ := f.trapStates(newLivenessGraph(f, NewTransitionIndex(f)))
+	return states
+}
+
+// trapStates returns the trap states in breadth-first order from the
+// initial state, and a shortest path to the first.
+func (f *FSM) trapStates(g *livenessGraph) ([]string, []string) {
+	if f.Initial == "" || len(f.Accepting) == 0 {
+		return nil, nil
+	}
+	pred := make(map[string][]string)
+	for from, tos := range g.adj {
+		for _, to := range tos {
+			pred[to] = append(pred[to], from)
+		}
+	}
+	live := make(map[string]bool)
+	var queue []string
+	for _, s := range f.Accepting {
+		if !live[s] {
+			live[s] = true
+			queue = append(queue, s)
+		}
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, p := range pred[cur] {
+			if !live[p] {
+				live[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	var trapped []string
+	for _, s := range g.order {
+		if !live[s] && len(g.adj[s]) > 0 {
+			trapped = append(trapped, s)
+		}
+	}
+	if len(trapped) == 0 {
+		return nil, nil
+	}
+	return trapped, g.pathTo(trapped[0])
+}
+
+// Livelocks returns the cycles a run can enter and never leave that
+// contain no accepting state: strongly connected groups of reachable
+// states with no transition out of the group. A machine without
+// accepting states has none.
+func (f *FSM) Livelocks() [][]string {
+	var cycles [][]string
+	for _, l := range f.livelocks(newLivenessGraph(f, NewTransitionIndex(f))) {
+		cycles = append(cycles, l.states)
+	}
+	return cycles
+}
+
+type livelock struct {
+	states []string
+	path   []string // from the initial state, once round the cycle
+}
+
+func (f *FSM) livelocks(g *livenessGraph) []livelock {
+	if f.Initial == "" || len(f.Accepting) == 0 {
+		return nil
+	}
+	var found []livelock
+	for _, comp := range stronglyConnected(g.order, g.adj) {
+		in := make(map[string]bool, len(comp))
+		for _, s := range comp {
+			in[s] = true
+		}
+		closed, cyclic := true, len(comp) > 1
+		for _, s := range comp {
+			if g.ix.IsAccepting(s) {
+				closed = false
+			}
+			for _, to := range g.adj[s] {
+				if !in[to] {
+					closed = false
+				}
+				cyclic = cyclic || to == s
+			}
+		}
+		if !closed || !cyclic {
+			continue
+		}
+
+		// Members in breadth-first order; the path enters at the first.
+		var states []string
+		for _, s := range g.order {
+			if in[s] {
+				states = append(states, s)
+			}
+		}
+		entry := states[0]
+		found = append(found, livelock{states, append(g.pathTo(entry), g.cycle(entry, in)[1:]...)})
+	}
+	// Report in the order a breadth-first search meets the cycles.
+	pos := make(map[string]int, len(g.order))
+	for i, s := range g.order {
+		pos[s] = i
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return pos[found[i].states[0]] < pos[found[j].states[0]]
+	})
+	return found
+}
+
+// cycle returns a shortest path from s back to s through states in in.
+func (g *livenessGraph) cycle(s string, in map[string]bool) []string {
+	parent := make(map[string]string)
+	queue := []string{s}
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range g.adj[cur] {
+			if !in[next] {
+				continue
+			}
+			if next == s {
+				path := []string{s}
+				for ; cur != s; cur = parent[cur] {
+					path = append([]string{cur}, path...)
+				}
+				return append([]string{s}, path...)
+			}
+			if !seen[next] {
+				seen[next] = true
+				parent[next] = cur
+				queue = append(queue, next)
+			}
+		}
+	}
+	return []string{s}
+}
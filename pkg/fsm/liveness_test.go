@@ -0,0 +1,67 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyse_TrapsAndLivelocks(t *testing.T) {
+	// From busy, fail leads into error and retry, which bounce between
+	// each other for ever; stop leaves them for halt, a dead end.
+	f := New(TypeDFA)
+	f.States = []string{"idle", "busy", "error", "retry", "halt", "spin", "done"}
+	f.Initial = "idle"
+	f.Alphabet = []string{"go", "done", "fail", "stop", "loop"}
+	f.Accepting = []string{"done"}
+	f.AddTransition("idle", strp("go"), []string{"busy"}, nil)
+	f.AddTransition("busy", strp("done"), []string{"done"}, nil)
+	f.AddTransition("busy", strp("fail"), []string{"error"}, nil)
+	f.AddTransition("busy", strp("loop"), []string{"spin"}, nil)
+	f.AddTransition("error", strp("fail"), []string{"retry"}, nil)
+	f.AddTransition("retry", strp("fail"), []string{"error"}, nil)
+	f.AddTransition("error", strp("stop"), []string{"halt"}, nil)
+	f.AddTransition("spin", strp("loop"), []string{"spin"}, nil)
+
+	if got := f.TrapStates(); !reflect.DeepEqual(got, []string{"error", "spin", "retry"}) {
+		t.Errorf("TrapStates = %v", got)
+	}
+	// error and retry can leave for halt, so only spin is a livelock.
+	if got := f.Livelocks(); !reflect.DeepEqual(got, [][]string{{"spin"}}) {
+		t.Errorf("Livelocks = %v", got)
+	}
+
+	var trap, livelock *ValidationWarning
+	warnings := f.Analyse()
+	for i, w := range warnings {
+		switch w.Type {
+		case "trap":
+			trap = &warnings[i]
+		case "livelock":
+			livelock = &warnings[i]
+		}
+	}
+	if trap == nil || !reflect.DeepEqual(trap.Path, []string{"idle", "busy", "error"}) {
+		t.Errorf("trap warning %+v", trap)
+	}
+	if livelock == nil || !reflect.DeepEqual(livelock.Path, []string{"idle", "busy", "spin", "spin"}) {
+		t.Errorf("livelock warning %+v", livelock)
+	}
+
+	// Without stop, error and retry form a second livelock, met first.
+	f.Transitions = append(f.Transitions[:6], f.Transitions[7:]...)
+	got := f.Livelocks()
+	if !reflect.DeepEqual(got, [][]string{{"error", "retry"}, {"spin"}}) {
+		t.Errorf("Livelocks = %v", got)
+	}
+	for _, w := range f.Analyse() {
+		if w.Type == "livelock" && w.States[0] == "error" && !reflect.DeepEqual(w.Path, []string{"idle", "busy", "error", "retry", "error"}) {
+			t.Errorf("livelock path %v", w.Path)
+		}
+	}
+
+	// Machines without accepting states are not checked.
+	f.Accepting = nil
+	if f.TrapStates() != nil || f.Livelocks() != nil {
+		t.Error("trap regions reported without accepting states")
+	}
+}
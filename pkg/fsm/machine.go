@@ -0,0 +1,314 @@
+package fsm
+
+import "fmt"
+
+// Machine is a deterministic machine whose states and inputs are values
+// of the caller's own types, such as enums, instead of names. A program
+// embedding a machine steps it with those values directly, with one map
+// lookup per step and no conversion to or from strings; outputs are
+// strings as in FSM. MachineOf builds one from an FSM, as read from any
+// file format, and FSM converts one back.
+//
+// A Machine is built with NewMachine and AddTransition and must not be
+// changed once in use. Stepping it (Step, Run, Accepts) does not change
+// it, so one machine is safe to step from several goroutines, each
+// keeping its own current state.
+type Machine[S, I comparable] struct {
+	typ       Type
+	initial   S
+	states    []S
+	inputs    []I
+	stateSeen map[S]bool
+	inputSeen map[I]bool
+	next      map[machineKey[S, I]]machineEdge[S]
+	accepting map[S]bool
+	stateOut  map[S]string // Moore
+}
+
+type machineKey[S, I comparable] struct {
+	state S
+	input I
+}
+
+type machineEdge[S comparable] struct {
+	to     S
+	output *string // Mealy
+}
+
+// NewMachine returns a machine of type t (TypeDFA, TypeMoore, or
+// TypeMealy) with only the initial state.
+func NewMachine[S, I comparable](t Type, initial S) *Machine[S, I] {
+	m := &Machine[S, I]{
+		typ:       t,
+		initial:   initial,
+		stateSeen: make(map[S]bool),
+		inputSeen: make(map[I]bool),
+		next:      make(map[machineKey[S, I]]machineEdge[S]),
+		accepting: make(map[S]bool),
+		stateOut:  make(map[S]string),
+	}
+	m.AddState(initial)
+	return m
+}
+
+// AddState adds a state if it is not already present. States used by
+// AddTransition are added anyway; AddState is for states without any.
+func (m *Machine[S, I]) AddState(s S) {
+	if !m.stateSeen[s] {
+		m.stateSeen[s] = true
+		m.states = append(m.states, s)
+	}
+}
+
+// AddInput adds an input if it is not already present, as AddTransition
+// does with the inputs it uses.
+func (m *Machine[S, I]) AddInput(in I) {
+	if !m.inputSeen[in] {
+		m.inputSeen[in] = true
+		m.inputs = append(m.inputs, in)
+	}
+}
+
+// AddTransition adds a transition from one state to another on an input,
+// with an output for a Mealy machine (nil for none). It is an error for
+// the state to have a transition on the input already, since a Machine is
+// deterministic.
+func (m *Machine[S, I]) AddTransition(from S, in I, to S, output *string) error {
+	key := machineKey[S, I]{from, in}
+	if _, ok := m.next[key]; ok {
+		return fmt.Errorf("state %v already has a transition on %v", from, in)
+	}
+	m.AddState(from)
+	m.AddState(to)
+	m.AddInput(in)
+	m.next[key] = machineEdge[S]{to, output}
+	return nil
+}
+
+// SetAccepting marks a state as accepting, or not.
+func (m *Machine[S, I]) SetAccepting(s S, accepting bool) {
+	m.AddState(s)
+	if accepting {
+		m.accepting[s] = true
+	} else {
+		delete(m.accepting, s)
+	}
+}
+
+// SetStateOutput sets the output of a state, for a Moore machine.
+func (m *Machine[S, I]) SetStateOutput(s S, output string) {
+	m.AddState(s)
+	m.stateOut[s] = output
+}
+
+// Type returns the machine's type.
+func (m *Machine[S, I]) Type() Type { return m.typ }
+
+// Initial returns the initial state.
+func (m *Machine[S, I]) Initial() S { return m.initial }
+
+// States returns the states in the order they were added, the initial
+// state first.
+func (m *Machine[S, I]) States() []S { return append([]S(nil), m.states...) }
+
+// Inputs returns the inputs in the order they were added.
+func (m *Machine[S, I]) Inputs() []I { return append([]I(nil), m.inputs...) }
+
+// IsAccepting reports whether s is an accepting state.
+func (m *Machine[S, I]) IsAccepting(s S) bool { return m.accepting[s] }
+
+// StateOutput returns the Moore output of s, if it has one.
+func (m *Machine[S, I]) StateOutput(s S) (string, bool) {
+	out, ok := m.stateOut[s]
+	return out, ok
+}
+
+// Step returns the state s moves to on in, with the output of the step:
+// the transition's output in a Mealy machine, the new state's in a Moore
+// machine, and "" otherwise. ok is false if s has no transition on in.
+func (m *Machine[S, I]) Step(s S, in I) (next S, output string, ok bool) {
+	e, ok := m.next[machineKey[S, I]{s, in}]
+	if !ok {
+		return next, "", false
+	}
+	switch {
+	case e.output != nil:
+		output = *e.output
+	case m.typ == TypeMoore:
+		output = m.stateOut[e.to]
+	}
+	return e.to, output, true
+}
+
+// Run steps from the initial state through inputs and returns the state
+// reached. ok is false if some input has no transition, and the state is
+// then the one that had none.
+func (m *Machine[S, I]) Run(inputs []I) (state S, ok bool) {
+	state = m.initial
+	for _, in := range inputs {
+		e, found := m.next[machineKey[S, I]{state, in}]
+		if !found {
+			return state, false
+		}
+		state = e.to
+	}
+	return state, true
+}
+
+// Accepts reports whether inputs lead from the initial state to an
+// accepting state.
+func (m *Machine[S, I]) Accepts(inputs []I) bool {
+	s, ok := m.Run(inputs)
+	return ok && m.accepting[s]
+}
+
+// MachineOf builds a Machine from f, reading each state name with state
+// and each input symbol with input, which return false for a name that
+// is not one of their type's values. Like Compile, it validates f,
+// converts an NFA with ToDFA (so state reads the DFA's subset names), and
+// expands input classes into transitions on every symbol they cover.
+// Metadata, layout, and other annotations are not carried over.
+func MachineOf[S, I comparable](f *FSM, state func(string) (S, bool), input func(string) (I, bool)) (*Machine[S, I], error) {
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid FSM: %w", err)
+	}
+	if f.Type == TypePDA {
+		return nil, fmt.Errorf("a PDA cannot be a Machine")
+	}
+	if f.HasInputClasses() {
+		expanded, err := f.ExpandInputClasses()
+		if err != nil {
+			return nil, err
+		}
+		f = expanded
+	}
+	if f.Type == TypeNFA {
+		f = f.ToDFA()
+	}
+
+	states := make(map[string]S, len(f.States))
+	stateOf := make(map[S]string, len(f.States))
+	for _, name := range f.States {
+		s, ok := state(name)
+		if !ok {
+			return nil, fmt.Errorf("state %q has no value", name)
+		}
+		if other, dup := stateOf[s]; dup {
+			return nil, fmt.Errorf("states %q and %q have the same value", other, name)
+		}
+		states[name], stateOf[s] = s, name
+	}
+	inputs := make(map[string]I, len(f.Alphabet))
+	inputOf := make(map[I]string, len(f.Alphabet))
+	for _, name := range f.Alphabet {
+		in, ok := input(name)
+		if !ok {
+			return nil, fmt.Errorf("input %q has no value", name)
+		}
+		if other, dup := inputOf[in]; dup {
+			return nil, fmt.Errorf("inputs %q and %q have the same value", other, name)
+		}
+		inputs[name], inputOf[in] = in, name
+	}
+
+	m := NewMachine[S, I](f.Type, states[f.Initial])
+	for _, name := range f.States {
+		m.AddState(states[name])
+	}
+	for _, name := range f.Alphabet {
+		m.AddInput(inputs[name])
+	}
+	for _, t := range f.Transitions {
+		if t.Input == nil || len(t.To) == 0 {
+			continue
+		}
+		if len(t.To) > 1 {
+			return nil, fmt.Errorf("state %q has more than one target on %q; use ToDFA first", t.From, *t.Input)
+		}
+		var output *string
+		if f.Type == TypeMealy && t.Output != nil {
+			out := *t.Output
+			output = &out
+		}
+		if err := m.AddTransition(states[t.From], inputs[*t.Input], states[t.To[0]], output); err != nil {
+			return nil, fmt.Errorf("state %q has more than one transition on %q; use ToDFA first", t.From, *t.Input)
+		}
+	}
+	for _, name := range f.Accepting {
+		m.SetAccepting(states[name], true)
+	}
+	if f.Type == TypeMoore {
+		for name, out := range f.StateOutputs {
+			if s, ok := states[name]; ok {
+				m.SetStateOutput(s, out)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Machine returns f as a Machine over its state names and input symbols,
+// as MachineOf does.
+func (f *FSM) Machine() (*Machine[string, string], error) {
+	name := func(s string) (string, bool) { return s, true }
+	return MachineOf(f, name, name)
+}
+
+// FSM converts m to an FSM, naming each state with state and each input
+// with input, for writing in any file format or for the analyses that
+// work on FSMs. Names must be distinct: two states or inputs with the
+// same name are an error. Outputs used by m make up the output alphabet.
+func (m *Machine[S, I]) FSM(state func(S) string, input func(I) string) (*FSM, error) {
+	f := New(m.typ)
+	stateName := make(map[S]string, len(m.states))
+	for _, s := range m.states {
+		name := state(s)
+		if f.HasState(name) {
+			return nil, fmt.Errorf("two states are named %q", name)
+		}
+		f.AddState(name)
+		stateName[s] = name
+	}
+	inputName := make(map[I]string, len(m.inputs))
+	for _, in := range m.inputs {
+		name := input(in)
+		for _, a := range f.Alphabet {
+			if a == name {
+				return nil, fmt.Errorf("two inputs are named %q", name)
+			}
+		}
+		f.AddInput(name)
+		inputName[in] = name
+	}
+	f.SetInitial(stateName[m.initial])
+
+	for _, s := range m.states {
+		if m.accepting[s] {
+			f.Accepting = append(f.Accepting, stateName[s])
+		}
+	}
+
+	// Transitions in state order, then input order, so the result does
+	// not depend on map iteration.
+	for _, s := range m.states {
+		for _, in := range m.inputs {
+			e, ok := m.next[machineKey[S, I]{s, in}]
+			if !ok {
+				continue
+			}
+			sym := inputName[in]
+			var output *string
+			if e.output != nil {
+				out := *e.output
+				output = &out
+				f.AddOutput(out)
+			}
+			f.AddTransition(stateName[s], &sym, []string{stateName[e.to]}, output)
+		}
+		if out, ok := m.stateOut[s]; ok {
+			f.SetStateOutput(stateName[s], out)
+			f.AddOutput(out)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,238 @@
+package fsm
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type doorState int
+
+const (
+	doorClosed doorState = iota
+	doorOpen
+	doorLocked
+)
+
+var doorStateNames = []string{"closed", "open", "locked"}
+
+type doorInput int
+
+const (
+	doorPush doorInput = iota
+	doorPull
+	doorLock
+	doorUnlock
+)
+
+var doorInputNames = []string{"push", "pull", "lock", "unlock"}
+
+func parseDoorState(name string) (doorState, bool) {
+	for i, n := range doorStateNames {
+		if n == name {
+			return doorState(i), true
+		}
+	}
+	return 0, false
+}
+
+func parseDoorInput(name string) (doorInput, bool) {
+	for i, n := range doorInputNames {
+		if n == name {
+			return doorInput(i), true
+		}
+	}
+	return 0, false
+}
+
+func doorMachine(t *testing.T) *Machine[doorState, doorInput] {
+	t.Helper()
+	m := NewMachine[doorState, doorInput](TypeMealy, doorClosed)
+	locked := "click"
+	for _, tr := range []struct {
+		from doorState
+		in   doorInput
+		to   doorState
+		out  *string
+	}{
+		{doorClosed, doorPull, doorOpen, nil},
+		{doorOpen, doorPush, doorClosed, nil},
+		{doorClosed, doorLock, doorLocked, &locked},
+		{doorLocked, doorUnlock, doorClosed, &locked},
+	} {
+		if err := m.AddTransition(tr.from, tr.in, tr.to, tr.out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.SetAccepting(doorClosed, true)
+	return m
+}
+
+func TestMachine_Step(t *testing.T) {
+	m := doorMachine(t)
+	if next, out, ok := m.Step(doorClosed, doorLock); !ok || next != doorLocked || out != "click" {
+		t.Errorf("Step(closed, lock) = %v, %q, %v", next, out, ok)
+	}
+	if next, out, ok := m.Step(doorClosed, doorPull); !ok || next != doorOpen || out != "" {
+		t.Errorf("Step(closed, pull) = %v, %q, %v", next, out, ok)
+	}
+	if _, _, ok := m.Step(doorLocked, doorPull); ok {
+		t.Error("Step(locked, pull) found a transition")
+	}
+
+	if s, ok := m.Run([]doorInput{doorPull, doorPush, doorLock}); !ok || s != doorLocked {
+		t.Errorf("Run = %v, %v, want locked", s, ok)
+	}
+	if s, ok := m.Run([]doorInput{doorLock, doorPull}); ok || s != doorLocked {
+		t.Errorf("Run stuck = %v, %v, want locked, false", s, ok)
+	}
+	if !m.Accepts([]doorInput{doorLock, doorUnlock}) || m.Accepts([]doorInput{doorPull}) {
+		t.Error("Accepts disagrees with the accepting states")
+	}
+
+	if err := m.AddTransition(doorClosed, doorPull, doorLocked, nil); err == nil {
+		t.Error("a second transition on the same input was accepted")
+	}
+	if got := len(m.States()); got != 3 {
+		t.Errorf("%d states, want 3", got)
+	}
+}
+
+func TestMachine_RoundTrip(t *testing.T) {
+	m := doorMachine(t)
+	f, err := m.FSM(
+		func(s doorState) string { return doorStateNames[s] },
+		func(in doorInput) string { return doorInputNames[in] },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Initial != "closed" || len(f.Transitions) != 4 || len(f.OutputAlphabet) != 1 {
+		t.Errorf("FSM: initial %q, %d transitions, outputs %v", f.Initial, len(f.Transitions), f.OutputAlphabet)
+	}
+
+	back, err := MachineOf(f, parseDoorState, parseDoorInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range m.States() {
+		for _, in := range m.Inputs() {
+			n1, o1, ok1 := m.Step(s, in)
+			n2, o2, ok2 := back.Step(s, in)
+			if n1 != n2 || o1 != o2 || ok1 != ok2 {
+				t.Errorf("Step(%v, %v): %v %q %v, then %v %q %v", s, in, n1, o1, ok1, n2, o2, ok2)
+			}
+		}
+		if m.IsAccepting(s) != back.IsAccepting(s) {
+			t.Errorf("state %v: accepting differs after the round trip", s)
+		}
+	}
+}
+
+func TestMachineOf_Errors(t *testing.T) {
+	f := New(TypeDFA)
+	f.AddState("closed")
+	f.AddState("ajar")
+	f.AddInput("push")
+	f.SetInitial("closed")
+	in := "push"
+	f.AddTransition("closed", &in, []string{"ajar"}, nil)
+	if _, err := MachineOf(f, parseDoorState, parseDoorInput); err == nil || !strings.Contains(err.Error(), `"ajar"`) {
+		t.Errorf("unknown state: err = %v", err)
+	}
+
+	same := func(string) (doorState, bool) { return doorClosed, true }
+	if _, err := MachineOf(f, same, parseDoorInput); err == nil || !strings.Contains(err.Error(), "same value") {
+		t.Errorf("shared value: err = %v", err)
+	}
+
+	m := NewMachine[doorState, doorInput](TypeDFA, doorClosed)
+	m.AddState(doorOpen)
+	if _, err := m.FSM(func(doorState) string { return "s" }, func(doorInput) string { return "i" }); err == nil {
+		t.Error("two states with one name were accepted")
+	}
+}
+
+// TestFSMMachine_MatchesRunner steps a string Machine and a Runner over
+// the same random inputs, as TestCompiledRunner_MatchesRunner does.
+func TestFSMMachine_MatchesRunner(t *testing.T) {
+	for _, typ := range []Type{TypeDFA, TypeMoore, TypeMealy} {
+		f, err := Random(RandomOptions{States: 30, Alphabet: 3, Density: 0.7, Type: typ, Seed: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := f.Machine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewRunner(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rng := rand.New(rand.NewSource(1))
+		state := m.Initial()
+		for step := 0; step < 1000; step++ {
+			in := f.Alphabet[rng.Intn(len(f.Alphabet))]
+			want, err := r.Step(in)
+			next, out, ok := m.Step(state, in)
+			if ok != (err == nil) {
+				t.Fatalf("%s step %d: machine ok=%v, runner err=%v", typ, step, ok, err)
+			}
+			if !ok {
+				r.Reset()
+				state = m.Initial()
+				continue
+			}
+			state = next
+			if state != r.CurrentState() || out != want {
+				t.Fatalf("%s step %d: %s %q, want %s %q", typ, step, state, out, r.CurrentState(), want)
+			}
+			if m.IsAccepting(state) != r.IsAccepting() {
+				t.Fatalf("%s step %d: accepting disagrees", typ, step)
+			}
+		}
+	}
+}
+
+func TestFSMMachine_NFA(t *testing.T) {
+	f, err := Random(RandomOptions{States: 10, Alphabet: 2, Type: TypeNFA, Seed: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := f.Machine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(3))
+	for word := 0; word < 200; word++ {
+		w := make([]string, rng.Intn(8))
+		for i := range w {
+			w[i] = f.Alphabet[rng.Intn(len(f.Alphabet))]
+		}
+		r, _ := NewRunner(f)
+		_, err := r.Run(w)
+		want := err == nil && r.IsAccepting()
+		if got := m.Accepts(w); got != want {
+			t.Fatalf("%v: machine accepts=%v, runner accepts=%v", w, got, want)
+		}
+	}
+}
+
+func BenchmarkMachineStep(b *testing.B) {
+	m := NewMachine[int, int](TypeDFA, 0)
+	for s := 0; s < 5000; s++ {
+		for in := 0; in < 4; in++ {
+			m.AddTransition(s, in, (s*7+in)%5000, nil)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	s := 0
+	for i := 0; i < b.N; i++ {
+		s, _, _ = m.Step(s, i&3)
+	}
+}
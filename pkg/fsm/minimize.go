@@ -0,0 +1,180 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Minimize returns an equivalent machine with the fewest states.
+//
+// NFAs are first converted with ToDFA. Unreachable states are discarded and
+// the remaining states are merged by partition refinement: two states stay
+// in the same block while they agree on acceptance, Moore output, and, for
+// every input, the block of their successor and the Mealy output on that
+// transition. Missing transitions are treated as moving to an implicit
+// rejecting sink, so partial DFAs are minimised without being completed.
+//
+// Each merged state keeps the name of its first member in declaration order.
+// Class, property, and net data are not carried over, since merged states
+// may disagree on them. Input classes are, with their fallbacks written
+// out as transitions (see ExpandInputClasses).
+func (f *FSM) Minimize() (*FSM, error) {
+	return f.MinimizeContext(context.Background())
+}
+
+// MinimizeContext is Minimize, stopping with ctx's error if ctx is done
+// before minimisation is, as it may be while converting a large NFA.
+func (f *FSM) MinimizeContext(ctx context.Context) (*FSM, error) {
+	if f.Type == TypePDA {
+		return nil, fmt.Errorf("cannot minimise a PDA")
+	}
+	src := f
+	if f.Type == TypeNFA {
+		dfa, err := f.ToDFAContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		src = dfa
+	}
+	if src.HasInputClasses() {
+		// Compare states by what they do with every symbol, fallbacks
+		// included.
+		expanded, err := src.ExpandInputClasses()
+		if err != nil {
+			return nil, fmt.Errorf("cannot minimise: %w", err)
+		}
+		src = expanded
+	}
+	if nondet := src.NonDeterministicStates(); len(nondet) > 0 {
+		return nil, fmt.Errorf("cannot minimise: %d states are non-deterministic", len(nondet))
+	}
+	if src.Initial == "" {
+		return nil, fmt.Errorf("cannot minimise: no initial state")
+	}
+
+	// Restrict to reachable states, in declaration order.
+	unreachable := make(map[string]bool)
+	for _, s := range src.UnreachableStates() {
+		unreachable[s] = true
+	}
+	var states []string
+	for _, s := range src.States {
+		if !unreachable[s] {
+			states = append(states, s)
+		}
+	}
+
+	type edge struct {
+		to     string
+		output *string
+	}
+	delta := make(map[string]map[string]edge, len(states))
+	for _, t := range src.Transitions {
+		if t.Input == nil || len(t.To) == 0 || unreachable[t.From] {
+			continue
+		}
+		if delta[t.From] == nil {
+			delta[t.From] = make(map[string]edge)
+		}
+		delta[t.From][*t.Input] = edge{to: t.To[0], output: t.Output}
+	}
+
+	// Initial partition: acceptance and Moore output.
+	block := make(map[string]int, len(states))
+	keys := make(map[string]int)
+	for _, s := range states {
+		key := fmt.Sprintf("%t\x00%s", src.IsAccepting(s), src.StateOutputs[s])
+		id, ok := keys[key]
+		if !ok {
+			id = len(keys)
+			keys[key] = id
+		}
+		block[s] = id
+	}
+	numBlocks := len(keys)
+
+	// Refine until stable.
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		next := make(map[string]int, len(states))
+		sigs := make(map[string]int)
+		for _, s := range states {
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "%d", block[s])
+			for _, in := range src.Alphabet {
+				e, ok := delta[s][in]
+				if !ok {
+					sb.WriteString("|-")
+					continue
+				}
+				fmt.Fprintf(&sb, "|%d", block[e.to])
+				if e.output != nil {
+					sb.WriteString("\x00" + *e.output)
+				}
+			}
+			sig := sb.String()
+			id, ok := sigs[sig]
+			if !ok {
+				id = len(sigs)
+				sigs[sig] = id
+			}
+			next[s] = id
+		}
+		block = next
+		if len(sigs) == numBlocks {
+			break
+		}
+		numBlocks = len(sigs)
+	}
+
+	// Name each block after its first member.
+	rep := make(map[int]string, numBlocks)
+	for _, s := range states {
+		if _, ok := rep[block[s]]; !ok {
+			rep[block[s]] = s
+		}
+	}
+
+	m := New(src.Type)
+	m.Name = src.Name
+	m.Description = src.Description
+	m.Vocabulary = src.Vocabulary
+	m.Alphabet = append(m.Alphabet, src.Alphabet...)
+	m.OutputAlphabet = append(m.OutputAlphabet, src.OutputAlphabet...)
+	m.Metadata = inputClassMetadata(src)
+
+	for _, s := range states {
+		if rep[block[s]] != s {
+			continue
+		}
+		m.AddState(s)
+		if src.IsAccepting(s) {
+			m.Accepting = append(m.Accepting, s)
+		}
+		if out, ok := src.StateOutputs[s]; ok {
+			m.SetStateOutput(s, out)
+		}
+		if src.IsLinked(s) {
+			m.LinkedMachines[s] = src.LinkedMachines[s]
+		}
+		for _, in := range src.Alphabet {
+			e, ok := delta[s][in]
+			if !ok {
+				continue
+			}
+			inp := in
+			var out *string
+			if e.output != nil {
+				o := *e.output
+				out = &o
+			}
+			m.AddTransition(s, &inp, []string{rep[block[e.to]]}, out)
+		}
+	}
+	m.Initial = rep[block[src.Initial]]
+
+	return m, nil
+}
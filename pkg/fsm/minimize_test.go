@@ -0,0 +1,124 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func strp(s string) *string { return &s }
+
+// redundantDFA accepts strings over {a,b} ending in "a". States q1 and q2
+// are equivalent, and q3 is unreachable.
+func redundantDFA() *FSM {
+	f := New(TypeDFA)
+	for _, s := range []string{"q0", "q1", "q2", "q3"} {
+		f.AddState(s)
+	}
+	f.Alphabet = []string{"a", "b"}
+	f.SetInitial("q0")
+	f.SetAccepting([]string{"q1", "q2"})
+	f.AddTransition("q0", strp("a"), []string{"q1"}, nil)
+	f.AddTransition("q0", strp("b"), []string{"q0"}, nil)
+	f.AddTransition("q1", strp("a"), []string{"q2"}, nil)
+	f.AddTransition("q1", strp("b"), []string{"q0"}, nil)
+	f.AddTransition("q2", strp("a"), []string{"q1"}, nil)
+	f.AddTransition("q2", strp("b"), []string{"q0"}, nil)
+	f.AddTransition("q3", strp("a"), []string{"q0"}, nil)
+	return f
+}
+
+func TestMinimize_MergesEquivalentStates(t *testing.T) {
+	f := redundantDFA()
+	m, err := f.Minimize()
+	if err != nil {
+		t.Fatalf("Minimize: %v", err)
+	}
+	if len(m.States) != 2 {
+		t.Fatalf("expected 2 states, got %d: %v", len(m.States), m.States)
+	}
+	if m.HasState("q3") {
+		t.Error("unreachable state q3 should be removed")
+	}
+	if m.Initial != "q0" {
+		t.Errorf("Initial = %q, want q0", m.Initial)
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("minimised machine is invalid: %v", err)
+	}
+	if eq, cex := Equivalent(f, m); !eq {
+		t.Errorf("minimised machine not equivalent, counterexample %v", cex)
+	}
+}
+
+func TestMinimize_MealyKeepsOutputs(t *testing.T) {
+	f := New(TypeMealy)
+	f.AddState("a")
+	f.AddState("b")
+	f.Alphabet = []string{"x"}
+	f.OutputAlphabet = []string{"0", "1"}
+	f.SetInitial("a")
+	f.AddTransition("a", strp("x"), []string{"b"}, strp("0"))
+	f.AddTransition("b", strp("x"), []string{"a"}, strp("1"))
+
+	m, err := f.Minimize()
+	if err != nil {
+		t.Fatalf("Minimize: %v", err)
+	}
+	if len(m.States) != 2 {
+		t.Errorf("states with different outputs must not merge, got %v", m.States)
+	}
+}
+
+func TestMinimize_NFA(t *testing.T) {
+	f := New(TypeNFA)
+	f.AddState("s")
+	f.AddState("t")
+	f.Alphabet = []string{"a"}
+	f.SetInitial("s")
+	f.SetAccepting([]string{"t"})
+	f.AddTransition("s", strp("a"), []string{"s", "t"}, nil)
+
+	m, err := f.Minimize()
+	if err != nil {
+		t.Fatalf("Minimize: %v", err)
+	}
+	if m.Type != TypeDFA {
+		t.Errorf("Type = %s, want dfa", m.Type)
+	}
+	if eq, cex := Equivalent(f, m); !eq {
+		t.Errorf("not equivalent, counterexample %v", cex)
+	}
+}
+
+func TestMinimizeContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := redundantDFA().MinimizeContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("DFA: err = %v, want context.Canceled", err)
+	}
+	nfa := coinFSM()
+	if _, err := nfa.ToDFAContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ToDFAContext: err = %v, want context.Canceled", err)
+	}
+	if _, err := nfa.MinimizeContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("NFA: err = %v, want context.Canceled", err)
+	}
+	if _, err := redundantDFA().MinimizeContext(context.Background()); err != nil {
+		t.Errorf("uncancelled: %v", err)
+	}
+}
+
+func TestEquivalent_Counterexample(t *testing.T) {
+	a := redundantDFA()
+	b := redundantDFA()
+	b.SetAccepting([]string{"q1"}) // "aa" now rejected
+
+	eq, cex := Equivalent(a, b)
+	if eq {
+		t.Fatal("machines should differ")
+	}
+	if len(cex) != 2 || cex[0] != "a" || cex[1] != "a" {
+		t.Errorf("counterexample = %v, want [a a]", cex)
+	}
+}
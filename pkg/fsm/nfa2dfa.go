@@ -1,6 +1,7 @@
 package fsm
 
 import (
+	"context"
 	"sort"
 	"strings"
 )
@@ -8,10 +9,29 @@ import (
 // ToDFA converts an NFA to an equivalent DFA using the powerset construction.
 // The resulting DFA accepts the same language as the original NFA.
 // State names in the DFA are comma-separated combinations of NFA states.
+// Input classes (see InputClassPrefix) are expanded first, so the DFA
+// follows their fallback rules, and the DFA keeps their definitions.
 func (f *FSM) ToDFA() *FSM {
+	dfa, _ := f.ToDFAContext(context.Background())
+	return dfa
+}
+
+// ToDFAContext is ToDFA, stopping with ctx's error if ctx is done before
+// the construction is. The powerset construction can produce
+// exponentially many states, so callers converting machines they do not
+// control should set a deadline.
+func (f *FSM) ToDFAContext(ctx context.Context) (*FSM, error) {
 	if f.Type != TypeNFA {
 		// Already deterministic, return a copy
-		return f.Copy()
+		return f.Copy(), nil
+	}
+	var classes map[string]string
+	if f.HasInputClasses() {
+		// Invalid classes are left for the runners to report.
+		if expanded, err := f.ExpandInputClasses(); err == nil {
+			classes = inputClassMetadata(f)
+			f = expanded
+		}
 	}
 
 	dfa := &FSM{
@@ -23,8 +43,10 @@ func (f *FSM) ToDFA() *FSM {
 		Transitions:  make([]Transition, 0),
 		Accepting:    make([]string, 0),
 		StateOutputs: make(map[string]string),
+		Metadata:     classes,
 	}
 	copy(dfa.Alphabet, f.Alphabet)
+	ix := NewTransitionIndex(f)
 
 	// Helper to compute epsilon closure
 	epsilonClosure := func(states map[string]bool) map[string]bool {
@@ -37,7 +59,7 @@ func (f *FSM) ToDFA() *FSM {
 		for changed {
 			changed = false
 			for state := range closure {
-				for _, t := range f.GetEpsilonTransitions(state) {
+				for _, t := range ix.Epsilon(state) {
 					for _, to := range t.To {
 						if !closure[to] {
 							closure[to] = true
@@ -63,7 +85,7 @@ func (f *FSM) ToDFA() *FSM {
 	// Helper to check if state set contains an accepting state
 	isAccepting := func(states map[string]bool) bool {
 		for s := range states {
-			if f.IsAccepting(s) {
+			if ix.IsAccepting(s) {
 				return true
 			}
 		}
@@ -85,6 +107,9 @@ func (f *FSM) ToDFA() *FSM {
 	dfaStates[dfa.Initial] = initialSet
 
 	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		current := queue[0]
 		queue = queue[1:]
 		currentName := stateSetName(current)
@@ -105,7 +130,7 @@ func (f *FSM) ToDFA() *FSM {
 			// Compute target state set
 			targetSet := make(map[string]bool)
 			for state := range current {
-				transitions := f.GetTransitions(state, &input)
+				transitions := ix.Transitions(state, &input)
 				for _, t := range transitions {
 					for _, to := range t.To {
 						targetSet[to] = true
@@ -137,10 +162,12 @@ func (f *FSM) ToDFA() *FSM {
 		}
 	}
 
-	return dfa
+	return dfa, nil
 }
 
-// Copy creates a deep copy of the FSM.
+// Copy creates a deep copy of the FSM's behavioural fields: states,
+// alphabets, transitions, outputs, and input classes. Use Clone to copy
+// everything.
 func (f *FSM) Copy() *FSM {
 	copy := &FSM{
 		Type:           f.Type,
@@ -159,6 +186,10 @@ func (f *FSM) Copy() *FSM {
 	copy1(copy.Alphabet, f.Alphabet)
 	copy1(copy.OutputAlphabet, f.OutputAlphabet)
 	copy1(copy.Accepting, f.Accepting)
+	if f.StackAlphabet != nil {
+		copy.StackAlphabet = append([]string{}, f.StackAlphabet...)
+	}
+	copy.StackStart = f.StackStart
 
 	for i, t := range f.Transitions {
 		copy.Transitions[i] = Transition{
@@ -174,11 +205,29 @@ func (f *FSM) Copy() *FSM {
 			out := *t.Output
 			copy.Transitions[i].Output = &out
 		}
+		if t.Probability != nil {
+			p := *t.Probability
+			copy.Transitions[i].Probability = &p
+		}
+		if t.Weight != nil {
+			w := *t.Weight
+			copy.Transitions[i].Weight = &w
+		}
+		if t.Pop != nil {
+			p := *t.Pop
+			copy.Transitions[i].Pop = &p
+		}
+		if t.Push != nil {
+			copy.Transitions[i].Push = append([]string{}, t.Push...)
+		}
 	}
 
 	for k, v := range f.StateOutputs {
 		copy.StateOutputs[k] = v
 	}
+	// Input classes change what transitions match, so they are
+	// behaviour, unlike the rest of the metadata.
+	copy.Metadata = inputClassMetadata(f)
 
 	return copy
 }
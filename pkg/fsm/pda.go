@@ -0,0 +1,292 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxPDAStack is the deepest stack a PDARunner follows. Epsilon
+// transitions that push without consuming input could otherwise grow
+// the stack forever; a run that needs a deeper stack is an error.
+const MaxPDAStack = 1024
+
+// stackSymbol reports whether sym is in f's stack alphabet.
+func stackSymbol(f *FSM, sym string) bool {
+	for _, s := range f.StackAlphabet {
+		if s == sym {
+			return true
+		}
+	}
+	return false
+}
+
+// StackLabel renders t's stack operation as "pop→push", with ε for no
+// pop or an empty push, as PDA edge labels show it in brackets after the
+// input ("a [Z→AZ]").
+// Pushed symbols are written top first, run together if each is a
+// single character and separated by spaces otherwise: "Z→AZ",
+// "ε→open", "Z→ε".
+func (t Transition) StackLabel() string {
+	pop := "ε"
+	if t.Pop != nil {
+		pop = *t.Pop
+	}
+	push := "ε"
+	if len(t.Push) > 0 {
+		sep := ""
+		for _, sym := range t.Push {
+			if utf8.RuneCountInString(sym) != 1 {
+				sep = " "
+				break
+			}
+		}
+		push = strings.Join(t.Push, sep)
+	}
+	return pop + "→" + push
+}
+
+// PDAConfig is one configuration of a running pushdown automaton.
+type PDAConfig struct {
+	State string   `json:"state"`
+	Stack []string `json:"stack"` // bottom first; the top is the last element
+}
+
+// key identifies the configuration for de-duplication.
+func (c PDAConfig) key() string {
+	return c.State + "\x00" + strings.Join(c.Stack, "\x01")
+}
+
+// String renders the configuration as "state [bottom ... top]".
+func (c PDAConfig) String() string {
+	return c.State + " [" + strings.Join(c.Stack, " ") + "]"
+}
+
+// PDARunner executes a pushdown automaton. Like Runner with an NFA, it
+// tracks every configuration (state and stack) the machine could be in,
+// following epsilon transitions after each input. A run accepts if any
+// configuration is in an accepting state; the stack need not be empty.
+//
+// A transition applies to a configuration if it leaves the
+// configuration's state and its Pop (if any) matches the top of the
+// stack. The machine must not be modified while a PDARunner is using it.
+type PDARunner struct {
+	fsm     *FSM
+	index   *TransitionIndex
+	configs []PDAConfig
+	history []Step
+}
+
+// NewPDARunner creates a runner for the pushdown automaton f, starting
+// in the initial state with StackStart (if any) on the stack.
+func NewPDARunner(f *FSM) (*PDARunner, error) {
+	if f.Type != TypePDA {
+		return nil, fmt.Errorf("not a PDA: %s", f.Type)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid FSM: %w", err)
+	}
+	r := &PDARunner{fsm: f, index: NewTransitionIndex(f)}
+	if err := r.start(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// start puts the runner in its initial configurations.
+func (r *PDARunner) start() error {
+	c := PDAConfig{State: r.fsm.Initial, Stack: []string{}}
+	if r.fsm.StackStart != "" {
+		c.Stack = append(c.Stack, r.fsm.StackStart)
+	}
+	configs, err := r.epsilonClosure([]PDAConfig{c})
+	if err != nil {
+		return err
+	}
+	r.configs = configs
+	r.history = make([]Step, 0)
+	return nil
+}
+
+// apply returns the configuration t leads to from c, and whether t
+// applies to c at all.
+func apply(t Transition, c PDAConfig, to string) (PDAConfig, bool) {
+	stack := c.Stack
+	if t.Pop != nil {
+		if len(stack) == 0 || stack[len(stack)-1] != *t.Pop {
+			return PDAConfig{}, false
+		}
+		stack = stack[:len(stack)-1]
+	}
+	next := make([]string, len(stack), len(stack)+len(t.Push))
+	copy(next, stack)
+	for i := len(t.Push) - 1; i >= 0; i-- {
+		next = append(next, t.Push[i])
+	}
+	return PDAConfig{State: to, Stack: next}, true
+}
+
+// epsilonClosure adds every configuration reachable from configs by
+// epsilon transitions, returning them sorted.
+func (r *PDARunner) epsilonClosure(configs []PDAConfig) ([]PDAConfig, error) {
+	seen := make(map[string]bool)
+	var result, queue []PDAConfig
+	add := func(c PDAConfig) error {
+		if len(c.Stack) > MaxPDAStack {
+			return fmt.Errorf("stack deeper than %d symbols in state %s", MaxPDAStack, c.State)
+		}
+		if k := c.key(); !seen[k] {
+			seen[k] = true
+			result = append(result, c)
+			queue = append(queue, c)
+		}
+		return nil
+	}
+	for _, c := range configs {
+		if err := add(c); err != nil {
+			return nil, err
+		}
+	}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, t := range r.index.Epsilon(c.State) {
+			for _, to := range t.To {
+				if next, ok := apply(t, c, to); ok {
+					if err := add(next); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	sortConfigs(result)
+	return result, nil
+}
+
+func sortConfigs(configs []PDAConfig) {
+	sort.Slice(configs, func(i, j int) bool {
+		if configs[i].State != configs[j].State {
+			return configs[i].State < configs[j].State
+		}
+		return strings.Join(configs[i].Stack, "\x01") < strings.Join(configs[j].Stack, "\x01")
+	})
+}
+
+// Step consumes one input symbol. It returns an error, leaving the runner
+// unchanged, if no transition applies to any current configuration.
+func (r *PDARunner) Step(input string) error {
+	var next []PDAConfig
+	for _, c := range r.configs {
+		for _, t := range r.index.Transitions(c.State, &input) {
+			for _, to := range t.To {
+				if n, ok := apply(t, c, to); ok {
+					next = append(next, n)
+				}
+			}
+		}
+	}
+	if len(next) == 0 {
+		return fmt.Errorf("no transition from %s on input %q", r.CurrentState(), input)
+	}
+	next, err := r.epsilonClosure(next)
+	if err != nil {
+		return err
+	}
+
+	from := r.CurrentStates()
+	r.configs = next
+	to := r.CurrentStates()
+	r.history = append(r.history, Step{
+		FromState:  formatStateSet(from),
+		FromStates: from,
+		Input:      input,
+		ToState:    formatStateSet(to),
+		ToStates:   to,
+	})
+	return nil
+}
+
+// Run consumes inputs in order, stopping at the first that cannot be
+// taken.
+func (r *PDARunner) Run(inputs []string) error {
+	for _, in := range inputs {
+		if err := r.Step(in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset returns the runner to its initial configurations and clears the
+// history.
+func (r *PDARunner) Reset() {
+	// The initial closure succeeded in NewPDARunner, so it succeeds again.
+	_ = r.start()
+}
+
+// Configurations returns the current configurations, sorted by state and
+// then stack.
+func (r *PDARunner) Configurations() []PDAConfig {
+	out := make([]PDAConfig, len(r.configs))
+	for i, c := range r.configs {
+		out[i] = PDAConfig{State: c.State, Stack: append([]string{}, c.Stack...)}
+	}
+	return out
+}
+
+// CurrentStates returns the states of the current configurations, sorted
+// and without repeats.
+func (r *PDARunner) CurrentStates() []string {
+	var states []string
+	seen := make(map[string]bool)
+	for _, c := range r.configs {
+		if !seen[c.State] {
+			seen[c.State] = true
+			states = append(states, c.State)
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+// CurrentState returns the current states as a string, as Runner does.
+func (r *PDARunner) CurrentState() string {
+	return formatStateSet(r.CurrentStates())
+}
+
+// IsAccepting reports whether any current configuration is in an
+// accepting state.
+func (r *PDARunner) IsAccepting() bool {
+	for _, c := range r.configs {
+		if r.index.IsAccepting(c.State) {
+			return true
+		}
+	}
+	return false
+}
+
+// AvailableInputs returns the inputs some current configuration can take.
+func (r *PDARunner) AvailableInputs() []string {
+	seen := make(map[string]bool)
+	var inputs []string
+	for _, c := range r.configs {
+		for _, t := range r.index.From(c.State) {
+			if t.Input == nil || seen[*t.Input] {
+				continue
+			}
+			if _, ok := apply(t, c, c.State); ok {
+				seen[*t.Input] = true
+				inputs = append(inputs, *t.Input)
+			}
+		}
+	}
+	sort.Strings(inputs)
+	return inputs
+}
+
+// History returns the execution history.
+func (r *PDARunner) History() []Step {
+	return r.history
+}
@@ -0,0 +1,146 @@
+package fsm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// anbnPDA accepts a^n b^n for n >= 0, counting the a's on the stack
+// above a bottom marker Z.
+func anbnPDA() *FSM {
+	f := New(TypePDA)
+	f.States = []string{"push", "pop", "done"}
+	f.Alphabet = []string{"a", "b"}
+	f.Initial = "push"
+	f.Accepting = []string{"done"}
+	f.StackAlphabet = []string{"Z", "A"}
+	f.StackStart = "Z"
+	a, b, z, sa := "a", "b", "Z", "A"
+	add := func(from string, in *string, to string, pop *string, push ...string) {
+		f.AddTransition(from, in, []string{to}, nil)
+		f.Transitions[len(f.Transitions)-1].Pop = pop
+		f.Transitions[len(f.Transitions)-1].Push = push
+	}
+	add("push", &a, "push", nil, "A")
+	add("push", &b, "pop", &sa)
+	add("pop", &b, "pop", &sa)
+	add("pop", nil, "done", &z, "Z")
+	add("push", nil, "done", &z, "Z")
+	return f
+}
+
+func TestPDARunner_Anbn(t *testing.T) {
+	tests := []struct {
+		input  string
+		accept bool
+	}{
+		{"", true}, {"ab", true}, {"aaabbb", true},
+		{"a", false}, {"aab", false}, {"abb", false}, {"ba", false},
+	}
+	for _, tt := range tests {
+		r, err := NewPDARunner(anbnPDA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var inputs []string
+		for _, c := range tt.input {
+			inputs = append(inputs, string(c))
+		}
+		err = r.Run(inputs)
+		if got := err == nil && r.IsAccepting(); got != tt.accept {
+			t.Errorf("%q: accepted %v (err %v), want %v", tt.input, got, err, tt.accept)
+		}
+	}
+
+	r, _ := NewPDARunner(anbnPDA())
+	r.Run([]string{"a", "a", "b"})
+	want := []PDAConfig{{"pop", []string{"Z", "A"}}}
+	if got := r.Configurations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after aab: %v, want %v", got, want)
+	}
+	if got := r.AvailableInputs(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("available inputs %v, want [b]", got)
+	}
+	r.Reset()
+	if got := r.CurrentState(); got != "{done, push}" || len(r.History()) != 0 {
+		t.Errorf("after reset: %s, history %v", got, r.History())
+	}
+}
+
+func TestPDARunner_StackLimit(t *testing.T) {
+	// An epsilon loop that pushes forever.
+	f := New(TypePDA)
+	f.States = []string{"s"}
+	f.Initial = "s"
+	f.StackAlphabet = []string{"X"}
+	f.AddTransition("s", nil, []string{"s"}, nil)
+	f.Transitions[0].Push = []string{"X"}
+	if _, err := NewPDARunner(f); err == nil || !strings.Contains(err.Error(), "stack deeper") {
+		t.Errorf("unbounded epsilon pushes: got %v", err)
+	}
+}
+
+func TestValidate_PDA(t *testing.T) {
+	if err := anbnPDA().Validate(); err != nil {
+		t.Fatalf("valid PDA rejected: %v", err)
+	}
+	tests := []struct {
+		name  string
+		edit  func(f *FSM)
+		error string
+	}{
+		{"pop", func(f *FSM) { x := "X"; f.Transitions[1].Pop = &x }, `pop "X" not in stack alphabet`},
+		{"push", func(f *FSM) { f.Transitions[0].Push = []string{"B"} }, `push "B" not in stack alphabet`},
+		{"start", func(f *FSM) { f.StackStart = "Y" }, `stack start "Y" not in stack alphabet`},
+		{"not a PDA", func(f *FSM) { f.Type = TypeNFA }, "stack operations only allowed in PDA"},
+	}
+	for _, tt := range tests {
+		f := anbnPDA()
+		tt.edit(f)
+		if err := f.Validate(); err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.error)
+		}
+	}
+
+	if _, err := NewRunner(anbnPDA()); err == nil {
+		t.Error("NewRunner accepted a PDA")
+	}
+	if _, err := NewPDARunner(coinFSM()); err == nil {
+		t.Error("NewPDARunner accepted an NFA")
+	}
+}
+
+func TestStackLabel(t *testing.T) {
+	z := "Z"
+	open := "open"
+	tests := []struct {
+		t    Transition
+		want string
+	}{
+		{Transition{}, "ε→ε"},
+		{Transition{Pop: &z, Push: []string{"A", "Z"}}, "Z→AZ"},
+		{Transition{Push: []string{"open", "Z"}}, "ε→open Z"},
+		{Transition{Pop: &open}, "open→ε"},
+	}
+	for _, tt := range tests {
+		if got := tt.t.StackLabel(); got != tt.want {
+			t.Errorf("StackLabel() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestClonePDA(t *testing.T) {
+	f := anbnPDA()
+	c := f.Clone()
+	if !c.StructurallyEqual(f) {
+		t.Fatal("clone differs")
+	}
+	c.Transitions[0].Push[0] = "Z"
+	if f.Transitions[0].Push[0] != "A" {
+		t.Error("clone shares a push list")
+	}
+	if c.StructurallyEqual(f) {
+		t.Error("different pushes compare equal")
+	}
+}
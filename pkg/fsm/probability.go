@@ -0,0 +1,208 @@
+package fsm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// probabilityTolerance is how far the probabilities of a (state, input)
+// group may sum from 1, to allow for decimal fractions such as 0.1.
+const probabilityTolerance = 1e-6
+
+// HasProbabilities reports whether any transition carries a probability.
+func (f *FSM) HasProbabilities() bool {
+	for _, t := range f.Transitions {
+		if t.Probability != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateProbabilities checks transition probabilities: each lies in
+// [0, 1], and among the transitions sharing a state and input (or
+// sharing a state and being epsilon), either none has a probability or
+// all do and they sum to 1.
+func (f *FSM) validateProbabilities() error {
+	v := f.Vocab()
+	sl := strings.ToLower(v.State)
+	tl := strings.ToLower(v.Transition)
+	il := strings.ToLower(v.Input)
+
+	type group struct {
+		with, without int
+		sum           float64
+	}
+	groups := make(map[pairKey]*group)
+	var order []pairKey
+	for i, t := range f.Transitions {
+		if p := t.Probability; p != nil && !(*p >= 0 && *p <= 1) {
+			return fmt.Errorf("%s %d: probability %v not between 0 and 1", tl, i, *p)
+		}
+		k := keyFor(t.From, t.Input)
+		g := groups[k]
+		if g == nil {
+			g = &group{}
+			groups[k] = g
+			order = append(order, k)
+		}
+		if t.Probability != nil {
+			g.with++
+			g.sum += *t.Probability
+		} else {
+			g.without++
+		}
+	}
+
+	for _, k := range order {
+		g := groups[k]
+		if g.with == 0 {
+			continue
+		}
+		on := fmt.Sprintf("%s %q", il, k.input)
+		if k.epsilon {
+			on = "epsilon"
+		}
+		if g.without > 0 {
+			return fmt.Errorf("%s %q on %s: %d of %d %ss have no probability", sl, k.from, on, g.without, g.with+g.without, tl)
+		}
+		if math.Abs(g.sum-1) > probabilityTolerance {
+			return fmt.Errorf("%s %q on %s: probabilities sum to %g, not 1", sl, k.from, on, g.sum)
+		}
+	}
+	return nil
+}
+
+// transitionWeights returns the chance of taking each of ts, the
+// transitions leaving one state on one input: their probabilities if
+// they have them, otherwise an equal share each. Transitions without
+// targets get nothing.
+func transitionWeights(ts []Transition) []float64 {
+	weights := make([]float64, len(ts))
+	total := 0.0
+	for i, t := range ts {
+		if len(t.To) == 0 {
+			continue
+		}
+		weights[i] = 1
+		if t.Probability != nil {
+			weights[i] = *t.Probability
+		}
+		total += weights[i]
+	}
+	if total > 0 {
+		for i := range weights {
+			weights[i] /= total
+		}
+	}
+	return weights
+}
+
+// StationaryDistribution returns the long-run share of time the machine
+// spends in each state when it is run as a Markov chain: from each
+// state, every input (and epsilon, if the state has epsilon transitions)
+// is equally likely, a transition is chosen by its probability (or
+// uniformly, for transitions without one), and an NFA transition's
+// targets share its chance equally. A state with no transitions stays
+// where it is.
+//
+// The distribution is the one reached from the initial state, so for a
+// machine whose states do not all reach each other it describes where
+// runs from the initial state settle, with nothing in the states they
+// cannot reach. Every state in f.States has an entry, and the values sum
+// to 1.
+func (f *FSM) StationaryDistribution() (map[string]float64, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	ix := NewTransitionIndex(f)
+	n := len(f.States)
+	out := markovChain(f, ix)
+
+	// Power iteration on the lazy chain (I+P)/2, which has the same
+	// stationary distributions as P but converges even when P is
+	// periodic.
+	dist := make([]float64, n)
+	dist[ix.StateIndex(f.Initial)] = 1
+	next := make([]float64, n)
+	converged := false
+	for iter := 0; iter < 1000000 && !converged; iter++ {
+		for i := range next {
+			next[i] = dist[i] / 2
+		}
+		for i, edges := range out {
+			for _, e := range edges {
+				next[e.to] += dist[i] * e.p / 2
+			}
+		}
+		change := 0.0
+		for i := range dist {
+			change += math.Abs(next[i] - dist[i])
+		}
+		dist, next = next, dist
+		converged = change < 1e-12
+	}
+	if !converged {
+		return nil, fmt.Errorf("stationary distribution did not converge")
+	}
+
+	result := make(map[string]float64, n)
+	for i, s := range f.States {
+		if ix.StateIndex(s) == i {
+			result[s] = dist[i]
+		}
+	}
+	return result, nil
+}
+
+// chainEdge is one move of the Markov chain behind a machine: to the
+// state at index to, with probability p, along a transition that costs
+// cost.
+type chainEdge struct {
+	to   int
+	p    float64
+	cost float64
+}
+
+// markovChain returns the moves out of each state (indexed as in
+// f.States) when f runs as a Markov chain: every input of a state, and
+// epsilon if it has epsilon transitions, is equally likely; a
+// transition is chosen by transitionWeights; and a transition's targets
+// share its chance equally. A state with no transitions moves to itself
+// at no cost. Duplicate state names get no moves. f must be valid.
+func markovChain(f *FSM, ix *TransitionIndex) [][]chainEdge {
+	out := make([][]chainEdge, len(f.States))
+	for i, s := range f.States {
+		if ix.StateIndex(s) != i {
+			continue // duplicate name; the first entry carries it
+		}
+		var keys []pairKey
+		byKey := make(map[pairKey][]Transition)
+		for _, t := range ix.From(s) {
+			if len(t.To) == 0 {
+				continue
+			}
+			k := keyFor(t.From, t.Input)
+			if byKey[k] == nil {
+				keys = append(keys, k)
+			}
+			byKey[k] = append(byKey[k], t)
+		}
+		if len(keys) == 0 {
+			out[i] = []chainEdge{{i, 1, 0}}
+			continue
+		}
+		for _, k := range keys {
+			ts := byKey[k]
+			for j, w := range transitionWeights(ts) {
+				for _, to := range ts[j].To {
+					p := w / float64(len(keys)) / float64(len(ts[j].To))
+					out[i] = append(out[i], chainEdge{ix.StateIndex(to), p, ts[j].Cost()})
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,154 @@
+package fsm
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func probPtr(p float64) *float64 { return &p }
+
+// weatherFSM is a two-state Markov chain on one input: sunny stays sunny
+// with probability 0.9, rainy clears up with probability 0.5. Its
+// stationary distribution is 5/6 sunny, 1/6 rainy.
+func weatherFSM() *FSM {
+	f := New(TypeNFA)
+	f.States = []string{"sunny", "rainy"}
+	f.Initial = "rainy"
+	f.Alphabet = []string{"day"}
+	in := "day"
+	for _, e := range []struct {
+		from, to string
+		p        float64
+	}{
+		{"sunny", "sunny", 0.9}, {"sunny", "rainy", 0.1},
+		{"rainy", "sunny", 0.5}, {"rainy", "rainy", 0.5},
+	} {
+		f.AddTransition(e.from, &in, []string{e.to}, nil)
+		f.Transitions[len(f.Transitions)-1].Probability = probPtr(e.p)
+	}
+	return f
+}
+
+func TestValidate_Probabilities(t *testing.T) {
+	if err := weatherFSM().Validate(); err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(f *FSM)
+		error string
+	}{
+		{"out of range", func(f *FSM) { f.Transitions[0].Probability = probPtr(1.5) }, "not between 0 and 1"},
+		{"NaN", func(f *FSM) { f.Transitions[0].Probability = probPtr(math.NaN()) }, "not between 0 and 1"},
+		{"bad sum", func(f *FSM) { f.Transitions[1].Probability = probPtr(0.2) }, `"sunny" on input "day": probabilities sum to 1.1`},
+		{"missing", func(f *FSM) { f.Transitions[3].Probability = nil }, "1 of 2 transitions have no probability"},
+	}
+	for _, tt := range tests {
+		f := weatherFSM()
+		tt.edit(f)
+		err := f.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.error)
+		}
+	}
+
+	// Decimal fractions need not sum to exactly 1.
+	f := weatherFSM()
+	f.Transitions[0].Probability = probPtr(0.7)
+	f.Transitions[1].Probability = probPtr(0.1)
+	in := "day"
+	f.AddTransition("sunny", &in, []string{"rainy"}, nil)
+	f.Transitions[len(f.Transitions)-1].Probability = probPtr(0.2)
+	if err := f.Validate(); err != nil {
+		t.Errorf("0.7 + 0.1 + 0.2 rejected: %v", err)
+	}
+}
+
+func TestStationaryDistribution(t *testing.T) {
+	dist, err := weatherFSM().StationaryDistribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(dist["sunny"]-5.0/6) > 1e-9 || math.Abs(dist["rainy"]-1.0/6) > 1e-9 {
+		t.Errorf("distribution %v, want 5/6 sunny, 1/6 rainy", dist)
+	}
+
+	// A periodic chain without probabilities: transitions are uniform.
+	f := New(TypeDFA)
+	f.States = []string{"a", "b", "c"}
+	f.Initial = "a"
+	f.Alphabet = []string{"x"}
+	x := "x"
+	f.AddTransition("a", &x, []string{"b"}, nil)
+	f.AddTransition("b", &x, []string{"a"}, nil)
+	dist, err = f.StationaryDistribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(dist["a"]-0.5) > 1e-9 || math.Abs(dist["b"]-0.5) > 1e-9 || dist["c"] != 0 {
+		t.Errorf("periodic chain: %v, want a and b 1/2 each", dist)
+	}
+
+	// An absorbing state takes everything.
+	dist, err = coinFSM().StationaryDistribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(dist["heads"]-1) > 1e-6 {
+		t.Errorf("coin: %v, want all in heads", dist)
+	}
+}
+
+func TestRunner_RandomMode(t *testing.T) {
+	r, err := NewRunner(weatherFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetRandom(rand.New(rand.NewSource(1)))
+	sunny := 0
+	const days = 60000
+	for i := 0; i < days; i++ {
+		if _, err := r.Step("day"); err != nil {
+			t.Fatal(err)
+		}
+		states := r.CurrentStates()
+		if len(states) != 1 {
+			t.Fatalf("random mode in %d states", len(states))
+		}
+		if states[0] == "sunny" {
+			sunny++
+		}
+	}
+	if share := float64(sunny) / days; math.Abs(share-5.0/6) > 0.01 {
+		t.Errorf("sunny %.3f of days, want about 5/6", share)
+	}
+
+	// The same seed gives the same run.
+	run := func() string {
+		r, _ := NewRunner(coinFSM())
+		r.SetRandom(rand.New(rand.NewSource(7)))
+		var seen []string
+		for i := 0; i < 20; i++ {
+			if _, err := r.Step("go"); err != nil {
+				r.Reset()
+			}
+			seen = append(seen, r.CurrentState())
+		}
+		return strings.Join(seen, " ")
+	}
+	if a, b := run(), run(); a != b {
+		t.Errorf("same seed, different runs:\n%s\n%s", a, b)
+	}
+
+	// Normal mode tracks both targets again.
+	r, _ = NewRunner(coinFSM())
+	r.SetRandom(rand.New(rand.NewSource(1)))
+	r.SetRandom(nil)
+	r.Step("go")
+	if got := r.CurrentState(); got != "{heads, tails}" {
+		t.Errorf("after SetRandom(nil): %s", got)
+	}
+}
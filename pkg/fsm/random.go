@@ -0,0 +1,177 @@
+package fsm
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// RandomOptions controls the machines produced by Random.
+type RandomOptions struct {
+	States   int     // number of states (default 10)
+	Alphabet int     // number of input symbols (default 2)
+	Outputs  int     // number of output symbols for Moore/Mealy (default 2)
+	Density  float64 // fraction of (state, input) pairs with a transition, 0–1 (default 0.8)
+	Type     Type    // machine type (default dfa)
+	Seed     int64   // random seed; the same options always give the same machine
+}
+
+// Random generates a valid machine of the requested size for stress tests
+// and benchmarks. States are named s0, s1, ..., inputs a0, a1, ..., and
+// outputs y0, y1, ....
+//
+// Every state is reachable from s0: a random spanning tree is laid down
+// first, and further transitions are added until the requested density is
+// met (or exceeded, if the tree alone needs more). About a quarter of the
+// states are accepting. NFAs additionally get some multi-target and
+// epsilon transitions; Moore machines get an output on every state and
+// Mealy machines on every transition.
+func Random(opts RandomOptions) (*FSM, error) {
+	if opts.States == 0 {
+		opts.States = 10
+	}
+	if opts.Alphabet == 0 {
+		opts.Alphabet = 2
+	}
+	if opts.Outputs == 0 {
+		opts.Outputs = 2
+	}
+	if opts.Density == 0 {
+		opts.Density = 0.8
+	}
+	if opts.Type == "" {
+		opts.Type = TypeDFA
+	}
+
+	switch {
+	case opts.States < 1 || opts.States > 65536:
+		return nil, fmt.Errorf("states must be between 1 and 65536, got %d", opts.States)
+	case opts.Alphabet < 1 || opts.Alphabet > 65535:
+		return nil, fmt.Errorf("alphabet must be between 1 and 65535, got %d", opts.Alphabet)
+	case opts.Outputs < 1 || opts.Outputs > 65536:
+		return nil, fmt.Errorf("outputs must be between 1 and 65536, got %d", opts.Outputs)
+	case opts.Density < 0 || opts.Density > 1:
+		return nil, fmt.Errorf("density must be between 0 and 1, got %g", opts.Density)
+	}
+	switch opts.Type {
+	case TypeDFA, TypeNFA, TypeMoore, TypeMealy:
+	default:
+		return nil, fmt.Errorf("unknown type %q", opts.Type)
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	n, k := opts.States, opts.Alphabet
+
+	f := New(opts.Type)
+	f.Name = fmt.Sprintf("random_%d", opts.Seed)
+	f.Description = fmt.Sprintf("Random %s: %d states, %d inputs, density %g, seed %d",
+		opts.Type, n, k, opts.Density, opts.Seed)
+	f.States = make([]string, n)
+	for i := range f.States {
+		f.States[i] = fmt.Sprintf("s%d", i)
+	}
+	f.Alphabet = make([]string, k)
+	for i := range f.Alphabet {
+		f.Alphabet[i] = fmt.Sprintf("a%d", i)
+	}
+	hasOutputs := opts.Type == TypeMoore || opts.Type == TypeMealy
+	if hasOutputs {
+		f.OutputAlphabet = make([]string, opts.Outputs)
+		for i := range f.OutputAlphabet {
+			f.OutputAlphabet[i] = fmt.Sprintf("y%d", i)
+		}
+	}
+	f.Initial = f.States[0]
+
+	// used[s*k+i] marks (state, input) pairs that already have a transition.
+	used := make([]bool, n*k)
+	free := make([]int, n) // unused inputs per state
+	for i := range free {
+		free[i] = k
+	}
+	add := func(from, input, to int) {
+		used[from*k+input] = true
+		free[from]--
+		in := f.Alphabet[input]
+		t := Transition{From: f.States[from], Input: &in, To: []string{f.States[to]}}
+		if opts.Type == TypeNFA && rng.Intn(4) == 0 {
+			if extra := rng.Intn(n); extra != to {
+				t.To = append(t.To, f.States[extra])
+			}
+		}
+		if opts.Type == TypeMealy {
+			out := f.OutputAlphabet[rng.Intn(len(f.OutputAlphabet))]
+			t.Output = &out
+		}
+		f.Transitions = append(f.Transitions, t)
+	}
+
+	// Spanning tree: each new state hangs off an earlier state that still
+	// has a free input, so everything is reachable from s0.
+	open := []int{0}
+	for s := 1; s < n; s++ {
+		j := rng.Intn(len(open))
+		parent := open[j]
+		input := randomFreeInput(rng, used[parent*k:(parent+1)*k])
+		add(parent, input, s)
+		if free[parent] == 0 {
+			open[j] = open[len(open)-1]
+			open = open[:len(open)-1]
+		}
+		open = append(open, s)
+	}
+
+	// Fill further pairs, chosen uniformly, up to the requested density.
+	want := int(opts.Density*float64(n*k) + 0.5)
+	if remaining := want - (n - 1); remaining > 0 {
+		var pairs []int
+		for p, u := range used {
+			if !u {
+				pairs = append(pairs, p)
+			}
+		}
+		rng.Shuffle(len(pairs), func(i, j int) { pairs[i], pairs[j] = pairs[j], pairs[i] })
+		if remaining > len(pairs) {
+			remaining = len(pairs)
+		}
+		for _, p := range pairs[:remaining] {
+			add(p/k, p%k, rng.Intn(n))
+		}
+	}
+
+	if opts.Type == TypeNFA {
+		for s := 0; s < n; s++ {
+			if rng.Intn(10) == 0 {
+				f.Transitions = append(f.Transitions, Transition{
+					From: f.States[s],
+					To:   []string{f.States[rng.Intn(n)]},
+				})
+			}
+		}
+	}
+
+	for _, s := range f.States {
+		if rng.Intn(4) == 0 {
+			f.Accepting = append(f.Accepting, s)
+		}
+	}
+	if len(f.Accepting) == 0 && !hasOutputs {
+		f.Accepting = append(f.Accepting, f.States[n-1])
+	}
+	if opts.Type == TypeMoore {
+		for _, s := range f.States {
+			f.StateOutputs[s] = f.OutputAlphabet[rng.Intn(len(f.OutputAlphabet))]
+		}
+	}
+
+	return f, nil
+}
+
+// randomFreeInput picks a random index i with !used[i]. The caller
+// guarantees that at least one exists.
+func randomFreeInput(rng *rand.Rand, used []bool) int {
+	i := rng.Intn(len(used))
+	for used[i] {
+		i = (i + 1) % len(used)
+	}
+	return i
+}
@@ -0,0 +1,74 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRandom_ValidAndReachable(t *testing.T) {
+	for _, typ := range []Type{TypeDFA, TypeNFA, TypeMoore, TypeMealy} {
+		for seed := int64(0); seed < 20; seed++ {
+			f, err := Random(RandomOptions{States: 30, Alphabet: 3, Density: 0.5, Type: typ, Seed: seed})
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", typ, seed, err)
+			}
+			if err := f.Validate(); err != nil {
+				t.Fatalf("%s seed %d: invalid machine: %v", typ, seed, err)
+			}
+			if u := f.UnreachableStates(); len(u) > 0 {
+				t.Fatalf("%s seed %d: unreachable states %v", typ, seed, u)
+			}
+			if typ != TypeNFA {
+				if nd := f.NonDeterministicStates(); len(nd) > 0 {
+					t.Fatalf("%s seed %d: nondeterministic states %v", typ, seed, nd)
+				}
+			}
+		}
+	}
+}
+
+func TestRandom_Deterministic(t *testing.T) {
+	opts := RandomOptions{States: 50, Alphabet: 4, Type: TypeMealy, Seed: 42}
+	a, _ := Random(opts)
+	b, _ := Random(opts)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("same options produced different machines")
+	}
+	opts.Seed = 43
+	c, _ := Random(opts)
+	if reflect.DeepEqual(a.Transitions, c.Transitions) {
+		t.Error("different seeds produced identical transitions")
+	}
+}
+
+func TestRandom_Density(t *testing.T) {
+	f, err := Random(RandomOptions{States: 100, Alphabet: 4, Density: 1, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Transitions) != 400 {
+		t.Errorf("density 1: got %d transitions, want 400", len(f.Transitions))
+	}
+	if inc := f.IncompleteStates(); len(inc) > 0 {
+		t.Errorf("density 1: incomplete states %v", inc)
+	}
+
+	// The spanning tree alone needs n-1 transitions.
+	f, _ = Random(RandomOptions{States: 100, Alphabet: 4, Density: 0.01, Seed: 1})
+	if len(f.Transitions) != 99 {
+		t.Errorf("low density: got %d transitions, want 99", len(f.Transitions))
+	}
+}
+
+func TestRandom_BadOptions(t *testing.T) {
+	for _, opts := range []RandomOptions{
+		{States: -1},
+		{States: 70000},
+		{Density: 1.5},
+		{Type: "turing"},
+	} {
+		if _, err := Random(opts); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package fsm
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RenameState renames a state everywhere it is referenced. See
+// RenameStates.
+func (f *FSM) RenameState(oldName, newName string) error {
+	return f.RenameStates(map[string]string{oldName: newName})
+}
+
+// RenameStates renames states everywhere they are referenced: the state
+// list, the initial and accepting states, transitions, Moore outputs,
+// linked machines, classes and property values, state metadata, and net
+// endpoints. All renames apply at once, so {"a": "b", "b": "a"} swaps
+// two states. It is an error to rename a state that does not exist, or
+// to give two states the same name; the machine is unchanged if so.
+func (f *FSM) RenameStates(mapping map[string]string) error {
+	for oldName, newName := range mapping {
+		if !f.HasState(oldName) {
+			return fmt.Errorf("state %q does not exist", oldName)
+		}
+		if newName == "" {
+			return fmt.Errorf("new name for state %q is empty", oldName)
+		}
+	}
+	seen := make(map[string]string, len(f.States))
+	for _, s := range f.States {
+		name := renamed(mapping, s)
+		if prev, ok := seen[name]; ok {
+			return fmt.Errorf("states %q and %q would both be named %q", prev, s, name)
+		}
+		seen[name] = s
+	}
+
+	for i, s := range f.States {
+		f.States[i] = renamed(mapping, s)
+	}
+	if f.Initial != "" {
+		f.Initial = renamed(mapping, f.Initial)
+	}
+	for i, s := range f.Accepting {
+		f.Accepting[i] = renamed(mapping, s)
+	}
+	for i := range f.Transitions {
+		t := &f.Transitions[i]
+		t.From = renamed(mapping, t.From)
+		for j, to := range t.To {
+			t.To[j] = renamed(mapping, to)
+		}
+	}
+	f.StateOutputs = renameKeys(mapping, f.StateOutputs)
+	f.LinkedMachines = renameKeys(mapping, f.LinkedMachines)
+	f.StateClasses = renameKeys(mapping, f.StateClasses)
+	f.StateProperties = renameKeys(mapping, f.StateProperties)
+	f.StateMetadata = renameKeys(mapping, f.StateMetadata)
+	for i := range f.Nets {
+		for j := range f.Nets[i].Endpoints {
+			ep := &f.Nets[i].Endpoints[j]
+			ep.Instance = renamed(mapping, ep.Instance)
+		}
+	}
+	return nil
+}
+
+// StateRenames applies a regular expression rename to every state name
+// and returns the states whose names change, mapped to their new names,
+// for RenameStates. The replacement may refer to capture groups as $1
+// or ${name}, as in regexp.Regexp.ReplaceAllString; a state matches
+// only if the whole name does.
+func (f *FSM) StateRenames(pattern, replacement string) (map[string]string, error) {
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	mapping := make(map[string]string)
+	for _, s := range f.States {
+		if !re.MatchString(s) {
+			continue
+		}
+		if name := re.ReplaceAllString(s, replacement); name != s {
+			mapping[s] = name
+		}
+	}
+	return mapping, nil
+}
+
+// renamed returns the new name of s under mapping.
+func renamed(mapping map[string]string, s string) string {
+	if to, ok := mapping[s]; ok {
+		return to
+	}
+	return s
+}
+
+// renameKeys returns m with its state-name keys renamed. A nil map stays
+// nil.
+func renameKeys[V any](mapping map[string]string, m map[string]V) map[string]V {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		out[renamed(mapping, k)] = v
+	}
+	return out
+}
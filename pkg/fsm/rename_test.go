@@ -0,0 +1,88 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenameStates(t *testing.T) {
+	f := New(TypeMoore)
+	for _, s := range []string{"S1", "S2", "S10"} {
+		f.AddState(s)
+	}
+	f.AddInput("x")
+	f.AddOutput("o")
+	f.Initial = "S1"
+	f.Accepting = []string{"S10"}
+	f.AddTransition("S1", strp("x"), []string{"S2"}, nil)
+	f.AddTransition("S2", strp("x"), []string{"S10"}, nil)
+	f.StateOutputs["S2"] = "o"
+	f.SetStateMetadata("S10", "note", "last")
+	f.LinkedMachines["S2"] = "child"
+	f.Nets = []Net{{Name: "N1", Endpoints: []NetEndpoint{{"S1", "out"}, {"S2", "in"}}}}
+
+	mapping, err := f.StateRenames(`S(\d+)`, "state_$1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping) != 3 || mapping["S10"] != "state_10" {
+		t.Fatalf("mapping = %v", mapping)
+	}
+	if err := f.RenameStates(mapping); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"state_1", "state_2", "state_10"}; !reflect.DeepEqual(f.States, want) {
+		t.Errorf("states = %v, want %v", f.States, want)
+	}
+	if f.Initial != "state_1" || f.Accepting[0] != "state_10" {
+		t.Errorf("initial/accepting not renamed: %s, %v", f.Initial, f.Accepting)
+	}
+	if tr := f.Transitions[1]; tr.From != "state_2" || tr.To[0] != "state_10" {
+		t.Errorf("transition not renamed: %+v", tr)
+	}
+	if f.StateOutputs["state_2"] != "o" || f.LinkedMachines["state_2"] != "child" {
+		t.Errorf("state maps not renamed: %v, %v", f.StateOutputs, f.LinkedMachines)
+	}
+	if f.StateMetadata["state_10"]["note"] != "last" {
+		t.Errorf("metadata not renamed: %v", f.StateMetadata)
+	}
+	if f.Nets[0].Endpoints[1].Instance != "state_2" {
+		t.Errorf("net endpoint not renamed: %+v", f.Nets[0])
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("renamed machine invalid: %v", err)
+	}
+}
+
+func TestRenameStates_Swap(t *testing.T) {
+	f := symbolsFSM()
+	if err := f.RenameStates(map[string]string{"idle": "busy", "busy": "idle"}); err != nil {
+		t.Fatal(err)
+	}
+	if f.Initial != "busy" || f.Transitions[0].From != "busy" || f.Transitions[0].To[0] != "idle" {
+		t.Errorf("states not swapped: %s, %+v", f.Initial, f.Transitions[0])
+	}
+}
+
+func TestRenameStates_Collision(t *testing.T) {
+	f := symbolsFSM()
+	if err := f.RenameState("idle", "busy"); err == nil {
+		t.Error("renaming onto an existing state should fail")
+	}
+	if err := f.RenameState("missing", "x"); err == nil {
+		t.Error("renaming a missing state should fail")
+	}
+	if f.States[0] != "idle" {
+		t.Error("failed rename changed the machine")
+	}
+
+	// Both states match the whole pattern and would become "s".
+	mapping, err := f.StateRenames(`.*`, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.RenameStates(mapping); err == nil {
+		t.Error("two states renamed to the same name should fail")
+	}
+}
@@ -0,0 +1,103 @@
+package fsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// EventRule translates log lines matching Pattern into the input Input.
+type EventRule struct {
+	Pattern *regexp.Regexp
+	Input   string
+}
+
+// EventMap translates the lines of a log into machine inputs. Each line
+// is tried against the rules in order and the first match gives its
+// input. Lines matching no rule are skipped, unless Strict is set, in
+// which case they are violations.
+type EventMap struct {
+	Rules  []EventRule
+	Strict bool
+}
+
+// Input returns the input for a log line, and whether any rule matched.
+func (m EventMap) Input(line string) (string, bool) {
+	for _, rule := range m.Rules {
+		if rule.Pattern.MatchString(line) {
+			return rule.Input, true
+		}
+	}
+	return "", false
+}
+
+// ReplayViolation describes the log line at which a replay stopped.
+type ReplayViolation struct {
+	Line     int      `json:"line"`            // 1-based line number in the log
+	Text     string   `json:"text"`            // the log line
+	Input    string   `json:"input,omitempty"` // empty if the line matched no rule
+	States   []string `json:"states"`          // current states before the line
+	Expected []string `json:"expected"`        // inputs the machine could have taken
+}
+
+// ReplayResult is the outcome of replaying a log through a Runner.
+type ReplayResult struct {
+	Lines     int              `json:"lines"`   // log lines read
+	Events    int              `json:"events"`  // lines translated into inputs and taken
+	Skipped   int              `json:"skipped"` // lines matching no rule
+	States    []string         `json:"states"`  // current states at the end, or at the violation
+	Accepted  bool             `json:"accepted"`
+	Violation *ReplayViolation `json:"violation,omitempty"`
+}
+
+// Replay feeds the log read from rd through the runner, one line at a
+// time, translating each line into an input with m. It stops at the
+// first violation: a line whose input has no transition from any current
+// state, or, if m is strict, a line that matches no rule. The run is
+// accepted if there is no violation and it ends in an accepting state.
+// Like Feed, Replay does not record history and starts from the current
+// state; the runner is left where the replay stopped.
+//
+// It is an error for a rule to name an input that is not in the
+// machine's alphabet, since such a rule could never be followed. The
+// other error is from reading rd.
+func (r *Runner) Replay(rd io.Reader, m EventMap) (ReplayResult, error) {
+	var res ReplayResult
+	for _, rule := range m.Rules {
+		if r.index.InputIndex(rule.Input) < 0 {
+			v := r.fsm.Vocab()
+			return res, fmt.Errorf("event map %s %q not in %s", strings.ToLower(v.Input), rule.Input, strings.ToLower(v.Alphabet))
+		}
+	}
+
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		res.Lines++
+		line := strings.TrimRight(sc.Text(), "\r")
+		in, ok := m.Input(line)
+		if !ok && !m.Strict {
+			res.Skipped++
+			continue
+		}
+		if ok {
+			if _, err := r.step(in, false); err == nil {
+				res.Events++
+				continue
+			}
+		}
+		res.Violation = &ReplayViolation{
+			Line:     res.Lines,
+			Text:     line,
+			Input:    in,
+			States:   r.CurrentStates(),
+			Expected: r.AvailableInputs(),
+		}
+		break
+	}
+	res.States = r.CurrentStates()
+	res.Accepted = res.Violation == nil && r.IsAccepting()
+	return res, sc.Err()
+}
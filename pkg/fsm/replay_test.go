@@ -0,0 +1,82 @@
+package fsm
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// sessionFSM is a login session: out -login-> in, in -view-> in,
+// in -logout-> out, accepting in out.
+func sessionFSM() *FSM {
+	f := New(TypeDFA)
+	f.States = []string{"out", "in"}
+	f.Alphabet = []string{"login", "logout", "view"}
+	f.Initial = "out"
+	f.Accepting = []string{"out"}
+	f.AddTransition("out", strp("login"), []string{"in"}, nil)
+	f.AddTransition("in", strp("view"), []string{"in"}, nil)
+	f.AddTransition("in", strp("logout"), []string{"out"}, nil)
+	return f
+}
+
+func sessionEvents() EventMap {
+	return EventMap{Rules: []EventRule{
+		{regexp.MustCompile(`POST /login .* 200`), "login"},
+		{regexp.MustCompile(`GET /page/\d+`), "view"},
+		{regexp.MustCompile(`GET /logout|session expired`), "logout"},
+	}}
+}
+
+func TestRunner_Replay(t *testing.T) {
+	r, err := NewRunner(sessionFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := "boot\nPOST /login u=1 200\nGET /page/3\r\nsession expired\n"
+	res, err := r.Replay(strings.NewReader(log), sessionEvents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Accepted || res.Violation != nil || res.Lines != 4 || res.Events != 3 || res.Skipped != 1 {
+		t.Errorf("got %+v, want accepted with 3 events and 1 skipped line", res)
+	}
+
+	r.Reset()
+	log = "POST /login u=1 200\nGET /logout\nGET /page/3\nGET /page/4\n"
+	res, err = r.Replay(strings.NewReader(log), sessionEvents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ReplayViolation{Line: 3, Text: "GET /page/3", Input: "view", States: []string{"out"}, Expected: []string{"login"}}
+	if res.Accepted || !reflect.DeepEqual(res.Violation, want) || res.Lines != 3 {
+		t.Errorf("got %+v, violation %+v; want %+v", res, res.Violation, want)
+	}
+
+	// Strict maps treat unmatched lines as violations.
+	r.Reset()
+	m := sessionEvents()
+	m.Strict = true
+	res, _ = r.Replay(strings.NewReader("POST /login u=1 200\nboot\n"), m)
+	if res.Violation == nil || res.Violation.Line != 2 || res.Violation.Input != "" {
+		t.Errorf("strict: violation %+v, want unmatched line 2", res.Violation)
+	}
+
+	// Ending outside an accepting state is not a violation.
+	r.Reset()
+	res, _ = r.Replay(strings.NewReader("POST /login u=1 200\n"), sessionEvents())
+	if res.Accepted || res.Violation != nil || !reflect.DeepEqual(res.States, []string{"in"}) {
+		t.Errorf("unfinished session: got %+v", res)
+	}
+}
+
+func TestRunner_ReplayUnknownInput(t *testing.T) {
+	r, _ := NewRunner(sessionFSM())
+	m := sessionEvents()
+	m.Rules = append(m.Rules, EventRule{regexp.MustCompile("DELETE"), "delete"})
+	_, err := r.Replay(strings.NewReader(""), m)
+	if err == nil || !strings.Contains(err.Error(), `"delete" not in alphabet`) {
+		t.Errorf("got %v, want an unknown input error", err)
+	}
+}
@@ -2,39 +2,79 @@ package fsm
 
 import (
 	"fmt"
+	"log/slog"
+	"math/rand"
 	"sort"
 	"strings"
 )
 
 // Runner executes an FSM interactively.
 // For NFAs, it tracks all possible current states simultaneously.
+// The machine must not be modified while a Runner is using it: lookups go
+// through a TransitionIndex built when the runner is created.
+//
+// A Runner is not safe for concurrent use. To simulate one machine from
+// several goroutines (for example, one per web request), build a Runner
+// once and give each goroutine its own Clone; clones share the read-only
+// machine and index, so cloning is cheap, and concurrent calls to Clone
+// are safe as long as nothing steps the original meanwhile.
 type Runner struct {
 	fsm           *FSM
+	index         *TransitionIndex
 	currentStates map[string]bool // Set of current states (for NFA)
 	history       []Step
+	rng           *rand.Rand   // random mode (see SetRandom); nil otherwise
+	logger        *slog.Logger // see SetLogger; nil logs nothing
+
+	// History is a ring buffer once historyLimit steps are kept: the
+	// oldest step is history[historyStart]. steps counts every step
+	// recorded since Reset, including those dropped.
+	historyLimit int
+	historyStart int
+	steps        int
+
+	vars map[string]string // see SetVar
+
+	// classes reads inputs as alphabet symbols when the machine has
+	// input classes, and is nil otherwise; index then follows the
+	// expanded machine (see ExpandInputClasses).
+	classes *InputClassifier
 }
 
 // Step records one step of execution.
 type Step struct {
-	FromState  string   // For DFA: single state. For NFA: comma-separated states
-	FromStates []string // For NFA: all source states
-	Input      string
-	ToState    string   // For DFA: single state. For NFA: comma-separated states
-	ToStates   []string // For NFA: all target states
-	Output     string   // For Mealy/Moore
+	FromState  string   `json:"from"`        // For DFA: single state. For NFA: comma-separated states
+	FromStates []string `json:"from_states"` // For NFA: all source states
+	Input      string   `json:"input"`
+	ToState    string   `json:"to"`               // For DFA: single state. For NFA: comma-separated states
+	ToStates   []string `json:"to_states"`        // For NFA: all target states
+	Output     string   `json:"output,omitempty"` // For Mealy/Moore
 }
 
-// NewRunner creates a runner for the given FSM.
+// NewRunner creates a runner for the given FSM. Pushdown automata need
+// a PDARunner instead.
 func NewRunner(f *FSM) (*Runner, error) {
 	if err := f.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid FSM: %w", err)
 	}
+	if f.Type == TypePDA {
+		return nil, fmt.Errorf("a PDA needs a stack: use NewPDARunner")
+	}
 
 	r := &Runner{
 		fsm:           f,
+		index:         NewTransitionIndex(f),
 		currentStates: make(map[string]bool),
 		history:       make([]Step, 0),
 	}
+	if f.HasInputClasses() {
+		expanded, err := f.ExpandInputClasses()
+		if err != nil {
+			return nil, err
+		}
+		r.index = NewTransitionIndex(expanded)
+		r.classes, _ = f.InputClassifier()
+	}
 
 	// Start with initial state and its epsilon closure
 	r.currentStates[f.Initial] = true
@@ -45,6 +85,56 @@ func NewRunner(f *FSM) (*Runner, error) {
 	return r, nil
 }
 
+// Clone returns an independent runner in the same state, with copies of
+// the history and variables. It shares the machine and transition index
+// with r, and in random mode the random source too, so clones that will
+// be stepped from different goroutines each need their own SetRandom.
+func (r *Runner) Clone() *Runner {
+	c := &Runner{
+		fsm:           r.fsm,
+		index:         r.index,
+		currentStates: make(map[string]bool, len(r.currentStates)),
+		history:       append(make([]Step, 0, len(r.history)), r.history...),
+		rng:           r.rng,
+		logger:        r.logger,
+		classes:       r.classes,
+		historyLimit:  r.historyLimit,
+		historyStart:  r.historyStart,
+		steps:         r.steps,
+	}
+	if r.vars != nil {
+		c.vars = make(map[string]string, len(r.vars))
+		for k, v := range r.vars {
+			c.vars[k] = v
+		}
+	}
+	for s := range r.currentStates {
+		c.currentStates[s] = true
+	}
+	return c
+}
+
+// SetRandom switches the runner to random mode, in which it follows one
+// path through the machine instead of tracking every possible state. On
+// each step it picks one of the current state's transitions on the input
+// at random, weighted by their probabilities (all equally likely if they
+// have none), and then one of that transition's targets, so the machine
+// runs as a Markov chain. Epsilon transitions are not followed. A nil rng
+// returns the runner to normal mode. The current states are unchanged
+// until the next step or Reset; Reset in random mode starts from the
+// initial state alone.
+func (r *Runner) SetRandom(rng *rand.Rand) {
+	r.rng = rng
+}
+
+// SetLogger sends a trace of the run to l at debug level: each step,
+// with the states before and after, the input and the symbol it was read
+// as, and the output; each input with no transition; and each Reset. A
+// nil l, the default, logs nothing. The logger is copied by Clone.
+func (r *Runner) SetLogger(l *slog.Logger) {
+	r.logger = l
+}
+
 // epsilonClosure computes the epsilon closure of a set of states.
 // Returns all states reachable via epsilon (nil input) transitions.
 func (r *Runner) epsilonClosure(states map[string]bool) map[string]bool {
@@ -57,7 +147,7 @@ func (r *Runner) epsilonClosure(states map[string]bool) map[string]bool {
 	for changed {
 		changed = false
 		for state := range closure {
-			for _, t := range r.fsm.GetEpsilonTransitions(state) {
+			for _, t := range r.index.Epsilon(state) {
 				for _, to := range t.To {
 					if !closure[to] {
 						closure[to] = true
@@ -107,9 +197,12 @@ func (r *Runner) CurrentOutput() string {
 	var outputs []string
 	seen := make(map[string]bool)
 	for state := range r.currentStates {
-		if out, ok := r.fsm.StateOutputs[state]; ok && !seen[out] {
-			seen[out] = true
-			outputs = append(outputs, out)
+		if out, ok := r.fsm.StateOutputs[state]; ok {
+			out = ExpandOutput(out, r.vars)
+			if !seen[out] {
+				seen[out] = true
+				outputs = append(outputs, out)
+			}
 		}
 	}
 
@@ -123,7 +216,7 @@ func (r *Runner) CurrentOutput() string {
 // IsAccepting returns true if any current state is accepting.
 func (r *Runner) IsAccepting() bool {
 	for state := range r.currentStates {
-		if r.fsm.IsAccepting(state) {
+		if r.index.IsAccepting(state) {
 			return true
 		}
 	}
@@ -136,8 +229,8 @@ func (r *Runner) AvailableInputs() []string {
 	var inputs []string
 
 	for state := range r.currentStates {
-		for _, t := range r.fsm.Transitions {
-			if t.From == state && t.Input != nil {
+		for _, t := range r.index.From(state) {
+			if t.Input != nil {
 				if !seen[*t.Input] {
 					seen[*t.Input] = true
 					inputs = append(inputs, *t.Input)
@@ -153,25 +246,49 @@ func (r *Runner) AvailableInputs() []string {
 // Step processes an input and returns the output (if any).
 // For NFA, explores all possible transitions simultaneously.
 // Returns an error if no valid transition exists from any current state.
+// If the machine has input classes (see InputClassPrefix), the input is
+// read as the most specific symbol covering it, and each state falls
+// back to less specific symbols as the classes' rules say.
 func (r *Runner) Step(input string) (output string, err error) {
-	fromStates := r.CurrentStates()
+	return r.step(input, true)
+}
+
+// step is Step, optionally without recording history (see Feed).
+func (r *Runner) step(input string, record bool) (output string, err error) {
+	// With input classes, transitions are on the symbol input is read
+	// as; history records the input itself.
+	symbol := input
+	if r.classes != nil {
+		if sym, ok := r.classes.Classify(input); ok {
+			symbol = sym
+		}
+	}
 
 	// Collect all target states from all current states
 	nextStates := make(map[string]bool)
 	var outputs []string
 	seenOutputs := make(map[string]bool)
 
-	for state := range r.currentStates {
-		transitions := r.fsm.GetTransitions(state, &input)
-		for _, t := range transitions {
-			for _, to := range t.To {
-				nextStates[to] = true
-
-				// Collect Mealy outputs
-				if r.fsm.Type == TypeMealy && t.Output != nil {
-					if !seenOutputs[*t.Output] {
-						seenOutputs[*t.Output] = true
-						outputs = append(outputs, *t.Output)
+	if r.rng != nil {
+		if t, to, ok := r.randomMove(symbol); ok {
+			nextStates[to] = true
+			if r.fsm.Type == TypeMealy && t.Output != nil {
+				outputs = append(outputs, *t.Output)
+			}
+		}
+	} else {
+		for state := range r.currentStates {
+			transitions := r.index.Transitions(state, &symbol)
+			for _, t := range transitions {
+				for _, to := range t.To {
+					nextStates[to] = true
+
+					// Collect Mealy outputs
+					if r.fsm.Type == TypeMealy && t.Output != nil {
+						if !seenOutputs[*t.Output] {
+							seenOutputs[*t.Output] = true
+							outputs = append(outputs, *t.Output)
+						}
 					}
 				}
 			}
@@ -179,11 +296,14 @@ func (r *Runner) Step(input string) (output string, err error) {
 	}
 
 	if len(nextStates) == 0 {
+		if r.logger != nil {
+			r.logger.Debug("no transition", "state", r.CurrentState(), "input", input, "symbol", symbol)
+		}
 		return "", fmt.Errorf("no transition from state %s on input %q", r.CurrentState(), input)
 	}
 
 	// Apply epsilon closure for NFA
-	if r.fsm.Type == TypeNFA {
+	if r.fsm.Type == TypeNFA && r.rng == nil {
 		nextStates = r.epsilonClosure(nextStates)
 	}
 
@@ -200,6 +320,9 @@ func (r *Runner) Step(input string) (output string, err error) {
 	}
 
 	// Format output
+	if len(r.vars) > 0 {
+		outputs = r.expandOutputs(outputs)
+	}
 	sort.Strings(outputs)
 	if len(outputs) == 1 {
 		output = outputs[0]
@@ -208,11 +331,23 @@ func (r *Runner) Step(input string) (output string, err error) {
 	}
 
 	// Update state
+	if !record && r.logger == nil {
+		r.currentStates = nextStates
+		return output, nil
+	}
+	fromStates := r.CurrentStates()
 	r.currentStates = nextStates
 	toStates := r.CurrentStates()
+	if r.logger != nil {
+		r.logger.Debug("step", "from", formatStateSet(fromStates), "input", input, "symbol", symbol,
+			"to", formatStateSet(toStates), "output", output)
+	}
+	if !record {
+		return output, nil
+	}
 
 	// Record step
-	r.history = append(r.history, Step{
+	r.record(Step{
 		FromState:  formatStateSet(fromStates),
 		FromStates: fromStates,
 		Input:      input,
@@ -224,6 +359,44 @@ func (r *Runner) Step(input string) (output string, err error) {
 	return output, nil
 }
 
+// expandOutputs expands output templates with the runner's variables,
+// dropping duplicate expansions.
+func (r *Runner) expandOutputs(outputs []string) []string {
+	expanded := make([]string, 0, len(outputs))
+	seen := make(map[string]bool, len(outputs))
+	for _, out := range outputs {
+		out = ExpandOutput(out, r.vars)
+		if !seen[out] {
+			seen[out] = true
+			expanded = append(expanded, out)
+		}
+	}
+	return expanded
+}
+
+// randomMove picks the transition and target a random-mode step takes
+// on input. If several states are current (SetRandom was called part way
+// through an NFA run), each is equally likely to be the one that moves.
+func (r *Runner) randomMove(input string) (Transition, string, bool) {
+	var candidates []Transition
+	var weights []float64
+	states := r.CurrentStates() // sorted, so a seed gives the same run
+	for _, state := range states {
+		ts := r.index.Transitions(state, &input)
+		for i, w := range transitionWeights(ts) {
+			if w > 0 {
+				candidates = append(candidates, ts[i])
+				weights = append(weights, w/float64(len(states)))
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return Transition{}, "", false
+	}
+	t := candidates[pickWeighted(r.rng, weights)]
+	return t, t.To[r.rng.Intn(len(t.To))], true
+}
+
 // formatStateSet formats a slice of states as a string.
 func formatStateSet(states []string) string {
 	if len(states) == 1 {
@@ -236,15 +409,88 @@ func formatStateSet(states []string) string {
 func (r *Runner) Reset() {
 	r.currentStates = make(map[string]bool)
 	r.currentStates[r.fsm.Initial] = true
-	if r.fsm.Type == TypeNFA {
+	if r.fsm.Type == TypeNFA && r.rng == nil {
 		r.currentStates = r.epsilonClosure(r.currentStates)
 	}
 	r.history = make([]Step, 0)
+	r.historyStart = 0
+	r.steps = 0
+	if r.logger != nil {
+		r.logger.Debug("reset", "state", r.CurrentState())
+	}
+}
+
+// SetHistoryLimit caps the history at the most recent n steps, dropping
+// older ones as new steps are recorded, so that a long-running
+// simulation uses bounded memory. If more steps are kept already, the
+// oldest are dropped now. A limit of 0 or less, the default, keeps every
+// step. The limit survives Reset and is copied by Clone.
+func (r *Runner) SetHistoryLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	h := r.History()
+	if n > 0 && len(h) > n {
+		h = h[len(h)-n:]
+	}
+	r.history = append(make([]Step, 0, len(h)), h...)
+	r.historyStart = 0
+	r.historyLimit = n
+}
+
+// HistoryLimit returns the limit set by SetHistoryLimit, or 0 if the
+// history is unbounded.
+func (r *Runner) HistoryLimit() int {
+	return r.historyLimit
+}
+
+// record adds step to the history, overwriting the oldest step once the
+// history is full.
+func (r *Runner) record(step Step) {
+	r.steps++
+	if r.historyLimit == 0 || len(r.history) < r.historyLimit {
+		r.history = append(r.history, step)
+		return
+	}
+	r.history[r.historyStart] = step
+	r.historyStart = (r.historyStart + 1) % len(r.history)
 }
 
-// History returns the execution history.
+// History returns the execution history, oldest step first. With a
+// history limit, it holds only the most recent steps (see
+// SetHistoryLimit).
 func (r *Runner) History() []Step {
-	return r.history
+	if r.historyStart == 0 {
+		return r.history
+	}
+	h := make([]Step, 0, len(r.history))
+	h = append(h, r.history[r.historyStart:]...)
+	return append(h, r.history[:r.historyStart]...)
+}
+
+// StepCount returns the number of steps recorded since the runner was
+// created or last Reset, including any the history limit has dropped.
+// Steps taken by Feed are not recorded.
+func (r *Runner) StepCount() int {
+	return r.steps
+}
+
+// HistorySince returns the recorded steps numbered i and later, oldest
+// first, where step 0 is the first recorded since the runner was created
+// or last Reset. Steps the history limit has dropped are left out, so
+// the result may start after step i; it is empty if i is StepCount or
+// more. A debugger can poll for new steps by passing the StepCount it
+// saw last time.
+func (r *Runner) HistorySince(i int) []Step {
+	h := r.History()
+	first := r.steps - len(h) // number of the oldest step kept
+	if i < first {
+		i = first
+	}
+	if i >= r.steps {
+		return nil
+	}
+	return h[i-first:]
 }
 
 // Run processes a sequence of inputs and returns all outputs.
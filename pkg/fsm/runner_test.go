@@ -0,0 +1,159 @@
+package fsm
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunner_CloneIsIndependent(t *testing.T) {
+	r, err := NewRunner(redundantDFA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Step("a")
+	c := r.Clone()
+	if c.CurrentState() != "q1" || len(c.History()) != 1 {
+		t.Fatalf("clone state %s with %d steps, want q1 with 1", c.CurrentState(), len(c.History()))
+	}
+	c.Step("b")
+	if r.CurrentState() != "q1" || len(r.History()) != 1 {
+		t.Errorf("stepping the clone changed the original: %s, %d steps", r.CurrentState(), len(r.History()))
+	}
+}
+
+// inputsOf returns the inputs of steps, in order.
+func inputsOf(steps []Step) string {
+	s := ""
+	for _, st := range steps {
+		s += st.Input
+	}
+	return s
+}
+
+func TestRunner_HistoryLimit(t *testing.T) {
+	r, err := NewRunner(redundantDFA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetHistoryLimit(3)
+	for _, in := range "abaab" {
+		if _, err := r.Step(string(in)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := inputsOf(r.History()); got != "aab" {
+		t.Errorf("history %q, want the last three steps \"aab\"", got)
+	}
+	if r.StepCount() != 5 {
+		t.Errorf("StepCount = %d, want 5", r.StepCount())
+	}
+	for i, want := range []string{"aab", "aab", "aab", "ab", "b", ""} {
+		if got := inputsOf(r.HistorySince(i)); got != want {
+			t.Errorf("HistorySince(%d) = %q, want %q", i, got, want)
+		}
+	}
+
+	c := r.Clone()
+	c.Step("a")
+	if got := inputsOf(c.History()); got != "aba" || c.HistoryLimit() != 3 {
+		t.Errorf("clone history %q with limit %d, want \"aba\" with 3", got, c.HistoryLimit())
+	}
+	if got := inputsOf(r.History()); got != "aab" {
+		t.Errorf("stepping the clone changed the original's history to %q", got)
+	}
+
+	r.SetHistoryLimit(2)
+	if got := inputsOf(r.History()); got != "ab" {
+		t.Errorf("after lowering the limit, history %q, want \"ab\"", got)
+	}
+	r.SetHistoryLimit(0)
+	r.Step("a")
+	r.Step("a")
+	if got := inputsOf(r.History()); got != "abaa" {
+		t.Errorf("unbounded history %q, want \"abaa\"", got)
+	}
+
+	r.Reset()
+	if len(r.History()) != 0 || r.StepCount() != 0 || r.HistorySince(0) != nil {
+		t.Errorf("after Reset: %d steps kept, StepCount %d", len(r.History()), r.StepCount())
+	}
+}
+
+// TestRunner_ConcurrentClones is meant to be run with -race.
+func TestRunner_ConcurrentClones(t *testing.T) {
+	f, err := Random(RandomOptions{States: 50, Alphabet: 3, Density: 1, Type: TypeMealy, Seed: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCompiledRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := make([]string, 500)
+	for i := range inputs {
+		inputs[i] = f.Alphabet[i%len(f.Alphabet)]
+	}
+	want := r.Clone().Feed(inputs)
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 16)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got := r.Clone().Feed(inputs)
+			if got.Consumed != want.Consumed || got.States[0] != want.States[0] {
+				errs <- "Runner clone diverged"
+			}
+			cc := c.Clone()
+			cc.Run(cc.InputIDs(inputs))
+			if cc.StateName() != want.States[0] {
+				errs <- "CompiledRunner clone diverged"
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+}
+
+func TestRunner_SetLogger(t *testing.T) {
+	r, err := NewRunner(redundantDFA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	r.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	r.Step("a")
+	r.Step("x")
+	r.Feed([]string{"b"})
+	c := r.Clone()
+	c.Reset()
+	got := buf.String()
+	for _, want := range []string{
+		"msg=step from=q0 input=a symbol=a to=q1",
+		`msg="no transition" state=q1 input=x`,
+		"msg=step from=q1 input=b symbol=b to=q0",
+		"msg=reset state=q0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log lacks %q:\n%s", want, got)
+		}
+	}
+
+	buf.Reset()
+	r.SetLogger(nil)
+	r.Step("a")
+	if buf.Len() != 0 {
+		t.Errorf("nil logger logged %q", buf.String())
+	}
+}
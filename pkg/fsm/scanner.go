@@ -0,0 +1,173 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScannerRule is one token of a scanner: the acceptor that recognises
+// it, a DFA or NFA over characters, and the token's name.
+type ScannerRule struct {
+	Token   string
+	Machine *FSM
+}
+
+// BuildScanner combines acceptors into one scanner, as a lexer generator
+// does: a minimal Moore machine that reads text one character at a time
+// and whose accepting states output the token they recognise. Where the
+// text read so far is accepted by several rules, the token is that of
+// the first; a rule wholly shadowed by earlier ones outputs nothing, and
+// its token is left out of the output alphabet. A generated next_token
+// function (see fsm generate --mode scanner) steps the scanner for as
+// long as it can and returns the token of the last accepting state
+// passed, so the longest match wins.
+//
+// The rules' alphabets and input classes are merged, so they must agree
+// on what each class contains, and classes from different rules must be
+// disjoint or nested. It is an error for a token to match the empty
+// string, since a scanner could then make no progress.
+func BuildScanner(rules []ScannerRule) (*FSM, error) {
+	return BuildScannerContext(context.Background(), rules)
+}
+
+// BuildScannerContext is BuildScanner, stopping with ctx's error if ctx
+// is done first, as it may be while determinising many large rules.
+func BuildScannerContext(ctx context.Context, rules []ScannerRule) (*FSM, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("a scanner needs at least one rule")
+	}
+
+	// The rules' union, as an NFA with an epsilon transition from a new
+	// initial state to each rule's. Rule i's state k is named "i:k", so
+	// that the names survive ToDFA's comma-separated subsets.
+	nfa := New(TypeNFA)
+	nfa.Name = "scanner"
+	nfa.AddState("start")
+	nfa.SetInitial("start")
+	ruleOf := make(map[string]int)
+	seen := make(map[string]bool)
+	for i, r := range rules {
+		if r.Token == "" {
+			return nil, fmt.Errorf("rule %d has no token", i+1)
+		}
+		if seen[r.Token] {
+			return nil, fmt.Errorf("token %q has two rules", r.Token)
+		}
+		seen[r.Token] = true
+		m := r.Machine
+		if m == nil {
+			return nil, fmt.Errorf("token %q has no machine", r.Token)
+		}
+		if m.Type != TypeDFA && m.Type != TypeNFA {
+			return nil, fmt.Errorf("token %q: a %s is not an acceptor", r.Token, m.Type)
+		}
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("token %q: %w", r.Token, err)
+		}
+
+		name := make(map[string]string, len(m.States))
+		for k, s := range m.States {
+			name[s] = strconv.Itoa(i) + ":" + strconv.Itoa(k)
+			nfa.AddState(name[s])
+			ruleOf[name[s]] = i
+		}
+		for _, in := range m.Alphabet {
+			nfa.AddInput(in)
+		}
+		for k, v := range inputClassMetadata(m) {
+			if old, ok := nfa.Metadata[k]; ok && old != v {
+				return nil, fmt.Errorf("token %q: input class %q is %s, but %s in an earlier rule",
+					r.Token, strings.TrimPrefix(k, InputClassPrefix), v, old)
+			}
+			if nfa.Metadata == nil {
+				nfa.Metadata = make(map[string]string)
+			}
+			nfa.Metadata[k] = v
+		}
+		for _, t := range m.Transitions {
+			to := make([]string, len(t.To))
+			for j, s := range t.To {
+				to[j] = name[s]
+			}
+			nfa.AddTransition(name[t.From], t.Input, to, nil)
+		}
+		nfa.AddTransition("start", nil, []string{name[m.Initial]}, nil)
+		for _, s := range m.Accepting {
+			nfa.Accepting = append(nfa.Accepting, name[s])
+		}
+	}
+	if _, err := nfa.InputClasses(); err != nil {
+		return nil, fmt.Errorf("merged input classes: %w", err)
+	}
+
+	dfa, err := nfa.ToDFAContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Label each accepting state with its first rule's token, and give
+	// the states short names in the order ToDFA found them.
+	scanner := New(TypeMoore)
+	scanner.Name = "scanner"
+	scanner.Alphabet = dfa.Alphabet
+	scanner.Metadata = dfa.Metadata
+	rename := make(map[string]string, len(dfa.States))
+	used := make([]bool, len(rules))
+	for k, s := range dfa.States {
+		rename[s] = "s" + strconv.Itoa(k)
+		scanner.AddState(rename[s])
+		if !dfa.IsAccepting(s) {
+			continue
+		}
+		first := len(rules)
+		for _, member := range strings.Split(s, ",") {
+			if i, ok := ruleOf[member]; ok && i < first && nfa.IsAccepting(member) {
+				first = i
+			}
+		}
+		if s == dfa.Initial {
+			return nil, fmt.Errorf("token %q matches the empty string", rules[first].Token)
+		}
+		used[first] = true
+		scanner.Accepting = append(scanner.Accepting, rename[s])
+		scanner.SetStateOutput(rename[s], rules[first].Token)
+	}
+	for i, r := range rules {
+		if used[i] {
+			scanner.AddOutput(r.Token)
+		}
+	}
+	scanner.SetInitial(rename[dfa.Initial])
+	for _, t := range dfa.Transitions {
+		scanner.AddTransition(rename[t.From], t.Input, []string{rename[t.To[0]]}, nil)
+	}
+	return scanner.MinimizeContext(ctx)
+}
+
+// ValidateScanner reports whether f can be used as a scanner by a
+// generated next_token function: a Moore machine whose accepting states,
+// and only those, output a token, and whose initial state is not
+// accepting. BuildScanner's machines are.
+func (f *FSM) ValidateScanner() error {
+	if f.Type != TypeMoore {
+		return fmt.Errorf("a scanner is a Moore machine, not a %s", f.Type)
+	}
+	if len(f.Accepting) == 0 {
+		return fmt.Errorf("no state is accepting, so there are no tokens")
+	}
+	if f.IsAccepting(f.Initial) {
+		return fmt.Errorf("initial state %q is accepting, so a token could be empty", f.Initial)
+	}
+	for _, s := range f.States {
+		_, labelled := f.StateOutputs[s]
+		switch {
+		case f.IsAccepting(s) && !labelled:
+			return fmt.Errorf("accepting state %q outputs no token", s)
+		case !f.IsAccepting(s) && labelled:
+			return fmt.Errorf("state %q outputs a token but is not accepting", s)
+		}
+	}
+	return nil
+}
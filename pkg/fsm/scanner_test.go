@@ -0,0 +1,176 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+)
+
+// keywordFSM accepts the single word w, one character per input.
+func keywordFSM(w string) *FSM {
+	f := New(TypeDFA)
+	f.AddState("k0")
+	f.SetInitial("k0")
+	for i, c := range w {
+		from, to := "k"+string(rune('0'+i)), "k"+string(rune('1'+i))
+		f.AddState(to)
+		f.AddInput(string(c))
+		f.AddTransition(from, strp(string(c)), []string{to}, nil)
+	}
+	f.SetAccepting([]string{f.States[len(f.States)-1]})
+	return f
+}
+
+// classFSM accepts one character of first followed by any number of
+// rest, with the classes given.
+func classFSM(first, rest string, classes map[string]string) *FSM {
+	f := New(TypeDFA)
+	f.AddState("a")
+	f.AddState("b")
+	f.AddInput(first)
+	if rest != first {
+		f.AddInput(rest)
+	}
+	f.Metadata = make(map[string]string)
+	for sym, pattern := range classes {
+		f.Metadata[InputClassPrefix+sym] = pattern
+	}
+	f.SetInitial("a")
+	f.SetAccepting([]string{"b"})
+	f.AddTransition("a", strp(first), []string{"b"}, nil)
+	f.AddTransition("b", strp(rest), []string{"b"}, nil)
+	return f
+}
+
+func scannerRules() []ScannerRule {
+	return []ScannerRule{
+		{"if", keywordFSM("if")},
+		{"ident", classFSM("letter", "alnum", map[string]string{"letter": "[a-z]", "alnum": "[a-z0-9]"})},
+		{"number", classFSM("digit", "digit", map[string]string{"digit": "[0-9]"})},
+		{"space", classFSM("blank", "blank", map[string]string{"blank": `[ \t\n]`})},
+	}
+}
+
+// nextToken steps r through text, longest match first, as a generated
+// next_token function does.
+func nextToken(t *testing.T, r *Runner, text string) (token string, n int) {
+	t.Helper()
+	r.Reset()
+	for i, c := range text {
+		if _, err := r.Step(string(c)); err != nil {
+			break
+		}
+		if r.IsAccepting() {
+			token, n = r.CurrentOutput(), i+len(string(c))
+		}
+	}
+	return token, n
+}
+
+func TestBuildScanner(t *testing.T) {
+	s, err := BuildScanner(scannerRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ValidateScanner(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.OutputAlphabet, " "); got != "if ident number space" {
+		t.Errorf("tokens %q, want if ident number space", got)
+	}
+
+	r, err := NewRunner(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		text  string
+		token string
+		n     int
+	}{
+		{"if", "if", 2},
+		{"if(", "if", 2},
+		{"iffy", "ident", 4},
+		{"i", "ident", 1},
+		{"x1 = 2", "ident", 2},
+		{"42a", "number", 2},
+		{" \t\nif", "space", 3},
+		{"+1", "", 0},
+	} {
+		token, n := nextToken(t, r, tc.text)
+		if token != tc.token || n != tc.n {
+			t.Errorf("%q: %q of %d bytes, want %q of %d", tc.text, token, n, tc.token, tc.n)
+		}
+	}
+}
+
+func TestBuildScanner_Priority(t *testing.T) {
+	// ident before if: the keyword is wholly shadowed.
+	rules := scannerRules()
+	rules[0], rules[1] = rules[1], rules[0]
+	s, err := BuildScanner(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range s.OutputAlphabet {
+		if tok == "if" {
+			t.Error("a shadowed token is in the output alphabet")
+		}
+	}
+	r, _ := NewRunner(s)
+	if token, _ := nextToken(t, r, "if"); token != "ident" {
+		t.Errorf("if read as %q, want ident", token)
+	}
+}
+
+func TestBuildScanner_Errors(t *testing.T) {
+	empty := New(TypeDFA)
+	empty.AddState("s")
+	empty.SetInitial("s")
+	empty.SetAccepting([]string{"s"})
+
+	moore := New(TypeMoore)
+	moore.AddState("s")
+	moore.SetInitial("s")
+
+	for _, tc := range []struct {
+		name  string
+		rules []ScannerRule
+		want  string
+	}{
+		{"none", nil, "at least one"},
+		{"duplicate", []ScannerRule{{"a", keywordFSM("a")}, {"a", keywordFSM("b")}}, "two rules"},
+		{"empty match", []ScannerRule{{"a", keywordFSM("a")}, {"nothing", empty}}, `"nothing" matches the empty string`},
+		{"not an acceptor", []ScannerRule{{"m", moore}}, "not an acceptor"},
+		{"class conflict", []ScannerRule{
+			{"a", classFSM("d", "d", map[string]string{"d": "[0-9]"})},
+			{"b", classFSM("d", "d", map[string]string{"d": "[0-7]"})},
+		}, `input class "d"`},
+		{"overlapping classes", []ScannerRule{
+			{"a", classFSM("x", "x", map[string]string{"x": "[a-m]"})},
+			{"b", classFSM("y", "y", map[string]string{"y": "[h-z]"})},
+		}, "input classes"},
+	} {
+		_, err := BuildScanner(tc.rules)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestValidateScanner(t *testing.T) {
+	s, err := BuildScanner(scannerRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlabelled := s.Clone()
+	delete(unlabelled.StateOutputs, unlabelled.Accepting[0])
+	if err := unlabelled.ValidateScanner(); err == nil {
+		t.Error("an accepting state without a token was accepted")
+	}
+	if err := redundantDFA().ValidateScanner(); err == nil {
+		t.Error("a DFA was accepted as a scanner")
+	}
+}
@@ -0,0 +1,227 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+)
+
+// SimulateOptions controls Simulate.
+type SimulateOptions struct {
+	Walks     int    // number of random walks (default 1000)
+	MaxLen    int    // transitions per walk before it is cut off (default 50)
+	Seed      int64  // random seed; the same options always give the same result
+	WeightKey string // transition metadata key holding a weight (default "probability")
+
+	// Logger, if set, is sent each step of each walk, and how each walk
+	// ended, at debug level.
+	Logger *slog.Logger
+}
+
+// SimulationResult summarises the random walks of Simulate.
+type SimulationResult struct {
+	Walks  int   `json:"walks"`
+	MaxLen int   `json:"max_len"`
+	Seed   int64 `json:"seed"`
+
+	// States has an entry for every state, in the machine's order.
+	States []StateVisits `json:"states"`
+
+	Absorbed  int `json:"absorbed"`  // walks that ended in an absorbing state
+	Truncated int `json:"truncated"` // walks cut off at MaxLen
+	Accepted  int `json:"accepted"`  // walks that ended in an accepting state
+
+	MeanLength           float64 `json:"mean_length"`            // transitions per walk
+	MeanAbsorptionLength float64 `json:"mean_absorption_length"` // transitions per absorbed walk
+}
+
+// StateVisits is one state's share of a simulation.
+type StateVisits struct {
+	State     string  `json:"state"`
+	Visits    int     `json:"visits"`    // times a walk was in the state, counting starts
+	Frequency float64 `json:"frequency"` // Visits as a fraction of all visits
+
+	// Absorbing states have no transition to any other state, so a walk
+	// that reaches one ends there.
+	Absorbing  bool    `json:"absorbing"`
+	Absorbed   int     `json:"absorbed"`   // walks that ended here
+	Absorption float64 `json:"absorption"` // Absorbed as a fraction of all walks
+}
+
+// simMove is one possible step of a walk.
+type simMove struct {
+	to     string
+	weight float64
+}
+
+// Simulate runs random walks from the initial state and counts where they
+// go. At each step a walk follows one of the current state's transitions
+// at random, in proportion to their weights: the transition's
+// Probability if it has one, else the number in its WeightKey metadata,
+// else 1. An NFA transition
+// with several targets shares its weight among them, and epsilon
+// transitions are steps like any other. A walk ends when it reaches an
+// absorbing state (one with no transition to another state), or after
+// MaxLen transitions.
+//
+// Simulate is a sanity check for protocol machines: which states are
+// busy, where runs end up, and how long they take. Input symbols play no
+// part, so for an input-driven machine the walks model uniformly random
+// input.
+func Simulate(f *FSM, opts SimulateOptions) (SimulationResult, error) {
+	return SimulateContext(context.Background(), f, opts)
+}
+
+// SimulateContext is Simulate, stopping with ctx's error if ctx is done
+// before the walks are.
+func SimulateContext(ctx context.Context, f *FSM, opts SimulateOptions) (SimulationResult, error) {
+	if opts.Walks == 0 {
+		opts.Walks = 1000
+	}
+	if opts.MaxLen == 0 {
+		opts.MaxLen = 50
+	}
+	if opts.WeightKey == "" {
+		opts.WeightKey = "probability"
+	}
+	switch {
+	case opts.Walks < 0:
+		return SimulationResult{}, fmt.Errorf("walks must be positive, got %d", opts.Walks)
+	case opts.MaxLen < 0:
+		return SimulationResult{}, fmt.Errorf("max length must be positive, got %d", opts.MaxLen)
+	case f.Initial == "":
+		return SimulationResult{}, fmt.Errorf("machine has no initial state")
+	}
+
+	moves := make(map[string][]simMove)
+	for _, t := range f.Transitions {
+		if len(t.To) == 0 {
+			continue
+		}
+		weight := 1.0
+		if t.Probability != nil {
+			weight = *t.Probability
+		} else if s, ok := t.Metadata[opts.WeightKey]; ok {
+			w, err := strconv.ParseFloat(s, 64)
+			if err != nil || w < 0 {
+				return SimulationResult{}, fmt.Errorf("transition %s: %s %q is not a non-negative number", t.From, opts.WeightKey, s)
+			}
+			weight = w
+		}
+		for _, to := range t.To {
+			moves[t.From] = append(moves[t.From], simMove{to, weight / float64(len(t.To))})
+		}
+	}
+	absorbing := map[string]bool{f.Initial: true}
+	for _, s := range f.States {
+		absorbing[s] = true
+	}
+	for _, t := range f.Transitions {
+		for _, to := range t.To {
+			absorbing[to] = true // targets missing from f.States too
+		}
+	}
+	for s := range absorbing {
+		for _, m := range moves[s] {
+			if m.to != s && m.weight > 0 {
+				absorbing[s] = false
+				break
+			}
+		}
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	visits := make(map[string]int)
+	absorbed := make(map[string]int)
+	res := SimulationResult{Walks: opts.Walks, MaxLen: opts.MaxLen, Seed: opts.Seed}
+	totalLen, absorbedLen := 0, 0
+	debug := opts.Logger != nil && opts.Logger.Enabled(ctx, slog.LevelDebug)
+	for w := 0; w < opts.Walks; w++ {
+		if err := ctx.Err(); err != nil {
+			return SimulationResult{}, err
+		}
+		state := f.Initial
+		visits[state]++
+		steps := 0
+		for !absorbing[state] && steps < opts.MaxLen {
+			from := state
+			state = pickMove(rng, moves[state])
+			visits[state]++
+			steps++
+			if debug {
+				opts.Logger.DebugContext(ctx, "simulate step", "walk", w, "step", steps, "from", from, "to", state)
+			}
+		}
+		if debug {
+			opts.Logger.DebugContext(ctx, "simulate walk", "walk", w, "steps", steps, "end", state, "absorbed", absorbing[state])
+		}
+		totalLen += steps
+		if absorbing[state] {
+			absorbed[state]++
+			res.Absorbed++
+			absorbedLen += steps
+		} else {
+			res.Truncated++
+		}
+		if f.IsAccepting(state) {
+			res.Accepted++
+		}
+	}
+
+	allVisits := 0
+	for _, n := range visits {
+		allVisits += n
+	}
+	for _, s := range f.States {
+		sv := StateVisits{State: s, Visits: visits[s], Absorbing: absorbing[s], Absorbed: absorbed[s]}
+		if allVisits > 0 {
+			sv.Frequency = float64(sv.Visits) / float64(allVisits)
+		}
+		if opts.Walks > 0 {
+			sv.Absorption = float64(sv.Absorbed) / float64(opts.Walks)
+		}
+		res.States = append(res.States, sv)
+	}
+	if opts.Walks > 0 {
+		res.MeanLength = float64(totalLen) / float64(opts.Walks)
+	}
+	if res.Absorbed > 0 {
+		res.MeanAbsorptionLength = float64(absorbedLen) / float64(res.Absorbed)
+	}
+	return res, nil
+}
+
+// pickMove chooses one of moves at random in proportion to its weight.
+// The moves of a non-absorbing state always have some weight.
+func pickMove(rng *rand.Rand, moves []simMove) string {
+	weights := make([]float64, len(moves))
+	for i, m := range moves {
+		weights[i] = m.weight
+	}
+	return moves[pickWeighted(rng, weights)].to
+}
+
+// pickWeighted chooses an index of weights at random in proportion to
+// its weight. At least one weight must be positive.
+func pickWeighted(rng *rand.Rand, weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	// Rounding can leave r just past the last weight.
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
@@ -0,0 +1,138 @@
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// coinFSM starts in "flip", which goes to "heads" or "tails"; "heads" is
+// absorbing and "tails" goes back to "flip".
+func coinFSM() *FSM {
+	f := New(TypeNFA)
+	f.States = []string{"flip", "heads", "tails"}
+	f.Initial = "flip"
+	f.Alphabet = []string{"go"}
+	f.Accepting = []string{"heads"}
+	in := "go"
+	f.AddTransition("flip", &in, []string{"heads", "tails"}, nil)
+	f.AddTransition("tails", &in, []string{"flip"}, nil)
+	return f
+}
+
+func TestSimulate_FairCoin(t *testing.T) {
+	res, err := Simulate(coinFSM(), SimulateOptions{Walks: 20000, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Absorbed+res.Truncated != 20000 {
+		t.Errorf("absorbed %d + truncated %d != walks", res.Absorbed, res.Truncated)
+	}
+	heads := res.States[1]
+	if !heads.Absorbing || res.States[0].Absorbing || res.States[2].Absorbing {
+		t.Errorf("absorbing states wrong: %+v", res.States)
+	}
+	if heads.Absorption < 0.99 || res.Accepted != heads.Absorbed {
+		t.Errorf("heads absorbed %.3f of walks, accepted %d", heads.Absorption, res.Accepted)
+	}
+	// Flips until heads are geometric with p = 1/2: two flips on
+	// average, each after the first preceded by a step back from tails.
+	if math.Abs(res.MeanAbsorptionLength-3) > 0.1 {
+		t.Errorf("mean absorption length %.3f, want about 3", res.MeanAbsorptionLength)
+	}
+	sum := 0.0
+	for _, s := range res.States {
+		sum += s.Frequency
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("frequencies sum to %v", sum)
+	}
+}
+
+func TestSimulate_WeightsFromMetadata(t *testing.T) {
+	f := New(TypeDFA)
+	f.States = []string{"s", "a", "b"}
+	f.Initial = "s"
+	f.Alphabet = []string{"x", "y"}
+	x, y := "x", "y"
+	f.AddTransition("s", &x, []string{"a"}, nil)
+	f.AddTransition("s", &y, []string{"b"}, nil)
+	f.Transitions[0].Metadata = map[string]string{"p": "0.9"}
+	f.Transitions[1].Metadata = map[string]string{"p": "0.1"}
+	res, err := Simulate(f, SimulateOptions{Walks: 10000, Seed: 7, WeightKey: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := res.States[1].Absorption; math.Abs(a-0.9) > 0.02 {
+		t.Errorf("a absorbed %.3f of walks, want about 0.9", a)
+	}
+
+	f.Transitions[1].Metadata["p"] = "lots"
+	if _, err := Simulate(f, SimulateOptions{WeightKey: "p"}); err == nil {
+		t.Error("non-numeric weight accepted")
+	}
+}
+
+func TestSimulate_TruncatedAndDeterministic(t *testing.T) {
+	// A two-state cycle never absorbs.
+	f := New(TypeDFA)
+	f.States = []string{"a", "b"}
+	f.Initial = "a"
+	in := "x"
+	f.AddTransition("a", &in, []string{"b"}, nil)
+	f.AddTransition("b", &in, []string{"a"}, nil)
+	res, err := Simulate(f, SimulateOptions{Walks: 10, MaxLen: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Truncated != 10 || res.MeanLength != 7 || res.MeanAbsorptionLength != 0 {
+		t.Errorf("got %+v", res)
+	}
+	if res.States[0].Visits != 40 || res.States[1].Visits != 40 {
+		t.Errorf("visits %d, %d; want 40 each", res.States[0].Visits, res.States[1].Visits)
+	}
+
+	r, _ := Random(RandomOptions{States: 40, Type: TypeNFA, Seed: 3})
+	a, _ := Simulate(r, SimulateOptions{Seed: 5})
+	b, _ := Simulate(r, SimulateOptions{Seed: 5})
+	if !reflect.DeepEqual(a, b) {
+		t.Error("same seed gave different results")
+	}
+
+	if _, err := Simulate(New(TypeDFA), SimulateOptions{}); err == nil {
+		t.Error("machine without an initial state accepted")
+	}
+}
+
+func TestSimulateContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := SimulateContext(ctx, coinFSM(), SimulateOptions{Seed: 1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestSimulate_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	res, err := Simulate(coinFSM(), SimulateOptions{Walks: 3, Seed: 1, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), `msg="simulate walk"`); n != 3 {
+		t.Errorf("%d walk lines, want 3:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), `msg="simulate step" walk=0 step=1 from=flip`) {
+		t.Errorf("no first step:\n%s", buf.String())
+	}
+	// Logging does not change the walks.
+	plain, _ := Simulate(coinFSM(), SimulateOptions{Walks: 3, Seed: 1})
+	if !reflect.DeepEqual(res, plain) {
+		t.Error("result differs with a logger")
+	}
+}
@@ -0,0 +1,82 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// snapshotVersion is the format version written by Runner.Snapshot.
+const snapshotVersion = 1
+
+// runnerSnapshot is the JSON form of a Runner's execution state.
+type runnerSnapshot struct {
+	Version      int      `json:"version"`
+	Fingerprint  string   `json:"fingerprint"` // of the machine, see FSM.Fingerprint
+	States       []string `json:"states"`
+	History      []Step   `json:"history"` // oldest first
+	HistoryLimit int      `json:"history_limit,omitempty"`
+	Steps        int      `json:"steps"`
+
+	Vars map[string]string `json:"vars,omitempty"` // see Runner.SetVar
+}
+
+// Snapshot returns the runner's execution state as JSON: its current
+// states, its history with the history limit and step count, its
+// variables (see SetVar), and the fingerprint of its machine (see
+// FSM.Fingerprint). A service can store the snapshot and continue the
+// run after a restart with RestoreRunner.
+// Random mode is not part of the snapshot, since a random source cannot
+// be saved; call SetRandom again on the restored runner.
+func (r *Runner) Snapshot() ([]byte, error) {
+	history := r.History()
+	if history == nil {
+		history = []Step{}
+	}
+	return json.Marshal(runnerSnapshot{
+		Version:      snapshotVersion,
+		Fingerprint:  r.fsm.Fingerprint(),
+		States:       r.CurrentStates(),
+		History:      history,
+		HistoryLimit: r.historyLimit,
+		Steps:        r.steps,
+		Vars:         r.vars,
+	})
+}
+
+// RestoreRunner creates a runner for f in the execution state saved by
+// Runner.Snapshot. It is an error if data is not a snapshot, or if f is
+// not the machine the snapshot was taken from, as its fingerprint shows:
+// a model that has changed since may not have the saved states, or may
+// give them different transitions.
+func RestoreRunner(f *FSM, data []byte) (*Runner, error) {
+	var snap runnerSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("invalid runner snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported runner snapshot version %d", snap.Version)
+	}
+	if snap.Fingerprint != f.Fingerprint() {
+		return nil, fmt.Errorf("runner snapshot was taken from a different machine (fingerprint %.12s, machine %.12s)", snap.Fingerprint, f.Fingerprint())
+	}
+	if len(snap.States) == 0 {
+		return nil, fmt.Errorf("runner snapshot has no current states")
+	}
+
+	r, err := NewRunner(f)
+	if err != nil {
+		return nil, err
+	}
+	r.currentStates = make(map[string]bool, len(snap.States))
+	for _, s := range snap.States {
+		if !f.HasState(s) {
+			return nil, fmt.Errorf("runner snapshot has unknown state %q", s)
+		}
+		r.currentStates[s] = true
+	}
+	r.history = append(make([]Step, 0, len(snap.History)), snap.History...)
+	r.steps = snap.Steps
+	r.vars = snap.Vars
+	r.SetHistoryLimit(snap.HistoryLimit)
+	return r, nil
+}
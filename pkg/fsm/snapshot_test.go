@@ -0,0 +1,99 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunnerSnapshot_RoundTrip(t *testing.T) {
+	f := symbolsFSM()
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetHistoryLimit(2)
+	r.SetVar("user", "ada")
+	for _, in := range []string{"tick", "tock", "reset", "tick"} {
+		if _, err := r.Step(in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A machine loaded afresh has the same fingerprint.
+	got, err := RestoreRunner(symbolsFSM(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CurrentState() != "busy" {
+		t.Errorf("restored state %s, want busy", got.CurrentState())
+	}
+	if !reflect.DeepEqual(got.History(), r.History()) {
+		t.Errorf("restored history %v, want %v", got.History(), r.History())
+	}
+	if v, _ := got.Var("user"); v != "ada" {
+		t.Errorf("restored variable user = %q, want ada", v)
+	}
+	if got.StepCount() != 4 || got.HistoryLimit() != 2 {
+		t.Errorf("restored StepCount %d, limit %d; want 4, 2", got.StepCount(), got.HistoryLimit())
+	}
+	if out, err := got.Step("reset"); err != nil || out != "none" || got.CurrentState() != "idle" {
+		t.Errorf("restored runner stepped to %s with output %q, %v", got.CurrentState(), out, err)
+	}
+}
+
+func TestRunnerSnapshot_NFA(t *testing.T) {
+	f := New(TypeNFA)
+	for _, s := range []string{"a", "b", "c"} {
+		f.AddState(s)
+	}
+	f.AddInput("x")
+	f.SetInitial("a")
+	f.AddTransition("a", strp("x"), []string{"b", "c"}, nil)
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Step("x")
+	data, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RestoreRunner(f, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(got.CurrentStates(), want) {
+		t.Errorf("restored states %v, want %v", got.CurrentStates(), want)
+	}
+}
+
+func TestRestoreRunner_Errors(t *testing.T) {
+	r, err := NewRunner(symbolsFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := symbolsFSM()
+	changed.Transitions[0].To = []string{"idle"}
+	if _, err := RestoreRunner(changed, data); err == nil {
+		t.Error("restored a snapshot into a changed machine")
+	}
+	for name, bad := range map[string]string{
+		"not json":  "snapshot",
+		"version":   `{"version": 99}`,
+		"no states": `{"version": 1, "fingerprint": "` + symbolsFSM().Fingerprint() + `", "states": []}`,
+		"unknown":   `{"version": 1, "fingerprint": "` + symbolsFSM().Fingerprint() + `", "states": ["gone"]}`,
+	} {
+		if _, err := RestoreRunner(symbolsFSM(), []byte(bad)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package fsm
+
+// Stats summarises the size and structural complexity of a machine.
+// It is intended for dashboards and CI reports that track how a model
+// grows over time; see ComputeStats.
+type Stats struct {
+	States      int `json:"states"`
+	Transitions int `json:"transitions"`
+	Edges       int `json:"edges"` // transition targets; an NFA transition to n states counts n
+	Inputs      int `json:"inputs"`
+	Outputs     int `json:"outputs"`
+	Accepting   int `json:"accepting"`
+	Epsilon     int `json:"epsilon"` // epsilon transitions
+
+	// Determinism is the percentage of (state, input) pairs with any
+	// transition that lead to exactly one target. A DFA scores 100.
+	// Epsilon moves count as a non-deterministic pair.
+	Determinism float64 `json:"determinism"`
+
+	// Completeness is the percentage of all (state, input) pairs that
+	// have at least one transition.
+	Completeness float64 `json:"completeness"`
+
+	MaxFanOut      int    `json:"max_fan_out"` // most distinct successors of one state
+	MaxFanOutState string `json:"max_fan_out_state,omitempty"`
+	MaxFanIn       int    `json:"max_fan_in"` // most distinct predecessors of one state
+	MaxFanInState  string `json:"max_fan_in_state,omitempty"`
+
+	Reachable  int `json:"reachable"`   // states reachable from the initial state
+	Diameter   int `json:"diameter"`    // longest shortest path between any two connected states
+	SCCs       int `json:"sccs"`        // strongly connected components
+	LargestSCC int `json:"largest_scc"` // states in the largest component
+	Components int `json:"components"`  // weakly connected components
+
+	// Cyclomatic is McCabe's complexity E - N + 2P over the state graph,
+	// with parallel arcs between the same pair of states collapsed.
+	Cyclomatic int `json:"cyclomatic"`
+}
+
+// ComputeStats returns size and complexity metrics for f. The diameter
+// is found by a breadth-first search from every state, so the cost is
+// O(N·(N+E)); this is fine for machines of a few thousand states.
+func (f *FSM) ComputeStats() Stats {
+	s := Stats{
+		States:      len(f.States),
+		Transitions: len(f.Transitions),
+		Inputs:      len(f.Alphabet),
+		Outputs:     len(f.OutputAlphabet),
+		Accepting:   len(f.Accepting),
+	}
+
+	// Distinct successor sets, and targets per (state, input) pair.
+	succ := make(map[string]map[string]bool)
+	adj := make(map[string][]string) // succ in transition order, for stable traversal
+	pred := make(map[string]map[string]bool)
+	targets := make(map[string]map[string]int)
+	for _, t := range f.Transitions {
+		s.Edges += len(t.To)
+		key := "\x00epsilon"
+		if t.Input != nil {
+			key = *t.Input
+		} else {
+			s.Epsilon++
+		}
+		if targets[t.From] == nil {
+			targets[t.From] = make(map[string]int)
+		}
+		targets[t.From][key] += len(t.To)
+		for _, to := range t.To {
+			if succ[t.From] == nil {
+				succ[t.From] = make(map[string]bool)
+			}
+			if !succ[t.From][to] {
+				succ[t.From][to] = true
+				adj[t.From] = append(adj[t.From], to)
+			}
+			if pred[to] == nil {
+				pred[to] = make(map[string]bool)
+			}
+			pred[to][t.From] = true
+		}
+	}
+
+	pairs, deterministic, covered := 0, 0, 0
+	for _, inputs := range targets {
+		for key, n := range inputs {
+			pairs++
+			if n == 1 && key != "\x00epsilon" {
+				deterministic++
+			}
+			if key != "\x00epsilon" {
+				covered++
+			}
+		}
+	}
+	if pairs > 0 {
+		s.Determinism = percent(deterministic, pairs)
+	} else {
+		s.Determinism = 100
+	}
+	if total := len(f.States) * len(f.Alphabet); total > 0 {
+		s.Completeness = percent(covered, total)
+	}
+
+	arcs := 0
+	for _, st := range f.States {
+		if n := len(succ[st]); n > s.MaxFanOut {
+			s.MaxFanOut, s.MaxFanOutState = n, st
+		}
+		if n := len(pred[st]); n > s.MaxFanIn {
+			s.MaxFanIn, s.MaxFanInState = n, st
+		}
+		arcs += len(succ[st])
+	}
+
+	if f.Initial != "" {
+		s.Reachable = len(bfsDistances(adj, f.Initial))
+	}
+	for _, st := range f.States {
+		for _, d := range bfsDistances(adj, st) {
+			if d > s.Diameter {
+				s.Diameter = d
+			}
+		}
+	}
+
+	sccs := stronglyConnected(f.States, adj)
+	s.SCCs = len(sccs)
+	for _, c := range sccs {
+		if len(c) > s.LargestSCC {
+			s.LargestSCC = len(c)
+		}
+	}
+
+	s.Components = weakComponents(f.States, succ, pred)
+	if s.States > 0 {
+		s.Cyclomatic = arcs - s.States + 2*s.Components
+	}
+	return s
+}
+
+// percent returns n/total as a percentage rounded to one decimal place.
+func percent(n, total int) float64 {
+	return float64(int(float64(n)*1000/float64(total)+0.5)) / 10
+}
+
+// bfsDistances returns the shortest distance from start to every state
+// reachable from it, including start itself at distance 0.
+func bfsDistances(adj map[string][]string, start string) map[string]int {
+	dist := map[string]int{start: 0}
+	queue := []string{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range adj[cur] {
+			if _, seen := dist[next]; !seen {
+				dist[next] = dist[cur] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return dist
+}
+
+// stronglyConnected returns the strongly connected components of the
+// graph using Tarjan's algorithm. Components are in reverse topological
+// order; members keep the order in which they were discovered.
+func stronglyConnected(states []string, adj map[string][]string) [][]string {
+	index := make(map[string]int, len(states))
+	low := make(map[string]int, len(states))
+	onStack := make(map[string]bool, len(states))
+	var stack []string
+	var result [][]string
+	next := 0
+
+	var visit func(v string)
+	visit = func(v string) {
+		index[v] = next
+		low[v] = next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range adj[v] {
+			if _, seen := index[w]; !seen {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+
+		if low[v] == index[v] {
+			var comp []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				comp = append(comp, w)
+				if w == v {
+					break
+				}
+			}
+			result = append(result, comp)
+		}
+	}
+
+	for _, v := range states {
+		if _, seen := index[v]; !seen {
+			visit(v)
+		}
+	}
+	return result
+}
+
+// weakComponents counts connected components when arc direction is ignored.
+func weakComponents(states []string, succ, pred map[string]map[string]bool) int {
+	seen := make(map[string]bool, len(states))
+	count := 0
+	for _, start := range states {
+		if seen[start] {
+			continue
+		}
+		count++
+		seen[start] = true
+		queue := []string{start}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, m := range []map[string]bool{succ[cur], pred[cur]} {
+				for n := range m {
+					if !seen[n] {
+						seen[n] = true
+						queue = append(queue, n)
+					}
+				}
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,65 @@
+package fsm
+
+import "testing"
+
+func TestComputeStats_RedundantDFA(t *testing.T) {
+	s := redundantDFA().ComputeStats()
+
+	if s.States != 4 || s.Transitions != 7 || s.Inputs != 2 {
+		t.Errorf("size = %d states, %d transitions, %d inputs; want 4, 7, 2", s.States, s.Transitions, s.Inputs)
+	}
+	if s.Determinism != 100 {
+		t.Errorf("Determinism = %v, want 100", s.Determinism)
+	}
+	// 7 of 8 (state, input) pairs are covered; q3 has no "b".
+	if s.Completeness != 87.5 {
+		t.Errorf("Completeness = %v, want 87.5", s.Completeness)
+	}
+	if s.Reachable != 3 {
+		t.Errorf("Reachable = %d, want 3", s.Reachable)
+	}
+	// q0, q1, q2 form one cycle; q3 is on its own.
+	if s.SCCs != 2 || s.LargestSCC != 3 {
+		t.Errorf("SCCs = %d (largest %d), want 2 (largest 3)", s.SCCs, s.LargestSCC)
+	}
+	// q3 -> q0 -> q1 -> q2
+	if s.Diameter != 3 {
+		t.Errorf("Diameter = %d, want 3", s.Diameter)
+	}
+	if s.MaxFanIn != 4 || s.MaxFanInState != "q0" {
+		t.Errorf("MaxFanIn = %d at %q, want 4 at q0", s.MaxFanIn, s.MaxFanInState)
+	}
+	// Arcs: q0->q1, q0->q0, q1->q2, q1->q0, q2->q1, q2->q0, q3->q0 = 7.
+	// 7 - 4 + 2*1 = 5.
+	if s.Components != 1 || s.Cyclomatic != 5 {
+		t.Errorf("Components = %d, Cyclomatic = %d; want 1, 5", s.Components, s.Cyclomatic)
+	}
+}
+
+func TestComputeStats_NFA(t *testing.T) {
+	f := New(TypeNFA)
+	f.AddState("s")
+	f.AddState("t")
+	f.Alphabet = []string{"a"}
+	f.SetInitial("s")
+	f.AddTransition("s", strp("a"), []string{"s", "t"}, nil)
+	f.AddTransition("t", nil, []string{"s"}, nil)
+
+	s := f.ComputeStats()
+	if s.Edges != 3 || s.Epsilon != 1 {
+		t.Errorf("Edges = %d, Epsilon = %d; want 3, 1", s.Edges, s.Epsilon)
+	}
+	if s.Determinism != 0 {
+		t.Errorf("Determinism = %v, want 0", s.Determinism)
+	}
+	if s.Completeness != 50 {
+		t.Errorf("Completeness = %v, want 50", s.Completeness)
+	}
+}
+
+func TestComputeStats_Empty(t *testing.T) {
+	s := New(TypeDFA).ComputeStats()
+	if s.States != 0 || s.Cyclomatic != 0 || s.Determinism != 100 {
+		t.Errorf("unexpected stats for empty machine: %+v", s)
+	}
+}
@@ -0,0 +1,99 @@
+package fsm
+
+import "fmt"
+
+// Subgraph returns a copy of the machine restricted to the given states
+// and, if closure is set, every state reachable from them. The states
+// keep their order in f. Transitions from a dropped state are removed,
+// and targets outside the subgraph are removed from the rest; a
+// transition left with no target is dropped. Accepting states, outputs,
+// classes, metadata, and nets are kept for the states that remain.
+//
+// The initial state is kept if it is in the subgraph; otherwise the
+// first of the given states becomes initial. The alphabets are copied
+// unchanged, so a subsystem can still be compared with the whole.
+func (f *FSM) Subgraph(states []string, closure bool) (*FSM, error) {
+	if len(states) == 0 {
+		return nil, fmt.Errorf("no states given")
+	}
+	keep := make(map[string]bool)
+	for _, s := range states {
+		if !f.HasState(s) {
+			return nil, fmt.Errorf("state %q does not exist", s)
+		}
+		keep[s] = true
+	}
+	if closure {
+		ix := NewTransitionIndex(f)
+		queue := append([]string(nil), states...)
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, t := range ix.From(current) {
+				for _, next := range t.To {
+					if !keep[next] {
+						keep[next] = true
+						queue = append(queue, next)
+					}
+				}
+			}
+		}
+	}
+
+	g := f.Clone()
+	g.States = filterStates(f.States, keep)
+	g.Accepting = filterStates(f.Accepting, keep)
+	if !keep[g.Initial] {
+		g.Initial = states[0]
+	}
+
+	transitions := make([]Transition, 0, len(g.Transitions))
+	for _, t := range g.Transitions {
+		if !keep[t.From] {
+			continue
+		}
+		t.To = filterStates(t.To, keep)
+		if len(t.To) > 0 {
+			transitions = append(transitions, t)
+		}
+	}
+	g.Transitions = transitions
+
+	g.StateOutputs = keepKeys(g.StateOutputs, keep)
+	g.LinkedMachines = keepKeys(g.LinkedMachines, keep)
+	g.StateClasses = keepKeys(g.StateClasses, keep)
+	g.StateProperties = keepKeys(g.StateProperties, keep)
+	g.StateMetadata = keepKeys(g.StateMetadata, keep)
+	for _, s := range f.States {
+		if !keep[s] {
+			g.CascadeDeleteState(s)
+		}
+	}
+	return g, nil
+}
+
+// filterStates returns the states in list that are in keep, in order.
+func filterStates(list []string, keep map[string]bool) []string {
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		if keep[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// keepKeys returns m without the entries of states not in keep. A nil
+// map stays nil.
+func keepKeys[V any](m map[string]V, keep map[string]bool) map[string]V {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		if keep[k] {
+			out[k] = v
+		}
+	}
+	return out
+}
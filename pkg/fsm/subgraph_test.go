@@ -0,0 +1,78 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// subgraphFSM is a small controller: off -> idle -> run -> stop -> idle,
+// with a fault state reachable from run.
+func subgraphFSM() *FSM {
+	f := New(TypeDFA)
+	for _, s := range []string{"off", "idle", "run", "stop", "fault"} {
+		f.AddState(s)
+	}
+	for _, in := range []string{"power", "go", "halt", "err"} {
+		f.AddInput(in)
+	}
+	f.Initial = "off"
+	f.Accepting = []string{"idle", "fault"}
+	f.AddTransition("off", strp("power"), []string{"idle"}, nil)
+	f.AddTransition("idle", strp("go"), []string{"run"}, nil)
+	f.AddTransition("run", strp("halt"), []string{"stop"}, nil)
+	f.AddTransition("run", strp("err"), []string{"fault"}, nil)
+	f.AddTransition("stop", strp("go"), []string{"idle"}, nil)
+	f.SetStateMetadata("fault", "severity", "high")
+	f.Nets = []Net{{Name: "N1", Endpoints: []NetEndpoint{{"idle", "a"}, {"run", "b"}, {"fault", "c"}}}}
+	return f
+}
+
+func TestSubgraph(t *testing.T) {
+	f := subgraphFSM()
+	g, err := f.Subgraph([]string{"run", "idle"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"idle", "run"}; !reflect.DeepEqual(g.States, want) {
+		t.Errorf("states = %v, want %v", g.States, want)
+	}
+	if g.Initial != "run" {
+		t.Errorf("initial = %q, want the first given state", g.Initial)
+	}
+	if len(g.Transitions) != 1 || g.Transitions[0].From != "idle" {
+		t.Errorf("dangling transitions kept: %+v", g.Transitions)
+	}
+	if !reflect.DeepEqual(g.Accepting, []string{"idle"}) {
+		t.Errorf("accepting = %v", g.Accepting)
+	}
+	if len(g.Nets[0].Endpoints) != 2 {
+		t.Errorf("net endpoint on dropped state kept: %+v", g.Nets[0])
+	}
+	if err := g.Validate(); err != nil {
+		t.Errorf("subgraph invalid: %v", err)
+	}
+	if len(f.States) != 5 || len(f.Transitions) != 5 {
+		t.Error("Subgraph modified the original machine")
+	}
+}
+
+func TestSubgraph_Closure(t *testing.T) {
+	f := subgraphFSM()
+	g, err := f.Subgraph([]string{"run"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"idle", "run", "stop", "fault"}; !reflect.DeepEqual(g.States, want) {
+		t.Errorf("states = %v, want %v", g.States, want)
+	}
+	if len(g.Transitions) != 4 {
+		t.Errorf("got %d transitions, want 4", len(g.Transitions))
+	}
+	if g.StateMetadata["fault"]["severity"] != "high" {
+		t.Error("metadata of kept state lost")
+	}
+
+	if _, err := f.Subgraph([]string{"nope"}, false); err == nil {
+		t.Error("unknown state should fail")
+	}
+}
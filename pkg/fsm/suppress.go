@@ -0,0 +1,95 @@
+package fsm
+
+import "strings"
+
+// SuppressKey is the state and machine metadata key that silences
+// analysis findings. Its value lists analysis rules, by name ("dead") or
+// ID ("A002"), separated by commas; a TOML-style list such as
+// ["dead", "trap"] is read the same way. On a state it drops that state
+// from the findings of those rules; on the machine it drops the rules'
+// findings altogether. A deliberate trap state, for one, can carry
+// suppress = "dead, trap".
+const SuppressKey = "suppress"
+
+// analysisIDs gives each analysis rule a stable ID, for reports and for
+// naming the rule in --ignore or suppress. IDs are never reused.
+var analysisIDs = map[string]string{
+	RuleUnreachable:      "A001",
+	RuleDead:             "A002",
+	RuleTrap:             "A003",
+	RuleLivelock:         "A004",
+	RuleNondeterministic: "A005",
+	RuleIncomplete:       "A006",
+	RuleUnusedInput:      "A007",
+	RuleUnusedOutput:     "A008",
+}
+
+// AnalysisID returns the stable ID of an analysis rule, such as "A002"
+// for "dead", or "" if rule is not one of Analyse's.
+func AnalysisID(rule string) string {
+	return analysisIDs[rule]
+}
+
+// AnalysisRule returns the analysis rule that name, a rule name or ID in
+// any case, stands for, or false if it stands for none.
+func AnalysisRule(name string) (string, bool) {
+	for rule, id := range analysisIDs {
+		if strings.EqualFold(name, rule) || strings.EqualFold(name, id) {
+			return rule, true
+		}
+	}
+	return "", false
+}
+
+// Matches reports whether name, a rule name or ID in any case, names the
+// rule w was found by.
+func (w ValidationWarning) Matches(name string) bool {
+	return strings.EqualFold(name, w.Type) || (w.ID != "" && strings.EqualFold(name, w.ID))
+}
+
+// IgnoreWarnings returns warnings without those found by the rules named,
+// by name or ID, in ignore.
+func IgnoreWarnings(warnings []ValidationWarning, ignore []string) []ValidationWarning {
+	var kept []ValidationWarning
+	for _, w := range warnings {
+		if !w.matchesAny(ignore) {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
+
+func (w ValidationWarning) matchesAny(names []string) bool {
+	for _, n := range names {
+		if w.Matches(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// SuppressList splits a suppress metadata value into rule names and IDs.
+func SuppressList(v string) []string {
+	v = strings.TrimSpace(v)
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")
+	var names []string
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.Trim(strings.TrimSpace(n), `"'`); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// unsuppressed returns states without those whose suppress metadata
+// names rule.
+func (f *FSM) unsuppressed(rule string, states []string) []string {
+	probe := ValidationWarning{Type: rule, ID: AnalysisID(rule)}
+	var kept []string
+	for _, s := range states {
+		if !probe.matchesAny(SuppressList(f.StateMetadata[s][SuppressKey])) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,88 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// trapDFA is a DFA with a deliberate trap state that every bad input leads
+// to, and an unused input.
+func trapDFA() *FSM {
+	f := New(TypeDFA)
+	f.States = []string{"s0", "s1", "trap"}
+	f.Alphabet = []string{"a", "b", "c"}
+	f.Initial = "s0"
+	f.Accepting = []string{"s1"}
+	f.AddTransition("s0", strp("a"), []string{"s1"}, nil)
+	f.AddTransition("s0", strp("b"), []string{"trap"}, nil)
+	f.AddTransition("s1", strp("a"), []string{"s0"}, nil)
+	f.AddTransition("s1", strp("b"), []string{"trap"}, nil)
+	return f
+}
+
+func warningTypes(warnings []ValidationWarning) []string {
+	var types []string
+	for _, w := range warnings {
+		types = append(types, w.Type)
+	}
+	return types
+}
+
+func TestAnalyse_IDsAndSeverities(t *testing.T) {
+	want := map[string][2]string{
+		RuleDead:        {"A002", string(SeverityWarning)},
+		RuleIncomplete:  {"A006", string(SeverityWarning)},
+		RuleUnusedInput: {"A007", string(SeverityInfo)},
+	}
+	warnings := trapDFA().Analyse()
+	if len(warnings) != len(want) {
+		t.Fatalf("got %v, want %d warnings", warningTypes(warnings), len(want))
+	}
+	for _, w := range warnings {
+		if got := [2]string{w.ID, string(w.Severity)}; got != want[w.Type] {
+			t.Errorf("%s: ID and severity %v, want %v", w.Type, got, want[w.Type])
+		}
+	}
+}
+
+func TestAnalyse_StateSuppression(t *testing.T) {
+	f := trapDFA()
+	f.SetStateMetadata("trap", SuppressKey, `["dead", "A006"]`)
+	warnings := f.Analyse()
+	if got, want := warningTypes(warnings), []string{RuleIncomplete, RuleUnusedInput}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Suppression only drops the state it is on.
+	for _, w := range warnings {
+		if w.Type == RuleIncomplete && !reflect.DeepEqual(w.States, []string{"s0", "s1"}) {
+			t.Errorf("incomplete states %v, want [s0 s1]", w.States)
+		}
+	}
+}
+
+func TestAnalyse_MachineSuppression(t *testing.T) {
+	f := trapDFA()
+	f.Metadata = map[string]string{SuppressKey: "a007, incomplete"}
+	got := warningTypes(f.Analyse())
+	if want := []string{RuleDead}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestIgnoreWarnings(t *testing.T) {
+	got := warningTypes(IgnoreWarnings(trapDFA().Analyse(), []string{"A002", "UNUSED_INPUT"}))
+	if want := []string{RuleIncomplete}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAnalysisRule(t *testing.T) {
+	for name, want := range map[string]string{"A005": RuleNondeterministic, "a001": RuleUnreachable, "Dead": RuleDead} {
+		if got, ok := AnalysisRule(name); !ok || got != want {
+			t.Errorf("AnalysisRule(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	if _, ok := AnalysisRule("state_naming"); ok {
+		t.Error("state_naming is a lint rule, not an analysis rule")
+	}
+}
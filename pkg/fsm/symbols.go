@@ -0,0 +1,326 @@
+package fsm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// SymbolKind selects the alphabet that RenameSymbol and MergeSymbols
+// rewrite.
+type SymbolKind int
+
+const (
+	InputSymbol  SymbolKind = iota // the input alphabet and transition inputs
+	OutputSymbol                   // the output alphabet, Moore state outputs, and Mealy transition outputs
+)
+
+func (k SymbolKind) String() string {
+	if k == OutputSymbol {
+		return "output"
+	}
+	return "input"
+}
+
+// RenameSymbol renames a symbol of the given kind everywhere it is used,
+// including the machine metadata keyed by its name, such as its pinned
+// encoding. It is an error if oldName is not in the alphabet or newName
+// already is; use MergeSymbols to combine two symbols into one.
+func (f *FSM) RenameSymbol(kind SymbolKind, oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("%s name cannot be empty", kind)
+	}
+	alphabet := f.symbolAlphabet(kind)
+	if !hasSymbol(*alphabet, oldName) {
+		return fmt.Errorf("%s %q not in alphabet", kind, oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if hasSymbol(*alphabet, newName) {
+		return fmt.Errorf("%s %q already exists (merge the symbols instead)", kind, newName)
+	}
+	f.rewriteSymbols(kind, map[string]string{oldName: newName})
+	return nil
+}
+
+// MergeSymbols replaces the symbols in from by the single symbol into,
+// which may be one of them, an existing symbol, or a new one. It takes
+// the alphabet position of the first merged symbol. Transitions that
+// become identical are kept once; others are kept as they are, so a
+// merge can make a deterministic machine nondeterministic or
+// probabilities no longer sum to 1. Call Validate and
+// NonDeterministicStates afterwards to find out. The merged symbol keeps
+// the metadata keyed by the names it replaces, such as a pinned encoding
+// or an input class pattern; it is an error for them to disagree, or to
+// merge an input class with a plain symbol.
+func (f *FSM) MergeSymbols(kind SymbolKind, from []string, into string) error {
+	if into == "" {
+		return fmt.Errorf("%s name cannot be empty", kind)
+	}
+	if len(from) == 0 {
+		return fmt.Errorf("no %ss to merge", kind)
+	}
+	alphabet := f.symbolAlphabet(kind)
+	mapping := make(map[string]string)
+	for _, s := range from {
+		if !hasSymbol(*alphabet, s) {
+			return fmt.Errorf("%s %q not in alphabet", kind, s)
+		}
+		mapping[s] = into
+	}
+	if err := f.checkMergeMetadata(kind, from, into); err != nil {
+		return err
+	}
+	f.rewriteSymbols(kind, mapping)
+	return nil
+}
+
+// checkMergeMetadata returns an error if the symbols merged into into,
+// and into itself if it exists, have different values for metadata
+// keyed by symbol name, which the merged symbol could not all keep.
+func (f *FSM) checkMergeMetadata(kind SymbolKind, from []string, into string) error {
+	names := from
+	if hasSymbol(*f.symbolAlphabet(kind), into) && !hasSymbol(from, into) {
+		names = append(append([]string(nil), from...), into)
+	}
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if err := f.symbolMetadataConflict(kind, a, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// symbolMetadataConflict returns an error if symbols a and b disagree
+// on metadata keyed by symbol name: both have a value under a prefix and
+// the values differ, or only one of them is an input class, which reads
+// different inputs from a plain symbol.
+func (f *FSM) symbolMetadataConflict(kind SymbolKind, a, b string) error {
+	for _, prefix := range symbolMetadataPrefixes(kind) {
+		va, okA := f.Metadata[prefix+a]
+		vb, okB := f.Metadata[prefix+b]
+		switch {
+		case okA && okB && va != vb:
+			return fmt.Errorf("cannot merge %ss %q and %q: %s%s is %q but %s%s is %q",
+				kind, a, b, prefix, a, va, prefix, b, vb)
+		case okA != okB && prefix == InputClassPrefix:
+			class, plain := a, b
+			if okB {
+				class, plain = b, a
+			}
+			return fmt.Errorf("cannot merge inputs %q and %q: %q is an input class and %q is not", a, b, class, plain)
+		}
+	}
+	return nil
+}
+
+// PruneAlphabet removes the inputs no transition uses and the outputs
+// no state or transition produces (see UnusedInputs and UnusedOutputs),
+// with the machine metadata keyed by their names, and returns what it
+// removed.
+func (f *FSM) PruneAlphabet() (inputs, outputs []string) {
+	inputs = f.UnusedInputs()
+	outputs = f.UnusedOutputs()
+	f.Alphabet = withoutSymbols(f.Alphabet, inputs)
+	f.OutputAlphabet = withoutSymbols(f.OutputAlphabet, outputs)
+	f.dropSymbolMetadata(InputSymbol, inputs)
+	f.dropSymbolMetadata(OutputSymbol, outputs)
+	return inputs, outputs
+}
+
+// EquivalentInputs returns the groups of two or more inputs that are
+// indistinguishable: from every state, each leads to the same targets
+// with the same outputs, stack operations, probabilities, weights, and
+// metadata. Inputs pinned to different encodings, and input classes
+// with different patterns or grouped with plain symbols, are not
+// grouped, so that a group can always be merged with MergeSymbols, which
+// leaves the machine's behaviour unchanged apart from the input names. Groups and
+// their members are in alphabet order.
+func (f *FSM) EquivalentInputs() [][]string {
+	ix := NewTransitionIndex(f)
+	grouped := make(map[string]bool)
+	var groups [][]string
+	for i, a := range f.Alphabet {
+		if grouped[a] {
+			continue
+		}
+		group := []string{a}
+		for _, b := range f.Alphabet[i+1:] {
+			if !grouped[b] && f.sameBehaviour(ix, a, b) && f.canJoin(group, b) {
+				group = append(group, b)
+				grouped[b] = true
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// canJoin reports whether input b agrees with every input of group on
+// the metadata keyed by their names.
+func (f *FSM) canJoin(group []string, b string) bool {
+	for _, a := range group {
+		if f.symbolMetadataConflict(InputSymbol, a, b) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// sameBehaviour reports whether inputs a and b have the same transitions,
+// in any order, from every state.
+func (f *FSM) sameBehaviour(ix *TransitionIndex, a, b string) bool {
+	for _, s := range f.States {
+		ta, tb := ix.Transitions(s, &a), ix.Transitions(s, &b)
+		if len(ta) != len(tb) {
+			return false
+		}
+		matched := make([]bool, len(tb))
+		for _, x := range ta {
+			x.Input = nil
+			found := false
+			for j, y := range tb {
+				y.Input = nil
+				if !matched[j] && reflect.DeepEqual(x, y) {
+					matched[j], found = true, true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// symbolMetadataPrefixes returns the prefixes of the machine metadata
+// keys that end in the name of a symbol of the given kind.
+func symbolMetadataPrefixes(kind SymbolKind) []string {
+	if kind == OutputSymbol {
+		return []string{OutputEncodingPrefix}
+	}
+	return []string{InputEncodingPrefix, InputClassPrefix}
+}
+
+// dropSymbolMetadata deletes the machine metadata keyed by the names of
+// symbols.
+func (f *FSM) dropSymbolMetadata(kind SymbolKind, symbols []string) {
+	for _, prefix := range symbolMetadataPrefixes(kind) {
+		for _, s := range symbols {
+			delete(f.Metadata, prefix+s)
+		}
+	}
+}
+
+// symbolAlphabet returns the alphabet holding symbols of the given kind.
+func (f *FSM) symbolAlphabet(kind SymbolKind) *[]string {
+	if kind == OutputSymbol {
+		return &f.OutputAlphabet
+	}
+	return &f.Alphabet
+}
+
+// rewriteSymbols replaces symbols of the given kind by their mapping.
+// In the alphabet each new symbol takes the place of the first symbol
+// mapped to it (or keeps its own, if it was already there).
+func (f *FSM) rewriteSymbols(kind SymbolKind, mapping map[string]string) {
+	alphabet := f.symbolAlphabet(kind)
+	var out []string
+	seen := make(map[string]bool)
+	for _, s := range *alphabet {
+		if to, ok := mapping[s]; ok {
+			s = to
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	*alphabet = out
+
+	// Metadata keyed by a symbol's name moves to its new name;
+	// MergeSymbols has checked that merged symbols agree on it.
+	for _, prefix := range symbolMetadataPrefixes(kind) {
+		for from, to := range mapping {
+			v, ok := f.Metadata[prefix+from]
+			if !ok || from == to {
+				continue
+			}
+			delete(f.Metadata, prefix+from)
+			f.Metadata[prefix+to] = v
+		}
+	}
+
+	rename := func(p *string) *string {
+		if p == nil {
+			return nil
+		}
+		if to, ok := mapping[*p]; ok {
+			return &to
+		}
+		return p
+	}
+
+	switch kind {
+	case InputSymbol:
+		for i := range f.Transitions {
+			f.Transitions[i].Input = rename(f.Transitions[i].Input)
+		}
+	case OutputSymbol:
+		for i := range f.Transitions {
+			f.Transitions[i].Output = rename(f.Transitions[i].Output)
+		}
+		for state, out := range f.StateOutputs {
+			if to, ok := mapping[out]; ok {
+				f.StateOutputs[state] = to
+			}
+		}
+	}
+
+	// Drop transitions made identical by the rewrite.
+	var kept []Transition
+	byState := make(map[string][]int) // state -> indices in kept
+	for _, t := range f.Transitions {
+		dup := false
+		for _, i := range byState[t.From] {
+			if reflect.DeepEqual(t, kept[i]) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			byState[t.From] = append(byState[t.From], len(kept))
+			kept = append(kept, t)
+		}
+	}
+	if kept == nil {
+		kept = make([]Transition, 0)
+	}
+	f.Transitions = kept
+}
+
+// withoutSymbols returns list without the symbols in drop.
+func withoutSymbols(list, drop []string) []string {
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		if !hasSymbol(drop, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// hasSymbol reports whether s is in list.
+func hasSymbol(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// symbolsFSM is a Mealy machine with two inputs that behave alike in
+// every state, and a third that does not.
+func symbolsFSM() *FSM {
+	f := New(TypeMealy)
+	for _, s := range []string{"idle", "busy"} {
+		f.AddState(s)
+	}
+	for _, in := range []string{"tick", "tock", "reset"} {
+		f.AddInput(in)
+	}
+	for _, out := range []string{"beep", "none"} {
+		f.AddOutput(out)
+	}
+	f.Initial = "idle"
+	f.AddTransition("idle", strp("tick"), []string{"busy"}, strp("beep"))
+	f.AddTransition("idle", strp("tock"), []string{"busy"}, strp("beep"))
+	f.AddTransition("busy", strp("tick"), []string{"busy"}, strp("none"))
+	f.AddTransition("busy", strp("tock"), []string{"busy"}, strp("none"))
+	f.AddTransition("busy", strp("reset"), []string{"idle"}, strp("none"))
+	return f
+}
+
+func TestRenameSymbol_Input(t *testing.T) {
+	f := symbolsFSM()
+	if err := f.RenameSymbol(InputSymbol, "tick", "clk"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"clk", "tock", "reset"}; !reflect.DeepEqual(f.Alphabet, want) {
+		t.Errorf("alphabet = %v, want %v", f.Alphabet, want)
+	}
+	for _, tr := range f.Transitions {
+		if *tr.Input == "tick" {
+			t.Errorf("transition %s still on tick", tr.From)
+		}
+	}
+	if len(f.Transitions) != 5 {
+		t.Errorf("got %d transitions, want 5", len(f.Transitions))
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("renamed machine invalid: %v", err)
+	}
+
+	if err := f.RenameSymbol(InputSymbol, "clk", "tock"); err == nil {
+		t.Error("renaming onto an existing symbol should fail")
+	}
+	if err := f.RenameSymbol(InputSymbol, "missing", "x"); err == nil {
+		t.Error("renaming a missing symbol should fail")
+	}
+}
+
+func TestRenameSymbol_Output(t *testing.T) {
+	f := New(TypeMoore)
+	f.AddState("a")
+	f.AddInput("x")
+	f.AddOutput("on")
+	f.Initial = "a"
+	f.StateOutputs["a"] = "on"
+	f.AddTransition("a", strp("x"), []string{"a"}, nil)
+
+	if err := f.RenameSymbol(OutputSymbol, "on", "high"); err != nil {
+		t.Fatal(err)
+	}
+	if f.StateOutputs["a"] != "high" || f.OutputAlphabet[0] != "high" {
+		t.Errorf("output not renamed: %v, %v", f.StateOutputs, f.OutputAlphabet)
+	}
+}
+
+func TestMergeSymbols(t *testing.T) {
+	f := symbolsFSM()
+	if err := f.MergeSymbols(InputSymbol, []string{"tick", "tock"}, "clk"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"clk", "reset"}; !reflect.DeepEqual(f.Alphabet, want) {
+		t.Errorf("alphabet = %v, want %v", f.Alphabet, want)
+	}
+	if len(f.Transitions) != 3 {
+		t.Errorf("identical transitions not merged: got %d, want 3", len(f.Transitions))
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("merged machine invalid: %v", err)
+	}
+}
+
+func TestMergeSymbols_IntoExisting(t *testing.T) {
+	f := symbolsFSM()
+	if err := f.MergeSymbols(InputSymbol, []string{"tock"}, "tick"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"tick", "reset"}; !reflect.DeepEqual(f.Alphabet, want) {
+		t.Errorf("alphabet = %v, want %v", f.Alphabet, want)
+	}
+}
+
+func TestMergeSymbols_Conflict(t *testing.T) {
+	f := symbolsFSM()
+	// reset and tick lead to different states from busy, so merging them
+	// makes the machine nondeterministic.
+	if err := f.MergeSymbols(InputSymbol, []string{"tick", "reset"}, "go"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.NonDeterministicStates(); !reflect.DeepEqual(got, []string{"busy"}) {
+		t.Errorf("nondeterministic states = %v, want [busy]", got)
+	}
+}
+
+func TestPruneAlphabet(t *testing.T) {
+	f := symbolsFSM()
+	f.AddInput("spare")
+	f.AddOutput("unused")
+	inputs, outputs := f.PruneAlphabet()
+	if !reflect.DeepEqual(inputs, []string{"spare"}) || !reflect.DeepEqual(outputs, []string{"unused"}) {
+		t.Errorf("pruned %v, %v", inputs, outputs)
+	}
+	if want := []string{"tick", "tock", "reset"}; !reflect.DeepEqual(f.Alphabet, want) {
+		t.Errorf("alphabet = %v, want %v", f.Alphabet, want)
+	}
+	if want := []string{"beep", "none"}; !reflect.DeepEqual(f.OutputAlphabet, want) {
+		t.Errorf("output alphabet = %v, want %v", f.OutputAlphabet, want)
+	}
+}
+
+func TestEquivalentInputs(t *testing.T) {
+	f := symbolsFSM()
+	if got, want := f.EquivalentInputs(), [][]string{{"tick", "tock"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EquivalentInputs = %v, want %v", got, want)
+	}
+
+	// A different output on one state tells them apart.
+	f.Transitions[3].Output = strp("beep")
+	if got := f.EquivalentInputs(); len(got) != 0 {
+		t.Errorf("EquivalentInputs = %v, want none", got)
+	}
+}
@@ -0,0 +1,225 @@
+package fsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyncSeparator joins the component state names of a product state:
+// "locked.idle" is a in locked and b in idle.
+const SyncSeparator = "."
+
+// Synchronize returns the synchronous parallel composition of a and b.
+// The product's states are the pairs of component states reachable from
+// the pair of initial states. On a shared input both machines move
+// together, and the input is refused unless both can take it; on any
+// other input, and on epsilon transitions, one machine moves while the
+// other stays put. A nil shared list shares the inputs the two alphabets
+// have in common.
+//
+// A product state is accepting when both of its components are. The
+// product is a DFA when both machines are and no unshared input is in
+// both alphabets; otherwise, since either machine may take such an input,
+// it is an NFA. Mealy machines compose into a Mealy machine: a step
+// outputs what the machines that moved output, joined by "+" when both
+// did. Moore machines and pushdown automata are not supported.
+func Synchronize(a, b *FSM, shared []string) (*FSM, error) {
+	for _, m := range []*FSM{a, b} {
+		switch m.Type {
+		case TypeMoore, TypePDA:
+			return nil, fmt.Errorf("cannot synchronize %s machines", m.Type)
+		}
+		if m.Initial == "" {
+			return nil, fmt.Errorf("machine %q has no initial state", m.Name)
+		}
+	}
+	if (a.Type == TypeMealy) != (b.Type == TypeMealy) {
+		return nil, fmt.Errorf("cannot synchronize a %s machine with a %s machine", a.Type, b.Type)
+	}
+
+	inA, inB := make(map[string]bool), make(map[string]bool)
+	for _, s := range a.Alphabet {
+		inA[s] = true
+	}
+	for _, s := range b.Alphabet {
+		inB[s] = true
+	}
+	sync := make(map[string]bool)
+	if shared == nil {
+		for _, s := range a.Alphabet {
+			if inB[s] {
+				sync[s] = true
+			}
+		}
+	}
+	for _, s := range shared {
+		if !inA[s] || !inB[s] {
+			return nil, fmt.Errorf("shared input %q is not in both alphabets", s)
+		}
+		sync[s] = true
+	}
+
+	p := New(a.Type)
+	if a.Type == TypeNFA || b.Type == TypeNFA {
+		p.Type = TypeNFA
+	}
+	p.Name = strings.Trim(a.Name+"_"+b.Name, "_")
+	p.Alphabet = unionSymbols(a.Alphabet, b.Alphabet)
+	p.OutputAlphabet = unionSymbols(a.OutputAlphabet, b.OutputAlphabet)
+
+	ixA, ixB := NewTransitionIndex(a), NewTransitionIndex(b)
+	type pair struct{ a, b string }
+	names := make(map[string]pair)
+	name := func(s pair) (string, error) {
+		n := s.a + SyncSeparator + s.b
+		if prev, ok := names[n]; ok && prev != s {
+			return "", fmt.Errorf("product states %s/%s and %s/%s would both be named %q", prev.a, prev.b, s.a, s.b, n)
+		}
+		names[n] = s
+		return n, nil
+	}
+
+	start := pair{a.Initial, b.Initial}
+	initial, err := name(start)
+	if err != nil {
+		return nil, err
+	}
+	p.Initial = initial
+	seen := map[pair]bool{start: true}
+	queue := []pair{start}
+	outputs := make(map[string]bool)
+	for _, o := range p.OutputAlphabet {
+		outputs[o] = true
+	}
+
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		from, _ := name(s)
+		p.States = append(p.States, from)
+		if ixA.IsAccepting(s.a) && ixB.IsAccepting(s.b) {
+			p.Accepting = append(p.Accepting, from)
+		}
+
+		// Moves grouped by input and output, in the order found.
+		type move struct {
+			input  *string
+			output *string
+			to     []pair
+		}
+		var moves []*move
+		add := func(input, output *string, to pair) {
+			for _, m := range moves {
+				if equalPtr(m.input, input) && equalPtr(m.output, output) {
+					for _, t := range m.to {
+						if t == to {
+							return
+						}
+					}
+					m.to = append(m.to, to)
+					return
+				}
+			}
+			moves = append(moves, &move{input, output, []pair{to}})
+		}
+
+		for _, in := range p.Alphabet {
+			if sync[in] {
+				for _, ta := range ixA.Transitions(s.a, &in) {
+					for _, tb := range ixB.Transitions(s.b, &in) {
+						out := joinOutputs(ta.Output, tb.Output)
+						for _, x := range ta.To {
+							for _, y := range tb.To {
+								add(&in, out, pair{x, y})
+							}
+						}
+					}
+				}
+				continue
+			}
+			for _, ta := range ixA.Transitions(s.a, &in) {
+				for _, x := range ta.To {
+					add(&in, ta.Output, pair{x, s.b})
+				}
+			}
+			for _, tb := range ixB.Transitions(s.b, &in) {
+				for _, y := range tb.To {
+					add(&in, tb.Output, pair{s.a, y})
+				}
+			}
+		}
+		for _, ta := range ixA.Epsilon(s.a) {
+			for _, x := range ta.To {
+				add(nil, nil, pair{x, s.b})
+			}
+		}
+		for _, tb := range ixB.Epsilon(s.b) {
+			for _, y := range tb.To {
+				add(nil, nil, pair{s.a, y})
+			}
+		}
+
+		counts := make(map[string]int)
+		for _, m := range moves {
+			var to []string
+			for _, t := range m.to {
+				n, err := name(t)
+				if err != nil {
+					return nil, err
+				}
+				to = append(to, n)
+				if !seen[t] {
+					seen[t] = true
+					queue = append(queue, t)
+				}
+			}
+			if m.output != nil && !outputs[*m.output] {
+				outputs[*m.output] = true
+				p.OutputAlphabet = append(p.OutputAlphabet, *m.output)
+			}
+			p.AddTransition(from, m.input, to, m.output)
+			key := ""
+			if m.input != nil {
+				key = "i" + *m.input
+			}
+			counts[key]++
+			if p.Type == TypeDFA && (m.input == nil || len(to) > 1 || counts[key] > 1) {
+				p.Type = TypeNFA
+			}
+		}
+	}
+	return p, nil
+}
+
+// unionSymbols returns a's symbols followed by those of b not in a.
+func unionSymbols(a, b []string) []string {
+	out := append([]string{}, a...)
+	in := make(map[string]bool, len(a))
+	for _, s := range a {
+		in[s] = true
+	}
+	for _, s := range b {
+		if !in[s] {
+			in[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func equalPtr(a, b *string) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// joinOutputs is the output of a synchronised step: either machine's
+// output, or both joined by "+".
+func joinOutputs(a, b *string) *string {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	s := *a + "+" + *b
+	return &s
+}
@@ -0,0 +1,116 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// producer and consumer share put: the producer makes an item, then puts
+// it; the consumer takes it, then uses it.
+func producerConsumer() (*FSM, *FSM) {
+	p := New(TypeDFA)
+	p.Name = "producer"
+	p.States = []string{"empty", "full"}
+	p.Initial = "empty"
+	p.Alphabet = []string{"make", "put"}
+	p.Accepting = []string{"empty"}
+	p.AddTransition("empty", strp("make"), []string{"full"}, nil)
+	p.AddTransition("full", strp("put"), []string{"empty"}, nil)
+
+	c := New(TypeDFA)
+	c.Name = "consumer"
+	c.States = []string{"wait", "busy"}
+	c.Initial = "wait"
+	c.Alphabet = []string{"put", "use"}
+	c.Accepting = []string{"wait"}
+	c.AddTransition("wait", strp("put"), []string{"busy"}, nil)
+	c.AddTransition("busy", strp("use"), []string{"wait"}, nil)
+	return p, c
+}
+
+func TestSynchronize(t *testing.T) {
+	p, c := producerConsumer()
+	s, err := Synchronize(p, c, []string{"put"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != TypeDFA || s.Name != "producer_consumer" || !reflect.DeepEqual(s.Alphabet, []string{"make", "put", "use"}) {
+		t.Errorf("product %v %q %v", s.Type, s.Name, s.Alphabet)
+	}
+	if want := []string{"empty.wait", "full.wait", "empty.busy", "full.busy"}; !reflect.DeepEqual(s.States, want) {
+		t.Errorf("states %v", s.States)
+	}
+	if !reflect.DeepEqual(s.Accepting, []string{"empty.wait"}) {
+		t.Errorf("accepting %v", s.Accepting)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		inputs []string
+		ok     bool
+	}{
+		{[]string{"make", "put", "use"}, true},
+		{[]string{"make", "put", "make", "use", "put"}, true},
+		{[]string{"put"}, false},                        // the producer has nothing to put
+		{[]string{"make", "put", "make", "put"}, false}, // the consumer is busy
+	}
+	for _, tt := range tests {
+		r, _ := NewRunner(s)
+		_, err := r.Run(tt.inputs)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: %v", tt.inputs, err)
+		}
+	}
+
+	// Sharing nothing interleaves put, so either machine may take it.
+	s, err = Synchronize(p, c, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != TypeNFA || len(s.GetTransitions("full.wait", strp("put"))) != 1 ||
+		len(s.GetTransitions("full.wait", strp("put"))[0].To) != 2 {
+		t.Errorf("interleaved product %v %+v", s.Type, s.Transitions)
+	}
+	// By default, common inputs are shared.
+	if d, _ := Synchronize(p, c, nil); len(d.States) != 4 || d.Type != TypeDFA {
+		t.Errorf("default sharing %v %v", d.Type, d.States)
+	}
+
+	if _, err := Synchronize(p, c, []string{"make"}); err == nil {
+		t.Error("shared input outside b's alphabet accepted")
+	}
+	if _, err := Synchronize(p, anbnPDA(), nil); err == nil {
+		t.Error("PDA accepted")
+	}
+}
+
+func TestSynchronize_Mealy(t *testing.T) {
+	a := turnstile("locked", "unlocked", "alarm")
+	b := New(TypeMealy)
+	b.States = []string{"off", "on"}
+	b.Initial = "off"
+	b.Alphabet = []string{"coin"}
+	b.OutputAlphabet = []string{"light"}
+	b.AddTransition("off", strp("coin"), []string{"on"}, strp("light"))
+
+	s, err := Synchronize(a, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := s.GetTransitions("locked.off", strp("coin"))
+	if len(tr) != 1 || tr[0].To[0] != "unlocked.on" || *tr[0].Output != "click+light" {
+		t.Errorf("coin: %+v", tr)
+	}
+	// The second coin is refused: the light has no transition on it.
+	if tr := s.GetTransitions("locked.on", strp("coin")); len(tr) != 0 {
+		t.Errorf("coin from locked.on: %+v", tr)
+	}
+	if tr := s.GetTransitions("locked.off", strp("push")); len(tr) != 1 || *tr[0].Output != "alarm" {
+		t.Errorf("push: %+v", tr)
+	}
+	if err := s.Validate(); err != nil {
+		t.Error(err)
+	}
+}
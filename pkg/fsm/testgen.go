@@ -0,0 +1,345 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TestCase is an input sequence and what a machine does given it, from
+// its initial state: whether it ends accepting, whether it gets stuck,
+// and for Mealy and Moore machines the output of each step.
+type TestCase struct {
+	Inputs []string `json:"inputs"`
+	Accept bool     `json:"accept"`
+	// Stuck is set when the machine has no transition on the last input.
+	// The inputs before it were taken; the machine rejects.
+	Stuck bool `json:"stuck,omitempty"`
+	// Outputs has an entry, "" for none, for each input taken, for
+	// Mealy and Moore machines; it is nil when outputs are not checked.
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// RunTestCase runs inputs through f from its initial state and returns
+// what it does. The run stops at the first input f has no transition
+// on; the TestCase's inputs end there.
+func RunTestCase(f *FSM, inputs []string) (TestCase, error) {
+	r, err := newBehaviour(f)
+	if err != nil {
+		return TestCase{}, err
+	}
+	tc := TestCase{Inputs: inputs}
+	if f.Type == TypeMealy || f.Type == TypeMoore {
+		tc.Outputs = []string{}
+	}
+	for i, in := range inputs {
+		out, err := r.step(in)
+		if err != nil {
+			tc.Inputs = inputs[:i+1]
+			tc.Stuck = true
+			return tc, nil
+		}
+		if tc.Outputs != nil {
+			tc.Outputs = append(tc.Outputs, out)
+		}
+	}
+	tc.Accept = r.observe().Accepting
+	return tc, nil
+}
+
+// Matches reports whether got, the result of running tc's inputs,
+// behaves as tc expects. Outputs are compared only when tc has them.
+func (tc TestCase) Matches(got TestCase) bool {
+	if tc.Accept != got.Accept || tc.Stuck != got.Stuck || !equalStrings(tc.Inputs, got.Inputs) {
+		return false
+	}
+	return tc.Outputs == nil || equalStrings(tc.Outputs, got.Outputs)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestMethod selects how GenerateTests chooses input sequences.
+type TestMethod string
+
+const (
+	// TestTransitionTour covers every transition reachable from the
+	// initial state at least once, in as few sequences as a greedy tour
+	// allows.
+	TestTransitionTour TestMethod = "transition-tour"
+	// TestWMethod is Chow's W-method: every transition, each followed by
+	// sequences that tell its target apart from every other state, so
+	// that any implementation with at most ExtraStates more states than
+	// a minimal specification that passes behaves exactly like it.
+	TestWMethod TestMethod = "w-method"
+)
+
+// TestGenOptions controls GenerateTests.
+type TestGenOptions struct {
+	Method TestMethod // default TestTransitionTour
+	// ExtraStates is how many more states than the specification the
+	// W-method allows an implementation to have. The suite grows by a
+	// factor of the alphabet size for each.
+	ExtraStates int
+}
+
+// GenerateTests returns a test suite for f: input sequences chosen by
+// opts.Method, with the behaviour f gives them as the expectation. The
+// sequences are built on f's deterministic form (see ToDFA), and an
+// input with no transition leads to an implicit rejecting sink, as in
+// Equivalent. Pushdown automata are not supported.
+func GenerateTests(f *FSM, opts TestGenOptions) ([]TestCase, error) {
+	if f.Type == TypePDA {
+		return nil, fmt.Errorf("test generation does not support pushdown automata")
+	}
+	if opts.ExtraStates < 0 {
+		return nil, fmt.Errorf("extra states must not be negative, got %d", opts.ExtraStates)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid FSM: %w", err)
+	}
+	d := withFallbacks(f.ToDFA())
+	var used []string
+	for _, t := range d.Transitions {
+		if t.Input != nil {
+			used = append(used, *t.Input)
+		}
+	}
+	g := testGraph{f: d, table: deltaTable(d), alphabet: unionSorted(d.Alphabet, used)}
+
+	var sequences [][]string
+	switch opts.Method {
+	case "", TestTransitionTour:
+		sequences = g.transitionTour()
+	case TestWMethod:
+		sequences = g.wMethod(opts.ExtraStates)
+	default:
+		return nil, fmt.Errorf("unknown test method %q (want %s or %s)", opts.Method, TestTransitionTour, TestWMethod)
+	}
+
+	var cases []TestCase
+	seen := make(map[string]bool)
+	for _, seq := range sequences {
+		tc, err := RunTestCase(f, seq)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.Join(tc.Inputs, "\x00")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		cases = append(cases, tc)
+	}
+	return cases, nil
+}
+
+// testGraph is a deterministic machine's transition graph, in which
+// the state "" is the implicit sink.
+type testGraph struct {
+	f        *FSM
+	table    map[string]map[string]deltaEdge
+	alphabet []string
+}
+
+// next follows input from s, to the sink when there is no transition.
+func (g testGraph) next(s, input string) deltaEdge {
+	return g.table[s][input] // the zero edge leads to the sink
+}
+
+// access returns the states reachable from the initial state, in
+// breadth-first order, with the shortest input sequence reaching each.
+// The sink is not included.
+func (g testGraph) access() ([]string, map[string][]string) {
+	paths := map[string][]string{g.f.Initial: {}}
+	order := []string{g.f.Initial}
+	for i := 0; i < len(order); i++ {
+		s := order[i]
+		for _, in := range g.alphabet {
+			to := g.next(s, in).to
+			if _, ok := paths[to]; ok || to == "" {
+				continue
+			}
+			paths[to] = appendPath(paths[s], in)
+			order = append(order, to)
+		}
+	}
+	return order, paths
+}
+
+// transitionTour returns sequences from the initial state that between
+// them take every reachable transition. Each extends its walk by the
+// shortest path to a transition not yet taken, and a new sequence starts
+// when none can be reached.
+func (g testGraph) transitionTour() [][]string {
+	type edge struct{ from, input string }
+	states, _ := g.access()
+	uncovered := 0
+	covered := make(map[edge]bool)
+	for _, s := range states {
+		for _, in := range g.alphabet {
+			if g.next(s, in).to != "" {
+				uncovered++
+			}
+		}
+	}
+
+	var sequences [][]string
+	for uncovered > 0 || sequences == nil {
+		cur, seq := g.f.Initial, []string{}
+		for uncovered > 0 {
+			// Breadth-first search for the nearest untaken transition.
+			prev := map[string]edge{cur: {}}
+			queue := []string{cur}
+			var found *edge
+			for len(queue) > 0 && found == nil {
+				s := queue[0]
+				queue = queue[1:]
+				for _, in := range g.alphabet {
+					to := g.next(s, in).to
+					if to == "" {
+						continue
+					}
+					if !covered[edge{s, in}] {
+						found = &edge{s, in}
+						break
+					}
+					if _, ok := prev[to]; !ok {
+						prev[to] = edge{s, in}
+						queue = append(queue, to)
+					}
+				}
+			}
+			if found == nil {
+				break
+			}
+			var path []edge
+			for s := found.from; s != cur; s = prev[s].from {
+				path = append(path, prev[s])
+			}
+			for i := len(path) - 1; i >= 0; i-- {
+				seq = append(seq, path[i].input)
+			}
+			seq = append(seq, found.input)
+			// Every transition on the way is taken too.
+			s := cur
+			for _, in := range seq[len(seq)-len(path)-1:] {
+				if e := (edge{s, in}); !covered[e] {
+					covered[e] = true
+					uncovered--
+				}
+				s = g.next(s, in).to
+			}
+			cur = s
+		}
+		sequences = append(sequences, seq)
+	}
+	return sequences
+}
+
+// wMethod returns P·Σ^≤extra·(W ∪ {ε}), where P is the transition
+// cover (a shortest sequence to each reachable state, alone and followed
+// by each input) and W a characterisation set (a shortest sequence
+// telling each pair of distinguishable states apart, the sink included).
+func (g testGraph) wMethod(extra int) [][]string {
+	states, paths := g.access()
+
+	cover := [][]string{{}}
+	for _, s := range states {
+		for _, in := range g.alphabet {
+			cover = append(cover, appendPath(paths[s], in))
+		}
+	}
+
+	w := [][]string{{}}
+	seen := map[string]bool{"": true}
+	all := append(append([]string{}, states...), "")
+	for i, s := range all {
+		for _, t := range all[i+1:] {
+			seq, ok := g.distinguish(s, t)
+			if !ok {
+				continue
+			}
+			if key := strings.Join(seq, "\x00"); !seen[key] {
+				seen[key] = true
+				w = append(w, seq)
+			}
+		}
+	}
+	sort.SliceStable(w, func(i, j int) bool { return len(w[i]) < len(w[j]) })
+
+	middles := [][]string{{}}
+	layer := [][]string{{}}
+	for k := 0; k < extra; k++ {
+		var grown [][]string
+		for _, m := range layer {
+			for _, in := range g.alphabet {
+				grown = append(grown, appendPath(m, in))
+			}
+		}
+		middles = append(middles, grown...)
+		layer = grown
+	}
+
+	var sequences [][]string
+	for _, p := range cover {
+		for _, m := range middles {
+			for _, suffix := range w {
+				seq := append(append(append([]string{}, p...), m...), suffix...)
+				sequences = append(sequences, seq)
+			}
+		}
+	}
+	return sequences
+}
+
+// distinguish returns a shortest input sequence after which states s
+// and t are seen to differ, in acceptance or in output, as Equivalent
+// searches two machines.
+func (g testGraph) distinguish(s, t string) ([]string, bool) {
+	type pair struct{ a, b string }
+	type node struct {
+		p    pair
+		path []string
+	}
+	observe := func(s string) (bool, string) {
+		if s == "" {
+			return false, ""
+		}
+		return g.f.IsAccepting(s), g.f.StateOutputs[s]
+	}
+
+	start := pair{s, t}
+	seen := map[pair]bool{start: true}
+	queue := []node{{p: start, path: []string{}}}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		accA, outA := observe(n.p.a)
+		accB, outB := observe(n.p.b)
+		if accA != accB || outA != outB {
+			return n.path, true
+		}
+		for _, in := range g.alphabet {
+			ea, eb := g.next(n.p.a, in), g.next(n.p.b, in)
+			if ea.output != eb.output {
+				return appendPath(n.path, in), true
+			}
+			next := pair{ea.to, eb.to}
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, node{p: next, path: appendPath(n.path, in)})
+			}
+		}
+	}
+	return nil, false
+}
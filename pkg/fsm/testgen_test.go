@@ -0,0 +1,107 @@
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGenerateTests_TransitionTour(t *testing.T) {
+	f := turnstile("locked", "unlocked", "alarm")
+	cases, err := GenerateTests(f, TestGenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken := make(map[string]bool)
+	for _, tc := range cases {
+		r, _ := NewRunner(f)
+		if _, err := r.Run(tc.Inputs); err != nil {
+			t.Errorf("%v: %v", tc.Inputs, err)
+		}
+		for _, s := range r.History() {
+			taken[s.FromState+" "+s.Input] = true
+		}
+	}
+	if len(taken) != len(f.Transitions) {
+		t.Errorf("tour %+v took %v", cases, taken)
+	}
+	if len(cases) != 1 {
+		t.Errorf("a strongly connected machine needs one sequence, got %+v", cases)
+	}
+	if cases[0].Outputs == nil {
+		t.Error("Mealy test case without outputs")
+	}
+}
+
+func TestGenerateTests_WMethodFindsMutants(t *testing.T) {
+	spec := turnstile("locked", "unlocked", "alarm")
+	cases, err := GenerateTests(spec, TestGenOptions{Method: TestWMethod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := func(f *FSM) int {
+		n := 0
+		for _, tc := range cases {
+			got, err := RunTestCase(f, tc.Inputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.Matches(got) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := failures(spec); n != 0 {
+		t.Fatalf("%d cases fail on the specification", n)
+	}
+
+	mutants := map[string]func(f *FSM){
+		"output": func(f *FSM) { f.Transitions[1].Output = strp("click") },
+		// Same output, wrong target: only a later input tells.
+		"transfer": func(f *FSM) { f.Transitions[2].To = []string{"unlocked"} },
+		"missing":  func(f *FSM) { f.Transitions = f.Transitions[:2] },
+		"extra":    func(f *FSM) { f.AddTransition("unlocked", strp("coin"), []string{"locked"}, nil) },
+	}
+	for name, mutate := range mutants {
+		m := spec.Clone()
+		mutate(m)
+		if failures(m) == 0 {
+			t.Errorf("%s mutant passes", name)
+		}
+	}
+}
+
+func TestGenerateTests_Sink(t *testing.T) {
+	// A DFA accepting "ab": the W-method checks that other inputs are
+	// refused.
+	f := New(TypeDFA)
+	f.States = []string{"s", "a", "ok"}
+	f.Initial = "s"
+	f.Alphabet = []string{"a", "b"}
+	f.Accepting = []string{"ok"}
+	f.AddTransition("s", strp("a"), []string{"a"}, nil)
+	f.AddTransition("a", strp("b"), []string{"ok"}, nil)
+
+	cases, err := GenerateTests(f, TestGenOptions{Method: TestWMethod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stuck, accept bool
+	for _, tc := range cases {
+		stuck = stuck || fmt.Sprint(tc.Inputs) == "[b]" && tc.Stuck
+		accept = accept || fmt.Sprint(tc.Inputs) == "[a b]" && tc.Accept
+		if tc.Outputs != nil {
+			t.Errorf("DFA test case with outputs: %+v", tc)
+		}
+	}
+	if !stuck || !accept {
+		t.Errorf("cases %+v", cases)
+	}
+
+	if _, err := GenerateTests(anbnPDA(), TestGenOptions{}); err == nil {
+		t.Error("PDA accepted")
+	}
+	if _, err := GenerateTests(f, TestGenOptions{Method: "random"}); err == nil {
+		t.Error("unknown method accepted")
+	}
+}
@@ -0,0 +1,99 @@
+package fsm
+
+import (
+	"sort"
+	"strings"
+)
+
+// SetVar sets a variable that outputs can refer to (see ExpandOutput).
+// Variables belong to the runner instance: they survive Reset, and Clone
+// and Snapshot copy them.
+func (r *Runner) SetVar(name, value string) {
+	if r.vars == nil {
+		r.vars = make(map[string]string)
+	}
+	r.vars[name] = value
+}
+
+// UnsetVar removes a variable.
+func (r *Runner) UnsetVar(name string) {
+	delete(r.vars, name)
+}
+
+// Var returns the value of a variable and whether it is set.
+func (r *Runner) Var(name string) (string, bool) {
+	v, ok := r.vars[name]
+	return v, ok
+}
+
+// Vars returns the names of the variables set, sorted.
+func (r *Runner) Vars() []string {
+	names := make([]string, 0, len(r.vars))
+	for n := range r.vars {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandOutput expands an output template. Outputs may refer to
+// variables by name between percent signs, so that an output carries a
+// payload rather than a fixed string: with user set to "ada" in vars,
+// "grant(%user%)" expands to "grant(ada)". "%%" is a literal percent
+// sign. References to variables not in vars, and text between percent
+// signs that is not a variable name, are left as they are.
+//
+// The template, not its expansion, is the symbol in OutputAlphabet. A
+// Runner expands the outputs it emits with its own variables (see
+// Runner.SetVar); CompiledRunner and generated code, which deal in
+// output IDs, do not.
+func ExpandOutput(template string, vars map[string]string) string {
+	if len(vars) == 0 && !strings.Contains(template, "%%") {
+		return template
+	}
+	var sb strings.Builder
+	rest := template
+	for {
+		i := strings.IndexByte(rest, '%')
+		if i < 0 {
+			break
+		}
+		sb.WriteString(rest[:i])
+		rest = rest[i+1:]
+		j := strings.IndexByte(rest, '%')
+		if j < 0 {
+			sb.WriteByte('%')
+			break
+		}
+		name := rest[:j]
+		if name == "" {
+			sb.WriteByte('%')
+			rest = rest[1:]
+			continue
+		}
+		if v, ok := vars[name]; ok && isVarName(name) {
+			sb.WriteString(v)
+			rest = rest[j+1:]
+			continue
+		}
+		// Not a reference: keep the percent sign, and let the closing
+		// one open the next reference.
+		sb.WriteByte('%')
+	}
+	sb.WriteString(rest)
+	return sb.String()
+}
+
+// isVarName reports whether name can be a variable reference: letters,
+// digits, underscores, dots, and hyphens.
+func isVarName(name string) bool {
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_' || c == '.' || c == '-':
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
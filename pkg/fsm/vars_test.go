@@ -0,0 +1,65 @@
+package fsm
+
+import "testing"
+
+func TestExpandOutput(t *testing.T) {
+	vars := map[string]string{"user": "ada", "door.id": "7", "pct": "%user%"}
+	for _, tc := range []struct{ in, want string }{
+		{"grant(%user%)", "grant(ada)"},
+		{"open %door.id% for %user%", "open 7 for ada"},
+		{"100%%", "100%"},
+		{"%unset%", "%unset%"},
+		{"50% off %user%", "50% off ada"},
+		{"%not a name%user%", "%not a nameada"},
+		{"trailing %", "trailing %"},
+		{"%pct%", "%user%"}, // values are not expanded again
+		{"plain", "plain"},
+	} {
+		if got := ExpandOutput(tc.in, vars); got != tc.want {
+			t.Errorf("ExpandOutput(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRunner_Vars(t *testing.T) {
+	f := New(TypeMealy)
+	f.AddState("locked")
+	f.AddState("open")
+	f.AddInput("badge")
+	f.AddInput("close")
+	f.AddOutput("grant(%user%)")
+	f.AddOutput("lock")
+	f.SetInitial("locked")
+	f.AddTransition("locked", strp("badge"), []string{"open"}, strp("grant(%user%)"))
+	f.AddTransition("open", strp("close"), []string{"locked"}, strp("lock"))
+	r, err := NewRunner(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out, _ := r.Step("badge"); out != "grant(%user%)" {
+		t.Errorf("output without variables = %q, want the template", out)
+	}
+	r.Reset()
+	r.SetVar("user", "ada")
+	if out, _ := r.Step("badge"); out != "grant(ada)" {
+		t.Errorf("output = %q, want grant(ada)", out)
+	}
+	if h := r.History(); h[len(h)-1].Output != "grant(ada)" {
+		t.Errorf("history recorded %q, want the expansion", h[len(h)-1].Output)
+	}
+
+	c := r.Clone()
+	c.SetVar("user", "bob")
+	if v, _ := r.Var("user"); v != "ada" {
+		t.Errorf("setting a clone's variable changed the original's to %q", v)
+	}
+	r.Reset()
+	if names := r.Vars(); len(names) != 1 || names[0] != "user" {
+		t.Errorf("variables after Reset = %v, want [user]", names)
+	}
+	r.UnsetVar("user")
+	if _, ok := r.Var("user"); ok {
+		t.Error("UnsetVar left the variable set")
+	}
+}
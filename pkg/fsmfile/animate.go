@@ -0,0 +1,99 @@
+package fsmfile
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// AnimationOptions configures RenderTraceGIF.
+type AnimationOptions struct {
+	PNGOptions     // frame size, fonts, and title
+	Delay      int // time per frame in hundredths of a second (0 = 100)
+	Hold       int // extra time on the last frame, likewise (0 = 2 * Delay)
+}
+
+// DefaultAnimationOptions returns sensible defaults: the PNG defaults
+// and one second per step.
+func DefaultAnimationOptions() AnimationOptions {
+	return AnimationOptions{
+		PNGOptions: DefaultPNGOptions(),
+		Delay:      100,
+	}
+}
+
+// RenderTraceGIF writes an animated GIF of f running inputs, built from
+// native PNG frames: one for the initial state and one per input, each
+// highlighting the active states and the transitions just taken. Frame
+// titles show the step, the input, and the states reached. The GIF
+// loops forever.
+//
+// If an input has no transition, the animation stops at the last state
+// reached; the GIF is still written and a *TraceError is returned.
+func RenderTraceGIF(f *fsm.FSM, w io.Writer, inputs []string, opts AnimationOptions) error {
+	if opts.Delay <= 0 {
+		opts.Delay = 100
+	}
+	if opts.Hold <= 0 {
+		opts.Hold = 2 * opts.Delay
+	}
+	steps, traceErr := TraceSteps(f, inputs)
+	if steps == nil {
+		return traceErr
+	}
+
+	anim := &gif.GIF{}
+	for i, step := range steps {
+		frameOpts := opts.PNGOptions
+		frameOpts.Highlight = step
+		frameOpts.Title = frameTitle(opts.Title, i, inputs, step)
+		img := RenderImage(f, frameOpts)
+
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.Draw(frame, frame.Bounds(), img, image.Point{}, draw.Src)
+		delay := opts.Delay
+		if i == len(steps)-1 {
+			delay += opts.Hold
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return err
+	}
+	return traceErr
+}
+
+// frameTitle captions frame i of a trace animation, e.g.
+// "Turnstile  2/3: push → locked".
+func frameTitle(title string, i int, inputs []string, step *Highlight) string {
+	caption := "start: " + stepStates(step)
+	if i > 0 {
+		caption = fmt.Sprintf("%d/%d: %s → %s", i, len(inputs), inputs[i-1], stepStates(step))
+	}
+	if title == "" {
+		return caption
+	}
+	return title + "  " + caption
+}
+
+// stepStates formats the active states of a step, braced if there are
+// several (as Runner.CurrentState does).
+func stepStates(step *Highlight) string {
+	states := make([]string, 0, len(step.States))
+	for s := range step.States {
+		states = append(states, s)
+	}
+	sort.Strings(states)
+	if len(states) == 1 {
+		return states[0]
+	}
+	return "{" + strings.Join(states, ", ") + "}"
+}
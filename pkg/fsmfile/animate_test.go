@@ -0,0 +1,65 @@
+package fsmfile
+
+import (
+	"bytes"
+	"errors"
+	"image/gif"
+	"testing"
+)
+
+func TestRenderTraceGIF_FramePerStep(t *testing.T) {
+	opts := DefaultAnimationOptions()
+	opts.Width, opts.Height = 320, 240
+	opts.Delay = 50
+	var buf bytes.Buffer
+	if err := RenderTraceGIF(highlightTestFSM(), &buf, []string{"x", "y", "x"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("output is not a GIF: %v", err)
+	}
+	if len(g.Image) != 4 {
+		t.Fatalf("%d frames, want 4 (start plus one per input)", len(g.Image))
+	}
+	want := []int{50, 50, 50, 150}
+	for i, d := range g.Delay {
+		if d != want[i] {
+			t.Errorf("frame %d delay = %d, want %d", i, d, want[i])
+		}
+	}
+	if b := g.Image[0].Bounds(); b.Dx() != 320 || b.Dy() != 240 {
+		t.Errorf("frame size = %v, want 320x240", b)
+	}
+}
+
+func TestRenderTraceGIF_StopsAtRejectedInput(t *testing.T) {
+	opts := DefaultAnimationOptions()
+	opts.Width, opts.Height = 320, 240
+	var buf bytes.Buffer
+	err := RenderTraceGIF(highlightTestFSM(), &buf, []string{"x", "x", "y"}, opts)
+	var traceErr *TraceError
+	if !errors.As(err, &traceErr) || traceErr.Step != 2 || traceErr.Input != "x" {
+		t.Fatalf("err = %v, want a TraceError for input 2", err)
+	}
+	g, decErr := gif.DecodeAll(&buf)
+	if decErr != nil {
+		t.Fatalf("partial animation not written: %v", decErr)
+	}
+	if len(g.Image) != 2 {
+		t.Errorf("%d frames, want 2", len(g.Image))
+	}
+}
+
+func TestFrameTitle(t *testing.T) {
+	steps, err := TraceSteps(highlightTestFSM(), []string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := frameTitle("", 0, []string{"x"}, steps[0]); got != "start: a" {
+		t.Errorf("start title = %q", got)
+	}
+	if got := frameTitle("M", 1, []string{"x"}, steps[1]); got != "M  1/1: x → b" {
+		t.Errorf("step title = %q", got)
+	}
+}
@@ -0,0 +1,434 @@
+package fsmfile
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// CellFunc sets one character cell of a character-grid diagram. The
+// drawing functions below call it only for cells inside the grid; a
+// terminal caller binds its colour into the function.
+type CellFunc func(x, y int, r rune)
+
+// ASCIIStateLabel returns the text drawn for a state: its name in
+// brackets, prefixed with → if initial (○ otherwise) and suffixed with *
+// if accepting or ↗ if it links to another machine.
+func ASCIIStateLabel(f *fsm.FSM, name string) string {
+	prefix, suffix := "○", ""
+	if f.IsLinked(name) {
+		suffix = "↗"
+	}
+	if f.Initial == name {
+		prefix = "→"
+	}
+	if f.IsAccepting(name) {
+		suffix = "*"
+	}
+	return prefix + "[" + name + "]" + suffix
+}
+
+// ASCIIArcOffset spreads parallel arcs between the same two states: it
+// returns the offset, in cells, of arc idx out of total.
+func ASCIIArcOffset(idx, total int) int {
+	if total <= 1 {
+		return 0
+	}
+	if total%2 == 0 {
+		return (idx-total/2)*2 + 1
+	}
+	return (idx - (total-1)/2) * 2
+}
+
+// RenderASCII draws f as a character-cell diagram in the style of the
+// fsmedit canvas, with box-drawing characters and arrows. States go
+// where layout places them (as saved by fsmedit), or, if layout is nil,
+// where SmartLayoutTUI places them on a width×height grid. The grid grows
+// to fit every state, and surrounding blank rows and columns are trimmed.
+// Use PlainASCII for 7-bit output.
+func RenderASCII(f *fsm.FSM, layout *Layout, width, height int) string {
+	diagram, _ := RenderASCIIContext(context.Background(), f, layout, width, height)
+	return diagram
+}
+
+// RenderASCIIContext is RenderASCII, stopping with ctx's error if ctx is
+// done before the layout is.
+func RenderASCIIContext(ctx context.Context, f *fsm.FSM, layout *Layout, width, height int) (string, error) {
+	var positions map[string][2]int
+	if layout != nil {
+		positions = savedPositions(f, layout)
+	}
+	if positions == nil {
+		var err error
+		if positions, err = smartLayoutTUI(ctx, f, width, height); err != nil {
+			return "", err
+		}
+	}
+	for name, p := range positions {
+		if w := p[0] + len([]rune(ASCIIStateLabel(f, name))) + 1; w > width {
+			width = w
+		}
+		if h := p[1] + 2; h > height {
+			height = h
+		}
+	}
+	for _, t := range f.Transitions {
+		for _, to := range t.To {
+			if t.From != to {
+				continue
+			}
+			// Self-loop labels sit to the right of the loop.
+			p := positions[t.From]
+			label := transitionCellLabel(f, t)
+			if w := p[0] + len(t.From)/2 + 8 + len([]rune(label)); w > width {
+				width = w
+			}
+		}
+	}
+
+	grid := make([][]rune, height)
+	for y := range grid {
+		grid[y] = []rune(strings.Repeat(" ", width))
+	}
+	set := func(x, y int, r rune) {
+		if x >= 0 && x < width && y >= 0 && y < height {
+			grid[y][x] = r
+		}
+	}
+	drawString := func(x, y int, s string) {
+		for i, r := range []rune(s) {
+			set(x+i, y, r)
+		}
+	}
+
+	// Arcs first, so that states are drawn over them.
+	pairCount := make(map[[2]string]int)
+	for _, t := range f.Transitions {
+		for _, to := range t.To {
+			if t.From != to {
+				pairCount[pairKey(t.From, to)]++
+			}
+		}
+	}
+	pairIndex := make(map[[2]string]int)
+	for _, t := range f.Transitions {
+		from, ok := positions[t.From]
+		if !ok {
+			continue
+		}
+		for _, to := range t.To {
+			target, ok := positions[to]
+			if !ok {
+				continue
+			}
+			fromX := from[0] + len(t.From)/2 + 2
+			fromY := from[1]
+			toX := target[0] + len(to)/2 + 2
+			toY := target[1]
+			label := transitionCellLabel(f, t)
+			if t.From == to {
+				DrawASCIISelfLoop(set, fromX, fromY-1, label, width, height)
+				continue
+			}
+			key := pairKey(t.From, to)
+			offset := ASCIIArcOffset(pairIndex[key], pairCount[key])
+			pairIndex[key]++
+			DrawASCIIArc(set, fromX, fromY, toX, toY, label, offset, width, height)
+		}
+	}
+
+	for _, name := range f.States {
+		p, ok := positions[name]
+		if !ok {
+			continue
+		}
+		drawString(p[0], p[1], ASCIIStateLabel(f, name))
+		if f.IsLinked(name) {
+			if target := f.GetLinkedMachine(name); target != "" {
+				drawString(p[0]+2, p[1]+1, "→"+target)
+			}
+		} else if f.Type == fsm.TypeMoore {
+			if out, ok := f.StateOutputs[name]; ok {
+				drawString(p[0]+2, p[1]+1, "/"+out)
+			}
+		}
+	}
+
+	lines := make([]string, 0, height)
+	for _, row := range grid {
+		lines = append(lines, strings.TrimRight(string(row), " "))
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	indent := -1
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= indent {
+			lines[i] = line[indent:]
+		}
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// plainReplacer maps the characters RenderASCII uses to 7-bit ASCII.
+var plainReplacer = strings.NewReplacer(
+	"─", "-", "│", "|", "╭", "+", "╮", "+", "╰", "+", "╯", "+",
+	"→", ">", "←", "<", "↑", "^", "↓", "v", "○", "o", "↗", "&", "ε", "e",
+)
+
+// PlainASCII replaces the box-drawing characters and arrows in a
+// RenderASCII diagram with 7-bit equivalents, for logs and terminals
+// that cannot show Unicode. Other characters, such as those in state
+// names, are left alone.
+func PlainASCII(s string) string {
+	return plainReplacer.Replace(s)
+}
+
+// pairKey returns the same key for a->b and b->a.
+func pairKey(a, b string) [2]string {
+	if a < b {
+		return [2]string{a, b}
+	}
+	return [2]string{b, a}
+}
+
+// transitionCellLabel is the arc label of a transition: its input (ε for
+// epsilon), followed by /output on Mealy machines and the bracketed
+// stack operation on PDAs.
+func transitionCellLabel(f *fsm.FSM, t fsm.Transition) string {
+	label := "ε"
+	if t.Input != nil {
+		label = *t.Input
+	}
+	if f.Type == fsm.TypeMealy && t.Output != nil {
+		label += "/" + *t.Output
+	}
+	if f.Type == fsm.TypePDA {
+		label += " [" + t.StackLabel() + "]"
+	}
+	return label
+}
+
+// DrawASCIISelfLoop draws a loop above the cell (x, y) with the label to
+// its right:
+//
+//	╭──╮
+//	│  │ label
+//	╰─→╯
+//
+// w and h bound the grid.
+func DrawASCIISelfLoop(set CellFunc, x, y int, label string, w, h int) {
+	if y < 2 || x < 1 || x >= w-6 {
+		return
+	}
+
+	loopY := y - 2
+
+	// Top of loop
+	set(x, loopY, '╭')
+	set(x+1, loopY, '─')
+	set(x+2, loopY, '─')
+	set(x+3, loopY, '╮')
+
+	// Sides, with the label to the right of the loop
+	if loopY+1 < h {
+		set(x, loopY+1, '│')
+		set(x+3, loopY+1, '│')
+		drawCellLabel(set, x+5, loopY+1, label, w, h)
+	}
+
+	// Bottom connects back with arrow
+	if loopY+2 < h {
+		set(x, loopY+2, '╰')
+		set(x+1, loopY+2, '─')
+		set(x+2, loopY+2, '→')
+		set(x+3, loopY+2, '╯')
+	}
+}
+
+// DrawASCIIArc draws an arrow between the cells (fromX, fromY) and (toX,
+// toY): straight if they share a row or column, otherwise L-shaped,
+// horizontal first. offset shifts parallel arcs apart (see
+// ASCIIArcOffset). w and h bound the grid.
+func DrawASCIIArc(set CellFunc, fromX, fromY, toX, toY int, label string, offset int, w, h int) {
+	set = clipCells(set, w, h)
+	switch {
+	case toY == fromY:
+		// Horizontal line - offset vertically
+		drawHorizontalArc(set, fromX, fromY+offset, toX, label, w, h)
+	case toX == fromX:
+		// Vertical line - offset horizontally
+		drawVerticalArc(set, fromX+offset, fromY, toY, label, w, h)
+	default:
+		// Diagonal - use L-shaped path with offset
+		drawLShapedArc(set, fromX, fromY, toX, toY, label, offset, w, h)
+	}
+}
+
+// clipCells wraps set so that it ignores cells outside a w×h grid.
+func clipCells(set CellFunc, w, h int) CellFunc {
+	return func(x, y int, r rune) {
+		if x >= 0 && x < w && y >= 0 && y < h {
+			set(x, y, r)
+		}
+	}
+}
+
+func drawCellLabel(set CellFunc, x, y int, label string, w, h int) {
+	if y < 0 || y >= h {
+		return
+	}
+	for i, r := range []rune(label) {
+		if x+i >= 0 && x+i < w {
+			set(x+i, y, r)
+		}
+	}
+}
+
+func drawHorizontalArc(set CellFunc, fromX, y, toX int, label string, w, h int) {
+	if y < 0 || y >= h {
+		return
+	}
+
+	minX, maxX := fromX, toX
+	goingRight := true
+	if fromX > toX {
+		minX, maxX = toX, fromX
+		goingRight = false
+	}
+
+	for x := minX + 1; x < maxX; x++ {
+		set(x, y, '─')
+	}
+
+	// Arrow at destination
+	if goingRight {
+		set(maxX-1, y, '→')
+	} else {
+		set(minX+1, y, '←')
+	}
+
+	// Label above the midpoint
+	midX := (minX+maxX)/2 - len(label)/2
+	if y > 0 {
+		drawCellLabel(set, midX, y-1, label, w, h)
+	}
+}
+
+func drawVerticalArc(set CellFunc, x, fromY, toY int, label string, w, h int) {
+	if x < 0 || x >= w {
+		return
+	}
+
+	minY, maxY := fromY, toY
+	goingDown := true
+	if fromY > toY {
+		minY, maxY = toY, fromY
+		goingDown = false
+	}
+
+	for y := minY + 1; y < maxY; y++ {
+		set(x, y, '│')
+	}
+
+	// Arrow at destination
+	if goingDown {
+		set(x, maxY-1, '↓')
+	} else {
+		set(x, minY+1, '↑')
+	}
+
+	// Label beside the midpoint
+	drawCellLabel(set, x+1, (minY+maxY)/2, label, w, h)
+}
+
+func drawLShapedArc(set CellFunc, fromX, fromY, toX, toY int, label string, offset int, w, h int) {
+	// Go horizontal first, then vertical. The offset moves the corner to
+	// separate parallel arcs.
+	cornerX := toX + offset
+	cornerY := fromY
+
+	// Horizontal segment
+	if fromX != cornerX {
+		minX, maxX := fromX, cornerX
+		if fromX > cornerX {
+			minX, maxX = cornerX, fromX
+		}
+		for x := minX + 1; x < maxX; x++ {
+			set(x, cornerY, '─')
+		}
+	}
+
+	// Corner
+	var cornerChar rune
+	switch {
+	case toX > fromX && toY > fromY:
+		cornerChar = '╮' // going right then down
+	case toX > fromX && toY < fromY:
+		cornerChar = '╯' // going right then up
+	case toX < fromX && toY > fromY:
+		cornerChar = '╭' // going left then down
+	default:
+		cornerChar = '╰' // going left then up
+	}
+	set(cornerX, cornerY, cornerChar)
+
+	// Vertical segment from corner to target
+	if cornerY != toY {
+		minY, maxY := cornerY, toY
+		goingDown := true
+		if cornerY > toY {
+			minY, maxY = toY, cornerY
+			goingDown = false
+		}
+		for y := minY + 1; y < maxY; y++ {
+			set(cornerX, y, '│')
+		}
+
+		// With an offset, a horizontal connector reaches the target column
+		if offset != 0 && cornerX != toX {
+			connY := minY + 1
+			if goingDown {
+				connY = maxY - 1
+			}
+			minCX, maxCX := cornerX, toX
+			if cornerX > toX {
+				minCX, maxCX = toX, cornerX
+			}
+			for cx := minCX + 1; cx < maxCX; cx++ {
+				set(cx, connY, '─')
+			}
+		}
+
+		// Arrow at end
+		if goingDown {
+			set(cornerX, maxY-1, '↓')
+		} else {
+			set(cornerX, minY+1, '↑')
+		}
+	}
+
+	// Label near the corner
+	labelX := (fromX+cornerX)/2 - len(label)/2
+	labelY := cornerY - 1
+	if labelY < 0 {
+		labelY = cornerY + 1
+	}
+	drawCellLabel(set, labelX, labelY, label, w, h)
+}
@@ -0,0 +1,82 @@
+package fsmfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func asciiTestLayout() *Layout {
+	return &Layout{States: map[string]StateLayout{
+		"a": {X: 0, Y: 3},
+		"b": {X: 20, Y: 3},
+		"c": {X: 20, Y: 10},
+	}}
+}
+
+func TestRenderASCII_Layout(t *testing.T) {
+	got := RenderASCII(highlightTestFSM(), asciiTestLayout(), 40, 20)
+	want := `            x
+→[a]────────────────○[b]
+  ↑                   │
+  │                   │
+  │                   │y
+  │                   ╭──╮
+  │                   │  │ y
+  │         x         ╰─→╯
+  ╰─────────────────○[c]*
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderASCII_AutoLayout(t *testing.T) {
+	f := highlightTestFSM()
+	out := RenderASCII(f, nil, 80, 24)
+	for _, want := range []string{"→[a]", "○[b]", "○[c]*"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if again := RenderASCII(f, nil, 80, 24); again != out {
+		t.Errorf("output differs between runs:\n%s\n%s", out, again)
+	}
+}
+
+func TestRenderASCII_GrowsToFit(t *testing.T) {
+	// The saved positions lie outside the requested grid.
+	out := RenderASCII(highlightTestFSM(), asciiTestLayout(), 10, 5)
+	if !strings.Contains(out, "○[c]*") {
+		t.Errorf("state c clipped:\n%s", out)
+	}
+}
+
+func TestPlainASCII(t *testing.T) {
+	out := PlainASCII(RenderASCII(highlightTestFSM(), asciiTestLayout(), 40, 20))
+	for _, r := range out {
+		if r > 0x7f {
+			t.Fatalf("non-ASCII %q in:\n%s", r, out)
+		}
+	}
+	if !strings.Contains(out, ">[a]----") || !strings.Contains(out, "+->+") {
+		t.Errorf("unexpected plain output:\n%s", out)
+	}
+}
+
+func TestASCIIArcOffset(t *testing.T) {
+	tests := []struct {
+		total int
+		want  []int
+	}{
+		{1, []int{0}},
+		{2, []int{-1, 1}},
+		{3, []int{-2, 0, 2}},
+	}
+	for _, tt := range tests {
+		for idx, want := range tt.want {
+			if got := ASCIIArcOffset(idx, tt.total); got != want {
+				t.Errorf("ASCIIArcOffset(%d, %d) = %d, want %d", idx, tt.total, got, want)
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package fsmfile
 
 import (
+	"context"
+	"log/slog"
 	"math"
 	"sort"
 
@@ -21,7 +23,15 @@ const (
 // AutoLayout generates positions for FSM states.
 // Returns map of state name to [x, y] coordinates.
 func AutoLayout(f *fsm.FSM, algorithm LayoutAlgorithm, width, height int) map[string][2]int {
+	positions, _ := autoLayout(context.Background(), f, algorithm, width, height)
+	return positions
+}
+
+// autoLayout is AutoLayout, stopping with ctx's error if ctx is done
+// before the layout is.
+func autoLayout(ctx context.Context, f *fsm.FSM, algorithm LayoutAlgorithm, width, height int) (map[string][2]int, error) {
 	var positions map[string][2]int
+	var err error
 	
 	switch algorithm {
 	case LayoutCircular:
@@ -29,12 +39,15 @@ func AutoLayout(f *fsm.FSM, algorithm LayoutAlgorithm, width, height int) map[st
 	case LayoutHierarchical:
 		positions = layoutHierarchical(f, width, height)
 	case LayoutForceDirected:
-		positions = layoutForceDirected(f, width, height)
+		positions, err = forceDirected(ctx, f, width, height)
 	case LayoutSugiyama:
-		positions = SugiyamaLayout(f, width, height)
+		positions, err = sugiyamaLayout(ctx, f, width, height)
 	default:
 		positions = layoutGrid(f, width, height)
 	}
+	if err != nil {
+		return nil, err
+	}
 	
 	// Estimate label width
 	maxLabelWidth := 8
@@ -50,37 +63,55 @@ func AutoLayout(f *fsm.FSM, algorithm LayoutAlgorithm, width, height int) map[st
 	// Clamp to bounds
 	positions = clampToBounds(positions, width, height, maxLabelWidth)
 	
-	return positions
+	return positions, nil
 }
 
 // SmartLayout chooses the best algorithm based on FSM structure.
 // Prefers Sugiyama for most cases as it produces the cleanest layouts.
 func SmartLayout(f *fsm.FSM, width, height int) map[string][2]int {
+	positions, _ := smartLayout(context.Background(), f, width, height)
+	return positions
+}
+
+// smartLayout is SmartLayout, stopping with ctx's error if ctx is done
+// before the layout is.
+func smartLayout(ctx context.Context, f *fsm.FSM, width, height int) (map[string][2]int, error) {
 	n := len(f.States)
 	
 	if n == 0 {
-		return make(map[string][2]int)
+		return make(map[string][2]int), nil
 	}
 	
 	// Analyse structure
 	hasCyclic := hasCycles(f)
 	density := float64(len(f.Transitions)) / float64(n*n)
 	
+	log := loggerFrom(ctx)
+	
 	// Sugiyama works best for DAG-like structures (most FSMs)
 	if !hasCyclic || n <= 20 {
-		return SugiyamaLayout(f, width, height)
+		log.DebugContext(ctx, "layout engine", "engine", "sugiyama", "reason", "acyclic or at most 20 states",
+			"states", n, "cyclic", hasCyclic, "density", density)
+		return sugiyamaLayout(ctx, f, width, height)
 	}
 	
 	// For very dense cyclic graphs, force-directed may work better
 	if density > 0.3 {
-		return layoutForceDirected(f, width, height)
+		log.DebugContext(ctx, "layout engine", "engine", "force", "reason", "cyclic with density above 0.3",
+			"states", n, "density", density)
+		return forceDirected(ctx, f, width, height)
 	}
 	
 	// Default to Sugiyama
-	return SugiyamaLayout(f, width, height)
+	log.DebugContext(ctx, "layout engine", "engine", "sugiyama", "reason", "cyclic with density at most 0.3",
+		"states", n, "density", density)
+	return sugiyamaLayout(ctx, f, width, height)
 }
 
-// layoutGrid arranges states in a simple grid pattern.
+// layoutGrid arranges states in a near-square grid, row by row in
+// breadth-first order from the initial state, so that the initial state
+// is at the top left and its successors follow it. Columns are wide
+// enough for the longest label and rows share out the height.
 func layoutGrid(f *fsm.FSM, width, height int) map[string][2]int {
 	positions := make(map[string][2]int)
 	n := len(f.States)
@@ -93,15 +124,28 @@ func layoutGrid(f *fsm.FSM, width, height int) map[string][2]int {
 	if cols < 1 {
 		cols = 1
 	}
+	rows := (n + cols - 1) / cols
 	
 	// Calculate spacing
+	labelWidth := 0
+	for _, name := range f.States {
+		if len(name) > labelWidth {
+			labelWidth = len(name)
+		}
+	}
 	cellW := (width - 10) / cols
+	if cellW < labelWidth+6 {
+		cellW = labelWidth + 6
+	}
 	if cellW < 15 {
 		cellW = 15
 	}
-	cellH := 4
+	cellH := (height - 4) / rows
+	if cellH < 4 {
+		cellH = 4
+	}
 	
-	for i, name := range f.States {
+	for i, name := range orderByConnectivity(f) {
 		col := i % cols
 		row := i / cols
 		positions[name] = [2]int{
@@ -113,7 +157,11 @@ func layoutGrid(f *fsm.FSM, width, height int) map[string][2]int {
 	return positions
 }
 
-// layoutCircular arranges states in a circle with initial state at top.
+// layoutCircular places states evenly on a circle, the initial state at
+// the top and the others clockwise in depth-first order along their
+// transitions, so that a ring of states (a token-passing protocol, say)
+// goes round the circle in sequence. One row counts as two columns, so
+// the circle is round on screen and in the native renderers.
 func layoutCircular(f *fsm.FSM, width, height int) map[string][2]int {
 	positions := make(map[string][2]int)
 	n := len(f.States)
@@ -121,36 +169,65 @@ func layoutCircular(f *fsm.FSM, width, height int) map[string][2]int {
 		return positions
 	}
 	
-	// Centre and radius
-	centreX := width / 2
-	centreY := height / 2
-	
-	// Radius based on available space
-	radiusX := (width - 20) / 2
-	radiusY := (height - 6) / 2
-	if radiusX < 10 {
-		radiusX = 10
+	// Centre and radius, in columns
+	centreX := float64(width) / 2
+	centreY := float64(height) / 2
+	radius := math.Min(float64(width-20), float64(height-6)*2) / 2
+	if radius < 10 {
+		radius = 10
 	}
-	if radiusY < 4 {
-		radiusY = 4
+	if n == 1 {
+		radius = 0
 	}
 	
-	// Order states: initial first, then by connectivity
-	ordered := orderByConnectivity(f)
-	
-	for i, name := range ordered {
+	for i, name := range ringOrder(f) {
 		// Angle: start from top (-π/2), go clockwise
 		angle := -math.Pi/2 + 2*math.Pi*float64(i)/float64(n)
 		
-		x := centreX + int(float64(radiusX)*math.Cos(angle))
-		y := centreY + int(float64(radiusY)*math.Sin(angle))
+		x := centreX + radius*math.Cos(angle)
+		y := centreY + radius*math.Sin(angle)/2
 		
-		positions[name] = [2]int{x, y}
+		positions[name] = [2]int{int(math.Round(x)), int(math.Round(y))}
 	}
 	
 	return positions
 }
 
+// ringOrder lists states in depth-first preorder from the initial state,
+// following transitions in file order, then any states not reached, each
+// starting a new search. Successive states are usually joined by a
+// transition.
+func ringOrder(f *fsm.FSM) []string {
+	adj := buildAdjacency(f)
+	known := make(map[string]bool, len(f.States))
+	for _, name := range f.States {
+		known[name] = true
+	}
+	visited := make(map[string]bool, len(f.States))
+	result := make([]string, 0, len(f.States))
+	
+	var visit func(name string)
+	visit = func(name string) {
+		visited[name] = true
+		result = append(result, name)
+		for _, next := range adj[name] {
+			if known[next] && !visited[next] {
+				visit(next)
+			}
+		}
+	}
+	
+	if known[f.Initial] {
+		visit(f.Initial)
+	}
+	for _, name := range f.States {
+		if !visited[name] {
+			visit(name)
+		}
+	}
+	return result
+}
+
 // layoutHierarchical arranges states in layers based on distance from initial.
 func layoutHierarchical(f *fsm.FSM, width, height int) map[string][2]int {
 	positions := make(map[string][2]int)
@@ -260,127 +337,189 @@ func layoutHierarchical(f *fsm.FSM, width, height int) map[string][2]int {
 	return positions
 }
 
-// layoutForceDirected uses a simple force-directed algorithm.
+// layoutForceDirected places states with the Fruchterman–Reingold
+// algorithm: every pair of states repels, states joined by a transition
+// attract, and the step size cools over a fixed number of iterations.
+// Forces are computed in a square space (one row counts as two columns,
+// the aspect of a terminal cell) and the result is scaled to fill the
+// width×height grid. Starting positions lie on a spiral in
+// breadth-first order from the initial state, so the layout is
+// deterministic.
 func layoutForceDirected(f *fsm.FSM, width, height int) map[string][2]int {
+	positions, _ := forceDirected(context.Background(), f, width, height)
+	return positions
+}
+
+// forceDirected is layoutForceDirected, stopping with ctx's error if ctx
+// is done before the iterations are.
+func forceDirected(ctx context.Context, f *fsm.FSM, width, height int) (map[string][2]int, error) {
 	positions := make(map[string][2]int)
 	n := len(f.States)
 	if n == 0 {
-		return positions
+		return positions, nil
 	}
-	
-	// Initial positions: random-ish but deterministic
-	posX := make(map[string]float64)
-	posY := make(map[string]float64)
-	
-	for i, name := range f.States {
-		// Start with circular layout
-		angle := 2 * math.Pi * float64(i) / float64(n)
-		posX[name] = float64(width)/2 + float64(width)/3*math.Cos(angle)
-		posY[name] = float64(height)/2 + float64(height)/3*math.Sin(angle)
+
+	ordered := orderByConnectivity(f)
+	index := make(map[string]int, n)
+	for i, name := range ordered {
+		index[name] = i
 	}
-	
-	// Build edge set
-	edges := make(map[[2]string]bool)
+
+	// Undirected edges, once each, in transition order
+	var edges [][2]int
+	seen := make(map[[2]int]bool)
 	for _, t := range f.Transitions {
+		a, ok := index[t.From]
+		if !ok {
+			continue
+		}
 		for _, to := range t.To {
-			if t.From != to {
-				edges[[2]string{t.From, to}] = true
+			b, ok := index[to]
+			if !ok || a == b {
+				continue
+			}
+			key := [2]int{a, b}
+			if a > b {
+				key = [2]int{b, a}
+			}
+			if !seen[key] {
+				seen[key] = true
+				edges = append(edges, key)
 			}
 		}
 	}
-	
-	// Force-directed iterations
-	const iterations = 50
-	const repulsion = 500.0
-	const attraction = 0.1
-	const damping = 0.85
-	
+
+	spaceW := float64(width)
+	spaceH := float64(height) * 2
+	if spaceW < 10 {
+		spaceW = 10
+	}
+	if spaceH < 10 {
+		spaceH = 10
+	}
+	k := math.Sqrt(spaceW * spaceH / float64(n)) // ideal edge length
+
+	// Spiral start around the origin, golden angle apart
+	goldenAngle := math.Pi * (3 - math.Sqrt(5))
+	posX := make([]float64, n)
+	posY := make([]float64, n)
+	for i := range ordered {
+		r := k / 2 * math.Sqrt(float64(i)+0.5)
+		posX[i] = r * math.Cos(float64(i)*goldenAngle)
+		posY[i] = r * math.Sin(float64(i)*goldenAngle)
+	}
+
+	const iterations = 300
+	const gravity = 0.05 // pull towards the centre, keeps components together
+	start := spaceW / 10
+	dispX := make([]float64, n)
+	dispY := make([]float64, n)
+	log := loggerFrom(ctx)
+	debug := log.Enabled(ctx, slog.LevelDebug)
+	log.DebugContext(ctx, "force layout", "states", n, "edges", len(edges), "ideal_edge", k, "iterations", iterations)
+
 	for iter := 0; iter < iterations; iter++ {
-		// Calculate forces
-		forceX := make(map[string]float64)
-		forceY := make(map[string]float64)
-		
-		for _, name := range f.States {
-			forceX[name] = 0
-			forceY[name] = 0
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		
-		// Repulsion between all pairs
-		for i, a := range f.States {
-			for j, b := range f.States {
-				if i >= j {
-					continue
-				}
-				
-				dx := posX[a] - posX[b]
-				dy := posY[a] - posY[b]
-				dist := math.Sqrt(dx*dx + dy*dy)
-				if dist < 1 {
-					dist = 1
+		for i := range dispX {
+			dispX[i], dispY[i] = 0, 0
+		}
+
+		// Repulsion between all pairs: k²/d
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				dx := posX[i] - posX[j]
+				dy := posY[i] - posY[j]
+				dist := math.Hypot(dx, dy)
+				if dist < 0.01 {
+					// Coincident states: separate along a fixed direction
+					dx, dy, dist = 0.01, 0, 0.01
 				}
-				
-				force := repulsion / (dist * dist)
-				fx := force * dx / dist
-				fy := force * dy / dist
-				
-				forceX[a] += fx
-				forceY[a] += fy
-				forceX[b] -= fx
-				forceY[b] -= fy
+				force := k * k / dist
+				dispX[i] += dx / dist * force
+				dispY[i] += dy / dist * force
+				dispX[j] -= dx / dist * force
+				dispY[j] -= dy / dist * force
 			}
 		}
-		
-		// Attraction along edges
-		for edge := range edges {
-			a, b := edge[0], edge[1]
-			
-			dx := posX[b] - posX[a]
-			dy := posY[b] - posY[a]
-			dist := math.Sqrt(dx*dx + dy*dy)
-			
-			force := attraction * dist
-			fx := force * dx / dist
-			fy := force * dy / dist
-			
-			forceX[a] += fx
-			forceY[a] += fy
-			forceX[b] -= fx
-			forceY[b] -= fy
-		}
-		
-		// Apply forces with damping
-		for _, name := range f.States {
-			posX[name] += forceX[name] * damping
-			posY[name] += forceY[name] * damping
-			
-			// Keep within bounds
-			if posX[name] < 5 {
-				posX[name] = 5
-			}
-			if posX[name] > float64(width-15) {
-				posX[name] = float64(width - 15)
-			}
-			if posY[name] < 2 {
-				posY[name] = 2
+
+		// Attraction along edges: d²/k
+		for _, e := range edges {
+			a, b := e[0], e[1]
+			dx := posX[a] - posX[b]
+			dy := posY[a] - posY[b]
+			dist := math.Hypot(dx, dy)
+			if dist < 0.01 {
+				continue
 			}
-			if posY[name] > float64(height-2) {
-				posY[name] = float64(height - 2)
+			force := dist * dist / k
+			dispX[a] -= dx / dist * force
+			dispY[a] -= dy / dist * force
+			dispX[b] += dx / dist * force
+			dispY[b] += dy / dist * force
+		}
+
+		// Move each state at most temp, which cools linearly
+		temp := start * (1 - float64(iter)/iterations)
+		moved := 0.0
+		for i := 0; i < n; i++ {
+			dispX[i] -= gravity * posX[i]
+			dispY[i] -= gravity * posY[i]
+			disp := math.Hypot(dispX[i], dispY[i])
+			if disp < 1e-9 {
+				continue
 			}
+			step := math.Min(disp, temp)
+			posX[i] += dispX[i] / disp * step
+			posY[i] += dispY[i] / disp * step
+			moved += step
+		}
+		if debug && (iter%50 == 0 || iter == iterations-1) {
+			log.DebugContext(ctx, "force iteration", "iteration", iter, "temperature", temp, "mean_move", moved/float64(n))
 		}
 	}
-	
-	// Convert to integer positions
-	for name := range posX {
-		positions[name] = [2]int{
-			int(math.Round(posX[name])),
-			int(math.Round(posY[name])),
+
+	// Scale uniformly into the grid, leaving room for the widest label
+	labelWidth := 8
+	for _, name := range f.States {
+		if len(name)+4 > labelWidth {
+			labelWidth = len(name) + 4
 		}
 	}
-	
+	minX, maxX := posX[0], posX[0]
+	minY, maxY := posY[0], posY[0]
+	for i := 1; i < n; i++ {
+		minX = math.Min(minX, posX[i])
+		maxX = math.Max(maxX, posX[i])
+		minY = math.Min(minY, posY[i])
+		maxY = math.Max(maxY, posY[i])
+	}
+	availW := math.Max(float64(width-labelWidth-6), 1)
+	availH := math.Max(float64(height-4)*2, 1)
+	scale := 1.0
+	if maxX > minX || maxY > minY {
+		scale = math.Inf(1)
+		if maxX > minX {
+			scale = availW / (maxX - minX)
+		}
+		if maxY > minY {
+			scale = math.Min(scale, availH/(maxY-minY))
+		}
+	}
+	log.DebugContext(ctx, "force scale", "scale", scale, "width", maxX-minX, "height", maxY-minY)
+	offX := 2 + (availW-(maxX-minX)*scale)/2
+	offY := 2 + (availH-(maxY-minY)*scale)/2
+	for i, name := range ordered {
+		x := offX + (posX[i]-minX)*scale
+		y := (offY + (posY[i]-minY)*scale) / 2
+		positions[name] = [2]int{int(math.Round(x)), int(math.Round(y))}
+	}
+
 	// Snap to grid to avoid half-character positions
 	positions = snapToGrid(positions, 2, 1)
-	
-	return positions
+
+	return positions, nil
 }
 
 // Helper functions
@@ -0,0 +1,40 @@
+package fsmfile
+
+import (
+	"io"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// Benchmarks for layout and rendering, shared by the package's Go
+// benchmarks and "fsm bench", so that both time the same work on the
+// same machines. Routing and label placement compare every edge with
+// every other, so time grows quickly with machine size; timing machines
+// of 10, 100, and 1000 states shows when a change makes that worse.
+
+// BenchSizes are the state counts benchmarked by default.
+var BenchSizes = []int{10, 100, 1000}
+
+// BenchOp is one operation that is timed.
+type BenchOp struct {
+	Name string
+	Run  func(f *fsm.FSM)
+}
+
+// BenchOps returns the operations timed by the benchmarks, in order: the
+// default layout, the layered layout with routing boxes, and the native
+// PNG and SVG renderers at their default canvas size.
+func BenchOps() []BenchOp {
+	return []BenchOp{
+		{"smart-layout", func(f *fsm.FSM) { SmartLayout(f, 80, 40) }},
+		{"sugiyama", func(f *fsm.FSM) { SugiyamaLayoutFull(f, 80, 40) }},
+		{"png", func(f *fsm.FSM) { RenderPNG(f, io.Discard, DefaultPNGOptions()) }},
+		{"svg", func(f *fsm.FSM) { GenerateSVGNative(f, DefaultSVGOptions()) }},
+	}
+}
+
+// BenchMachine returns the machine benchmarked at the given size: a
+// random DFA over three inputs, the same for the same size and seed.
+func BenchMachine(states int, seed int64) (*fsm.FSM, error) {
+	return fsm.Random(fsm.RandomOptions{States: states, Alphabet: 3, Seed: seed})
+}
@@ -0,0 +1,38 @@
+package fsmfile
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchOp runs the named operation of BenchOps on each of BenchSizes.
+// The 1000-state machines are skipped with -short.
+func benchOp(b *testing.B, name string) {
+	var op BenchOp
+	for _, o := range BenchOps() {
+		if o.Name == name {
+			op = o
+		}
+	}
+	for _, n := range BenchSizes {
+		b.Run(fmt.Sprintf("states=%d", n), func(b *testing.B) {
+			if testing.Short() && n >= 1000 {
+				b.Skip("skipping 1000 states in short mode")
+			}
+			f, err := BenchMachine(n, 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				op.Run(f)
+			}
+		})
+	}
+}
+
+func BenchmarkSmartLayout(b *testing.B)        { benchOp(b, "smart-layout") }
+func BenchmarkSugiyamaLayoutFull(b *testing.B) { benchOp(b, "sugiyama") }
+func BenchmarkRenderPNG(b *testing.B)          { benchOp(b, "png") }
+func BenchmarkGenerateSVGNative(b *testing.B)  { benchOp(b, "svg") }
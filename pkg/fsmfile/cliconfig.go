@@ -0,0 +1,149 @@
+package fsmfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CLIConfig holds the defaults the fsm command reads from its config
+// file. Empty fields leave the command's own defaults in place, and flags
+// given on the command line override them.
+type CLIConfig struct {
+	Renderer  string // png, svg, view: "native" or "graphviz"
+	Theme     string // native SVG colour theme
+	OutputDir string // directory for output files named after their input
+	Editor    string // path to fsmedit
+	Generate  GenerateDefaults
+}
+
+// GenerateDefaults holds the [generate] section of the config file.
+type GenerateDefaults struct {
+	Lang      string // c, rust, go, or tinygo
+	Package   string // Go package name
+	DocHeader bool
+	MISRA     bool // C only
+	NoStd     bool // Rust only
+}
+
+// ParseCLIConfig parses fsm config file content:
+//
+//	renderer = "native"       # native | graphviz
+//	theme = "dark"
+//	output_dir = "~/diagrams"
+//	editor = "/opt/fsm/bin/fsmedit"
+//
+//	[generate]
+//	lang = "go"               # c | rust | go | tinygo
+//	package = "machines"
+//	doc_header = true
+//	misra = true
+//	no_std = true
+//
+// As with .fsmlint.toml, unknown sections, keys, and values are errors.
+func ParseCLIConfig(text string) (CLIConfig, error) {
+	var cfg CLIConfig
+
+	var section string
+	for n, line := range strings.Split(text, "\n") {
+		lineNo := n + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			if section != "generate" {
+				return cfg, fmt.Errorf("line %d: unknown section [%s]", lineNo, section)
+			}
+			continue
+		}
+
+		key, value, ok := tomlKeyValue(line)
+		if !ok {
+			return cfg, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		flag := func(p *bool) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %s must be true or false, not %q", lineNo, key, value)
+			}
+			*p = b
+			return nil
+		}
+
+		var err error
+		switch section + "." + key {
+		case ".renderer":
+			cfg.Renderer = strings.ToLower(value)
+			if cfg.Renderer != "native" && cfg.Renderer != "graphviz" {
+				err = fmt.Errorf("line %d: unknown renderer %q (use native or graphviz)", lineNo, value)
+			}
+		case ".theme":
+			if _, ok := ThemeByName(value); !ok {
+				err = fmt.Errorf("line %d: unknown theme %q (available: %s)", lineNo, value, strings.Join(ThemeNames(), ", "))
+			}
+			cfg.Theme = value
+		case ".output_dir":
+			cfg.OutputDir = value
+		case ".editor":
+			cfg.Editor = value
+		case "generate.lang":
+			cfg.Generate.Lang = strings.ToLower(value)
+			switch cfg.Generate.Lang {
+			case "c", "rust", "go", "tinygo":
+			default:
+				err = fmt.Errorf("line %d: unknown language %q (use c, rust, go, or tinygo)", lineNo, value)
+			}
+		case "generate.package":
+			cfg.Generate.Package = value
+		case "generate.doc_header":
+			err = flag(&cfg.Generate.DocHeader)
+		case "generate.misra":
+			err = flag(&cfg.Generate.MISRA)
+		case "generate.no_std":
+			err = flag(&cfg.Generate.NoStd)
+		default:
+			if section == "" {
+				err = fmt.Errorf("line %d: unknown key %q", lineNo, key)
+			} else {
+				err = fmt.Errorf("line %d: unknown key %q in [%s]", lineNo, key, section)
+			}
+		}
+		if err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// LoadCLIConfig reads and parses an fsm config file.
+func LoadCLIConfig(path string) (CLIConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CLIConfig{}, err
+	}
+	cfg, err := ParseCLIConfig(string(data))
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// DefaultCLIConfigPath returns where the fsm command looks for its config
+// file: $XDG_CONFIG_HOME/fsm/config.toml, or ~/.config/fsm/config.toml
+// when XDG_CONFIG_HOME is unset. It returns "" if neither can be found.
+func DefaultCLIConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "fsm", "config.toml")
+}
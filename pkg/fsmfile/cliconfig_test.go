@@ -0,0 +1,64 @@
+package fsmfile
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCLIConfig(t *testing.T) {
+	cfg, err := ParseCLIConfig(`
+# my defaults
+renderer = "Native"
+theme = 'dark'
+output_dir = "build/#diagrams"   # kept inside quotes
+editor = "/opt/fsm/fsmedit"
+
+[generate]
+lang = "GO"
+package = "machines"
+doc_header = true
+no_std = false
+`)
+	if err != nil {
+		t.Fatalf("ParseCLIConfig: %v", err)
+	}
+	want := CLIConfig{
+		Renderer:  "native",
+		Theme:     "dark",
+		OutputDir: "build/#diagrams",
+		Editor:    "/opt/fsm/fsmedit",
+		Generate:  GenerateDefaults{Lang: "go", Package: "machines", DocHeader: true},
+	}
+	if cfg != want {
+		t.Errorf("config = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestParseCLIConfig_Errors(t *testing.T) {
+	for _, text := range []string{
+		`renderer = "cairo"`,
+		`theme = "nope"`,
+		`lang = "go"`,
+		"[generate]\nlang = \"java\"",
+		"[generate]\nmisra = \"yes\"",
+		"[generate]\ntheme = \"dark\"",
+		"[render]\n",
+		"renderer",
+	} {
+		if _, err := ParseCLIConfig(text); err == nil {
+			t.Errorf("expected error for %q", text)
+		}
+	}
+}
+
+func TestDefaultCLIConfigPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, want := DefaultCLIConfigPath(), filepath.Join("/xdg", "fsm", "config.toml"); got != want {
+		t.Errorf("with XDG_CONFIG_HOME: %q, want %q", got, want)
+	}
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/ada")
+	if got, want := DefaultCLIConfigPath(), filepath.Join("/home/ada", ".config", "fsm", "config.toml"); got != want {
+		t.Errorf("without XDG_CONFIG_HOME: %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package fsmfile
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// Clipboard section markers. The clipboard format is the hex records,
+// followed by labels.toml and layout.toml, each introduced by a marker
+// comment so the text stays valid hex and TOML when split.
+const (
+	clipboardLabelsMarker = "# ---- labels.toml -----------------------------------"
+	clipboardLayoutMarker = "# ---- layout.toml -----------------------------------"
+)
+
+// FormatClipboard renders a machine and its editor positions in the text
+// format used by fsmedit's copy and paste.
+func FormatClipboard(f *fsm.FSM, positions map[string][2]int, offsetX, offsetY int) string {
+	records, stateNames, inputNames, outputNames := FSMToRecords(f)
+
+	var sb strings.Builder
+	sb.WriteString(FormatHex(records, 1)) // one record per line
+	sb.WriteString("\n" + clipboardLabelsMarker + "\n")
+	sb.WriteString(GenerateLabels(f, stateNames, inputNames, outputNames))
+	sb.WriteString(clipboardLayoutMarker + "\n")
+	sb.WriteString(GenerateLayout(positions, offsetX, offsetY))
+	return sb.String()
+}
+
+// ParseClipboard parses text produced by FormatClipboard, or bare hex
+// records (the legacy format). Clipboard contents come from outside the
+// program, so the parser tolerates a BOM, CRLF line endings, and missing
+// or out-of-order sections. A malformed layout is ignored (nil Layout);
+// anything else malformed is an error.
+func ParseClipboard(content string) (*fsm.FSM, *Layout, error) {
+	content = strings.TrimPrefix(content, "\xef\xbb\xbf")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, nil, errors.New("clipboard is empty")
+	}
+
+	hexPart, labelsPart, layoutPart := splitClipboard(content)
+
+	if len(hexPart) < 4 {
+		return nil, nil, errors.New("no hex data found")
+	}
+	records, err := ParseHex(hexPart)
+	if err != nil {
+		return nil, nil, errors.New("invalid hex data: " + err.Error())
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("no valid hex records found")
+	}
+
+	var labels *Labels
+	if labelsPart != "" {
+		labels, err = ParseLabels(labelsPart)
+		if err != nil {
+			return nil, nil, errors.New("invalid labels: " + err.Error())
+		}
+	}
+
+	var layout *Layout
+	if layoutPart != "" {
+		if l, err := ParseLayout(layoutPart); err == nil {
+			layout = l
+		}
+	}
+
+	f, err := RecordsToFSM(records, labels)
+	if err != nil {
+		return nil, nil, errors.New("invalid FSM data: " + err.Error())
+	}
+	return f, layout, nil
+}
+
+// splitClipboard separates the hex, labels, and layout sections. Each
+// section runs from its marker to the next marker (whichever comes
+// first), and the hex is everything before the first marker.
+func splitClipboard(content string) (hexPart, labelsPart, layoutPart string) {
+	labelsIdx := strings.Index(content, clipboardLabelsMarker)
+	layoutIdx := strings.Index(content, clipboardLayoutMarker)
+
+	section := func(start, markerLen, other int) string {
+		if start < 0 {
+			return ""
+		}
+		end := len(content)
+		if other > start {
+			end = other
+		}
+		return strings.TrimSpace(content[start+markerLen : end])
+	}
+
+	hexEnd := len(content)
+	for _, idx := range []int{labelsIdx, layoutIdx} {
+		if idx >= 0 && idx < hexEnd {
+			hexEnd = idx
+		}
+	}
+	return strings.TrimSpace(content[:hexEnd]),
+		section(labelsIdx, len(clipboardLabelsMarker), layoutIdx),
+		section(layoutIdx, len(clipboardLayoutMarker), labelsIdx)
+}
@@ -0,0 +1,77 @@
+package fsmfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func clipboardFSM() *fsm.FSM {
+	f := fsm.New(fsm.TypeDFA)
+	f.AddState("idle")
+	f.AddState("busy \"x\"")
+	f.Alphabet = []string{"go", "stop"}
+	f.SetInitial("idle")
+	f.SetAccepting([]string{"idle"})
+	goIn, stop := "go", "stop"
+	f.AddTransition("idle", &goIn, []string{"busy \"x\""}, nil)
+	f.AddTransition("busy \"x\"", &stop, []string{"idle"}, nil)
+	return f
+}
+
+func TestClipboard_RoundTrip(t *testing.T) {
+	f := clipboardFSM()
+	text := FormatClipboard(f, map[string][2]int{"idle": {3, 4}}, 0, 0)
+
+	// Simulate a Windows clipboard.
+	text = "\xef\xbb\xbf" + strings.ReplaceAll(text, "\n", "\r\n")
+
+	g, layout, err := ParseClipboard(text)
+	if err != nil {
+		t.Fatalf("ParseClipboard: %v", err)
+	}
+	if eq, cex := fsm.Equivalent(f, g); !eq {
+		t.Errorf("pasted machine differs, counterexample %v", cex)
+	}
+	if !g.HasState("busy \"x\"") {
+		t.Errorf("quoted state name lost: %v", g.States)
+	}
+	if layout == nil || layout.States["idle"].X != 3 {
+		t.Errorf("layout not restored: %+v", layout)
+	}
+}
+
+func TestClipboard_Malformed(t *testing.T) {
+	f := clipboardFSM()
+	good := FormatClipboard(f, nil, 0, 0)
+	records, _, _, _ := FSMToRecords(f)
+	hex := FormatHex(records, 1)
+
+	cases := map[string]string{
+		"empty":          "   \r\n",
+		"no hex":         clipboardLabelsMarker + "\n[fsm]\n",
+		"garbage":        "hello world",
+		"markers only":   clipboardLayoutMarker + clipboardLabelsMarker,
+		"swapped":        hex + "\n" + clipboardLayoutMarker + "\n[editor]\n" + clipboardLabelsMarker + "\n[fsm]\ntype = \"dfa\"\n",
+		"labels only":    hex + "\n" + clipboardLabelsMarker + "\n[fsm]\ntype = \"dfa\"\n",
+		"truncated":      good[:len(good)/2],
+		"bad layout":     hex + "\n" + clipboardLabelsMarker + "\n" + clipboardLayoutMarker + "\n[states.\"x\nx = y\n",
+		"legacy hex":     hex,
+		"unterminated":   hex + "\n" + clipboardLabelsMarker + "\n[states]\n0x0000 = \"abc\n",
+		"marker in name": hex + "\n" + clipboardLabelsMarker + "\n[states]\n0x0000 = \"" + clipboardLayoutMarker + "\"\n",
+	}
+	for _, text := range cases {
+		// Must not panic; errors are fine.
+		_, _, _ = ParseClipboard(text)
+	}
+
+	// Swapped sections must still be recognised.
+	g, _, err := ParseClipboard(cases["swapped"])
+	if err != nil || g.Type != fsm.TypeDFA {
+		t.Errorf("swapped sections: %v, %+v", err, g)
+	}
+	if _, _, err := ParseClipboard(cases["empty"]); err == nil {
+		t.Error("expected error for empty clipboard")
+	}
+}
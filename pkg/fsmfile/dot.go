@@ -7,54 +7,121 @@ import (
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
 
+// DOTOptions controls DOT export.
+type DOTOptions struct {
+	Title      string            // graph label, at the top
+	RankDir    string            // TB, LR, BT, or RL ("" = LR)
+	ClusterBy  string            // state metadata key; states sharing a value form a cluster
+	FillBy     string            // state metadata key holding a state's fill colour
+	FillColors map[string]string // fill colour per state, before FillBy
+	FontName   string            // font for states, edges, and title ("" = Helvetica, title unchanged)
+	FontSize   int               // state label size; edge labels are one smaller (0 = 11)
+}
+
+// DefaultDOTOptions returns the options GenerateDOT uses: left to right,
+// with no clusters or fills, in 11-point Helvetica.
+func DefaultDOTOptions() DOTOptions {
+	return DOTOptions{RankDir: "LR", FontSize: 11}
+}
+
+// DOTRankDirs returns the rank directions DOTOptions accepts.
+func DOTRankDirs() []string {
+	return []string{"TB", "LR", "BT", "RL"}
+}
+
 // GenerateDOT converts an FSM to Graphviz DOT format.
 func GenerateDOT(f *fsm.FSM, title string) string {
+	opts := DefaultDOTOptions()
+	opts.Title = title
+	return GenerateDOTWithOptions(f, opts)
+}
+
+// GenerateDOTWithOptions converts an FSM to Graphviz DOT format, with the
+// layout direction, clusters, colours, and fonts set by opts. Clusters
+// follow the order in which their values first appear in f.States.
+// Colours are passed to Graphviz as given, so names ("lightblue") and
+// "#rrggbb" both work.
+func GenerateDOTWithOptions(f *fsm.FSM, opts DOTOptions) string {
+	rankDir := strings.ToUpper(opts.RankDir)
+	if rankDir == "" {
+		rankDir = "LR"
+	}
+	fontName := opts.FontName
+	if fontName == "" {
+		fontName = "Helvetica"
+	}
+	fontSize := opts.FontSize
+	if fontSize <= 0 {
+		fontSize = 11
+	}
+
 	var sb strings.Builder
 	
 	sb.WriteString("digraph FSM {\n")
-	sb.WriteString("    rankdir=LR;\n")
-	sb.WriteString("    node [fontname=\"Helvetica\", fontsize=11];\n")
-	sb.WriteString("    edge [fontname=\"Helvetica\", fontsize=10];\n")
+	sb.WriteString(fmt.Sprintf("    rankdir=%s;\n", rankDir))
+	if opts.FontName != "" {
+		sb.WriteString(fmt.Sprintf("    fontname=\"%s\";\n", escapeDOT(fontName)))
+	}
+	sb.WriteString(fmt.Sprintf("    node [fontname=\"%s\", fontsize=%d];\n", escapeDOT(fontName), fontSize))
+	sb.WriteString(fmt.Sprintf("    edge [fontname=\"%s\", fontsize=%d];\n", escapeDOT(fontName), fontSize-1))
 	sb.WriteString("\n")
 	
 	// Title
-	if title != "" {
+	if opts.Title != "" {
 		sb.WriteString(fmt.Sprintf("    labelloc=\"t\";\n"))
-		sb.WriteString(fmt.Sprintf("    label=\"%s\";\n", escapeDOT(title)))
+		sb.WriteString(fmt.Sprintf("    label=\"%s\";\n", escapeDOT(opts.Title)))
 		sb.WriteString("\n")
 	}
 	
 	// Invisible start node
 	if f.Initial != "" {
-		sb.WriteString("    __start [shape=none, label=\"\", width=0, height=0];\n")
-		sb.WriteString(fmt.Sprintf("    __start -> \"%s\";\n", escapeDOT(f.Initial)))
+		start := dotStartNode(f)
+		sb.WriteString(fmt.Sprintf("    %s [shape=none, label=\"\", width=0, height=0];\n", start))
+		sb.WriteString(fmt.Sprintf("    %s -> \"%s\";\n", start, escapeDOT(f.Initial)))
 		sb.WriteString("\n")
 	}
 	
-	// State nodes
+	// State nodes, grouped into clusters by the ClusterBy metadata value
+	var clusterOrder []string
+	clusters := make(map[string][]string)
+	var loose []string
 	for _, state := range f.States {
-		var attrs []string
-		
-		if f.IsAccepting(state) {
-			attrs = append(attrs, "shape=doublecircle")
-		} else {
-			attrs = append(attrs, "shape=circle")
+		value := ""
+		if opts.ClusterBy != "" {
+			value = f.StateMetadata[state][opts.ClusterBy]
 		}
-		
-		// Moore output in label
-		if f.Type == fsm.TypeMoore {
-			if out, ok := f.StateOutputs[state]; ok {
-				label := fmt.Sprintf("%s\\n/%s", state, out)
-				attrs = append(attrs, fmt.Sprintf("label=\"%s\"", escapeDOT(label)))
-			}
+		if value == "" {
+			loose = append(loose, state)
+			continue
 		}
-		
-		sb.WriteString(fmt.Sprintf("    \"%s\" [%s];\n", escapeDOT(state), strings.Join(attrs, ", ")))
+		if _, seen := clusters[value]; !seen {
+			clusterOrder = append(clusterOrder, value)
+		}
+		clusters[value] = append(clusters[value], state)
+	}
+	for _, state := range loose {
+		sb.WriteString("    " + dotStateNode(f, state, opts))
+	}
+	for i, value := range clusterOrder {
+		// Cluster names are numbered, since Graphviz only treats
+		// subgraphs named cluster* as clusters.
+		if i > 0 || len(loose) > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("    subgraph cluster_%d {\n", i))
+		sb.WriteString(fmt.Sprintf("        label=\"%s\";\n", escapeDOT(value)))
+		sb.WriteString("        style=rounded;\n")
+		for _, state := range clusters[value] {
+			sb.WriteString("        " + dotStateNode(f, state, opts))
+		}
+		sb.WriteString("    }\n")
 	}
 	sb.WriteString("\n")
 	
-	// Group transitions by (from, to)
+	// Group transitions by (from, to), keeping edges in the order of
+	// their first transition so the output is stable.
 	edgeLabels := make(map[[2]string][]string)
+	var edgeOrder [][2]string
 	
 	for _, t := range f.Transitions {
 		var label string
@@ -67,16 +134,22 @@ func GenerateDOT(f *fsm.FSM, title string) string {
 		if f.Type == fsm.TypeMealy && t.Output != nil {
 			label = fmt.Sprintf("%s/%s", label, *t.Output)
 		}
+		if f.Type == fsm.TypePDA {
+			label += " [" + t.StackLabel() + "]"
+		}
 		
 		for _, to := range t.To {
 			key := [2]string{t.From, to}
+			if _, seen := edgeLabels[key]; !seen {
+				edgeOrder = append(edgeOrder, key)
+			}
 			edgeLabels[key] = append(edgeLabels[key], label)
 		}
 	}
 	
 	// Write edges
-	for key, labels := range edgeLabels {
-		combined := strings.Join(labels, ", ")
+	for _, key := range edgeOrder {
+		combined := strings.Join(edgeLabels[key], ", ")
 		sb.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\" [label=\"%s\"];\n",
 			escapeDOT(key[0]), escapeDOT(key[1]), escapeDOT(combined)))
 	}
@@ -86,6 +159,45 @@ func GenerateDOT(f *fsm.FSM, title string) string {
 	return sb.String()
 }
 
+// dotStateNode returns the node statement for a state, with a newline.
+func dotStateNode(f *fsm.FSM, state string, opts DOTOptions) string {
+	var attrs []string
+	if f.IsAccepting(state) {
+		attrs = append(attrs, "shape=doublecircle")
+	} else {
+		attrs = append(attrs, "shape=circle")
+	}
+
+	// Moore output in label
+	if f.Type == fsm.TypeMoore {
+		if out, ok := f.StateOutputs[state]; ok {
+			label := fmt.Sprintf("%s\\n/%s", state, out)
+			attrs = append(attrs, fmt.Sprintf("label=\"%s\"", escapeDOT(label)))
+		}
+	}
+
+	fill := opts.FillColors[state]
+	if fill == "" && opts.FillBy != "" {
+		fill = f.StateMetadata[state][opts.FillBy]
+	}
+	if fill != "" {
+		attrs = append(attrs, "style=filled", fmt.Sprintf("fillcolor=\"%s\"", escapeDOT(fill)))
+	}
+	return fmt.Sprintf("\"%s\" [%s];\n", escapeDOT(state), strings.Join(attrs, ", "))
+}
+
+// dotStartNode returns the ID of the invisible node the arrow to the
+// initial state starts from: __start, unless a state has that name.
+// State IDs are always quoted, so any name is a valid ID, but a quoted
+// and an unquoted ID with the same text are the same node.
+func dotStartNode(f *fsm.FSM) string {
+	start := "__start"
+	for n := 2; f.HasState(start); n++ {
+		start = fmt.Sprintf("__start_%d", n)
+	}
+	return start
+}
+
 func escapeDOT(s string) string {
 	s = strings.ReplaceAll(s, "\\", "\\\\")
 	s = strings.ReplaceAll(s, "\"", "\\\"")
@@ -0,0 +1,105 @@
+package fsmfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// dotTestFSM is a four-state machine whose states are tagged with a
+// phase and a colour in their metadata; d has neither.
+func dotTestFSM() *fsm.FSM {
+	f := fsm.New(fsm.TypeDFA)
+	f.States = []string{"a", "b", "c", "d"}
+	f.Initial = "a"
+	f.Alphabet = []string{"x"}
+	f.AddTransition("a", strPtr("x"), []string{"b"}, nil)
+	f.AddTransition("b", strPtr("x"), []string{"c"}, nil)
+	f.AddTransition("c", strPtr("x"), []string{"d"}, nil)
+	f.SetStateMetadata("a", "phase", "setup")
+	f.SetStateMetadata("b", "phase", "run \"main\"")
+	f.SetStateMetadata("c", "phase", "setup")
+	f.SetStateMetadata("a", "colour", "lightblue")
+	f.SetStateMetadata("c", "colour", "#ffcc00")
+	return f
+}
+
+func TestGenerateDOTDefaults(t *testing.T) {
+	f := dotTestFSM()
+	opts := DefaultDOTOptions()
+	opts.Title = "T"
+	if GenerateDOT(f, "T") != GenerateDOTWithOptions(f, opts) {
+		t.Error("GenerateDOT differs from GenerateDOTWithOptions with default options")
+	}
+	dot := GenerateDOT(f, "T")
+	for _, want := range []string{"rankdir=LR;", `node [fontname="Helvetica", fontsize=11];`, `edge [fontname="Helvetica", fontsize=10];`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if strings.Contains(dot, "subgraph") || strings.Contains(dot, "fillcolor") {
+		t.Error("default output has clusters or fills")
+	}
+}
+
+func TestGenerateDOTClusters(t *testing.T) {
+	opts := DefaultDOTOptions()
+	opts.RankDir = "tb"
+	opts.ClusterBy = "phase"
+	dot := GenerateDOTWithOptions(dotTestFSM(), opts)
+	if !strings.Contains(dot, "rankdir=TB;") {
+		t.Error("rankdir not set")
+	}
+	setup := strings.Index(dot, "subgraph cluster_0 {\n        label=\"setup\";")
+	run := strings.Index(dot, "subgraph cluster_1 {\n        label=\"run \\\"main\\\"\";")
+	if setup < 0 || run < 0 || run < setup {
+		t.Fatalf("clusters missing or out of order:\n%s", dot)
+	}
+	// a and c share the first cluster; d stays outside both.
+	cluster0 := dot[setup:run]
+	if !strings.Contains(cluster0, `"a" [`) || !strings.Contains(cluster0, `"c" [`) || strings.Contains(cluster0, `"b" [`) {
+		t.Errorf("setup cluster holds the wrong states:\n%s", cluster0)
+	}
+	if d := strings.Index(dot, `"d" [`); d < 0 || d > setup {
+		t.Errorf("untagged state not before the clusters:\n%s", dot)
+	}
+	if strings.Count(dot, `"a" [`) != 1 {
+		t.Error("state declared more than once")
+	}
+}
+
+func TestGenerateDOTColoursAndFonts(t *testing.T) {
+	opts := DefaultDOTOptions()
+	opts.FillBy = "colour"
+	opts.FillColors = map[string]string{"c": "red", "d": "green"}
+	opts.FontName = "Fira Sans"
+	opts.FontSize = 14
+	dot := GenerateDOTWithOptions(dotTestFSM(), opts)
+	for _, want := range []string{
+		`"a" [shape=circle, style=filled, fillcolor="lightblue"];`,
+		`"b" [shape=circle];`,
+		`"c" [shape=circle, style=filled, fillcolor="red"];`,
+		`"d" [shape=circle, style=filled, fillcolor="green"];`,
+		`fontname="Fira Sans";`,
+		`node [fontname="Fira Sans", fontsize=14];`,
+		`edge [fontname="Fira Sans", fontsize=13];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("missing %q in:\n%s", want, dot)
+		}
+	}
+}
+
+func TestGenerateDOTStartNodeAvoidsStates(t *testing.T) {
+	f := fsm.New(fsm.TypeDFA)
+	f.States = []string{"__start", "b"}
+	f.Initial = "b"
+	dot := GenerateDOT(f, "")
+	if !strings.Contains(dot, `__start_2 -> "b";`) {
+		t.Errorf("start arrow should come from __start_2:\n%s", dot)
+	}
+	if strings.Contains(dot, `__start -> "b"`) {
+		t.Errorf("start node shares its ID with state __start:\n%s", dot)
+	}
+}
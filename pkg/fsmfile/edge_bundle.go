@@ -0,0 +1,165 @@
+package fsmfile
+
+import "math"
+
+// BundleMinSources is how many states must have transitions into one
+// state, from the same side of it, for FindEdgeBundles to bundle them.
+const BundleMinSources = 3
+
+// EdgeBundle is a set of transitions into one state from several others,
+// drawn as branches that merge at Junction into a single trunk, with one
+// arrowhead, into the state.
+type EdgeBundle struct {
+	To       string
+	From     []string
+	Junction Point
+}
+
+// FindEdgeBundles returns the bundles to draw for edges, each a from and a
+// to state, between states at the given positions. The edges into a state
+// are bundled when at least BundleMinSources states on the same side of
+// it have one and it has none back to them; a reset or error state that
+// most of a machine can reach is the usual case. The junction is trunk
+// beyond the state's radius, towards those states, but no more than half
+// way across the gap to the nearest; where that leaves less than a
+// quarter of trunk, the states are too close together to bundle their
+// edges. States missing from radius have none.
+//
+// Bundles are in the order their states first appear in edges, with the
+// states in each in the order of their edges.
+func FindEdgeBundles(edges [][2]string, pos map[string][2]float64, radius map[string]float64, trunk float64) []EdgeBundle {
+	has := make(map[[2]string]bool, len(edges))
+	for _, e := range edges {
+		has[e] = true
+	}
+	var targets []string
+	sources := make(map[string][]string)
+	for _, e := range edges {
+		from, to := e[0], e[1]
+		if from == to || has[[2]string{to, from}] {
+			continue
+		}
+		if _, seen := sources[to]; !seen {
+			targets = append(targets, to)
+		}
+		dup := false
+		for _, s := range sources[to] {
+			dup = dup || s == from
+		}
+		if !dup {
+			sources[to] = append(sources[to], from)
+		}
+	}
+
+	var bundles []EdgeBundle
+	for _, to := range targets {
+		from := sources[to]
+		if len(from) < BundleMinSources {
+			continue
+		}
+		p := pos[to]
+		// Keep the sources within a right angle of their mean
+		// direction, and take the trunk that way.
+		dir := meanDirection(p, from, pos)
+		var kept []string
+		for _, s := range from {
+			q := pos[s]
+			if (q[0]-p[0])*dir.X+(q[1]-p[1])*dir.Y > 0 {
+				kept = append(kept, s)
+			}
+		}
+		// A branch that would cross another state is left out, and
+		// the junction found again without it.
+		for len(kept) >= BundleMinSources {
+			b, ok := bundleTowards(to, kept, pos, radius, trunk)
+			if !ok {
+				break
+			}
+			var clear []string
+			for _, s := range kept {
+				if branchClear(b, s, pos, radius) {
+					clear = append(clear, s)
+				}
+			}
+			if len(clear) == len(kept) {
+				bundles = append(bundles, b)
+				break
+			}
+			kept = clear
+		}
+	}
+	return bundles
+}
+
+// bundleTowards returns the bundle of the edges into to from the named
+// states, with its junction placed as FindEdgeBundles describes, or false
+// if there is no room for one.
+func bundleTowards(to string, from []string, pos map[string][2]float64, radius map[string]float64, trunk float64) (EdgeBundle, bool) {
+	p := pos[to]
+	dir := meanDirection(p, from, pos)
+	length := radius[to] + trunk
+	for _, s := range from {
+		q := pos[s]
+		gap := math.Hypot(q[0]-p[0], q[1]-p[1]) - radius[to] - radius[s]
+		length = math.Min(length, radius[to]+gap/2)
+	}
+	if length < radius[to]+trunk/4 {
+		return EdgeBundle{}, false
+	}
+	return EdgeBundle{
+		To:       to,
+		From:     from,
+		Junction: Point{p[0] + dir.X*length, p[1] + dir.Y*length},
+	}, true
+}
+
+// branchClear reports whether the branch of b from the named state keeps
+// clear of every other state.
+func branchClear(b EdgeBundle, from string, pos map[string][2]float64, radius map[string]float64) bool {
+	p, q := pos[from], pos[b.To]
+	c := bundleBranch(b, p, q)
+	for name, o := range pos {
+		if name == from || name == b.To {
+			continue
+		}
+		for i := 1; i <= 20; i++ {
+			at, _ := quadAt(Point{p[0], p[1]}, c, b.Junction, float64(i)/20)
+			if math.Hypot(at.X-o[0], at.Y-o[1]) < radius[name] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// meanDirection returns the unit vector along the mean of the directions
+// from p to each of the named states, or to the first of them if those
+// cancel out.
+func meanDirection(p [2]float64, names []string, pos map[string][2]float64) Point {
+	var sx, sy float64
+	for _, s := range names {
+		q := pos[s]
+		if d := math.Hypot(q[0]-p[0], q[1]-p[1]); d > 0 {
+			sx += (q[0] - p[0]) / d
+			sy += (q[1] - p[1]) / d
+		}
+	}
+	if l := math.Hypot(sx, sy); l > 0.1 {
+		return Point{sx / l, sy / l}
+	}
+	q := pos[names[0]]
+	if l := math.Hypot(q[0]-p[0], q[1]-p[1]); l > 0 {
+		return Point{(q[0] - p[0]) / l, (q[1] - p[1]) / l}
+	}
+	return Point{0, -1}
+}
+
+// bundleBranch returns the control point of the quadratic curve from a
+// bundled state at from to the junction of b: beyond the junction, away
+// from b.To at to, so that the branch meets the trunk head on.
+func bundleBranch(b EdgeBundle, from, to [2]float64) Point {
+	dx, dy := b.Junction.X-to[0], b.Junction.Y-to[1]
+	l := math.Hypot(dx, dy)
+	reach := math.Hypot(from[0]-b.Junction.X, from[1]-b.Junction.Y) / 2
+	return Point{b.Junction.X + dx/l*reach, b.Junction.Y + dy/l*reach}
+}
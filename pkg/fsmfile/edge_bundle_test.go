@@ -0,0 +1,77 @@
+package fsmfile
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestFindEdgeBundles(t *testing.T) {
+	// Three states above err, one below, and one that err goes back to.
+	pos := map[string][2]float64{
+		"err": {200, 300},
+		"a":   {0, 0}, "b": {200, 0}, "c": {400, 0},
+		"d": {200, 600},
+		"e": {400, 300},
+	}
+	edges := [][2]string{
+		{"a", "err"}, {"b", "err"}, {"c", "err"}, {"a", "err"},
+		{"d", "err"}, {"e", "err"}, {"err", "e"}, {"a", "b"},
+	}
+	got := FindEdgeBundles(edges, pos, nil, 40)
+	if len(got) != 1 {
+		t.Fatalf("got %d bundles, want 1: %+v", len(got), got)
+	}
+	b := got[0]
+	if b.To != "err" || !reflect.DeepEqual(b.From, []string{"a", "b", "c"}) {
+		t.Errorf("bundle into %s from %v, want err from [a b c]", b.To, b.From)
+	}
+	if math.Abs(b.Junction.X-200) > 1e-9 || math.Abs(b.Junction.Y-260) > 1e-9 {
+		t.Errorf("junction at %v, want 40 above err", b.Junction)
+	}
+}
+
+func TestFindEdgeBundlesTooFew(t *testing.T) {
+	pos := map[string][2]float64{"err": {0, 0}, "a": {-100, -100}, "b": {100, -100}}
+	if got := FindEdgeBundles([][2]string{{"a", "err"}, {"b", "err"}}, pos, nil, 40); len(got) != 0 {
+		t.Errorf("bundled two edges: %+v", got)
+	}
+}
+
+func TestFindEdgeBundlesSkipsBlockedBranch(t *testing.T) {
+	// d is straight above b, so its branch would run through it.
+	pos := map[string][2]float64{
+		"err": {200, 300},
+		"a":   {0, 0}, "b": {200, 0}, "c": {400, 0}, "d": {200, -300},
+	}
+	radius := map[string]float64{"err": 30, "a": 30, "b": 30, "c": 30, "d": 30}
+	edges := [][2]string{{"a", "err"}, {"b", "err"}, {"c", "err"}, {"d", "err"}}
+	got := FindEdgeBundles(edges, pos, radius, 40)
+	if len(got) != 1 || !reflect.DeepEqual(got[0].From, []string{"a", "b", "c"}) {
+		t.Errorf("got %+v, want a bundle from a, b, and c", got)
+	}
+}
+
+func TestSVGBundleEdges(t *testing.T) {
+	f := fsm.New(fsm.TypeDFA)
+	for _, s := range []string{"a", "b", "c", "d", "err"} {
+		f.AddState(s)
+	}
+	f.SetInitial("a")
+	for _, s := range []string{"a", "b", "c", "d"} {
+		f.AddTransition(s, strp("bad"), []string{"err"}, nil)
+	}
+	opts := DefaultSVGOptions()
+	opts.LayoutEngine = EngineCircular
+	opts.BundleEdges = true
+	svg := GenerateSVGNative(f, opts)
+	if n := strings.Count(svg, `style="marker-end: none"`); n < BundleMinSources {
+		t.Fatalf("found %d branches, want a bundle", n)
+	}
+	if n := strings.Count(svg, ">bad</text>"); n != 4 {
+		t.Errorf("found %d labels, want one for each transition", n)
+	}
+}
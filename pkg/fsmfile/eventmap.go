@@ -0,0 +1,145 @@
+package fsmfile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// ParseEventMap parses an event map, which translates log lines into
+// inputs for fsm replay:
+//
+//	[events]
+//	login  = 'POST /login .* 200'
+//	logout = ['GET /logout', 'session expired']
+//
+//	[options]
+//	unmatched = "skip"   # skip | error
+//
+// Each key in [events] is an input and each value a regular expression
+// (RE2 syntax), or an array of them, matched anywhere in a line. Lines
+// are tried against the patterns in file order and take the input of the
+// first that matches. Single-quoted strings are taken literally, which
+// suits regular expressions. Unknown sections or options are errors.
+func ParseEventMap(text string) (fsm.EventMap, error) {
+	var m fsm.EventMap
+
+	var section string
+	for n, line := range strings.Split(text, "\n") {
+		lineNo := n + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section != "events" && section != "options" {
+				return m, fmt.Errorf("line %d: unknown section [%s]", lineNo, section)
+			}
+			continue
+		}
+
+		rawKey, rawValue, ok := splitKeyValue(line)
+		if !ok {
+			return m, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key := unquoteKey(rawKey)
+		value := stripTOMLComment(rawValue)
+
+		switch section {
+		case "events":
+			patterns, err := parseStringArray(value)
+			if err != nil {
+				return m, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			for _, p := range patterns {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					return m, fmt.Errorf("line %d: pattern for %s: %w", lineNo, key, err)
+				}
+				m.Rules = append(m.Rules, fsm.EventRule{Pattern: re, Input: key})
+			}
+		case "options":
+			if key != "unmatched" {
+				return m, fmt.Errorf("line %d: unknown option %q (use unmatched)", lineNo, key)
+			}
+			switch v := unquoteKey(value); v {
+			case "skip":
+				m.Strict = false
+			case "error":
+				m.Strict = true
+			default:
+				return m, fmt.Errorf("line %d: invalid unmatched %q (use skip or error)", lineNo, v)
+			}
+		default:
+			return m, fmt.Errorf("line %d: %s outside a section", lineNo, key)
+		}
+	}
+	if len(m.Rules) == 0 {
+		return m, fmt.Errorf("no [events] patterns")
+	}
+	return m, nil
+}
+
+// parseStringArray parses a quoted string or a one-line array of quoted
+// strings.
+func parseStringArray(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") {
+		if len(value) < 2 || (value[0] != '"' && value[0] != '\'') || value[len(value)-1] != value[0] {
+			return nil, fmt.Errorf("expected a quoted string or an array of them")
+		}
+		return []string{unquoteKey(value)}, nil
+	}
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated array")
+	}
+
+	var out []string
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	for rest != "" {
+		quote := rest[0]
+		if quote != '"' && quote != '\'' {
+			return nil, fmt.Errorf("expected a quoted string in array")
+		}
+		end := -1
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' && quote == '"' {
+				i++
+			} else if rest[i] == quote {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string in array")
+		}
+		out = append(out, unquoteKey(rest[:end+1]))
+		rest = strings.TrimSpace(rest[end+1:])
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if rest != "" {
+			return nil, fmt.Errorf("expected ',' between array elements")
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty array")
+	}
+	return out, nil
+}
+
+// LoadEventMap reads and parses an event map file.
+func LoadEventMap(path string) (fsm.EventMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fsm.EventMap{}, err
+	}
+	m, err := ParseEventMap(string(data))
+	if err != nil {
+		return m, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,57 @@
+package fsmfile
+
+import "testing"
+
+func TestParseEventMap(t *testing.T) {
+	m, err := ParseEventMap(`
+# web sessions
+[events]
+login  = 'POST /login .* 200'
+logout = ['GET /logout', "session expired"]   # either ends it
+"page view" = 'GET /page/\d+#top'
+
+[options]
+unmatched = "error"
+`)
+	if err != nil {
+		t.Fatalf("ParseEventMap: %v", err)
+	}
+	if !m.Strict {
+		t.Error("unmatched = error not applied")
+	}
+	want := []struct{ pattern, input string }{
+		{`POST /login .* 200`, "login"},
+		{`GET /logout`, "logout"},
+		{`session expired`, "logout"},
+		{`GET /page/\d+#top`, "page view"},
+	}
+	if len(m.Rules) != len(want) {
+		t.Fatalf("%d rules, want %d", len(m.Rules), len(want))
+	}
+	for i, w := range want {
+		if got := m.Rules[i]; got.Pattern.String() != w.pattern || got.Input != w.input {
+			t.Errorf("rule %d: %q -> %q, want %q -> %q", i, got.Pattern, got.Input, w.pattern, w.input)
+		}
+	}
+	if in, ok := m.Input("GET /page/12#top"); !ok || in != "page view" {
+		t.Errorf("Input = %q, %v", in, ok)
+	}
+}
+
+func TestParseEventMap_Errors(t *testing.T) {
+	for _, text := range []string{
+		"[events]\nlogin = 'POST ('",
+		"[events]\nlogin = POST",
+		"[events]\nlogin = ['a' 'b']",
+		"[events]\nlogin = []",
+		"[events]\nlogin = 'a'\n[options]\nunmatched = \"warn\"",
+		"[events]\nlogin = 'a'\n[options]\nstrict = \"error\"",
+		"[inputs]\nlogin = 'a'",
+		"login = 'a'",
+		"[options]\nunmatched = \"skip\"",
+	} {
+		if _, err := ParseEventMap(text); err == nil {
+			t.Errorf("expected error for %q", text)
+		}
+	}
+}
@@ -15,7 +15,10 @@ import (
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
 
-// Labels represents the labels.toml content.
+// Labels is the content of a labels.toml file: the names behind the
+// numeric IDs in machine.hex, plus machine-level data the hex records
+// cannot hold. MarshalLabels and UnmarshalLabels convert it to and from
+// TOML without loss, so tools can read, edit, and rewrite the file.
 type Labels struct {
 	FSM      FSMMeta           `toml:"fsm"`
 	States   map[int]string    `toml:"states"`
@@ -23,6 +26,27 @@ type Labels struct {
 	Outputs  map[int]string    `toml:"outputs"`
 	Machines map[string]string `toml:"machines"` // state name -> linked machine name
 	Nets     map[string]string `toml:"nets"`     // net name -> "U3.3Y, U7.2D"
+
+	// Transition probabilities and weights, numbered like
+	// TransitionMetadata.
+	Probabilities map[int]float64 `toml:"probabilities"`
+	Weights       map[int]float64 `toml:"weights"`
+
+	// PDA stack symbols by ID, and stack operations by transition
+	// number. Pushes are written top first, separated by ", ".
+	Stack  map[int]string `toml:"stack"`
+	Pops   map[int]string `toml:"pops"`
+	Pushes map[int]string `toml:"pushes"`
+
+	// Tool metadata. Transitions are numbered in hex record order,
+	// counting each (possibly multi-record) transition once.
+	Metadata           map[string]string            `toml:"metadata"`
+	StateMetadata      map[string]map[string]string `toml:"state_metadata"`      // state name -> key -> value
+	TransitionMetadata map[int]map[string]string    `toml:"transition_metadata"` // transition number -> key -> value
+
+	// Extra holds the keys and sections this package does not interpret,
+	// so that files written by newer or other tools survive a round trip.
+	Extra Extra `toml:"-"`
 }
 
 // FSMMeta contains FSM metadata.
@@ -32,83 +56,214 @@ type FSMMeta struct {
 	Name        string `toml:"name"`
 	Description string `toml:"description"`
 	Vocabulary  string `toml:"vocabulary"`
+	StackStart  string `toml:"stack_start"` // PDA only
 }
 
-// GenerateLabels creates labels.toml content.
+// GenerateLabels creates labels.toml content for f, given the ID-to-name
+// maps returned by FSMToRecords.
 func GenerateLabels(f *fsm.FSM, states, inputs, outputs map[int]string) string {
-	var sb strings.Builder
-	
-	sb.WriteString("[fsm]\n")
-	sb.WriteString("version = 1\n")
-	sb.WriteString(fmt.Sprintf("type = %q\n", f.Type))
-	if f.Name != "" {
-		sb.WriteString(fmt.Sprintf("name = %q\n", f.Name))
-	}
-	if f.Description != "" {
-		sb.WriteString(fmt.Sprintf("description = %q\n", f.Description))
-	}
-	if f.Vocabulary != "" {
-		sb.WriteString(fmt.Sprintf("vocabulary = %q\n", f.Vocabulary))
-	}
-	sb.WriteString("\n")
-	
-	if len(states) > 0 {
-		sb.WriteString("[states]\n")
-		keys := sortedKeys(states)
-		for _, k := range keys {
-			sb.WriteString(fmt.Sprintf("0x%04X = %q\n", k, states[k]))
-		}
-		sb.WriteString("\n")
-	}
-	
-	if len(inputs) > 0 {
-		sb.WriteString("[inputs]\n")
-		keys := sortedKeys(inputs)
-		for _, k := range keys {
-			sb.WriteString(fmt.Sprintf("0x%04X = %q\n", k, inputs[k]))
-		}
-		sb.WriteString("\n")
+	l := &Labels{
+		FSM: FSMMeta{
+			Version:     1,
+			Type:        string(f.Type),
+			Name:        f.Name,
+			Description: f.Description,
+			Vocabulary:  f.Vocabulary,
+			StackStart:  f.StackStart,
+		},
+		States:        states,
+		Inputs:        inputs,
+		Outputs:       outputs,
+		Metadata:      f.Metadata,
+		StateMetadata: f.StateMetadata,
 	}
-	
-	if len(outputs) > 0 {
-		sb.WriteString("[outputs]\n")
-		keys := sortedKeys(outputs)
-		for _, k := range keys {
-			sb.WriteString(fmt.Sprintf("0x%04X = %q\n", k, outputs[k]))
-		}
-		sb.WriteString("\n")
-	}
-	
-	// Write linked machines section if any
+
 	if f.HasLinkedStates() {
-		sb.WriteString("[machines]\n")
+		l.Machines = make(map[string]string)
 		for state, machine := range f.LinkedMachines {
 			if machine != "" {
-				sb.WriteString(fmt.Sprintf("%q = %q\n", state, machine))
+				l.Machines[state] = machine
 			}
 		}
-		sb.WriteString("\n")
 	}
 
-	// Write nets section if any
+	if len(f.StackAlphabet) > 0 {
+		l.Stack = make(map[int]string, len(f.StackAlphabet))
+		for i, sym := range f.StackAlphabet {
+			l.Stack[i] = sym
+		}
+	}
+
 	if len(f.Nets) > 0 {
-		sb.WriteString("[nets]\n")
+		l.Nets = make(map[string]string, len(f.Nets))
 		for _, n := range f.Nets {
 			var eps []string
 			for _, ep := range n.Endpoints {
 				eps = append(eps, ep.Instance+"."+ep.Port)
 			}
-			sb.WriteString(fmt.Sprintf("%q = %q\n", n.Name, strings.Join(eps, ", ")))
+			l.Nets[n.Name] = strings.Join(eps, ", ")
 		}
-		sb.WriteString("\n")
 	}
-	
-	return sb.String()
+
+	n := 0
+	for _, t := range f.Transitions {
+		if len(t.To) == 0 {
+			continue // not written to machine.hex
+		}
+		if t.Probability != nil {
+			if l.Probabilities == nil {
+				l.Probabilities = make(map[int]float64)
+			}
+			l.Probabilities[n] = *t.Probability
+		}
+		if t.Weight != nil {
+			if l.Weights == nil {
+				l.Weights = make(map[int]float64)
+			}
+			l.Weights[n] = *t.Weight
+		}
+		if t.Pop != nil {
+			if l.Pops == nil {
+				l.Pops = make(map[int]string)
+			}
+			l.Pops[n] = *t.Pop
+		}
+		if len(t.Push) > 0 {
+			if l.Pushes == nil {
+				l.Pushes = make(map[int]string)
+			}
+			l.Pushes[n] = strings.Join(t.Push, ", ")
+		}
+		if len(t.Metadata) > 0 {
+			if l.TransitionMetadata == nil {
+				l.TransitionMetadata = make(map[int]map[string]string)
+			}
+			l.TransitionMetadata[n] = t.Metadata
+		}
+		n++
+	}
+
+	return string(MarshalLabels(l))
+}
+
+// MarshalLabels encodes l as labels.toml. Sections and keys are written
+// in a fixed order (IDs and names sorted), so equal Labels give equal
+// bytes. Empty sections are omitted, except [fsm].
+func MarshalLabels(l *Labels) []byte {
+	w := newTOMLWriter(l.Extra)
+	w.section("", nil)
+
+	fsmKeys := []string{
+		fmt.Sprintf("version = %d", l.FSM.Version),
+		fmt.Sprintf("type = %q", l.FSM.Type),
+	}
+	if l.FSM.Name != "" {
+		fsmKeys = append(fsmKeys, fmt.Sprintf("name = %q", l.FSM.Name))
+	}
+	if l.FSM.Description != "" {
+		fsmKeys = append(fsmKeys, fmt.Sprintf("description = %q", l.FSM.Description))
+	}
+	if l.FSM.Vocabulary != "" {
+		fsmKeys = append(fsmKeys, fmt.Sprintf("vocabulary = %q", l.FSM.Vocabulary))
+	}
+	if l.FSM.StackStart != "" {
+		fsmKeys = append(fsmKeys, fmt.Sprintf("stack_start = %q", l.FSM.StackStart))
+	}
+	w.section("fsm", fsmKeys)
+
+	w.section("states", idLines(l.States))
+	w.section("inputs", idLines(l.Inputs))
+	w.section("outputs", idLines(l.Outputs))
+	w.section("stack", idLines(l.Stack))
+	w.section("machines", quotedPairs(l.Machines))
+	w.section("nets", quotedPairs(l.Nets))
+	w.section("probabilities", numberLines(l.Probabilities))
+	w.section("weights", numberLines(l.Weights))
+	w.section("pops", numberedStrings(l.Pops))
+	w.section("pushes", numberedStrings(l.Pushes))
+
+	w.section("metadata", quotedPairs(l.Metadata))
+	for _, state := range sortedStrings(l.StateMetadata) {
+		w.section(fmt.Sprintf("state_metadata.%q", state), quotedPairs(l.StateMetadata[state]))
+	}
+	ns := make([]int, 0, len(l.TransitionMetadata))
+	for n := range l.TransitionMetadata {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	for _, n := range ns {
+		w.section(fmt.Sprintf("transition_metadata.%d", n), quotedPairs(l.TransitionMetadata[n]))
+	}
+
+	return w.finish()
 }
 
-// ParseLabels parses labels.toml content.
-// Simple parser that doesn't require external TOML library.
+// idLines renders an ID-to-name map as sorted `0xNNNN = "name"` lines,
+// or nil if it is empty.
+func idLines(ids map[int]string) []string {
+	var lines []string
+	for _, k := range sortedKeys(ids) {
+		lines = append(lines, fmt.Sprintf("0x%04X = %q", k, ids[k]))
+	}
+	return lines
+}
+
+// numberLines renders per-transition numbers (probabilities, weights) as
+// sorted `N = 0.25` lines, or nil if there are none.
+func numberLines(ps map[int]float64) []string {
+	ns := make([]int, 0, len(ps))
+	for n := range ps {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	var lines []string
+	for _, n := range ns {
+		lines = append(lines, fmt.Sprintf("%d = %s", n, strconv.FormatFloat(ps[n], 'g', -1, 64)))
+	}
+	return lines
+}
+
+// numberedStrings renders per-transition strings (stack operations) as
+// sorted `N = "value"` lines, or nil if there are none.
+func numberedStrings(m map[int]string) []string {
+	var lines []string
+	for _, n := range sortedKeys(m) {
+		lines = append(lines, fmt.Sprintf("%d = %q", n, m[n]))
+	}
+	return lines
+}
+
+// quotedPairs renders a string map as sorted `"key" = "value"` lines,
+// or nil if it is empty.
+func quotedPairs(m map[string]string) []string {
+	var lines []string
+	for _, k := range sortedStrings(m) {
+		lines = append(lines, fmt.Sprintf("%q = %q", k, m[k]))
+	}
+	return lines
+}
+
+// sortedStrings returns the keys of a string-keyed map in sorted order.
+func sortedStrings[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseLabels parses labels.toml content. It is UnmarshalLabels for a
+// string.
 func ParseLabels(text string) (*Labels, error) {
+	return UnmarshalLabels([]byte(text))
+}
+
+// UnmarshalLabels decodes labels.toml. It reads the subset of TOML the
+// toolkit writes (one key = value per line, no external TOML library
+// needed). Keys and sections it does not recognise are kept in Extra,
+// and MarshalLabels writes them back.
+func UnmarshalLabels(data []byte) (*Labels, error) {
 	labels := &Labels{
 		States:   make(map[int]string),
 		Inputs:   make(map[int]string),
@@ -118,8 +273,10 @@ func ParseLabels(text string) (*Labels, error) {
 	}
 	
 	var currentSection string
+	var currentMeta map[string]string // table for the current metadata section
+	known := true                     // whether currentSection is interpreted
 	
-	for _, line := range strings.Split(text, "\n") {
+	for _, line := range strings.Split(string(data), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -127,28 +284,34 @@ func ParseLabels(text string) (*Labels, error) {
 		
 		// Section header
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			currentSection = line[1 : len(line)-1]
+			currentSection = strings.TrimSpace(line[1 : len(line)-1])
+			currentMeta = labels.metadataTable(currentSection)
+			switch currentSection {
+			case "fsm", "states", "inputs", "outputs", "machines", "nets", "probabilities", "weights", "stack", "pops", "pushes":
+				known = true
+			default:
+				known = currentMeta != nil
+			}
+			if !known {
+				labels.Extra.addSection(currentSection)
+			}
 			continue
 		}
 		
 		// Key = value
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+		rawKey, rawValue, ok := splitKeyValue(line)
+		if !ok {
 			continue
 		}
-		
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		
-		// Remove quotes from key if present (for machines section)
-		if len(key) >= 2 && key[0] == '"' && key[len(key)-1] == '"' {
-			key = key[1 : len(key)-1]
+		if !known || currentSection == "" {
+			labels.Extra.add(currentSection, rawKey, rawValue)
+			continue
 		}
 		
-		// Remove quotes from value
-		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
-			value = value[1 : len(value)-1]
-		}
+		// Keys are quoted in the machines and nets sections; values are
+		// always written with %q.
+		key := unquoteKey(rawKey)
+		value := unquoteKey(rawValue)
 		
 		switch currentSection {
 		case "fsm":
@@ -163,21 +326,27 @@ func ParseLabels(text string) (*Labels, error) {
 				labels.FSM.Description = value
 			case "vocabulary":
 				labels.FSM.Vocabulary = value
+			case "stack_start":
+				labels.FSM.StackStart = value
+			default:
+				labels.Extra.add(currentSection, rawKey, rawValue)
 			}
-		case "states":
-			idx := parseHexKey(key)
-			if idx >= 0 {
-				labels.States[idx] = value
-			}
-		case "inputs":
-			idx := parseHexKey(key)
-			if idx >= 0 {
-				labels.Inputs[idx] = value
-			}
-		case "outputs":
-			idx := parseHexKey(key)
-			if idx >= 0 {
-				labels.Outputs[idx] = value
+		case "states", "inputs", "outputs", "stack", "pops", "pushes":
+			ids := map[string]*map[int]string{
+				"states":  &labels.States,
+				"inputs":  &labels.Inputs,
+				"outputs": &labels.Outputs,
+				"stack":   &labels.Stack,
+				"pops":    &labels.Pops,
+				"pushes":  &labels.Pushes,
+			}[currentSection]
+			if idx := parseHexKey(key); idx >= 0 {
+				if *ids == nil {
+					*ids = make(map[int]string)
+				}
+				(*ids)[idx] = value
+			} else {
+				labels.Extra.add(currentSection, rawKey, rawValue)
 			}
 		case "machines":
 			// key is state name (string), value is machine name
@@ -185,12 +354,65 @@ func ParseLabels(text string) (*Labels, error) {
 		case "nets":
 			// key is net name (string), value is endpoint list string
 			labels.Nets[key] = value
+		case "probabilities", "weights":
+			// key is a transition number, value a bare number
+			n, nerr := strconv.Atoi(key)
+			p, perr := strconv.ParseFloat(value, 64)
+			if nerr != nil || n < 0 || perr != nil {
+				labels.Extra.add(currentSection, rawKey, rawValue)
+				continue
+			}
+			table := &labels.Probabilities
+			if currentSection == "weights" {
+				table = &labels.Weights
+			}
+			if *table == nil {
+				*table = make(map[int]float64)
+			}
+			(*table)[n] = p
+		default:
+			currentMeta[key] = value
 		}
 	}
 	
 	return labels, nil
 }
 
+// metadataTable returns the map that a metadata section header
+// ("metadata", "state_metadata.\"name\"", "transition_metadata.N")
+// fills, creating it as needed, or nil for any other section.
+func (l *Labels) metadataTable(section string) map[string]string {
+	switch {
+	case section == "metadata":
+		if l.Metadata == nil {
+			l.Metadata = make(map[string]string)
+		}
+		return l.Metadata
+	case strings.HasPrefix(section, "state_metadata."):
+		state := unquoteKey(strings.TrimPrefix(section, "state_metadata."))
+		if l.StateMetadata == nil {
+			l.StateMetadata = make(map[string]map[string]string)
+		}
+		if l.StateMetadata[state] == nil {
+			l.StateMetadata[state] = make(map[string]string)
+		}
+		return l.StateMetadata[state]
+	case strings.HasPrefix(section, "transition_metadata."):
+		n, err := strconv.Atoi(strings.TrimPrefix(section, "transition_metadata."))
+		if err != nil || n < 0 {
+			return nil
+		}
+		if l.TransitionMetadata == nil {
+			l.TransitionMetadata = make(map[int]map[string]string)
+		}
+		if l.TransitionMetadata[n] == nil {
+			l.TransitionMetadata[n] = make(map[string]string)
+		}
+		return l.TransitionMetadata[n]
+	}
+	return nil
+}
+
 func parseHexKey(s string) int {
 	s = strings.TrimSpace(s)
 	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
@@ -329,8 +551,10 @@ func ReadFSMWithLayout(r io.ReaderAt, size int64) (*fsm.FSM, *Layout, error) {
 		return nil, nil, err
 	}
 	
-	var hexContent, labelsContent, layoutContent string
+	var labelsContent, layoutContent string
 	var classesData []byte
+	var records []Record
+	foundHex := false
 	
 	for _, f := range zr.File {
 		rc, err := f.Open()
@@ -338,6 +562,17 @@ func ReadFSMWithLayout(r io.ReaderAt, size int64) (*fsm.FSM, *Layout, error) {
 			return nil, nil, err
 		}
 		
+		// machine.hex can be large; parse it straight from the archive.
+		if f.Name == "machine.hex" {
+			records, err = readHex(rc, int64(f.UncompressedSize64))
+			rc.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			foundHex = true
+			continue
+		}
+		
 		data, err := io.ReadAll(rc)
 		rc.Close()
 		if err != nil {
@@ -345,8 +580,6 @@ func ReadFSMWithLayout(r io.ReaderAt, size int64) (*fsm.FSM, *Layout, error) {
 		}
 		
 		switch f.Name {
-		case "machine.hex":
-			hexContent = string(data)
 		case "labels.toml":
 			labelsContent = string(data)
 		case "layout.toml":
@@ -356,15 +589,10 @@ func ReadFSMWithLayout(r io.ReaderAt, size int64) (*fsm.FSM, *Layout, error) {
 		}
 	}
 	
-	if hexContent == "" {
+	if !foundHex {
 		return nil, nil, fmt.Errorf("machine.hex not found in archive")
 	}
 	
-	records, err := ParseHex(hexContent)
-	if err != nil {
-		return nil, nil, err
-	}
-	
 	var labels *Labels
 	if labelsContent != "" {
 		labels, err = ParseLabels(labelsContent)
@@ -1008,7 +1236,7 @@ func UpdateBundleMachines(bundlePath string, updates map[string]BundleMachineDat
 		
 		// Generate layout.toml
 		if len(data.Positions) > 0 {
-			layoutContent := generateLayoutToml(data.Positions, data.OffsetX, data.OffsetY)
+			layoutContent := GenerateLayout(data.Positions, data.OffsetX, data.OffsetY)
 			existingFiles[machineName+".layout.toml"] = []byte(layoutContent)
 		}
 
@@ -1030,7 +1258,9 @@ func UpdateBundleMachines(bundlePath string, updates map[string]BundleMachineDat
 	
 	zw := zip.NewWriter(outFile)
 	
-	for name, data := range existingFiles {
+	// Write entries in name order so that saving is reproducible.
+	for _, name := range sortedStrings(existingFiles) {
+		data := existingFiles[name]
 		w, err := zw.Create(name)
 		if err != nil {
 			zw.Close()
@@ -1062,80 +1292,11 @@ func UpdateBundleMachines(bundlePath string, updates map[string]BundleMachineDat
 	return nil
 }
 
-// generateLabelsToml creates labels.toml content for an FSM
+// generateLabelsToml creates labels.toml content for a bundle machine,
+// numbered as FSMToRecords numbers its hex file.
 func generateLabelsToml(f *fsm.FSM) string {
-	var buf bytes.Buffer
-	
-	buf.WriteString("[fsm]\n")
-	buf.WriteString("version = 1\n")
-	buf.WriteString(fmt.Sprintf("type = %q\n", f.Type))
-	if f.Name != "" {
-		buf.WriteString(fmt.Sprintf("name = %q\n", f.Name))
-	}
-	if f.Description != "" {
-		buf.WriteString(fmt.Sprintf("description = %q\n", f.Description))
-	}
-	buf.WriteString("\n")
-	
-	buf.WriteString("[states]\n")
-	for i, s := range f.States {
-		buf.WriteString(fmt.Sprintf("0x%04X = %q\n", i, s))
-	}
-	buf.WriteString("\n")
-	
-	buf.WriteString("[inputs]\n")
-	for i, inp := range f.Alphabet {
-		buf.WriteString(fmt.Sprintf("0x%04X = %q\n", i, inp))
-	}
-	
-	if len(f.OutputAlphabet) > 0 {
-		buf.WriteString("\n[outputs]\n")
-		for i, out := range f.OutputAlphabet {
-			buf.WriteString(fmt.Sprintf("0x%04X = %q\n", i, out))
-		}
-	}
-	
-	if len(f.LinkedMachines) > 0 {
-		buf.WriteString("\n[machines]\n")
-		for state, machine := range f.LinkedMachines {
-			buf.WriteString(fmt.Sprintf("%q = %q\n", state, machine))
-		}
-	}
-
-	if len(f.Nets) > 0 {
-		buf.WriteString("\n[nets]\n")
-		for _, n := range f.Nets {
-			var eps []string
-			for _, ep := range n.Endpoints {
-				eps = append(eps, ep.Instance+"."+ep.Port)
-			}
-			buf.WriteString(fmt.Sprintf("%q = %q\n", n.Name, strings.Join(eps, ", ")))
-		}
-	}
-	
-	return buf.String()
-}
-
-// generateLayoutToml creates layout.toml content
-func generateLayoutToml(positions map[string][2]int, offsetX, offsetY int) string {
-	var buf bytes.Buffer
-	
-	buf.WriteString("[layout]\n")
-	buf.WriteString("version = 1\n\n")
-	
-	buf.WriteString("[editor]\n")
-	buf.WriteString(fmt.Sprintf("canvas_offset_x = %d\n", offsetX))
-	buf.WriteString(fmt.Sprintf("canvas_offset_y = %d\n", offsetY))
-	buf.WriteString("\n")
-	
-	buf.WriteString("[states]\n")
-	for name, pos := range positions {
-		buf.WriteString(fmt.Sprintf("[states.%q]\n", name))
-		buf.WriteString(fmt.Sprintf("x = %d\n", pos[0]))
-		buf.WriteString(fmt.Sprintf("y = %d\n", pos[1]))
-	}
-	
-	return buf.String()
+	_, states, inputs, outputs := FSMToRecords(f)
+	return GenerateLabels(f, states, inputs, outputs)
 }
 
 // classesJSON is the JSON representation of class data within a .fsm zip.
@@ -1214,7 +1375,8 @@ func WriteBundleFromData(bundlePath string, machines map[string]BundleMachineDat
 
 	zw := zip.NewWriter(outFile)
 
-	for machineName, data := range machines {
+	for _, machineName := range sortedStrings(machines) {
+		data := machines[machineName]
 		// Generate hex records
 		records, _, _, _ := FSMToRecords(data.FSM)
 		hexContent := FormatHex(records, 1)
@@ -1250,7 +1412,7 @@ func WriteBundleFromData(bundlePath string, machines map[string]BundleMachineDat
 
 		// Generate layout.toml if positions available
 		if len(data.Positions) > 0 {
-			layoutContent := generateLayoutToml(data.Positions, data.OffsetX, data.OffsetY)
+			layoutContent := GenerateLayout(data.Positions, data.OffsetX, data.OffsetY)
 			w, err = zw.Create(machineName + ".layout.toml")
 			if err != nil {
 				zw.Close()
@@ -0,0 +1,249 @@
+package fsmfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// Format is a machine file format. The tools find formats through the
+// registry below rather than switching on extensions themselves, so that
+// every command and the editor read and write a format the same way.
+type Format interface {
+	// Name is the short name used on the command line, such as "json".
+	Name() string
+	// Extensions are the file extensions of the format, each with its
+	// leading dot, the preferred one first.
+	Extensions() []string
+	// Detect reports whether data looks like this format.
+	Detect(data []byte) bool
+	// Read decodes a machine, and its editor layout if the format keeps
+	// one (nil otherwise).
+	Read(data []byte) (*fsm.FSM, *Layout, error)
+	// Write encodes a machine. Options a format cannot represent are
+	// ignored.
+	Write(w io.Writer, f *fsm.FSM, opts WriteOptions) error
+}
+
+// WriteOptions control how a machine is written.
+type WriteOptions struct {
+	Pretty bool // indent JSON
+	Labels bool // include labels.toml in .fsm archives
+
+	// Editor layout for .fsm archives; nil positions write none.
+	Positions        map[string][2]int
+	OffsetX, OffsetY int
+}
+
+// formats is the registry, in detection order. Hex comes last because
+// text that is not a record is skipped, so it accepts anything.
+var formats = []Format{fsmFormat{}, jsonFormat{}, textFormat{}, hexFormat{}}
+
+// Formats returns the supported machine formats in detection order.
+func Formats() []Format {
+	return append([]Format(nil), formats...)
+}
+
+// FormatByName returns the format with the given short name, or nil.
+func FormatByName(name string) Format {
+	for _, ft := range formats {
+		if ft.Name() == name {
+			return ft
+		}
+	}
+	return nil
+}
+
+// FormatForPath returns the format for a file name's extension, or nil
+// if the extension is not a machine format's.
+func FormatForPath(path string) Format {
+	ext := filepath.Ext(path)
+	for _, ft := range formats {
+		for _, e := range ft.Extensions() {
+			if ext == e {
+				return ft
+			}
+		}
+	}
+	return nil
+}
+
+// DetectFormat returns the format data appears to be in. Since hex
+// accepts anything, it never returns nil.
+func DetectFormat(data []byte) Format {
+	for _, ft := range formats {
+		if ft.Detect(data) {
+			return ft
+		}
+	}
+	return hexFormat{}
+}
+
+// MachineExtensions returns the extensions of the supported machine file
+// formats, each with its leading dot, in the order tools list them.
+func MachineExtensions() []string {
+	var exts []string
+	for _, ft := range formats {
+		exts = append(exts, ft.Extensions()...)
+	}
+	return exts
+}
+
+// IsMachineFile reports whether path has the extension of a supported
+// machine file format.
+func IsMachineFile(path string) bool {
+	return FormatForPath(path) != nil
+}
+
+// ReadMachine decodes a machine from data in any supported format,
+// detected from the content. For a bundle it reads the first machine.
+// Included files are named relative to the current directory.
+func ReadMachine(data []byte) (*fsm.FSM, *Layout, error) {
+	f, layout, err := DetectFormat(data).Read(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ResolveIncludes(f, data, "."); err != nil {
+		return nil, nil, err
+	}
+	return f, layout, nil
+}
+
+// ReadMachineFile reads a machine from a file, in the format given by
+// its extension, or detected from the content for other extensions.
+// Included files are named relative to the file's directory.
+func ReadMachineFile(path string) (*fsm.FSM, *Layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	ft := FormatForPath(path)
+	if ft == nil {
+		ft = DetectFormat(data)
+	}
+	f, layout, err := ft.Read(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := resolveIncludes(f, data, filepath.Dir(path), []string{abs}); err != nil {
+		return nil, nil, err
+	}
+	return f, layout, nil
+}
+
+// WriteMachineFile writes a machine to a file in the format given by its
+// extension. Unknown extensions are an error.
+func WriteMachineFile(path string, f *fsm.FSM, opts WriteOptions) error {
+	ft := FormatForPath(path)
+	if ft == nil {
+		return fmt.Errorf("unknown output format: %s", filepath.Ext(path))
+	}
+	var buf bytes.Buffer
+	if err := ft.Write(&buf, f, opts); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// fsmFormat is the .fsm archive: machine.hex with labels.toml, layout.toml,
+// and classes.json in a ZIP file, or several machines in a bundle.
+type fsmFormat struct{}
+
+func (fsmFormat) Name() string         { return "fsm" }
+func (fsmFormat) Extensions() []string { return []string{".fsm"} }
+
+func (fsmFormat) Detect(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+func (fsmFormat) Read(data []byte) (*fsm.FSM, *Layout, error) {
+	r := bytes.NewReader(data)
+	machines, err := ListMachinesFromReader(r, int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(machines) > 1 || (len(machines) == 1 && machines[0].HexFile != "machine.hex") {
+		return ReadMachineFromBundleReader(r, int64(len(data)), machines[0].Name)
+	}
+	return ReadFSMWithLayout(r, int64(len(data)))
+}
+
+func (fsmFormat) Write(w io.Writer, f *fsm.FSM, opts WriteOptions) error {
+	return WriteFSMWithLayout(w, f, opts.Labels, opts.Positions, opts.OffsetX, opts.OffsetY)
+}
+
+// jsonFormat is the JSON format described by fsm.schema.json.
+type jsonFormat struct{}
+
+func (jsonFormat) Name() string         { return "json" }
+func (jsonFormat) Extensions() []string { return []string{".json"} }
+
+func (jsonFormat) Detect(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\uFEFF")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func (jsonFormat) Read(data []byte) (*fsm.FSM, *Layout, error) {
+	f, err := ParseJSON(data)
+	return f, nil, err
+}
+
+func (jsonFormat) Write(w io.Writer, f *fsm.FSM, opts WriteOptions) error {
+	data, err := ToJSON(f, opts.Pretty)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// textFormat is the line-oriented text format; see ToText.
+type textFormat struct{}
+
+func (textFormat) Name() string            { return "text" }
+func (textFormat) Extensions() []string    { return []string{".fsmt"} }
+func (textFormat) Detect(data []byte) bool { return detectText(data) }
+
+func (textFormat) Read(data []byte) (*fsm.FSM, *Layout, error) {
+	f, err := ParseText(data)
+	return f, nil, err
+}
+
+func (textFormat) Write(w io.Writer, f *fsm.FSM, opts WriteOptions) error {
+	_, err := w.Write(ToText(f))
+	return err
+}
+
+// hexFormat is bare hex records, with no names: states, inputs, and
+// outputs are numbered.
+type hexFormat struct{}
+
+func (hexFormat) Name() string         { return "hex" }
+func (hexFormat) Extensions() []string { return []string{".hex"} }
+func (hexFormat) Detect([]byte) bool   { return true }
+
+func (hexFormat) Read(data []byte) (*fsm.FSM, *Layout, error) {
+	records, err := ReadHex(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("no FSM data recognised")
+	}
+	f, err := RecordsToFSM(records, nil)
+	return f, nil, err
+}
+
+func (hexFormat) Write(w io.Writer, f *fsm.FSM, opts WriteOptions) error {
+	records, _, _, _ := FSMToRecords(f)
+	_, err := io.WriteString(w, FormatHex(records, 4)+"\n")
+	return err
+}
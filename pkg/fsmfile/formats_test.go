@@ -0,0 +1,111 @@
+package fsmfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormats_RoundTrip(t *testing.T) {
+	original := buildTestFSMWithMetadata()
+	for _, ft := range Formats() {
+		t.Run(ft.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := WriteOptions{Labels: true, Positions: map[string][2]int{"idle": {3, 4}}}
+			if err := ft.Write(&buf, original, opts); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := DetectFormat(buf.Bytes()); got.Name() != ft.Name() {
+				t.Errorf("DetectFormat = %s, want %s", got.Name(), ft.Name())
+			}
+			f, layout, err := ft.Read(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if len(f.States) != len(original.States) || len(f.Transitions) != len(original.Transitions) {
+				t.Errorf("got %d states, %d transitions; want %d, %d",
+					len(f.States), len(f.Transitions), len(original.States), len(original.Transitions))
+			}
+			if ft.Name() == "fsm" {
+				if layout == nil || layout.States["idle"].X != 3 {
+					t.Errorf("layout not kept: %+v", layout)
+				}
+			} else if layout != nil {
+				t.Errorf("%s should keep no layout", ft.Name())
+			}
+		})
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	cases := map[string]string{
+		"a.fsm":      "fsm",
+		"dir/b.json": "json",
+		"c.hex":      "hex",
+		"c.fsmt":     "text",
+		"d.txt":      "",
+		"e":          "",
+	}
+	for path, want := range cases {
+		ft := FormatForPath(path)
+		got := ""
+		if ft != nil {
+			got = ft.Name()
+		}
+		if got != want {
+			t.Errorf("FormatForPath(%q) = %q, want %q", path, got, want)
+		}
+		if got := IsMachineFile(path); got != (want != "") {
+			t.Errorf("IsMachineFile(%q) = %v", path, got)
+		}
+	}
+	if FormatByName("json") == nil || FormatByName("yaml") != nil {
+		t.Error("FormatByName should find json and not yaml")
+	}
+}
+
+func TestMachineFile_Extensions(t *testing.T) {
+	original := buildTestFSMWithMetadata()
+	dir := t.TempDir()
+
+	for _, ext := range MachineExtensions() {
+		path := filepath.Join(dir, "m"+ext)
+		if err := WriteMachineFile(path, original, WriteOptions{Labels: true}); err != nil {
+			t.Fatalf("WriteMachineFile(%s): %v", ext, err)
+		}
+		f, _, err := ReadMachineFile(path)
+		if err != nil {
+			t.Fatalf("ReadMachineFile(%s): %v", ext, err)
+		}
+		if len(f.States) != 3 {
+			t.Errorf("%s: got %d states, want 3", ext, len(f.States))
+		}
+	}
+
+	// An unknown extension is written nowhere, but read by content.
+	if err := WriteMachineFile(filepath.Join(dir, "m.txt"), original, WriteOptions{}); err == nil {
+		t.Error("expected an error writing an unknown extension")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "m.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sniffed := filepath.Join(dir, "machine.txt")
+	if err := os.WriteFile(sniffed, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := ReadMachineFile(sniffed)
+	if err != nil {
+		t.Fatalf("ReadMachineFile(.txt): %v", err)
+	}
+	if f.Initial != "idle" {
+		t.Errorf("initial = %q, want idle (names kept by JSON)", f.Initial)
+	}
+}
+
+func TestHexFormat_Empty(t *testing.T) {
+	if _, _, err := FormatByName("hex").Read([]byte("# nothing here\n")); err == nil {
+		t.Error("expected an error for hex with no records")
+	}
+}
@@ -0,0 +1,124 @@
+package fsmfile
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// ParseTests parses a test suite in the .fsmtest format, one test case
+// per line:
+//
+//	# turnstile, transition tour
+//	coin push => accept / click ""
+//	push push => reject
+//	coin coin => stuck / click
+//
+// Before "=>" are the inputs, and after it the verdict: accept, reject,
+// or stuck when the machine has no transition on the last input. An
+// optional "/" is followed by the output of each input taken, "" for a
+// step without output. Names are written as in the text format, quoted
+// when they contain spaces or would read as syntax. Blank lines and
+// comments are ignored.
+func ParseTests(data []byte) ([]fsm.TestCase, error) {
+	var cases []fsm.TestCase
+	for n, line := range strings.Split(string(data), "\n") {
+		tokens, _, err := splitTextLine(line, 0)
+		if err != nil {
+			return nil, &TextError{n + 1, err.Error()}
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		arrow := -1
+		for i, t := range tokens {
+			if t.is("=>") {
+				arrow = i
+				break
+			}
+		}
+		if arrow < 0 || arrow == len(tokens)-1 {
+			return nil, &TextError{n + 1, `expected "inputs => verdict"`}
+		}
+		tc := fsm.TestCase{Inputs: []string{}}
+		for _, t := range tokens[:arrow] {
+			tc.Inputs = append(tc.Inputs, t.text)
+		}
+		switch verdict := tokens[arrow+1]; {
+		case verdict.is("accept"):
+			tc.Accept = true
+		case verdict.is("reject"):
+		case verdict.is("stuck"):
+			tc.Stuck = true
+		default:
+			return nil, &TextError{n + 1, fmt.Sprintf("unknown verdict %q (want accept, reject, or stuck)", verdict.text)}
+		}
+		if tc.Stuck && len(tc.Inputs) == 0 {
+			return nil, &TextError{n + 1, "stuck needs an input to be stuck on"}
+		}
+
+		rest := tokens[arrow+2:]
+		if len(rest) > 0 {
+			if !rest[0].is("/") {
+				return nil, &TextError{n + 1, fmt.Sprintf("unexpected %q after the verdict", rest[0].text)}
+			}
+			tc.Outputs = []string{}
+			for _, t := range rest[1:] {
+				tc.Outputs = append(tc.Outputs, t.text)
+			}
+			taken := len(tc.Inputs)
+			if tc.Stuck {
+				taken--
+			}
+			if len(tc.Outputs) != taken {
+				return nil, &TextError{n + 1, fmt.Sprintf("%d outputs for %d inputs taken", len(tc.Outputs), taken)}
+			}
+		}
+		cases = append(cases, tc)
+	}
+	return cases, nil
+}
+
+// FormatTests writes test cases in the .fsmtest format read by
+// ParseTests, after a comment of the given lines, if any.
+func FormatTests(cases []fsm.TestCase, comment ...string) []byte {
+	var b bytes.Buffer
+	for _, c := range comment {
+		fmt.Fprintf(&b, "# %s\n", c)
+	}
+	for _, tc := range cases {
+		words := make([]string, 0, len(tc.Inputs)+2)
+		for _, in := range tc.Inputs {
+			words = append(words, testWord(in))
+		}
+		verdict := "reject"
+		switch {
+		case tc.Stuck:
+			verdict = "stuck"
+		case tc.Accept:
+			verdict = "accept"
+		}
+		words = append(words, "=>", verdict)
+		if len(tc.Outputs) > 0 {
+			words = append(words, "/")
+			for _, out := range tc.Outputs {
+				words = append(words, testWord(out))
+			}
+		}
+		b.WriteString(strings.Join(words, " "))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// testWord is textWord, also quoting the arrow of a test line.
+func testWord(s string) string {
+	if s == "=>" {
+		return strconv.Quote(s)
+	}
+	return textWord(s)
+}
@@ -0,0 +1,64 @@
+package fsmfile
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestParseTests(t *testing.T) {
+	src := `# turnstile
+coin push => accept / click ""
+
+=> reject
+"=>" "two words" push => stuck / beep "" # a comment
+`
+	cases, err := ParseTests([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fsm.TestCase{
+		{Inputs: []string{"coin", "push"}, Accept: true, Outputs: []string{"click", ""}},
+		{Inputs: []string{}},
+		{Inputs: []string{"=>", "two words", "push"}, Stuck: true, Outputs: []string{"beep", ""}},
+	}
+	if !reflect.DeepEqual(cases, want) {
+		t.Fatalf("got %+v", cases)
+	}
+
+	out := FormatTests(cases, "turnstile")
+	again, err := ParseTests(out)
+	if err != nil || !reflect.DeepEqual(again, want) {
+		t.Errorf("round trip: %v\n%s", err, out)
+	}
+	if !strings.HasPrefix(string(out), "# turnstile\ncoin push => accept / click \"\"\n") {
+		t.Errorf("formatted:\n%s", out)
+	}
+}
+
+func TestParseTests_Errors(t *testing.T) {
+	cases := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{"a b", 1, "expected"},
+		{"\na =>", 2, "expected"},
+		{"a => maybe", 1, "unknown verdict"},
+		{"=> stuck", 1, "needs an input"},
+		{"a => accept x", 1, "unexpected"},
+		{"a b => accept / x", 1, "1 outputs for 2"},
+		{"a b => stuck / x y", 1, "2 outputs for 1"},
+		{`a => "accept`, 1, "unterminated"},
+	}
+	for _, c := range cases {
+		_, err := ParseTests([]byte(c.src))
+		var te *TextError
+		if !errors.As(err, &te) || te.Line != c.line || !strings.Contains(te.Msg, c.msg) {
+			t.Errorf("%q: %v, want line %d: ...%s...", c.src, err, c.line, c.msg)
+		}
+	}
+}
@@ -15,6 +15,19 @@ const (
 	LoopBottom                 // Loop extends below
 )
 
+// String returns the side's name: right, left, top, or bottom.
+func (s LoopSide) String() string {
+	switch s {
+	case LoopLeft:
+		return "left"
+	case LoopTop:
+		return "top"
+	case LoopBottom:
+		return "bottom"
+	}
+	return "right"
+}
+
 // SelfLoopParams configures self-loop rendering.
 type SelfLoopParams struct {
 	Side       LoopSide
@@ -168,10 +181,34 @@ func SelfLoopBounds(points []Point) (minX, minY, maxX, maxY float64) {
 	return minX - dx, minY - dy, maxX + dx, maxY + dy
 }
 
+// LoopSurroundings describes what lies around a state, so that
+// ChooseSelfLoopSide can keep the state's self-loop clear of it.
+type LoopSurroundings struct {
+	// Towards holds, for each of the state's other transitions, a point
+	// it passes through near the state, such as its label or the far
+	// state: the loop avoids the sides they leave and arrive from.
+	Towards []Point
+
+	// Obstacles are boxes the loop should not cover: labels already
+	// placed, and other states.
+	Obstacles []Rect
+
+	// Occupied sides are not used.
+	Occupied map[LoopSide]bool
+
+	// Scale is the scale the loop will be drawn at, as passed to
+	// SelfLoopControlPoints; zero means 1.
+	Scale float64
+}
+
 // ChooseSelfLoopSide determines the best side for a self-loop based on
-// available space and canvas boundaries.
+// available space and canvas boundaries and, if around is not nil, on
+// the state's other transitions and the labels and states nearby. Of
+// the sides with room for the loop, it takes the one facing fewest
+// transitions and covering least of the obstacles; ties go, in order,
+// to right, top, left, and bottom.
 func ChooseSelfLoopSide(state Ellipse, canvasWidth, canvasHeight float64,
-	occupiedSides map[LoopSide]bool) LoopSide {
+	around *LoopSurroundings) LoopSide {
 	// Preference order: Right, Top, Left, Bottom
 	preference := []LoopSide{LoopRight, LoopTop, LoopLeft, LoopBottom}
 
@@ -183,30 +220,41 @@ func ChooseSelfLoopSide(state Ellipse, canvasWidth, canvasHeight float64,
 
 	requiredSpace := state.RX * 1.5 // Minimum space needed for loop
 
-	for _, side := range preference {
+	var occupiedSides map[LoopSide]bool
+	if around != nil {
+		occupiedSides = around.Occupied
+	}
+
+	best, bestCost := LoopRight, math.Inf(1)
+	for i, side := range preference {
 		if occupiedSides != nil && occupiedSides[side] {
 			continue
 		}
 
+		var space float64
 		switch side {
 		case LoopRight:
-			if spaceRight >= requiredSpace {
-				return LoopRight
-			}
+			space = spaceRight
 		case LoopLeft:
-			if spaceLeft >= requiredSpace {
-				return LoopLeft
-			}
+			space = spaceLeft
 		case LoopTop:
-			if spaceTop >= requiredSpace {
-				return LoopTop
-			}
+			space = spaceTop
 		case LoopBottom:
-			if spaceBottom >= requiredSpace {
-				return LoopBottom
-			}
+			space = spaceBottom
+		}
+		if space < requiredSpace {
+			continue
+		}
+		// A hundredth is less than any crossing or overlap worth
+		// avoiding, so it only breaks ties.
+		cost := loopSideCost(state, side, around) + float64(i)*0.01
+		if cost < bestCost {
+			best, bestCost = side, cost
 		}
 	}
+	if !math.IsInf(bestCost, 1) {
+		return best
+	}
 
 	// Fall back to side with most space
 	maxSpace := spaceRight
@@ -226,6 +274,54 @@ func ChooseSelfLoopSide(state Ellipse, canvasWidth, canvasHeight float64,
 	return bestSide
 }
 
+// loopSideCost scores how much a loop on the given side would get in the
+// way: each transition counts by how squarely it leaves towards that
+// side, from 1 for head on to 0 at right angles, and each obstacle by the
+// fraction of it the loop covers, twice over.
+func loopSideCost(state Ellipse, side LoopSide, around *LoopSurroundings) float64 {
+	if around == nil {
+		return 0
+	}
+	var dx, dy float64
+	switch side {
+	case LoopRight:
+		dx = 1
+	case LoopLeft:
+		dx = -1
+	case LoopTop:
+		dy = -1
+	case LoopBottom:
+		dy = 1
+	}
+	cost := 0.0
+	for _, p := range around.Towards {
+		vx, vy := p.X-state.CX, p.Y-state.CY
+		l := math.Hypot(vx, vy)
+		if l < 1e-9 {
+			continue
+		}
+		if c := (vx*dx + vy*dy) / l; c > 0 {
+			cost += c * c
+		}
+	}
+	if len(around.Obstacles) > 0 {
+		params := DefaultSelfLoopParams()
+		params.Side = side
+		scale := around.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		minX, minY, maxX, maxY := SelfLoopBounds(SelfLoopControlPoints(state, params, scale))
+		loop := Rect{X: (minX + maxX) / 2, Y: (minY + maxY) / 2, W: maxX - minX, H: maxY - minY}
+		for _, ob := range around.Obstacles {
+			if area := ob.W * ob.H; area > 0 {
+				cost += 2 * RectOverlap(loop, ob) / area
+			}
+		}
+	}
+	return cost
+}
+
 // Rect represents an axis-aligned rectangle.
 type Rect struct {
 	X, Y float64 // Center
@@ -311,6 +407,123 @@ func (lp *LabelPlacer) PlaceLabel(anchor Point, labelW, labelH, gap float64) Poi
 	return bestPos
 }
 
+// LabelBox is a transition label for SeparateLabels: the label's box,
+// centred where it is to be drawn, and the point it was first placed at,
+// next to its edge.
+type LabelBox struct {
+	Rect
+	Anchor Point
+}
+
+// NewLabelBox returns a box of the given size centred on its anchor.
+func NewLabelBox(x, y, w, h float64) LabelBox {
+	return LabelBox{Rect: Rect{X: x, Y: y, W: w, H: h}, Anchor: Point{X: x, Y: y}}
+}
+
+// Displaced reports whether the label has moved so far from its anchor
+// that a leader line should connect the two.
+func (l LabelBox) Displaced() bool {
+	return math.Hypot(l.X-l.Anchor.X, l.Y-l.Anchor.Y) > l.H*1.5
+}
+
+// Leader returns the ends of a leader line: the point on the label's box
+// nearest its anchor, and the anchor.
+func (l LabelBox) Leader() (Point, Point) {
+	near := Point{
+		X: math.Max(l.X-l.W/2, math.Min(l.Anchor.X, l.X+l.W/2)),
+		Y: math.Max(l.Y-l.H/2, math.Min(l.Anchor.Y, l.Y+l.H/2)),
+	}
+	return near, l.Anchor
+}
+
+// SeparateLabels is a whole-diagram pass run after every edge has placed
+// its label. Placing labels one edge at a time, as LabelPlacer does,
+// still piles them up on dense machines, where no candidate position is
+// free. SeparateLabels repeatedly pushes each overlapping pair of labels
+// apart, along whichever axis needs the smaller move (for wide labels
+// that is usually vertical, so a pile becomes a stack), and pushes
+// labels off the obstacles, normally the states. Labels stay within the
+// width×height canvas. Labels are processed in slice order, so the
+// result is deterministic. Labels that end up far from their anchors
+// report Displaced, and should be drawn with a leader line.
+func SeparateLabels(labels []LabelBox, obstacles []Rect, width, height float64) {
+	const gap = 2.0       // clearance kept between boxes
+	const maxPasses = 100 // enough for piles of a few dozen labels
+
+	for pass := 0; pass < maxPasses; pass++ {
+		moved := false
+		for i := range labels {
+			for j := i + 1; j < len(labels); j++ {
+				a, b := &labels[i].Rect, &labels[j].Rect
+				ox, oy := rectPenetration(*a, *b, gap)
+				if ox <= 0 || oy <= 0 {
+					continue
+				}
+				moved = true
+				if oy <= ox {
+					// On a tie the earlier label goes up.
+					dir := 1.0
+					if a.Y <= b.Y {
+						dir = -1
+					}
+					a.Y += dir * oy / 2
+					b.Y -= dir * oy / 2
+				} else {
+					dir := 1.0
+					if a.X <= b.X {
+						dir = -1
+					}
+					a.X += dir * ox / 2
+					b.X -= dir * ox / 2
+				}
+			}
+			for _, obs := range obstacles {
+				l := &labels[i].Rect
+				ox, oy := rectPenetration(*l, obs, gap)
+				if ox <= 0 || oy <= 0 {
+					continue
+				}
+				moved = true
+				if oy <= ox {
+					if l.Y < obs.Y {
+						l.Y -= oy
+					} else {
+						l.Y += oy
+					}
+				} else {
+					if l.X < obs.X {
+						l.X -= ox
+					} else {
+						l.X += ox
+					}
+				}
+			}
+			clampRect(&labels[i].Rect, width, height)
+		}
+		if !moved {
+			return
+		}
+	}
+}
+
+// rectPenetration returns how far a and b, each grown by gap, overlap
+// along each axis. Either value is zero or less if they do not overlap.
+func rectPenetration(a, b Rect, gap float64) (float64, float64) {
+	ox := (a.W+b.W)/2 + gap - math.Abs(a.X-b.X)
+	oy := (a.H+b.H)/2 + gap - math.Abs(a.Y-b.Y)
+	return ox, oy
+}
+
+// clampRect moves r inside a width×height canvas, if it fits.
+func clampRect(r *Rect, width, height float64) {
+	if width > r.W {
+		r.X = math.Max(r.W/2, math.Min(r.X, width-r.W/2))
+	}
+	if height > r.H {
+		r.Y = math.Max(r.H/2, math.Min(r.Y, height-r.H/2))
+	}
+}
+
 // PlaceLabelOnEdge places a label along an edge, trying the midpoint first,
 // then sliding along the edge to find a clear spot.
 func (lp *LabelPlacer) PlaceLabelOnEdge(p1, p2 Point, labelW, labelH, gap float64) Point {
@@ -98,6 +98,46 @@ func TestChooseSelfLoopSide(t *testing.T) {
 	}
 }
 
+func TestChooseSelfLoopSideAvoidsTransitions(t *testing.T) {
+	state := Ellipse{CX: 150, CY: 150, RX: 30, RY: 20}
+
+	// Transitions leave to the right and upwards: the loop goes left.
+	around := &LoopSurroundings{Towards: []Point{{300, 150}, {280, 120}, {150, 20}}}
+	if side := ChooseSelfLoopSide(state, 300, 300, around); side != LoopLeft {
+		t.Errorf("side %v, want LoopLeft", side)
+	}
+
+	// Transitions on every side but the bottom.
+	around = &LoopSurroundings{Towards: []Point{{300, 150}, {0, 150}, {150, 0}}}
+	if side := ChooseSelfLoopSide(state, 300, 300, around); side != LoopBottom {
+		t.Errorf("side %v, want LoopBottom", side)
+	}
+
+	// Empty surroundings keep the default preference.
+	if side := ChooseSelfLoopSide(state, 300, 300, &LoopSurroundings{}); side != LoopRight {
+		t.Errorf("side %v, want LoopRight", side)
+	}
+}
+
+func TestChooseSelfLoopSideAvoidsObstacles(t *testing.T) {
+	state := Ellipse{CX: 150, CY: 150, RX: 30, RY: 20}
+
+	// A label just right of the state and another state above it.
+	around := &LoopSurroundings{Obstacles: []Rect{
+		{X: 200, Y: 150, W: 40, H: 14},
+		{X: 150, Y: 90, W: 60, H: 40},
+	}}
+	if side := ChooseSelfLoopSide(state, 300, 300, around); side != LoopLeft {
+		t.Errorf("side %v, want LoopLeft", side)
+	}
+
+	// Occupied sides are never used, however clear.
+	around.Occupied = map[LoopSide]bool{LoopLeft: true}
+	if side := ChooseSelfLoopSide(state, 300, 300, around); side != LoopBottom {
+		t.Errorf("side %v, want LoopBottom", side)
+	}
+}
+
 func TestRectOverlap(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -216,3 +256,64 @@ func TestSelfLoopLabelPosition(t *testing.T) {
 		t.Errorf("Label Y=%.2f should be near apex Y=%.2f", pos.Y, apex.Y)
 	}
 }
+
+func TestSeparateLabels(t *testing.T) {
+	// Six labels piled on one spot next to a state.
+	state := Rect{X: 100, Y: 100, W: 80, H: 60}
+	var labels []LabelBox
+	for i := 0; i < 6; i++ {
+		labels = append(labels, NewLabelBox(150, 100, 40, 14))
+	}
+	SeparateLabels(labels, []Rect{state}, 400, 300)
+
+	for i, a := range labels {
+		if RectOverlap(a.Rect, state) > 0 {
+			t.Errorf("label %d at (%.1f, %.1f) overlaps the state", i, a.X, a.Y)
+		}
+		if a.X-a.W/2 < 0 || a.X+a.W/2 > 400 || a.Y-a.H/2 < 0 || a.Y+a.H/2 > 300 {
+			t.Errorf("label %d at (%.1f, %.1f) is off the canvas", i, a.X, a.Y)
+		}
+		for j := i + 1; j < len(labels); j++ {
+			if RectOverlap(a.Rect, labels[j].Rect) > 0 {
+				t.Errorf("labels %d and %d overlap", i, j)
+			}
+		}
+	}
+
+	again := make([]LabelBox, 6)
+	for i := range again {
+		again[i] = NewLabelBox(150, 100, 40, 14)
+	}
+	SeparateLabels(again, []Rect{state}, 400, 300)
+	for i := range labels {
+		if labels[i] != again[i] {
+			t.Fatalf("label %d at %v, then at %v", i, labels[i].Rect, again[i].Rect)
+		}
+	}
+}
+
+func TestSeparateLabels_LeavesClearLabels(t *testing.T) {
+	labels := []LabelBox{NewLabelBox(50, 50, 40, 14), NewLabelBox(150, 50, 40, 14)}
+	SeparateLabels(labels, nil, 400, 300)
+	for i, l := range labels {
+		if l.X != l.Anchor.X || l.Y != l.Anchor.Y {
+			t.Errorf("clear label %d moved to (%.1f, %.1f)", i, l.X, l.Y)
+		}
+	}
+}
+
+func TestLabelBoxLeader(t *testing.T) {
+	l := NewLabelBox(100, 100, 40, 14)
+	l.Y = 140
+	if !l.Displaced() {
+		t.Fatal("label 40px from its anchor is not displaced")
+	}
+	from, to := l.Leader()
+	if from != (Point{100, 133}) || to != (Point{100, 100}) {
+		t.Errorf("leader from %v to %v, want from the top of the box to the anchor", from, to)
+	}
+	l.Y = 110
+	if l.Displaced() {
+		t.Error("label 10px from its anchor is displaced")
+	}
+}
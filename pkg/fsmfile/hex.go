@@ -3,7 +3,6 @@ package fsmfile
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -93,35 +92,10 @@ func parseHex16(s string) (uint16, error) {
 	return uint16(v), err
 }
 
-// ParseHex parses hex records from text.
+// ParseHex parses hex records from text. See HexScanner for the
+// accepted syntax, and ReadHex to parse from a stream.
 func ParseHex(text string) ([]Record, error) {
-	// Remove comments
-	lines := strings.Split(text, "\n")
-	var cleanLines []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		cleanLines = append(cleanLines, line)
-	}
-	text = strings.Join(cleanLines, " ")
-	
-	// Match pattern: TYPE SSSS:IIII TTTT:OOOO
-	pattern := regexp.MustCompile(`([0-9A-Fa-f]{4})\s*([0-9A-Fa-f]{4}):([0-9A-Fa-f]{4})\s*([0-9A-Fa-f]{4}):([0-9A-Fa-f]{4})`)
-	matches := pattern.FindAllStringSubmatch(text, -1)
-	
-	var records []Record
-	for _, m := range matches {
-		rec := fmt.Sprintf("%s %s:%s %s:%s", m[1], m[2], m[3], m[4], m[5])
-		r, err := ParseRecord(rec)
-		if err != nil {
-			return nil, err
-		}
-		records = append(records, r)
-	}
-	
-	return records, nil
+	return ReadHex(strings.NewReader(text))
 }
 
 // FormatHex formats records as text.
@@ -163,6 +137,25 @@ func FSMToRecords(f *fsm.FSM) ([]Record, map[int]string, map[int]string, map[int
 	for i, o := range f.OutputAlphabet {
 		outputIdx[o] = i
 	}
+	// Validate allows outputs when the output alphabet is empty; give
+	// any undeclared outputs their own indices so they are not lost.
+	addOutput := func(o string) {
+		if _, ok := outputIdx[o]; !ok {
+			outputIdx[o] = len(outputIdx)
+		}
+	}
+	if f.Type == fsm.TypeMoore {
+		for _, state := range f.States {
+			if o, ok := f.StateOutputs[state]; ok {
+				addOutput(o)
+			}
+		}
+	}
+	for _, t := range f.Transitions {
+		if t.Output != nil {
+			addOutput(*t.Output)
+		}
+	}
 	
 	// Reverse maps for labels
 	stateNames := make(map[int]string)
@@ -506,8 +499,10 @@ func RecordsToFSM(records []Record, labels *Labels) (*fsm.FSM, error) {
 		f.SetInitial(stateName(initialState))
 	}
 	var accepting []string
-	for s := range acceptingStates {
-		accepting = append(accepting, stateName(s))
+	for i := 0; i <= maxKey(acceptingStates); i++ {
+		if acceptingStates[i] {
+			accepting = append(accepting, stateName(i))
+		}
 	}
 	f.SetAccepting(accepting)
 	
@@ -527,9 +522,12 @@ func RecordsToFSM(records []Record, labels *Labels) (*fsm.FSM, error) {
 		}
 	}
 	
-	// Set Moore outputs
-	for s, o := range stateOutputs {
-		f.SetStateOutput(stateName(s), outputName(o))
+	// Set Moore outputs. Other types cannot carry them (FSMToRecords
+	// would drop them), so stray state outputs are ignored.
+	if fsmType == fsm.TypeMoore {
+		for s, o := range stateOutputs {
+			f.SetStateOutput(stateName(s), outputName(o))
+		}
 	}
 	
 	// Add transitions
@@ -553,6 +551,46 @@ func RecordsToFSM(records []Record, labels *Labels) (*fsm.FSM, error) {
 		
 		f.AddTransition(stateName(t.from), inputPtr, toNames, outputPtr)
 	}
+
+	// Tool metadata from labels.toml
+	if labels != nil {
+		f.Metadata = labels.Metadata
+		f.StateMetadata = labels.StateMetadata
+		for n, m := range labels.TransitionMetadata {
+			if n < len(f.Transitions) {
+				f.Transitions[n].Metadata = m
+			}
+		}
+		for n, p := range labels.Probabilities {
+			if n < len(f.Transitions) {
+				p := p
+				f.Transitions[n].Probability = &p
+			}
+		}
+		for n, w := range labels.Weights {
+			if n < len(f.Transitions) {
+				w := w
+				f.Transitions[n].Weight = &w
+			}
+		}
+
+		// PDA stack alphabet and operations
+		for _, id := range sortedKeys(labels.Stack) {
+			f.StackAlphabet = append(f.StackAlphabet, labels.Stack[id])
+		}
+		f.StackStart = labels.FSM.StackStart
+		for n, sym := range labels.Pops {
+			if n < len(f.Transitions) {
+				sym := sym
+				f.Transitions[n].Pop = &sym
+			}
+		}
+		for n, push := range labels.Pushes {
+			if n < len(f.Transitions) && push != "" {
+				f.Transitions[n].Push = strings.Split(push, ", ")
+			}
+		}
+	}
 	
 	return f, nil
 }
@@ -0,0 +1,206 @@
+package fsmfile
+
+import (
+	"io"
+	"os"
+)
+
+// recordMaxLen is the longest normalised record text:
+// "TTTT SSSS:IIII TTTT:OOOO" with single spaces.
+const recordMaxLen = 24
+
+// hexRecordSize is the approximate size of one record in a hex dump
+// (FormatRecord plus a separator), used to preallocate record slices.
+const hexRecordSize = 26
+
+// HexScanner reads hex records one at a time from a stream, in the
+// manner of bufio.Scanner, so that large dumps can be processed without
+// holding the text in memory. It accepts exactly what ParseHex accepts:
+// lines starting with '#' are comments, records may be split across
+// whitespace and line breaks, and text that is not a record is skipped.
+//
+//	sc := fsmfile.NewHexScanner(r)
+//	for sc.Scan() {
+//		rec := sc.Record()
+//		...
+//	}
+//	if err := sc.Err(); err != nil { ... }
+type HexScanner struct {
+	r     io.Reader
+	chunk []byte // read buffer
+	buf   []byte // normalised text not yet matched
+	pos   int    // start of unmatched text in buf
+	rec   Record
+	err   error
+	eof   bool
+
+	lineStart bool // at the start of a line (skipping leading space)
+	comment   bool // inside a comment line
+	space     bool // last byte written to buf was a space
+}
+
+// NewHexScanner returns a scanner reading from r.
+func NewHexScanner(r io.Reader) *HexScanner {
+	return &HexScanner{
+		r:         r,
+		chunk:     make([]byte, 32*1024),
+		buf:       make([]byte, 0, 32*1024),
+		lineStart: true,
+		space:     true,
+	}
+}
+
+// Scan advances to the next record, returning false at the end of the
+// input or on a read error.
+func (s *HexScanner) Scan() bool {
+	for {
+		// A match needs at most recordMaxLen bytes, so unless the input
+		// is exhausted, only try once that much text is buffered.
+		for len(s.buf)-s.pos >= recordMaxLen || (s.eof && s.pos < len(s.buf)) {
+			if n := matchRecord(s.buf[s.pos:], &s.rec); n > 0 {
+				s.pos += n
+				return true
+			}
+			s.pos++
+		}
+		if s.eof {
+			return false
+		}
+		s.fill()
+	}
+}
+
+// Record returns the record found by the last successful Scan.
+func (s *HexScanner) Record() Record {
+	return s.rec
+}
+
+// Err returns the first read error, if any. io.EOF is not an error.
+func (s *HexScanner) Err() error {
+	return s.err
+}
+
+// fill reads the next chunk of input into buf, dropping comment lines
+// and collapsing each run of whitespace to a single space. Lines are
+// joined by a space, as in ParseHex.
+func (s *HexScanner) fill() {
+	if s.pos > 0 {
+		n := copy(s.buf, s.buf[s.pos:])
+		s.buf = s.buf[:n]
+		s.pos = 0
+	}
+	n, err := s.r.Read(s.chunk)
+	for _, c := range s.chunk[:n] {
+		switch {
+		case c == '\n':
+			s.lineStart, s.comment = true, false
+			s.putSpace()
+		case s.comment:
+		case isHexSpace(c):
+			if !s.lineStart {
+				s.putSpace()
+			}
+		case s.lineStart && c == '#':
+			s.comment = true
+		default:
+			s.lineStart = false
+			s.buf = append(s.buf, c)
+			s.space = false
+		}
+	}
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		s.eof = true
+	}
+}
+
+func (s *HexScanner) putSpace() {
+	if !s.space {
+		s.buf = append(s.buf, ' ')
+		s.space = true
+	}
+}
+
+// matchRecord matches "HHHH\s*HHHH:HHHH\s*HHHH:HHHH" at the start of b,
+// where whitespace has already been collapsed to at most one space. It
+// returns the length matched, or 0 if b does not start with a record.
+func matchRecord(b []byte, r *Record) int {
+	i := 0
+	var fields [5]uint16
+	for f := range fields {
+		switch f {
+		case 1, 3:
+			if i < len(b) && b[i] == ' ' {
+				i++
+			}
+		case 2, 4:
+			if i >= len(b) || b[i] != ':' {
+				return 0
+			}
+			i++
+		}
+		if i+4 > len(b) {
+			return 0
+		}
+		var v uint16
+		for _, c := range b[i : i+4] {
+			d, ok := hexDigit(c)
+			if !ok {
+				return 0
+			}
+			v = v<<4 | d
+		}
+		fields[f] = v
+		i += 4
+	}
+	*r = Record{Type: fields[0], Field1: fields[1], Field2: fields[2], Field3: fields[3], Field4: fields[4]}
+	return i
+}
+
+func hexDigit(c byte) (uint16, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return uint16(c - '0'), true
+	case c >= 'a' && c <= 'f':
+		return uint16(c-'a') + 10, true
+	case c >= 'A' && c <= 'F':
+		return uint16(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+// isHexSpace reports whether c is whitespace as matched by \s.
+func isHexSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\f'
+}
+
+// ReadHex reads all hex records from r. Unlike ParseHex it does not need
+// the whole text in memory, and when the input size is known (a file,
+// or a bytes/strings reader) the record slice is allocated once.
+func ReadHex(r io.Reader) ([]Record, error) {
+	var size int64
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		size = int64(v.Len())
+	case *os.File:
+		if info, err := v.Stat(); err == nil && info.Mode().IsRegular() {
+			size = info.Size()
+		}
+	}
+	return readHex(r, size)
+}
+
+// readHex is ReadHex with an explicit size hint in bytes (0 if unknown).
+func readHex(r io.Reader, size int64) ([]Record, error) {
+	var records []Record
+	if size > 0 {
+		records = make([]Record, 0, size/hexRecordSize+1)
+	}
+	sc := NewHexScanner(r)
+	for sc.Scan() {
+		records = append(records, sc.Record())
+	}
+	return records, sc.Err()
+}
@@ -0,0 +1,139 @@
+package fsmfile
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// parseHexRegexp is the original whole-string parser, kept as a
+// reference for the streaming one.
+func parseHexRegexp(text string) []Record {
+	var clean []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		clean = append(clean, line)
+	}
+	pattern := regexp.MustCompile(`([0-9A-Fa-f]{4})\s*([0-9A-Fa-f]{4}):([0-9A-Fa-f]{4})\s*([0-9A-Fa-f]{4}):([0-9A-Fa-f]{4})`)
+	var records []Record
+	for _, m := range pattern.FindAllStringSubmatch(strings.Join(clean, " "), -1) {
+		r, _ := ParseRecord(fmt.Sprintf("%s %s:%s %s:%s", m[1], m[2], m[3], m[4], m[5]))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestHexScanner_MatchesParseHex(t *testing.T) {
+	inputs := []string{
+		"",
+		"# only a comment",
+		"0000 0000:0000 0001:0000",
+		"0000 0000:0000 0001:0000   0001 0001:0002 0003:0004\n0002 0000:0003 0000:0000",
+		"0000 0000:0000\n0001:0000", // record split across lines
+		"  # comment\n0000 0000:0000 0001:0000 # trailing text is not a comment\n",
+		"0000\t\t0000:0000\r\n\r\n0001:0000",
+		"abcd ABCD:ef01 2345:6789",
+		"000000000000000000000000000", // no separators: not a record
+		"12345 0000:0000 0001:0000",   // leading junk digit
+		"0000 0000:0000 0001:000g 0000 0000:0000 0001:0000",
+		"xx0000 0000:0000 0001:0000yy",
+		"0000 0000:0000 0001:0000\n#0000 0000:0000 0001:0000\n0000 0000:0000 0002:0000",
+	}
+	for _, in := range inputs {
+		want := parseHexRegexp(in)
+
+		got, err := ParseHex(in)
+		if err != nil {
+			t.Fatalf("ParseHex(%q): %v", in, err)
+		}
+		if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Errorf("ParseHex(%q) = %v, want %v", in, got, want)
+		}
+
+		// Feed one byte at a time to exercise every buffer boundary.
+		got, err = ReadHex(iotest.OneByteReader(strings.NewReader(in)))
+		if err != nil {
+			t.Fatalf("ReadHex(%q): %v", in, err)
+		}
+		if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Errorf("ReadHex(%q) one byte at a time = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestHexScanner_ReadError(t *testing.T) {
+	r := iotest.TimeoutReader(strings.NewReader(strings.Repeat("0000 0000:0000 0001:0000\n", 2000)))
+	if _, err := ReadHex(r); err == nil {
+		t.Error("expected the read error to be returned")
+	}
+}
+
+func TestReadHex_LargeMachine(t *testing.T) {
+	text := randomHex(t, 2000, 8)
+	want := parseHexRegexp(text)
+	got, err := ReadHex(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	if want := len(text)/hexRecordSize + 1; cap(got) != want {
+		t.Errorf("capacity %d, want the preallocated %d (slice was regrown)", cap(got), want)
+	}
+}
+
+func randomHex(tb testing.TB, states, inputs int) string {
+	tb.Helper()
+	f, err := fsm.Random(fsm.RandomOptions{States: states, Alphabet: inputs, Type: fsm.TypeMealy, Seed: 1})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	records, _, _, _ := FSMToRecords(f)
+	return FormatHex(records, 4)
+}
+
+func BenchmarkParseHex(b *testing.B) {
+	text := randomHex(b, 20000, 16) // roughly 7 MB
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseHex(text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseHexRegexp(b *testing.B) {
+	text := randomHex(b, 20000, 16)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parseHexRegexp(text)
+	}
+}
+
+func BenchmarkHexScanner(b *testing.B) {
+	text := randomHex(b, 20000, 16)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sc := NewHexScanner(strings.NewReader(text))
+		for sc.Scan() {
+		}
+		if err := sc.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package fsmfile
+
+import (
+	"fmt"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// Highlight selects states and edges that the native renderers draw in
+// a distinct colour, for example the path taken by an input word.
+type Highlight struct {
+	States map[string]bool
+	Edges  map[HighlightEdge]bool
+}
+
+// HighlightEdge identifies a drawn edge by its endpoints. All
+// transitions between the same two states share one edge. An empty
+// From denotes the arrow marking the initial state.
+type HighlightEdge struct {
+	From, To string
+}
+
+// NewHighlight returns an empty highlight.
+func NewHighlight() *Highlight {
+	return &Highlight{
+		States: make(map[string]bool),
+		Edges:  make(map[HighlightEdge]bool),
+	}
+}
+
+// AddState highlights a state.
+func (h *Highlight) AddState(name string) {
+	h.States[name] = true
+}
+
+// AddEdge highlights the edge from one state to another.
+func (h *Highlight) AddEdge(from, to string) {
+	h.Edges[HighlightEdge{from, to}] = true
+}
+
+// state reports whether a state is highlighted; h may be nil.
+func (h *Highlight) state(name string) bool {
+	return h != nil && h.States[name]
+}
+
+// edge reports whether an edge is highlighted; h may be nil.
+func (h *Highlight) edge(from, to string) bool {
+	return h != nil && h.Edges[HighlightEdge{from, to}]
+}
+
+// TraceError reports an input with no transition from the states
+// reached so far, which ends a trace early.
+type TraceError struct {
+	Step  int    // 1-based position of the input in the word
+	Input string // the rejected input
+	Err   error  // the runner's error
+}
+
+func (e *TraceError) Error() string {
+	return fmt.Sprintf("input %d: %v", e.Step, e.Err)
+}
+
+func (e *TraceError) Unwrap() error { return e.Err }
+
+// TraceHighlight runs inputs through f from its initial state and
+// highlights every state the machine passes through and every edge it
+// takes, including epsilon moves of an NFA. If an input has no
+// transition, it returns the path up to that point along with a
+// *TraceError.
+func TraceHighlight(f *fsm.FSM, inputs []string) (*Highlight, error) {
+	steps, err := TraceSteps(f, inputs)
+	if steps == nil {
+		return nil, err
+	}
+	h := NewHighlight()
+	for _, step := range steps {
+		for s := range step.States {
+			h.AddState(s)
+		}
+		for e := range step.Edges {
+			h.Edges[e] = true
+		}
+	}
+	return h, err
+}
+
+// TraceSteps runs inputs through f and returns one highlight per step:
+// the first holds the initial states, and each later one holds the
+// states active after an input and the edges taken to reach them. As
+// with TraceHighlight, an input with no transition ends the trace and
+// the steps so far are returned along with a *TraceError.
+func TraceSteps(f *fsm.FSM, inputs []string) ([]*Highlight, error) {
+	r, err := fsm.NewRunner(f)
+	if err != nil {
+		return nil, err
+	}
+	current := r.CurrentStates()
+	start := NewHighlight()
+	start.AddEdge("", f.Initial)
+	for _, s := range current {
+		start.AddState(s)
+	}
+	start.addEpsilonEdges(f, current)
+	steps := []*Highlight{start}
+
+	for i, input := range inputs {
+		if _, err := r.Step(input); err != nil {
+			return steps, &TraceError{Step: i + 1, Input: input, Err: err}
+		}
+		next := r.CurrentStates()
+		h := NewHighlight()
+		from := stringSet(current)
+		to := stringSet(next)
+		for _, t := range f.Transitions {
+			if t.Input == nil || *t.Input != input || !from[t.From] {
+				continue
+			}
+			for _, target := range t.To {
+				if to[target] {
+					h.AddEdge(t.From, target)
+				}
+			}
+		}
+		for _, s := range next {
+			h.AddState(s)
+		}
+		h.addEpsilonEdges(f, next)
+		steps = append(steps, h)
+		current = next
+	}
+	return steps, nil
+}
+
+// addEpsilonEdges highlights the epsilon transitions between states of
+// one step's state set, which is already closed under epsilon moves.
+func (h *Highlight) addEpsilonEdges(f *fsm.FSM, states []string) {
+	set := stringSet(states)
+	for _, t := range f.Transitions {
+		if t.Input != nil || !set[t.From] {
+			continue
+		}
+		for _, target := range t.To {
+			if set[target] {
+				h.AddEdge(t.From, target)
+			}
+		}
+	}
+}
+
+func stringSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, s := range items {
+		set[s] = true
+	}
+	return set
+}
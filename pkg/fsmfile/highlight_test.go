@@ -0,0 +1,127 @@
+package fsmfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// highlightTestFSM is a DFA a -x-> b -y-> c with a self-loop on c and a
+// transition back from c to a.
+func highlightTestFSM() *fsm.FSM {
+	f := fsm.New(fsm.TypeDFA)
+	for _, s := range []string{"a", "b", "c"} {
+		f.AddState(s)
+	}
+	f.AddInput("x")
+	f.AddInput("y")
+	f.AddTransition("a", strp("x"), []string{"b"}, nil)
+	f.AddTransition("b", strp("y"), []string{"c"}, nil)
+	f.AddTransition("c", strp("y"), []string{"c"}, nil)
+	f.AddTransition("c", strp("x"), []string{"a"}, nil)
+	f.SetInitial("a")
+	f.SetAccepting([]string{"c"})
+	return f
+}
+
+func TestTraceHighlight_DFA(t *testing.T) {
+	h, err := TraceHighlight(highlightTestFSM(), []string{"x", "y", "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStates := map[string]bool{"a": true, "b": true, "c": true}
+	if !reflect.DeepEqual(h.States, wantStates) {
+		t.Errorf("states = %v, want %v", h.States, wantStates)
+	}
+	wantEdges := map[HighlightEdge]bool{{"", "a"}: true, {"a", "b"}: true, {"b", "c"}: true, {"c", "c"}: true}
+	if !reflect.DeepEqual(h.Edges, wantEdges) {
+		t.Errorf("edges = %v, want %v", h.Edges, wantEdges)
+	}
+}
+
+func TestTraceHighlight_NFAEpsilon(t *testing.T) {
+	f := fsm.New(fsm.TypeNFA)
+	for _, s := range []string{"s", "p", "q", "r"} {
+		f.AddState(s)
+	}
+	f.AddInput("a")
+	f.AddTransition("s", nil, []string{"p"}, nil)
+	f.AddTransition("p", strp("a"), []string{"q", "r"}, nil)
+	f.AddTransition("s", strp("a"), []string{"s"}, nil)
+	f.SetInitial("s")
+
+	h, err := TraceHighlight(f, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []HighlightEdge{{"s", "p"}, {"p", "q"}, {"p", "r"}, {"s", "s"}} {
+		if !h.Edges[e] {
+			t.Errorf("edge %v not highlighted", e)
+		}
+	}
+	for _, s := range f.States {
+		if !h.States[s] {
+			t.Errorf("state %s not highlighted", s)
+		}
+	}
+}
+
+func TestTraceHighlight_StopsAtMissingTransition(t *testing.T) {
+	h, err := TraceHighlight(highlightTestFSM(), []string{"x", "x", "y"})
+	if err == nil {
+		t.Fatal("expected an error for input with no transition")
+	}
+	if h == nil || !h.States["b"] || h.States["c"] {
+		t.Errorf("partial highlight = %+v, want path up to b", h)
+	}
+}
+
+func TestSVGHighlight(t *testing.T) {
+	f := highlightTestFSM()
+	plain := GenerateSVGNative(f, DefaultSVGOptions())
+	if strings.Contains(plain, "highlight") {
+		t.Error("SVG without a highlight should not mention highlight classes")
+	}
+
+	h := NewHighlight()
+	h.AddState("b")
+	h.AddEdge("a", "b")
+	opts := DefaultSVGOptions()
+	opts.Highlight = h
+	svg := GenerateSVGNative(f, opts)
+	if !strings.Contains(svg, `id="arrowhead-highlight"`) {
+		t.Error("highlight marker missing")
+	}
+	if n := strings.Count(svg, `class="transition transition-highlight"`); n != 1 {
+		t.Errorf("%d highlighted transitions, want 1", n)
+	}
+	if n := strings.Count(svg, "state-highlight\""); n != 1 {
+		t.Errorf("%d highlighted state shapes, want 1", n)
+	}
+	if !strings.Contains(svg, `class="trans-label trans-label-highlight" text-anchor="middle">x</text>`) {
+		t.Error("label of highlighted transition not highlighted")
+	}
+}
+
+func TestPNGHighlight(t *testing.T) {
+	f := highlightTestFSM()
+	h, err := TraceHighlight(f, []string{"x", "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultPNGOptions()
+	var plain, traced bytes.Buffer
+	if err := RenderPNG(f, &plain, opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.Highlight = h
+	if err := RenderPNG(f, &traced, opts); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(plain.Bytes(), traced.Bytes()) {
+		t.Error("highlight did not change the PNG")
+	}
+}
@@ -0,0 +1,74 @@
+package fsmfile
+
+import (
+	_ "embed"
+	"html/template"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+//go:embed viewer.html
+var viewerHTML string
+
+var viewerTemplate = template.Must(template.New("viewer").Parse(viewerHTML))
+
+// HTMLOptions configures GenerateHTML.
+type HTMLOptions struct {
+	Title string     // page heading (default: machine name)
+	SVG   SVGOptions // diagram options; Highlight and DataAttributes are set by GenerateHTML
+}
+
+// DefaultHTMLOptions returns the default SVG options and no title.
+func DefaultHTMLOptions() HTMLOptions {
+	return HTMLOptions{SVG: DefaultSVGOptions()}
+}
+
+// GenerateHTML returns a self-contained HTML page for reviewing f: the
+// native SVG diagram, one button per input symbol, and a script that
+// steps the machine (from its JSON form, embedded in the page) and
+// highlights the active states and the transitions just taken. The page
+// needs no network access.
+func GenerateHTML(f *fsm.FSM, opts HTMLOptions) (string, error) {
+	machine, err := ToJSON(f, false)
+	if err != nil {
+		return "", err
+	}
+
+	title := opts.Title
+	if title == "" {
+		title = f.Name
+	}
+	if title == "" {
+		title = strings.ToUpper(string(f.Type))
+	}
+
+	svgOpts := opts.SVG
+	svgOpts.Title = ""
+	svgOpts.Highlight = NewHighlight() // emits the highlight styles
+	svgOpts.DataAttributes = true
+	svg := GenerateSVGNative(f, svgOpts)
+	if i := strings.Index(svg, "<svg"); i > 0 {
+		svg = svg[i:] // drop the XML declaration
+	}
+
+	var sb strings.Builder
+	err = viewerTemplate.Execute(&sb, struct {
+		Title       string
+		Description string
+		SVG         template.HTML
+		Machine     template.JS
+	}{
+		Title:       title,
+		Description: f.Description,
+		// Both are generated here: the SVG escapes every name, and
+		// encoding/json escapes <, >, and & so the JSON cannot end the
+		// script element.
+		SVG:     template.HTML(svg),
+		Machine: template.JS(machine),
+	})
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,80 @@
+package fsmfile
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSVGDataAttributes(t *testing.T) {
+	f := highlightTestFSM()
+	plain := GenerateSVGNative(f, DefaultSVGOptions())
+	if strings.Contains(plain, "data-") {
+		t.Error("data attributes emitted without DataAttributes")
+	}
+
+	opts := DefaultSVGOptions()
+	opts.DataAttributes = true
+	svg := GenerateSVGNative(f, opts)
+	for _, s := range f.States {
+		if !strings.Contains(svg, `<g data-state="`+s+`">`) {
+			t.Errorf("no group for state %s", s)
+		}
+	}
+	for _, e := range []string{`data-from="" data-to="a"`, `data-from="a" data-to="b"`, `data-from="c" data-to="c"`} {
+		if !strings.Contains(svg, "<g "+e+">") {
+			t.Errorf("no group with %s", e)
+		}
+	}
+	if open, closed := strings.Count(svg, "<g "), strings.Count(svg, "</g>"); open != closed {
+		t.Errorf("%d groups opened, %d closed", open, closed)
+	}
+}
+
+func TestGenerateHTML(t *testing.T) {
+	f := highlightTestFSM()
+	f.Name = `A <b> & "c"`
+	page, err := GenerateHTML(f, DefaultHTMLOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page, "<b>") || !strings.Contains(page, "<title>A &lt;b&gt; &amp; &#34;c&#34;</title>") {
+		t.Error("machine name not escaped in the page title")
+	}
+	if strings.Contains(page, "<?xml") {
+		t.Error("XML declaration left in the embedded SVG")
+	}
+	if !strings.Contains(page, `<g data-state="a">`) || !strings.Contains(page, ".transition-highlight") {
+		t.Error("embedded SVG lacks data attributes or highlight styles")
+	}
+
+	const open = `<script id="machine" type="application/json">`
+	i := strings.Index(page, open)
+	if i < 0 {
+		t.Fatal("machine JSON not embedded")
+	}
+	rest := page[i+len(open):]
+	embedded := rest[:strings.Index(rest, "</script>")]
+	loaded, err := ParseJSON([]byte(embedded))
+	if err != nil {
+		t.Fatalf("embedded JSON does not parse: %v", err)
+	}
+	if !loaded.StructurallyEqual(f) {
+		t.Error("embedded machine differs from the original")
+	}
+	if !json.Valid([]byte(embedded)) || strings.Contains(embedded, "<") {
+		t.Error("embedded JSON must be valid and free of '<'")
+	}
+}
+
+func TestGenerateHTML_TitleOption(t *testing.T) {
+	opts := DefaultHTMLOptions()
+	opts.Title = "Review copy"
+	page, err := GenerateHTML(highlightTestFSM(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page, "<h1>Review copy</h1>") {
+		t.Error("title option not used")
+	}
+}
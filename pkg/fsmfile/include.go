@@ -0,0 +1,237 @@
+package fsmfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// Include is a directive to merge another machine file into the one being
+// read: a reusable fragment, such as a standard error-handling subgraph.
+// In JSON it is an entry of the "include" array:
+//
+//	"include": [
+//	  {"file": "errors.json", "prefix": "err_", "bind": {"done": "idle"}}
+//	]
+//
+// and in the text format an include line:
+//
+//	include errors.fsmt prefix err_
+//	  bind done idle
+//
+// The fragment's states are renamed with Prefix, except those bound to a
+// state of the including machine, which become that state. Its inputs and
+// outputs keep their names, so that the including machine's transitions
+// and the fragment's share events.
+type Include struct {
+	File    string            `json:"file"`              // relative to the including file
+	Prefix  string            `json:"prefix,omitempty"`  // prepended to the fragment's state names
+	Machine string            `json:"machine,omitempty"` // machine to take from a bundle
+	Bind    map[string]string `json:"bind,omitempty"`    // fragment state -> including state
+}
+
+// ResolveIncludes merges into f, which was read from data, the fragments
+// data includes, naming files relative to dir. Fragments may include
+// fragments of their own; a file that includes itself is an error.
+//
+// ReadMachineFile and ReadMachine call this, so tools see the merged
+// machine, and writing it out writes the fragments in full. A fragment's
+// accepting states stay accepting and its initial state is ignored. f
+// refers to fragment states by their prefixed names, so a state of f with
+// such a name is the fragment's state, unless f gives it transitions of
+// its own or makes it initial, which is an error. The fragment must have
+// f's type, except that a DFA can be included in an NFA.
+func ResolveIncludes(f *fsm.FSM, data []byte, dir string) error {
+	return resolveIncludes(f, data, dir, nil)
+}
+
+// resolveIncludes is ResolveIncludes, with the absolute paths of the
+// files being read, to find include cycles.
+func resolveIncludes(f *fsm.FSM, data []byte, dir string, reading []string) error {
+	includes, err := includesOf(data)
+	if err != nil {
+		return err
+	}
+	for _, inc := range includes {
+		path := inc.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		for _, p := range reading {
+			if p == abs {
+				return fmt.Errorf("include %s: file includes itself", inc.File)
+			}
+		}
+		frag, err := readFragment(path, inc.Machine, append(reading, abs))
+		if err == nil {
+			err = mergeFragment(f, frag, inc)
+		}
+		if err != nil {
+			return fmt.Errorf("include %s: %w", inc.File, err)
+		}
+	}
+	return nil
+}
+
+// includesOf returns the include directives of JSON or text data. Other
+// formats cannot include.
+func includesOf(data []byte) ([]Include, error) {
+	switch DetectFormat(data).(type) {
+	case jsonFormat:
+		var j struct {
+			Include []Include `json:"include"`
+		}
+		if err := json.Unmarshal(data, &j); err != nil {
+			return nil, err
+		}
+		for _, inc := range j.Include {
+			if inc.File == "" {
+				return nil, fmt.Errorf("include without a file")
+			}
+		}
+		return j.Include, nil
+	case textFormat:
+		_, includes, err := parseText(data)
+		return includes, err
+	}
+	return nil, nil
+}
+
+// readFragment reads an included file, and the files it includes.
+func readFragment(path, machine string, reading []string) (*fsm.FSM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ft := FormatForPath(path)
+	if ft == nil {
+		ft = DetectFormat(data)
+	}
+	var f *fsm.FSM
+	switch {
+	case machine == "":
+		f, _, err = ft.Read(data)
+	case ft.Name() == "fsm":
+		f, _, err = ReadMachineFromBundleReader(bytes.NewReader(data), int64(len(data)), machine)
+	default:
+		return nil, fmt.Errorf("machine %q: only a .fsm bundle holds several machines", machine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveIncludes(f, data, filepath.Dir(path), reading); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// mergeFragment adds g's states and transitions to f as inc directs.
+func mergeFragment(f, g *fsm.FSM, inc Include) error {
+	if g.Type != f.Type && !(g.Type == fsm.TypeDFA && f.Type == fsm.TypeNFA) {
+		return fmt.Errorf("cannot include a %s in a %s", g.Type, f.Type)
+	}
+	hostStates := make(map[string]bool, len(f.States))
+	for _, s := range f.States {
+		hostStates[s] = true
+	}
+	hostFrom := make(map[string]bool)
+	for _, t := range f.Transitions {
+		hostFrom[t.From] = true
+	}
+	fragStates := make(map[string]bool, len(g.States))
+	for _, s := range g.States {
+		fragStates[s] = true
+	}
+	for from, to := range inc.Bind {
+		if !fragStates[from] {
+			return fmt.Errorf("bind: %q is not a state of the fragment", from)
+		}
+		if !hostStates[to] {
+			return fmt.Errorf("bind: %q is not a state of the including machine", to)
+		}
+	}
+	rename := func(s string) string {
+		if to, ok := inc.Bind[s]; ok {
+			return to
+		}
+		return inc.Prefix + s
+	}
+
+	f.EnsureClassMaps()
+	accepting := make(map[string]bool, len(g.Accepting))
+	for _, s := range g.Accepting {
+		accepting[s] = true
+	}
+	for _, s := range g.States {
+		if _, ok := inc.Bind[s]; ok {
+			continue
+		}
+		n := rename(s)
+		if hostFrom[n] || n == f.Initial {
+			return fmt.Errorf("state %q is already a state of the including machine", n)
+		}
+		f.AddState(n)
+		if accepting[s] && !f.IsAccepting(n) {
+			f.Accepting = append(f.Accepting, n)
+		}
+		if out, ok := g.StateOutputs[s]; ok {
+			f.StateOutputs[n] = out
+		}
+		if m, ok := g.LinkedMachines[s]; ok {
+			f.SetLinkedMachine(n, m)
+		}
+		for k, v := range g.StateMetadata[s] {
+			f.SetStateMetadata(n, k, v)
+		}
+		if c, ok := g.StateClasses[s]; ok {
+			f.StateClasses[n] = c
+			if _, defined := f.Classes[c]; !defined && g.Classes[c] != nil {
+				f.Classes[c] = g.Classes[c]
+			}
+		}
+		if props, ok := g.StateProperties[s]; ok {
+			f.StateProperties[n] = props
+		}
+	}
+
+	for _, in := range g.Alphabet {
+		f.AddInput(in)
+	}
+	for _, out := range g.OutputAlphabet {
+		f.AddOutput(out)
+	}
+	f.StackAlphabet = unionStrings(f.StackAlphabet, g.StackAlphabet)
+	for _, t := range g.Transitions {
+		t.From = rename(t.From)
+		to := make([]string, len(t.To))
+		for i, s := range t.To {
+			to[i] = rename(s)
+		}
+		t.To = to
+		f.Transitions = append(f.Transitions, t)
+	}
+	return nil
+}
+
+// unionStrings returns a's strings followed by those of b not in a.
+func unionStrings(a, b []string) []string {
+	in := make(map[string]bool, len(a))
+	for _, s := range a {
+		in[s] = true
+	}
+	for _, s := range b {
+		if !in[s] {
+			in[s] = true
+			a = append(a, s)
+		}
+	}
+	return a
+}
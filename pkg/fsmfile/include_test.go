@@ -0,0 +1,158 @@
+package fsmfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes name -> content files into a new directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// retryFragment is a retry subgraph that gives up after two failures.
+const retryFragment = `type dfa
+inputs fail ok
+
+state first initial
+state second
+state done accepting
+state gave_up
+
+first -> second on fail
+second -> gave_up on fail
+first -> done on ok
+second -> done on ok
+`
+
+func TestReadMachineFile_Include(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib/retry.fsmt": retryFragment,
+		"job.json": `{
+  "type": "dfa",
+  "states": ["idle", "running"],
+  "alphabet": ["start"],
+  "initial": "idle",
+  "accepting": [],
+  "transitions": [
+    {"from": "idle", "input": "start", "to": "running"},
+    {"from": "running", "input": "fail", "to": "retry_first"}
+  ],
+  "include": [{"file": "lib/retry.fsmt", "prefix": "retry_", "bind": {"done": "idle"}}]
+}`,
+	})
+
+	f, _, err := ReadMachineFile(filepath.Join(dir, "job.json"))
+	if err != nil {
+		t.Fatalf("ReadMachineFile: %v", err)
+	}
+	wantStates := []string{"idle", "running", "retry_first", "retry_second", "retry_gave_up"}
+	if !reflect.DeepEqual(f.States, wantStates) {
+		t.Errorf("states = %v, want %v", f.States, wantStates)
+	}
+	if !reflect.DeepEqual(f.Alphabet, []string{"start", "fail", "ok"}) {
+		t.Errorf("alphabet = %v", f.Alphabet)
+	}
+	if len(f.Accepting) != 0 {
+		t.Errorf("accepting = %v; done was bound to idle, which is not accepting", f.Accepting)
+	}
+	if got := f.Transitions[len(f.Transitions)-1]; got.From != "retry_second" || got.To[0] != "idle" {
+		t.Errorf("last transition = %s -> %v, want retry_second -> idle", got.From, got.To)
+	}
+	if f.Initial != "idle" {
+		t.Errorf("initial = %q; the fragment's initial state must not replace it", f.Initial)
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("merged machine does not validate: %v", err)
+	}
+}
+
+func TestReadMachineFile_NestedTextInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"retry.fsmt": retryFragment,
+		"wrapped.fsmt": `type dfa
+state entry initial
+entry -> r_first on go
+include retry.fsmt prefix r_
+`,
+		"main.fsmt": `type dfa
+state idle initial
+idle -> w_entry on begin
+include wrapped.fsmt prefix w_
+`,
+	})
+	f, _, err := ReadMachineFile(filepath.Join(dir, "main.fsmt"))
+	if err != nil {
+		t.Fatalf("ReadMachineFile: %v", err)
+	}
+	if !f.IsAccepting("w_r_done") {
+		t.Errorf("states %v: w_r_done should be an accepting state", f.States)
+	}
+}
+
+func TestReadMachineFile_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"cycle", map[string]string{
+			"a.fsmt": "state x initial\ninclude b.fsmt prefix b_\n",
+			"b.fsmt": "state y\ninclude a.fsmt prefix a_\n",
+		}, "includes itself"},
+		{"clash", map[string]string{
+			"a.fsmt":     "type dfa\nstate r_first initial\ninclude retry.fsmt prefix r_\n",
+			"retry.fsmt": retryFragment,
+		}, `"r_first" is already a state`},
+		{"bind to unknown state", map[string]string{
+			"a.fsmt":     "type dfa\nstate x initial\ninclude retry.fsmt\n  bind done nowhere\n",
+			"retry.fsmt": retryFragment,
+		}, `"nowhere" is not a state of the including machine`},
+		{"type", map[string]string{
+			"a.fsmt":     "type mealy\nstate x initial\ninclude retry.fsmt prefix r_\n",
+			"retry.fsmt": retryFragment,
+		}, "cannot include a dfa in a mealy"},
+		{"missing", map[string]string{
+			"a.fsmt": "state x initial\ninclude nope.fsmt\n",
+		}, "include nope.fsmt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			_, _, err := ReadMachineFile(filepath.Join(dir, "a.fsmt"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseText_IncludeSyntax(t *testing.T) {
+	_, includes, err := parseText([]byte("include \"lib/errors.fsmt\" prefix err_ machine handler\n  bind done idle\nstate idle initial\n"))
+	if err != nil {
+		t.Fatalf("parseText: %v", err)
+	}
+	want := []Include{{File: "lib/errors.fsmt", Prefix: "err_", Machine: "handler", Bind: map[string]string{"done": "idle"}}}
+	if !reflect.DeepEqual(includes, want) {
+		t.Errorf("includes = %+v, want %+v", includes, want)
+	}
+	for _, bad := range []string{"include a.fsmt as x\n", "include a.fsmt prefix\n", "include a.fsmt\n  link x\n"} {
+		if _, err := ParseText([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package fsmfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// GraphicsProtocol is a way of drawing images in a terminal.
+type GraphicsProtocol string
+
+const (
+	GraphicsNone  GraphicsProtocol = ""
+	GraphicsKitty GraphicsProtocol = "kitty" // kitty graphics protocol (kitty, Ghostty, Konsole)
+	GraphicsITerm GraphicsProtocol = "iterm" // iTerm2 inline images (iTerm2, WezTerm, mintty)
+	GraphicsSixel GraphicsProtocol = "sixel" // DEC sixel graphics (foot, mlterm, xterm -ti vt340)
+)
+
+// GraphicsProtocols lists the protocols WriteInlineImage supports.
+var GraphicsProtocols = []GraphicsProtocol{GraphicsKitty, GraphicsITerm, GraphicsSixel}
+
+// DetectGraphicsProtocol guesses which image protocol the terminal
+// supports from its environment variables, looked up with getenv (use
+// os.Getenv). It returns GraphicsNone when it cannot tell. Terminals
+// announce themselves unevenly: iTerm2 sets LC_TERMINAL, which ssh
+// forwards by default, but most sixel terminals can only be recognised
+// by their TERM.
+func DetectGraphicsProtocol(getenv func(string) string) GraphicsProtocol {
+	term := getenv("TERM")
+	switch getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "mintty":
+		return GraphicsITerm
+	case "ghostty":
+		return GraphicsKitty
+	}
+	switch {
+	case getenv("LC_TERMINAL") == "iTerm2":
+		return GraphicsITerm
+	case getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty":
+		return GraphicsKitty
+	case getenv("KONSOLE_VERSION") != "":
+		return GraphicsKitty
+	case strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") ||
+		strings.HasPrefix(term, "mlterm") || strings.HasPrefix(term, "contour") ||
+		strings.HasPrefix(term, "yaft"):
+		return GraphicsSixel
+	}
+	return GraphicsNone
+}
+
+// WriteInlineImage writes escape sequences drawing a PNG image at the
+// cursor of a terminal that supports the given protocol. Kitty and
+// iTerm2 terminals decode the PNG themselves; for sixel the image is
+// flattened onto white and reduced to the 216 web-safe colours.
+func WriteInlineImage(w io.Writer, pngData []byte, proto GraphicsProtocol) error {
+	switch proto {
+	case GraphicsKitty:
+		return writeKitty(w, pngData)
+	case GraphicsITerm:
+		data := base64.StdEncoding.EncodeToString(pngData)
+		_, err := fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;preserveAspectRatio=1:%s\x07", len(pngData), data)
+		return err
+	case GraphicsSixel:
+		img, err := png.Decode(bytes.NewReader(pngData))
+		if err != nil {
+			return err
+		}
+		return writeSixel(w, img)
+	}
+	return fmt.Errorf("unknown graphics protocol %q", proto)
+}
+
+// kittyChunk is the most base64 data the kitty protocol takes in one
+// escape sequence.
+const kittyChunk = 4096
+
+func writeKitty(w io.Writer, pngData []byte) error {
+	data := base64.StdEncoding.EncodeToString(pngData)
+	bw := bufio.NewWriter(w)
+	for first := true; first || len(data) > 0; first = false {
+		n := len(data)
+		if n > kittyChunk {
+			n = kittyChunk
+		}
+		more := 0
+		if n < len(data) {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(bw, "\x1b_Ga=T,f=100,m=%d;%s\x1b\\", more, data[:n])
+		} else {
+			fmt.Fprintf(bw, "\x1b_Gm=%d;%s\x1b\\", more, data[:n])
+		}
+		data = data[n:]
+	}
+	return bw.Flush()
+}
+
+// writeSixel encodes img as sixels: bands six pixels high, each drawn
+// once per colour it uses, with runs of the same column pattern
+// compressed.
+func writeSixel(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, b.Min, draw.Over)
+	pal := image.NewPaletted(flat.Bounds(), palette.WebSafe)
+	draw.Draw(pal, pal.Bounds(), flat, image.Point{}, draw.Src)
+
+	width, height := pal.Rect.Dx(), pal.Rect.Dy()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range palette.WebSafe {
+		r, g, bl, _ := c.RGBA()
+		fmt.Fprintf(bw, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+
+	row := make([]byte, width)
+	for y0 := 0; y0 < height; y0 += 6 {
+		used := make(map[uint8]bool)
+		var order []uint8
+		for y := y0; y < y0+6 && y < height; y++ {
+			for x := 0; x < width; x++ {
+				if c := pal.ColorIndexAt(x, y); !used[c] {
+					used[c] = true
+					order = append(order, c)
+				}
+			}
+		}
+		for i, c := range order {
+			for x := 0; x < width; x++ {
+				bits := byte(0)
+				for dy := 0; dy < 6 && y0+dy < height; dy++ {
+					if pal.ColorIndexAt(x, y0+dy) == c {
+						bits |= 1 << dy
+					}
+				}
+				row[x] = '?' + bits
+			}
+			fmt.Fprintf(bw, "#%d", c)
+			writeSixelRuns(bw, row)
+			if i < len(order)-1 {
+				bw.WriteByte('$')
+			}
+		}
+		bw.WriteByte('-')
+	}
+	bw.WriteString("\x1b\\")
+	return bw.Flush()
+}
+
+// writeSixelRuns writes a row of sixel characters, with a run of four
+// or more of the same as "!count" and the character.
+func writeSixelRuns(w *bufio.Writer, row []byte) {
+	for i := 0; i < len(row); {
+		j := i
+		for j < len(row) && row[j] == row[i] {
+			j++
+		}
+		if n := j - i; n >= 4 {
+			fmt.Fprintf(w, "!%d%c", n, row[i])
+		} else {
+			w.Write(row[i:j])
+		}
+		i = j
+	}
+}
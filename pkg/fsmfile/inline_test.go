@@ -0,0 +1,107 @@
+package fsmfile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestDetectGraphicsProtocol(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want GraphicsProtocol
+	}{
+		{map[string]string{"TERM": "xterm-kitty"}, GraphicsKitty},
+		{map[string]string{"TERM": "xterm-256color", "KITTY_WINDOW_ID": "1"}, GraphicsKitty},
+		{map[string]string{"TERM_PROGRAM": "iTerm.app"}, GraphicsITerm},
+		// iTerm2 over ssh: only LC_TERMINAL survives.
+		{map[string]string{"TERM": "xterm-256color", "LC_TERMINAL": "iTerm2"}, GraphicsITerm},
+		{map[string]string{"TERM": "foot"}, GraphicsSixel},
+		{map[string]string{"TERM": "xterm-256color"}, GraphicsNone},
+		{map[string]string{}, GraphicsNone},
+	}
+	for _, tt := range tests {
+		if got := DetectGraphicsProtocol(func(k string) string { return tt.env[k] }); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func inlineTestPNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.Black)
+			} else {
+				img.Set(x, y, color.RGBA{0xff, 0, 0, 0xff})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteInlineImage(t *testing.T) {
+	data := inlineTestPNG(t, 8, 7)
+
+	var out bytes.Buffer
+	if err := WriteInlineImage(&out, data, GraphicsITerm); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); !strings.HasPrefix(s, "\x1b]1337;File=inline=1;") ||
+		!strings.HasSuffix(s, ":"+base64.StdEncoding.EncodeToString(data)+"\x07") {
+		t.Errorf("iterm: %q", s)
+	}
+
+	out.Reset()
+	if err := WriteInlineImage(&out, data, GraphicsSixel); err != nil {
+		t.Fatal(err)
+	}
+	s := out.String()
+	if !strings.HasPrefix(s, "\x1bP0;1;0q\"1;1;8;7") || !strings.HasSuffix(s, "\x1b\\") {
+		t.Errorf("sixel framing: %q", s)
+	}
+	// Two bands of black (colour 0) and red (180), each filling half the
+	// width: all six rows, then the seventh alone.
+	body := s[strings.LastIndex(s, "#215;2;100;100;100")+len("#215;2;100;100;100") : len(s)-2]
+	if want := "#0!4~!4?$#180!4?!4~-#0!4@!4?$#180!4?!4@-"; body != want {
+		t.Errorf("sixel body %q, want %q", body, want)
+	}
+
+	if err := WriteInlineImage(&out, data, "ascii"); err == nil {
+		t.Error("unknown protocol accepted")
+	}
+}
+
+func TestWriteInlineImage_KittyChunks(t *testing.T) {
+	data := bytes.Repeat([]byte{0xa5}, kittyChunk) // 4/3 chunks of base64
+	var out bytes.Buffer
+	if err := writeKitty(&out, data); err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimSuffix(out.String(), "\x1b\\"), "\x1b\\")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "\x1b_Ga=T,f=100,m=1;") || !strings.HasPrefix(parts[1], "\x1b_Gm=0;") {
+		t.Fatalf("chunks %d: %.40q", len(parts), parts)
+	}
+	var joined string
+	for _, p := range parts {
+		joined += p[strings.IndexByte(p, ';')+1:]
+	}
+	if got, _ := base64.StdEncoding.DecodeString(joined); !bytes.Equal(got, data) {
+		t.Error("payload does not round trip")
+	}
+
+	out.Reset()
+	writeKitty(&out, []byte("x"))
+	if s := out.String(); s != "\x1b_Ga=T,f=100,m=0;eA==\x1b\\" {
+		t.Errorf("single chunk %q", s)
+	}
+}
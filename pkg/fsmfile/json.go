@@ -20,6 +20,8 @@ type jsonFSM struct {
 	StateOutputs   map[string]string `json:"state_outputs,omitempty"`
 	OutputAlphabet []string          `json:"output_alphabet,omitempty"`
 	LinkedMachines map[string]string `json:"linked_machines,omitempty"`
+	StackAlphabet  []string          `json:"stack_alphabet,omitempty"`
+	StackStart     string            `json:"stack_start,omitempty"`
 
 	// Class system
 	Classes         map[string]*fsm.Class                `json:"classes,omitempty"`
@@ -31,6 +33,13 @@ type jsonFSM struct {
 
 	// Vocabulary
 	Vocabulary string `json:"vocabulary,omitempty"`
+
+	// Tool metadata
+	Metadata      map[string]string            `json:"metadata,omitempty"`
+	StateMetadata map[string]map[string]string `json:"state_metadata,omitempty"`
+
+	// Fragments merged in by ResolveIncludes; never written.
+	Include []Include `json:"include,omitempty"`
 }
 
 type jsonTransition struct {
@@ -38,6 +47,14 @@ type jsonTransition struct {
 	Input  *string     `json:"input"`
 	To     interface{} `json:"to"` // string or []string
 	Output *string     `json:"output,omitempty"`
+
+	Probability *float64 `json:"probability,omitempty"`
+	Weight      *float64 `json:"weight,omitempty"`
+
+	Pop  *string  `json:"pop,omitempty"`  // PDA only
+	Push []string `json:"push,omitempty"` // PDA only
+
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // ParseJSON parses an FSM from JSON.
@@ -55,6 +72,8 @@ func ParseJSON(data []byte) (*fsm.FSM, error) {
 	f.Initial = j.Initial
 	f.Accepting = j.Accepting
 	f.OutputAlphabet = j.OutputAlphabet
+	f.StackAlphabet = j.StackAlphabet
+	f.StackStart = j.StackStart
 	
 	if j.StateOutputs != nil {
 		f.StateOutputs = j.StateOutputs
@@ -78,6 +97,14 @@ func ParseJSON(data []byte) (*fsm.FSM, error) {
 		}
 		
 		f.AddTransition(jt.From, jt.Input, to, jt.Output)
+		f.Transitions[len(f.Transitions)-1].Probability = jt.Probability
+		f.Transitions[len(f.Transitions)-1].Weight = jt.Weight
+		f.Transitions[len(f.Transitions)-1].Pop = jt.Pop
+		f.Transitions[len(f.Transitions)-1].Push = jt.Push
+		f.Transitions[len(f.Transitions)-1].Metadata = jt.Metadata
+	}
+	if f.Type == "" {
+		f.Type = inferType(f)
 	}
 
 	// Load class system (older files may not have these fields).
@@ -107,10 +134,44 @@ func ParseJSON(data []byte) (*fsm.FSM, error) {
 	if j.Vocabulary != "" {
 		f.Vocabulary = j.Vocabulary
 	}
+	f.Metadata = j.Metadata
+	f.StateMetadata = j.StateMetadata
 	
 	return f, nil
 }
 
+// inferType picks a type for a document that omits "type", using the
+// same rules as RecordsToFSM: transition outputs make it Mealy, state
+// outputs Moore, and epsilon or multi-target transitions an NFA. Stack
+// operations, which RecordsToFSM never sees, make it a PDA.
+func inferType(f *fsm.FSM) fsm.Type {
+	for _, t := range f.Transitions {
+		if t.Pop != nil || len(t.Push) > 0 {
+			return fsm.TypePDA
+		}
+	}
+	for _, t := range f.Transitions {
+		if t.Output != nil {
+			return fsm.TypeMealy
+		}
+	}
+	if len(f.StateOutputs) > 0 {
+		return fsm.TypeMoore
+	}
+	seen := make(map[[2]string]bool)
+	for _, t := range f.Transitions {
+		if t.Input == nil || len(t.To) > 1 {
+			return fsm.TypeNFA
+		}
+		key := [2]string{t.From, *t.Input}
+		if seen[key] {
+			return fsm.TypeNFA
+		}
+		seen[key] = true
+	}
+	return fsm.TypeDFA
+}
+
 // coercePropertyValue converts a JSON-deserialised value to the correct
 // Go type based on the property's declared type in the class definition.
 func coercePropertyValue(f *fsm.FSM, state, propName string, raw interface{}) interface{} {
@@ -189,6 +250,8 @@ func ToJSON(f *fsm.FSM, pretty bool) ([]byte, error) {
 		Initial:        f.Initial,
 		Accepting:      f.Accepting,
 		OutputAlphabet: f.OutputAlphabet,
+		StackAlphabet:  f.StackAlphabet,
+		StackStart:     f.StackStart,
 	}
 	
 	if len(f.StateOutputs) > 0 {
@@ -201,9 +264,14 @@ func ToJSON(f *fsm.FSM, pretty bool) ([]byte, error) {
 	
 	for _, t := range f.Transitions {
 		jt := jsonTransition{
-			From:   t.From,
-			Input:  t.Input,
-			Output: t.Output,
+			From:        t.From,
+			Input:       t.Input,
+			Output:      t.Output,
+			Probability: t.Probability,
+			Weight:      t.Weight,
+			Pop:         t.Pop,
+			Push:        t.Push,
+			Metadata:    t.Metadata,
 		}
 		
 		if len(t.To) == 1 {
@@ -252,6 +320,12 @@ func ToJSON(f *fsm.FSM, pretty bool) ([]byte, error) {
 	if f.Vocabulary != "" {
 		j.Vocabulary = f.Vocabulary
 	}
+	if len(f.Metadata) > 0 {
+		j.Metadata = f.Metadata
+	}
+	if len(f.StateMetadata) > 0 {
+		j.StateMetadata = f.StateMetadata
+	}
 	
 	if pretty {
 		return json.MarshalIndent(j, "", "  ")
@@ -6,11 +6,18 @@ import (
 	"strings"
 )
 
-// Layout represents visual layout metadata for the editor.
+// Layout is the content of a layout.toml file: editor positions for the
+// states of one machine. MarshalLayout and UnmarshalLayout convert it to
+// and from TOML without loss.
 type Layout struct {
 	Version  int                  `toml:"version"`
 	Editor   EditorMeta           `toml:"editor"`
 	States   map[string]StateLayout `toml:"states"`
+
+	// Extra holds the keys and sections this package does not
+	// interpret. Keys found in a state's table are filed under the
+	// section name `states."<name>"`, quoted as MarshalLayout writes it.
+	Extra Extra `toml:"-"`
 }
 
 // EditorMeta contains editor-specific settings.
@@ -27,41 +34,57 @@ type StateLayout struct {
 
 // GenerateLayout creates layout.toml content from state positions.
 func GenerateLayout(positions map[string][2]int, offsetX, offsetY int) string {
-	var sb strings.Builder
-
-	sb.WriteString("[layout]\n")
-	sb.WriteString("version = 1\n")
-	sb.WriteString("\n")
-
-	sb.WriteString("[editor]\n")
-	sb.WriteString(fmt.Sprintf("canvas_offset_x = %d\n", offsetX))
-	sb.WriteString(fmt.Sprintf("canvas_offset_y = %d\n", offsetY))
-	sb.WriteString("\n")
-
-	if len(positions) > 0 {
-		sb.WriteString("[states]\n")
-		for name, pos := range positions {
-			// Use dotted key syntax for nested tables
-			sb.WriteString(fmt.Sprintf("[states.%q]\n", name))
-			sb.WriteString(fmt.Sprintf("x = %d\n", pos[0]))
-			sb.WriteString(fmt.Sprintf("y = %d\n", pos[1]))
-			sb.WriteString("\n")
-		}
+	l := &Layout{
+		Version: 1,
+		Editor:  EditorMeta{CanvasOffsetX: offsetX, CanvasOffsetY: offsetY},
+		States:  make(map[string]StateLayout, len(positions)),
 	}
+	for name, pos := range positions {
+		l.States[name] = StateLayout{X: pos[0], Y: pos[1]}
+	}
+	return string(MarshalLayout(l))
+}
 
-	return sb.String()
+// MarshalLayout encodes l as layout.toml, with states sorted by name.
+func MarshalLayout(l *Layout) []byte {
+	w := newTOMLWriter(l.Extra)
+	w.section("", nil)
+	w.section("layout", []string{fmt.Sprintf("version = %d", l.Version)})
+	w.section("editor", []string{
+		fmt.Sprintf("canvas_offset_x = %d", l.Editor.CanvasOffsetX),
+		fmt.Sprintf("canvas_offset_y = %d", l.Editor.CanvasOffsetY),
+	})
+	if len(l.States) > 0 {
+		w.section("states", []string{})
+	}
+	for _, name := range sortedStrings(l.States) {
+		sl := l.States[name]
+		w.section(fmt.Sprintf("states.%q", name), []string{
+			fmt.Sprintf("x = %d", sl.X),
+			fmt.Sprintf("y = %d", sl.Y),
+		})
+	}
+	return w.finish()
 }
 
-// ParseLayout parses layout.toml content.
+// ParseLayout parses layout.toml content. It is UnmarshalLayout for a
+// string.
 func ParseLayout(text string) (*Layout, error) {
+	return UnmarshalLayout([]byte(text))
+}
+
+// UnmarshalLayout decodes layout.toml. Keys and sections it does not
+// recognise are kept in Extra, and MarshalLayout writes them back.
+func UnmarshalLayout(data []byte) (*Layout, error) {
 	layout := &Layout{
 		States: make(map[string]StateLayout),
 	}
 
 	var currentSection string
 	var currentState string
+	var extraSection string // where unrecognised keys in this section go
 
-	for _, line := range strings.Split(text, "\n") {
+	for _, line := range strings.Split(string(data), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -69,7 +92,8 @@ func ParseLayout(text string) (*Layout, error) {
 
 		// Section header
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			section := line[1 : len(line)-1]
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			extraSection = section
 			
 			// Check for states subsection like [states."green"]
 			if strings.HasPrefix(section, "states.") {
@@ -80,59 +104,178 @@ func ParseLayout(text string) (*Layout, error) {
 				if _, exists := layout.States[currentState]; !exists {
 					layout.States[currentState] = StateLayout{}
 				}
+				extraSection = fmt.Sprintf("states.%q", currentState)
 			} else {
 				currentSection = section
 				currentState = ""
+				switch section {
+				case "layout", "editor", "states":
+				default:
+					layout.Extra.addSection(section)
+				}
 			}
 			continue
 		}
 
 		// Key = value
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+		key, value, ok := splitKeyValue(line)
+		if !ok {
 			continue
 		}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-
-		switch currentSection {
-		case "layout":
-			if key == "version" {
-				layout.Version, _ = strconv.Atoi(value)
-			}
-		case "editor":
-			switch key {
-			case "canvas_offset_x":
-				layout.Editor.CanvasOffsetX, _ = strconv.Atoi(value)
-			case "canvas_offset_y":
-				layout.Editor.CanvasOffsetY, _ = strconv.Atoi(value)
-			}
-		case "states":
-			if currentState != "" {
-				sl := layout.States[currentState]
-				switch key {
-				case "x":
-					sl.X, _ = strconv.Atoi(value)
-				case "y":
-					sl.Y, _ = strconv.Atoi(value)
-				}
-				layout.States[currentState] = sl
+		switch {
+		case currentSection == "layout" && key == "version":
+			layout.Version, _ = strconv.Atoi(value)
+		case currentSection == "editor" && key == "canvas_offset_x":
+			layout.Editor.CanvasOffsetX, _ = strconv.Atoi(value)
+		case currentSection == "editor" && key == "canvas_offset_y":
+			layout.Editor.CanvasOffsetY, _ = strconv.Atoi(value)
+		case currentState != "" && (key == "x" || key == "y"):
+			sl := layout.States[currentState]
+			if key == "x" {
+				sl.X, _ = strconv.Atoi(value)
+			} else {
+				sl.Y, _ = strconv.Atoi(value)
 			}
+			layout.States[currentState] = sl
+		default:
+			layout.Extra.add(extraSection, key, value)
 		}
 	}
 
 	return layout, nil
 }
 
+// RenameStates moves the positions, and any extra keys, of renamed
+// states to their new names. See fsm.FSM.RenameStates.
+func (l *Layout) RenameStates(mapping map[string]string) {
+	states := make(map[string]StateLayout, len(l.States))
+	for name, sl := range l.States {
+		if to, ok := mapping[name]; ok {
+			name = to
+		}
+		states[name] = sl
+	}
+	l.States = states
+
+	var moved Extra
+	for from, to := range mapping {
+		section := fmt.Sprintf("states.%q", from)
+		if keys, ok := l.Extra[section]; ok {
+			if moved == nil {
+				moved = make(Extra)
+			}
+			moved[fmt.Sprintf("states.%q", to)] = keys
+			delete(l.Extra, section)
+		}
+	}
+	for section, keys := range moved {
+		l.Extra[section] = keys
+	}
+}
+
+// Extra holds TOML content that a parser does not interpret, so that it
+// can be written back unchanged. It maps each section name (the header
+// without brackets, or "" for keys before the first header) to the raw
+// key and value text of each of its lines. Only single-line values are
+// supported, as elsewhere in these files.
+type Extra map[string]map[string]string
+
+func (e *Extra) addSection(section string) {
+	if *e == nil {
+		*e = make(Extra)
+	}
+	if (*e)[section] == nil {
+		(*e)[section] = make(map[string]string)
+	}
+}
+
+func (e *Extra) add(section, key, value string) {
+	e.addSection(section)
+	(*e)[section][key] = value
+}
+
+// tomlWriter writes the sections of a TOML file, merging in the Extra
+// keys of each section and appending the sections it was not asked for.
+type tomlWriter struct {
+	sb      strings.Builder
+	extra   Extra
+	written map[string]bool
+}
+
+func newTOMLWriter(extra Extra) *tomlWriter {
+	return &tomlWriter{extra: extra, written: make(map[string]bool)}
+}
+
+// section writes a section's lines followed by its extra keys. It writes
+// nothing if both are empty, unless lines is non-nil (an empty, non-nil
+// slice forces a bare header). The "" section has no header.
+func (w *tomlWriter) section(name string, lines []string) {
+	w.written[name] = true
+	extra := w.extra[name]
+	if lines == nil && len(extra) == 0 {
+		return
+	}
+	if name != "" {
+		w.sb.WriteString("[" + name + "]\n")
+	}
+	for _, line := range lines {
+		w.sb.WriteString(line + "\n")
+	}
+	for _, k := range sortedStrings(extra) {
+		w.sb.WriteString(k + " = " + extra[k] + "\n")
+	}
+	w.sb.WriteString("\n")
+}
+
+// finish writes the remaining extra sections, sorted by name, and
+// returns the file.
+func (w *tomlWriter) finish() []byte {
+	for _, name := range sortedStrings(w.extra) {
+		if !w.written[name] {
+			w.section(name, []string{})
+		}
+	}
+	return []byte(w.sb.String())
+}
+
 // unquoteKey removes surrounding quotes from a TOML key.
 func unquoteKey(s string) string {
 	s = strings.TrimSpace(s)
 	if len(s) >= 2 {
-		if (s[0] == '"' && s[len(s)-1] == '"') ||
-			(s[0] == '\'' && s[len(s)-1] == '\'') {
+		if s[0] == '"' && s[len(s)-1] == '"' {
+			// Names are written with %q, so undo Go escaping. Fall back to
+			// stripping the quotes for hand-written files.
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+			return s[1 : len(s)-1]
+		}
+		if s[0] == '\'' && s[len(s)-1] == '\'' {
 			return s[1 : len(s)-1]
 		}
 	}
 	return s
 }
+
+// splitKeyValue splits a TOML "key = value" line at the first '=' that is
+// not inside a quoted key.
+func splitKeyValue(line string) (key, value string, ok bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
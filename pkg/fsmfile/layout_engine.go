@@ -0,0 +1,140 @@
+package fsmfile
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// LayoutEngine names a layout algorithm that users can choose, in
+// renderer options, on the command line and in fsmedit.
+type LayoutEngine string
+
+const (
+	EngineAuto     LayoutEngine = ""         // SmartLayout picks per machine
+	EngineSugiyama LayoutEngine = "sugiyama" // layered, crossing-minimised
+	EngineForce    LayoutEngine = "force"    // Fruchterman–Reingold
+	EngineCircular LayoutEngine = "circular" // ring, initial state at top
+	EngineGrid     LayoutEngine = "grid"     // rows and columns, initial state first
+)
+
+// LayoutEngineNames returns the names accepted by LayoutEngineByName, in
+// display order.
+func LayoutEngineNames() []string {
+	return []string{"auto", "sugiyama", "force", "circular", "grid"}
+}
+
+// LayoutEngineByName returns the engine with the given name. Both "auto"
+// and "" select EngineAuto.
+func LayoutEngineByName(name string) (LayoutEngine, bool) {
+	switch name {
+	case "", "auto":
+		return EngineAuto, true
+	case "sugiyama":
+		return EngineSugiyama, true
+	case "force":
+		return EngineForce, true
+	case "circular":
+		return EngineCircular, true
+	case "grid":
+		return EngineGrid, true
+	}
+	return EngineAuto, false
+}
+
+// Name returns the engine's name as accepted by LayoutEngineByName.
+func (e LayoutEngine) Name() string {
+	if e == EngineAuto {
+		return "auto"
+	}
+	return string(e)
+}
+
+// EngineLayout places the states of f on a width×height grid with the
+// given engine, for the native SVG and PNG renderers. Unknown engines
+// behave as EngineAuto.
+func EngineLayout(f *fsm.FSM, engine LayoutEngine, width, height int) map[string][2]int {
+	positions, _ := EngineLayoutContext(context.Background(), f, engine, width, height)
+	return positions
+}
+
+// EngineLayoutContext is EngineLayout, stopping with ctx's error if ctx
+// is done before the layout is. The layered and force-directed engines
+// take time that grows faster than the machine, so servers and other
+// callers laying out machines they do not control should set a deadline.
+func EngineLayoutContext(ctx context.Context, f *fsm.FSM, engine LayoutEngine, width, height int) (map[string][2]int, error) {
+	switch engine {
+	case EngineSugiyama:
+		return sugiyamaLayout(ctx, f, width, height)
+	case EngineForce:
+		return autoLayout(ctx, f, LayoutForceDirected, width, height)
+	case EngineCircular:
+		return autoLayout(ctx, f, LayoutCircular, width, height)
+	case EngineGrid:
+		return autoLayout(ctx, f, LayoutGrid, width, height)
+	}
+	return smartLayout(ctx, f, width, height)
+}
+
+// EngineLayoutTUI is EngineLayout for the character-cell canvas of
+// fsmedit and RenderASCII. Positions are left edges of state labels, as
+// with SmartLayoutTUI, and no two labels on a row overlap; a row that
+// does not fit in width is pushed past it.
+func EngineLayoutTUI(f *fsm.FSM, engine LayoutEngine, width, height int) map[string][2]int {
+	positions, _ := EngineLayoutTUIContext(context.Background(), f, engine, width, height)
+	return positions
+}
+
+// EngineLayoutTUIContext is EngineLayoutTUI, stopping with ctx's error if
+// ctx is done before the layout is.
+func EngineLayoutTUIContext(ctx context.Context, f *fsm.FSM, engine LayoutEngine, width, height int) (map[string][2]int, error) {
+	var positions map[string][2]int
+	var err error
+	switch engine {
+	case EngineForce:
+		positions, err = forceDirected(ctx, f, width, height)
+	case EngineCircular:
+		positions = layoutCircular(f, width, height)
+	case EngineGrid:
+		positions = layoutGrid(f, width, height)
+	default:
+		return smartLayoutTUI(ctx, f, width, height)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return separateRows(f, positions), nil
+}
+
+// separateRows shifts states right, where needed, so that labels sharing
+// a row are at least two cells apart.
+func separateRows(f *fsm.FSM, positions map[string][2]int) map[string][2]int {
+	metrics := ComputeNodeMetrics(f)
+	rows := make(map[int][]string)
+	for _, name := range f.States {
+		if p, ok := positions[name]; ok {
+			rows[p[1]] = append(rows[p[1]], name)
+		}
+	}
+	result := make(map[string][2]int, len(positions))
+	for y, names := range rows {
+		sort.SliceStable(names, func(i, j int) bool {
+			return positions[names[i]][0] < positions[names[j]][0]
+		})
+		next := 0
+		for _, name := range names {
+			x := positions[name][0]
+			if x < next {
+				x = next
+			}
+			w := len(name) + 4
+			if m, ok := metrics[name]; ok {
+				w = m.Width
+			}
+			result[name] = [2]int{x, y}
+			next = x + w + 2
+		}
+	}
+	return result
+}
@@ -0,0 +1,275 @@
+package fsmfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// denseCycleFSM is a ring of n states with chords, the shape for which
+// SmartLayout falls back to the force-directed engine.
+func denseCycleFSM(n int) *fsm.FSM {
+	f := fsm.New(fsm.TypeNFA)
+	for i := 0; i < n; i++ {
+		f.States = append(f.States, fmt.Sprintf("s%d", i))
+	}
+	f.Initial = "s0"
+	f.Alphabet = []string{"a"}
+	for i := 0; i < n; i++ {
+		from := fmt.Sprintf("s%d", i)
+		f.AddTransition(from, strPtr("a"), []string{fmt.Sprintf("s%d", (i+1)%n)}, nil)
+		if i%3 == 0 {
+			f.AddTransition(from, strPtr("a"), []string{fmt.Sprintf("s%d", (i+7)%n)}, nil)
+		}
+	}
+	return f
+}
+
+func TestLayoutEngineByName(t *testing.T) {
+	for _, name := range LayoutEngineNames() {
+		engine, ok := LayoutEngineByName(name)
+		if !ok {
+			t.Errorf("LayoutEngineByName(%q) not found", name)
+			continue
+		}
+		if engine.Name() != name {
+			t.Errorf("LayoutEngineByName(%q).Name() = %q", name, engine.Name())
+		}
+	}
+	if engine, ok := LayoutEngineByName(""); !ok || engine != EngineAuto {
+		t.Errorf("empty name = %q, %v; want auto", engine, ok)
+	}
+	if _, ok := LayoutEngineByName("spring"); ok {
+		t.Error("unknown engine accepted")
+	}
+}
+
+func TestForceDirected_Deterministic(t *testing.T) {
+	f := denseCycleFSM(30)
+	first := layoutForceDirected(f, 200, 60)
+	for i := 0; i < 3; i++ {
+		if again := layoutForceDirected(f, 200, 60); !reflect.DeepEqual(first, again) {
+			t.Fatal("force-directed layout differs between runs")
+		}
+	}
+}
+
+func TestForceDirected_WithinBounds(t *testing.T) {
+	for _, n := range []int{1, 2, 5, 30} {
+		f := denseCycleFSM(n)
+		positions := layoutForceDirected(f, 120, 40)
+		if len(positions) != n {
+			t.Fatalf("n=%d: got %d positions", n, len(positions))
+		}
+		seen := make(map[[2]int]string)
+		for name, p := range positions {
+			if p[0] < 0 || p[0] >= 120 || p[1] < 0 || p[1] >= 40 {
+				t.Errorf("n=%d: %s at %v outside 120x40", n, name, p)
+			}
+			if other, ok := seen[p]; ok {
+				t.Errorf("n=%d: %s and %s both at %v", n, name, other, p)
+			}
+			seen[p] = name
+		}
+	}
+}
+
+func TestForceDirected_NeighboursCloser(t *testing.T) {
+	// Two triangles joined by one edge: states in the same triangle
+	// should end up closer together than states in different ones.
+	f := fsm.New(fsm.TypeDFA)
+	f.States = []string{"a1", "a2", "a3", "b1", "b2", "b3"}
+	f.Initial = "a1"
+	f.Alphabet = []string{"x"}
+	for _, e := range [][2]string{
+		{"a1", "a2"}, {"a2", "a3"}, {"a3", "a1"},
+		{"b1", "b2"}, {"b2", "b3"}, {"b3", "b1"},
+		{"a1", "b1"},
+	} {
+		f.AddTransition(e[0], strPtr("x"), []string{e[1]}, nil)
+	}
+	p := layoutForceDirected(f, 200, 60)
+	dist := func(a, b string) float64 {
+		dx := float64(p[a][0] - p[b][0])
+		dy := float64(p[a][1]-p[b][1]) * 2
+		return dx*dx + dy*dy
+	}
+	if dist("a2", "a3") >= dist("a3", "b3") {
+		t.Errorf("a2-a3 (%v) not closer than a3-b3 (%v): %v", dist("a2", "a3"), dist("a3", "b3"), p)
+	}
+}
+
+func TestEngineLayoutTUI_NoOverlaps(t *testing.T) {
+	for _, engine := range []LayoutEngine{EngineAuto, EngineSugiyama, EngineForce, EngineCircular, EngineGrid} {
+		t.Run(engine.Name(), func(t *testing.T) {
+			f := buildFSMWithLongNames(12, "engine")
+			positions := EngineLayoutTUI(f, engine, 120, 40)
+			if len(positions) != len(f.States) {
+				t.Fatalf("got %d positions, want %d", len(positions), len(f.States))
+			}
+			checkNoOverlaps(t, f, positions)
+		})
+	}
+}
+
+func TestSVGOptionsLayoutEngine(t *testing.T) {
+	f := denseCycleFSM(8)
+	opts := DefaultSVGOptions()
+	auto := GenerateSVGNative(f, opts)
+	opts.LayoutEngine = EngineCircular
+	circular := GenerateSVGNative(f, opts)
+	if auto == circular {
+		t.Error("LayoutEngine had no effect on the SVG")
+	}
+	if !strings.Contains(circular, "s7") {
+		t.Error("circular SVG is missing a state")
+	}
+}
+
+func TestEngineLayout_AutoIsSmartLayout(t *testing.T) {
+	f := denseCycleFSM(8)
+	if !reflect.DeepEqual(EngineLayout(f, EngineAuto, 70, 25), SmartLayout(f, 70, 25)) {
+		t.Error("auto engine differs from SmartLayout")
+	}
+	// SmartLayout uses Sugiyama for small machines.
+	if !reflect.DeepEqual(EngineLayout(f, EngineSugiyama, 70, 25), SmartLayout(f, 70, 25)) {
+		t.Error("sugiyama engine differs from auto on a small machine")
+	}
+}
+
+func TestEngineLayoutContext_Cancelled(t *testing.T) {
+	f := denseCycleFSM(30)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, engine := range []LayoutEngine{EngineAuto, EngineSugiyama, EngineForce} {
+		if _, err := EngineLayoutContext(ctx, f, engine, 120, 40); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: err = %v, want context.Canceled", engine.Name(), err)
+		}
+		if _, err := EngineLayoutTUIContext(ctx, f, engine, 120, 40); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s TUI: err = %v, want context.Canceled", engine.Name(), err)
+		}
+	}
+	if _, err := GenerateSVGNativeContext(ctx, f, DefaultSVGOptions()); !errors.Is(err, context.Canceled) {
+		t.Errorf("SVG: err = %v, want context.Canceled", err)
+	}
+	if err := RenderPNGContext(ctx, f, &bytes.Buffer{}, DefaultPNGOptions()); !errors.Is(err, context.Canceled) {
+		t.Errorf("PNG: err = %v, want context.Canceled", err)
+	}
+	if _, err := RenderASCIIContext(ctx, f, nil, 80, 24); !errors.Is(err, context.Canceled) {
+		t.Errorf("ASCII: err = %v, want context.Canceled", err)
+	}
+
+	got, err := EngineLayoutContext(context.Background(), f, EngineForce, 120, 40)
+	if err != nil || !reflect.DeepEqual(got, EngineLayout(f, EngineForce, 120, 40)) {
+		t.Errorf("uncancelled layout differs from EngineLayout (err %v)", err)
+	}
+}
+
+func TestCircular_TokenRingInOrder(t *testing.T) {
+	// A ring with transitions both ways, listed out of order: the
+	// states should still go round the circle in ring order.
+	f := fsm.New(fsm.TypeDFA)
+	f.States = []string{"n3", "n0", "n5", "n1", "n4", "n2"}
+	f.Initial = "n0"
+	f.Alphabet = []string{"next", "prev"}
+	for i := 0; i < 6; i++ {
+		this, next := fmt.Sprintf("n%d", i), fmt.Sprintf("n%d", (i+1)%6)
+		f.AddTransition(next, strPtr("prev"), []string{this}, nil)
+		f.AddTransition(this, strPtr("next"), []string{next}, nil)
+	}
+	order := ringOrder(f)
+	for i, name := range order {
+		if want := fmt.Sprintf("n%d", i); name != want && name != fmt.Sprintf("n%d", (6-i)%6) {
+			t.Fatalf("ring order %v does not follow the ring", order)
+		}
+	}
+
+	positions := layoutCircular(f, 120, 40)
+	top := positions["n0"]
+	for name, p := range positions {
+		if p[1] < top[1] {
+			t.Errorf("%s at %v is above the initial state at %v", name, p, top)
+		}
+	}
+	// Round on screen, where a row is two columns high: the chord from
+	// the second state to the last is √3/2 of the diameter.
+	opposite := positions[order[3]]
+	right, left := positions[order[1]], positions[order[5]]
+	diameter := float64(opposite[1]-top[1]) * 2
+	chord := float64(right[0] - left[0])
+	if want := diameter * math.Sqrt(3) / 2; math.Abs(chord-want) > 3 {
+		t.Errorf("chord %v columns, want %.1f for a diameter of %v", chord, want, diameter)
+	}
+}
+
+func TestGrid_RowsAndColumns(t *testing.T) {
+	f := buildFSMWithLongNames(7, "grid")
+	positions := layoutGrid(f, 120, 40)
+	cols := make(map[int]bool)
+	rows := make(map[int]bool)
+	for _, p := range positions {
+		cols[p[0]] = true
+		rows[p[1]] = true
+	}
+	if len(cols) != 3 || len(rows) != 3 {
+		t.Errorf("7 states on %d columns and %d rows, want 3x3", len(cols), len(rows))
+	}
+	if p := positions[f.Initial]; p != [2]int{5, 2} {
+		t.Errorf("initial state at %v, want top left", p)
+	}
+	checkNoOverlaps(t, f, positions)
+}
+
+func TestWithLogger_TracesLayoutAndRouting(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	f := denseCycleFSM(30)
+	ctx := WithLogger(context.Background(), logger)
+	for _, engine := range []LayoutEngine{EngineAuto, EngineForce} {
+		if _, err := EngineLayoutContext(ctx, f, engine, 120, 40); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{
+		`msg="layout engine" engine=sugiyama reason="cyclic with density at most 0.3" states=30`,
+		`msg="sugiyama crossing pass" pass=4`,
+		`msg="force layout" states=30`,
+		`msg="force iteration" iteration=299`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("layout log lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	opts := DefaultSVGOptions()
+	opts.Logger = logger
+	svg := GenerateSVGNative(denseCycleFSM(6), opts)
+	for _, want := range []string{`msg="svg layout" source=engine`, `msg="sugiyama layers"`, `msg="svg edge" from=s0 to=s1 route=`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("SVG log lacks %q:\n%s", want, buf.String())
+		}
+	}
+	opts.Logger = nil
+	if svg != GenerateSVGNative(denseCycleFSM(6), opts) {
+		t.Error("SVG differs with a logger")
+	}
+
+	buf.Reset()
+	popts := DefaultPNGOptions()
+	popts.Logger = logger
+	if err := RenderPNG(denseCycleFSM(6), &bytes.Buffer{}, popts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `msg="png edge" from=s0 to=s1 route=`) {
+		t.Errorf("PNG log lacks edge routes:\n%s", buf.String())
+	}
+}
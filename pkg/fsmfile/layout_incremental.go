@@ -0,0 +1,176 @@
+package fsmfile
+
+import (
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// IncrementalLayoutTUI places the states of f that have no position in
+// fixed, on the character-cell canvas of fsmedit, without moving any
+// state that has one. It is for small edits to a machine the user has
+// already arranged: a state added in the text pane, or missing from a
+// saved layout, goes next to the states it has transitions with, in the
+// nearest space where its label and self-loops do not run into another
+// state's. States with no placed neighbour go below the others.
+//
+// Positions in fixed for states not in f are ignored. If fixed places
+// none of f's states, the whole machine is laid out by SmartLayoutTUI.
+func IncrementalLayoutTUI(f *fsm.FSM, fixed map[string][2]int, width, height int) map[string][2]int {
+	positions := make(map[string][2]int, len(f.States))
+	for _, name := range f.States {
+		if p, ok := fixed[name]; ok {
+			positions[name] = p
+		}
+	}
+	if len(positions) == 0 {
+		return SmartLayoutTUI(f, width, height)
+	}
+	if len(positions) == len(f.States) {
+		return positions
+	}
+
+	metrics := ComputeNodeMetrics(f)
+	neighbours := make(map[string][]string)
+	for _, t := range f.Transitions {
+		for _, to := range t.To {
+			if to != t.From {
+				neighbours[t.From] = append(neighbours[t.From], to)
+				neighbours[to] = append(neighbours[to], t.From)
+			}
+		}
+	}
+
+	var placed []footprint
+	for _, name := range f.States {
+		if p, ok := positions[name]; ok {
+			placed = append(placed, newFootprint(name, p, metrics))
+		}
+	}
+
+	// Place states next to placed neighbours first, so that a chain of
+	// new states grows out from the arranged part of the machine.
+	pending := make(map[string]bool)
+	for _, name := range f.States {
+		if _, ok := positions[name]; !ok {
+			pending[name] = true
+		}
+	}
+	for len(pending) > 0 {
+		next, best := "", -1
+		for _, name := range f.States {
+			if !pending[name] {
+				continue
+			}
+			n := 0
+			for _, nb := range neighbours[name] {
+				if _, ok := positions[nb]; ok {
+					n++
+				}
+			}
+			if n > best {
+				next, best = name, n
+			}
+		}
+		p := placeNear(next, incrementalTarget(next, neighbours[next], positions, placed), metrics, placed)
+		positions[next] = p
+		placed = append(placed, newFootprint(next, p, metrics))
+		delete(pending, next)
+	}
+	return positions
+}
+
+// footprint is the box of cells a state takes on the canvas, with its
+// self-loops and annotations: columns x1 to x2 and rows y1 to y2, the
+// second of each excluded.
+type footprint struct {
+	x1, y1, x2, y2 int
+}
+
+func newFootprint(name string, p [2]int, metrics map[string]NodeMetrics) footprint {
+	m := metrics[name]
+	return footprint{p[0], p[1] - m.TopMargin, p[0] + nodeW(name, metrics), p[1] + 1 + m.BottomMargin}
+}
+
+// Space kept free around a placed state, for the arcs and labels between
+// it and its neighbours.
+const (
+	incrementalGapX = 4
+	incrementalGapY = 1
+)
+
+func (a footprint) near(b footprint) bool {
+	return a.x1 < b.x2+incrementalGapX && b.x1 < a.x2+incrementalGapX &&
+		a.y1 < b.y2+incrementalGapY && b.y1 < a.y2+incrementalGapY
+}
+
+// incrementalTarget returns where a new state would ideally go: among
+// its placed neighbours, or below everything if it has none.
+func incrementalTarget(name string, neighbours []string, positions map[string][2]int, placed []footprint) [2]int {
+	sx, sy, n := 0, 0, 0
+	seen := make(map[string]bool)
+	for _, nb := range neighbours {
+		p, ok := positions[nb]
+		if !ok || seen[nb] {
+			continue
+		}
+		seen[nb] = true
+		sx += p[0]
+		sy += p[1]
+		n++
+	}
+	if n > 0 {
+		return [2]int{sx / n, sy / n}
+	}
+	minX, maxY := placed[0].x1, placed[0].y2
+	for _, b := range placed[1:] {
+		if b.x1 < minX {
+			minX = b.x1
+		}
+		if b.y2 > maxY {
+			maxY = b.y2
+		}
+	}
+	return [2]int{minX, maxY + 3}
+}
+
+// placeNear returns the free position nearest target for the named
+// state, searching ever wider around it. A row counts as two columns,
+// since cells are about twice as tall as they are wide.
+func placeNear(name string, target [2]int, metrics map[string]NodeMetrics, placed []footprint) [2]int {
+	minY := metrics[name].TopMargin + 1
+	free := func(x, y int) bool {
+		fp := newFootprint(name, [2]int{x, y}, metrics)
+		for _, b := range placed {
+			if fp.near(b) {
+				return false
+			}
+		}
+		return true
+	}
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	for r := 16; ; r *= 2 {
+		best, bestCost := [2]int{}, -1
+		for y := target[1] - r/2; y <= target[1]+r/2; y++ {
+			if y < minY {
+				continue
+			}
+			for x := target[0] - r; x <= target[0]+r; x++ {
+				if x < 1 {
+					continue
+				}
+				cost := abs(x-target[0]) + 2*abs(y-target[1])
+				if (bestCost < 0 || cost < bestCost) && free(x, y) {
+					best, bestCost = [2]int{x, y}, cost
+				}
+			}
+		}
+		// Anywhere outside the area searched costs more than r.
+		if bestCost >= 0 && bestCost <= r {
+			return best
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package fsmfile
+
+import (
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestIncrementalLayoutTUI_KeepsFixedStates(t *testing.T) {
+	f := buildFSMWithNStates(12)
+	fixed := SmartLayoutTUI(f, 100, 40)
+	f.AddState("extra")
+	f.AddTransition("s5", strPtr("a"), []string{"extra"}, nil)
+
+	got := IncrementalLayoutTUI(f, fixed, 100, 40)
+	for name, p := range fixed {
+		if got[name] != p {
+			t.Errorf("%s moved from %v to %v", name, p, got[name])
+		}
+	}
+	if _, ok := got["extra"]; !ok {
+		t.Fatal("new state not placed")
+	}
+	checkIncrementalClear(t, f, got)
+
+	// The new state goes next to s5, its only neighbour.
+	e, s5 := got["extra"], got["s5"]
+	if dx, dy := e[0]-s5[0], e[1]-s5[1]; dx*dx+4*dy*dy > 30*30 {
+		t.Errorf("extra at %v, far from s5 at %v", e, s5)
+	}
+}
+
+func TestIncrementalLayoutTUI_ChainGrowsFromPlaced(t *testing.T) {
+	f := fsm.New(fsm.TypeDFA)
+	for _, s := range []string{"a", "b", "c", "d"} {
+		f.AddState(s)
+	}
+	f.AddInput("x")
+	f.AddTransition("a", strPtr("x"), []string{"b"}, nil)
+	f.AddTransition("b", strPtr("x"), []string{"c"}, nil)
+	f.AddTransition("c", strPtr("x"), []string{"d"}, nil)
+
+	got := IncrementalLayoutTUI(f, map[string][2]int{"a": {40, 10}}, 80, 24)
+	if got["a"] != [2]int{40, 10} {
+		t.Errorf("a moved to %v", got["a"])
+	}
+	if len(got) != 4 {
+		t.Fatalf("placed %d states, want 4: %v", len(got), got)
+	}
+	checkIncrementalClear(t, f, got)
+	dist := func(p, q [2]int) int {
+		dx, dy := p[0]-q[0], p[1]-q[1]
+		return dx*dx + 4*dy*dy
+	}
+	// Each new state is placed beside the one before it in the chain.
+	if dist(got["d"], got["c"]) > dist(got["d"], got["a"]) {
+		t.Errorf("d is nearer a than c: %v", got)
+	}
+}
+
+func TestIncrementalLayoutTUI_UnconnectedGoesBelow(t *testing.T) {
+	f := buildFSMWithNStates(6)
+	fixed := SmartLayoutTUI(f, 80, 24)
+	f.AddState("alone")
+
+	got := IncrementalLayoutTUI(f, fixed, 80, 24)
+	for name, p := range fixed {
+		if got["alone"][1] <= p[1] {
+			t.Errorf("alone at %v is not below %s at %v", got["alone"], name, p)
+		}
+	}
+}
+
+func TestIncrementalLayoutTUI_NothingFixed(t *testing.T) {
+	// With nothing to keep, the machine is laid out afresh by
+	// SmartLayoutTUI, which may order states that tie differently from
+	// run to run, so only the result's shape is checked.
+	f := buildFSMWithNStates(8)
+	got := IncrementalLayoutTUI(f, map[string][2]int{"gone": {3, 3}}, 80, 24)
+	if len(got) != len(f.States) {
+		t.Fatalf("got %d positions, want %d", len(got), len(f.States))
+	}
+	if _, ok := got["gone"]; ok {
+		t.Error("kept a position for a state not in the machine")
+	}
+	checkNoOverlaps(t, f, got)
+}
+
+// checkIncrementalClear checks that no two states' footprints touch.
+func checkIncrementalClear(t *testing.T, f *fsm.FSM, positions map[string][2]int) {
+	t.Helper()
+	metrics := ComputeNodeMetrics(f)
+	for i, a := range f.States {
+		for _, b := range f.States[i+1:] {
+			fa := newFootprint(a, positions[a], metrics)
+			fb := newFootprint(b, positions[b], metrics)
+			if fa.x1 < fb.x2 && fb.x1 < fa.x2 && fa.y1 < fb.y2 && fb.y1 < fa.y2 {
+				t.Errorf("%s at %v overlaps %s at %v", a, positions[a], b, positions[b])
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package fsmfile
 
 import (
+	"unicode/utf8"
+
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
 
@@ -119,6 +121,9 @@ func selfLoopLabelLen(t fsm.Transition, fsmType fsm.Type) int {
 	if fsmType == fsm.TypeMealy && t.Output != nil {
 		n += 1 + len(*t.Output) // "/output"
 	}
+	if fsmType == fsm.TypePDA {
+		n += 3 + utf8.RuneCountInString(t.StackLabel()) // " [pop→push]"
+	}
 	return n
 }
 
@@ -149,7 +154,8 @@ func MinLayerSpacing(upperMetrics, lowerMetrics []NodeMetrics, baseGap int) int
 }
 
 // MaxTransitionLabelWidth returns the length of the longest transition
-// label in the FSM. For Mealy machines this includes "input/output".
+// label in the FSM. For Mealy machines this includes "input/output", and
+// for PDAs the stack operation.
 func MaxTransitionLabelWidth(f *fsm.FSM) int {
 	maxLen := 0
 	for _, t := range f.Transitions {
@@ -162,6 +168,9 @@ func MaxTransitionLabelWidth(f *fsm.FSM) int {
 		if f.Type == fsm.TypeMealy && t.Output != nil {
 			n += 1 + len(*t.Output) // "/output"
 		}
+		if f.Type == fsm.TypePDA {
+			n += 3 + utf8.RuneCountInString(t.StackLabel())
+		}
 		if n > maxLen {
 			maxLen = n
 		}
@@ -1,6 +1,7 @@
 package fsmfile
 
 import (
+	"context"
 	"sort"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
@@ -19,16 +20,26 @@ import (
 // Returned positions are left-edge character-cell coordinates matching the
 // TUI draw origin (state box starts at pos.X).
 func SmartLayoutTUI(f *fsm.FSM, width, height int) map[string][2]int {
+	positions, _ := smartLayoutTUI(context.Background(), f, width, height)
+	return positions
+}
+
+// smartLayoutTUI is SmartLayoutTUI, stopping with ctx's error if ctx is
+// done before the layout is.
+func smartLayoutTUI(ctx context.Context, f *fsm.FSM, width, height int) (map[string][2]int, error) {
 	n := len(f.States)
 	if n == 0 {
-		return make(map[string][2]int)
+		return make(map[string][2]int), nil
 	}
 
 	metrics := ComputeNodeMetrics(f)
 
 	// --- Recover layer structure from Sugiyama ---
 
-	basePositions := SmartLayout(f, width, height)
+	basePositions, err := smartLayout(ctx, f, width, height)
+	if err != nil {
+		return nil, err
+	}
 
 	type stateInfo struct {
 		name string
@@ -61,6 +72,7 @@ func SmartLayoutTUI(f *fsm.FSM, width, height int) map[string][2]int {
 	// --- Compute cell dimensions ---
 
 	cellW, cellH := computeCellSize(f, metrics)
+	loggerFrom(ctx).DebugContext(ctx, "tui cells", "cell_width", cellW, "cell_height", cellH, "layers", len(layers))
 
 	// --- Compute per-state column span ---
 
@@ -146,7 +158,7 @@ func SmartLayoutTUI(f *fsm.FSM, width, height int) map[string][2]int {
 		}
 	}
 
-	return positions
+	return positions, nil
 }
 
 // computeCellSize determines cell width and height from the FSM geometry.
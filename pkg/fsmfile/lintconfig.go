@@ -0,0 +1,147 @@
+package fsmfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// LintConfigName is the file name searched for by FindLintConfig.
+const LintConfigName = ".fsmlint.toml"
+
+// ParseLintConfig parses .fsmlint.toml content:
+//
+//	[rules]
+//	nondeterministic = "error"   # off | warning | error
+//	unused_input = "off"
+//
+//	[naming]
+//	states = "^[a-z_]+$"
+//	inputs = "^[a-z_]+$"
+//	outputs = "^[A-Z_]+$"
+//
+// Unknown sections, rules, or severities are errors, so that typos do not
+// silently disable a check.
+func ParseLintConfig(text string) (fsm.LintConfig, error) {
+	cfg := fsm.LintConfig{Rules: make(map[string]fsm.Severity)}
+	known := fsm.LintRules()
+
+	var section string
+	for n, line := range strings.Split(text, "\n") {
+		lineNo := n + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			if section != "rules" && section != "naming" {
+				return cfg, fmt.Errorf("line %d: unknown section [%s]", lineNo, section)
+			}
+			continue
+		}
+
+		key, value, ok := tomlKeyValue(line)
+		if !ok {
+			return cfg, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+
+		switch section {
+		case "rules":
+			if _, ok := known[key]; !ok {
+				return cfg, fmt.Errorf("line %d: unknown rule %q", lineNo, key)
+			}
+			sev := fsm.Severity(strings.ToLower(value))
+			if sev != fsm.SeverityOff && sev != fsm.SeverityInfo && sev != fsm.SeverityWarning && sev != fsm.SeverityError {
+				return cfg, fmt.Errorf("line %d: invalid severity %q for %s (use off, info, warning, or error)", lineNo, value, key)
+			}
+			cfg.Rules[key] = sev
+		case "naming":
+			switch key {
+			case "states":
+				cfg.StatePattern = value
+			case "inputs":
+				cfg.InputPattern = value
+			case "outputs":
+				cfg.OutputPattern = value
+			default:
+				return cfg, fmt.Errorf("line %d: unknown naming key %q (use states, inputs, or outputs)", lineNo, key)
+			}
+		default:
+			return cfg, fmt.Errorf("line %d: %s outside a section", lineNo, key)
+		}
+	}
+	return cfg, nil
+}
+
+// tomlKeyValue splits a "key = value" line, dropping any trailing comment
+// and the quotes around a string value.
+func tomlKeyValue(line string) (key, value string, ok bool) {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(parts[0])
+	value = stripTOMLComment(strings.TrimSpace(parts[1]))
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return key, value, true
+}
+
+// stripTOMLComment removes a trailing "# comment" that is not inside a
+// quoted string.
+func stripTOMLComment(value string) string {
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+// LoadLintConfig reads and parses a lint config file.
+func LoadLintConfig(path string) (fsm.LintConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fsm.LintConfig{}, err
+	}
+	cfg, err := ParseLintConfig(string(data))
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// FindLintConfig looks for .fsmlint.toml in dir and each of its parents,
+// returning the first path found or "" if there is none.
+func FindLintConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, LintConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
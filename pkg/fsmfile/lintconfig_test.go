@@ -0,0 +1,69 @@
+package fsmfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestParseLintConfig(t *testing.T) {
+	cfg, err := ParseLintConfig(`
+# CI rules
+[rules]
+nondeterministic = "error"
+unused_input = 'off'   # not relevant for us
+
+[naming]
+states = '^[a-z_]+$'
+inputs = "^[a-z#]+$"
+`)
+	if err != nil {
+		t.Fatalf("ParseLintConfig: %v", err)
+	}
+	if cfg.Severity(fsm.RuleNondeterministic) != fsm.SeverityError {
+		t.Errorf("nondeterministic = %s, want error", cfg.Severity(fsm.RuleNondeterministic))
+	}
+	if cfg.Severity(fsm.RuleUnusedInput) != fsm.SeverityOff {
+		t.Errorf("unused_input = %s, want off", cfg.Severity(fsm.RuleUnusedInput))
+	}
+	if cfg.Severity(fsm.RuleDead) != fsm.SeverityWarning {
+		t.Errorf("dead = %s, want default warning", cfg.Severity(fsm.RuleDead))
+	}
+	if cfg.StatePattern != "^[a-z_]+$" {
+		t.Errorf("StatePattern = %q", cfg.StatePattern)
+	}
+	if cfg.InputPattern != "^[a-z#]+$" {
+		t.Errorf("InputPattern = %q, '#' inside quotes must be kept", cfg.InputPattern)
+	}
+}
+
+func TestParseLintConfig_Errors(t *testing.T) {
+	for _, text := range []string{
+		"[rules]\nunreachabel = \"error\"",
+		"[rules]\ndead = \"fatal\"",
+		"[styles]\n",
+		"[naming]\nmachines = \"x\"",
+		"dead = \"error\"",
+	} {
+		if _, err := ParseLintConfig(text); err == nil {
+			t.Errorf("expected error for %q", text)
+		}
+	}
+}
+
+func TestFindLintConfig(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(root, LintConfigName)
+	if err := os.WriteFile(want, []byte("[rules]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindLintConfig(sub); got != want {
+		t.Errorf("FindLintConfig = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+package fsmfile
+
+import (
+	"context"
+	"log/slog"
+)
+
+// loggerKey is the context key WithLogger stores a logger under.
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying l. The context-aware layout
+// and rendering functions, such as EngineLayoutContext and
+// GenerateSVGNativeContext, send l debug traces of their decisions: the
+// engine SmartLayout picks and why, Sugiyama's layers and crossings,
+// force-directed convergence, and how the SVG renderer routes each edge.
+// Without a logger they log nothing.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger ctx carries, or one that discards
+// everything.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+	return discardLogger
+}
+
+// discardLogger is the logger used when none is given. Its handler is
+// never enabled, so logging to it costs only the level check.
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,85 @@
+package fsmfile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// GenerateMermaid converts an FSM to a Mermaid state diagram
+// (stateDiagram-v2), which GitHub, GitLab, and many Markdown viewers draw
+// from a ```mermaid code block. States are given IDs s0, s1, ... in
+// order, labelled with their names, and with their outputs in a Moore
+// machine. The initial state has an arrow from [*], and accepting states
+// one to [*]. As in GenerateDOT, transitions between the same two states
+// share an edge, labelled with their inputs (and Mealy outputs or stack
+// operations) joined by commas.
+func GenerateMermaid(f *fsm.FSM) string {
+	var sb strings.Builder
+	sb.WriteString("stateDiagram-v2\n")
+	sb.WriteString("    direction LR\n")
+
+	id := make(map[string]string, len(f.States))
+	for i, state := range f.States {
+		id[state] = fmt.Sprintf("s%d", i)
+		label := state
+		if f.Type == fsm.TypeMoore {
+			if out, ok := f.StateOutputs[state]; ok {
+				label += " / " + out
+			}
+		}
+		sb.WriteString(fmt.Sprintf("    state \"%s\" as %s\n", escapeMermaid(label), id[state]))
+	}
+
+	if f.Initial != "" {
+		sb.WriteString(fmt.Sprintf("    [*] --> %s\n", id[f.Initial]))
+	}
+
+	// Group transitions by (from, to), keeping edges in the order of
+	// their first transition so the output is stable.
+	edgeLabels := make(map[[2]string][]string)
+	var edgeOrder [][2]string
+	for _, t := range f.Transitions {
+		label := "ε"
+		if t.Input != nil {
+			label = *t.Input
+		}
+		if f.Type == fsm.TypeMealy && t.Output != nil {
+			label = fmt.Sprintf("%s/%s", label, *t.Output)
+		}
+		if f.Type == fsm.TypePDA {
+			label += " [" + t.StackLabel() + "]"
+		}
+		for _, to := range t.To {
+			key := [2]string{t.From, to}
+			if _, seen := edgeLabels[key]; !seen {
+				edgeOrder = append(edgeOrder, key)
+			}
+			edgeLabels[key] = append(edgeLabels[key], label)
+		}
+	}
+	for _, key := range edgeOrder {
+		from, to := id[key[0]], id[key[1]]
+		if from == "" || to == "" {
+			continue // left for Validate to report
+		}
+		sb.WriteString(fmt.Sprintf("    %s --> %s : %s\n", from, to, escapeMermaid(strings.Join(edgeLabels[key], ", "))))
+	}
+
+	for _, state := range f.States {
+		if f.IsAccepting(state) {
+			sb.WriteString(fmt.Sprintf("    %s --> [*]\n", id[state]))
+		}
+	}
+	return sb.String()
+}
+
+// escapeMermaid writes the characters that would end or confuse a
+// Mermaid label as entity codes, and line breaks as spaces.
+func escapeMermaid(s string) string {
+	return strings.NewReplacer(
+		"#", "#35;", `"`, "#quot;", ";", "#59;", ":", "#58;",
+		"<", "#lt;", ">", "#gt;", "\n", " ", "\r", " ",
+	).Replace(s)
+}
@@ -0,0 +1,53 @@
+package fsmfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestGenerateMermaid(t *testing.T) {
+	f := fsm.New(fsm.TypeMealy)
+	f.States = []string{"door open", "closed", `say "hi"; #1`}
+	f.Initial = "door open"
+	f.Accepting = []string{"closed"}
+	f.Alphabet = []string{"push", "pull", "a:b"}
+	f.OutputAlphabet = []string{"click"}
+	f.AddTransition("door open", strPtr("push"), []string{"closed"}, strPtr("click"))
+	f.AddTransition("door open", strPtr("a:b"), []string{"closed"}, nil)
+	f.AddTransition("closed", strPtr("pull"), []string{`say "hi"; #1`}, nil)
+
+	got := GenerateMermaid(f)
+	for _, want := range []string{
+		"stateDiagram-v2\n",
+		`    state "door open" as s0` + "\n",
+		`    state "say #quot;hi#quot;#59; #35;1" as s2` + "\n",
+		"    [*] --> s0\n",
+		"    s0 --> s1 : push/click, a#58;b\n",
+		"    s1 --> s2 : pull\n",
+		"    s1 --> [*]\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("diagram lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "-->") != 4 {
+		t.Errorf("want 4 arrows (transitions sharing an edge):\n%s", got)
+	}
+}
+
+func TestGenerateMermaid_Moore(t *testing.T) {
+	f := fsm.New(fsm.TypeMoore)
+	f.AddState("idle")
+	f.AddState("on")
+	f.AddInput("go")
+	f.SetInitial("idle")
+	f.SetStateOutput("on", "lamp")
+	f.AddTransition("idle", strPtr("go"), []string{"on"}, nil)
+	f.AddTransition("on", nil, []string{"idle"}, nil)
+	got := GenerateMermaid(f)
+	if !strings.Contains(got, `state "on / lamp" as s1`) || !strings.Contains(got, "s1 --> s0 : ε") {
+		t.Errorf("Moore output or epsilon edge missing:\n%s", got)
+	}
+}
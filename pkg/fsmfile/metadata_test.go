@@ -0,0 +1,168 @@
+package fsmfile
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// buildTestFSMWithMetadata creates an NFA with metadata at every level.
+// The epsilon transition from idle has no targets written before it, and
+// the multi-target transition spans several hex records, so transition
+// numbering in labels.toml is exercised.
+func buildTestFSMWithMetadata() *fsm.FSM {
+	f := fsm.New(fsm.TypeNFA)
+	f.Name = "meta"
+	f.AddState("idle")
+	f.AddState("running")
+	f.AddState("done")
+	f.AddInput("start")
+	f.AddInput("stop")
+	f.AddTransition("idle", strp("start"), []string{"running", "done"}, nil)
+	f.AddTransition("running", strp("stop"), []string{"done"}, nil)
+	f.AddTransition("running", nil, []string{"idle"}, nil)
+	f.Initial = "idle"
+	f.Accepting = []string{"done"}
+
+	f.Metadata = map[string]string{"owner": "controls team", "ticket": "CTL-42"}
+	f.SetStateMetadata("running", "note", "motor \"on\"")
+	f.SetStateMetadata("done", "reviewed", "yes")
+	f.Transitions[0].Metadata = map[string]string{"req": "R-1"}
+	f.Transitions[2].Metadata = map[string]string{"req": "R-3", "why": "timeout = retry"}
+	return f
+}
+
+func TestJSONMetadataRoundTrip(t *testing.T) {
+	original := buildTestFSMWithMetadata()
+	data, err := ToJSON(original, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ParseJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.StructurallyEqual(original) {
+		t.Errorf("metadata lost in JSON round-trip:\n%s", data)
+	}
+}
+
+func TestFSMFileMetadataRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta.fsm")
+	original := buildTestFSMWithMetadata()
+	if err := WriteFSMFile(path, original, true); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadFSMFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Metadata, original.Metadata) {
+		t.Errorf("Metadata = %v, want %v", loaded.Metadata, original.Metadata)
+	}
+	if !reflect.DeepEqual(loaded.StateMetadata, original.StateMetadata) {
+		t.Errorf("StateMetadata = %v, want %v", loaded.StateMetadata, original.StateMetadata)
+	}
+	for _, want := range original.Transitions {
+		found := false
+		for _, got := range loaded.Transitions {
+			if got.From == want.From && reflect.DeepEqual(got.To, want.To) &&
+				reflect.DeepEqual(got.Input, want.Input) {
+				found = true
+				if len(want.Metadata) > 0 && !reflect.DeepEqual(got.Metadata, want.Metadata) {
+					t.Errorf("transition %s: Metadata = %v, want %v", want.From, got.Metadata, want.Metadata)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("transition from %s lost", want.From)
+		}
+	}
+}
+
+func TestLabelsMetadataSections(t *testing.T) {
+	f := buildTestFSMWithMetadata()
+	_, states, inputs, outputs := FSMToRecords(f)
+	labels, err := ParseLabels(GenerateLabels(f, states, inputs, outputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels.Metadata["ticket"] != "CTL-42" {
+		t.Errorf("[metadata] ticket = %q", labels.Metadata["ticket"])
+	}
+	if got := labels.StateMetadata["running"]["note"]; got != `motor "on"` {
+		t.Errorf("[state_metadata.running] note = %q", got)
+	}
+	if got := labels.TransitionMetadata[2]["why"]; got != "timeout = retry" {
+		t.Errorf("[transition_metadata.2] why = %q", got)
+	}
+	if labels.TransitionMetadata[1] != nil {
+		t.Errorf("transition 1 has no metadata, got %v", labels.TransitionMetadata[1])
+	}
+}
+
+func TestMetadataIgnoredBySemantics(t *testing.T) {
+	plain := buildTestFSMWithMetadata()
+	plain.Metadata, plain.StateMetadata = nil, nil
+	for i := range plain.Transitions {
+		plain.Transitions[i].Metadata = nil
+	}
+	if eq, _ := fsm.Equivalent(buildTestFSMWithMetadata(), plain); !eq {
+		t.Error("metadata should not affect equivalence")
+	}
+}
+
+func TestProbabilityAndWeightRoundTrip(t *testing.T) {
+	original := buildTestFSMWithMetadata()
+	half := 0.5
+	original.AddTransition("idle", strp("start"), []string{"idle"}, nil)
+	original.Transitions[0].Probability = &half
+	original.Transitions[3].Probability = &half
+	cost := 2.5
+	original.Transitions[1].Weight = &cost
+	if err := original.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ToJSON(original, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ParseJSONStrict(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.StructurallyEqual(original) {
+		t.Errorf("probabilities lost in JSON round-trip:\n%s", data)
+	}
+
+	path := filepath.Join(t.TempDir(), "prob.fsm")
+	if err := WriteFSMFile(path, original, true); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = ReadFSMFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, tr := range loaded.Transitions {
+		if tr.Probability != nil {
+			n++
+			if tr.From != "idle" || *tr.Probability != 0.5 {
+				t.Errorf("transition %s -> %v has probability %v", tr.From, tr.To, *tr.Probability)
+			}
+		}
+	}
+	if n != 2 {
+		t.Errorf("%d probabilities after .fsm round-trip, want 2", n)
+	}
+	for _, tr := range loaded.Transitions {
+		if (tr.From == "running" && tr.Input != nil) != (tr.Weight != nil) {
+			t.Errorf("transition %s -> %v has weight %v", tr.From, tr.To, tr.Weight)
+		} else if tr.Weight != nil && *tr.Weight != 2.5 {
+			t.Errorf("weight %v after .fsm round-trip, want 2.5", *tr.Weight)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package fsmfile
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func buildTestPDA() *fsm.FSM {
+	f := fsm.New(fsm.TypePDA)
+	f.Name = "brackets"
+	f.States = []string{"s", "ok"}
+	f.Alphabet = []string{"(", ")"}
+	f.Initial = "s"
+	f.Accepting = []string{"ok"}
+	f.StackAlphabet = []string{"Z", "P"}
+	f.StackStart = "Z"
+	f.AddTransition("s", strp("("), []string{"s"}, nil)
+	f.Transitions[0].Push = []string{"P"}
+	f.AddTransition("s", strp(")"), []string{"s"}, nil)
+	f.Transitions[1].Pop = strp("P")
+	f.AddTransition("s", nil, []string{"ok"}, nil)
+	f.Transitions[2].Pop = strp("Z")
+	f.Transitions[2].Push = []string{"Z"}
+	return f
+}
+
+func TestPDARoundTrip(t *testing.T) {
+	original := buildTestPDA()
+
+	data, err := ToJSON(original, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ParseJSONStrict(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.StructurallyEqual(original) {
+		t.Errorf("PDA changed in JSON round-trip:\n%s", data)
+	}
+
+	path := filepath.Join(t.TempDir(), "pda.fsm")
+	if err := WriteFSMFile(path, original, true); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = ReadFSMFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The .fsm reader adds the default class; compare the rest.
+	loaded.Classes, original.Classes = nil, nil
+	if !loaded.StructurallyEqual(original) {
+		t.Errorf("PDA changed in .fsm round-trip: %+v", loaded)
+	}
+}
+
+func TestPDAEdgeLabels(t *testing.T) {
+	f := buildTestPDA()
+	dot := GenerateDOT(f, "")
+	for _, want := range []string{`label="( [ε→P], ) [P→ε]"`, `label="ε [Z→Z]"`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output lacks %s:\n%s", want, dot)
+		}
+	}
+	if svg := GenerateSVGNative(f, DefaultSVGOptions()); !strings.Contains(svg, "P→ε") {
+		t.Error("SVG output lacks the stack operation")
+	}
+	if tikz := GenerateTikZ(f, DefaultTikZOptions()); !strings.Contains(tikz, `[P$\to$$\varepsilon$]`) {
+		t.Errorf("TikZ output lacks the stack operation:\n%s", tikz)
+	}
+}
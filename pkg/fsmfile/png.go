@@ -4,19 +4,33 @@
 package fsmfile
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
 	"image"
 	"image/color"
 	"image/png"
 	"io"
+	"log/slog"
 	"math"
 	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/image/draw"
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
 	"golang.org/x/image/font/gofont/goregular"
 	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
@@ -31,6 +45,177 @@ type PNGOptions struct {
 	LabelSize   int
 	NodeSpacing float64
 	Title       string
+	Highlight   *Highlight // states and edges drawn in colorHighlight
+
+	// Viewport, if not empty, renders only this region of the
+	// Width×Height canvas; the image is the size of the region. See
+	// TileGrid.
+	Viewport image.Rectangle
+
+	// LayoutEngine chooses the algorithm that places states. The zero
+	// value, EngineAuto, uses SmartLayout.
+	LayoutEngine LayoutEngine
+
+	// Logger, if set, is sent debug traces of the layout and of how each
+	// edge is routed (see WithLogger).
+	Logger *slog.Logger
+
+	// Scale multiplies the size of the image, in pixels, without changing
+	// the drawing: 2 gives a Width×Height canvas twice as many pixels
+	// each way, for high-density displays. It is at most pngMaxScale; 0
+	// means 1.
+	Scale float64
+
+	// DPI, if positive, is recorded in the PNG as its resolution, so that
+	// applications that honour it show the image at its intended size.
+	// It does not change the pixels; see Scale.
+	DPI int
+
+	// Transparent leaves the background unpainted instead of white.
+	Transparent bool
+
+	// Font is the typeface for all text; the zero value is Go Regular.
+	Font PNGFont
+
+	// TitleStyle, StateStyle, LabelStyle, and NoteStyle set the weight
+	// and slant of the title, state names, transition labels, and the
+	// notes under states (Moore outputs and linked machines). The zero
+	// value, TextDefault, matches the SVG renderer: a bold title, italic
+	// notes, and plain state names and labels.
+	TitleStyle, StateStyle, LabelStyle, NoteStyle TextStyle
+
+	// SeparateEdges draws each transition between two states as a curve
+	// of its own, as SVGOptions.SeparateEdges does.
+	SeparateEdges bool
+
+	// BundleEdges draws converging transitions as one bundle, as
+	// SVGOptions.BundleEdges does.
+	BundleEdges bool
+}
+
+// PNGFont names a typeface embedded for PNG rendering. Each comes in
+// the four styles of TextStyle.
+type PNGFont string
+
+const (
+	PNGFontRegular PNGFont = ""     // Go, proportional
+	PNGFontBold    PNGFont = "bold" // Go Bold throughout, with Go Bold Italic for italics
+	PNGFontMono    PNGFont = "mono" // Go Mono, fixed width
+)
+
+// PNGFontNames returns the names accepted by PNGFontByName, in display
+// order.
+func PNGFontNames() []string {
+	return []string{"regular", "bold", "mono"}
+}
+
+// PNGFontByName returns the font with the given name. Both "regular"
+// and "" select PNGFontRegular.
+func PNGFontByName(name string) (PNGFont, bool) {
+	switch name {
+	case "", "regular":
+		return PNGFontRegular, true
+	case "bold":
+		return PNGFontBold, true
+	case "mono":
+		return PNGFontMono, true
+	}
+	return PNGFontRegular, false
+}
+
+// TextStyle is the weight and slant of a kind of text.
+type TextStyle int
+
+const (
+	TextDefault    TextStyle = iota // the renderer's usual style for that text
+	TextPlain                       // regular weight, upright
+	TextBold                        // bold, upright
+	TextItalic                      // regular weight, italic
+	TextBoldItalic                  // bold, italic
+)
+
+// or returns s, or def if s is TextDefault.
+func (s TextStyle) or(def TextStyle) TextStyle {
+	if s == TextDefault {
+		return def
+	}
+	return s
+}
+
+// pngFontFiles holds the TrueType data of each font, in the order
+// plain, bold, italic, bold italic.
+var pngFontFiles = map[PNGFont][4][]byte{
+	PNGFontRegular: {goregular.TTF, gobold.TTF, goitalic.TTF, gobolditalic.TTF},
+	PNGFontBold:    {gobold.TTF, gobold.TTF, gobolditalic.TTF, gobolditalic.TTF},
+	PNGFontMono:    {gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF},
+}
+
+// pngParsed caches parsed fonts, by font and index in pngFontFiles.
+var (
+	pngParsedMu sync.Mutex
+	pngParsed   = make(map[pngFontKey]*opentype.Font)
+)
+
+type pngFontKey struct {
+	font  PNGFont
+	index int
+}
+
+// pngFace returns a face of fnt in style at size points. Unknown fonts
+// fall back to PNGFontRegular, and TextDefault to TextPlain.
+func pngFace(fnt PNGFont, style TextStyle, size float64) font.Face {
+	if _, ok := pngFontFiles[fnt]; !ok {
+		fnt = PNGFontRegular
+	}
+	i := 0
+	switch style {
+	case TextBold:
+		i = 1
+	case TextItalic:
+		i = 2
+	case TextBoldItalic:
+		i = 3
+	}
+	key := pngFontKey{fnt, i}
+
+	pngParsedMu.Lock()
+	parsed, ok := pngParsed[key]
+	if !ok {
+		var err error
+		parsed, err = opentype.Parse(pngFontFiles[fnt][i])
+		if err != nil {
+			pngParsedMu.Unlock()
+			panic(err) // should never happen with embedded fonts
+		}
+		pngParsed[key] = parsed
+	}
+	pngParsedMu.Unlock()
+
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingNone, // unhinted, so text scales with the drawing
+	})
+	if err != nil {
+		panic(err)
+	}
+	return face
+}
+
+// pngLayoutScale is the factor by which RenderImage lays the canvas out
+// larger than its size in pixels. Layout, line widths, and text are
+// worked out in these finer units, then drawn at the image's resolution.
+const pngLayoutScale = 4
+
+// pngMaxScale bounds PNGOptions.Scale.
+const pngMaxScale = 4
+
+// pixelScale returns o.Scale within (0, pngMaxScale], defaulting to 1.
+func (o PNGOptions) pixelScale() float64 {
+	if o.Scale <= 0 {
+		return 1
+	}
+	return math.Min(o.Scale, pngMaxScale)
 }
 
 // DefaultPNGOptions returns sensible defaults for PNG rendering.
@@ -60,104 +245,198 @@ var (
 	colorBothBdr    = color.RGBA{21, 101, 192, 255}     // #1565c0
 	colorLinked     = color.RGBA{243, 229, 245, 255}    // #f3e5f5 (light purple)
 	colorLinkedBdr  = color.RGBA{142, 36, 170, 255}     // #8e24aa (purple)
+	colorHighlight  = color.RGBA{211, 47, 47, 255}      // #d32f2f (red)
 )
 
 // renderContext holds rendering parameters including scale
 type renderContext struct {
 	img       *image.RGBA
 	scale     float64  // multiplier for line thickness, arrow size, etc.
+	zoom      float64  // image pixels per canvas unit
 	lineWidth float64  // base line width (scaled)
 	fontSize  float64  // font size in points
-	face      font.Face // font face for text rendering
+	face      textFace // font face for text rendering, and transition labels
+
+	// Faces for the title, state names, and notes under states.
+	titleFace, stateFace, noteFace textFace
+
+	// raster and scratch are reused from one shape to the next (see
+	// fillShape).
+	raster  *vector.Rasterizer
+	scratch []uint8
+
+	// deferLabels queues transition labels in labels, to be separated
+	// and drawn together by drawEdgeLabels, instead of drawing them at
+	// once (see drawEdgeLabel).
+	deferLabels bool
+	labels      []queuedLabel
+
+	log *slog.Logger // debug traces of edge routing; never nil
 }
 
-func newRenderContext(img *image.RGBA, scale int) *renderContext {
-	// Parse Go Regular font
-	fnt, err := opentype.Parse(goregular.TTF)
-	if err != nil {
-		panic(err) // should never happen with embedded font
+// textFace is a face as measured on the canvas, where labels are placed,
+// and as drawn on the image, zoom times the size.
+type textFace struct {
+	canvas, image font.Face
+}
+
+func newTextFace(fnt PNGFont, style TextStyle, size, zoom float64) textFace {
+	f := textFace{canvas: pngFace(fnt, style, size)}
+	f.image = f.canvas
+	if zoom != 1 {
+		f.image = pngFace(fnt, style, size*zoom)
 	}
-	
-	// Create face at scaled size (will be downsampled)
+	return f
+}
+
+// newRenderContext returns a context that draws on img, whose pixels are
+// zoom times the canvas units that positions are given in.
+func newRenderContext(img *image.RGBA, scale int, zoom float64, opts PNGOptions) *renderContext {
 	// Base size 14pt, scaled by render scale
 	fontSize := float64(14 * scale)
-	face, err := opentype.NewFace(fnt, &opentype.FaceOptions{
-		Size:    fontSize,
-		DPI:     72,
-		Hinting: font.HintingNone, // No hinting - we'll supersample instead
-	})
-	if err != nil {
-		panic(err)
+
+	log := opts.Logger
+	if log == nil {
+		log = discardLogger
 	}
-	
 	return &renderContext{
+		log:       log,
 		img:       img,
 		scale:     float64(scale),
+		zoom:      zoom,
 		lineWidth: float64(scale) * 2,  // 2px base line width
 		fontSize:  fontSize,
-		face:      face,
+		face:      newTextFace(opts.Font, opts.LabelStyle.or(TextPlain), fontSize, zoom),
+		titleFace: newTextFace(opts.Font, opts.TitleStyle.or(TextBold), fontSize, zoom),
+		stateFace: newTextFace(opts.Font, opts.StateStyle.or(TextPlain), fontSize, zoom),
+		noteFace:  newTextFace(opts.Font, opts.NoteStyle.or(TextItalic), fontSize, zoom),
 	}
 }
 
-// RenderPNG renders an FSM to PNG format.
-// Uses 4x supersampling for smoother output.
+// RenderPNG renders an FSM to PNG format, anti-aliased.
 func RenderPNG(f *fsm.FSM, w io.Writer, opts PNGOptions) error {
-	// Render at 4x size for supersampling
-	scale := 4
+	return RenderPNGContext(context.Background(), f, w, opts)
+}
+
+// RenderPNGContext is RenderPNG, stopping with ctx's error if ctx is done
+// before the layout is.
+func RenderPNGContext(ctx context.Context, f *fsm.FSM, w io.Writer, opts PNGOptions) error {
+	img, err := RenderImageContext(ctx, f, opts)
+	if err != nil {
+		return err
+	}
+	return EncodePNG(w, img, opts.DPI)
+}
+
+// EncodePNG writes img as a PNG, recording dpi as its resolution if it is
+// positive.
+func EncodePNG(w io.Writer, img image.Image, dpi int) error {
+	if dpi <= 0 {
+		return png.Encode(w, img)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	// The pHYs chunk goes straight after IHDR: the 8-byte signature,
+	// then IHDR's length, type, 13 data bytes, and CRC.
+	data := buf.Bytes()
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	ppm := uint32(math.Round(float64(dpi) / 0.0254)) // pixels per metre
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1 // unit: metre
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+	for _, part := range [][]byte{data[:ihdrEnd], chunk, data[ihdrEnd:]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderImage renders an FSM to an image, as RenderPNG does before
+// encoding it. The image is opts.Scale times the size of the canvas (or
+// of the Viewport).
+func RenderImage(f *fsm.FSM, opts PNGOptions) *image.RGBA {
+	img, _ := RenderImageContext(context.Background(), f, opts)
+	return img
+}
+
+// RenderImageContext is RenderImage, stopping with ctx's error if ctx is
+// done before the layout is.
+func RenderImageContext(ctx context.Context, f *fsm.FSM, opts PNGOptions) (*image.RGBA, error) {
+	if opts.Logger != nil {
+		ctx = WithLogger(ctx, opts.Logger)
+	}
+	// Lay out at 4x size, and draw at the size of the image
+	scale := pngLayoutScale
+	region := image.Rect(0, 0, opts.Width, opts.Height)
+	if !opts.Viewport.Empty() {
+		region = opts.Viewport
+	}
 	largeOpts := opts
+	largeOpts.Viewport = image.Rectangle{Min: region.Min.Mul(scale), Max: region.Max.Mul(scale)}
 	largeOpts.Width = opts.Width * scale
 	largeOpts.Height = opts.Height * scale
 	largeOpts.Padding = opts.Padding * scale
 	largeOpts.StateRadius = opts.StateRadius * scale
 	largeOpts.FontSize = opts.FontSize * scale
 	largeOpts.LabelSize = opts.LabelSize * scale
+	largeOpts.Logger = loggerFrom(ctx)
 
-	// Render large image with scale context
-	largeImg := renderPNGInternal(f, largeOpts, scale)
-
-	// Downsample to target size using high-quality interpolation
-	finalImg := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
-	draw.CatmullRom.Scale(finalImg, finalImg.Bounds(), largeImg, largeImg.Bounds(), draw.Over, nil)
+	layoutWidth, layoutHeight := pngLayoutSize(largeOpts)
+	largeOpts.Logger.DebugContext(ctx, "png layout", "engine", opts.LayoutEngine.Name(), "width", layoutWidth, "height", layoutHeight)
+	positions, err := EngineLayoutContext(ctx, f, largeOpts.LayoutEngine, layoutWidth, layoutHeight)
+	if err != nil {
+		return nil, err
+	}
+	img := renderPNGInternal(f, positions, largeOpts, scale, opts.pixelScale()/float64(scale))
+	img.Rect = img.Rect.Sub(img.Rect.Min)
+	return img, nil
+}
 
-	return png.Encode(w, finalImg)
+// pngLayoutSize returns the grid the states of an image with opts are laid
+// out on. Sugiyama produces hierarchical (typically tall) layouts, so the
+// grid follows the canvas's aspect ratio.
+func pngLayoutSize(opts PNGOptions) (width, height int) {
+	canvasAspect := float64(opts.Width) / float64(opts.Height)
+	switch {
+	case canvasAspect > 1.3:
+		// Wide canvas: give layout more width to spread horizontally
+		return opts.Width / 8, opts.Height / 15
+	case canvasAspect < 0.7:
+		// Tall canvas: standard vertical layout
+		return opts.Width / 12, opts.Height / 18
+	}
+	// Square-ish canvas
+	return opts.Width / 10, opts.Height / 18
 }
 
-// renderPNGInternal renders the FSM to an image at the specified size.
-func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
+// renderPNGInternal renders the FSM, with its states at positions, to an
+// image zoom times the specified size. With a Viewport, the image covers
+// only that region of the canvas and drawing outside it is discarded.
+func renderPNGInternal(f *fsm.FSM, positions map[string][2]int, opts PNGOptions, scale int, zoom float64) *image.RGBA {
 	// Create image
-	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	region := image.Rect(0, 0, opts.Width, opts.Height)
+	if !opts.Viewport.Empty() {
+		region = opts.Viewport
+	}
+	min := image.Pt(int(math.Round(float64(region.Min.X)*zoom)), int(math.Round(float64(region.Min.Y)*zoom)))
+	bounds := image.Rectangle{Min: min, Max: min.Add(image.Pt(
+		int(math.Round(float64(region.Dx())*zoom)), int(math.Round(float64(region.Dy())*zoom))))}
+	img := image.NewRGBA(bounds)
 	
 	// Create render context with scale for line thickness etc.
-	ctx := newRenderContext(img, scale)
+	ctx := newRenderContext(img, scale, zoom, opts)
 
-	// Fill background white
-	for y := 0; y < opts.Height; y++ {
-		for x := 0; x < opts.Width; x++ {
-			img.Set(x, y, colorWhite)
-		}
-	}
-
-	// Get layout positions
-	// Sugiyama produces hierarchical (typically tall) layouts
-	// Adjust layout dimensions based on canvas aspect ratio
-	canvasAspect := float64(opts.Width) / float64(opts.Height)
-	
-	var layoutWidth, layoutHeight int
-	if canvasAspect > 1.3 {
-		// Wide canvas: give layout more width to spread horizontally
-		layoutWidth = opts.Width / 8
-		layoutHeight = opts.Height / 15
-	} else if canvasAspect < 0.7 {
-		// Tall canvas: standard vertical layout
-		layoutWidth = opts.Width / 12
-		layoutHeight = opts.Height / 18
-	} else {
-		// Square-ish canvas
-		layoutWidth = opts.Width / 10
-		layoutHeight = opts.Height / 18
+	// Fill background white, unless it is to stay transparent
+	if !opts.Transparent {
+		draw.Draw(img, bounds, image.NewUniform(colorWhite), image.Point{}, draw.Src)
 	}
-	
-	positions := SmartLayout(f, layoutWidth, layoutHeight)
 
 	// Convert to pixel coordinates (same logic as SVG)
 	rawPos := make(map[string][2]float64)
@@ -372,17 +651,23 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 
 	// Draw title
 	if opts.Title != "" {
-		drawTextCentered(ctx, opts.Width/2, 25*scale, opts.Title, colorBlack)
+		drawTextCenteredFace(ctx, ctx.titleFace, opts.Width/2, 25*scale, opts.Title, colorBlack)
 	}
 
 	// Collect transitions
 	type transKey struct {
 		from, to string
 	}
+	// transOrder keeps edges in first-seen order so that label placement,
+	// which depends on what was drawn before, is the same on every run.
 	transLabels := make(map[transKey][]string)
+	var transOrder []transKey
 	for _, t := range f.Transitions {
 		for _, to := range t.To {
 			key := transKey{t.From, to}
+			if _, seen := transLabels[key]; !seen {
+				transOrder = append(transOrder, key)
+			}
 			label := ""
 			if t.Input != nil {
 				label = *t.Input
@@ -392,6 +677,9 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 			if f.Type == fsm.TypeMealy && t.Output != nil {
 				label += "/" + *t.Output
 			}
+			if f.Type == fsm.TypePDA {
+				label += " [" + t.StackLabel() + "]"
+			}
 			transLabels[key] = append(transLabels[key], label)
 		}
 	}
@@ -400,7 +688,8 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 	// First, build state obstacles for LabelPlacer
 	var stateRects []Rect
 	var stateEllipses []Ellipse // For obstacle-aware routing
-	for name, pos := range pngPos {
+	for _, name := range f.States {
+		pos := pngPos[name]
 		dims := ellipseDims[name]
 		stateRects = append(stateRects, Rect{
 			X: pos[0], Y: pos[1],
@@ -413,17 +702,53 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 		})
 	}
 	labelPlacer := NewLabelPlacer(stateRects)
+	ctx.deferLabels = true
 
 	// First pass: draw non-self-loop transitions
 	var labelBoxes []labelBox
 	drawnPairs := make(map[transKey]bool)
 	var selfLoops []struct {
+		name         string
 		x, y, rx, ry float64
 		label        string
+		ink          color.Color
+	}
+
+	// towards holds points the transitions of each state pass through
+	// near it, so that its self-loop can go on a side they leave clear.
+	towards := make(map[string][]Point)
+
+	hl := opts.Highlight
+	edgeInk := func(from, to string) color.Color {
+		if hl.edge(from, to) {
+			return colorHighlight
+		}
+		return colorBlack
+	}
+
+	// Transitions in bundles are drawn together after the others.
+	var bundles []EdgeBundle
+	bundled := make(map[transKey]bool)
+	if opts.BundleEdges {
+		edges := make([][2]string, len(transOrder))
+		for i, key := range transOrder {
+			edges[i] = [2]string{key.from, key.to}
+		}
+		radius := make(map[string]float64)
+		for name, dims := range ellipseDims {
+			radius[name] = math.Max(dims[0], dims[1])
+		}
+		bundles = FindEdgeBundles(edges, pngPos, radius, 40*ctx.scale)
+		for _, b := range bundles {
+			for _, from := range b.From {
+				bundled[transKey{from, b.To}] = true
+			}
+		}
 	}
 
-	for key, labels := range transLabels {
-		if drawnPairs[key] {
+	for _, key := range transOrder {
+		labels := transLabels[key]
+		if drawnPairs[key] || bundled[key] {
 			continue
 		}
 
@@ -436,9 +761,11 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 		if key.from == key.to {
 			// Defer self-loops to second pass
 			selfLoops = append(selfLoops, struct {
+				name         string
 				x, y, rx, ry float64
 				label        string
-			}{fromPos[0], fromPos[1], fromDims[0], fromDims[1], label})
+				ink          color.Color
+			}{key.from, fromPos[0], fromPos[1], fromDims[0], fromDims[1], label, edgeInk(key.from, key.to)})
 		} else {
 			reverseKey := transKey{key.to, key.from}
 			reverseLabels, hasBidi := transLabels[reverseKey]
@@ -448,20 +775,41 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 			avgR := (fromDims[0] + fromDims[1] + toDims[0] + toDims[1]) / 4
 			isBackEdge := dy < -avgR*2
 
-			if hasBidi && !drawnPairs[reverseKey] {
+			if opts.SeparateEdges && len(labels)+len(reverseLabels) > 1 {
+				var arcs []pngArc
+				for _, k := range []transKey{key, reverseKey} {
+					for _, l := range transLabels[k] {
+						arcs = append(arcs, pngArc{k.from, k.to, l, edgeInk(k.from, k.to)})
+					}
+				}
+				ctx.log.Debug("png edge", "from", key.from, "to", key.to, "route", "parallel", "arcs", len(arcs))
+				for _, p := range drawParallelTransitionsPNG(ctx, fromPos, toPos, fromDims, toDims, arcs, labelPlacer) {
+					labelBoxes = append(labelBoxes, labelBox{p.X, p.Y, 50 * ctx.scale, 15 * ctx.scale})
+					towards[key.from] = append(towards[key.from], p)
+					towards[key.to] = append(towards[key.to], p)
+				}
+				drawnPairs[reverseKey] = true
+			} else if hasBidi && !drawnPairs[reverseKey] {
+				ctx.log.Debug("png edge", "from", key.from, "to", key.to, "route", "bidirectional")
 				lx, ly := drawBidiTransitionPNGWithPlacer(ctx, fromPos[0], fromPos[1], toPos[0], toPos[1],
-					fromDims, toDims, label, strings.Join(reverseLabels, ", "), labelPlacer)
+					fromDims, toDims, label, strings.Join(reverseLabels, ", "), labelPlacer,
+					edgeInk(key.from, key.to), edgeInk(key.to, key.from))
 				labelBoxes = append(labelBoxes, labelBox{lx, ly, 50 * ctx.scale, 15 * ctx.scale})
+				// The two curves bow to either side of the line between
+				// the states, so that line is their direction.
+				towards[key.from] = append(towards[key.from], Point{toPos[0], toPos[1]})
+				towards[key.to] = append(towards[key.to], Point{fromPos[0], fromPos[1]})
 				drawnPairs[reverseKey] = true
 			} else if !hasBidi {
 				if isBackEdge {
 					// Use obstacle-aware routing for back-edges
 					// Build list of obstacles excluding source and target
 					var routingObstacles []Ellipse
-					for name, pos := range pngPos {
+					for _, name := range f.States {
 						if name == key.from || name == key.to {
 							continue
 						}
+						pos := pngPos[name]
 						dims := ellipseDims[name]
 						routingObstacles = append(routingObstacles, Ellipse{
 							CX: pos[0], CY: pos[1],
@@ -469,24 +817,64 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 							RY: dims[1] + 8*ctx.scale,
 						})
 					}
+					ctx.log.Debug("png edge", "from", key.from, "to", key.to, "route", "routed", "reason", "goes upward",
+						"obstacles", len(routingObstacles))
 					lx, ly := drawTransitionWithRouting(ctx, fromPos[0], fromPos[1], toPos[0], toPos[1],
-						fromDims, toDims, label, routingObstacles, labelPlacer)
+						fromDims, toDims, label, routingObstacles, labelPlacer, edgeInk(key.from, key.to))
 					labelBoxes = append(labelBoxes, labelBox{lx, ly, 50 * ctx.scale, 15 * ctx.scale})
+					towards[key.from] = append(towards[key.from], Point{lx, ly})
+					towards[key.to] = append(towards[key.to], Point{lx, ly})
 				} else {
+					ctx.log.Debug("png edge", "from", key.from, "to", key.to, "route", "direct")
 					lx, ly := drawTransitionPNGWithPlacer(ctx, fromPos[0], fromPos[1], toPos[0], toPos[1],
-						fromDims, toDims, label, graphCentreX, graphCentreY, labelPlacer)
+						fromDims, toDims, label, graphCentreX, graphCentreY, labelPlacer, edgeInk(key.from, key.to))
 					labelBoxes = append(labelBoxes, labelBox{lx, ly, 50 * ctx.scale, 15 * ctx.scale})
+					towards[key.from] = append(towards[key.from], Point{lx, ly})
+					towards[key.to] = append(towards[key.to], Point{lx, ly})
 				}
 			}
 		}
 		drawnPairs[key] = true
 	}
+	for _, b := range bundles {
+		var branches []pngArc
+		for _, from := range b.From {
+			branches = append(branches, pngArc{from, b.To, strings.Join(transLabels[transKey{from, b.To}], ", "), edgeInk(from, b.To)})
+		}
+		ctx.log.Debug("png edge", "from", b.From, "to", b.To, "route", "bundle")
+		placed := drawEdgeBundlePNG(ctx, b, pngPos, ellipseDims, branches, labelPlacer)
+		towards[b.To] = append(towards[b.To], b.Junction)
+		for i, p := range placed {
+			labelBoxes = append(labelBoxes, labelBox{p.X, p.Y, 50 * ctx.scale, 15 * ctx.scale})
+			towards[b.From[i]] = append(towards[b.From[i]], p)
+		}
+	}
 
 	// Second pass: draw self-loops with smart label placement
 	canvasW := float64(opts.Width)
 	canvasH := float64(opts.Height)
+	// The initial arrow comes in from the left, like a transition, and
+	// a loop must not be drawn over it.
+	var initialArrow []Rect
+	if pos, ok := pngPos[f.Initial]; ok {
+		rx := ellipseDims[f.Initial][0]
+		towards[f.Initial] = append(towards[f.Initial], Point{pos[0] - rx - 30*ctx.scale, pos[1]})
+		initialArrow = []Rect{{X: pos[0] - rx - 16*ctx.scale, Y: pos[1], W: 28 * ctx.scale, H: 8 * ctx.scale}}
+	}
 	for _, loop := range selfLoops {
-		drawSelfLoopPNG(ctx, loop.x, loop.y, loop.rx, loop.ry, loop.label, labelBoxes, graphCentreY, canvasW, canvasH)
+		around := &LoopSurroundings{Towards: towards[loop.name], Scale: ctx.scale}
+		if loop.name == f.Initial {
+			around.Obstacles = append(around.Obstacles, initialArrow...)
+		}
+		for _, b := range labelBoxes {
+			around.Obstacles = append(around.Obstacles, Rect{X: b.x, Y: b.y, W: b.w, H: b.h})
+		}
+		for i, name := range f.States {
+			if name != loop.name {
+				around.Obstacles = append(around.Obstacles, stateRects[i])
+			}
+		}
+		drawSelfLoopPNG(ctx, loop.x, loop.y, loop.rx, loop.ry, loop.label, labelBoxes, around, canvasW, canvasH, loop.ink)
 	}
 
 	// Draw initial arrow
@@ -496,7 +884,11 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 			rx := dims[0]
 			startX := pos[0] - rx - 30*ctx.scale
 			endX := pos[0] - rx - 2*ctx.scale
-			drawArrowLine(ctx, startX, pos[1], endX, pos[1], colorBlack)
+			ink := color.Color(colorBlack)
+			if hl.edge("", f.Initial) {
+				ink = colorHighlight
+			}
+			drawArrowLine(ctx, startX, pos[1], endX, pos[1], ink)
 		}
 	}
 
@@ -526,6 +918,9 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 			fillColor = colorAccepting
 			borderColor = colorAcceptBdr
 		}
+		if hl.state(name) {
+			borderColor = colorHighlight
+		}
 
 		// Calculate dimensions
 		labelLen := len(name)
@@ -547,215 +942,149 @@ func renderPNGInternal(f *fsm.FSM, opts PNGOptions, scale int) *image.RGBA {
 		}
 
 		// Draw label
-		drawTextCentered(ctx, int(x), int(y)+int(4*ctx.scale), name, colorBlack)
+		drawTextCenteredFace(ctx, ctx.stateFace, int(x), int(y)+int(4*ctx.scale), name, colorBlack)
 
 		// Draw linked machine label below state
 		if isLinked {
 			targetMachine := f.GetLinkedMachine(name)
 			if targetMachine != "" {
-				drawTextCentered(ctx, int(x), int(y+stateHeight/2+12*ctx.scale), "→"+targetMachine, colorLinkedBdr)
+				drawTextCenteredFace(ctx, ctx.noteFace, int(x), int(y+stateHeight/2+12*ctx.scale), "→"+targetMachine, colorLinkedBdr)
 			}
 		} else if f.Type == fsm.TypeMoore {
 			// Draw Moore output
 			if output, ok := f.StateOutputs[name]; ok {
-				drawTextCentered(ctx, int(x), int(y+stateHeight/2+12*ctx.scale), "/"+output, colorGray)
+				drawTextCenteredFace(ctx, ctx.noteFace, int(x), int(y+stateHeight/2+12*ctx.scale), "/"+output, colorGray)
 			}
 		}
 	}
 
+	// Transition labels last, once all of them are known
+	obstacles := stateRects
+	if opts.Title != "" {
+		obstacles = append(obstacles, Rect{
+			X: float64(opts.Width) / 2, Y: 25 * float64(scale),
+			W: float64(font.MeasureString(ctx.titleFace.canvas, opts.Title).Ceil()),
+			H: float64(ctx.titleFace.canvas.Metrics().Ascent.Ceil()),
+		})
+	}
+	drawEdgeLabels(ctx, obstacles, float64(opts.Width), float64(opts.Height))
+
 	return img
 }
 
 // drawEllipse draws an ellipse outline and optional fill.
 func drawEllipse(ctx *renderContext, cx, cy, rx, ry float64, fill, stroke color.Color) {
-	img := ctx.img
-	thickness := ctx.lineWidth
-	
-	// Fill interior first
 	if fill != color.Transparent {
-		for dy := -ry; dy <= ry; dy++ {
-			yNorm := dy / ry
-			if yNorm*yNorm <= 1 {
-				xExtent := rx * math.Sqrt(1-yNorm*yNorm)
-				for dx := -xExtent; dx <= xExtent; dx++ {
-					img.Set(int(cx+dx), int(cy+dy), fill)
-				}
-			}
-		}
-	}
-	
-	// Draw thick outline
-	for angle := 0.0; angle < 2*math.Pi; angle += 0.005 {
-		x := cx + rx*math.Cos(angle)
-		y := cy + ry*math.Sin(angle)
-		
-		// Draw with thickness
-		for t := -thickness / 2; t <= thickness/2; t += 0.5 {
-			// Offset along the normal (radial direction)
-			nx := math.Cos(angle)
-			ny := math.Sin(angle)
-			img.Set(int(x+nx*t), int(y+ny*t), stroke)
-		}
+		fillShape(ctx, shape{{ellipsePoints(cx, cy, rx, ry, 0, 2*math.Pi)}}, fill)
 	}
+	fillShape(ctx, shape{arcPiece(cx, cy, rx, ry, ctx.lineWidth, 0, 2*math.Pi)}, stroke)
 }
 
 // drawDashedEllipse draws a dashed ellipse outline (for linked states).
 func drawDashedEllipse(ctx *renderContext, cx, cy, rx, ry float64, stroke color.Color) {
-	img := ctx.img
-	thickness := ctx.lineWidth
-	
 	// Dash pattern: draw for dashLen, skip for gapLen
 	dashLen := 8.0 * float64(ctx.scale)
 	gapLen := 4.0 * float64(ctx.scale)
-	
-	// Calculate ellipse perimeter approximately for dash spacing
-	perimeter := 2 * math.Pi * math.Sqrt((rx*rx+ry*ry)/2)
+
 	angleStep := 0.005
-	
 	arcLen := 0.0
 	drawing := true
-	
+	dashStart := 0.0
+
+	// Every dash is a band of its own; they do not overlap, so they
+	// fill together as one piece.
+	var dashes piece
 	for angle := 0.0; angle < 2*math.Pi; angle += angleStep {
 		// Approximate arc length increment
 		dx := -rx * math.Sin(angle) * angleStep
 		dy := ry * math.Cos(angle) * angleStep
 		arcLen += math.Sqrt(dx*dx + dy*dy)
-		
+
 		// Toggle drawing based on dash pattern
 		if drawing && arcLen > dashLen {
+			dashes = append(dashes, arcPiece(cx, cy, rx, ry, ctx.lineWidth, dashStart, angle)...)
 			drawing = false
 			arcLen = 0
 		} else if !drawing && arcLen > gapLen {
 			drawing = true
+			dashStart = angle
 			arcLen = 0
 		}
-		
-		if drawing {
-			x := cx + rx*math.Cos(angle)
-			y := cy + ry*math.Sin(angle)
-			
-			// Draw with thickness
-			for t := -thickness / 2; t <= thickness/2; t += 0.5 {
-				nx := math.Cos(angle)
-				ny := math.Sin(angle)
-				img.Set(int(x+nx*t), int(y+ny*t), stroke)
-			}
-		}
 	}
-	_ = perimeter // suppress unused warning
+	if drawing {
+		dashes = append(dashes, arcPiece(cx, cy, rx, ry, ctx.lineWidth, dashStart, 2*math.Pi)...)
+	}
+	fillShape(ctx, shape{dashes}, stroke)
 }
 
 // drawLine draws a line between two points with thickness from context.
 func drawLine(ctx *renderContext, x1, y1, x2, y2 float64, c color.Color) {
-	img := ctx.img
-	thickness := ctx.lineWidth
-	
-	dx := x2 - x1
-	dy := y2 - y1
-	steps := math.Max(math.Abs(dx), math.Abs(dy))
-	if steps < 1 {
-		steps = 1
-	}
-
-	halfThick := thickness / 2
-	
-	dist := math.Sqrt(dx*dx + dy*dy)
-	if dist < 1 {
-		for ty := -halfThick; ty <= halfThick; ty++ {
-			for tx := -halfThick; tx <= halfThick; tx++ {
-				img.Set(int(x1+tx), int(y1+ty), c)
-			}
-		}
+	if math.Hypot(x2-x1, y2-y1) < 1 {
+		// Too short to have a direction: a dot
+		h := ctx.lineWidth / 2
+		fillShape(ctx, shape{{{{x1 - h, y1 - h}, {x1 + h, y1 - h}, {x1 + h, y1 + h}, {x1 - h, y1 + h}}}}, c)
 		return
 	}
-	
-	perpX := -dy / dist
-	perpY := dx / dist
-
-	for i := 0.0; i <= steps; i++ {
-		t := i / steps
-		cx := x1 + dx*t
-		cy := y1 + dy*t
-		
-		for offset := -halfThick; offset <= halfThick; offset += 0.5 {
-			img.Set(int(cx+perpX*offset), int(cy+perpY*offset), c)
-		}
-	}
+	fillShape(ctx, strokeShape([]Point{{x1, y1}, {x2, y2}}, ctx.lineWidth), c)
 }
 
 // drawArrowLine draws a line with an arrowhead at the end.
 func drawArrowLine(ctx *renderContext, x1, y1, x2, y2 float64, c color.Color) {
 	drawLine(ctx, x1, y1, x2, y2, c)
 
-	// Arrowhead - scale with context
 	dx := x2 - x1
 	dy := y2 - y1
 	dist := math.Sqrt(dx*dx + dy*dy)
 	if dist < 1 {
 		return
 	}
-
-	nx := dx / dist
-	ny := dy / dist
-
-	// Arrow wings - scale with context
-	arrowLen := 8.0 * ctx.scale
-	arrowWidth := 4.0 * ctx.scale
-
-	ax1 := x2 - nx*arrowLen + ny*arrowWidth
-	ay1 := y2 - ny*arrowLen - nx*arrowWidth
-	ax2 := x2 - nx*arrowLen - ny*arrowWidth
-	ay2 := y2 - ny*arrowLen + nx*arrowWidth
-
-	drawLine(ctx, x2, y2, ax1, ay1, c)
-	drawLine(ctx, x2, y2, ax2, ay2, c)
-
-	// Fill arrowhead
-	for t := 0.0; t <= 1.0; t += 0.05 {
-		mx := ax1 + (ax2-ax1)*t
-		my := ay1 + (ay2-ay1)*t
-		drawLine(ctx, x2, y2, mx, my, c)
-	}
+	drawArrowhead(ctx, x2, y2, dx/dist, dy/dist, c)
 }
 
 // drawQuadBezier draws a quadratic Bezier curve.
 func drawQuadBezier(ctx *renderContext, x1, y1, cx, cy, x2, y2 float64, c color.Color) {
-	steps := 100.0
-	var prevX, prevY float64
-
-	for i := 0.0; i <= steps; i++ {
-		t := i / steps
-		x := (1-t)*(1-t)*x1 + 2*(1-t)*t*cx + t*t*x2
-		y := (1-t)*(1-t)*y1 + 2*(1-t)*t*cy + t*t*y2
-
-		if i > 0 {
-			drawLine(ctx, prevX, prevY, x, y, c)
+	steps := 100
+	pts := make([]Point, steps+1)
+	for i := range pts {
+		t := float64(i) / float64(steps)
+		pts[i] = Point{
+			(1-t)*(1-t)*x1 + 2*(1-t)*t*cx + t*t*x2,
+			(1-t)*(1-t)*y1 + 2*(1-t)*t*cy + t*t*y2,
 		}
-		prevX, prevY = x, y
 	}
+	fillShape(ctx, strokeShape(pts, ctx.lineWidth), c)
 }
 
-// drawCubicBezier draws a cubic Bézier curve.
-func drawCubicBezier(ctx *renderContext, p0, p1, p2, p3 Point, c color.Color) {
-	steps := 100.0
-	var prevX, prevY float64
+// drawCubicSpline draws a sequence of cubic Bézier curves, given as
+// [P0, C1, C2, P1, C3, C4, P2, ...], as one line.
+func drawCubicSpline(ctx *renderContext, spline []Point, c color.Color) {
+	if len(spline) < 4 {
+		return
+	}
+	pts := []Point{spline[0]}
+	for i := 0; i+3 < len(spline); i += 3 {
+		pts = appendCubic(pts, spline[i], spline[i+1], spline[i+2], spline[i+3])
+	}
+	fillShape(ctx, strokeShape(pts, ctx.lineWidth), c)
+}
 
-	for i := 0.0; i <= steps; i++ {
-		t := i / steps
+// appendCubic appends points along a cubic Bézier curve, after p0, to pts.
+func appendCubic(pts []Point, p0, p1, p2, p3 Point) []Point {
+	steps := 100
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / float64(steps)
 		t2 := t * t
 		t3 := t2 * t
 		mt := 1 - t
 		mt2 := mt * mt
 		mt3 := mt2 * mt
 
-		x := mt3*p0.X + 3*mt2*t*p1.X + 3*mt*t2*p2.X + t3*p3.X
-		y := mt3*p0.Y + 3*mt2*t*p1.Y + 3*mt*t2*p2.Y + t3*p3.Y
-
-		if i > 0 {
-			drawLine(ctx, prevX, prevY, x, y, c)
-		}
-		prevX, prevY = x, y
+		pts = append(pts, Point{
+			mt3*p0.X + 3*mt2*t*p1.X + 3*mt*t2*p2.X + t3*p3.X,
+			mt3*p0.Y + 3*mt2*t*p1.Y + 3*mt*t2*p2.Y + t3*p3.Y,
+		})
 	}
+	return pts
 }
 
 // drawQuadBezierArrow draws a quadratic Bezier curve with arrowhead.
@@ -769,31 +1098,20 @@ func drawQuadBezierArrow(ctx *renderContext, x1, y1, cx, cy, x2, y2 float64, c c
 	if dist < 1 {
 		return
 	}
-
-	nx := tx / dist
-	ny := ty / dist
-
-	arrowLen := 8.0 * ctx.scale
-	arrowWidth := 4.0 * ctx.scale
-
-	ax1 := x2 - nx*arrowLen + ny*arrowWidth
-	ay1 := y2 - ny*arrowLen - nx*arrowWidth
-	ax2 := x2 - nx*arrowLen - ny*arrowWidth
-	ay2 := y2 - ny*arrowLen + nx*arrowWidth
-
-	drawLine(ctx, x2, y2, ax1, ay1, c)
-	drawLine(ctx, x2, y2, ax2, ay2, c)
-	for t := 0.0; t <= 1.0; t += 0.05 {
-		mx := ax1 + (ax2-ax1)*t
-		my := ay1 + (ay2-ay1)*t
-		drawLine(ctx, x2, y2, mx, my, c)
-	}
+	drawArrowhead(ctx, x2, y2, tx/dist, ty/dist, c)
 }
 
-// drawTextCentered draws text centered at the given position using Go Regular font.
+// drawTextCentered draws text centered at the given position in the
+// transition label face.
 func drawTextCentered(ctx *renderContext, x, y int, text string, c color.Color) {
-	// Measure text width
-	width := font.MeasureString(ctx.face, text).Ceil()
+	drawTextCenteredFace(ctx, ctx.face, x, y, text, c)
+}
+
+// drawTextCenteredFace draws text centered at the given position in face.
+func drawTextCenteredFace(ctx *renderContext, tf textFace, x, y int, text string, c color.Color) {
+	// Measure text width, as drawn
+	face := tf.image
+	width := font.MeasureString(face, text)
 	
 	// Calculate baseline position
 	// y is the vertical centre point of the ellipse (Y increases downward)
@@ -803,20 +1121,20 @@ func drawTextCentered(ctx *renderContext, x, y int, text string, c color.Color)
 	// Cap height ≈ 0.7 * ascent
 	// So baseline ≈ y + 0.35 * ascent for true centering
 	// Text was too low, so reduce this offset further
-	metrics := ctx.face.Metrics()
+	metrics := face.Metrics()
 	ascent := metrics.Ascent.Ceil()
 	
-	baselineY := y + int(float64(ascent)*0.15)
+	baselineY := float64(y)*ctx.zoom + float64(ascent)*0.15
 	
 	point := fixed.Point26_6{
-		X: fixed.I(x - width/2),
-		Y: fixed.I(baselineY),
+		X: fixed.Int26_6(math.Round(float64(x)*ctx.zoom*64)) - width/2,
+		Y: fixed.Int26_6(math.Round(baselineY * 64)),
 	}
 
 	d := &font.Drawer{
 		Dst:  ctx.img,
 		Src:  image.NewUniform(c),
-		Face: ctx.face,
+		Face: face,
 		Dot:  point,
 	}
 	d.DrawString(text)
@@ -907,7 +1225,7 @@ func drawTransitionPNG(ctx *renderContext, x1, y1, x2, y2 float64, fromDims, toD
 }
 
 // drawTransitionPNGWithPlacer draws a transition with collision-aware label placement.
-func drawTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fromDims, toDims [2]float64, label string, graphCentreX, graphCentreY float64, placer *LabelPlacer) (float64, float64) {
+func drawTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fromDims, toDims [2]float64, label string, graphCentreX, graphCentreY float64, placer *LabelPlacer, ink color.Color) (float64, float64) {
 	dx := x2 - x1
 	dy := y2 - y1
 	dist := math.Sqrt(dx*dx + dy*dy)
@@ -959,7 +1277,7 @@ func drawTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fro
 		cx := midX + perpX*curveAmount
 		cy := midY + perpY*curveAmount
 
-		drawQuadBezierArrow(ctx, sx, sy, cx, cy, ex, ey, colorBlack)
+		drawQuadBezierArrow(ctx, sx, sy, cx, cy, ex, ey, ink)
 
 		// Place label on the curve at t=0.5 using collision avoidance
 		curveMidX := 0.25*sx + 0.5*cx + 0.25*ex
@@ -972,9 +1290,9 @@ func drawTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fro
 			labelW, labelH, gap,
 		)
 		labelX, labelY = labelPos.X, labelPos.Y
-		drawTextCentered(ctx, int(labelX), int(labelY), label, colorBlack)
+		drawEdgeLabel(ctx, int(labelX), int(labelY), label, ink)
 	} else {
-		drawArrowLine(ctx, sx, sy, ex, ey, colorBlack)
+		drawArrowLine(ctx, sx, sy, ex, ey, ink)
 
 		// Use LabelPlacer for label position
 		labelPos := placer.PlaceLabelOnEdge(
@@ -982,7 +1300,7 @@ func drawTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fro
 			labelW, labelH, gap,
 		)
 		labelX, labelY = labelPos.X, labelPos.Y
-		drawTextCentered(ctx, int(labelX), int(labelY), label, colorBlack)
+		drawEdgeLabel(ctx, int(labelX), int(labelY), label, ink)
 	}
 	return labelX, labelY
 }
@@ -990,7 +1308,7 @@ func drawTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fro
 // drawTransitionWithRouting draws a transition using obstacle-aware routing.
 // Uses visibility graph to find waypoints, then fits a smooth quadratic curve
 // guided by those waypoints (rather than passing exactly through each one).
-func drawTransitionWithRouting(ctx *renderContext, x1, y1, x2, y2 float64, fromDims, toDims [2]float64, label string, obstacles []Ellipse, placer *LabelPlacer) (float64, float64) {
+func drawTransitionWithRouting(ctx *renderContext, x1, y1, x2, y2 float64, fromDims, toDims [2]float64, label string, obstacles []Ellipse, placer *LabelPlacer, ink color.Color) (float64, float64) {
 	dx := x2 - x1
 	dy := y2 - y1
 	dist := math.Sqrt(dx*dx + dy*dy)
@@ -1015,6 +1333,7 @@ func drawTransitionWithRouting(ctx *renderContext, x1, y1, x2, y2 float64, fromD
 	start := Point{sx, sy}
 	end := Point{ex, ey}
 	path := RouteAroundObstacles(start, end, obstacles)
+	ctx.log.Debug("png route", "path", path, "obstacles", len(obstacles))
 
 	var labelX, labelY float64
 	var cx, cy float64 // Control point for the curve
@@ -1084,7 +1403,7 @@ func drawTransitionWithRouting(ctx *renderContext, x1, y1, x2, y2 float64, fromD
 	}
 
 	// Draw the smooth quadratic Bézier
-	drawQuadBezierArrow(ctx, sx, sy, cx, cy, ex, ey, colorBlack)
+	drawQuadBezierArrow(ctx, sx, sy, cx, cy, ex, ey, ink)
 
 	// Place label on the curve at t=0.5
 	curveMidX := 0.25*sx + 0.5*cx + 0.25*ex
@@ -1111,7 +1430,7 @@ func drawTransitionWithRouting(ctx *renderContext, x1, y1, x2, y2 float64, fromD
 	)
 	labelX, labelY = labelPos.X, labelPos.Y
 
-	drawTextCentered(ctx, int(labelX), int(labelY), label, colorBlack)
+	drawEdgeLabel(ctx, int(labelX), int(labelY), label, ink)
 	return labelX, labelY
 }
 
@@ -1145,14 +1464,7 @@ func drawPathWithArrow(ctx *renderContext, path []Point, c color.Color) {
 		// smoothPath has format: [P0, C1, C2, P1, C3, C4, P2, ...]
 		// So for n waypoints, we have (n-1) segments, each using 4 points
 		// Total points = 1 + 3*(n-1) = 3n - 2
-		numSegments := (len(smoothPath) - 1) / 3
-		for seg := 0; seg < numSegments; seg++ {
-			i := seg * 3
-			// Need indices i, i+1, i+2, i+3
-			if i+3 <= len(smoothPath)-1 {
-				drawCubicBezier(ctx, smoothPath[i], smoothPath[i+1], smoothPath[i+2], smoothPath[i+3], c)
-			}
-		}
+		drawCubicSpline(ctx, smoothPath, c)
 	} else {
 		// Fallback: draw as quadratic through midpoint
 		mid := Point{
@@ -1196,26 +1508,7 @@ func drawPathWithArrow(ctx *renderContext, path []Point, c color.Color) {
 		return
 	}
 
-	nx := tx / dist
-	ny := ty / dist
-
-	arrowLen := 8.0 * ctx.scale
-	arrowWidth := 4.0 * ctx.scale
-
-	ax1 := last.X - nx*arrowLen + ny*arrowWidth
-	ay1 := last.Y - ny*arrowLen - nx*arrowWidth
-	ax2 := last.X - nx*arrowLen - ny*arrowWidth
-	ay2 := last.Y - ny*arrowLen + nx*arrowWidth
-
-	drawLine(ctx, last.X, last.Y, ax1, ay1, c)
-	drawLine(ctx, last.X, last.Y, ax2, ay2, c)
-
-	// Fill arrowhead
-	for t := 0.0; t <= 1.0; t += 0.05 {
-		mx := ax1 + (ax2-ax1)*t
-		my := ay1 + (ay2-ay1)*t
-		drawLine(ctx, last.X, last.Y, mx, my, c)
-	}
+	drawArrowhead(ctx, last.X, last.Y, tx/dist, ty/dist, c)
 }
 
 // addIntermediatePoints adds points between waypoints to ensure smoother curves.
@@ -1369,14 +1662,7 @@ func drawSplineWithArrow(ctx *renderContext, spline []Point, c color.Color) {
 	}
 
 	// Draw cubic Bézier segments
-	numSegments := (len(spline) - 1) / 3
-	for seg := 0; seg < numSegments; seg++ {
-		i := seg * 3
-		if i+3 >= len(spline) {
-			break
-		}
-		drawCubicBezier(ctx, spline[i], spline[i+1], spline[i+2], spline[i+3], c)
-	}
+	drawCubicSpline(ctx, spline, c)
 
 	// Draw arrowhead using tangent at end
 	tangent := EvaluateSplineTangent(spline, 1.0)
@@ -1387,25 +1673,7 @@ func drawSplineWithArrow(ctx *renderContext, spline []Point, c color.Color) {
 		return
 	}
 
-	nx := tangent.X / dist
-	ny := tangent.Y / dist
-
-	arrowLen := 8.0 * ctx.scale
-	arrowWidth := 4.0 * ctx.scale
-
-	ax1 := endPt.X - nx*arrowLen + ny*arrowWidth
-	ay1 := endPt.Y - ny*arrowLen - nx*arrowWidth
-	ax2 := endPt.X - nx*arrowLen - ny*arrowWidth
-	ay2 := endPt.Y - ny*arrowLen + nx*arrowWidth
-
-	drawLine(ctx, endPt.X, endPt.Y, ax1, ay1, c)
-	drawLine(ctx, endPt.X, endPt.Y, ax2, ay2, c)
-
-	for t := 0.0; t <= 1.0; t += 0.05 {
-		mx := ax1 + (ax2-ax1)*t
-		my := ay1 + (ay2-ay1)*t
-		drawLine(ctx, endPt.X, endPt.Y, mx, my, c)
-	}
+	drawArrowhead(ctx, endPt.X, endPt.Y, tangent.X/dist, tangent.Y/dist, c)
 }
 
 // drawBidiTransitionPNG draws bidirectional transition arrows and returns one label position.
@@ -1464,7 +1732,7 @@ func drawBidiTransitionPNG(ctx *renderContext, x1, y1, x2, y2 float64, fromDims,
 }
 
 // drawBidiTransitionPNGWithPlacer draws bidirectional arrows with collision-aware labels.
-func drawBidiTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fromDims, toDims [2]float64, label1, label2 string, placer *LabelPlacer) (float64, float64) {
+func drawBidiTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64, fromDims, toDims [2]float64, label1, label2 string, placer *LabelPlacer, ink1, ink2 color.Color) (float64, float64) {
 	dx := x2 - x1
 	dy := y2 - y1
 	dist := math.Sqrt(dx*dx + dy*dy)
@@ -1494,7 +1762,7 @@ func drawBidiTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64,
 	cx1 := (x1+x2)/2 + perpX*offset
 	cy1 := (y1+y2)/2 + perpY*offset
 
-	drawQuadBezierArrow(ctx, sx1, sy1, cx1, cy1, ex1, ey1, colorBlack)
+	drawQuadBezierArrow(ctx, sx1, sy1, cx1, cy1, ex1, ey1, ink1)
 
 	// Place first label with collision avoidance
 	labelW1 := float64(len(label1)) * ctx.fontSize * 0.6
@@ -1505,7 +1773,7 @@ func drawBidiTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64,
 		Point{perpX, perpY},
 		labelW1, labelH, gap,
 	)
-	drawTextCentered(ctx, int(labelPos1.X), int(labelPos1.Y), label1, colorBlack)
+	drawEdgeLabel(ctx, int(labelPos1.X), int(labelPos1.Y), label1, ink1)
 
 	// Second arrow (to -> from), curves the other way
 	sx2, sy2 := ellipseEdgePoint(x2, y2, toDims[0], toDims[1], -nx, -ny)
@@ -1519,7 +1787,7 @@ func drawBidiTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64,
 	cx2 := (x1+x2)/2 - perpX*offset
 	cy2 := (y1+y2)/2 - perpY*offset
 
-	drawQuadBezierArrow(ctx, sx2, sy2, cx2, cy2, ex2, ey2, colorBlack)
+	drawQuadBezierArrow(ctx, sx2, sy2, cx2, cy2, ex2, ey2, ink2)
 
 	// Place second label with collision avoidance
 	labelW2 := float64(len(label2)) * ctx.fontSize * 0.6
@@ -1528,11 +1796,137 @@ func drawBidiTransitionPNGWithPlacer(ctx *renderContext, x1, y1, x2, y2 float64,
 		Point{-perpX, -perpY},
 		labelW2, labelH, gap,
 	)
-	drawTextCentered(ctx, int(labelPos2.X), int(labelPos2.Y), label2, colorBlack)
+	drawEdgeLabel(ctx, int(labelPos2.X), int(labelPos2.Y), label2, ink2)
 
 	return labelPos1.X, labelPos1.Y
 }
 
+// pngArc is one transition drawn by drawParallelTransitionsPNG.
+type pngArc struct {
+	from, to string
+	label    string
+	ink      color.Color
+}
+
+// drawParallelTransitionsPNG draws each of arcs, all between the states
+// at p1 and p2 in either direction, as a curve of its own, as
+// drawParallelTransitions does for SVG. It returns where the labels went.
+func drawParallelTransitionsPNG(ctx *renderContext, p1, p2 [2]float64, dims1, dims2 [2]float64, arcs []pngArc, placer *LabelPlacer) []Point {
+	dx, dy := p2[0]-p1[0], p2[1]-p1[1]
+	dist := math.Hypot(dx, dy)
+	if dist < 1 {
+		return nil
+	}
+	nx, ny := dx/dist, dy/dist
+	perpX, perpY := -ny, nx
+	midX, midY := (p1[0]+p2[0])/2, (p1[1]+p2[1])/2
+	spacing := 9 * ctx.scale
+	from := arcs[0].from
+	var placed []Point
+	for i, a := range arcs {
+		bend := float64(ASCIIArcOffset(i, len(arcs))) * spacing
+		// A quadratic curve passes halfway to its control point.
+		cx, cy := midX+perpX*2*bend, midY+perpY*2*bend
+		x1, y1, d1, x2, y2, d2 := p1[0], p1[1], dims1, p2[0], p2[1], dims2
+		if a.from != from {
+			x1, y1, d1, x2, y2, d2 = x2, y2, d2, x1, y1, d1
+		}
+		ux, uy := unitTowards(x1, y1, cx, cy)
+		sx, sy := ellipseEdgePoint(x1, y1, d1[0], d1[1], ux, uy)
+		ux, uy = unitTowards(x2, y2, cx, cy)
+		ex, ey := ellipseEdgePoint(x2, y2, d2[0]+2*ctx.scale, d2[1]+2*ctx.scale, ux, uy)
+		drawQuadBezierArrow(ctx, sx, sy, cx, cy, ex, ey, a.ink)
+
+		side := 1.0
+		if bend < 0 {
+			side = -1
+		}
+		at, dir := parallelLabelAt(Point{p1[0], p1[1]}, Point{cx, cy}, Point{p2[0], p2[1]}, i, len(arcs))
+		labelW := float64(len(a.label)) * ctx.fontSize * 0.6
+		pos := placer.PlaceLabelOnCurve(at, Point{dir.X * side, dir.Y * side}, labelW, ctx.fontSize, 10*ctx.scale)
+		drawEdgeLabel(ctx, int(pos.X), int(pos.Y), a.label, a.ink)
+		placed = append(placed, pos)
+	}
+	return placed
+}
+
+// drawEdgeBundlePNG draws the transitions of b, one to a branch, as
+// drawEdgeBundle does for SVG. It returns where the labels went.
+func drawEdgeBundlePNG(ctx *renderContext, b EdgeBundle, pos map[string][2]float64, dims map[string][2]float64, branches []pngArc, placer *LabelPlacer) []Point {
+	to := pos[b.To]
+	trunkInk := color.Color(colorBlack)
+	var placed []Point
+	for _, a := range branches {
+		from, d := pos[a.from], dims[a.from]
+		c := bundleBranch(b, from, to)
+		ux, uy := unitTowards(from[0], from[1], c.X, c.Y)
+		sx, sy := ellipseEdgePoint(from[0], from[1], d[0], d[1], ux, uy)
+		drawQuadBezier(ctx, sx, sy, c.X, c.Y, b.Junction.X, b.Junction.Y, a.ink)
+
+		at, dir := quadAt(Point{sx, sy}, c, b.Junction, 0.4)
+		labelW := float64(len(a.label)) * ctx.fontSize * 0.6
+		p := placer.PlaceLabelOnCurve(at, dir, labelW, ctx.fontSize, 10*ctx.scale)
+		drawEdgeLabel(ctx, int(p.X), int(p.Y), a.label, a.ink)
+		placed = append(placed, p)
+		if a.ink != colorBlack {
+			trunkInk = a.ink
+		}
+	}
+	d := dims[b.To]
+	ux, uy := unitTowards(to[0], to[1], b.Junction.X, b.Junction.Y)
+	ex, ey := ellipseEdgePoint(to[0], to[1], d[0]+2*ctx.scale, d[1]+2*ctx.scale, ux, uy)
+	drawArrowLine(ctx, b.Junction.X, b.Junction.Y, ex, ey, trunkInk)
+	return placed
+}
+
+// unitTowards returns the unit vector from (x, y) towards (tx, ty).
+func unitTowards(x, y, tx, ty float64) (float64, float64) {
+	l := math.Hypot(tx-x, ty-y)
+	if l < 1e-9 {
+		return 1, 0
+	}
+	return (tx - x) / l, (ty - y) / l
+}
+
+// queuedLabel is a transition label waiting for drawEdgeLabels.
+type queuedLabel struct {
+	box  LabelBox
+	text string
+	ink  color.Color
+}
+
+// drawEdgeLabel draws a transition label centred at (x, y) or, if the
+// context defers labels, queues it for drawEdgeLabels.
+func drawEdgeLabel(ctx *renderContext, x, y int, text string, ink color.Color) {
+	if !ctx.deferLabels {
+		drawTextCentered(ctx, x, y, text, ink)
+		return
+	}
+	w := float64(font.MeasureString(ctx.face.canvas, text).Ceil())
+	h := float64(ctx.face.canvas.Metrics().Ascent.Ceil())
+	ctx.labels = append(ctx.labels, queuedLabel{NewLabelBox(float64(x), float64(y), w, h), text, ink})
+}
+
+// drawEdgeLabels separates the queued labels from each other and from
+// the obstacles (see SeparateLabels) and draws them, each with a leader
+// line back to its edge if it had to move far.
+func drawEdgeLabels(ctx *renderContext, obstacles []Rect, width, height float64) {
+	boxes := make([]LabelBox, len(ctx.labels))
+	for i, l := range ctx.labels {
+		boxes[i] = l.box
+	}
+	SeparateLabels(boxes, obstacles, width, height)
+	for i, l := range ctx.labels {
+		b := boxes[i]
+		if b.Displaced() {
+			from, to := b.Leader()
+			drawLine(ctx, from.X, from.Y, to.X, to.Y, colorGray)
+		}
+		drawTextCentered(ctx, int(math.Round(b.X)), int(math.Round(b.Y)), l.text, l.ink)
+	}
+	ctx.labels = nil
+}
+
 // labelBox represents a rectangular occupied region
 type labelBox struct {
 	x, y, w, h float64
@@ -1545,11 +1939,11 @@ func boxesOverlap(x1, y1, w1, h1, x2, y2, w2, h2 float64) bool {
 }
 
 // drawSelfLoopPNG draws a self-loop using the unified 7-point Bézier approach.
-func drawSelfLoopPNG(ctx *renderContext, x, y, rx, ry float64, label string, occupiedBoxes []labelBox, graphCentreY, canvasW, canvasH float64) {
+func drawSelfLoopPNG(ctx *renderContext, x, y, rx, ry float64, label string, occupiedBoxes []labelBox, around *LoopSurroundings, canvasW, canvasH float64, ink color.Color) {
 	state := Ellipse{CX: x, CY: y, RX: rx, RY: ry}
 
 	// Choose the best side for the loop
-	side := ChooseSelfLoopSide(state, canvasW, canvasH, nil)
+	side := ChooseSelfLoopSide(state, canvasW, canvasH, around)
 
 	params := DefaultSelfLoopParams()
 	params.Side = side
@@ -1577,9 +1971,10 @@ func drawSelfLoopPNG(ctx *renderContext, x, y, rx, ry float64, label string, occ
 		}
 	}
 
+	ctx.log.Debug("png self-loop", "at", Point{x, y}, "side", params.Side.String())
+
 	// Draw the two cubic Bézier segments
-	drawCubicBezier(ctx, points[0], points[1], points[2], points[3], colorBlack)
-	drawCubicBezier(ctx, points[3], points[4], points[5], points[6], colorBlack)
+	drawCubicSpline(ctx, points, ink)
 
 	// Draw arrowhead at P6
 	// Tangent direction at end: derivative of cubic Bézier at t=1
@@ -1592,21 +1987,7 @@ func drawSelfLoopPNG(ctx *renderContext, x, y, rx, ry float64, label string, occ
 		ty /= dist
 	}
 
-	arrowLen := 8.0 * ctx.scale
-	arrowWidth := 4.0 * ctx.scale
-
-	ax1 := points[6].X - tx*arrowLen + ty*arrowWidth
-	ay1 := points[6].Y - ty*arrowLen - tx*arrowWidth
-	ax2 := points[6].X - tx*arrowLen - ty*arrowWidth
-	ay2 := points[6].Y - ty*arrowLen + tx*arrowWidth
-
-	drawLine(ctx, points[6].X, points[6].Y, ax1, ay1, colorBlack)
-	drawLine(ctx, points[6].X, points[6].Y, ax2, ay2, colorBlack)
-	for t := 0.0; t <= 1.0; t += 0.05 {
-		mx := ax1 + (ax2-ax1)*t
-		my := ay1 + (ay2-ay1)*t
-		drawLine(ctx, points[6].X, points[6].Y, mx, my, colorBlack)
-	}
+	drawArrowhead(ctx, points[6].X, points[6].Y, tx, ty, ink)
 
 	// Label placement with collision avoidance
 	labelW := float64(len(label)) * ctx.fontSize * 0.6
@@ -1650,7 +2031,7 @@ func drawSelfLoopPNG(ctx *renderContext, x, y, rx, ry float64, label string, occ
 		}
 	}
 
-	drawTextCentered(ctx, int(bestX), int(bestY), label, colorBlack)
+	drawEdgeLabel(ctx, int(bestX), int(bestY), label, ink)
 }
 
 // SortedStates returns states in a deterministic order.
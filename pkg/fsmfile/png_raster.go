@@ -0,0 +1,255 @@
+package fsmfile
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/image/vector"
+)
+
+// Anti-aliased drawing for the PNG renderer. Every line, curve, ellipse,
+// and arrowhead is built as polygons in canvas coordinates, the outlines a
+// vector backend would emit as paths, and filled with the rasterizer from
+// golang.org/x/image/vector straight at the resolution of the image, which
+// works out how much of each pixel a polygon covers. This replaces drawing
+// pixel by pixel at four times the size and scaling down.
+
+// piece is one or more closed polygons filled together. Coverage adds up
+// with the direction of travel, so a polygon going the other way round
+// inside another cuts a hole in it, as the inside of a ring.
+type piece [][]Point
+
+// shape is pieces drawn together in one colour. Where pieces overlap,
+// each pixel takes the coverage of the piece that covers it most, so
+// their shared edges do not come out darker than either piece.
+type shape []piece
+
+// fillShape draws s in c. Points are in canvas coordinates; ctx.zoom
+// takes them to pixels.
+func fillShape(ctx *renderContext, s shape, c color.Color) {
+	if len(s) == 0 || c == color.Transparent {
+		return
+	}
+	var bounds image.Rectangle
+	rects := make([]image.Rectangle, len(s))
+	for i, p := range s {
+		rects[i] = pieceBounds(p, ctx.zoom).Intersect(ctx.img.Bounds())
+		bounds = bounds.Union(rects[i])
+	}
+	if bounds.Empty() {
+		return
+	}
+
+	var cover *image.Alpha
+	for i, p := range s {
+		r := rects[i]
+		if r.Empty() {
+			continue
+		}
+		mask := ctx.scratchMask(r)
+		ctx.coverPiece(p, mask)
+		if len(s) == 1 {
+			// A single piece needs no union.
+			cover = mask
+			break
+		}
+		if cover == nil {
+			cover = image.NewAlpha(bounds)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row := cover.Pix[cover.PixOffset(r.Min.X, y):]
+			mrow := mask.Pix[mask.PixOffset(r.Min.X, y):]
+			for x := 0; x < r.Dx(); x++ {
+				if mrow[x] > row[x] {
+					row[x] = mrow[x]
+				}
+			}
+		}
+	}
+	draw.DrawMask(ctx.img, bounds, image.NewUniform(c), image.Point{}, cover, bounds.Min, draw.Over)
+}
+
+// pieceBounds returns the pixels p touches at the given zoom.
+func pieceBounds(p piece, zoom float64) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, poly := range p {
+		for _, pt := range poly {
+			x, y := pt.X*zoom, pt.Y*zoom
+			minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+			minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		}
+	}
+	if minX > maxX {
+		return image.Rectangle{}
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)),
+		int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1)
+}
+
+// rasterBlock is the largest block the rasterizer covers at once. Up to
+// this size it works in fixed point, on a grid of rasterGrid steps per
+// pixel; points are rounded to the grid, so a pixel's coverage barely
+// depends on where the block starts, and a Viewport, which cuts pieces
+// off at its edges, gets the pixels of the full image to within one
+// level of each channel.
+const (
+	rasterBlock = 512
+	rasterGrid  = 512
+)
+
+// coverPiece sets each pixel of mask to how much of it p covers.
+func (ctx *renderContext) coverPiece(p piece, mask *image.Alpha) {
+	if ctx.raster == nil {
+		ctx.raster = vector.NewRasterizer(rasterBlock, rasterBlock)
+	}
+	r := mask.Rect
+	for y := r.Min.Y; y < r.Max.Y; y += rasterBlock {
+		for x := r.Min.X; x < r.Max.X; x += rasterBlock {
+			b := image.Rect(x, y, x+rasterBlock, y+rasterBlock).Intersect(r)
+			ctx.raster.Reset(b.Dx(), b.Dy())
+			ox, oy := float64(b.Min.X), float64(b.Min.Y)
+			for _, poly := range p {
+				if len(poly) < 3 {
+					continue
+				}
+				for i, pt := range poly {
+					px := float32(math.Round(pt.X*ctx.zoom*rasterGrid)/rasterGrid - ox)
+					py := float32(math.Round(pt.Y*ctx.zoom*rasterGrid)/rasterGrid - oy)
+					if i == 0 {
+						ctx.raster.MoveTo(px, py)
+					} else {
+						ctx.raster.LineTo(px, py)
+					}
+				}
+				ctx.raster.ClosePath()
+			}
+			ctx.raster.DrawOp = draw.Src
+			ctx.raster.Draw(mask, b, image.Opaque, image.Point{})
+		}
+	}
+}
+
+// scratchMask returns a mask covering r, reusing the context's buffer.
+func (ctx *renderContext) scratchMask(r image.Rectangle) *image.Alpha {
+	n := r.Dx() * r.Dy()
+	if cap(ctx.scratch) < n {
+		ctx.scratch = make([]uint8, n)
+	}
+	return &image.Alpha{Pix: ctx.scratch[:n], Stride: r.Dx(), Rect: r}
+}
+
+// strokeShape returns the outline of a line of the given width along
+// pts: one polygon, offset half the width to either side of the line,
+// with mitred corners.
+func strokeShape(pts []Point, width float64) shape {
+	// Repeated points have no direction to offset from.
+	line := make([]Point, 0, len(pts))
+	for _, p := range pts {
+		if len(line) == 0 || math.Hypot(p.X-line[len(line)-1].X, p.Y-line[len(line)-1].Y) > 1e-9 {
+			line = append(line, p)
+		}
+	}
+	n := len(line)
+	if n < 2 {
+		return nil
+	}
+	half := width / 2
+	normal := func(a, b Point) Point {
+		l := math.Hypot(b.X-a.X, b.Y-a.Y)
+		return Point{-(b.Y - a.Y) / l, (b.X - a.X) / l}
+	}
+	outline := make([]Point, 2*n)
+	for i, p := range line {
+		var m Point
+		switch i {
+		case 0:
+			m = normal(line[0], line[1])
+		case n - 1:
+			m = normal(line[n-2], line[n-1])
+		default:
+			// The mitre runs along the mean of the two normals, longer as
+			// the line turns more, up to twice the width for sharp turns.
+			n1, n2 := normal(line[i-1], p), normal(p, line[i+1])
+			m = Point{n1.X + n2.X, n1.Y + n2.Y}
+			dot := m.X*n1.X + m.Y*n1.Y
+			if dot < 0.25 {
+				dot = 0.25
+			}
+			m = Point{m.X / dot, m.Y / dot}
+		}
+		outline[i] = Point{p.X + m.X*half, p.Y + m.Y*half}
+		outline[2*n-1-i] = Point{p.X - m.X*half, p.Y - m.Y*half}
+	}
+	return shape{{outline}}
+}
+
+// ellipsePoints returns points along the ellipse with centre (cx, cy) and
+// radii rx and ry, from angle a0 to a1, close enough together that the
+// polygon through them looks curved at any zoom the renderer uses.
+func ellipsePoints(cx, cy, rx, ry, a0, a1 float64) []Point {
+	// About one point per two canvas units of arc, where the renderer
+	// lays out at four times the size it draws at.
+	steps := int(math.Abs(a1-a0) * math.Max(rx, ry) / 2)
+	if steps < 12 {
+		steps = 12
+	}
+	pts := make([]Point, steps+1)
+	for i := range pts {
+		a := a0 + (a1-a0)*float64(i)/float64(steps)
+		pts[i] = Point{cx + rx*math.Cos(a), cy + ry*math.Sin(a)}
+	}
+	return pts
+}
+
+// arcPiece returns the band of the given width along the ellipse from
+// angle a0 to a1: a ring if the angles go all the way round.
+func arcPiece(cx, cy, rx, ry, width, a0, a1 float64) piece {
+	half := width / 2
+	outer := ellipsePoints(cx, cy, rx+half, ry+half, a0, a1)
+	inner := ellipsePoints(cx, cy, math.Max(rx-half, 0), math.Max(ry-half, 0), a1, a0)
+	if a1-a0 >= 2*math.Pi {
+		// A full ring: the inner edge runs the other way round, a hole.
+		return piece{outer, inner}
+	}
+	return piece{append(outer, inner...)}
+}
+
+// arrowheadShape returns a filled arrowhead with its tip at (x, y),
+// pointing along the unit vector (nx, ny), with edges as thick as lines:
+// the triangle grown by half the line width, its corners rounded.
+func arrowheadShape(ctx *renderContext, x, y, nx, ny float64) shape {
+	arrowLen := 8.0 * ctx.scale
+	arrowWidth := 4.0 * ctx.scale
+	tri := []Point{
+		{x, y},
+		{x - nx*arrowLen + ny*arrowWidth, y - ny*arrowLen - nx*arrowWidth},
+		{x - nx*arrowLen - ny*arrowWidth, y - ny*arrowLen + nx*arrowWidth},
+	}
+	cx, cy := (tri[0].X+tri[1].X+tri[2].X)/3, (tri[0].Y+tri[1].Y+tri[2].Y)/3
+	// outward returns the angle of the normal of edge a→b that points
+	// away from the middle of the triangle.
+	outward := func(a, b Point) float64 {
+		ex, ey := -(b.Y - a.Y), b.X-a.X
+		if ex*((a.X+b.X)/2-cx)+ey*((a.Y+b.Y)/2-cy) < 0 {
+			ex, ey = -ex, -ey
+		}
+		return math.Atan2(ey, ex)
+	}
+	half := ctx.lineWidth / 2
+	var outline []Point
+	for i, p := range tri {
+		a0 := outward(tri[(i+2)%3], p)
+		turn := math.Remainder(outward(p, tri[(i+1)%3])-a0, 2*math.Pi)
+		outline = append(outline, ellipsePoints(p.X, p.Y, half, half, a0, a0+turn)...)
+	}
+	return shape{{outline}}
+}
+
+// drawArrowhead draws an arrowhead with its tip at (x, y), pointing along
+// the unit vector (nx, ny).
+func drawArrowhead(ctx *renderContext, x, y, nx, ny float64, c color.Color) {
+	fillShape(ctx, arrowheadShape(ctx, x, y, nx, ny), c)
+}
@@ -0,0 +1,84 @@
+package fsmfile
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// rasterTestContext returns a context drawing at the size of the canvas
+// on a white w×h image.
+func rasterTestContext(w, h int) *renderContext {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return newRenderContext(img, 1, 1, DefaultPNGOptions())
+}
+
+func TestDrawLineAntialiased(t *testing.T) {
+	ctx := rasterTestContext(40, 40)
+	drawLine(ctx, 5, 5, 35, 20, colorBlack)
+	partial := 0
+	for _, v := range ctx.img.Pix {
+		if v != 0xff && v > colorBlack.R {
+			partial++
+		}
+	}
+	if partial == 0 {
+		t.Error("sloping line has no partly covered pixels")
+	}
+}
+
+func TestStrokeShapeJoinsInvisible(t *testing.T) {
+	// A curve is drawn as many short segments; where they meet must look
+	// no different from a line drawn in one piece.
+	whole := rasterTestContext(60, 20)
+	fillShape(whole, strokeShape([]Point{{5, 10.3}, {55, 10.3}}, 2), colorBlack)
+	split := rasterTestContext(60, 20)
+	var pts []Point
+	for x := 5.0; x <= 55; x += 2.5 {
+		pts = append(pts, Point{x, 10.3})
+	}
+	fillShape(split, strokeShape(pts, 2), colorBlack)
+	for i := range whole.img.Pix {
+		if d := int(whole.img.Pix[i]) - int(split.img.Pix[i]); d > 1 || d < -1 {
+			t.Fatalf("byte %d: %d in one piece, %d in segments", i, whole.img.Pix[i], split.img.Pix[i])
+		}
+	}
+}
+
+func TestDrawEllipseOutline(t *testing.T) {
+	ctx := rasterTestContext(60, 40)
+	drawEllipse(ctx, 30, 20, 20, 10, color.Transparent, colorBlack)
+	if c := ctx.img.RGBAAt(30, 20); c != colorWhite {
+		t.Errorf("centre of unfilled ellipse is %v", c)
+	}
+	if c := ctx.img.RGBAAt(50, 20); c == colorWhite {
+		t.Error("no outline at the right of the ellipse")
+	}
+
+	drawEllipse(ctx, 30, 20, 20, 10, colorInitial, colorBlack)
+	if c := ctx.img.RGBAAt(30, 20); c != colorInitial {
+		t.Errorf("centre of filled ellipse is %v, want %v", c, colorInitial)
+	}
+}
+
+func TestDrawDashedEllipse(t *testing.T) {
+	ctx := rasterTestContext(100, 100)
+	drawDashedEllipse(ctx, 50, 50, 40, 40, colorBlack)
+	inked, blank := 0, 0
+	for a := 0; a < 360; a++ {
+		rad := float64(a) * math.Pi / 180
+		x, y := 50+40*math.Cos(rad), 50+40*math.Sin(rad)
+		if ctx.img.RGBAAt(int(x), int(y)) == colorWhite {
+			blank++
+		} else {
+			inked++
+		}
+	}
+	if inked == 0 || blank == 0 {
+		t.Errorf("dashed outline: %d degrees inked, %d blank", inked, blank)
+	}
+}
@@ -0,0 +1,169 @@
+package fsmfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/font"
+)
+
+func TestRenderImageScale(t *testing.T) {
+	opts := DefaultPNGOptions()
+	opts.Width, opts.Height = 400, 300
+	opts.Scale = 2
+	if b := RenderImage(highlightTestFSM(), opts).Bounds(); b != image.Rect(0, 0, 800, 600) {
+		t.Errorf("scale 2: bounds %v, want 800x600", b)
+	}
+	opts.Scale = 1.5
+	opts.Viewport = image.Rect(0, 0, 200, 100)
+	if b := RenderImage(highlightTestFSM(), opts).Bounds(); b != image.Rect(0, 0, 300, 150) {
+		t.Errorf("scale 1.5 with viewport: bounds %v, want 300x150", b)
+	}
+	opts.Scale = 10
+	opts.Viewport = image.Rectangle{}
+	if b := RenderImage(highlightTestFSM(), opts).Bounds(); b.Dx() != 400*pngMaxScale {
+		t.Errorf("scale 10: bounds %v, want the scale limit", b)
+	}
+}
+
+func TestRenderImageTransparent(t *testing.T) {
+	opts := DefaultPNGOptions()
+	opts.Width, opts.Height = 400, 300
+	if c := RenderImage(highlightTestFSM(), opts).RGBAAt(1, 1); c.A != 255 {
+		t.Errorf("default background %v, want opaque", c)
+	}
+	opts.Transparent = true
+	img := RenderImage(highlightTestFSM(), opts)
+	if c := img.RGBAAt(1, 1); c.A != 0 {
+		t.Errorf("transparent background %v, want alpha 0", c)
+	}
+	// States are still filled.
+	opaque := 0
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			if img.RGBAAt(x, y).A == 255 {
+				opaque++
+			}
+		}
+	}
+	if opaque == 0 {
+		t.Error("transparent image has nothing drawn on it")
+	}
+}
+
+func TestEncodePNGDPI(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	var buf bytes.Buffer
+	if err := EncodePNG(&buf, img, 300); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	i := bytes.Index(data, []byte("pHYs"))
+	if i < 0 {
+		t.Fatal("no pHYs chunk")
+	}
+	// 300 dpi is 11811 pixels per metre.
+	if x, y, unit := binary.BigEndian.Uint32(data[i+4:]), binary.BigEndian.Uint32(data[i+8:]), data[i+12]; x != 11811 || y != 11811 || unit != 1 {
+		t.Errorf("pHYs = %d x %d per unit %d, want 11811 per metre", x, y, unit)
+	}
+	// Decoding checks the chunk's CRC.
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds() != img.Bounds() {
+		t.Errorf("decoded bounds %v", decoded.Bounds())
+	}
+
+	buf.Reset()
+	if err := EncodePNG(&buf, img, 0); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("pHYs")) {
+		t.Error("pHYs chunk written without a DPI")
+	}
+}
+
+func TestPNGFontByName(t *testing.T) {
+	for _, name := range PNGFontNames() {
+		if _, ok := PNGFontByName(name); !ok {
+			t.Errorf("PNGFontByName(%q) not found", name)
+		}
+	}
+	if f, ok := PNGFontByName(""); !ok || f != PNGFontRegular {
+		t.Errorf(`PNGFontByName("") = %q, %v`, f, ok)
+	}
+	if _, ok := PNGFontByName("serif"); ok {
+		t.Error("unknown font accepted")
+	}
+}
+
+func TestPNGFaces(t *testing.T) {
+	width := func(fnt PNGFont, style TextStyle, s string) int {
+		return font.MeasureString(pngFace(fnt, style, 14), s).Round()
+	}
+	if width(PNGFontMono, TextPlain, "iiii") != width(PNGFontMono, TextPlain, "mmmm") {
+		t.Error("mono font is not fixed width")
+	}
+	if width(PNGFontRegular, TextPlain, "iiii") == width(PNGFontRegular, TextPlain, "mmmm") {
+		t.Error("regular font is fixed width")
+	}
+	if width(PNGFontRegular, TextBold, "state") <= width(PNGFontRegular, TextPlain, "state") {
+		t.Error("bold text is no wider than plain")
+	}
+	if width(PNGFontBold, TextPlain, "state") != width(PNGFontRegular, TextBold, "state") {
+		t.Error("bold font's plain style is not bold")
+	}
+	if width("serif", TextPlain, "state") != width(PNGFontRegular, TextPlain, "state") {
+		t.Error("unknown font does not fall back to regular")
+	}
+}
+
+func TestRenderImageTitleStyle(t *testing.T) {
+	opts := DefaultPNGOptions()
+	opts.Width, opts.Height = 400, 300
+	opts.Title = "Turnstile"
+	bold := RenderImage(highlightTestFSM(), opts)
+	opts.TitleStyle = TextPlain
+	plain := RenderImage(highlightTestFSM(), opts)
+
+	// The title is drawn in the top band; below it the images match.
+	differs := func(y0, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < 400; x++ {
+				if bold.RGBAAt(x, y) != plain.RGBAAt(x, y) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if !differs(0, 40) {
+		t.Error("title looks the same bold and plain")
+	}
+	if differs(40, 300) {
+		t.Error("title style changed more than the title")
+	}
+}
+
+func TestRenderImageSeparateEdges(t *testing.T) {
+	f := highlightTestFSM()
+	opts := DefaultPNGOptions()
+	opts.Width, opts.Height = 400, 300
+	joined := RenderImage(f, opts)
+	opts.SeparateEdges = true
+	if !bytes.Equal(RenderImage(f, opts).Pix, joined.Pix) {
+		t.Error("SeparateEdges changed a machine with one transition per pair")
+	}
+
+	f.AddTransition("a", strp("y"), []string{"b"}, nil)
+	opts.SeparateEdges = false
+	joined = RenderImage(f, opts)
+	opts.SeparateEdges = true
+	if bytes.Equal(RenderImage(f, opts).Pix, joined.Pix) {
+		t.Error("SeparateEdges made no difference to two transitions a to b")
+	}
+}
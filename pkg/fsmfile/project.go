@@ -0,0 +1,346 @@
+package fsmfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProjectExt is the file extension of project manifests.
+const ProjectExt = ".fsmproj"
+
+// Project is a manifest grouping several machine files with the code and
+// diagrams built from them, read from a .fsmproj file. Paths are relative
+// to the directory holding the manifest.
+type Project struct {
+	Name      string
+	OutputDir string              // where outputs are written (default ".")
+	Alphabets map[string][]string // shared input alphabets by name
+	Machines  []ProjectMachine
+	Generate  []GenerateTarget
+	Render    []RenderTarget
+}
+
+// ProjectMachine is a [[machine]] entry.
+type ProjectMachine struct {
+	Name     string // default: the file name without its extension
+	File     string
+	Machine  string // machine to select from a bundle
+	Alphabet string // shared alphabet the machine's inputs must come from
+}
+
+// GenerateTarget is a [[generate]] entry: code for some or all machines.
+type GenerateTarget struct {
+	Lang     string
+	Package  string
+	Output   string   // file name pattern; {name} is the machine's name
+	Machines []string // default: every machine
+	Options  []string // further fsm generate flags
+}
+
+// RenderTarget is a [[render]] entry: diagrams for some or all machines.
+type RenderTarget struct {
+	Format   string // png or svg
+	Renderer string
+	Theme    string
+	Output   string
+	Machines []string
+	Options  []string // further fsm png or fsm svg flags
+}
+
+// codeExt gives the default output extension of each generate language.
+var codeExt = map[string]string{"c": ".h", "rust": ".rs", "go": ".go", "tinygo": ".go"}
+
+// ParseProject parses .fsmproj content:
+//
+//	name = "controllers"
+//	output_dir = "build"
+//
+//	[alphabets]
+//	buttons = ["press", "release", "hold"]
+//
+//	[[machine]]
+//	file = "machines/door.fsm"
+//	alphabet = "buttons"
+//
+//	[[machine]]
+//	name = "lift"
+//	file = "machines/system.fsm"
+//	machine = "lift"              # from a bundle
+//
+//	[[generate]]
+//	lang = "c"
+//	output = "include/{name}.h"   # default {name}.h, .rs, or .go
+//	options = ["--misra"]
+//
+//	[[render]]
+//	format = "svg"
+//	renderer = "native"
+//	theme = "dark"
+//	machines = ["door"]           # default: every machine
+//
+// Unknown sections and keys are errors, as are targets naming machines,
+// alphabets, languages, formats, renderers, or themes that do not exist.
+func ParseProject(text string) (*Project, error) {
+	p := &Project{Alphabets: make(map[string][]string)}
+
+	var section string
+	for n, line := range strings.Split(text, "\n") {
+		lineNo := n + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "]]") {
+			section = line[2 : len(line)-2]
+			switch section {
+			case "machine":
+				p.Machines = append(p.Machines, ProjectMachine{})
+			case "generate":
+				p.Generate = append(p.Generate, GenerateTarget{})
+			case "render":
+				p.Render = append(p.Render, RenderTarget{})
+			default:
+				return nil, fmt.Errorf("line %d: unknown section [[%s]]", lineNo, section)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			if section != "alphabets" {
+				return nil, fmt.Errorf("line %d: unknown section [%s]", lineNo, section)
+			}
+			continue
+		}
+
+		key, value, ok := tomlKeyValue(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		list := func(p *[]string) error {
+			items, err := parseTOMLStrings(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %v", lineNo, key, err)
+			}
+			*p = items
+			return nil
+		}
+
+		var err error
+		switch section {
+		case "":
+			switch key {
+			case "name":
+				p.Name = value
+			case "output_dir":
+				p.OutputDir = value
+			default:
+				err = fmt.Errorf("line %d: unknown key %q", lineNo, key)
+			}
+		case "alphabets":
+			var symbols []string
+			err = list(&symbols)
+			p.Alphabets[key] = symbols
+		case "machine":
+			m := &p.Machines[len(p.Machines)-1]
+			switch key {
+			case "name":
+				m.Name = value
+			case "file":
+				m.File = value
+			case "machine":
+				m.Machine = value
+			case "alphabet":
+				m.Alphabet = value
+			default:
+				err = fmt.Errorf("line %d: unknown key %q in [[machine]]", lineNo, key)
+			}
+		case "generate":
+			g := &p.Generate[len(p.Generate)-1]
+			switch key {
+			case "lang":
+				g.Lang = strings.ToLower(value)
+			case "package":
+				g.Package = value
+			case "output":
+				g.Output = value
+			case "machines":
+				err = list(&g.Machines)
+			case "options":
+				err = list(&g.Options)
+			default:
+				err = fmt.Errorf("line %d: unknown key %q in [[generate]]", lineNo, key)
+			}
+		case "render":
+			r := &p.Render[len(p.Render)-1]
+			switch key {
+			case "format":
+				r.Format = strings.ToLower(value)
+			case "renderer":
+				r.Renderer = strings.ToLower(value)
+			case "theme":
+				r.Theme = value
+			case "output":
+				r.Output = value
+			case "machines":
+				err = list(&r.Machines)
+			case "options":
+				err = list(&r.Options)
+			default:
+				err = fmt.Errorf("line %d: unknown key %q in [[render]]", lineNo, key)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// check fills in default machine names and reports entries that refer to
+// things that do not exist.
+func (p *Project) check() error {
+	if len(p.Machines) == 0 {
+		return fmt.Errorf("no [[machine]] entries")
+	}
+	names := make(map[string]bool)
+	for i := range p.Machines {
+		m := &p.Machines[i]
+		if m.File == "" {
+			return fmt.Errorf("machine %d has no file", i+1)
+		}
+		if m.Name == "" {
+			m.Name = strings.TrimSuffix(filepath.Base(m.File), filepath.Ext(m.File))
+		}
+		if names[m.Name] {
+			return fmt.Errorf("two machines are named %q; give one a name", m.Name)
+		}
+		names[m.Name] = true
+		if _, ok := p.Alphabets[m.Alphabet]; m.Alphabet != "" && !ok {
+			return fmt.Errorf("machine %q: unknown alphabet %q", m.Name, m.Alphabet)
+		}
+	}
+	selects := func(what string, machines []string) error {
+		for _, name := range machines {
+			if !names[name] {
+				return fmt.Errorf("%s: unknown machine %q", what, name)
+			}
+		}
+		return nil
+	}
+
+	for i, g := range p.Generate {
+		what := fmt.Sprintf("generate target %d", i+1)
+		if _, ok := codeExt[g.Lang]; !ok {
+			return fmt.Errorf("%s: unknown language %q (use c, rust, go, or tinygo)", what, g.Lang)
+		}
+		if err := selects(what, g.Machines); err != nil {
+			return err
+		}
+	}
+	for i, r := range p.Render {
+		what := fmt.Sprintf("render target %d", i+1)
+		if r.Format != "png" && r.Format != "svg" {
+			return fmt.Errorf("%s: unknown format %q (use png or svg)", what, r.Format)
+		}
+		if r.Renderer != "" && r.Renderer != "native" && r.Renderer != "graphviz" {
+			return fmt.Errorf("%s: unknown renderer %q (use native or graphviz)", what, r.Renderer)
+		}
+		if r.Theme != "" && r.Format != "svg" {
+			return fmt.Errorf("%s: theme applies to svg only", what)
+		}
+		if _, ok := ThemeByName(r.Theme); r.Theme != "" && !ok {
+			return fmt.Errorf("%s: unknown theme %q (available: %s)", what, r.Theme, strings.Join(ThemeNames(), ", "))
+		}
+		if err := selects(what, r.Machines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Select returns the machines with the given names, in that order, or
+// every machine if names is empty.
+func (p *Project) Select(names []string) []ProjectMachine {
+	if len(names) == 0 {
+		return p.Machines
+	}
+	var out []ProjectMachine
+	for _, name := range names {
+		for _, m := range p.Machines {
+			if m.Name == name {
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+// OutputPath returns where the target writes its code for m: the output
+// pattern with {name} replaced, or the machine's name with the language's
+// extension, inside the project's output directory.
+func (g GenerateTarget) OutputPath(p *Project, m ProjectMachine) string {
+	pattern := g.Output
+	if pattern == "" {
+		pattern = "{name}" + codeExt[g.Lang]
+	}
+	return filepath.Join(p.OutputDir, strings.ReplaceAll(pattern, "{name}", m.Name))
+}
+
+// OutputPath returns where the target writes its diagram of m.
+func (r RenderTarget) OutputPath(p *Project, m ProjectMachine) string {
+	pattern := r.Output
+	if pattern == "" {
+		pattern = "{name}." + r.Format
+	}
+	return filepath.Join(p.OutputDir, strings.ReplaceAll(pattern, "{name}", m.Name))
+}
+
+// LoadProject reads and parses a project manifest.
+func LoadProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParseProject(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// parseTOMLStrings parses a one-line array of quoted strings, such as
+// ["press", 'release'].
+func parseTOMLStrings(value string) ([]string, error) {
+	if len(value) < 2 || value[0] != '[' || value[len(value)-1] != ']' {
+		return nil, fmt.Errorf("expected an array of strings, such as [\"a\", \"b\"]")
+	}
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	items := []string{}
+	for rest != "" {
+		q := rest[0]
+		if q != '"' && q != '\'' {
+			return nil, fmt.Errorf("array items must be quoted strings")
+		}
+		end := strings.IndexByte(rest[1:], q)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		items = append(items, rest[1:end+1])
+		rest = strings.TrimSpace(rest[end+2:])
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("expected a comma between array items")
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+	return items, nil
+}
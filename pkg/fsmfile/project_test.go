@@ -0,0 +1,103 @@
+package fsmfile
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testProject = `
+name = "controllers"
+output_dir = "build"
+
+[alphabets]
+buttons = ["press", 'release', "hold"]   # shared by the panels
+
+[[machine]]
+file = "machines/door.fsm"
+alphabet = "buttons"
+
+[[machine]]
+name = "lift"
+file = "machines/system.fsm"
+machine = "lift"
+
+[[generate]]
+lang = "C"
+options = ["--misra", "--prefix", "ctl"]
+
+[[generate]]
+lang = "go"
+package = "machines"
+output = "go/{name}_fsm.go"
+machines = ["lift"]
+
+[[render]]
+format = "svg"
+renderer = "native"
+theme = "dark"
+`
+
+func TestParseProject(t *testing.T) {
+	p, err := ParseProject(testProject)
+	if err != nil {
+		t.Fatalf("ParseProject: %v", err)
+	}
+	if p.Name != "controllers" || p.OutputDir != "build" {
+		t.Errorf("name, output_dir = %q, %q", p.Name, p.OutputDir)
+	}
+	if got := p.Alphabets["buttons"]; !reflect.DeepEqual(got, []string{"press", "release", "hold"}) {
+		t.Errorf("buttons = %q", got)
+	}
+	want := []ProjectMachine{
+		{Name: "door", File: "machines/door.fsm", Alphabet: "buttons"},
+		{Name: "lift", File: "machines/system.fsm", Machine: "lift"},
+	}
+	if !reflect.DeepEqual(p.Machines, want) {
+		t.Errorf("machines = %+v, want %+v", p.Machines, want)
+	}
+	if len(p.Generate) != 2 || len(p.Render) != 1 {
+		t.Fatalf("%d generate and %d render targets, want 2 and 1", len(p.Generate), len(p.Render))
+	}
+	if g := p.Generate[0]; g.Lang != "c" || !reflect.DeepEqual(g.Options, []string{"--misra", "--prefix", "ctl"}) {
+		t.Errorf("generate[0] = %+v", g)
+	}
+
+	door, lift := p.Machines[0], p.Machines[1]
+	if got := p.Generate[0].OutputPath(p, door); got != filepath.Join("build", "door.h") {
+		t.Errorf("default C output = %q", got)
+	}
+	if got := p.Generate[1].OutputPath(p, lift); got != filepath.Join("build", "go", "lift_fsm.go") {
+		t.Errorf("patterned Go output = %q", got)
+	}
+	if got := p.Render[0].OutputPath(p, lift); got != filepath.Join("build", "lift.svg") {
+		t.Errorf("default SVG output = %q", got)
+	}
+	if got := p.Select(p.Generate[1].Machines); len(got) != 1 || got[0].Name != "lift" {
+		t.Errorf("Select([lift]) = %+v", got)
+	}
+	if got := p.Select(nil); len(got) != 2 {
+		t.Errorf("Select(nil) returned %d machines, want 2", len(got))
+	}
+}
+
+func TestParseProject_Errors(t *testing.T) {
+	for _, text := range []string{
+		``,
+		"[[machine]]\nname = \"x\"",
+		"[[machine]]\nfile = \"a/x.fsm\"\n[[machine]]\nfile = \"b/x.json\"",
+		"[[machine]]\nfile = \"x.fsm\"\nalphabet = \"nope\"",
+		"[[machine]]\nfile = \"x.fsm\"\n[[generate]]\nlang = \"java\"",
+		"[[machine]]\nfile = \"x.fsm\"\n[[generate]]\nlang = \"c\"\nmachines = [\"y\"]",
+		"[[machine]]\nfile = \"x.fsm\"\n[[render]]\nformat = \"gif\"",
+		"[[machine]]\nfile = \"x.fsm\"\n[[render]]\nformat = \"png\"\ntheme = \"dark\"",
+		"[[machine]]\nfile = \"x.fsm\"\n[[render]]\nformat = \"svg\"\nmachines = \"x\"",
+		"[[machine]]\nfile = \"x.fsm\"\ncolour = \"red\"",
+		"[[target]]\n",
+		"[alphabets]\nbuttons = [\"a\" \"b\"]",
+	} {
+		if _, err := ParseProject(text); err == nil {
+			t.Errorf("expected error for %q", text)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package fsmfile
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+//go:embed report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// ReportOptions configures GenerateMarkdownReport and GenerateHTMLReport.
+type ReportOptions struct {
+	Title string     // document heading (default: machine name)
+	SVG   SVGOptions // diagram options
+
+	// DiagramPath, if set, makes a Markdown report link the diagram at
+	// this path instead of embedding the SVG, for renderers (such as
+	// GitHub's) that strip inline SVG. The caller writes the file.
+	DiagramPath string
+
+	// Mermaid makes a Markdown report draw the diagram as a Mermaid code
+	// block (see GenerateMermaid), which such renderers do draw, rather
+	// than as SVG. HTML reports always use SVG.
+	Mermaid bool
+}
+
+// DefaultReportOptions returns the default SVG options and no title.
+func DefaultReportOptions() ReportOptions {
+	return ReportOptions{SVG: DefaultSVGOptions()}
+}
+
+// reportTable is a table of a report, with one string per cell.
+type reportTable struct {
+	Header []string
+	Rows   [][]string
+}
+
+// reportIssue is an analysis warning in a report.
+type reportIssue struct {
+	Type    string
+	Message string
+	Detail  string // affected states and symbols
+}
+
+// reportDoc is the content of a report, shared by the Markdown and HTML
+// renderings.
+type reportDoc struct {
+	Title       string
+	Description string
+	Summary     reportTable
+	SVG         string
+	TitleStates string // heading of the states section
+	TitleTrans  string // heading of the transitions section
+	Transitions reportTable
+	Issues      []reportIssue
+	States      reportTable
+}
+
+// newReportDoc collects what a report says about f.
+func newReportDoc(f *fsm.FSM, opts ReportOptions) reportDoc {
+	v := f.Vocab()
+	d := reportDoc{
+		Title:       opts.Title,
+		Description: f.Description,
+		TitleStates: v.States,
+		TitleTrans:  v.Transition + "s",
+	}
+	if d.Title == "" {
+		d.Title = f.Name
+	}
+	if d.Title == "" {
+		d.Title = strings.ToUpper(string(f.Type))
+	}
+
+	// Summary
+	sum := &d.Summary
+	sum.Header = []string{"Property", "Value"}
+	add := func(k, val string) { sum.Rows = append(sum.Rows, []string{k, val}) }
+	add("Type", string(f.Type))
+	add(v.States, fmt.Sprintf("%d", len(f.States)))
+	add(v.Alphabet, strings.Join(f.Alphabet, ", "))
+	if len(f.OutputAlphabet) > 0 {
+		add(v.Output+"s", strings.Join(f.OutputAlphabet, ", "))
+	}
+	if len(f.StackAlphabet) > 0 {
+		add("Stack alphabet", strings.Join(f.StackAlphabet, ", "))
+	}
+	add(v.Initial, f.Initial)
+	if len(f.Accepting) > 0 {
+		add(v.Accepting, strings.Join(f.Accepting, ", "))
+	}
+	add(v.Transition+"s", fmt.Sprintf("%d", len(f.Transitions)))
+	add("Fingerprint", f.Fingerprint())
+	for _, k := range sortedStrings(f.Metadata) {
+		add(k, f.Metadata[k])
+	}
+
+	// Diagram
+	if !opts.Mermaid {
+		svgOpts := opts.SVG
+		svgOpts.Title = ""
+		d.SVG = GenerateSVGNative(f, svgOpts)
+		if i := strings.Index(d.SVG, "<svg"); i > 0 {
+			d.SVG = d.SVG[i:] // drop the XML declaration
+		}
+	}
+
+	// Transitions, with a column for each optional field in use
+	var hasOutput, hasProb, hasWeight bool
+	for _, t := range f.Transitions {
+		hasOutput = hasOutput || t.Output != nil
+		hasProb = hasProb || t.Probability != nil
+		hasWeight = hasWeight || t.Weight != nil
+	}
+	tr := &d.Transitions
+	tr.Header = []string{"From", v.Input, "To"}
+	if hasOutput {
+		tr.Header = append(tr.Header, v.Output)
+	}
+	if f.Type == fsm.TypePDA {
+		tr.Header = append(tr.Header, "Stack")
+	}
+	if hasProb {
+		tr.Header = append(tr.Header, "Probability")
+	}
+	if hasWeight {
+		tr.Header = append(tr.Header, "Weight")
+	}
+	for _, t := range f.Transitions {
+		input := "ε"
+		if t.Input != nil {
+			input = *t.Input
+		}
+		row := []string{t.From, input, strings.Join(t.To, ", ")}
+		if hasOutput {
+			row = append(row, optString(t.Output))
+		}
+		if f.Type == fsm.TypePDA {
+			row = append(row, t.StackLabel())
+		}
+		if hasProb {
+			row = append(row, optFloat(t.Probability))
+		}
+		if hasWeight {
+			row = append(row, optFloat(t.Weight))
+		}
+		tr.Rows = append(tr.Rows, row)
+	}
+
+	// Analysis
+	for _, w := range f.Analyse() {
+		issue := reportIssue{Type: w.Type, Message: w.Message}
+		var detail []string
+		if len(w.States) > 0 {
+			detail = append(detail, v.States+": "+strings.Join(w.States, ", "))
+		}
+		if len(w.Symbols) > 0 {
+			detail = append(detail, "Symbols: "+strings.Join(w.Symbols, ", "))
+		}
+		if len(w.Path) > 0 {
+			detail = append(detail, "Path: "+strings.Join(w.Path, " -> "))
+		}
+		issue.Detail = strings.Join(detail, "; ")
+		d.Issues = append(d.Issues, issue)
+	}
+
+	// Per-state notes
+	st := &d.States
+	st.Header = []string{v.State, "Role", "Notes"}
+	for _, s := range f.States {
+		var role []string
+		if s == f.Initial {
+			role = append(role, strings.ToLower(v.Initial))
+		}
+		if f.IsAccepting(s) {
+			role = append(role, strings.ToLower(v.Accepting))
+		}
+		if f.IsLinked(s) {
+			if m := f.LinkedMachines[s]; m != "" {
+				role = append(role, "linked to "+m)
+			} else {
+				role = append(role, "linked")
+			}
+		}
+		st.Rows = append(st.Rows, []string{s, strings.Join(role, ", "), strings.Join(stateNotes(f, s, v), "; ")})
+	}
+	return d
+}
+
+// stateNotes lists what a report says about a state beyond its role:
+// its Moore output, class and non-zero property values, and metadata.
+func stateNotes(f *fsm.FSM, state string, v fsm.VocabLabels) []string {
+	var notes []string
+	if out, ok := f.StateOutputs[state]; ok && out != "" {
+		notes = append(notes, strings.ToLower(v.Output)+": "+out)
+	}
+	if cls, ok := f.StateClasses[state]; ok && cls != "" && cls != fsm.DefaultClassName {
+		notes = append(notes, "class: "+cls)
+	}
+	props := f.StateProperties[state]
+	for _, k := range sortedStrings(props) {
+		if !isZeroValue(props[k]) {
+			notes = append(notes, fmt.Sprintf("%s = %v", k, props[k]))
+		}
+	}
+	meta := f.StateMetadata[state]
+	for _, k := range sortedStrings(meta) {
+		notes = append(notes, k+": "+meta[k])
+	}
+	return notes
+}
+
+func optString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optFloat(x *float64) string {
+	if x == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*x, 'g', -1, 64)
+}
+
+// GenerateMarkdownReport returns a Markdown document describing f, for
+// committing as design documentation: a summary with the machine's
+// fingerprint and metadata, the diagram (native SVG, or Mermaid with
+// opts.Mermaid), the transition table, the warnings
+// from Analyse, and a table of states with their roles and notes (Moore
+// outputs, classes and property values, and state metadata).
+func GenerateMarkdownReport(f *fsm.FSM, opts ReportOptions) string {
+	d := newReportDoc(f, opts)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", mdEscape(d.Title))
+	if d.Description != "" {
+		fmt.Fprintf(&sb, "%s\n\n", mdEscape(d.Description))
+	}
+
+	sb.WriteString("## Summary\n\n")
+	writeMarkdownTable(&sb, d.Summary)
+
+	sb.WriteString("## Diagram\n\n")
+	if opts.Mermaid {
+		sb.WriteString("```mermaid\n" + GenerateMermaid(f) + "```\n\n")
+	} else if opts.DiagramPath != "" {
+		fmt.Fprintf(&sb, "![%s](%s)\n\n", mdEscape(d.Title), opts.DiagramPath)
+	} else {
+		// Markdown passes HTML blocks through; a blank line would end one.
+		sb.WriteString("<div>\n")
+		for _, line := range strings.Split(strings.TrimSpace(d.SVG), "\n") {
+			if strings.TrimSpace(line) != "" {
+				sb.WriteString(line + "\n")
+			}
+		}
+		sb.WriteString("</div>\n\n")
+	}
+
+	fmt.Fprintf(&sb, "## %s\n\n", d.TitleTrans)
+	if len(d.Transitions.Rows) == 0 {
+		sb.WriteString("None.\n\n")
+	} else {
+		writeMarkdownTable(&sb, d.Transitions)
+	}
+
+	sb.WriteString("## Analysis\n\n")
+	if len(d.Issues) == 0 {
+		sb.WriteString("No issues found.\n\n")
+	} else {
+		for _, issue := range d.Issues {
+			fmt.Fprintf(&sb, "- **%s**: %s", issue.Type, mdEscape(issue.Message))
+			if issue.Detail != "" {
+				fmt.Fprintf(&sb, " (%s)", mdEscape(issue.Detail))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	fmt.Fprintf(&sb, "## %s\n\n", d.TitleStates)
+	writeMarkdownTable(&sb, d.States)
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+// writeMarkdownTable writes a pipe table followed by a blank line.
+func writeMarkdownTable(sb *strings.Builder, t reportTable) {
+	row := func(cells []string) {
+		sb.WriteString("|")
+		for _, c := range cells {
+			sb.WriteString(" " + mdCell(c) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	row(t.Header)
+	sb.WriteString("|" + strings.Repeat(" --- |", len(t.Header)) + "\n")
+	for _, r := range t.Rows {
+		row(r)
+	}
+	sb.WriteString("\n")
+}
+
+// mdEscape escapes the characters that Markdown would otherwise read as
+// emphasis, code, links, or HTML.
+func mdEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`",
+		"[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;",
+	).Replace(s)
+}
+
+// mdCell escapes a table cell, which additionally cannot hold pipes or
+// line breaks.
+func mdCell(s string) string {
+	s = strings.ReplaceAll(mdEscape(s), "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// GenerateHTMLReport returns the report of GenerateMarkdownReport as a
+// self-contained HTML page, with the diagram inline.
+func GenerateHTMLReport(f *fsm.FSM, opts ReportOptions) (string, error) {
+	opts.Mermaid = false
+	d := newReportDoc(f, opts)
+	var sb strings.Builder
+	err := reportTemplate.Execute(&sb, struct {
+		reportDoc
+		Diagram template.HTML
+	}{
+		reportDoc: d,
+		// The SVG is generated here and escapes every name.
+		Diagram: template.HTML(d.SVG),
+	})
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,83 @@
+package fsmfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateMarkdownReport(t *testing.T) {
+	f := buildTestFSMWithMetadata()
+	f.Metadata["ticket"] = "CTL-42 | CTL-43"
+	doc := GenerateMarkdownReport(f, DefaultReportOptions())
+
+	for _, want := range []string{
+		"# meta\n",
+		"| ticket | CTL-42 \\| CTL-43 |",
+		"| owner | controls team |",
+		"<div>\n<svg ",
+		"| idle | start | running, done |",
+		"| running | ε | idle |",
+		"| idle | initial |  |",
+		`| running |  | note: motor "on" |`,
+		"| done | accepting | reviewed: yes |",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("report lacks %q", want)
+		}
+	}
+	if strings.Contains(doc, "<?xml") {
+		t.Error("XML declaration left in the embedded SVG")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(doc[strings.Index(doc, "<div>"):strings.Index(doc, "</div>")]), "\n") {
+		if strings.TrimSpace(line) == "" {
+			t.Fatal("blank line inside the SVG block ends it early in Markdown")
+		}
+	}
+
+	opts := DefaultReportOptions()
+	opts.DiagramPath = "img/meta.svg"
+	doc = GenerateMarkdownReport(f, opts)
+	if !strings.Contains(doc, "![meta](img/meta.svg)") || strings.Contains(doc, "<svg") {
+		t.Error("DiagramPath should link the diagram instead of embedding it")
+	}
+
+	opts = DefaultReportOptions()
+	opts.Mermaid = true
+	doc = GenerateMarkdownReport(f, opts)
+	if !strings.Contains(doc, "```mermaid\nstateDiagram-v2\n") || strings.Contains(doc, "<svg") {
+		t.Error("Mermaid should draw the diagram as a mermaid block instead of SVG")
+	}
+	if !strings.Contains(doc, "| Fingerprint | "+f.Fingerprint()+" |") {
+		t.Error("report lacks the fingerprint")
+	}
+}
+
+func TestGenerateMarkdownReport_Analysis(t *testing.T) {
+	f := buildTestFSMWithMetadata()
+	f.AddState("orphan")
+	doc := GenerateMarkdownReport(f, DefaultReportOptions())
+	if strings.Contains(doc, "No issues found.") {
+		t.Fatal("expected analysis warnings for an unreachable state")
+	}
+	if !strings.Contains(doc, "orphan") || !strings.Contains(doc, "- **") {
+		t.Error("warnings not listed")
+	}
+}
+
+func TestGenerateHTMLReport(t *testing.T) {
+	f := buildTestFSMWithMetadata()
+	f.Name = `A <b> & "c"`
+	page, err := GenerateHTMLReport(f, DefaultReportOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page, "<b>") || !strings.Contains(page, "<title>A &lt;b&gt; &amp; &#34;c&#34;</title>") {
+		t.Error("machine name not escaped in the page title")
+	}
+	if !strings.Contains(page, "<div id=\"diagram\">\n<svg ") {
+		t.Error("diagram not embedded")
+	}
+	if !strings.Contains(page, "<td>note: motor &#34;on&#34;</td>") {
+		t.Error("state notes missing or unescaped")
+	}
+}
@@ -0,0 +1,151 @@
+package fsmfile
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+//go:embed fsm.schema.json
+var jsonSchema []byte
+
+// JSONSchema returns the JSON Schema (draft 2020-12) for the FSM JSON
+// format read by ParseJSON and written by ToJSON.
+func JSONSchema() []byte {
+	return append([]byte(nil), jsonSchema...)
+}
+
+// JSONError is an error in a JSON document, with the 1-based line and
+// column where it was found. Line is 0 when the position is not known.
+type JSONError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *JSONError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ParseJSONStrict is ParseJSON for documents that must conform to the
+// schema: unknown fields (such as a misspelt "acepting"), values of the
+// wrong type, an unknown machine type, malformed "to" targets, and
+// trailing data are errors. Errors are *JSONError values carrying the
+// line and column of the problem.
+func ParseJSONStrict(data []byte) (*fsm.FSM, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var j jsonFSM
+	if err := dec.Decode(&j); err != nil {
+		return nil, jsonError(data, err)
+	}
+	end := int(dec.InputOffset())
+	if rest := bytes.TrimLeft(data[end:], " \t\r\n"); len(rest) > 0 {
+		return nil, positionError(data, len(data)-len(rest), "unexpected data after the top-level object")
+	}
+
+	switch fsm.Type(j.Type) {
+	case "", fsm.TypeDFA, fsm.TypeNFA, fsm.TypeMoore, fsm.TypeMealy, fsm.TypePDA:
+	default:
+		return nil, keyError(data, "type", fmt.Sprintf("unknown machine type %q", j.Type))
+	}
+	for i, jt := range j.Transitions {
+		switch v := jt.To.(type) {
+		case nil, string:
+		case []interface{}:
+			for _, s := range v {
+				if _, ok := s.(string); !ok {
+					return nil, &JSONError{Msg: fmt.Sprintf("transitions[%d].to: targets must be strings", i)}
+				}
+			}
+		default:
+			return nil, &JSONError{Msg: fmt.Sprintf("transitions[%d].to: must be a string or an array of strings", i)}
+		}
+	}
+
+	return ParseJSON(data)
+}
+
+var unknownFieldErr = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// jsonError converts an encoding/json error into a *JSONError.
+func jsonError(data []byte, err error) error {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		// Offset is just past the offending character.
+		return positionError(data, int(syntax.Offset)-1, syntax.Error())
+	case errors.As(err, &typ):
+		msg := fmt.Sprintf("%s: cannot use JSON %s as %s", typ.Field, typ.Value, typ.Type)
+		// Offset is just past the offending value; point at its start.
+		return positionError(data, valueStart(data, int(typ.Offset)), msg)
+	case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF):
+		return positionError(data, len(data), "unexpected end of JSON input")
+	}
+	if m := unknownFieldErr.FindStringSubmatch(err.Error()); m != nil {
+		return keyError(data, m[1], fmt.Sprintf("unknown field %q", m[1]))
+	}
+	return &JSONError{Msg: err.Error()}
+}
+
+// keyError reports msg at the first occurrence of key as an object key.
+func keyError(data []byte, key, msg string) error {
+	quoted, _ := json.Marshal(key)
+	re := regexp.MustCompile(regexp.QuoteMeta(string(quoted)) + `\s*:`)
+	if loc := re.FindIndex(data); loc != nil {
+		return positionError(data, loc[0], msg)
+	}
+	return &JSONError{Msg: msg}
+}
+
+// valueStart finds the start of the value that encoding/json reports
+// ending at end: a string, a literal, or the opening bracket of an
+// array or object (for which end is just past the bracket).
+func valueStart(data []byte, end int) int {
+	if end > len(data) {
+		end = len(data)
+	}
+	if end == 0 {
+		return 0
+	}
+	switch data[end-1] {
+	case '[', '{':
+		return end - 1
+	case '"':
+		for i := end - 2; i >= 0; i-- {
+			if data[i] == '"' && (i == 0 || data[i-1] != '\\') {
+				return i
+			}
+		}
+		return end - 1
+	}
+	i := end
+	for i > 0 && bytes.IndexByte([]byte(" \t\r\n:,[{"), data[i-1]) < 0 {
+		i--
+	}
+	return i
+}
+
+// positionError reports msg at a byte offset in data.
+func positionError(data []byte, offset int, msg string) error {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	col := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return &JSONError{Line: line, Column: col, Msg: msg}
+}
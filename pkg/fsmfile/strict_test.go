@@ -0,0 +1,146 @@
+package fsmfile
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONStrict_AcceptsToJSONOutput(t *testing.T) {
+	original := buildTestFSMWithMetadata()
+	data, err := ToJSON(original, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ParseJSONStrict(data)
+	if err != nil {
+		t.Fatalf("ParseJSONStrict rejected ToJSON output: %v", err)
+	}
+	if !loaded.StructurallyEqual(original) {
+		t.Error("strict parse differs from the original")
+	}
+
+	classes := buildTestFSMWithClasses()
+	data, err = ToJSON(classes, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJSONStrict(data); err != nil {
+		t.Errorf("ParseJSONStrict rejected classes: %v", err)
+	}
+}
+
+func TestParseJSONStrict_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		line, col  int
+		msgContain string
+	}{
+		{
+			name: "unknown field",
+			doc: `{
+  "type": "dfa",
+  "states": ["a"],
+  "acepting": ["a"]
+}`,
+			line: 4, col: 3, msgContain: `unknown field "acepting"`,
+		},
+		{
+			name: "unknown transition field",
+			doc: `{
+  "states": ["a"],
+  "transitions": [
+    {"from": "a", "input": "x", "to": "a", "ouptut": "y"}
+  ]
+}`,
+			line: 4, col: 44, msgContain: `unknown field "ouptut"`,
+		},
+		{
+			name: "wrong type",
+			doc:  "{\n  \"states\": \"a\"\n}",
+			line: 2, col: 13, msgContain: "states",
+		},
+		{
+			name: "syntax error",
+			doc:  "{\n  \"states\": [\"a\",]\n}",
+			line: 2, col: 18, msgContain: "invalid character",
+		},
+		{
+			name: "trailing data",
+			doc:  "{\"states\": []}\n{}",
+			line: 2, col: 1, msgContain: "after the top-level object",
+		},
+		{
+			name: "unknown type",
+			doc:  "{\n  \"type\": \"dfs\"\n}",
+			line: 2, col: 3, msgContain: `"dfs"`,
+		},
+		{
+			name: "truncated",
+			doc:  "{\n  \"states\": [",
+			line: 2, col: 14, msgContain: "unexpected end",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJSONStrict([]byte(tt.doc))
+			var je *JSONError
+			if !errors.As(err, &je) {
+				t.Fatalf("got %v, want a *JSONError", err)
+			}
+			if je.Line != tt.line || je.Column != tt.col {
+				t.Errorf("position %d:%d, want %d:%d (%v)", je.Line, je.Column, tt.line, tt.col, err)
+			}
+			if !strings.Contains(err.Error(), tt.msgContain) {
+				t.Errorf("error %q does not mention %q", err, tt.msgContain)
+			}
+		})
+	}
+}
+
+func TestParseJSONStrict_BadTargets(t *testing.T) {
+	for _, doc := range []string{
+		`{"states": ["a"], "transitions": [{"from": "a", "input": "x", "to": 3}]}`,
+		`{"states": ["a"], "transitions": [{"from": "a", "input": "x", "to": ["a", 3]}]}`,
+	} {
+		if _, err := ParseJSONStrict([]byte(doc)); err == nil || !strings.Contains(err.Error(), "transitions[0].to") {
+			t.Errorf("%s: got %v, want a transitions[0].to error", doc, err)
+		}
+	}
+}
+
+// TestJSONSchema_CoversFormat checks that the embedded schema parses and
+// declares exactly the fields ParseJSON reads.
+func TestJSONSchema_CoversFormat(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       struct {
+			Transition struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"transition"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(JSONSchema(), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	check := func(what string, typ reflect.Type, props map[string]json.RawMessage) {
+		fields := map[string]bool{}
+		for i := 0; i < typ.NumField(); i++ {
+			name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			fields[name] = true
+			if _, ok := props[name]; !ok {
+				t.Errorf("%s field %q missing from the schema", what, name)
+			}
+		}
+		for name := range props {
+			if !fields[name] {
+				t.Errorf("schema %s property %q is not read by ParseJSON", what, name)
+			}
+		}
+	}
+	check("machine", reflect.TypeOf(jsonFSM{}), schema.Properties)
+	check("transition", reflect.TypeOf(jsonTransition{}), schema.Defs.Transition.Properties)
+}
@@ -1,6 +1,8 @@
 package fsmfile
 
 import (
+	"context"
+	"log/slog"
 	"math"
 	"sort"
 
@@ -16,8 +18,15 @@ import (
 // 3. Horizontal positioning - assign X coordinates to minimise edge length
 // 4. Final coordinate assignment - convert to pixel coordinates
 func SugiyamaLayout(f *fsm.FSM, width, height int) map[string][2]int {
+	positions, _ := sugiyamaLayout(context.Background(), f, width, height)
+	return positions
+}
+
+// sugiyamaLayout is SugiyamaLayout, stopping with ctx's error if ctx is
+// done before the layout is.
+func sugiyamaLayout(ctx context.Context, f *fsm.FSM, width, height int) (map[string][2]int, error) {
 	if len(f.States) == 0 {
-		return make(map[string][2]int)
+		return make(map[string][2]int), nil
 	}
 
 	// Build graph structure
@@ -25,16 +34,34 @@ func SugiyamaLayout(f *fsm.FSM, width, height int) map[string][2]int {
 
 	// Phase 1: Layer assignment
 	layers := assignLayers(graph, f.Initial)
+	log := loggerFrom(ctx)
+	debug := log.Enabled(ctx, slog.LevelDebug)
+	if debug {
+		sizes := make([]int, len(layers))
+		for i, layer := range layers {
+			sizes[i] = len(layer)
+		}
+		log.DebugContext(ctx, "sugiyama layers", "layers", len(layers), "sizes", sizes, "crossings", totalCrossings(layers, graph))
+	}
 
 	// Phase 2: Crossing minimisation (multiple passes)
 	for i := 0; i < 4; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		layers = reduceCrossings(layers, graph)
+		if debug {
+			log.DebugContext(ctx, "sugiyama crossing pass", "pass", i+1, "crossings", totalCrossings(layers, graph))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	// Phase 3: Horizontal positioning within layers
 	positions := assignPositions(layers, graph, width, height)
 
-	return positions
+	return positions, nil
 }
 
 // graph represents the FSM as an adjacency structure
@@ -448,6 +475,16 @@ func resolveOverlapsWithWidths(layer []string, xPos map[string]float64, labelWid
 	}
 }
 
+// totalCrossings counts the edge crossings between every pair of adjacent
+// layers.
+func totalCrossings(layers [][]string, g *graph) int {
+	n := 0
+	for i := 1; i < len(layers); i++ {
+		n += countCrossings(layers[i-1], layers[i], g)
+	}
+	return n
+}
+
 // countCrossings counts edge crossings between two adjacent layers.
 // Used to evaluate layout quality.
 func countCrossings(layer1, layer2 []string, g *graph) int {
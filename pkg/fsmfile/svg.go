@@ -1,10 +1,14 @@
 package fsmfile
 
 import (
+	"context"
 	"fmt"
 	"html"
+	"image"
+	"log/slog"
 	"math"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
 )
@@ -32,6 +36,44 @@ type SVGOptions struct {
 	StateShape  StateShape // shape of state nodes
 	Padding     int        // padding around edges
 	NodeSpacing float64    // multiplier for spacing between nodes (default 1.0)
+	Theme       Theme      // colours and font; empty fields use DefaultTheme
+
+	// UseLayout, if set, places states at their saved editor positions
+	// (as read from layout.toml) instead of computing a layout. States
+	// without a saved position are placed next to their neighbours, as
+	// IncrementalLayoutTUI places them.
+	UseLayout *Layout
+
+	// LayoutEngine chooses the algorithm that computes positions when
+	// UseLayout is nil. The zero value, EngineAuto, uses SmartLayout.
+	LayoutEngine LayoutEngine
+
+	// Highlight, if set, draws the given states and edges in the
+	// theme's highlight colour (see TraceHighlight).
+	Highlight *Highlight
+
+	// DataAttributes wraps each state in <g data-state="name"> and each
+	// edge in <g data-from="a" data-to="b"> (data-from is empty for the
+	// initial arrow), so that scripts can find and restyle them.
+	DataAttributes bool
+
+	// Viewport, if not empty, shows only this region of the Width×Height
+	// canvas; the SVG is the size of the region. See TileGrid.
+	Viewport image.Rectangle
+
+	// SeparateEdges draws each transition between two states as a curve
+	// of its own, fanned out from the others as on the fsmedit canvas,
+	// instead of one edge each way with the labels joined by commas.
+	SeparateEdges bool
+
+	// BundleEdges draws the transitions into a state that many others
+	// lead to, such as an error or reset state, as branches merging into
+	// one trunk with a single arrowhead (see FindEdgeBundles).
+	BundleEdges bool
+
+	// Logger, if set, is sent debug traces of the layout and of how each
+	// edge is routed (see WithLogger).
+	Logger *slog.Logger
 }
 
 // DefaultSVGOptions returns sensible defaults.
@@ -46,12 +88,24 @@ func DefaultSVGOptions() SVGOptions {
 		StateShape:  ShapeEllipse,
 		Padding:     50,
 		NodeSpacing: 1.5, // more generous default spacing
+		Theme:       DefaultTheme(),
 	}
 }
 
 // GenerateSVGNative renders FSM to SVG without external dependencies.
 // Uses the built-in layout algorithms.
 func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
+	svg, _ := GenerateSVGNativeContext(context.Background(), f, opts)
+	return svg
+}
+
+// GenerateSVGNativeContext is GenerateSVGNative, stopping with ctx's error
+// if ctx is done before the layout is.
+func GenerateSVGNativeContext(ctx context.Context, f *fsm.FSM, opts SVGOptions) (string, error) {
+	if opts.Logger != nil {
+		ctx = WithLogger(ctx, opts.Logger)
+	}
+	log := loggerFrom(ctx)
 	if opts.Width == 0 {
 		opts.Width = 800
 	}
@@ -76,11 +130,25 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 	if opts.NodeSpacing == 0 {
 		opts.NodeSpacing = 1.5
 	}
+	theme := opts.Theme.resolved()
 
 	// Get layout in terminal coordinates
 	layoutW := (opts.Width - 2*opts.Padding) / 10
 	layoutH := (opts.Height - 2*opts.Padding) / 20
-	positions := SmartLayout(f, layoutW, layoutH)
+	var positions map[string][2]int
+	if opts.UseLayout != nil {
+		positions = savedPositions(f, opts.UseLayout)
+	}
+	if positions != nil {
+		log.DebugContext(ctx, "svg layout", "source", "saved", "states", len(positions))
+	} else {
+		log.DebugContext(ctx, "svg layout", "source", "engine", "engine", opts.LayoutEngine.Name(), "width", layoutW, "height", layoutH)
+		var err error
+		positions, err = EngineLayoutContext(ctx, f, opts.LayoutEngine, layoutW, layoutH)
+		if err != nil {
+			return "", err
+		}
+	}
 
 	// First pass: calculate positions and find bounding box
 	rawPos := make(map[string][2]float64)
@@ -211,31 +279,18 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 	var sb strings.Builder
 
 	// SVG header
+	view := image.Rect(0, 0, opts.Width, opts.Height)
+	if !opts.Viewport.Empty() {
+		view = opts.Viewport
+	}
 	sb.WriteString(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">
-<defs>
-  <marker id="arrowhead" markerWidth="10" markerHeight="7" refX="9" refY="3.5" orient="auto">
-    <polygon points="0 0, 10 3.5, 0 7" fill="#333"/>
-  </marker>
-  <marker id="arrowhead-self" markerWidth="10" markerHeight="7" refX="9" refY="3.5" orient="auto">
-    <polygon points="0 0, 10 3.5, 0 7" fill="#666"/>
-  </marker>
-</defs>
-<style>
-  .state { fill: white; stroke: #333; stroke-width: 2; }
-  .state-initial { fill: #e8f5e9; stroke: #2e7d32; stroke-width: 2; }
-  .state-accepting { fill: #fff3e0; stroke: #e65100; stroke-width: 2; }
-  .state-both { fill: #e3f2fd; stroke: #1565c0; stroke-width: 2; }
-  .state-linked { fill: #f3e5f5; stroke: #8e24aa; stroke-width: 2; }
-  .state-label { font-family: sans-serif; font-size: %dpx; text-anchor: middle; dominant-baseline: middle; }
-  .transition { fill: none; stroke: #333; stroke-width: 1.5; marker-end: url(#arrowhead); }
-  .transition-self { fill: none; stroke: #666; stroke-width: 1.5; marker-end: url(#arrowhead-self); }
-  .trans-label { font-family: sans-serif; font-size: %dpx; fill: #333; }
-  .title { font-family: sans-serif; font-size: %dpx; font-weight: bold; text-anchor: middle; }
-  .moore-output { font-family: sans-serif; font-size: %dpx; fill: #666; font-style: italic; text-anchor: middle; }
-  .linked-label { font-family: sans-serif; font-size: %dpx; fill: #8e24aa; font-style: italic; text-anchor: middle; }
-</style>
-`, opts.Width, opts.Height, opts.Width, opts.Height, stateLabelSize, opts.LabelSize, opts.TitleSize, opts.LabelSize, opts.LabelSize))
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="%d %d %d %d">
+`, view.Dx(), view.Dy(), view.Min.X, view.Min.Y, view.Dx(), view.Dy()))
+	sb.WriteString(theme.svgDefs(stateLabelSize, opts.LabelSize, opts.TitleSize, opts.Highlight != nil))
+
+	// Background, drawn first so that it does not cover the title
+	sb.WriteString(fmt.Sprintf(`<rect width="%d" height="%d" fill="%s"/>
+`, opts.Width, opts.Height, cssValue(theme.Background)))
 
 	// Title
 	if opts.Title != "" {
@@ -243,16 +298,16 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 `, opts.Width/2, html.EscapeString(opts.Title)))
 	}
 
-	// Background
-	sb.WriteString(fmt.Sprintf(`<rect width="%d" height="%d" fill="white"/>
-`, opts.Width, opts.Height))
-
 	// Group transitions by from->to for label aggregation
 	type transKey struct{ from, to string }
 	transLabels := make(map[transKey][]string)
+	var transOrder []transKey // first-seen order, so output is stable
 	for _, t := range f.Transitions {
 		for _, to := range t.To {
 			key := transKey{t.From, to}
+			if _, seen := transLabels[key]; !seen {
+				transOrder = append(transOrder, key)
+			}
 			label := ""
 			if t.Input != nil {
 				label = *t.Input
@@ -262,6 +317,9 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 			if f.Type == fsm.TypeMealy && t.Output != nil {
 				label += "/" + *t.Output
 			}
+			if f.Type == fsm.TypePDA {
+				label += " [" + t.StackLabel() + "]"
+			}
 			transLabels[key] = append(transLabels[key], label)
 		}
 	}
@@ -276,41 +334,142 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 	graphCentreY := sumY / float64(len(svgPos))
 
 	// Draw transitions first (under states)
+	hl := opts.Highlight
+	edgeGroup := func(from, to string) string {
+		if !opts.DataAttributes {
+			return ""
+		}
+		return fmt.Sprintf(`<g data-from="%s" data-to="%s">
+`, html.EscapeString(from), html.EscapeString(to))
+	}
+	labels := &svgLabels{fontSize: float64(opts.LabelSize)}
+	stateSize := func(name string) (float64, float64) {
+		textWidth := float64(len(name)*stateLabelSize) * 0.6
+		return math.Max(scaledRadius*2, textWidth+40), math.Max(scaledRadius*1.6, float64(stateLabelSize)+24)
+	}
+	// Transitions in bundles are drawn together after the others.
+	var bundles []EdgeBundle
+	bundled := make(map[transKey]bool)
+	if opts.BundleEdges {
+		edges := make([][2]string, len(transOrder))
+		for i, key := range transOrder {
+			edges[i] = [2]string{key.from, key.to}
+		}
+		radius := make(map[string]float64)
+		for _, name := range f.States {
+			w, h := stateSize(name)
+			radius[name] = math.Max(w, h) / 2
+		}
+		bundles = FindEdgeBundles(edges, svgPos, radius, 40)
+		for _, b := range bundles {
+			for _, from := range b.From {
+				bundled[transKey{from, b.To}] = true
+			}
+		}
+	}
+	// Self-loops are drawn last, on the side of their state that the
+	// other transitions and their labels leave clearest.
+	var selfLoops []transKey
+	towards := make(map[string][]Point)
 	drawnPairs := make(map[transKey]bool)
-	for key, labels := range transLabels {
-		if drawnPairs[key] {
+	for _, key := range transOrder {
+		if drawnPairs[key] || bundled[key] {
 			continue
 		}
 
 		fromPos := svgPos[key.from]
 		toPos := svgPos[key.to]
-		label := strings.Join(labels, ", ")
+		label := strings.Join(transLabels[key], ", ")
 
 		if key.from == key.to {
-			// Self-loop - compute ellipse dimensions for the state
-			labelLen := len(key.from)
-			textWidth := float64(labelLen*stateLabelSize) * 0.6
-			stateWidth := math.Max(scaledRadius*2, textWidth+40)
-			stateHeight := math.Max(scaledRadius*1.6, float64(stateLabelSize)+24)
-			drawSelfLoop(&sb, fromPos[0], fromPos[1], stateWidth/2, stateHeight/2, label, opts.LabelSize, float64(opts.Width), float64(opts.Height))
+			selfLoops = append(selfLoops, key)
 		} else {
+			placed := len(labels.boxes)
 			// Check for bidirectional
 			reverseKey := transKey{key.to, key.from}
 			reverseLabels, hasBidi := transLabels[reverseKey]
 
-			if hasBidi && !drawnPairs[reverseKey] {
+			if opts.SeparateEdges && len(transLabels[key])+len(reverseLabels) > 1 {
+				var arcs []svgArc
+				for _, k := range []transKey{key, reverseKey} {
+					for _, l := range transLabels[k] {
+						arcs = append(arcs, svgArc{k.from, k.to, l, hl.edge(k.from, k.to), edgeGroup(k.from, k.to)})
+					}
+				}
+				drawParallelTransitions(&sb, fromPos, toPos, scaledRadius, arcs, labels)
+				log.DebugContext(ctx, "svg edge", "from", key.from, "to", key.to, "route", "parallel", "arcs", len(arcs))
+				drawnPairs[reverseKey] = true
+			} else if hasBidi && !drawnPairs[reverseKey] {
 				// Draw curved bidirectional arrows
 				drawBidiTransition(&sb, fromPos[0], fromPos[1], toPos[0], toPos[1],
-					scaledRadius, label, strings.Join(reverseLabels, ", "), opts.LabelSize)
+					scaledRadius, label, strings.Join(reverseLabels, ", "), opts.LabelSize,
+					hl.edge(key.from, key.to), hl.edge(key.to, key.from),
+					edgeGroup(key.from, key.to), edgeGroup(key.to, key.from), labels)
+				log.DebugContext(ctx, "svg edge", "from", key.from, "to", key.to, "route", "bidirectional")
 				drawnPairs[reverseKey] = true
 			} else if !hasBidi {
 				// Draw single-direction arrow
-				drawTransition(&sb, fromPos[0], fromPos[1], toPos[0], toPos[1],
-					scaledRadius, label, opts.LabelSize, graphCentreX, graphCentreY)
+				group := edgeGroup(key.from, key.to)
+				sb.WriteString(group)
+				route, reason := drawTransition(&sb, fromPos[0], fromPos[1], toPos[0], toPos[1],
+					scaledRadius, label, opts.LabelSize, graphCentreX, graphCentreY, hl.edge(key.from, key.to), labels)
+				closeGroup(&sb, group)
+				log.DebugContext(ctx, "svg edge", "from", key.from, "to", key.to, "route", route, "reason", reason)
+			}
+			// Each label sits on its edge, so it shows which way the
+			// edge leaves both of its states.
+			for _, b := range labels.boxes[placed:] {
+				towards[key.from] = append(towards[key.from], b.Anchor)
+				towards[key.to] = append(towards[key.to], b.Anchor)
 			}
 		}
 		drawnPairs[key] = true
 	}
+	for _, b := range bundles {
+		placed := len(labels.boxes)
+		var branches []svgArc
+		for _, from := range b.From {
+			key := transKey{from, b.To}
+			branches = append(branches, svgArc{from, b.To, strings.Join(transLabels[key], ", "), hl.edge(from, b.To), edgeGroup(from, b.To)})
+		}
+		drawEdgeBundle(&sb, b, svgPos, scaledRadius, branches, labels)
+		log.DebugContext(ctx, "svg edge", "from", b.From, "to", b.To, "route", "bundle")
+		towards[b.To] = append(towards[b.To], b.Junction)
+		for i, from := range b.From {
+			towards[from] = append(towards[from], labels.boxes[placed+i].Anchor)
+		}
+	}
+
+	// The initial arrow comes in from the left, like a transition, and
+	// a loop must not be drawn over it.
+	var initialArrow []Rect
+	if pos, ok := svgPos[f.Initial]; ok {
+		towards[f.Initial] = append(towards[f.Initial], Point{pos[0] - scaledRadius - 30, pos[1]})
+		initialArrow = []Rect{{X: pos[0] - scaledRadius - 16, Y: pos[1], W: 28, H: 8}}
+	}
+	for _, key := range selfLoops {
+		pos := svgPos[key.from]
+		stateWidth, stateHeight := stateSize(key.from)
+		around := &LoopSurroundings{Towards: towards[key.from]}
+		if key.from == f.Initial {
+			around.Obstacles = append(around.Obstacles, initialArrow...)
+		}
+		for _, b := range labels.boxes {
+			around.Obstacles = append(around.Obstacles, b.Rect)
+		}
+		for _, name := range f.States {
+			if name != key.from {
+				w, h := stateSize(name)
+				around.Obstacles = append(around.Obstacles, Rect{X: svgPos[name][0], Y: svgPos[name][1], W: w, H: h})
+			}
+		}
+		group := edgeGroup(key.from, key.to)
+		sb.WriteString(group)
+		side := drawSelfLoop(&sb, pos[0], pos[1], stateWidth/2, stateHeight/2, strings.Join(transLabels[key], ", "), opts.LabelSize,
+			float64(opts.Width), float64(opts.Height), hl.edge(key.from, key.to), around, labels)
+		closeGroup(&sb, group)
+		log.DebugContext(ctx, "svg edge", "from", key.from, "to", key.to, "route", "self-loop", "side", side.String())
+	}
 
 	// Draw initial arrow
 	if f.Initial != "" {
@@ -318,12 +477,24 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 			startX := pos[0] - scaledRadius - 30
 			startY := pos[1]
 			endX := pos[0] - scaledRadius - 2
-			sb.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="transition"/>
-`, startX, startY, endX, startY))
+			class, _ := edgeClasses("transition", hl.edge("", f.Initial))
+			group := edgeGroup("", f.Initial)
+			sb.WriteString(group)
+			sb.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="%s"/>
+`, startX, startY, endX, startY, class))
+			closeGroup(&sb, group)
 		}
 	}
 
-	// Draw states
+	// Draw states, noting where they are for the transition labels
+	var obstacles []Rect
+	if opts.Title != "" {
+		titleSize := float64(opts.TitleSize)
+		obstacles = append(obstacles, Rect{
+			X: float64(opts.Width) / 2, Y: 25 - titleSize*0.35,
+			W: float64(len(opts.Title)) * titleSize * 0.6, H: titleSize,
+		})
+	}
 	for _, name := range f.States {
 		pos := svgPos[name]
 		x, y := pos[0], pos[1]
@@ -342,6 +513,15 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 		} else if isAccepting {
 			class = "state-accepting"
 		}
+		if hl.state(name) {
+			class += " state-highlight"
+		}
+		group := ""
+		if opts.DataAttributes {
+			group = fmt.Sprintf(`<g data-state="%s">
+`, html.EscapeString(name))
+		}
+		sb.WriteString(group)
 
 		// Calculate dimensions based on label length and scaled radius
 		labelLen := len(name)
@@ -356,6 +536,7 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 		// Height: enough for text + vertical padding
 		// Text height ≈ stateLabelSize, add padding for comfortable fit
 		stateHeight := math.Max(r*1.6, float64(stateLabelSize)+24)
+		obstacles = append(obstacles, Rect{X: x, Y: y, W: stateWidth, H: stateHeight})
 
 		// Draw shape based on option
 		switch opts.StateShape {
@@ -457,19 +638,105 @@ func GenerateSVGNative(f *fsm.FSM, opts SVGOptions) string {
 `, x, y+stateHeight/2+15, html.EscapeString(output)))
 			}
 		}
+		closeGroup(&sb, group)
 	}
 
 	sb.WriteString("</svg>\n")
-	return sb.String()
+	return labels.resolve(sb.String(), obstacles, float64(opts.Width), float64(opts.Height), cssValue(theme.Edge)), nil
+}
+
+// svgLabels collects transition labels while edges are drawn, so that
+// they can be separated from each other and from the states once all of
+// them are known (see SeparateLabels). Each label is written as a
+// placeholder comment until resolve replaces it. A nil *svgLabels writes
+// labels at once.
+type svgLabels struct {
+	fontSize float64
+	boxes    []LabelBox
+	classes  []string
+	texts    []string
+}
+
+// write writes a label with the given class, x centred on x and with its
+// baseline at y, or a placeholder for it.
+func (l *svgLabels) write(sb *strings.Builder, x, y float64, class, text string) {
+	if l == nil {
+		sb.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" class="%s" text-anchor="middle">%s</text>
+`, x, y, class, html.EscapeString(text)))
+		return
+	}
+	// Boxes are centred; the baseline sits about a third of the font
+	// size below the centre.
+	w := float64(utf8.RuneCountInString(text)) * l.fontSize * 0.6
+	l.boxes = append(l.boxes, NewLabelBox(x, y-l.fontSize*0.35, w, l.fontSize))
+	l.classes = append(l.classes, class)
+	l.texts = append(l.texts, text)
+	sb.WriteString(fmt.Sprintf("<!--label:%d-->\n", len(l.boxes)-1))
 }
 
-func drawTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label string, fontSize int, graphCentreX, graphCentreY float64) {
+// resolve separates the collected labels within a width×height canvas
+// and replaces their placeholders in svg, adding a leader line in the
+// given colour to each label that had to move far from its edge.
+func (l *svgLabels) resolve(svg string, obstacles []Rect, width, height float64, leader string) string {
+	if len(l.boxes) == 0 {
+		return svg
+	}
+	SeparateLabels(l.boxes, obstacles, width, height)
+	pairs := make([]string, 0, 2*len(l.boxes))
+	for i, b := range l.boxes {
+		var sb strings.Builder
+		if b.Displaced() {
+			from, to := b.Leader()
+			sb.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="0.75" stroke-dasharray="2,2"/>
+`, from.X, from.Y, to.X, to.Y, leader))
+		}
+		sb.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" class="%s" text-anchor="middle">%s</text>
+`, b.X, b.Y+l.fontSize*0.35, l.classes[i], html.EscapeString(l.texts[i])))
+		pairs = append(pairs, fmt.Sprintf("<!--label:%d-->\n", i), sb.String())
+	}
+	return strings.NewReplacer(pairs...).Replace(svg)
+}
+
+// savedPositions returns the editor positions in l for f's states, in
+// the same character-cell units SmartLayout uses. States missing from l
+// are placed near the states they have transitions with, as fsmedit
+// would place them. It returns nil if l has no position for any of f's
+// states.
+func savedPositions(f *fsm.FSM, l *Layout) map[string][2]int {
+	fixed := make(map[string][2]int, len(f.States))
+	for _, name := range f.States {
+		if sl, ok := l.States[name]; ok {
+			fixed[name] = [2]int{sl.X, sl.Y}
+		}
+	}
+	if len(fixed) == 0 {
+		return nil
+	}
+	return IncrementalLayoutTUI(f, fixed, 0, 0)
+}
+
+// edgeClasses returns the CSS classes for an edge drawn with the given
+// base class and for its label, adding the highlight classes if hl is set.
+func edgeClasses(edge string, hl bool) (string, string) {
+	if hl {
+		return edge + " transition-highlight", "trans-label trans-label-highlight"
+	}
+	return edge, "trans-label"
+}
+
+// drawTransition draws a single-direction edge, straight if it is short
+// and curved away from the middle of the graph otherwise. It returns the
+// route taken, "straight", "curve", or "none" for states on top of each
+// other, and why.
+func drawTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label string, fontSize int, graphCentreX, graphCentreY float64, hl bool, labels *svgLabels) (route, reason string) {
+	edgeClass, labelClass := edgeClasses("transition", hl)
+
 	// Calculate start and end points on circle edges
 	dx := x2 - x1
 	dy := y2 - y1
 	dist := math.Sqrt(dx*dx + dy*dy)
 	if dist < 1 {
-		return
+		return "none", "states coincide"
 	}
 
 	// Normalize
@@ -523,19 +790,22 @@ func drawTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label string
 		cx := midX + perpX*curveAmount
 		cy := midY + perpY*curveAmount
 
-		sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="transition"/>
-`, sx, sy, cx, cy, ex, ey))
+		sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="%s"/>
+`, sx, sy, cx, cy, ex, ey, edgeClass))
 
 		// Label near control point - small fixed offset, not proportional to curve
 		// The control point is already offset from the edge, so only need a small nudge
 		labelX := cx + perpX*8
 		labelY := cy + perpY*8
-		sb.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" class="trans-label" text-anchor="middle">%s</text>
-`, labelX, labelY, html.EscapeString(label)))
+		labels.write(sb, labelX, labelY, labelClass, label)
+		if isBackEdge {
+			return "curve", "goes upward"
+		}
+		return "curve", "longer than four radii"
 	} else {
 		// Straight line for short edges
-		sb.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="transition"/>
-`, sx, sy, ex, ey))
+		sb.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="%s"/>
+`, sx, sy, ex, ey, edgeClass))
 
 		// Label at midpoint, offset perpendicular to line
 		mx := (sx + ex) / 2
@@ -543,12 +813,141 @@ func drawTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label string
 		ox := -ny * 12
 		oy := nx * 12
 
-		sb.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" class="trans-label" text-anchor="middle">%s</text>
-`, mx+ox, my+oy, html.EscapeString(label)))
+		labels.write(sb, mx+ox, my+oy, labelClass, label)
+	}
+	return "straight", "short"
+}
+
+// svgArc is one transition drawn by drawParallelTransitions.
+type svgArc struct {
+	from, to string
+	label    string
+	hl       bool
+	group    string
+}
+
+// drawParallelTransitions draws each of arcs, all between the states at
+// p1 and p2 in either direction, as a curve of its own. The curves fan
+// out to either side of the line between the states, with the offsets
+// ASCIIArcOffset gives the fsmedit canvas; arcs from the state at p2
+// run the other way along the same curves.
+func drawParallelTransitions(sb *strings.Builder, p1, p2 [2]float64, r float64, arcs []svgArc, labels *svgLabels) {
+	dx, dy := p2[0]-p1[0], p2[1]-p1[1]
+	dist := math.Hypot(dx, dy)
+	if dist < 1 {
+		return
+	}
+	perpX, perpY := -dy/dist, dx/dist
+	midX, midY := (p1[0]+p2[0])/2, (p1[1]+p2[1])/2
+	// Curves are this far apart at their middles, per step of offset.
+	const spacing = 9.0
+	from := arcs[0].from
+	for i, a := range arcs {
+		edgeClass, labelClass := edgeClasses("transition", a.hl)
+		bend := float64(ASCIIArcOffset(i, len(arcs))) * spacing
+		// A quadratic curve passes halfway to its control point.
+		cx, cy := midX+perpX*2*bend, midY+perpY*2*bend
+		x1, y1, x2, y2 := p1[0], p1[1], p2[0], p2[1]
+		if a.from != from {
+			x1, y1, x2, y2 = x2, y2, x1, y1
+		}
+		sx, sy := towardsPoint(x1, y1, cx, cy, r)
+		ex, ey := towardsPoint(x2, y2, cx, cy, r+2)
+
+		sb.WriteString(a.group)
+		sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="%s"/>
+`, sx, sy, cx, cy, ex, ey, edgeClass))
+		side := 1.0
+		if bend < 0 {
+			side = -1
+		}
+		at, _ := parallelLabelAt(Point{p1[0], p1[1]}, Point{cx, cy}, Point{p2[0], p2[1]}, i, len(arcs))
+		labels.write(sb, at.X+perpX*side*10, at.Y+perpY*side*10, labelClass, a.label)
+		closeGroup(sb, a.group)
+	}
+}
+
+// parallelLabelAt returns where the ith of n parallel arcs, the quadratic
+// curve from p1 to p2 with control point c, carries its label, and the
+// curve's direction there. The labels are staggered along the curves, so
+// that those of arcs next to each other do not sit side by side.
+func parallelLabelAt(p1, c, p2 Point, i, n int) (Point, Point) {
+	t := 0.5
+	if n > 1 {
+		t = 0.3 + 0.4*float64(i)/float64(n-1)
 	}
+	return quadAt(p1, c, p2, t)
 }
 
-func drawBidiTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label1, label2 string, fontSize int) {
+// quadAt returns the point at t along the quadratic curve from p1 to p2
+// with control point c, and the curve's direction there.
+func quadAt(p1, c, p2 Point, t float64) (Point, Point) {
+	u := 1 - t
+	at := Point{
+		u*u*p1.X + 2*u*t*c.X + t*t*p2.X,
+		u*u*p1.Y + 2*u*t*c.Y + t*t*p2.Y,
+	}
+	dir := Point{
+		2*u*(c.X-p1.X) + 2*t*(p2.X-c.X),
+		2*u*(c.Y-p1.Y) + 2*t*(p2.Y-c.Y),
+	}
+	return at, dir
+}
+
+// drawEdgeBundle draws the transitions of b, one to a branch, as curves
+// from their states into a trunk that ends in a single arrowhead at b.To.
+// The trunk is highlighted if any branch is.
+func drawEdgeBundle(sb *strings.Builder, b EdgeBundle, pos map[string][2]float64, r float64, branches []svgArc, labels *svgLabels) {
+	to := pos[b.To]
+	trunkHL := false
+	for _, a := range branches {
+		from := pos[a.from]
+		c := bundleBranch(b, from, to)
+		sx, sy := towardsPoint(from[0], from[1], c.X, c.Y, r)
+		edgeClass, labelClass := edgeClasses("transition", a.hl)
+		sb.WriteString(a.group)
+		sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="%s" style="marker-end: none"/>
+`, sx, sy, c.X, c.Y, b.Junction.X, b.Junction.Y, edgeClass))
+		// Labels go nearer the states than the junction, where the
+		// branches crowd together.
+		at, dir := quadAt(Point{sx, sy}, c, b.Junction, 0.4)
+		l := math.Hypot(dir.X, dir.Y)
+		if l < 1e-9 {
+			l = 1
+		}
+		labels.write(sb, at.X-dir.Y/l*10, at.Y+dir.X/l*10, labelClass, a.label)
+		closeGroup(sb, a.group)
+		trunkHL = trunkHL || a.hl
+	}
+	edgeClass, _ := edgeClasses("transition", trunkHL)
+	ex, ey := towardsPoint(to[0], to[1], b.Junction.X, b.Junction.Y, r+2)
+	sb.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="%s"/>
+`, b.Junction.X, b.Junction.Y, ex, ey, edgeClass))
+}
+
+// towardsPoint returns the point at distance d from (x, y) in the
+// direction of (tx, ty).
+func towardsPoint(x, y, tx, ty, d float64) (float64, float64) {
+	l := math.Hypot(tx-x, ty-y)
+	if l < 1e-9 {
+		return x, y
+	}
+	return x + (tx-x)/l*d, y + (ty-y)/l*d
+}
+
+// closeGroup ends a group opened with the given tag, if there is one.
+func closeGroup(sb *strings.Builder, open string) {
+	if open != "" {
+		sb.WriteString("</g>\n")
+	}
+}
+
+// drawBidiTransition draws a pair of opposing edges; group1 and group2
+// are the optional group tags wrapping each (see closeGroup).
+func drawBidiTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label1, label2 string, fontSize int, hl1, hl2 bool, group1, group2 string, labels *svgLabels) {
+	edgeClass1, labelClass1 := edgeClasses("transition", hl1)
+	edgeClass2, labelClass2 := edgeClasses("transition", hl2)
+
 	dx := x2 - x1
 	dy := y2 - y1
 	dist := math.Sqrt(dx*dx + dy*dy)
@@ -571,12 +970,13 @@ func drawBidiTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label1,
 	cx1 := (x1+x2)/2 + px
 	cy1 := (y1+y2)/2 + py
 
-	sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="transition"/>
-`, sx1, sy1, cx1, cy1, ex1, ey1))
+	sb.WriteString(group1)
+	sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="%s"/>
+`, sx1, sy1, cx1, cy1, ex1, ey1, edgeClass1))
 
 	// Label for forward
-	sb.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" class="trans-label" text-anchor="middle">%s</text>
-`, cx1, cy1-5, html.EscapeString(label1)))
+	labels.write(sb, cx1, cy1-5, labelClass1, label1)
+	closeGroup(sb, group1)
 
 	// Reverse arrow (curved down)
 	sx2 := x2 - nx*r
@@ -586,19 +986,25 @@ func drawBidiTransition(sb *strings.Builder, x1, y1, x2, y2, r float64, label1,
 	cx2 := (x1+x2)/2 - px
 	cy2 := (y1+y2)/2 - py
 
-	sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="transition"/>
-`, sx2, sy2, cx2, cy2, ex2, ey2))
+	sb.WriteString(group2)
+	sb.WriteString(fmt.Sprintf(`<path d="M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f" class="%s"/>
+`, sx2, sy2, cx2, cy2, ex2, ey2, edgeClass2))
 
 	// Label for reverse
-	sb.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" class="trans-label" text-anchor="middle">%s</text>
-`, cx2, cy2+12, html.EscapeString(label2)))
+	labels.write(sb, cx2, cy2+12, labelClass2, label2)
+	closeGroup(sb, group2)
 }
 
-func drawSelfLoop(sb *strings.Builder, x, y, rx, ry float64, label string, fontSize int, canvasW, canvasH float64) {
+// drawSelfLoop draws a self-loop on the side of the state that
+// ChooseSelfLoopSide picks, or another if that one leaves the canvas, and
+// returns the side used.
+func drawSelfLoop(sb *strings.Builder, x, y, rx, ry float64, label string, fontSize int, canvasW, canvasH float64, hl bool, around *LoopSurroundings, labels *svgLabels) LoopSide {
+	edgeClass, labelClass := edgeClasses("transition-self", hl)
+
 	state := Ellipse{CX: x, CY: y, RX: rx, RY: ry}
 
 	// Choose the best side for the loop
-	side := ChooseSelfLoopSide(state, canvasW, canvasH, nil)
+	side := ChooseSelfLoopSide(state, canvasW, canvasH, around)
 
 	params := DefaultSelfLoopParams()
 	params.Side = side
@@ -628,18 +1034,16 @@ func drawSelfLoop(sb *strings.Builder, x, y, rx, ry float64, label string, fontS
 
 	// SVG cubic Bézier path: M start C ctrl1 ctrl2 end C ctrl3 ctrl4 end2
 	sb.WriteString(fmt.Sprintf(
-		`<path d="M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f" class="transition-self"/>
+		`<path d="M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f" class="%s"/>
 `,
 		points[0].X, points[0].Y,
 		points[1].X, points[1].Y, points[2].X, points[2].Y, points[3].X, points[3].Y,
-		points[4].X, points[4].Y, points[5].X, points[5].Y, points[6].X, points[6].Y))
+		points[4].X, points[4].Y, points[5].X, points[5].Y, points[6].X, points[6].Y, edgeClass))
 
 	// Label
 	labelW := float64(len(label)*fontSize) * 0.6
 	labelH := float64(fontSize)
 	labelPos := SelfLoopLabelPosition(points, params.Side, labelW, labelH, 1.0)
-	sb.WriteString(fmt.Sprintf(
-		`<text x="%.1f" y="%.1f" class="trans-label" text-anchor="middle">%s</text>
-`,
-		labelPos.X, labelPos.Y, html.EscapeString(label)))
+	labels.write(sb, labelPos.X, labelPos.Y, labelClass, label)
+	return params.Side
 }
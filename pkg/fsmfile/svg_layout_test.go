@@ -0,0 +1,159 @@
+package fsmfile
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// stateLabelPositions extracts the centre of each state label in an SVG.
+func stateLabelPositions(t *testing.T, svg string) map[string][2]float64 {
+	t.Helper()
+	re := regexp.MustCompile(`<text x="([-0-9.]+)" y="([-0-9.]+)" class="state-label">([^<]*)</text>`)
+	pos := make(map[string][2]float64)
+	for _, m := range re.FindAllStringSubmatch(svg, -1) {
+		x, _ := strconv.ParseFloat(m[1], 64)
+		y, _ := strconv.ParseFloat(m[2], 64)
+		pos[m[3]] = [2]float64{x, y}
+	}
+	return pos
+}
+
+func TestSVGUseLayout(t *testing.T) {
+	f := fsm.New(fsm.TypeDFA)
+	for _, s := range []string{"a", "b", "c", "d"} {
+		f.AddState(s)
+	}
+	f.AddInput("x")
+	f.AddTransition("a", strp("x"), []string{"b"}, nil)
+	f.AddTransition("b", strp("x"), []string{"c"}, nil)
+	f.AddTransition("c", strp("x"), []string{"d"}, nil)
+	f.SetInitial("a")
+
+	// A hand-tuned arrangement, saved and read back as fsmedit would:
+	// c far left, b top right, a bottom right; d has no saved position.
+	path := filepath.Join(t.TempDir(), "m.fsm")
+	saved := map[string][2]int{"a": {60, 20}, "b": {60, 2}, "c": {2, 10}}
+	if err := WriteFSMFileWithLayout(path, f, true, saved, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, layout, err := ReadFSMFileWithLayout(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultSVGOptions()
+	opts.UseLayout = layout
+	pos := stateLabelPositions(t, GenerateSVGNative(f, opts))
+	if len(pos) != 4 {
+		t.Fatalf("found %d state labels, want 4", len(pos))
+	}
+	if !(pos["c"][0] < pos["a"][0] && pos["a"][0] == pos["b"][0]) {
+		t.Errorf("horizontal arrangement not kept: %v", pos)
+	}
+	if !(pos["b"][1] < pos["c"][1] && pos["c"][1] < pos["a"][1]) {
+		t.Errorf("vertical arrangement not kept: %v", pos)
+	}
+	// d, with no saved position, goes next to c, its only neighbour.
+	dist := func(a, b string) float64 {
+		return math.Hypot(pos[a][0]-pos[b][0], pos[a][1]-pos[b][1])
+	}
+	if dist("d", "c") >= dist("d", "a") || dist("d", "c") >= dist("d", "b") {
+		t.Errorf("unsaved state d should be placed next to c: %v", pos)
+	}
+
+	// A layout for some other machine falls back to automatic layout.
+	opts.UseLayout = &Layout{States: map[string]StateLayout{"zz": {1, 1}}}
+	auto := DefaultSVGOptions()
+	got := stateLabelPositions(t, GenerateSVGNative(f, opts))
+	want := stateLabelPositions(t, GenerateSVGNative(f, auto))
+	if !reflect.DeepEqual(got, want) {
+		t.Error("a layout without any of the machine's states should be ignored")
+	}
+}
+
+func TestSVGTransitionLabelsSeparated(t *testing.T) {
+	// Every state goes to every other on its own input: far more labels
+	// than fit where their edges would put them.
+	f := fsm.New(fsm.TypeNFA)
+	for i := 0; i < 6; i++ {
+		f.AddState("s" + strconv.Itoa(i))
+	}
+	f.SetInitial("s0")
+	for i := 0; i < 6; i++ {
+		for j := 0; j < 6; j++ {
+			if i != j {
+				f.AddTransition("s"+strconv.Itoa(i), strp("go"+strconv.Itoa(j)), []string{"s" + strconv.Itoa(j)}, nil)
+			}
+		}
+	}
+	opts := DefaultSVGOptions()
+	svg := GenerateSVGNative(f, opts)
+	if svg != GenerateSVGNative(f, opts) {
+		t.Error("SVG differs between runs")
+	}
+	if strings.Contains(svg, "<!--label:") {
+		t.Error("label placeholder left in the SVG")
+	}
+
+	size := float64(opts.FontSize - 2)
+	re := regexp.MustCompile(`<text x="([-0-9.]+)" y="([-0-9.]+)" class="trans-label" text-anchor="middle">([^<]*)</text>`)
+	var boxes []Rect
+	for _, m := range re.FindAllStringSubmatch(svg, -1) {
+		x, _ := strconv.ParseFloat(m[1], 64)
+		y, _ := strconv.ParseFloat(m[2], 64)
+		boxes = append(boxes, Rect{X: x, Y: y - size*0.35, W: float64(len(m[3])) * size * 0.6, H: size})
+	}
+	if len(boxes) != 30 {
+		t.Fatalf("found %d transition labels, want 30", len(boxes))
+	}
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			if RectOverlap(boxes[i], boxes[j]) > 0 {
+				t.Errorf("labels at %v and %v overlap", boxes[i], boxes[j])
+			}
+		}
+	}
+}
+
+func TestSVGSeparateEdges(t *testing.T) {
+	f := fsm.New(fsm.TypeDFA)
+	f.AddState("a")
+	f.AddState("b")
+	f.SetInitial("a")
+	for _, in := range []string{"x", "y", "z"} {
+		f.AddTransition("a", strp(in), []string{"b"}, nil)
+	}
+	f.AddTransition("b", strp("w"), []string{"a"}, nil)
+
+	re := regexp.MustCompile(`class="trans-label" text-anchor="middle">([^<]*)</text>`)
+	labelsOf := func(svg string) []string {
+		var got []string
+		for _, m := range re.FindAllStringSubmatch(svg, -1) {
+			got = append(got, m[1])
+		}
+		return got
+	}
+
+	opts := DefaultSVGOptions()
+	if got := labelsOf(GenerateSVGNative(f, opts)); !reflect.DeepEqual(got, []string{"x, y, z", "w"}) {
+		t.Errorf("default labels %q, want the inputs joined", got)
+	}
+
+	opts.SeparateEdges = true
+	svg := GenerateSVGNative(f, opts)
+	got := labelsOf(svg)
+	if !reflect.DeepEqual(got, []string{"x", "y", "z", "w"}) {
+		t.Errorf("separate labels %q, want one per transition", got)
+	}
+	curves := regexp.MustCompile(`<path d="M[-0-9.,]+ Q`).FindAllString(svg, -1)
+	if len(curves) != 4 {
+		t.Errorf("found %d curves, want 4", len(curves))
+	}
+}
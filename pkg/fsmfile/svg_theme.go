@@ -0,0 +1,224 @@
+package fsmfile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Theme sets the colours and font of a native SVG rendering. Colours are
+// any CSS colour value. Empty fields take the value from DefaultTheme, so
+// a theme can override just the fields it cares about.
+type Theme struct {
+	Name       string
+	Background string
+	FontFamily string
+
+	StateFill       string // ordinary states
+	StateStroke     string
+	InitialFill     string
+	InitialStroke   string
+	AcceptingFill   string
+	AcceptingStroke string
+	BothFill        string // initial and accepting
+	BothStroke      string
+	LinkedFill      string // states delegating to another machine
+	LinkedStroke    string
+
+	Edge      string // transitions and their arrowheads
+	SelfLoop  string
+	Text      string // state labels and the title
+	LabelText string // transition labels
+	MutedText string // Moore outputs
+	Highlight string // traced states and transitions (see Highlight)
+}
+
+// DefaultTheme is the original palette: light fills with green initial,
+// orange accepting, blue initial-and-accepting, and purple linked states.
+func DefaultTheme() Theme {
+	return Theme{
+		Name:            "default",
+		Background:      "white",
+		FontFamily:      "sans-serif",
+		StateFill:       "white",
+		StateStroke:     "#333",
+		InitialFill:     "#e8f5e9",
+		InitialStroke:   "#2e7d32",
+		AcceptingFill:   "#fff3e0",
+		AcceptingStroke: "#e65100",
+		BothFill:        "#e3f2fd",
+		BothStroke:      "#1565c0",
+		LinkedFill:      "#f3e5f5",
+		LinkedStroke:    "#8e24aa",
+		Edge:            "#333",
+		SelfLoop:        "#666",
+		Text:            "#000",
+		LabelText:       "#333",
+		MutedText:       "#666",
+		Highlight:       "#d32f2f",
+	}
+}
+
+// themes holds the named presets selectable with ThemeByName.
+var themes = map[string]Theme{
+	"default": DefaultTheme(),
+	"dark": {
+		Name:            "dark",
+		Background:      "#1e1e1e",
+		StateFill:       "#2d2d2d",
+		StateStroke:     "#c8c8c8",
+		InitialFill:     "#1b3a1f",
+		InitialStroke:   "#81c784",
+		AcceptingFill:   "#3e2a12",
+		AcceptingStroke: "#ffb74d",
+		BothFill:        "#142a40",
+		BothStroke:      "#64b5f6",
+		LinkedFill:      "#2f1c36",
+		LinkedStroke:    "#ce93d8",
+		Edge:            "#c8c8c8",
+		SelfLoop:        "#9e9e9e",
+		Text:            "#eeeeee",
+		LabelText:       "#d0d0d0",
+		MutedText:       "#9e9e9e",
+		Highlight:       "#ff5252",
+	},
+	"mono": {
+		Name:            "mono",
+		StateStroke:     "#000",
+		InitialFill:     "#f0f0f0",
+		InitialStroke:   "#000",
+		AcceptingFill:   "white",
+		AcceptingStroke: "#000",
+		BothFill:        "#f0f0f0",
+		BothStroke:      "#000",
+		LinkedFill:      "#e0e0e0",
+		LinkedStroke:    "#000",
+		Edge:            "#000",
+		SelfLoop:        "#000",
+		LabelText:       "#000",
+		MutedText:       "#444",
+		Highlight:       "#000",
+	},
+	"print": {
+		Name:       "print",
+		FontFamily: "serif",
+		Edge:       "#000",
+		SelfLoop:   "#000",
+		LabelText:  "#000",
+	},
+}
+
+// ThemeByName returns a preset theme ("default", "dark", "mono", or
+// "print"), with unset fields filled from DefaultTheme.
+func ThemeByName(name string) (Theme, bool) {
+	t, ok := themes[strings.ToLower(name)]
+	if !ok {
+		return Theme{}, false
+	}
+	return t.resolved(), true
+}
+
+// ThemeNames lists the preset theme names in sorted order.
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolved returns t with every empty field taken from DefaultTheme.
+func (t Theme) resolved() Theme {
+	d := DefaultTheme()
+	fill := func(v *string, def string) {
+		if *v == "" {
+			*v = def
+		}
+	}
+	fill(&t.Name, "custom")
+	fill(&t.Background, d.Background)
+	fill(&t.FontFamily, d.FontFamily)
+	fill(&t.StateFill, d.StateFill)
+	fill(&t.StateStroke, d.StateStroke)
+	fill(&t.InitialFill, d.InitialFill)
+	fill(&t.InitialStroke, d.InitialStroke)
+	fill(&t.AcceptingFill, d.AcceptingFill)
+	fill(&t.AcceptingStroke, d.AcceptingStroke)
+	fill(&t.BothFill, d.BothFill)
+	fill(&t.BothStroke, d.BothStroke)
+	fill(&t.LinkedFill, d.LinkedFill)
+	fill(&t.LinkedStroke, d.LinkedStroke)
+	fill(&t.Edge, d.Edge)
+	fill(&t.SelfLoop, d.SelfLoop)
+	fill(&t.Text, d.Text)
+	fill(&t.LabelText, d.LabelText)
+	fill(&t.MutedText, d.MutedText)
+	fill(&t.Highlight, d.Highlight)
+	return t
+}
+
+// svgDefs renders the arrowhead markers and stylesheet for a theme. The
+// highlight marker and rules are included only when highlight is set.
+func (t Theme) svgDefs(stateLabelSize, labelSize, titleSize int, highlight bool) string {
+	font := cssValue(t.FontFamily)
+	marker, rules := "", ""
+	if highlight {
+		hl := cssValue(t.Highlight)
+		marker = fmt.Sprintf(`  <marker id="arrowhead-highlight" markerWidth="10" markerHeight="7" refX="9" refY="3.5" orient="auto">
+    <polygon points="0 0, 10 3.5, 0 7" fill="%s"/>
+  </marker>
+`, hl)
+		rules = fmt.Sprintf(`  .state-highlight { stroke: %s; stroke-width: 3.5; }
+  .transition-highlight { stroke: %s; stroke-width: 3; marker-end: url(#arrowhead-highlight); }
+  .trans-label-highlight { fill: %s; font-weight: bold; }
+`, hl, hl, hl)
+	}
+	return fmt.Sprintf(`<defs>
+  <marker id="arrowhead" markerWidth="10" markerHeight="7" refX="9" refY="3.5" orient="auto">
+    <polygon points="0 0, 10 3.5, 0 7" fill="%s"/>
+  </marker>
+  <marker id="arrowhead-self" markerWidth="10" markerHeight="7" refX="9" refY="3.5" orient="auto">
+    <polygon points="0 0, 10 3.5, 0 7" fill="%s"/>
+  </marker>
+%s</defs>
+<style>
+  .state { fill: %s; stroke: %s; stroke-width: 2; }
+  .state-initial { fill: %s; stroke: %s; stroke-width: 2; }
+  .state-accepting { fill: %s; stroke: %s; stroke-width: 2; }
+  .state-both { fill: %s; stroke: %s; stroke-width: 2; }
+  .state-linked { fill: %s; stroke: %s; stroke-width: 2; }
+  .state-label { font-family: %s; font-size: %dpx; fill: %s; text-anchor: middle; dominant-baseline: middle; }
+  .transition { fill: none; stroke: %s; stroke-width: 1.5; marker-end: url(#arrowhead); }
+  .transition-self { fill: none; stroke: %s; stroke-width: 1.5; marker-end: url(#arrowhead-self); }
+  .trans-label { font-family: %s; font-size: %dpx; fill: %s; }
+  .title { font-family: %s; font-size: %dpx; fill: %s; font-weight: bold; text-anchor: middle; }
+  .moore-output { font-family: %s; font-size: %dpx; fill: %s; font-style: italic; text-anchor: middle; }
+  .linked-label { font-family: %s; font-size: %dpx; fill: %s; font-style: italic; text-anchor: middle; }
+%s</style>
+`,
+		cssValue(t.Edge), cssValue(t.SelfLoop), marker,
+		cssValue(t.StateFill), cssValue(t.StateStroke),
+		cssValue(t.InitialFill), cssValue(t.InitialStroke),
+		cssValue(t.AcceptingFill), cssValue(t.AcceptingStroke),
+		cssValue(t.BothFill), cssValue(t.BothStroke),
+		cssValue(t.LinkedFill), cssValue(t.LinkedStroke),
+		font, stateLabelSize, cssValue(t.Text),
+		cssValue(t.Edge), cssValue(t.SelfLoop),
+		font, labelSize, cssValue(t.LabelText),
+		font, titleSize, cssValue(t.Text),
+		font, labelSize, cssValue(t.MutedText),
+		font, labelSize, cssValue(t.LinkedStroke), rules)
+}
+
+// cssValue strips characters that could end a CSS declaration or the
+// surrounding element, so a theme value cannot break the document.
+func cssValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ';', '{', '}', '<', '>', '&', '"':
+			return -1
+		}
+		return r
+	}, s)
+}
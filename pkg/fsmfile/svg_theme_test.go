@@ -0,0 +1,89 @@
+package fsmfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func themeTestFSM() *fsm.FSM {
+	f := fsm.New(fsm.TypeDFA)
+	f.AddState("a")
+	f.AddState("b")
+	f.AddInput("x")
+	f.AddTransition("a", strp("x"), []string{"b"}, nil)
+	f.SetInitial("a")
+	f.SetAccepting([]string{"b"})
+	return f
+}
+
+func TestSVGTheme_DefaultPalette(t *testing.T) {
+	svg := GenerateSVGNative(themeTestFSM(), DefaultSVGOptions())
+	for _, want := range []string{
+		".state-initial { fill: #e8f5e9; stroke: #2e7d32;",
+		".state-accepting { fill: #fff3e0; stroke: #e65100;",
+		`<rect width="800" height="600" fill="white"/>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("default SVG lacks %q", want)
+		}
+	}
+}
+
+func TestSVGTheme_ZeroThemeIsDefault(t *testing.T) {
+	opts := DefaultSVGOptions()
+	withDefault := GenerateSVGNative(themeTestFSM(), opts)
+	opts.Theme = Theme{}
+	if got := GenerateSVGNative(themeTestFSM(), opts); got != withDefault {
+		t.Error("a zero Theme should render like DefaultTheme")
+	}
+}
+
+func TestSVGTheme_Presets(t *testing.T) {
+	for _, name := range ThemeNames() {
+		theme, ok := ThemeByName(name)
+		if !ok {
+			t.Fatalf("ThemeByName(%q) failed", name)
+		}
+		opts := DefaultSVGOptions()
+		opts.Title = "T"
+		opts.Theme = theme
+		svg := GenerateSVGNative(themeTestFSM(), opts)
+		bg := `fill="` + theme.Background + `"/>`
+		if !strings.Contains(svg, bg) {
+			t.Errorf("%s: background %q not used", name, theme.Background)
+		}
+		if strings.Index(svg, bg) > strings.Index(svg, `class="title"`) {
+			t.Errorf("%s: background drawn over the title", name)
+		}
+	}
+	if _, ok := ThemeByName("nope"); ok {
+		t.Error("unknown theme accepted")
+	}
+	dark, _ := ThemeByName("DARK")
+	if dark.Background == "white" {
+		t.Error("theme names should be case-insensitive")
+	}
+}
+
+func TestSVGTheme_PartialOverride(t *testing.T) {
+	opts := DefaultSVGOptions()
+	opts.Theme = Theme{AcceptingStroke: "red", FontFamily: "Fira Sans, sans-serif"}
+	svg := GenerateSVGNative(themeTestFSM(), opts)
+	if !strings.Contains(svg, ".state-accepting { fill: #fff3e0; stroke: red;") {
+		t.Error("override not applied, or unset fill not defaulted")
+	}
+	if !strings.Contains(svg, "font-family: Fira Sans, sans-serif;") {
+		t.Error("font family not applied")
+	}
+}
+
+func TestSVGTheme_ValuesCannotEscapeStyle(t *testing.T) {
+	opts := DefaultSVGOptions()
+	opts.Theme = Theme{Edge: `red; } </style><script>alert(1)</script>`}
+	svg := GenerateSVGNative(themeTestFSM(), opts)
+	if strings.Contains(svg, "<script>") || strings.Count(svg, "</style>") != 1 {
+		t.Error("theme value broke out of the stylesheet")
+	}
+}
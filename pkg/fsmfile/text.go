@@ -0,0 +1,745 @@
+package fsmfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// The text format (.fsmt) is a line-oriented form of a machine, written
+// to be edited by hand and reviewed in diffs: one fact per line, in a
+// fixed order. A declaration starts at the beginning of a line, and the
+// indented lines below it add details to it:
+//
+//	type mealy
+//	name Turnstile
+//	inputs coin push
+//	outputs click open alarm
+//
+//	state locked initial
+//	state unlocked
+//
+//	locked -> unlocked on coin / click
+//	locked -> locked on push / alarm
+//	  weight 2
+//	  meta owner alice
+//
+// A transition is "from -> to... [on input] [/ output]"; without "on"
+// it is an epsilon transition. Names are bare words, or Go-quoted
+// strings when they contain spaces, quotes, or "#" at the start, or are
+// "->", "/", or "on". "#" starts a comment. ToText documents every
+// declaration.
+
+// TextError is a syntax error in the text format, at a line (1-based).
+type TextError struct {
+	Line int
+	Msg  string
+}
+
+func (e *TextError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ToText writes f in the text format. Declarations come in this
+// order, each only when it has something to say:
+//
+//	type T                   machine type
+//	name N                   machine name
+//	description D
+//	vocabulary V
+//	meta KEY VALUE           machine metadata, by key
+//	inputs A B ...           the alphabet, in order
+//	outputs X Y ...          the output alphabet
+//	stack Z ...              PDA stack alphabet
+//	stack-start Z
+//	class C                  class definitions, by name
+//	  parent P
+//	  property NAME TYPE
+//	  port NAME DIR [PIN [GROUP]]
+//	  kicad-part P
+//	  kicad-footprint F
+//	state S [initial] [accepting]   states, in order
+//	  output O               Moore output
+//	  link M                 linked machine
+//	  class C
+//	  set PROPERTY VALUE     property value, as JSON to the end of the line
+//	  meta KEY VALUE
+//	initial S                an initial state that is not a state
+//	FROM -> TO ... [on I] [/ O]     transitions, in order
+//	  probability P
+//	  weight W
+//	  pop Z
+//	  push A ...
+//	  meta KEY VALUE
+//	net N INSTANCE PORT ...  nets, in order
+//
+// The default_state class is left out while it is unchanged.
+func ToText(f *fsm.FSM) []byte {
+	var b bytes.Buffer
+	line := func(indent bool, words ...string) {
+		if indent {
+			b.WriteString("  ")
+		}
+		b.WriteString(strings.Join(words, " "))
+		b.WriteByte('\n')
+	}
+	blank := func() {
+		if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n\n")) {
+			b.WriteByte('\n')
+		}
+	}
+	meta := func(m map[string]string) {
+		for _, k := range sortedStrings(m) {
+			line(true, "meta", textWord(k), textWord(m[k]))
+		}
+	}
+
+	line(false, "type", textWord(string(f.Type)))
+	if f.Name != "" {
+		line(false, "name", textWord(f.Name))
+	}
+	if f.Description != "" {
+		line(false, "description", textWord(f.Description))
+	}
+	if f.Vocabulary != "" {
+		line(false, "vocabulary", textWord(f.Vocabulary))
+	}
+	for _, k := range sortedStrings(f.Metadata) {
+		line(false, "meta", textWord(k), textWord(f.Metadata[k]))
+	}
+	blank()
+	// An empty inputs or outputs line still counts: it keeps ParseText
+	// from declaring the symbols the machine uses.
+	line(false, append([]string{"inputs"}, textWords(f.Alphabet)...)...)
+	if len(f.OutputAlphabet) > 0 || f.Type == fsm.TypeMealy || f.Type == fsm.TypeMoore {
+		line(false, append([]string{"outputs"}, textWords(f.OutputAlphabet)...)...)
+	}
+	if len(f.StackAlphabet) > 0 {
+		line(false, append([]string{"stack"}, textWords(f.StackAlphabet)...)...)
+	}
+	if f.StackStart != "" {
+		line(false, "stack-start", textWord(f.StackStart))
+	}
+
+	for _, name := range sortedStrings(f.Classes) {
+		c := f.Classes[name]
+		if name == fsm.DefaultClassName && reflect.DeepEqual(c, fsm.NewDefaultClass()) {
+			continue
+		}
+		blank()
+		line(false, "class", textWord(name))
+		if c.Parent != "" {
+			line(true, "parent", textWord(c.Parent))
+		}
+		for _, p := range c.Properties {
+			line(true, "property", textWord(p.Name), textWord(string(p.Type)))
+		}
+		for _, p := range c.Ports {
+			words := []string{"port", textWord(p.Name), textWord(string(p.Direction))}
+			if p.PinNumber != 0 || p.Group != "" {
+				words = append(words, strconv.Itoa(p.PinNumber))
+			}
+			if p.Group != "" {
+				words = append(words, textWord(p.Group))
+			}
+			line(true, words...)
+		}
+		if c.KiCadPart != "" {
+			line(true, "kicad-part", textWord(c.KiCadPart))
+		}
+		if c.KiCadFootprint != "" {
+			line(true, "kicad-footprint", textWord(c.KiCadFootprint))
+		}
+	}
+
+	blank()
+	for _, s := range f.States {
+		words := []string{"state", textWord(s)}
+		if s == f.Initial {
+			words = append(words, "initial")
+		}
+		if f.IsAccepting(s) {
+			words = append(words, "accepting")
+		}
+		line(false, words...)
+		if out, ok := f.StateOutputs[s]; ok {
+			line(true, "output", textWord(out))
+		}
+		if m, ok := f.LinkedMachines[s]; ok {
+			line(true, "link", textWord(m))
+		}
+		if c, ok := f.StateClasses[s]; ok {
+			line(true, "class", textWord(c))
+		}
+		if props := f.StateProperties[s]; hasNonZero(props) {
+			for _, p := range sortedStrings(props) {
+				v, err := json.Marshal(props[p])
+				if err != nil {
+					continue
+				}
+				line(true, "set", textWord(p), string(v))
+			}
+		}
+		meta(f.StateMetadata[s])
+	}
+	if f.Initial != "" && !f.HasState(f.Initial) {
+		line(false, "initial", textWord(f.Initial))
+	}
+
+	blank()
+	for _, t := range f.Transitions {
+		words := append([]string{textWord(t.From), "->"}, textWords(t.To)...)
+		if t.Input != nil {
+			words = append(words, "on", textWord(*t.Input))
+		}
+		if t.Output != nil {
+			words = append(words, "/", textWord(*t.Output))
+		}
+		line(false, words...)
+		if t.Probability != nil {
+			line(true, "probability", strconv.FormatFloat(*t.Probability, 'g', -1, 64))
+		}
+		if t.Weight != nil {
+			line(true, "weight", strconv.FormatFloat(*t.Weight, 'g', -1, 64))
+		}
+		if t.Pop != nil {
+			line(true, "pop", textWord(*t.Pop))
+		}
+		if len(t.Push) > 0 {
+			line(true, append([]string{"push"}, textWords(t.Push)...)...)
+		}
+		meta(t.Metadata)
+	}
+
+	blank()
+	for _, n := range f.Nets {
+		words := []string{"net", textWord(n.Name)}
+		for _, ep := range n.Endpoints {
+			words = append(words, textWord(ep.Instance), textWord(ep.Port))
+		}
+		line(false, words...)
+	}
+	return append(bytes.TrimRight(b.Bytes(), "\n"), '\n')
+}
+
+// hasNonZero reports whether any property value is not its type's zero,
+// as ToJSON decides whether to write a state's properties.
+func hasNonZero(props map[string]interface{}) bool {
+	for _, v := range props {
+		if !isZeroValue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// textWord writes a name as a bare word when it reads back as itself,
+// and quoted otherwise.
+func textWord(s string) string {
+	switch s {
+	case "", "->", "/", "on":
+		return strconv.Quote(s)
+	}
+	if strings.HasPrefix(s, "#") || strings.HasPrefix(s, `"`) {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '"' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+func textWords(names []string) []string {
+	words := make([]string, len(names))
+	for i, n := range names {
+		words[i] = textWord(n)
+	}
+	return words
+}
+
+// textToken is a word of a line; quoted words are never keywords. start
+// and end are its byte offsets in the line, quotes included.
+type textToken struct {
+	text       string
+	quoted     bool
+	start, end int
+}
+
+// is reports whether t is the bare keyword k.
+func (t textToken) is(k string) bool {
+	return !t.quoted && t.text == k
+}
+
+// splitTextLine splits a line into words, dropping a comment. With a
+// positive limit it stops after that many words and returns the rest of
+// the line as it is.
+func splitTextLine(s string, limit int) ([]textToken, string, error) {
+	var tokens []textToken
+	i := 0
+	for limit <= 0 || len(tokens) < limit {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r') {
+			i++
+		}
+		if i == len(s) || s[i] == '#' {
+			return tokens, "", nil
+		}
+		start := i
+		if s[i] == '"' {
+			// Find the closing quote, skipping escapes.
+			i++
+			for i < len(s) && s[i] != '"' {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(s) {
+				return nil, "", fmt.Errorf("unterminated string")
+			}
+			i++
+			text, err := strconv.Unquote(s[start:i])
+			if err != nil {
+				return nil, "", fmt.Errorf("malformed string %s", s[start:i])
+			}
+			tokens = append(tokens, textToken{text, true, start, i})
+			continue
+		}
+		for i < len(s) && s[i] != ' ' && s[i] != '\t' && s[i] != '\r' {
+			i++
+		}
+		tokens = append(tokens, textToken{text: s[start:i], start: start, end: i})
+	}
+	return tokens, s[i:], nil
+}
+
+// textKeywords are the declarations that start a line.
+var textKeywords = map[string]bool{
+	"type": true, "name": true, "description": true, "vocabulary": true, "meta": true,
+	"inputs": true, "outputs": true, "stack": true, "stack-start": true,
+	"class": true, "state": true, "initial": true, "net": true, "include": true,
+}
+
+// detectText reports whether data looks like the text format: its first
+// declaration is a keyword or a transition.
+func detectText(data []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		tokens, _, err := splitTextLine(sc.Text(), 0)
+		if err != nil {
+			return false
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		first := tokens[0]
+		return (!first.quoted && textKeywords[first.text]) || (len(tokens) > 2 && tokens[1].is("->"))
+	}
+	return false
+}
+
+// ParseText parses the text format (see ToText). States that are used
+// without being declared are added in the order they are first used, and
+// so are inputs and outputs when there is no inputs or outputs line.
+// Without a type, the type is inferred as for JSON. Errors are
+// *TextError.
+//
+// Include lines, which ToText never writes, are checked but not
+// resolved; see ResolveIncludes:
+//
+//	include FILE [prefix P] [machine M]
+//	  bind FRAGMENT_STATE STATE
+func ParseText(data []byte) (*fsm.FSM, error) {
+	f, _, err := parseText(data)
+	return f, err
+}
+
+// parseText is ParseText, also returning the include lines.
+func parseText(data []byte) (*fsm.FSM, []Include, error) {
+	f := fsm.New("")
+	var includes []Include
+	typed := false
+	declared := make(map[string]bool)
+	var hasInputs, hasOutputs bool
+	var usedInputs, usedOutputs []string
+	rawProps := make(map[string]map[string]interface{})
+
+	// The declaration that indented lines add to.
+	var (
+		class      *fsm.Class
+		state      string
+		transition = -1
+		include    = -1
+	)
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 16<<20)
+	for n := 1; sc.Scan(); n++ {
+		raw := sc.Text()
+		fail := func(format string, args ...interface{}) error {
+			return &TextError{Line: n, Msg: fmt.Sprintf(format, args...)}
+		}
+		indented := raw != "" && (raw[0] == ' ' || raw[0] == '\t')
+
+		// A property value is JSON, which is not split into words.
+		tokens, value, err := splitTextLine(raw, 2)
+		if err != nil || !indented || len(tokens) < 2 || !tokens[0].is("set") {
+			tokens, _, err = splitTextLine(raw, 0)
+		}
+		if err != nil {
+			return nil, nil, fail("%v", err)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		words := make([]string, len(tokens))
+		for i, t := range tokens {
+			words[i] = t.text
+		}
+		args := words[1:]
+		need := func(min, max int) error {
+			switch {
+			case len(args) < min:
+				return fail("%s needs %d argument(s)", words[0], min)
+			case max >= 0 && len(args) > max:
+				return fail("too many arguments to %s", words[0])
+			}
+			return nil
+		}
+
+		if indented {
+			if tokens[0].quoted {
+				return nil, nil, fail("expected a keyword, found %q", words[0])
+			}
+			switch {
+			case class != nil:
+				switch words[0] {
+				case "parent":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					class.Parent = args[0]
+				case "property":
+					if err := need(2, 2); err != nil {
+						return nil, nil, err
+					}
+					class.Properties = append(class.Properties, fsm.PropertyDef{Name: args[0], Type: fsm.PropertyType(args[1])})
+				case "port":
+					if err := need(2, 4); err != nil {
+						return nil, nil, err
+					}
+					p := fsm.Port{Name: args[0], Direction: fsm.PortDir(args[1])}
+					if len(args) > 2 {
+						if p.PinNumber, err = strconv.Atoi(args[2]); err != nil {
+							return nil, nil, fail("malformed pin number %q", args[2])
+						}
+					}
+					if len(args) > 3 {
+						p.Group = args[3]
+					}
+					class.Ports = append(class.Ports, p)
+				case "kicad-part":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					class.KiCadPart = args[0]
+				case "kicad-footprint":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					class.KiCadFootprint = args[0]
+				default:
+					return nil, nil, fail("unknown class detail %q", words[0])
+				}
+			case state != "":
+				switch words[0] {
+				case "output":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					f.StateOutputs[state] = args[0]
+					usedOutputs = append(usedOutputs, args[0])
+				case "link":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					f.SetLinkedMachine(state, args[0])
+				case "class":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					f.StateClasses[state] = args[0]
+				case "set":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					if strings.TrimSpace(value) == "" {
+						return nil, nil, fail("set needs a value")
+					}
+					var v interface{}
+					if err := json.Unmarshal([]byte(value), &v); err != nil {
+						return nil, nil, fail("malformed value for %s: %v", args[0], err)
+					}
+					if rawProps[state] == nil {
+						rawProps[state] = make(map[string]interface{})
+					}
+					rawProps[state][args[0]] = v
+				case "meta":
+					if err := need(2, 2); err != nil {
+						return nil, nil, err
+					}
+					f.SetStateMetadata(state, args[0], args[1])
+				default:
+					return nil, nil, fail("unknown state detail %q", words[0])
+				}
+			case transition >= 0:
+				t := &f.Transitions[transition]
+				switch words[0] {
+				case "probability", "weight":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					v, err := strconv.ParseFloat(args[0], 64)
+					if err != nil {
+						return nil, nil, fail("malformed %s %q", words[0], args[0])
+					}
+					if words[0] == "weight" {
+						t.Weight = &v
+					} else {
+						t.Probability = &v
+					}
+				case "pop":
+					if err := need(1, 1); err != nil {
+						return nil, nil, err
+					}
+					pop := args[0]
+					t.Pop = &pop
+				case "push":
+					if err := need(1, -1); err != nil {
+						return nil, nil, err
+					}
+					t.Push = append([]string(nil), args...)
+				case "meta":
+					if err := need(2, 2); err != nil {
+						return nil, nil, err
+					}
+					if t.Metadata == nil {
+						t.Metadata = make(map[string]string)
+					}
+					t.Metadata[args[0]] = args[1]
+				default:
+					return nil, nil, fail("unknown transition detail %q", words[0])
+				}
+			case include >= 0:
+				if words[0] != "bind" {
+					return nil, nil, fail("unknown include detail %q", words[0])
+				}
+				if err := need(2, 2); err != nil {
+					return nil, nil, err
+				}
+				inc := &includes[include]
+				if inc.Bind == nil {
+					inc.Bind = make(map[string]string)
+				}
+				inc.Bind[args[0]] = args[1]
+			default:
+				return nil, nil, fail("indented line outside a class, state, transition, or include")
+			}
+			continue
+		}
+
+		class, state, transition, include = nil, "", -1, -1
+		if len(tokens) > 1 && tokens[1].is("->") {
+			t, err := parseTextTransition(tokens)
+			if err != nil {
+				return nil, nil, fail("%v", err)
+			}
+			f.AddState(t.From)
+			for _, s := range t.To {
+				f.AddState(s)
+			}
+			if t.Input != nil {
+				usedInputs = append(usedInputs, *t.Input)
+			}
+			if t.Output != nil {
+				usedOutputs = append(usedOutputs, *t.Output)
+			}
+			f.Transitions = append(f.Transitions, t)
+			transition = len(f.Transitions) - 1
+			continue
+		}
+		if tokens[0].quoted {
+			return nil, nil, fail("expected a declaration, found %q", words[0])
+		}
+		switch words[0] {
+		case "type":
+			if err := need(1, 1); err != nil {
+				return nil, nil, err
+			}
+			f.Type = fsm.Type(args[0])
+			typed = true
+		case "name", "description", "vocabulary", "stack-start", "initial":
+			if err := need(1, 1); err != nil {
+				return nil, nil, err
+			}
+			switch words[0] {
+			case "name":
+				f.Name = args[0]
+			case "description":
+				f.Description = args[0]
+			case "vocabulary":
+				f.Vocabulary = args[0]
+			case "stack-start":
+				f.StackStart = args[0]
+			case "initial":
+				f.Initial = args[0]
+			}
+		case "meta":
+			if err := need(2, 2); err != nil {
+				return nil, nil, err
+			}
+			if f.Metadata == nil {
+				f.Metadata = make(map[string]string)
+			}
+			f.Metadata[args[0]] = args[1]
+		case "inputs":
+			hasInputs = true
+			for _, a := range args {
+				f.AddInput(a)
+			}
+		case "outputs":
+			hasOutputs = true
+			for _, a := range args {
+				f.AddOutput(a)
+			}
+		case "stack":
+			f.StackAlphabet = append(f.StackAlphabet, args...)
+		case "class":
+			if err := need(1, 1); err != nil {
+				return nil, nil, err
+			}
+			class = &fsm.Class{Name: args[0], Properties: []fsm.PropertyDef{}}
+			f.Classes[args[0]] = class
+		case "state":
+			if err := need(1, 3); err != nil {
+				return nil, nil, err
+			}
+			state = args[0]
+			if declared[state] {
+				return nil, nil, fail("state %q declared twice", state)
+			}
+			declared[state] = true
+			f.AddState(state)
+			for _, flag := range tokens[2:] {
+				switch {
+				case flag.is("initial"):
+					f.Initial = state
+				case flag.is("accepting"):
+					f.Accepting = append(f.Accepting, state)
+				default:
+					return nil, nil, fail("unknown state flag %q (use initial or accepting)", flag.text)
+				}
+			}
+		case "net":
+			if err := need(1, -1); err != nil {
+				return nil, nil, err
+			}
+			if len(args)%2 != 1 {
+				return nil, nil, fail("net endpoints come in pairs of instance and port")
+			}
+			net := fsm.Net{Name: args[0]}
+			for i := 1; i < len(args); i += 2 {
+				net.Endpoints = append(net.Endpoints, fsm.NetEndpoint{Instance: args[i], Port: args[i+1]})
+			}
+			f.Nets = append(f.Nets, net)
+		case "include":
+			if err := need(1, 5); err != nil {
+				return nil, nil, err
+			}
+			inc := Include{File: args[0]}
+			for i := 1; i < len(args); i += 2 {
+				if i+1 == len(args) {
+					return nil, nil, fail("%s needs a value", args[i])
+				}
+				switch args[i] {
+				case "prefix":
+					inc.Prefix = args[i+1]
+				case "machine":
+					inc.Machine = args[i+1]
+				default:
+					return nil, nil, fail("unknown include option %q (use prefix or machine)", args[i])
+				}
+			}
+			includes = append(includes, inc)
+			include = len(includes) - 1
+		default:
+			return nil, nil, fail("unknown declaration %q", words[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if !hasInputs {
+		for _, in := range usedInputs {
+			f.AddInput(in)
+		}
+	}
+	if !hasOutputs {
+		for _, out := range usedOutputs {
+			f.AddOutput(out)
+		}
+	}
+	if !typed {
+		f.Type = inferType(f)
+	}
+	for state, props := range rawProps {
+		coerced := make(map[string]interface{}, len(props))
+		for k, v := range props {
+			coerced[k] = coercePropertyValue(f, state, k, v)
+		}
+		f.StateProperties[state] = coerced
+	}
+	return f, includes, nil
+}
+
+// parseTextTransition reads "from -> to... [on input] [/ output]".
+func parseTextTransition(tokens []textToken) (fsm.Transition, error) {
+	t := fsm.Transition{From: tokens[0].text}
+	rest := tokens[2:]
+	for len(rest) > 0 && !rest[0].is("on") && !rest[0].is("/") {
+		t.To = append(t.To, rest[0].text)
+		rest = rest[1:]
+	}
+	if len(t.To) == 0 {
+		return t, fmt.Errorf("transition from %q has no target", t.From)
+	}
+	if len(rest) > 0 && rest[0].is("on") {
+		if len(rest) < 2 {
+			return t, fmt.Errorf("on needs an input")
+		}
+		input := rest[1].text
+		t.Input = &input
+		rest = rest[2:]
+	}
+	if len(rest) > 0 && rest[0].is("/") {
+		if len(rest) < 2 {
+			return t, fmt.Errorf("/ needs an output")
+		}
+		output := rest[1].text
+		t.Output = &output
+		rest = rest[2:]
+	}
+	if len(rest) > 0 {
+		return t, fmt.Errorf("unexpected %q after transition", rest[0].text)
+	}
+	return t, nil
+}
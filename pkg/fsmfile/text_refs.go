@@ -0,0 +1,180 @@
+package fsmfile
+
+import "strings"
+
+// TextRefKind is the kind of name a TextRef refers to.
+type TextRefKind string
+
+const (
+	TextState       TextRefKind = "state"
+	TextInput       TextRefKind = "input"
+	TextOutput      TextRefKind = "output"
+	TextClass       TextRefKind = "class"
+	TextStackSymbol TextRefKind = "stack"
+)
+
+// TextRef is an occurrence of a name in text-format source, for editors:
+// finding a state's declaration, renaming it everywhere, and completing
+// names.
+type TextRef struct {
+	Kind TextRefKind
+	Name string
+	Line int // 1-based, as in TextError
+	// Start and End are the byte offsets of the name in its line, quotes
+	// included; End is exclusive.
+	Start, End int
+	// Decl is set on declarations (state, class, inputs, outputs, and
+	// stack lines), and unset on uses.
+	Decl bool
+	// Transition is the index of the transition whose line the name is
+	// on, or -1.
+	Transition int
+}
+
+// TextRefs returns the names in text-format source, in order. Unlike
+// ParseText it does not stop at errors: lines it cannot read are skipped.
+func TextRefs(data []byte) []TextRef {
+	var refs []TextRef
+	// The declaration indented lines belong to, as in ParseText.
+	block, transition, transitions := "", -1, 0
+	for n, raw := range strings.Split(string(data), "\n") {
+		tokens, _, err := splitTextLine(raw, 0)
+		if err != nil {
+			// A property value is JSON, which need not split into words.
+			if tokens, _, err = splitTextLine(raw, 2); err != nil {
+				continue
+			}
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		add := func(kind TextRefKind, decl bool, tokens ...textToken) {
+			for _, t := range tokens {
+				refs = append(refs, TextRef{Kind: kind, Name: t.text, Line: n + 1, Start: t.start, End: t.end, Decl: decl, Transition: transition})
+			}
+		}
+		first, args := tokens[0], tokens[1:]
+
+		if raw[0] == ' ' || raw[0] == '\t' {
+			switch {
+			case block == "state" && len(args) == 1 && first.is("output"):
+				add(TextOutput, false, args...)
+			case block == "state" && len(args) == 1 && first.is("class"):
+				add(TextClass, false, args...)
+			case block == "class" && len(args) == 1 && first.is("parent"):
+				add(TextClass, false, args...)
+			case block == "transition" && (first.is("pop") || first.is("push")):
+				add(TextStackSymbol, false, args...)
+			}
+			continue
+		}
+
+		block, transition = "", -1
+		if len(tokens) > 1 && tokens[1].is("->") {
+			block, transition = "transition", transitions
+			transitions++
+			add(TextState, false, first)
+			rest := tokens[2:]
+			for len(rest) > 0 && !rest[0].is("on") && !rest[0].is("/") {
+				add(TextState, false, rest[0])
+				rest = rest[1:]
+			}
+			if len(rest) > 1 && rest[0].is("on") {
+				add(TextInput, false, rest[1])
+				rest = rest[2:]
+			}
+			if len(rest) > 1 && rest[0].is("/") {
+				add(TextOutput, false, rest[1])
+			}
+			continue
+		}
+		switch {
+		case first.is("state") && len(args) > 0:
+			block = "state"
+			add(TextState, true, args[0])
+		case first.is("initial") && len(args) == 1:
+			add(TextState, false, args[0])
+		case first.is("inputs"):
+			add(TextInput, true, args...)
+		case first.is("outputs"):
+			add(TextOutput, true, args...)
+		case first.is("stack"):
+			add(TextStackSymbol, true, args...)
+		case first.is("stack-start") && len(args) == 1:
+			add(TextStackSymbol, false, args...)
+		case first.is("class") && len(args) == 1:
+			block = "class"
+			add(TextClass, true, args...)
+		}
+	}
+	return refs
+}
+
+// TextNameAt returns the kind of name that belongs at byte offset col of
+// a line of text-format source, such as an input after "on", for
+// completing what is being typed there. It returns "" where no name of
+// those kinds belongs.
+func TextNameAt(line string, col int) TextRefKind {
+	if col > len(line) {
+		col = len(line)
+	}
+	tokens, _, err := splitTextLine(line[:col], 0)
+	if err != nil {
+		return ""
+	}
+	// The word being typed, if any, is not context.
+	if len(tokens) > 0 && tokens[len(tokens)-1].end == col {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	if line != "" && (line[0] == ' ' || line[0] == '\t') {
+		if len(tokens) == 0 {
+			return ""
+		}
+		switch first := tokens[0]; {
+		case first.is("output") && len(tokens) == 1:
+			return TextOutput
+		case (first.is("class") || first.is("parent")) && len(tokens) == 1:
+			return TextClass
+		case first.is("pop") && len(tokens) == 1, first.is("push"):
+			return TextStackSymbol
+		}
+		return ""
+	}
+
+	if len(tokens) == 0 {
+		return TextState // the source of a transition
+	}
+	if len(tokens) > 1 && tokens[1].is("->") {
+		last := tokens[len(tokens)-1]
+		switch {
+		case last.is("on"):
+			return TextInput
+		case last.is("/"):
+			return TextOutput
+		}
+		for _, t := range tokens[2:] {
+			if t.is("on") || t.is("/") {
+				return ""
+			}
+		}
+		return TextState
+	}
+	switch first := tokens[0]; {
+	case (first.is("state") || first.is("initial")) && len(tokens) == 1:
+		return TextState
+	case first.is("inputs"):
+		return TextInput
+	case first.is("outputs"):
+		return TextOutput
+	case first.is("stack"), first.is("stack-start") && len(tokens) == 1:
+		return TextStackSymbol
+	}
+	return ""
+}
+
+// QuoteTextName returns name as it is written in the text format: bare,
+// or quoted when it would not read back as itself.
+func QuoteTextName(name string) string {
+	return textWord(name)
+}
@@ -0,0 +1,184 @@
+package fsmfile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestParseText(t *testing.T) {
+	src := `# A turnstile, written by hand.
+name Turnstile
+
+state locked initial   # where it starts
+state unlocked accepting
+
+locked -> unlocked on coin / click
+locked -> locked on push / alarm
+  weight 2
+  meta owner "Ada Lovelace"
+unlocked -> locked on push
+`
+	f, err := ParseText([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != fsm.TypeMealy || f.Name != "Turnstile" || f.Initial != "locked" {
+		t.Errorf("type %s, name %q, initial %q", f.Type, f.Name, f.Initial)
+	}
+	if fmt.Sprint(f.States, f.Accepting, f.Alphabet, f.OutputAlphabet) != "[locked unlocked] [unlocked] [coin push] [click alarm]" {
+		t.Errorf("states %v, accepting %v, inputs %v, outputs %v", f.States, f.Accepting, f.Alphabet, f.OutputAlphabet)
+	}
+	if len(f.Transitions) != 3 {
+		t.Fatalf("transitions %+v", f.Transitions)
+	}
+	tr := f.Transitions[1]
+	if tr.Weight == nil || *tr.Weight != 2 || tr.Metadata["owner"] != "Ada Lovelace" {
+		t.Errorf("transition details %+v", tr)
+	}
+	if f.Transitions[2].Output != nil {
+		t.Errorf("unexpected output %q", *f.Transitions[2].Output)
+	}
+}
+
+func TestToText_RoundTrip(t *testing.T) {
+	pda := fsm.New(fsm.TypePDA)
+	pda.Name = "balanced"
+	pda.Description = `parens, "quoted"`
+	pda.Metadata = map[string]string{"owner": "team a"}
+	pda.AddState("q0")
+	pda.AddState("on") // a keyword as a name
+	pda.AddState("two words")
+	pda.Alphabet = []string{"(", ")"}
+	pda.StackAlphabet = []string{"Z", "X"}
+	pda.StackStart = "Z"
+	pda.SetInitial("q0")
+	pda.SetAccepting([]string{"q0"})
+	pda.AddTransition("q0", strp("("), []string{"q0"}, nil)
+	pda.Transitions[0].Push = []string{"X", "Z"}
+	pda.AddTransition("q0", strp(")"), []string{"on"}, nil)
+	pda.Transitions[1].Pop = strp("X")
+	pda.AddTransition("on", nil, []string{"q0", "two words"}, nil)
+	pda.SetStateMetadata("two words", "note", "# not a comment")
+
+	circuit := fsm.New(fsm.TypeMoore)
+	circuit.Name = "blinker"
+	circuit.AddState("off")
+	circuit.AddState("on")
+	circuit.OutputAlphabet = []string{"dark", "lit"}
+	circuit.SetInitial("off")
+	circuit.StateOutputs = map[string]string{"off": "dark", "on": "lit"}
+	circuit.AddTransition("off", strp("tick"), []string{"on"}, nil)
+	circuit.Transitions[0].Probability = new(float64)
+	*circuit.Transitions[0].Probability = 0.25
+	circuit.Alphabet = []string{"tick"}
+	if err := circuit.AddClass(&fsm.Class{
+		Name:       "led",
+		Properties: []fsm.PropertyDef{{Name: "colour", Type: fsm.PropString}, {Name: "level", Type: fsm.PropFloat64}},
+		Ports:      []fsm.Port{{Name: "A", Direction: fsm.PortInput, PinNumber: 1}, {Name: "K", Direction: fsm.PortOutput, PinNumber: 2, Group: "LED1"}},
+		KiCadPart:  "Device:LED",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	circuit.StateClasses = map[string]string{"on": "led"}
+	circuit.StateProperties = map[string]map[string]interface{}{"on": {"colour": "red green", "level": 0.5}}
+	circuit.SetLinkedMachine("off", "sleep")
+	circuit.Nets = []fsm.Net{{Name: "VCC", Endpoints: []fsm.NetEndpoint{{Instance: "U1", Port: "A"}, {Instance: "U2", Port: "K"}}}}
+
+	for _, f := range []*fsm.FSM{buildTestFSMWithMetadata(), pda, circuit} {
+		t.Run(f.Name, func(t *testing.T) {
+			text := ToText(f)
+			got, err := ParseText(text)
+			if err != nil {
+				t.Fatalf("%v:\n%s", err, text)
+			}
+			if !got.StructurallyEqual(f) {
+				t.Errorf("machine changed:\n%s\ngot  %+v\nwant %+v", text, got, f)
+			}
+			if again := ToText(got); string(again) != string(text) {
+				t.Errorf("not canonical:\n%s\nthen\n%s", text, again)
+			}
+		})
+	}
+}
+
+func TestParseText_Errors(t *testing.T) {
+	cases := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{"state a\nstate a", 2, "declared twice"},
+		{"a ->", 1, "no target"},
+		{"a -> b on", 1, "needs an input"},
+		{"a -> b on x / y z", 1, "unexpected"},
+		{"state a\n  weight 2", 2, "unknown state detail"},
+		{"\n  meta k v", 2, "outside"},
+		{"state a final", 1, "unknown state flag"},
+		{"state a\n  set n {", 2, "malformed value"},
+		{`name "open`, 1, "unterminated"},
+		{"colour red", 1, "unknown declaration"},
+		{"net n U1", 1, "pairs"},
+	}
+	for _, c := range cases {
+		_, err := ParseText([]byte(c.src))
+		var te *TextError
+		if !errors.As(err, &te) {
+			t.Errorf("%q: error %v, want a TextError", c.src, err)
+			continue
+		}
+		if te.Line != c.line || !strings.Contains(te.Msg, c.msg) {
+			t.Errorf("%q: %v, want line %d: ...%s...", c.src, err, c.line, c.msg)
+		}
+	}
+}
+
+func TestTextRefs(t *testing.T) {
+	src := `inputs go
+state "a b" initial
+  class led
+"a b" -> c on go / beep
+  push X
+class led
+`
+	var got []string
+	for _, r := range TextRefs([]byte(src)) {
+		got = append(got, fmt.Sprintf("%s %s %d:%d-%d %v %d", r.Kind, r.Name, r.Line, r.Start, r.End, r.Decl, r.Transition))
+	}
+	want := []string{
+		"input go 1:7-9 true -1",
+		"state a b 2:6-11 true -1",
+		"class led 3:8-11 false -1",
+		"state a b 4:0-5 false 0",
+		"state c 4:9-10 false 0",
+		"input go 4:14-16 false 0",
+		"output beep 4:19-23 false 0",
+		"stack X 5:7-8 false 0",
+		"class led 6:6-9 true -1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, c := range []struct {
+		line string
+		want TextRefKind
+	}{
+		{"", TextState},
+		{"idle -> ", TextState},
+		{"idle -> run on ", TextInput},
+		{"idle -> run on st", TextInput},
+		{"idle -> run on start / ", TextOutput},
+		{"idle -> run on start ", ""},
+		{"  output ", TextOutput},
+		{"  weight ", ""},
+		{"inputs a ", TextInput},
+	} {
+		if got := TextNameAt(c.line, len(c.line)); got != c.want {
+			t.Errorf("TextNameAt(%q) = %q, want %q", c.line, got, c.want)
+		}
+	}
+}
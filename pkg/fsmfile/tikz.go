@@ -0,0 +1,171 @@
+package fsmfile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// TikZOptions controls TikZ export.
+type TikZOptions struct {
+	Standalone bool    // wrap in a complete standalone LaTeX document
+	Scale      float64 // centimetres per layout column; rows are twice that (0 = 0.2)
+	UseLayout  *Layout // saved editor positions to use instead of SmartLayout
+}
+
+// DefaultTikZOptions returns a bare tikzpicture at the default scale.
+func DefaultTikZOptions() TikZOptions {
+	return TikZOptions{Scale: 0.2}
+}
+
+// GenerateTikZ converts an FSM to a tikzpicture using the TikZ automata
+// library, placing states at the same computed layout positions as the
+// native renderers (or at saved positions with UseLayout). Without
+// Standalone the output is meant for \input in a document that loads
+// \usetikzlibrary{automata}.
+func GenerateTikZ(f *fsm.FSM, opts TikZOptions) string {
+	if opts.Scale <= 0 {
+		opts.Scale = 0.2
+	}
+	var positions map[string][2]int
+	if opts.UseLayout != nil {
+		positions = savedPositions(f, opts.UseLayout)
+	}
+	if positions == nil {
+		// The grid of an 800x600 native SVG (see GenerateSVGNative).
+		positions = SmartLayout(f, 70, 25)
+	}
+	minX, minY := 0, 0
+	for i, name := range f.States {
+		p := positions[name]
+		if i == 0 || p[0] < minX {
+			minX = p[0]
+		}
+		if i == 0 || p[1] < minY {
+			minY = p[1]
+		}
+	}
+
+	var sb strings.Builder
+	if opts.Standalone {
+		sb.WriteString("\\documentclass[tikz,border=5pt]{standalone}\n")
+		sb.WriteString("\\usetikzlibrary{automata}\n")
+		sb.WriteString("\\begin{document}\n")
+	} else {
+		sb.WriteString("% Requires \\usepackage{tikz} and \\usetikzlibrary{automata}\n")
+	}
+	if f.Name != "" {
+		sb.WriteString(fmt.Sprintf("%% %s\n", strings.ReplaceAll(f.Name, "\n", " ")))
+	}
+	sb.WriteString("\\begin{tikzpicture}[->, >=stealth, shorten >=1pt, auto, semithick]\n")
+
+	// Nodes are named by index, since state names may contain characters
+	// that TikZ does not allow in node names.
+	ids := make(map[string]string, len(f.States))
+	for i, name := range f.States {
+		ids[name] = fmt.Sprintf("s%d", i)
+		style := []string{"state"}
+		if name == f.Initial {
+			style = append(style, "initial")
+		}
+		if f.IsAccepting(name) {
+			style = append(style, "accepting")
+		}
+		if f.IsLinked(name) {
+			style = append(style, "dashed")
+		}
+		label := escapeTeX(name)
+		if f.Type == fsm.TypeMoore {
+			if out, ok := f.StateOutputs[name]; ok && out != "" {
+				style = append(style, "align=center")
+				label += `\\\footnotesize ` + escapeTeX(out)
+			}
+		}
+		p := positions[name]
+		x := float64(p[0]-minX) * opts.Scale
+		y := float64(minY-p[1]) * opts.Scale * 2 // TikZ y grows upwards
+		sb.WriteString(fmt.Sprintf("  \\node[%s] (%s) at (%.2f,%.2f) {%s};\n",
+			strings.Join(style, ", "), ids[name], x, y, label))
+	}
+
+	// Group transitions by (from, to) in first-seen order, as GenerateDOT
+	// does.
+	edgeLabels := make(map[[2]string][]string)
+	var edgeOrder [][2]string
+	for _, t := range f.Transitions {
+		label := `$\varepsilon$`
+		if t.Input != nil {
+			label = escapeTeX(*t.Input)
+		}
+		if f.Type == fsm.TypeMealy && t.Output != nil {
+			label += "/" + escapeTeX(*t.Output)
+		}
+		if f.Type == fsm.TypePDA {
+			label += " [" + escapeTeX(t.StackLabel()) + "]"
+		}
+		for _, to := range t.To {
+			key := [2]string{t.From, to}
+			if _, seen := edgeLabels[key]; !seen {
+				edgeOrder = append(edgeOrder, key)
+			}
+			edgeLabels[key] = append(edgeLabels[key], label)
+		}
+	}
+
+	if len(edgeOrder) > 0 {
+		sb.WriteString("  \\path\n")
+		for i, key := range edgeOrder {
+			from, to := ids[key[0]], ids[key[1]]
+			label := strings.Join(edgeLabels[key], ", ")
+			var edge string
+			switch {
+			case key[0] == key[1]:
+				edge = fmt.Sprintf("(%s) edge [loop above] node {%s} ()", from, label)
+			case edgeLabels[[2]string{key[1], key[0]}] != nil:
+				// Opposing edges each bend to their own left.
+				edge = fmt.Sprintf("(%s) edge [bend left=15] node {%s} (%s)", from, label, to)
+			default:
+				edge = fmt.Sprintf("(%s) edge node {%s} (%s)", from, label, to)
+			}
+			end := "\n"
+			if i == len(edgeOrder)-1 {
+				end = ";\n"
+			}
+			sb.WriteString("    " + edge + end)
+		}
+	}
+
+	sb.WriteString("\\end{tikzpicture}\n")
+	if opts.Standalone {
+		sb.WriteString("\\end{document}\n")
+	}
+	return sb.String()
+}
+
+// escapeTeX makes s safe as LaTeX text.
+func escapeTeX(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\textbackslash{}`)
+		case '{', '}', '$', '&', '#', '_', '%':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case '^':
+			sb.WriteString(`\^{}`)
+		case '~':
+			sb.WriteString(`\~{}`)
+		case 'ε':
+			sb.WriteString(`$\varepsilon$`)
+		case '→':
+			sb.WriteString(`$\to$`)
+		case '\n':
+			sb.WriteByte(' ')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
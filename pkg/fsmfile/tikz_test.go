@@ -0,0 +1,75 @@
+package fsmfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestGenerateTikZ(t *testing.T) {
+	f := highlightTestFSM()
+	f.AddTransition("b", strp("x"), []string{"a"}, nil)
+	out := GenerateTikZ(f, DefaultTikZOptions())
+
+	for _, want := range []string{
+		`\begin{tikzpicture}`,
+		`\node[state, initial] (s0) at (`,
+		`\node[state, accepting] (s2) at (`,
+		`(s0) edge [bend left=15] node {x} (s1)`,
+		`(s1) edge [bend left=15] node {x} (s0)`,
+		`(s1) edge node {y} (s2)`,
+		`(s2) edge [loop above] node {y} ()`,
+		`\end{tikzpicture}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, ";\n") != len(f.States)+1 {
+		t.Errorf("expected one statement per node plus one path:\n%s", out)
+	}
+	if strings.Contains(out, `\documentclass`) {
+		t.Error("document preamble without Standalone")
+	}
+}
+
+func TestGenerateTikZ_Standalone(t *testing.T) {
+	opts := DefaultTikZOptions()
+	opts.Standalone = true
+	out := GenerateTikZ(highlightTestFSM(), opts)
+	if !strings.HasPrefix(out, `\documentclass`) || !strings.HasSuffix(out, "\\end{document}\n") {
+		t.Errorf("not a standalone document:\n%s", out)
+	}
+}
+
+func TestGenerateTikZ_Escaping(t *testing.T) {
+	f := fsm.New(fsm.TypeMoore)
+	f.AddState("q_1 & #2")
+	f.AddInput("50%")
+	f.AddOutput("x^2")
+	f.AddTransition("q_1 & #2", strp("50%"), []string{"q_1 & #2"}, nil)
+	f.SetInitial("q_1 & #2")
+	f.SetStateOutput("q_1 & #2", "x^2")
+	out := GenerateTikZ(f, DefaultTikZOptions())
+	for _, want := range []string{`{q\_1 \& \#2\\\footnotesize x\^{}2}`, `node {50\%}`, "align=center"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGenerateTikZ_UseLayout(t *testing.T) {
+	f := highlightTestFSM()
+	l := &Layout{States: map[string]StateLayout{
+		"a": {X: 10, Y: 4}, "b": {X: 30, Y: 4}, "c": {X: 20, Y: 9},
+	}}
+	opts := DefaultTikZOptions()
+	opts.UseLayout = l
+	out := GenerateTikZ(f, opts)
+	for _, want := range []string{"(s0) at (0.00,0.00)", "(s1) at (4.00,0.00)", "(s2) at (2.00,-2.00)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
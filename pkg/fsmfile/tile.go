@@ -0,0 +1,181 @@
+package fsmfile
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"golang.org/x/image/draw"
+)
+
+// Tile is one page of a canvas split by TileGrid.
+type Tile struct {
+	Row, Col int             // zero-based position in the grid
+	Rect     image.Rectangle // region of the full canvas
+}
+
+// Label names the tile by its one-based row and column, as "2-3". It is
+// shown on overview pages and used in tile file names.
+func (t Tile) Label() string {
+	return fmt.Sprintf("%d-%d", t.Row+1, t.Col+1)
+}
+
+// TileGrid splits a width×height canvas into the fewest rows and columns
+// of pages no larger than maxSize pixels on either side, in row-major
+// order. Pages in a row share a height and pages in a column a width,
+// which differ by at most one pixel.
+func TileGrid(width, height, maxSize int) []Tile {
+	if maxSize <= 0 {
+		return []Tile{{Rect: image.Rect(0, 0, width, height)}}
+	}
+	cols := (width + maxSize - 1) / maxSize
+	rows := (height + maxSize - 1) / maxSize
+	tiles := make([]Tile, 0, rows*cols)
+	for r := 0; r < rows; r++ {
+		y0, y1 := height*r/rows, height*(r+1)/rows
+		for c := 0; c < cols; c++ {
+			x0, x1 := width*c/cols, width*(c+1)/cols
+			tiles = append(tiles, Tile{Row: r, Col: c, Rect: image.Rect(x0, y0, x1, y1)})
+		}
+	}
+	return tiles
+}
+
+// FitSize scales width×height down, keeping its aspect ratio, so that
+// neither side exceeds maxSize. Sizes that already fit are unchanged.
+func FitSize(width, height, maxSize int) (int, int) {
+	if maxSize <= 0 || (width <= maxSize && height <= maxSize) {
+		return width, height
+	}
+	scale := math.Min(float64(maxSize)/float64(width), float64(maxSize)/float64(height))
+	w := int(float64(width) * scale)
+	h := int(float64(height) * scale)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// CanvasSizeFor suggests a native-renderer canvas on which every state of
+// f has room at the default font size: each layer of the automatic
+// layout gets a row, and the widest layer sets the width. Small machines
+// get the default 800x600. Use it to size a canvas for TileGrid.
+func CanvasSizeFor(f *fsm.FSM) (int, int) {
+	rows := make(map[int]int) // layer y -> label width of its states
+	for name, p := range SmartLayout(f, 200, 100) {
+		rows[p[1]] += len(name)*9 + 100
+	}
+	width, height := 800, 600
+	if w := maxRowWidth(rows) + 100; w > width {
+		width = w
+	}
+	if h := len(rows)*120 + 135; h > height {
+		height = h
+	}
+	return width, height
+}
+
+func maxRowWidth(rows map[int]int) int {
+	widest := 0
+	for _, w := range rows {
+		if w > widest {
+			widest = w
+		}
+	}
+	return widest
+}
+
+// RenderTiledPNG renders the opts.Width×opts.Height canvas one tile at a
+// time, passing each to page, and returns an overview: the whole canvas
+// shrunk to fit maxSize, with each tile outlined and labelled. Only one
+// tile is held in memory at once. It stops at the first error from page.
+// maxSize bounds images in pixels, after opts.Scale, so a larger Scale
+// gives more, smaller tiles of the canvas.
+func RenderTiledPNG(f *fsm.FSM, opts PNGOptions, maxSize int, page func(Tile, image.Image) error) (*image.RGBA, error) {
+	px := opts.pixelScale()
+	ow, oh := FitSize(int(math.Round(float64(opts.Width)*px)), int(math.Round(float64(opts.Height)*px)), maxSize)
+	overview := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	sx := float64(ow) / float64(opts.Width)
+	sy := float64(oh) / float64(opts.Height)
+	scaled := func(r image.Rectangle) image.Rectangle {
+		return image.Rect(
+			int(math.Round(float64(r.Min.X)*sx)), int(math.Round(float64(r.Min.Y)*sy)),
+			int(math.Round(float64(r.Max.X)*sx)), int(math.Round(float64(r.Max.Y)*sy)))
+	}
+
+	tiles := TileGrid(opts.Width, opts.Height, int(float64(maxSize)/px))
+	for _, t := range tiles {
+		tileOpts := opts
+		tileOpts.Viewport = t.Rect
+		img := RenderImage(f, tileOpts)
+		if err := page(t, img); err != nil {
+			return nil, err
+		}
+		draw.CatmullRom.Scale(overview, scaled(t.Rect), img, img.Bounds(), draw.Src, nil)
+	}
+
+	ctx := newRenderContext(overview, 1, 1, opts)
+	for _, t := range tiles {
+		r := scaled(t.Rect)
+		x0, y0 := float64(r.Min.X), float64(r.Min.Y)
+		x1, y1 := float64(r.Max.X-1), float64(r.Max.Y-1)
+		drawLine(ctx, x0, y0, x1, y0, colorGray)
+		drawLine(ctx, x1, y0, x1, y1, colorGray)
+		drawLine(ctx, x1, y1, x0, y1, colorGray)
+		drawLine(ctx, x0, y1, x0, y0, colorGray)
+		drawTextCentered(ctx, (r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2, t.Label(), colorHighlight)
+	}
+	return overview, nil
+}
+
+// GenerateTiledSVG splits the opts.Width×opts.Height native SVG into
+// pages no larger than maxSize, one per tile of TileGrid, and returns
+// them with an overview page: the whole diagram shrunk to fit maxSize,
+// with each tile outlined and labelled. If href is not nil, each outline
+// links to href(tile), normally the tile's file name.
+func GenerateTiledSVG(f *fsm.FSM, opts SVGOptions, maxSize int, href func(Tile) string) (pages []string, overview string) {
+	tiles := TileGrid(opts.Width, opts.Height, maxSize)
+	for _, t := range tiles {
+		tileOpts := opts
+		tileOpts.Viewport = t.Rect
+		pages = append(pages, GenerateSVGNative(f, tileOpts))
+	}
+
+	full := opts
+	full.Viewport = image.Rectangle{}
+	svg := GenerateSVGNative(f, full)
+	if i := strings.Index(svg, "<svg"); i > 0 {
+		svg = svg[i:] // drop the XML declaration; it is nested below
+	}
+
+	ow, oh := FitSize(opts.Width, opts.Height, maxSize)
+	// Labels stay readable whatever the reduction.
+	fontSize := 16 * float64(opts.Width) / float64(ow)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d">
+`, ow, oh, opts.Width, opts.Height))
+	sb.WriteString(svg)
+	// Transparent fills make the whole tile, not only its outline, a link.
+	sb.WriteString(fmt.Sprintf(`<g fill="#fff" fill-opacity="0" stroke="#666" stroke-width="%.1f" font-family="sans-serif" font-size="%.1f" text-anchor="middle" dominant-baseline="middle">
+`, fontSize/8, fontSize))
+	for _, t := range tiles {
+		r := t.Rect
+		cell := fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d"/><text x="%d" y="%d" fill="#d32f2f" fill-opacity="1" stroke="none">%s</text>`,
+			r.Min.X, r.Min.Y, r.Dx(), r.Dy(), (r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2, t.Label())
+		if href != nil {
+			link := html.EscapeString(href(t))
+			cell = fmt.Sprintf(`<a href="%s" xlink:href="%s">%s</a>`, link, link, cell)
+		}
+		sb.WriteString(cell + "\n")
+	}
+	sb.WriteString("</g>\n</svg>\n")
+	return pages, sb.String()
+}
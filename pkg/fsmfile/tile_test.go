@@ -0,0 +1,156 @@
+package fsmfile
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestTileGrid(t *testing.T) {
+	tiles := TileGrid(5000, 1000, 2000)
+	if len(tiles) != 3 {
+		t.Fatalf("got %d tiles, want 3", len(tiles))
+	}
+	x := 0
+	for i, tile := range tiles {
+		if tile.Row != 0 || tile.Col != i {
+			t.Errorf("tile %d at row %d col %d", i, tile.Row, tile.Col)
+		}
+		if tile.Rect.Min.X != x || tile.Rect.Min.Y != 0 || tile.Rect.Max.Y != 1000 {
+			t.Errorf("tile %d covers %v", i, tile.Rect)
+		}
+		if w := tile.Rect.Dx(); w < 1666 || w > 1667 {
+			t.Errorf("tile %d is %d wide", i, w)
+		}
+		x = tile.Rect.Max.X
+	}
+	if x != 5000 {
+		t.Errorf("tiles end at x=%d, want 5000", x)
+	}
+	if got := tiles[2].Label(); got != "1-3" {
+		t.Errorf("Label() = %q, want 1-3", got)
+	}
+
+	if tiles := TileGrid(800, 600, 2000); len(tiles) != 1 || tiles[0].Rect != image.Rect(0, 0, 800, 600) {
+		t.Errorf("small canvas: got %v", tiles)
+	}
+	if tiles := TileGrid(4001, 4000, 2000); len(tiles) != 6 || tiles[5].Label() != "2-3" {
+		t.Errorf("4001x4000: got %d tiles", len(tiles))
+	}
+}
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		w, h, max, wantW, wantH int
+	}{
+		{800, 600, 2000, 800, 600},
+		{30000, 3000, 2000, 2000, 200},
+		{1000, 4000, 2000, 500, 2000},
+		{800, 600, 0, 800, 600},
+	}
+	for _, tt := range tests {
+		if w, h := FitSize(tt.w, tt.h, tt.max); w != tt.wantW || h != tt.wantH {
+			t.Errorf("FitSize(%d, %d, %d) = %d, %d, want %d, %d", tt.w, tt.h, tt.max, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestCanvasSizeFor(t *testing.T) {
+	if w, h := CanvasSizeFor(highlightTestFSM()); w != 800 || h != 600 {
+		t.Errorf("small machine: got %dx%d, want the default 800x600", w, h)
+	}
+}
+
+func TestPNGViewport(t *testing.T) {
+	f := highlightTestFSM()
+	opts := DefaultPNGOptions()
+	opts.Width, opts.Height = 400, 300
+	w, h := pngLayoutSize(opts)
+	positions := EngineLayout(f, opts.LayoutEngine, w, h)
+	full := renderPNGInternal(f, positions, opts, 1, 1)
+
+	opts.Viewport = image.Rect(100, 50, 300, 250)
+	part := renderPNGInternal(f, positions, opts, 1, 1)
+	if part.Bounds() != opts.Viewport {
+		t.Fatalf("viewport image covers %v, want %v", part.Bounds(), opts.Viewport)
+	}
+	// Anti-aliasing a shape cut off at the viewport can round a channel
+	// the other way.
+	near := func(a, b uint8) bool { return a-b <= 1 || b-a <= 1 }
+	for y := 50; y < 250; y++ {
+		for x := 100; x < 300; x++ {
+			p, f := part.RGBAAt(x, y), full.RGBAAt(x, y)
+			if !near(p.R, f.R) || !near(p.G, f.G) || !near(p.B, f.B) || !near(p.A, f.A) {
+				t.Fatalf("pixel (%d,%d) differs from the full render: %v, %v", x, y, p, f)
+			}
+		}
+	}
+
+	if b := RenderImage(f, opts).Bounds(); b != image.Rect(0, 0, 200, 200) {
+		t.Errorf("RenderImage with viewport: bounds %v", b)
+	}
+}
+
+func TestRenderTiledPNG(t *testing.T) {
+	opts := DefaultPNGOptions()
+	opts.Width, opts.Height = 500, 200
+	var got []string
+	overview, err := RenderTiledPNG(highlightTestFSM(), opts, 200, func(tile Tile, img image.Image) error {
+		if img.Bounds().Size() != tile.Rect.Size() {
+			t.Errorf("tile %s is %v, want %v", tile.Label(), img.Bounds().Size(), tile.Rect.Size())
+		}
+		got = append(got, tile.Label())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != "1-1 1-2 1-3" {
+		t.Errorf("tiles = %v", got)
+	}
+	if b := overview.Bounds(); b.Dx() != 200 || b.Dy() != 80 {
+		t.Errorf("overview is %v, want 200x80", b)
+	}
+
+	// At scale 2 each 200px page covers 100 canvas pixels.
+	opts.Scale = 2
+	count := 0
+	if _, err := RenderTiledPNG(highlightTestFSM(), opts, 200, func(tile Tile, img image.Image) error {
+		if b := img.Bounds(); b.Dx() > 200 || b.Dy() > 200 {
+			t.Errorf("scaled tile %s is %v", tile.Label(), b)
+		}
+		count++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 {
+		t.Errorf("scale 2: got %d tiles, want 10", count)
+	}
+}
+
+func TestGenerateTiledSVG(t *testing.T) {
+	opts := DefaultSVGOptions()
+	opts.Width, opts.Height = 500, 200
+	pages, overview := GenerateTiledSVG(highlightTestFSM(), opts, 200, func(tile Tile) string {
+		return "m-" + tile.Label() + ".svg"
+	})
+	if len(pages) != 3 {
+		t.Fatalf("got %d pages, want 3", len(pages))
+	}
+	if !strings.Contains(pages[1], `width="167" height="200" viewBox="166 0 167 200"`) {
+		t.Errorf("page 2 header wrong:\n%.300s", pages[1])
+	}
+	for _, want := range []string{
+		`width="200" height="80" viewBox="0 0 500 200"`,
+		`<a href="m-1-2.svg"`,
+		`>1-3</text>`,
+	} {
+		if !strings.Contains(overview, want) {
+			t.Errorf("overview lacks %q", want)
+		}
+	}
+	if strings.Count(overview, "<?xml") != 1 {
+		t.Error("overview repeats the XML declaration")
+	}
+}
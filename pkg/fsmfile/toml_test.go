@@ -0,0 +1,173 @@
+package fsmfile
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const handWrittenLabels = `# written by hand
+generator = "other-tool 2.1"
+
+[fsm]
+version = 1
+type = "dfa"
+name = "door"
+author = "someone"
+
+[states]
+0x0000 = "closed"
+0x0001 = "open"
+note = "kept"
+
+[inputs]
+0x0000 = "push"
+
+[machines]
+"open" = "alarm"
+
+[metadata]
+"owner" = "ops"
+
+[review]
+status = "approved"
+reviewers = ["a", "b"]
+
+[empty_section]
+`
+
+func TestLabels_RoundTripPreservesUnknownKeys(t *testing.T) {
+	l, err := UnmarshalLabels([]byte(handWrittenLabels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.FSM.Name != "door" || l.States[1] != "open" || l.Machines["open"] != "alarm" || l.Metadata["owner"] != "ops" {
+		t.Fatalf("known fields not parsed: %+v", l)
+	}
+	want := Extra{
+		"":              {"generator": `"other-tool 2.1"`},
+		"fsm":           {"author": `"someone"`},
+		"states":        {"note": `"kept"`},
+		"review":        {"status": `"approved"`, "reviewers": `["a", "b"]`},
+		"empty_section": {},
+	}
+	if !reflect.DeepEqual(l.Extra, want) {
+		t.Errorf("Extra = %v, want %v", l.Extra, want)
+	}
+
+	out := MarshalLabels(l)
+	for _, s := range []string{`generator = "other-tool 2.1"`, `author = "someone"`, `note = "kept"`,
+		"[review]", `reviewers = ["a", "b"]`, "[empty_section]"} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("marshalled labels lost %q:\n%s", s, out)
+		}
+	}
+
+	again, err := UnmarshalLabels(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, l) {
+		t.Errorf("second round trip differs:\n%+v\n%+v", again, l)
+	}
+	if string(MarshalLabels(again)) != string(out) {
+		t.Error("MarshalLabels is not stable")
+	}
+}
+
+func TestLabels_GenerateMatchesMarshal(t *testing.T) {
+	f := buildTestFSMWithMetadata()
+	_, states, inputs, outputs := FSMToRecords(f)
+	text := GenerateLabels(f, states, inputs, outputs)
+	l, err := ParseLabels(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(MarshalLabels(l)); got != text {
+		t.Errorf("MarshalLabels(ParseLabels(GenerateLabels)) differs:\n%s\nwant:\n%s", got, text)
+	}
+}
+
+func TestLayout_RoundTripPreservesUnknownKeys(t *testing.T) {
+	text := `[layout]
+version = 1
+
+[editor]
+canvas_offset_x = 4
+canvas_offset_y = -2
+zoom = 1.5
+
+[states]
+[states."idle"]
+x = 10
+y = 20
+colour = "red"
+
+[states.running]
+x = 30
+y = 40
+
+[guides]
+vertical = [100, 200]
+`
+	l, err := UnmarshalLayout([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Editor.CanvasOffsetY != -2 || l.States["running"] != (StateLayout{30, 40}) {
+		t.Fatalf("known fields not parsed: %+v", l)
+	}
+	want := Extra{
+		"editor":        {"zoom": "1.5"},
+		`states."idle"`: {"colour": `"red"`},
+		"guides":        {"vertical": "[100, 200]"},
+	}
+	if !reflect.DeepEqual(l.Extra, want) {
+		t.Errorf("Extra = %v, want %v", l.Extra, want)
+	}
+
+	out := MarshalLayout(l)
+	again, err := UnmarshalLayout(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, l) {
+		t.Errorf("round trip differs:\n%s\n%+v\n%+v", out, again, l)
+	}
+	if !strings.Contains(string(out), "[states.\"idle\"]\nx = 10\ny = 20\ncolour = \"red\"\n") {
+		t.Errorf("state extras not written with their state:\n%s", out)
+	}
+}
+
+func TestLayout_RenameStates(t *testing.T) {
+	l, err := UnmarshalLayout([]byte("[states.\"idle\"]\nx = 10\ny = 20\ncolour = \"red\"\n\n[states.\"run\"]\nx = 30\ny = 40\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.RenameStates(map[string]string{"idle": "run", "run": "idle"})
+	if l.States["run"] != (StateLayout{10, 20}) || l.States["idle"] != (StateLayout{30, 40}) {
+		t.Errorf("positions not swapped: %+v", l.States)
+	}
+	if want := (Extra{`states."run"`: {"colour": `"red"`}}); !reflect.DeepEqual(l.Extra, want) {
+		t.Errorf("Extra = %v, want %v", l.Extra, want)
+	}
+}
+
+func TestBundleMetadataPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.fsm")
+	f := buildTestFSMWithMetadata()
+	if err := WriteBundleFromData(path, map[string]BundleMachineData{
+		"meta":  {FSM: f},
+		"other": {FSM: buildTestFSMWithClasses()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _, err := ReadMachineFromBundle(path, "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Metadata, f.Metadata) || !reflect.DeepEqual(loaded.StateMetadata, f.StateMetadata) {
+		t.Errorf("bundle lost metadata: %v %v", loaded.Metadata, loaded.StateMetadata)
+	}
+}
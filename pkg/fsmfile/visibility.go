@@ -279,7 +279,16 @@ func (vg *VisibilityGraph) FindStartEndIndices(start, end Point) (int, int) {
 	return startIdx, endIdx
 }
 
+// maxRouteObstacles bounds the obstacles RouteAroundObstacles plans
+// around. The visibility graph has a vertex for every pair of obstacles
+// and checks every pair of vertices, so planning around hundreds of
+// states would take hours.
+const maxRouteObstacles = 12
+
 // RouteAroundObstacles finds a path from start to end that avoids all obstacles.
+// With more than maxRouteObstacles obstacles, only those near the direct
+// line are considered, and if there are still too many the direct path
+// is returned.
 func RouteAroundObstacles(start, end Point, obstacles []Ellipse) []Point {
 	if len(obstacles) == 0 {
 		return []Point{start, end}
@@ -290,6 +299,13 @@ func RouteAroundObstacles(start, end Point, obstacles []Ellipse) []Point {
 		return []Point{start, end}
 	}
 
+	if len(obstacles) > maxRouteObstacles {
+		obstacles = nearbyObstacles(start, end, obstacles)
+		if len(obstacles) > maxRouteObstacles {
+			return []Point{start, end}
+		}
+	}
+
 	// Build visibility graph and find shortest path
 	vg := BuildVisibilityGraph(obstacles, start, end)
 
@@ -307,6 +323,27 @@ func RouteAroundObstacles(start, end Point, obstacles []Ellipse) []Point {
 	return path
 }
 
+// nearbyObstacles returns the obstacles that overlap the bounding box of
+// the segment from start to end, widened by the largest obstacle so that
+// a detour around the segment stays inside it.
+func nearbyObstacles(start, end Point, obstacles []Ellipse) []Ellipse {
+	margin := 0.0
+	for _, obs := range obstacles {
+		margin = math.Max(margin, math.Max(obs.RX, obs.RY)*2)
+	}
+	minX, maxX := math.Min(start.X, end.X)-margin, math.Max(start.X, end.X)+margin
+	minY, maxY := math.Min(start.Y, end.Y)-margin, math.Max(start.Y, end.Y)+margin
+
+	var near []Ellipse
+	for _, obs := range obstacles {
+		if obs.CX+obs.RX >= minX && obs.CX-obs.RX <= maxX &&
+			obs.CY+obs.RY >= minY && obs.CY-obs.RY <= maxY {
+			near = append(near, obs)
+		}
+	}
+	return near
+}
+
 // Priority queue implementation for Dijkstra's algorithm
 type pqItem struct {
 	vertex int
@@ -218,3 +218,33 @@ func TestDistance(t *testing.T) {
 		t.Errorf("Expected distance 5, got %.3f", d)
 	}
 }
+
+func TestRouteAroundObstaclesMany(t *testing.T) {
+	// A row of obstacles along the direct line; planning around all of
+	// them would not finish.
+	var obstacles []Ellipse
+	for i := 0; i < 200; i++ {
+		obstacles = append(obstacles, Ellipse{CX: float64(100 + i*4), CY: 5000, RX: 30, RY: 20})
+	}
+	path := RouteAroundObstacles(Point{0, 5000}, Point{1000, 5000}, obstacles)
+	if len(path) != 2 {
+		t.Errorf("expected the direct path with too many nearby obstacles, got %d points", len(path))
+	}
+
+	// Far-away obstacles do not change the route around a near one.
+	near := []Ellipse{{CX: 100, CY: 100, RX: 30, RY: 20}}
+	start, end := Point{50, 100}, Point{150, 100}
+	want := RouteAroundObstacles(start, end, near)
+	for i := 0; i < 20; i++ {
+		near = append(near, Ellipse{CX: float64(5000 + i*100), CY: 5000, RX: 30, RY: 20})
+	}
+	got := RouteAroundObstacles(start, end, near)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package fsmfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// Metadata keys read by GenerateXState, for the parts of an XState
+// machine that the toolkit's model does not have. Guards and actions
+// are named; their implementations are supplied in JavaScript.
+const (
+	XStateGuardKey   = "xstate.guard"   // transition metadata: guard name
+	XStateActionsKey = "xstate.actions" // transition metadata: action names, comma-separated
+	XStateEntryKey   = "xstate.entry"   // state metadata: entry action names, comma-separated
+	XStateExitKey    = "xstate.exit"    // state metadata: exit action names, comma-separated
+)
+
+// XStateOptions controls XState export.
+type XStateOptions struct {
+	// ID is the machine's id (default: the machine name, or "machine").
+	ID string
+	// Machines are the machines of the bundle, by name. A linked state
+	// whose machine is here becomes a compound state holding that
+	// machine's states; other linked states stay atomic.
+	Machines map[string]*fsm.FSM
+}
+
+// GenerateXState converts an FSM to an XState (v5) machine config as
+// indented JSON, states in the machine's order, to be passed to
+// createMachine.
+//
+// Inputs become events. Accepting states are tagged "accepting". Mealy
+// outputs become actions of their transitions, and Moore outputs entry
+// actions of their states, named by the output; the xstate.* metadata
+// keys add guards and further actions. NFAs are converted to DFAs
+// first, as for code generation; pushdown automata are not supported.
+//
+// A linked state whose machine is in opts.Machines becomes a compound
+// state, as its machine runs in fsm run: the parent's transition on
+// "accept" becomes onDone, reached through the child's accepting
+// terminal states, which are final, and the child's other terminal
+// states take the parent's transition on "reject". Unlike fsm run,
+// XState offers the compound state's other events while the child runs.
+func GenerateXState(f *fsm.FSM, opts XStateOptions) ([]byte, error) {
+	id := opts.ID
+	if id == "" {
+		id = f.Name
+	}
+	if id == "" {
+		id = "machine"
+	}
+	x := &xstateWriter{machines: opts.Machines, root: id}
+	config, err := x.machine(f, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	root := jsonObject{{"id", id}}
+	if f.Description != "" {
+		root = append(root, jsonField{"description", f.Description})
+	}
+	root = append(root, config...)
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// xstateWriter builds the nested state configs of a machine.
+type xstateWriter struct {
+	machines map[string]*fsm.FSM
+	root     string
+	nesting  []string // machines being written, outermost first
+}
+
+// xstateReturn says where a child machine's terminal states lead.
+type xstateReturn struct {
+	done   bool   // the parent has a transition on "accept"
+	reject string // absolute target of the parent's "reject" transition, if any
+}
+
+// machine returns the initial and states fields for f, whose states are
+// at path within the root machine. ret is nil for the root machine.
+func (x *xstateWriter) machine(f *fsm.FSM, path []string, ret *xstateReturn) (jsonObject, error) {
+	if f.Type == fsm.TypePDA {
+		return nil, fmt.Errorf("XState export does not support pushdown automata")
+	}
+	if f.Type == fsm.TypeNFA {
+		f = f.ToDFA()
+	}
+	x.nesting = append(x.nesting, f.Name)
+	defer func() { x.nesting = x.nesting[:len(x.nesting)-1] }()
+
+	states := make(jsonObject, 0, len(f.States))
+	for _, s := range f.States {
+		state, err := x.state(f, s, path, ret)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, jsonField{s, state})
+	}
+	return jsonObject{{"initial", f.Initial}, {"states", states}}, nil
+}
+
+// state returns the config of state s of f.
+func (x *xstateWriter) state(f *fsm.FSM, s string, path []string, ret *xstateReturn) (jsonObject, error) {
+	var state jsonObject
+	terminal := true
+	for _, t := range f.Transitions {
+		if t.From == s {
+			terminal = false
+			break
+		}
+	}
+	if ret != nil && terminal && f.IsAccepting(s) {
+		state = append(state, jsonField{"type", "final"})
+	}
+	if f.IsAccepting(s) {
+		state = append(state, jsonField{"tags", []string{"accepting"}})
+	}
+
+	entry := metadataList(f.StateMetadata[s][XStateEntryKey])
+	if f.Type == fsm.TypeMoore {
+		if out, ok := f.StateOutputs[s]; ok && out != "" {
+			entry = append(entry, out)
+		}
+	}
+	if len(entry) > 0 {
+		state = append(state, jsonField{"entry", entry})
+	}
+	if exit := metadataList(f.StateMetadata[s][XStateExitKey]); len(exit) > 0 {
+		state = append(state, jsonField{"exit", exit})
+	}
+
+	// A linked state holds its machine's states.
+	var child *fsm.FSM
+	if f.IsLinked(s) {
+		child = x.machines[f.GetLinkedMachine(s)]
+		if child != nil && x.nested(child.Name) {
+			child = nil // XState cannot nest a machine within itself
+		}
+	}
+	var sub *xstateReturn
+	if child != nil {
+		sub = &xstateReturn{}
+		for _, t := range f.Transitions {
+			if t.From != s || t.Input == nil || len(t.To) == 0 {
+				continue
+			}
+			switch *t.Input {
+			case "accept":
+				sub.done = true
+			case "reject":
+				sub.reject = "#" + strings.Join(append(append([]string{x.root}, path...), t.To[0]), ".")
+			}
+		}
+		config, err := x.machine(child, append(append([]string(nil), path...), s), sub)
+		if err != nil {
+			return nil, err
+		}
+		state = append(state, config...)
+	} else if f.IsLinked(s) {
+		state = append(state, jsonField{"meta", jsonObject{{"linkedMachine", f.GetLinkedMachine(s)}}})
+	}
+
+	// A child's terminal states return to the parent.
+	if ret != nil && terminal && !f.IsAccepting(s) && ret.reject != "" {
+		state = append(state, jsonField{"always", jsonObject{{"target", ret.reject}}})
+	}
+
+	var on jsonObject
+	var always []interface{}
+	for _, t := range f.Transitions {
+		if t.From != s || len(t.To) == 0 {
+			continue
+		}
+		tr := xstateTransition(f, t)
+		switch {
+		case t.Input == nil:
+			always = append(always, tr)
+		case child != nil && *t.Input == "accept":
+			state = append(state, jsonField{"onDone", tr})
+		case child != nil && *t.Input == "reject":
+			// Taken by the child's terminal states.
+		default:
+			on = on.add(*t.Input, tr)
+		}
+	}
+	if len(always) > 0 {
+		state = append(state, jsonField{"always", always})
+	}
+	if len(on) > 0 {
+		state = append(state, jsonField{"on", on})
+	}
+	if state == nil {
+		state = jsonObject{}
+	}
+	return state, nil
+}
+
+// nested reports whether machine is being written.
+func (x *xstateWriter) nested(machine string) bool {
+	for _, m := range x.nesting {
+		if m == machine {
+			return true
+		}
+	}
+	return false
+}
+
+// xstateTransition returns the config of t: its target, or an object
+// when it has actions or a guard.
+func xstateTransition(f *fsm.FSM, t fsm.Transition) interface{} {
+	actions := metadataList(t.Metadata[XStateActionsKey])
+	if f.Type == fsm.TypeMealy && t.Output != nil && *t.Output != "" {
+		actions = append(actions, *t.Output)
+	}
+	guard := t.Metadata[XStateGuardKey]
+	if len(actions) == 0 && guard == "" {
+		return t.To[0]
+	}
+	tr := jsonObject{{"target", t.To[0]}}
+	if guard != "" {
+		tr = append(tr, jsonField{"guard", guard})
+	}
+	if len(actions) > 0 {
+		tr = append(tr, jsonField{"actions", actions})
+	}
+	return tr
+}
+
+// metadataList splits a comma-separated metadata value into names.
+func metadataList(v string) []string {
+	var names []string
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// jsonObject is a JSON object that keeps its fields in order.
+type jsonObject []jsonField
+
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+// add sets key to v, collecting the values of a repeated key, such as
+// guarded transitions on one event, into an array.
+func (o jsonObject) add(key string, v interface{}) jsonObject {
+	for i, fld := range o {
+		if fld.Key == key {
+			if list, ok := fld.Value.([]interface{}); ok {
+				o[i].Value = append(list, v)
+			} else {
+				o[i].Value = []interface{}{fld.Value, v}
+			}
+			return o
+		}
+	}
+	return append(o, jsonField{key, v})
+}
+
+// MarshalJSON writes the fields in order.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, fld := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(fld.Key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(fld.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,420 @@
+package fsmfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// ParseXState reads an XState machine config, as JSON, into machines:
+// the root machine first, then one machine for each compound state,
+// which becomes a linked state (see GenerateXState for the mapping).
+// Configs for XState v4 and v5 are accepted.
+//
+// Events become inputs, final states and states tagged "accepting"
+// become accepting, and eventless transitions become epsilon
+// transitions. Guards, actions, and entry and exit actions are kept by
+// name in the xstate.* metadata keys. They are not evaluated, so a
+// state with guarded alternatives on one event, or with eventless
+// transitions, makes its machine an NFA. A transition without a target
+// becomes a self-loop.
+//
+// Within a compound state, onDone becomes the parent's transition on
+// "accept", and an eventless transition leaving the compound state from
+// a state that has no other transitions becomes the parent's transition
+// on "reject". Other transitions out of a compound state, parallel and
+// history states, and transitions into a compound state's children from
+// outside it cannot be represented and are reported as errors.
+func ParseXState(data []byte) ([]*fsm.FSM, error) {
+	var cfg xstateNode
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing XState config: %w", err)
+	}
+	id := cfg.ID
+	if id == "" {
+		id = "machine"
+	}
+	root := &xstateTreeNode{cfg: cfg}
+	p := &xstateParser{byID: make(map[string]*xstateTreeNode), used: make(map[string]bool)}
+	if err := p.tree(root, id); err != nil {
+		return nil, err
+	}
+	if len(root.children) == 0 {
+		return nil, fmt.Errorf("XState config has no states")
+	}
+	p.used[id] = true
+	if _, err := p.machine(id, root); err != nil {
+		return nil, err
+	}
+	p.machines[0].Description = cfg.Description
+	return p.machines, nil
+}
+
+// xstateNode is a state node of an XState config. Fields that take
+// several shapes are decoded later.
+type xstateNode struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Description string                 `json:"description"`
+	Initial     string                 `json:"initial"`
+	States      json.RawMessage        `json:"states"`
+	On          json.RawMessage        `json:"on"`
+	Always      interface{}            `json:"always"`
+	OnDone      interface{}            `json:"onDone"`
+	Entry       interface{}            `json:"entry"`
+	Exit        interface{}            `json:"exit"`
+	Tags        interface{}            `json:"tags"`
+	Meta        map[string]interface{} `json:"meta"`
+}
+
+// xstateTreeNode is a state node with its place in the config.
+type xstateTreeNode struct {
+	key      string
+	cfg      xstateNode
+	parent   *xstateTreeNode
+	children []*xstateTreeNode
+}
+
+type xstateParser struct {
+	byID     map[string]*xstateTreeNode
+	used     map[string]bool // machine names
+	machines []*fsm.FSM
+}
+
+// tree reads the states below n, whose id is id, registering the ids
+// that # targets refer to.
+func (p *xstateParser) tree(n *xstateTreeNode, id string) error {
+	switch n.cfg.Type {
+	case "parallel", "history":
+		return fmt.Errorf("state %q: %s states are not supported", n.key, n.cfg.Type)
+	}
+	p.byID[id] = n
+	if n.cfg.ID != "" {
+		p.byID[n.cfg.ID] = n
+	}
+	keys, values, err := orderedObject(n.cfg.States)
+	if err != nil {
+		return fmt.Errorf("states of %q: %w", id, err)
+	}
+	for _, k := range keys {
+		c := &xstateTreeNode{key: k, parent: n}
+		if err := json.Unmarshal(values[k], &c.cfg); err != nil {
+			return fmt.Errorf("state %q: %w", k, err)
+		}
+		n.children = append(n.children, c)
+		if err := p.tree(c, id+"."+k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// machine builds the machine named name from the children of n, and
+// those of its compound children, and reports where n's children
+// return to on "reject" ("" if nowhere).
+func (p *xstateParser) machine(name string, n *xstateTreeNode) (string, error) {
+	f := fsm.New(fsm.TypeDFA)
+	f.Name = name
+	p.machines = append(p.machines, f)
+	for _, c := range n.children {
+		f.AddState(c.key)
+	}
+	f.Initial = n.cfg.Initial
+	if f.Initial == "" {
+		f.Initial = n.children[0].key
+	}
+	if !f.HasState(f.Initial) {
+		return "", fmt.Errorf("initial state %q of %q is not one of its states", f.Initial, name)
+	}
+
+	reject := ""
+	var accepting []string
+	for _, c := range n.children {
+		s := c.key
+		if c.cfg.Type == "final" || contains(stringList(c.cfg.Tags), "accepting") {
+			accepting = append(accepting, s)
+		}
+		if entry := actionNames(c.cfg.Entry); len(entry) > 0 {
+			f.SetStateMetadata(s, XStateEntryKey, strings.Join(entry, ","))
+		}
+		if exit := actionNames(c.cfg.Exit); len(exit) > 0 {
+			f.SetStateMetadata(s, XStateExitKey, strings.Join(exit, ","))
+		}
+		if m, ok := c.cfg.Meta["linkedMachine"].(string); ok && m != "" {
+			f.SetLinkedMachine(s, m)
+		}
+
+		if len(c.children) > 0 {
+			child := p.machineName(s)
+			f.SetLinkedMachine(s, child)
+			childReject, err := p.machine(child, c)
+			if err != nil {
+				return "", err
+			}
+			if childReject != "" {
+				result := "reject"
+				f.AddInput(result)
+				f.AddTransition(s, &result, []string{childReject}, nil)
+			}
+			done, err := transitionConfigs(c.cfg.OnDone)
+			if err != nil {
+				return "", fmt.Errorf("onDone of %q: %w", s, err)
+			}
+			accept := "accept"
+			for _, tc := range done {
+				if err := p.addTransition(f, c, &accept, tc); err != nil {
+					return "", err
+				}
+			}
+		}
+
+		// A state whose only transition leaves the machine returns to
+		// the parent, on "reject".
+		always, err := transitionConfigs(c.cfg.Always)
+		if err != nil {
+			return "", fmt.Errorf("always of %q: %w", s, err)
+		}
+		if len(always) == 1 && len(c.cfg.On) == 0 && always[0].guard == "" && n.parent != nil {
+			if target, _ := p.resolve(c, always[0].target); target != nil && target.parent == n.parent {
+				if reject != "" && reject != target.key {
+					return "", fmt.Errorf("states of %q return to both %q and %q", n.key, reject, target.key)
+				}
+				reject = target.key
+				continue
+			}
+		}
+
+		keys, values, err := orderedObject(c.cfg.On)
+		if err != nil {
+			return "", fmt.Errorf("on of %q: %w", s, err)
+		}
+		for _, event := range keys {
+			event := event
+			var v interface{}
+			if err := json.Unmarshal(values[event], &v); err != nil {
+				return "", err
+			}
+			tcs, err := transitionConfigs(v)
+			if err != nil {
+				return "", fmt.Errorf("%q on %q: %w", s, event, err)
+			}
+			for _, tc := range tcs {
+				if err := p.addTransition(f, c, &event, tc); err != nil {
+					return "", err
+				}
+			}
+		}
+		for _, tc := range always {
+			if err := p.addTransition(f, c, nil, tc); err != nil {
+				return "", err
+			}
+		}
+	}
+	f.SetAccepting(accepting)
+
+	// Guarded alternatives and eventless transitions are not
+	// deterministic.
+	seen := make(map[string]bool)
+	for _, t := range f.Transitions {
+		key := t.From + "\x00"
+		if t.Input != nil {
+			key += *t.Input
+		}
+		if t.Input == nil || seen[key] {
+			f.Type = fsm.TypeNFA
+		}
+		seen[key] = true
+	}
+	return reject, nil
+}
+
+// addTransition adds the transition tc from n, on input (nil for an
+// eventless transition), to f.
+func (p *xstateParser) addTransition(f *fsm.FSM, n *xstateTreeNode, input *string, tc xstateTransitionConfig) error {
+	to := n.key
+	if tc.target != "" {
+		target, err := p.resolve(n, tc.target)
+		if err != nil {
+			return err
+		}
+		if target.parent != n.parent {
+			return fmt.Errorf("transition from %q to %q leaves or enters a compound state, which the model cannot represent", n.key, tc.target)
+		}
+		to = target.key
+	}
+	if input != nil {
+		f.AddInput(*input)
+	}
+	f.AddTransition(n.key, input, []string{to}, nil)
+	t := &f.Transitions[len(f.Transitions)-1]
+	if tc.guard != "" || len(tc.actions) > 0 {
+		t.Metadata = make(map[string]string)
+	}
+	if tc.guard != "" {
+		t.Metadata[XStateGuardKey] = tc.guard
+	}
+	if len(tc.actions) > 0 {
+		t.Metadata[XStateActionsKey] = strings.Join(tc.actions, ",")
+	}
+	return nil
+}
+
+// resolve finds the state node that target names, from n: a sibling's
+// key, or # and an id.
+func (p *xstateParser) resolve(n *xstateTreeNode, target string) (*xstateTreeNode, error) {
+	if strings.HasPrefix(target, "#") {
+		if t, ok := p.byID[target[1:]]; ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("state %q: unknown target %q", n.key, target)
+	}
+	for _, c := range n.parent.children {
+		if c.key == target {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("state %q: target %q is not a sibling state", n.key, target)
+}
+
+// machineName returns a machine name for a compound state's machine that
+// no other machine has.
+func (p *xstateParser) machineName(state string) string {
+	name := state
+	for i := 2; p.used[name]; i++ {
+		name = fmt.Sprintf("%s_%d", state, i)
+	}
+	p.used[name] = true
+	return name
+}
+
+// xstateTransitionConfig is one transition of an XState config.
+type xstateTransitionConfig struct {
+	target  string
+	guard   string
+	actions []string
+}
+
+// transitionConfigs reads a transition config: a target, an object, or
+// a list of either.
+func transitionConfigs(v interface{}) ([]xstateTransitionConfig, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []xstateTransitionConfig{{target: v}}, nil
+	case []interface{}:
+		var tcs []xstateTransitionConfig
+		for _, e := range v {
+			tc, err := transitionConfigs(e)
+			if err != nil {
+				return nil, err
+			}
+			tcs = append(tcs, tc...)
+		}
+		return tcs, nil
+	case map[string]interface{}:
+		var tc xstateTransitionConfig
+		switch target := v["target"].(type) {
+		case nil:
+		case string:
+			tc.target = target
+		case []interface{}:
+			if len(target) != 1 {
+				return nil, fmt.Errorf("transitions to several states are not supported")
+			}
+			tc.target, _ = target[0].(string)
+		default:
+			return nil, fmt.Errorf("malformed target %v", target)
+		}
+		guard := v["guard"]
+		if guard == nil {
+			guard = v["cond"] // XState v4
+		}
+		if names := actionNames(guard); len(names) > 0 {
+			tc.guard = names[0]
+		}
+		tc.actions = actionNames(v["actions"])
+		return []xstateTransitionConfig{tc}, nil
+	}
+	return nil, fmt.Errorf("malformed transition %v", v)
+}
+
+// actionNames reads the names of actions or a guard: a name, an object
+// with a type, or a list of either.
+func actionNames(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case map[string]interface{}:
+		if name, ok := v["type"].(string); ok {
+			return []string{name}
+		}
+	case []interface{}:
+		var names []string
+		for _, e := range v {
+			names = append(names, actionNames(e)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// stringList reads a string or a list of strings.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// orderedObject returns the keys of a JSON object in order, and their
+// values. An empty raw message is an empty object.
+func orderedObject(raw json.RawMessage) ([]string, map[string]json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected an object")
+	}
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := tok.(string)
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		if _, dup := values[key]; !dup {
+			keys = append(keys, key)
+		}
+		values[key] = v
+	}
+	return keys, values, nil
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package fsmfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+func TestGenerateXState(t *testing.T) {
+	f := fsm.New(fsm.TypeMealy)
+	f.Name = "door"
+	for _, s := range []string{"closed", "open", "locked"} {
+		f.AddState(s)
+	}
+	f.Alphabet = []string{"open", "close", "lock"}
+	f.OutputAlphabet = []string{"beep"}
+	f.SetInitial("closed")
+	f.SetAccepting([]string{"closed"})
+	f.AddTransition("closed", strp("open"), []string{"open"}, nil)
+	f.AddTransition("open", strp("close"), []string{"closed"}, strp("beep"))
+	f.AddTransition("closed", strp("lock"), []string{"locked"}, nil)
+	f.Transitions[2].Metadata = map[string]string{XStateGuardKey: "hasKey", XStateActionsKey: "log, notify"}
+	f.SetStateMetadata("locked", XStateEntryKey, "bolt")
+
+	out, err := GenerateXState(f, XStateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "id": "door",
+  "initial": "closed",
+  "states": {
+    "closed": {
+      "tags": [
+        "accepting"
+      ],
+      "on": {
+        "open": "open",
+        "lock": {
+          "target": "locked",
+          "guard": "hasKey",
+          "actions": [
+            "log",
+            "notify"
+          ]
+        }
+      }
+    },
+    "open": {
+      "on": {
+        "close": {
+          "target": "closed",
+          "actions": [
+            "beep"
+          ]
+        }
+      }
+    },
+    "locked": {
+      "entry": [
+        "bolt"
+      ]
+    }
+  }
+}
+`
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	pda := fsm.New(fsm.TypePDA)
+	if _, err := GenerateXState(pda, XStateOptions{}); err == nil {
+		t.Error("exported a pushdown automaton")
+	}
+}
+
+func TestGenerateXState_Hierarchy(t *testing.T) {
+	main := fsm.New(fsm.TypeDFA)
+	main.Name = "main"
+	for _, s := range []string{"idle", "auth", "done", "failed"} {
+		main.AddState(s)
+	}
+	main.Alphabet = []string{"start", "accept", "reject", "cancel"}
+	main.SetInitial("idle")
+	main.SetLinkedMachine("auth", "login")
+	main.AddTransition("idle", strp("start"), []string{"auth"}, nil)
+	main.AddTransition("auth", strp("accept"), []string{"done"}, nil)
+	main.AddTransition("auth", strp("reject"), []string{"failed"}, nil)
+	main.AddTransition("auth", strp("cancel"), []string{"idle"}, nil)
+
+	login := fsm.New(fsm.TypeDFA)
+	login.Name = "login"
+	for _, s := range []string{"user", "ok", "bad"} {
+		login.AddState(s)
+	}
+	login.Alphabet = []string{"good", "wrong"}
+	login.SetInitial("user")
+	login.SetAccepting([]string{"ok"})
+	login.SetLinkedMachine("bad", "main") // a cycle, left atomic
+	login.AddTransition("user", strp("good"), []string{"ok"}, nil)
+	login.AddTransition("user", strp("wrong"), []string{"bad"}, nil)
+
+	out, err := GenerateXState(main, XStateOptions{Machines: map[string]*fsm.FSM{"main": main, "login": login}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		ID     string `json:"id"`
+		States map[string]struct {
+			Initial string                     `json:"initial"`
+			OnDone  string                     `json:"onDone"`
+			On      map[string]json.RawMessage `json:"on"`
+			States  map[string]struct {
+				Type   string            `json:"type"`
+				Always map[string]string `json:"always"`
+				Meta   map[string]string `json:"meta"`
+			} `json:"states"`
+		} `json:"states"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	auth := config.States["auth"]
+	if auth.Initial != "user" || auth.OnDone != "done" {
+		t.Errorf("auth: initial %q, onDone %q", auth.Initial, auth.OnDone)
+	}
+	if _, ok := auth.On["cancel"]; !ok || len(auth.On) != 1 {
+		t.Errorf("auth events %v, want only cancel", auth.On)
+	}
+	if auth.States["ok"].Type != "final" || auth.States["user"].Type != "" {
+		t.Errorf("final states: %+v", auth.States)
+	}
+	bad := auth.States["bad"]
+	if bad.Always["target"] != "#main.failed" || bad.Meta["linkedMachine"] != "main" {
+		t.Errorf("bad: %+v", bad)
+	}
+	if strings.Count(string(out), `"initial"`) != 2 {
+		t.Errorf("cyclic link was nested:\n%s", out)
+	}
+}
+
+func TestParseXState(t *testing.T) {
+	// An XState v4 config, with cond, action objects, and a targetless
+	// transition.
+	config := `{
+  "id": "toggle",
+  "initial": "off",
+  "states": {
+    "off": {
+      "entry": {"type": "dim"},
+      "on": {
+        "TOGGLE": [
+          {"target": "on", "cond": "hasPower", "actions": ["click", {"type": "log"}]},
+          {"target": "broken"}
+        ],
+        "PING": {"actions": "pong"}
+      }
+    },
+    "on": {"on": {"TOGGLE": "#toggle.off"}, "tags": "accepting"},
+    "broken": {"type": "final"}
+  }
+}`
+	machines, err := ParseXState([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 1 {
+		t.Fatalf("%d machines, want 1", len(machines))
+	}
+	f := machines[0]
+	if f.Name != "toggle" || f.Initial != "off" || f.Type != fsm.TypeNFA {
+		t.Errorf("name %q, initial %q, type %s", f.Name, f.Initial, f.Type)
+	}
+	if fmt.Sprint(f.States, f.Alphabet, f.Accepting) != "[off on broken] [TOGGLE PING] [on broken]" {
+		t.Errorf("states %v, inputs %v, accepting %v", f.States, f.Alphabet, f.Accepting)
+	}
+	if len(f.Transitions) != 4 {
+		t.Fatalf("transitions %v", f.Transitions)
+	}
+	if md := f.Transitions[0].Metadata; md[XStateGuardKey] != "hasPower" || md[XStateActionsKey] != "click,log" {
+		t.Errorf("guarded transition metadata %v", md)
+	}
+	if tr := f.Transitions[2]; tr.To[0] != "off" || tr.Metadata[XStateActionsKey] != "pong" {
+		t.Errorf("targetless transition %+v", tr)
+	}
+	if f.StateMetadata["off"][XStateEntryKey] != "dim" {
+		t.Errorf("entry actions %v", f.StateMetadata)
+	}
+
+	for _, bad := range []string{
+		`{"states": {}}`,
+		`{"initial": "x", "states": {"a": {}}}`,
+		`{"type": "parallel", "states": {"a": {}}}`,
+		`{"states": {"a": {"on": {"go": "nowhere"}}}}`,
+		`{"id": "m", "states": {"a": {"on": {"go": "#m.b.c"}}, "b": {"states": {"c": {}}}}}`,
+	} {
+		if _, err := ParseXState([]byte(bad)); err == nil {
+			t.Errorf("no error for %s", bad)
+		}
+	}
+}
+
+func TestParseXState_RoundTrip(t *testing.T) {
+	main := fsm.New(fsm.TypeDFA)
+	main.Name = "main"
+	for _, s := range []string{"idle", "auth", "done", "failed"} {
+		main.AddState(s)
+	}
+	main.Alphabet = []string{"start", "cancel", "accept", "reject"}
+	main.SetInitial("idle")
+	main.SetAccepting([]string{"done"})
+	main.SetLinkedMachine("auth", "login")
+	main.AddTransition("idle", strp("start"), []string{"auth"}, nil)
+	main.AddTransition("auth", strp("cancel"), []string{"idle"}, nil)
+	main.AddTransition("auth", strp("accept"), []string{"done"}, nil)
+	main.AddTransition("auth", strp("reject"), []string{"failed"}, nil)
+	main.Transitions[0].Metadata = map[string]string{XStateGuardKey: "ready"}
+
+	login := fsm.New(fsm.TypeDFA)
+	login.Name = "login"
+	for _, s := range []string{"user", "ok", "bad"} {
+		login.AddState(s)
+	}
+	login.Alphabet = []string{"good", "wrong"}
+	login.SetInitial("user")
+	login.SetAccepting([]string{"ok"})
+	login.AddTransition("user", strp("good"), []string{"ok"}, nil)
+	login.AddTransition("user", strp("wrong"), []string{"bad"}, nil)
+
+	out, err := GenerateXState(main, XStateOptions{Machines: map[string]*fsm.FSM{"login": login}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	machines, err := ParseXState(out)
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if len(machines) != 2 {
+		t.Fatalf("%d machines, want 2", len(machines))
+	}
+	gotMain, gotChild := machines[0], machines[1]
+	if gotMain.GetLinkedMachine("auth") != "auth" || gotChild.Name != "auth" {
+		t.Errorf("link %q to machine %q", gotMain.GetLinkedMachine("auth"), gotChild.Name)
+	}
+
+	// Apart from the child machine's name, the bundle is unchanged.
+	gotMain.SetLinkedMachine("auth", "login")
+	gotChild.Name = "login"
+	if !gotMain.StructurallyEqual(main) {
+		t.Errorf("main machine changed:\n%+v\nwant\n%+v", gotMain, main)
+	}
+	if !gotChild.StructurallyEqual(login) {
+		t.Errorf("child machine changed:\n%+v\nwant\n%+v", gotChild, login)
+	}
+}
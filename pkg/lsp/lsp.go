@@ -0,0 +1,532 @@
+// Package lsp is a language server for the text machine format (.fsmt;
+// see fsmfile.ToText), speaking the Language Server Protocol over a
+// stream such as stdio. It publishes parse errors and lint findings as
+// diagnostics, finds the declarations and uses of states and symbols,
+// renames them, and completes their names.
+//
+// Documents are synchronised in full on every change; the machines are
+// small enough that reparsing them is cheaper than tracking edits.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// Server is a language server session.
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]string // by URI
+
+	shutdown bool
+}
+
+// Serve runs a session on r and w until the client sends exit or closes
+// r. It returns an error for a broken stream, and for an exit without a
+// shutdown request first, as the protocol asks.
+func Serve(r io.Reader, w io.Writer) error {
+	s := &Server{in: bufio.NewReader(r), out: w, docs: make(map[string]string)}
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(msg)
+		if msg.ID == nil {
+			continue // a notification
+		}
+		reply := response{JSONRPC: "2.0", ID: msg.ID, Result: result, Error: rerr}
+		if rerr == nil && result == nil {
+			reply.Result = json.RawMessage("null")
+		}
+		if err := s.write(reply); err != nil {
+			return err
+		}
+	}
+}
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// JSON-RPC error codes.
+const (
+	codeInvalidParams  = -32602
+	codeMethodNotFound = -32601
+	codeInvalidRequest = -32600
+)
+
+// read reads a message: headers, a blank line, and Content-Length bytes
+// of JSON.
+func (s *Server) read() (*message, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("bad Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("malformed message: %w", err)
+	}
+	return &msg, nil
+}
+
+func (s *Server) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// Protocol types, with only the fields used.
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type span struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string `json:"uri"`
+	Range span   `json:"range"`
+}
+
+type textEdit struct {
+	Range   span   `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type diagnostic struct {
+	Range    span   `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+type documentParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Text    string `json:"text"`
+		Version int    `json:"version"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Position position `json:"position"`
+	NewName  string   `json:"newName"`
+	Context  struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+// Diagnostic severities and completion item kinds of the protocol.
+const (
+	severityError       = 1
+	severityWarning     = 2
+	severityInformation = 3
+
+	kindVariable = 6
+	kindClass    = 7
+	kindEvent    = 23
+	kindConstant = 21
+)
+
+func (s *Server) handle(msg *message) (interface{}, *responseError) {
+	if s.shutdown && msg.Method != "exit" {
+		return nil, &responseError{codeInvalidRequest, "server is shut down"}
+	}
+	var p documentParams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+	}
+	uri := p.TextDocument.URI
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"renameProvider":     map[string]bool{"prepareProvider": true},
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{" "}},
+			},
+			"serverInfo": map[string]string{"name": "fsm lsp"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.docs[uri] = p.TextDocument.Text
+		return nil, s.publish(uri)
+	case "textDocument/didChange":
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[uri] = p.ContentChanges[n-1].Text
+		}
+		return nil, s.publish(uri)
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		return nil, s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": []diagnostic{}})
+	case "textDocument/definition":
+		ref, lines, ok := s.refAt(uri, p.Position)
+		if !ok {
+			return nil, nil
+		}
+		decl := definition(fsmfile.TextRefs([]byte(s.docs[uri])), ref)
+		return location{uri, refSpan(lines, decl)}, nil
+	case "textDocument/references":
+		ref, lines, ok := s.refAt(uri, p.Position)
+		if !ok {
+			return nil, nil
+		}
+		locs := []location{}
+		for _, r := range fsmfile.TextRefs([]byte(s.docs[uri])) {
+			if r.Kind == ref.Kind && r.Name == ref.Name && (p.Context.IncludeDeclaration || !r.Decl) {
+				locs = append(locs, location{uri, refSpan(lines, r)})
+			}
+		}
+		return locs, nil
+	case "textDocument/prepareRename":
+		ref, lines, ok := s.refAt(uri, p.Position)
+		if !ok {
+			return nil, nil
+		}
+		return refSpan(lines, ref), nil
+	case "textDocument/rename":
+		ref, lines, ok := s.refAt(uri, p.Position)
+		if !ok {
+			return nil, &responseError{codeInvalidParams, "no state or symbol here"}
+		}
+		if p.NewName == "" {
+			return nil, &responseError{codeInvalidParams, "empty name"}
+		}
+		refs := fsmfile.TextRefs([]byte(s.docs[uri]))
+		for _, r := range refs {
+			if r.Kind == ref.Kind && r.Name == p.NewName {
+				return nil, &responseError{codeInvalidParams, fmt.Sprintf("%s %q already exists", ref.Kind, p.NewName)}
+			}
+		}
+		edits := []textEdit{}
+		for _, r := range refs {
+			if r.Kind == ref.Kind && r.Name == ref.Name {
+				edits = append(edits, textEdit{refSpan(lines, r), fsmfile.QuoteTextName(p.NewName)})
+			}
+		}
+		return map[string]interface{}{"changes": map[string][]textEdit{uri: edits}}, nil
+	case "textDocument/completion":
+		return s.complete(uri, p.Position), nil
+	}
+	if msg.ID == nil || strings.HasPrefix(msg.Method, "$/") {
+		return nil, nil // notifications we do not need, such as initialized
+	}
+	return nil, &responseError{codeMethodNotFound, "unsupported method " + msg.Method}
+}
+
+func (s *Server) notify(method string, params interface{}) *responseError {
+	if err := s.write(notification{"2.0", method, params}); err != nil {
+		return &responseError{codeInvalidRequest, err.Error()}
+	}
+	return nil
+}
+
+// publish sends the diagnostics of a document.
+func (s *Server) publish(uri string) *responseError {
+	return s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": diagnose(s.docs[uri], lintConfig(uri)),
+	})
+}
+
+// lintConfig returns the .fsmlint.toml configuration that applies to a
+// file: URI, or the defaults.
+func lintConfig(uri string) fsm.LintConfig {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return fsm.LintConfig{}
+	}
+	path := fsmfile.FindLintConfig(filepath.Dir(filepath.FromSlash(u.Path)))
+	if path == "" {
+		return fsm.LintConfig{}
+	}
+	cfg, err := fsmfile.LoadLintConfig(path)
+	if err != nil {
+		return fsm.LintConfig{}
+	}
+	return cfg
+}
+
+// transitionError matches a Validate error about a transition by index.
+var transitionError = regexp.MustCompile(`^\w+ (\d+): `)
+
+// diagnose returns the diagnostics of a text-format document: its syntax
+// error, or else its lint findings under cfg, each placed at the
+// declaration of a state or symbol it is about, or at the transition.
+func diagnose(text string, cfg fsm.LintConfig) []diagnostic {
+	lines := strings.Split(text, "\n")
+	diags := []diagnostic{}
+	f, err := fsmfile.ParseText([]byte(text))
+	if err != nil {
+		line := 1
+		if te, ok := err.(*fsmfile.TextError); ok {
+			line = te.Line
+		}
+		return append(diags, diagnostic{Range: lineSpan(lines, line), Severity: severityError, Source: "fsm", Message: err.Error()})
+	}
+	issues, err := f.Lint(cfg)
+	if err != nil {
+		return append(diags, diagnostic{Range: lineSpan(lines, 1), Severity: severityError, Source: "fsm", Message: err.Error()})
+	}
+
+	refs := fsmfile.TextRefs([]byte(text))
+	for _, issue := range issues {
+		d := diagnostic{Severity: severityWarning, Code: issue.Rule, Source: "fsm", Message: issue.Message}
+		switch issue.Severity {
+		case fsm.SeverityError:
+			d.Severity = severityError
+		case fsm.SeverityInfo:
+			d.Severity = severityInformation
+		}
+		var at []fsmfile.TextRef
+		for _, st := range issue.States {
+			at = append(at, declarationOf(refs, st, fsmfile.TextState)...)
+		}
+		for _, sym := range issue.Symbols {
+			at = append(at, declarationOf(refs, sym, fsmfile.TextInput, fsmfile.TextOutput)...)
+		}
+		if len(at) == 0 {
+			if m := transitionError.FindStringSubmatch(issue.Message); m != nil {
+				i, _ := strconv.Atoi(m[1])
+				for _, r := range refs {
+					if r.Transition == i {
+						d.Range = lineSpan(lines, r.Line)
+						break
+					}
+				}
+				diags = append(diags, d)
+				continue
+			}
+		}
+		if len(at) == 0 {
+			d.Range = lineSpan(lines, 1)
+			diags = append(diags, d)
+			continue
+		}
+		for _, r := range at {
+			d.Range = refSpan(lines, r)
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// declarationOf returns the declaration of name as one of kinds, or its
+// first use if it has none.
+func declarationOf(refs []fsmfile.TextRef, name string, kinds ...fsmfile.TextRefKind) []fsmfile.TextRef {
+	for _, kind := range kinds {
+		for _, r := range refs {
+			if r.Kind == kind && r.Name == name {
+				return []fsmfile.TextRef{definition(refs, r)}
+			}
+		}
+	}
+	return nil
+}
+
+// definition returns the declaration of the name ref refers to, or its
+// first use if it has none.
+func definition(refs []fsmfile.TextRef, ref fsmfile.TextRef) fsmfile.TextRef {
+	first := ref
+	found := false
+	for _, r := range refs {
+		if r.Kind != ref.Kind || r.Name != ref.Name {
+			continue
+		}
+		if r.Decl {
+			return r
+		}
+		if !found {
+			first, found = r, true
+		}
+	}
+	return first
+}
+
+// refAt returns the reference at a position of a document.
+func (s *Server) refAt(uri string, pos position) (fsmfile.TextRef, []string, bool) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return fsmfile.TextRef{}, nil, false
+	}
+	lines := strings.Split(text, "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return fsmfile.TextRef{}, lines, false
+	}
+	col := byteOffset(lines[pos.Line], pos.Character)
+	for _, r := range fsmfile.TextRefs([]byte(text)) {
+		if r.Line == pos.Line+1 && r.Start <= col && col <= r.End {
+			return r, lines, true
+		}
+	}
+	return fsmfile.TextRef{}, lines, false
+}
+
+// complete lists the names that belong at a position.
+func (s *Server) complete(uri string, pos position) []completionItem {
+	items := []completionItem{}
+	text, ok := s.docs[uri]
+	if !ok {
+		return items
+	}
+	lines := strings.Split(text, "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return items
+	}
+	line := lines[pos.Line]
+	kind := fsmfile.TextNameAt(line, byteOffset(line, pos.Character))
+	if kind == "" {
+		return items
+	}
+	itemKind := map[fsmfile.TextRefKind]int{
+		fsmfile.TextState:       kindVariable,
+		fsmfile.TextInput:       kindEvent,
+		fsmfile.TextOutput:      kindEvent,
+		fsmfile.TextClass:       kindClass,
+		fsmfile.TextStackSymbol: kindConstant,
+	}[kind]
+	seen := make(map[string]bool)
+	for _, r := range fsmfile.TextRefs([]byte(text)) {
+		if r.Kind == kind && !seen[r.Name] {
+			seen[r.Name] = true
+			items = append(items, completionItem{Label: fsmfile.QuoteTextName(r.Name), Kind: itemKind, Detail: string(kind)})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// Positions in the protocol count UTF-16 code units; TextRef offsets
+// count bytes.
+
+// byteOffset converts a UTF-16 offset in line to a byte offset.
+func byteOffset(line string, units int) int {
+	for i, r := range line {
+		if units <= 0 {
+			return i
+		}
+		units -= runeUnits(r)
+	}
+	return len(line)
+}
+
+// unitOffset converts a byte offset in line to a UTF-16 offset.
+func unitOffset(line string, offset int) int {
+	units := 0
+	for i, r := range line {
+		if i >= offset {
+			break
+		}
+		units += runeUnits(r)
+	}
+	return units
+}
+
+// runeUnits is the number of UTF-16 code units of r.
+func runeUnits(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func refSpan(lines []string, r fsmfile.TextRef) span {
+	line := lines[r.Line-1]
+	return span{position{r.Line - 1, unitOffset(line, r.Start)}, position{r.Line - 1, unitOffset(line, r.End)}}
+}
+
+// lineSpan spans the text of a 1-based line.
+func lineSpan(lines []string, n int) span {
+	if n < 1 || n > len(lines) {
+		n = 1
+	}
+	line := strings.TrimRight(lines[n-1], "\r")
+	return span{position{n - 1, 0}, position{n - 1, unitOffset(line, len(line))}}
+}
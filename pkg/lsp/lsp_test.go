@@ -0,0 +1,169 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+const doc = `type dfa
+inputs coin push
+
+state locked initial
+state unlocked
+state broken
+
+locked -> unlocked on coin
+unlocked -> locked on push
+`
+
+// session sends requests (method and params, numbered from 1) to a
+// server, then shutdown and exit, and returns its replies by id and the
+// notifications it sent.
+func session(t *testing.T, requests ...interface{}) (map[int]json.RawMessage, []json.RawMessage) {
+	t.Helper()
+	var in bytes.Buffer
+	send := func(v interface{}) {
+		body, _ := json.Marshal(v)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	send(map[string]interface{}{"jsonrpc": "2.0", "id": 0, "method": "initialize", "params": map[string]interface{}{}})
+	send(map[string]interface{}{"jsonrpc": "2.0", "method": "initialized", "params": map[string]interface{}{}})
+	send(map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": "untitled:a.fsmt", "languageId": "fsmt", "version": 1, "text": doc},
+	}})
+	for i := 0; i < len(requests); i += 2 {
+		send(map[string]interface{}{"jsonrpc": "2.0", "id": i/2 + 1, "method": requests[i], "params": requests[i+1]})
+	}
+	send(map[string]interface{}{"jsonrpc": "2.0", "id": 99, "method": "shutdown"})
+	send(map[string]interface{}{"jsonrpc": "2.0", "method": "exit"})
+
+	var out bytes.Buffer
+	if err := Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	replies := make(map[int]json.RawMessage)
+	var notes []json.RawMessage
+	r := bufio.NewReader(&out)
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+		r.ReadString('\n')
+		body := make([]byte, n)
+		io.ReadFull(r, body)
+		var msg struct {
+			ID     *int            `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("%v: %s", err, body)
+		}
+		switch {
+		case msg.ID == nil:
+			notes = append(notes, msg.Params)
+		case msg.Error != nil:
+			replies[*msg.ID] = msg.Error
+		default:
+			replies[*msg.ID] = msg.Result
+		}
+	}
+	return replies, notes
+}
+
+func at(line, char int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": "untitled:a.fsmt"},
+		"position":     map[string]int{"line": line, "character": char},
+	}
+}
+
+func TestServe(t *testing.T) {
+	rename := at(7, 1)
+	rename["newName"] = "closed shut"
+	taken := at(7, 1)
+	taken["newName"] = "broken"
+	replies, notes := session(t,
+		"textDocument/definition", at(8, 12), // locked in "-> locked"
+		"textDocument/rename", rename,
+		"textDocument/completion", at(7, 26), // after "on "
+		"textDocument/rename", taken,
+	)
+
+	if got := string(replies[1]); got != `{"uri":"untitled:a.fsmt","range":{"start":{"line":3,"character":6},"end":{"line":3,"character":12}}}` {
+		t.Errorf("definition: %s", got)
+	}
+
+	var edit struct {
+		Changes map[string][]textEdit `json:"changes"`
+	}
+	json.Unmarshal(replies[2], &edit)
+	edits := edit.Changes["untitled:a.fsmt"]
+	if len(edits) != 3 {
+		t.Fatalf("rename edits: %s", replies[2])
+	}
+	for _, e := range edits {
+		if e.NewText != `"closed shut"` || e.Range.End.Character-e.Range.Start.Character != len("locked") {
+			t.Errorf("rename edit %+v", e)
+		}
+	}
+
+	var items []completionItem
+	json.Unmarshal(replies[3], &items)
+	if len(items) != 2 || items[0].Label != "coin" || items[1].Label != "push" {
+		t.Errorf("completion: %s", replies[3])
+	}
+
+	if !strings.Contains(string(replies[4]), "already exists") {
+		t.Errorf("rename onto an existing state: %s", replies[4])
+	}
+
+	// The broken state is unreachable and dead.
+	if len(notes) != 1 {
+		t.Fatalf("notifications: %s", notes)
+	}
+	var published struct {
+		Diagnostics []diagnostic `json:"diagnostics"`
+	}
+	json.Unmarshal(notes[0], &published)
+	var unreachable bool
+	for _, d := range published.Diagnostics {
+		if d.Code == "unreachable" && d.Range.Start.Line == 5 && d.Severity == severityWarning {
+			unreachable = true
+		}
+	}
+	if !unreachable {
+		t.Errorf("diagnostics: %s", notes[0])
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	diags := diagnose("state a initial\nstate a\n", fsm.LintConfig{})
+	if len(diags) != 1 || diags[0].Range.Start.Line != 1 || diags[0].Severity != severityError {
+		t.Errorf("syntax error: %+v", diags)
+	}
+
+	// A Validate error about a transition is placed on its line.
+	diags = diagnose("type dfa\ninputs a\nstate s initial\ns -> s on a\ns -> s\n", fsm.LintConfig{})
+	var found bool
+	for _, d := range diags {
+		if d.Code == "invalid" && d.Range.Start.Line == 4 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("invalid machine: %+v", diags)
+	}
+}
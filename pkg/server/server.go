@@ -0,0 +1,295 @@
+// Package server serves diagrams of the machine files in a directory
+// over HTTP, for wikis and dashboards that link to them.
+//
+// Renderings are cached by the machine's fingerprint (see
+// fsm.FSM.Fingerprint), its links, and the rendering options, and are
+// sent with an ETag derived from the same key, so a diagram is drawn
+// again only when the model changes and clients revalidate cheaply.
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// DefaultCacheSize is the number of renderings a Server keeps when
+// Options.CacheSize is zero.
+const DefaultCacheSize = 128
+
+// Options configures a Server.
+type Options struct {
+	// Root is the directory machine files are served from.
+	Root string
+	// CacheSize is the number of renderings kept, least recently used
+	// first out (0 = DefaultCacheSize).
+	CacheSize int
+	// RenderTimeout bounds the time spent drawing one diagram; a request
+	// that takes longer fails with 503 Service Unavailable (0 = no
+	// limit). Drawing also stops when the client goes away.
+	RenderTimeout time.Duration
+	// Logger, if set, is sent a debug line for each rendering request,
+	// with whether the cache answered it and how long it took, and the
+	// layout and routing traces of each diagram drawn (see
+	// fsmfile.WithLogger).
+	Logger *slog.Logger
+}
+
+// Server is an http.Handler serving:
+//
+//	GET /render?file=path&machine=name&format=svg&theme=dark
+//
+// file is relative to the root and required; machine selects a machine
+// from a bundle (default: the first). format is svg (the default, drawn
+// by the native renderer), png, dot, or ascii; theme applies to svg and
+// is one of fsmfile.ThemeNames.
+type Server struct {
+	root    string
+	timeout time.Duration
+	log     *slog.Logger // nil logs nothing
+	mux     *http.ServeMux
+
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     list.List // of *cacheEntry, most recently used first
+}
+
+type cacheEntry struct {
+	key         string
+	contentType string
+	body        []byte
+}
+
+// New returns a Server for opts.
+func New(opts Options) *Server {
+	s := &Server{root: opts.Root, timeout: opts.RenderTimeout, log: opts.Logger, size: opts.CacheSize, entries: make(map[string]*list.Element)}
+	if s.size <= 0 {
+		s.size = DefaultCacheSize
+	}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/render", s.handleRender)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// renderFormats are the formats of /render with their content types.
+var renderFormats = map[string]string{
+	"svg":   "image/svg+xml",
+	"png":   "image/png",
+	"dot":   "text/vnd.graphviz; charset=utf-8",
+	"ascii": "text/plain; charset=utf-8",
+}
+
+func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	file, machine := q.Get("file"), q.Get("machine")
+	format, themeName := q.Get("format"), q.Get("theme")
+	if format == "" {
+		format = "svg"
+	}
+	contentType, ok := renderFormats[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q (use svg, png, dot, or ascii)", format), http.StatusBadRequest)
+		return
+	}
+	theme := fsmfile.DefaultTheme()
+	if themeName != "" {
+		if theme, ok = fsmfile.ThemeByName(themeName); !ok {
+			http.Error(w, fmt.Sprintf("unknown theme %q (use %s)", themeName, strings.Join(fsmfile.ThemeNames(), ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	if format != "svg" {
+		theme = fsmfile.DefaultTheme() // only SVG is themed
+	}
+	if file == "" {
+		http.Error(w, "file parameter required", http.StatusBadRequest)
+		return
+	}
+
+	f, err := s.load(file, machine)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "no such file", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	key := renderKey(f, format, theme.Name)
+	etag := `"` + key[:32] + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	entry := s.cached(key)
+	if s.log != nil {
+		hit, start := entry != nil, time.Now()
+		defer func() {
+			s.log.DebugContext(r.Context(), "render", "file", file, "machine", machine, "format", format,
+				"theme", theme.Name, "cached", hit, "duration", time.Since(start))
+		}()
+	}
+	if entry == nil {
+		ctx := r.Context()
+		if s.log != nil {
+			ctx = fsmfile.WithLogger(ctx, s.log)
+		}
+		if s.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+		}
+		body, err := render(ctx, f, format, theme)
+		if errors.Is(err, context.Canceled) {
+			return // the client has gone
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "rendering timed out", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entry = &cacheEntry{key: key, contentType: contentType, body: body}
+		s.store(entry)
+	}
+	w.Header().Set("Content-Type", entry.contentType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(entry.body)))
+	if r.Method == http.MethodGet {
+		w.Write(entry.body)
+	}
+}
+
+// load reads machine (or the first machine) from file under the root.
+// The path cannot leave the root.
+func (s *Server) load(file, machine string) (*fsm.FSM, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+file)))
+	if machine == "" {
+		f, _, err := fsmfile.ReadMachineFile(p)
+		return f, err
+	}
+	if _, err := os.Stat(p); err != nil {
+		return nil, err
+	}
+	f, _, err := fsmfile.ReadMachineFromBundle(p, machine)
+	return f, err
+}
+
+// renderKey returns the cache key of a rendering of f: a hash of its
+// fingerprint, its links, which the fingerprint leaves out but diagrams
+// show, and the options.
+func renderKey(f *fsm.FSM, format, theme string) string {
+	var sb strings.Builder
+	sb.WriteString(f.Fingerprint())
+	links := make([]string, 0, len(f.LinkedMachines))
+	for s, m := range f.LinkedMachines {
+		links = append(links, fmt.Sprintf("%q>%q", s, m))
+	}
+	sort.Strings(links)
+	fmt.Fprintf(&sb, "\n%s\n%s\n%s", strings.Join(links, ","), format, theme)
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, m := range strings.Split(header, ",") {
+		m = strings.TrimSpace(m)
+		if m == "*" || strings.TrimPrefix(m, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// render draws f in format, giving up with ctx's error if ctx is done
+// first.
+func render(ctx context.Context, f *fsm.FSM, format string, theme fsmfile.Theme) ([]byte, error) {
+	switch format {
+	case "png":
+		var buf bytes.Buffer
+		if err := fsmfile.RenderPNGContext(ctx, f, &buf, fsmfile.DefaultPNGOptions()); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "dot":
+		return []byte(fsmfile.GenerateDOT(f, f.Name)), nil
+	case "ascii":
+		diagram, err := fsmfile.RenderASCIIContext(ctx, f, nil, 80, 24)
+		return []byte(diagram), err
+	}
+	opts := fsmfile.DefaultSVGOptions()
+	opts.Title = f.Name
+	opts.Theme = theme
+	svg, err := fsmfile.GenerateSVGNativeContext(ctx, f, opts)
+	return []byte(svg), err
+}
+
+// cached returns the cached rendering for key, or nil.
+func (s *Server) cached(key string) *cacheEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry)
+}
+
+// store caches a rendering, evicting the least recently used beyond the
+// cache size.
+func (s *Server) store(entry *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[entry.key]; ok {
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[entry.key] = s.lru.PushFront(entry)
+	for s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// CacheLen returns the number of cached renderings.
+func (s *Server) CacheLen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+func writeMachine(t *testing.T, dir string, f *fsm.FSM) {
+	t.Helper()
+	if err := fsmfile.WriteMachineFile(filepath.Join(dir, "door.json"), f, fsmfile.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func doorFSM() *fsm.FSM {
+	f := fsm.New(fsm.TypeDFA)
+	f.Name = "door"
+	f.AddState("closed")
+	f.AddState("open")
+	f.AddInput("push")
+	f.SetInitial("closed")
+	in := "push"
+	f.AddTransition("closed", &in, []string{"open"}, nil)
+	f.AddTransition("open", &in, []string{"closed"}, nil)
+	return f
+}
+
+func get(s *Server, url, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	f := doorFSM()
+	writeMachine(t, dir, f)
+	s := New(Options{Root: dir, CacheSize: 2})
+
+	rec := get(s, "/render?file=door.json&format=svg&theme=dark", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("status %d, type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "<svg") {
+		t.Error("body is not SVG")
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	// Revalidation, and re-saving the machine without changing it, keep
+	// the ETag; the rendering is served from the cache.
+	if rec := get(s, "/render?file=door.json&format=svg&theme=dark", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status %d", rec.Code)
+	}
+	f.Description = "a door"
+	writeMachine(t, dir, f)
+	if rec := get(s, "/render?file=door.json&theme=dark", ""); rec.Header().Get("ETag") != etag || s.CacheLen() != 1 {
+		t.Errorf("unchanged model: ETag %s, want %s; %d cached", rec.Header().Get("ETag"), etag, s.CacheLen())
+	}
+
+	// Changing the model or the options changes the ETag.
+	f.SetAccepting([]string{"open"})
+	writeMachine(t, dir, f)
+	if rec := get(s, "/render?file=door.json&theme=dark", etag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("changed model: status %d, ETag %s", rec.Code, rec.Header().Get("ETag"))
+	}
+	for _, format := range []string{"png", "dot", "ascii"} {
+		rec := get(s, "/render?file=door.json&format="+format, "")
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || rec.Body.Len() == 0 {
+			t.Errorf("%s: status %d, ETag %s", format, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+	if s.CacheLen() != 2 {
+		t.Errorf("%d cached, want the cache size 2", s.CacheLen())
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	dir := t.TempDir()
+	writeMachine(t, dir, doorFSM())
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(Options{Root: filepath.Join(dir)})
+	for url, want := range map[string]int{
+		"/render":                                 http.StatusBadRequest,
+		"/render?file=door.json&format=gif":       http.StatusBadRequest,
+		"/render?file=door.json&theme=neon":       http.StatusBadRequest,
+		"/render?file=missing.json":               http.StatusNotFound,
+		"/render?file=../../../../etc/passwd":     http.StatusNotFound,
+		"/render?file=bad.json":                   http.StatusUnprocessableEntity,
+		"/render?file=door.json&machine=whatever": http.StatusUnprocessableEntity,
+	} {
+		if rec := get(s, url, ""); rec.Code != want {
+			t.Errorf("%s: status %d, want %d", url, rec.Code, want)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/render?file=door.json", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d", rec.Code)
+	}
+}
+
+func TestRender_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	writeMachine(t, dir, doorFSM())
+	s := New(Options{Root: dir, RenderTimeout: time.Nanosecond})
+	if rec := get(s, "/render?file=door.json", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", rec.Code)
+	}
+	// DOT needs no layout, so it is drawn whatever the timeout.
+	if rec := get(s, "/render?file=door.json&format=dot", ""); rec.Code != http.StatusOK {
+		t.Errorf("dot: status %d, want 200", rec.Code)
+	}
+
+	// A request whose client has gone is dropped, and nothing cached.
+	s = New(Options{Root: dir})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/render?file=door.json", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Body.Len() != 0 || s.CacheLen() != 0 {
+		t.Errorf("cancelled request wrote %d bytes and cached %d renderings", rec.Body.Len(), s.CacheLen())
+	}
+}
+
+func TestRender_Logger(t *testing.T) {
+	dir := t.TempDir()
+	writeMachine(t, dir, doorFSM())
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := New(Options{Root: dir, Logger: logger})
+	get(s, "/render?file=door.json", "")
+	get(s, "/render?file=door.json", "")
+	got := buf.String()
+	for _, want := range []string{
+		"msg=render file=door.json machine=\"\" format=svg theme=default cached=false",
+		"msg=render file=door.json machine=\"\" format=svg theme=default cached=true",
+		`msg="svg layout"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log lacks %q:\n%s", want, got)
+		}
+	}
+}
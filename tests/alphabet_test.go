@@ -0,0 +1,202 @@
+// Alphabet transform tests: renaming, merging, and pruning symbols must
+// carry the metadata keyed by symbol name along, so that code can still
+// be generated from the result.
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/codegen"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// pinnedMachine is a Mealy machine whose inputs go and spare and outputs
+// beep and quiet have pinned encodings; spare and quiet are unused.
+func pinnedMachine() *fsm.FSM {
+	f := fsm.New(fsm.TypeMealy)
+	f.AddState("idle")
+	f.AddState("busy")
+	for _, in := range []string{"go", "stop", "spare"} {
+		f.AddInput(in)
+	}
+	f.AddOutput("beep")
+	f.AddOutput("quiet")
+	f.SetInitial("idle")
+	goIn, stop, beep := "go", "stop", "beep"
+	f.AddTransition("idle", &goIn, []string{"busy"}, &beep)
+	f.AddTransition("busy", &stop, []string{"idle"}, &beep)
+	f.Metadata = map[string]string{
+		fsm.InputEncodingPrefix + "go":     "7",
+		fsm.InputEncodingPrefix + "spare":  "9",
+		fsm.OutputEncodingPrefix + "beep":  "0x10",
+		fsm.OutputEncodingPrefix + "quiet": "0x11",
+	}
+	return f
+}
+
+// generateGo generates Go for f, failing if the pinned encodings were
+// set aside.
+func generateGo(t *testing.T, f *fsm.FSM) string {
+	t.Helper()
+	if _, err := f.Encodings(); err != nil {
+		t.Fatalf("Encodings: %v", err)
+	}
+	code := codegen.GenerateGo(f, "pins")
+	if strings.Contains(code, "encoding metadata ignored") {
+		t.Fatalf("generated code ignored the encodings:\n%s", code)
+	}
+	return code
+}
+
+func TestRenameSymbolKeepsEncoding(t *testing.T) {
+	f := pinnedMachine()
+	if err := f.RenameSymbol(fsm.InputSymbol, "go", "run"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.RenameSymbol(fsm.OutputSymbol, "beep", "chime"); err != nil {
+		t.Fatal(err)
+	}
+	generateGo(t, f)
+	enc, _ := f.Encodings()
+	if enc.Inputs["run"] != 7 || enc.Outputs["chime"] != 0x10 {
+		t.Errorf("encodings not carried over: %v %v", enc.Inputs, enc.Outputs)
+	}
+	if _, ok := f.Metadata[fsm.InputEncodingPrefix+"go"]; ok {
+		t.Error("encoding for go left behind")
+	}
+}
+
+func TestPruneAlphabetDropsEncoding(t *testing.T) {
+	f := pinnedMachine()
+	inputs, outputs := f.PruneAlphabet()
+	if len(inputs) != 1 || inputs[0] != "spare" || len(outputs) != 1 || outputs[0] != "quiet" {
+		t.Fatalf("pruned %v, %v", inputs, outputs)
+	}
+	generateGo(t, f)
+	for _, k := range []string{fsm.InputEncodingPrefix + "spare", fsm.OutputEncodingPrefix + "quiet"} {
+		if _, ok := f.Metadata[k]; ok {
+			t.Errorf("%s left behind", k)
+		}
+	}
+}
+
+func TestMergeSymbolsEncoding(t *testing.T) {
+	// go is pinned and stop is not: the merged symbol keeps go's value.
+	f := pinnedMachine()
+	if err := f.MergeSymbols(fsm.InputSymbol, []string{"go", "stop"}, "toggle"); err != nil {
+		t.Fatal(err)
+	}
+	generateGo(t, f)
+	if enc, _ := f.Encodings(); enc.Inputs["toggle"] != 7 {
+		t.Errorf("toggle = %d, want 7", enc.Inputs["toggle"])
+	}
+
+	// go and spare are pinned to different values.
+	f = pinnedMachine()
+	if err := f.MergeSymbols(fsm.InputSymbol, []string{"spare"}, "go"); err == nil {
+		t.Error("merging inputs with different encodings succeeded")
+	}
+	if len(f.Alphabet) != 3 {
+		t.Errorf("failed merge changed the alphabet: %v", f.Alphabet)
+	}
+
+	// go and spare behave alike, but cannot be merged while their
+	// encodings differ.
+	f = pinnedMachine()
+	spare, beep := "spare", "beep"
+	f.AddTransition("idle", &spare, []string{"busy"}, &beep)
+	if groups := f.EquivalentInputs(); len(groups) != 0 {
+		t.Errorf("EquivalentInputs = %v, want none", groups)
+	}
+	delete(f.Metadata, fsm.InputEncodingPrefix+"spare")
+	groups := f.EquivalentInputs()
+	if len(groups) != 1 || strings.Join(groups[0], " ") != "go spare" {
+		t.Fatalf("EquivalentInputs = %v, want [[go spare]]", groups)
+	}
+	if err := f.MergeSymbols(fsm.InputSymbol, groups[0], "go"); err != nil {
+		t.Fatal(err)
+	}
+	generateGo(t, f)
+}
+
+// numberMachine reads an optional sign and then digits; sign and digit
+// are input classes with the same transitions, and other is an unused
+// class.
+func numberMachine() *fsm.FSM {
+	f := fsm.New(fsm.TypeDFA)
+	f.AddState("start")
+	f.AddState("number")
+	for _, in := range []string{"digit", "sign", "other"} {
+		f.AddInput(in)
+	}
+	f.Metadata = map[string]string{
+		fsm.InputClassPrefix + "digit": "[0-9]",
+		fsm.InputClassPrefix + "sign":  `[+\-]`,
+		fsm.InputClassPrefix + "other": "*",
+	}
+	f.SetInitial("start")
+	f.SetAccepting([]string{"number"})
+	for _, in := range []string{"digit", "sign"} {
+		in := in
+		f.AddTransition("start", &in, []string{"number"}, nil)
+		f.AddTransition("number", &in, []string{"number"}, nil)
+	}
+	return f
+}
+
+// reads reports whether f accepts input, a character per step.
+func reads(t *testing.T, f *fsm.FSM, input string) bool {
+	t.Helper()
+	r, err := fsm.NewRunner(f)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+	for _, c := range input {
+		if _, err := r.Step(string(c)); err != nil {
+			return false
+		}
+	}
+	return r.IsAccepting()
+}
+
+func TestInputClassesFollowSymbols(t *testing.T) {
+	f := numberMachine()
+	if groups := f.EquivalentInputs(); len(groups) != 0 {
+		t.Errorf("classes with different patterns grouped: %v", groups)
+	}
+	if err := f.MergeSymbols(fsm.InputSymbol, []string{"sign"}, "digit"); err == nil {
+		t.Error("merging classes with different patterns succeeded")
+	}
+
+	if err := f.RenameSymbol(fsm.InputSymbol, "sign", "plusminus"); err != nil {
+		t.Fatal(err)
+	}
+	if f.Metadata[fsm.InputClassPrefix+"plusminus"] != `[+\-]` {
+		t.Errorf("class pattern not renamed: %v", f.Metadata)
+	}
+	if !reads(t, f, "+12") {
+		t.Error("+12 not accepted after renaming sign")
+	}
+
+	if inputs, _ := f.PruneAlphabet(); len(inputs) != 1 || inputs[0] != "other" {
+		t.Fatalf("pruned %v, want [other]", inputs)
+	}
+	if _, ok := f.Metadata[fsm.InputClassPrefix+"other"]; ok {
+		t.Error("class of a pruned input left behind")
+	}
+	if reads(t, f, "x") {
+		t.Error("x accepted after pruning the * class")
+	}
+	generateGo(t, f)
+
+	// A plain symbol that behaves like a class reads different inputs.
+	f = numberMachine()
+	delete(f.Metadata, fsm.InputClassPrefix+"sign")
+	if groups := f.EquivalentInputs(); len(groups) != 0 {
+		t.Errorf("class grouped with a plain symbol: %v", groups)
+	}
+	if err := f.MergeSymbols(fsm.InputSymbol, []string{"sign", "digit"}, "digit"); err == nil {
+		t.Error("merging a class with a plain symbol succeeded")
+	}
+}
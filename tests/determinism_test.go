@@ -0,0 +1,185 @@
+// Determinism tests: every serialiser must produce the same bytes for the
+// same machine, and re-saving a loaded file must reproduce it exactly, so
+// that files under version control do not change when nothing changed.
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/codegen"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// determinismMachine is a random machine with the map-valued fields
+// (links, metadata, Moore outputs) that are easiest to emit unstably.
+func determinismMachine(t *testing.T, typ fsm.Type) *fsm.FSM {
+	t.Helper()
+	f, err := fsm.Random(fsm.RandomOptions{States: 12, Alphabet: 3, Outputs: 3, Type: typ, Seed: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Name = "det_" + string(typ)
+	f.Metadata = map[string]string{"b": "2", "a": "1", "c": "3"}
+	for i, s := range f.States {
+		f.SetStateMetadata(s, "index", fmt.Sprint(i))
+		if i%4 == 1 {
+			f.SetLinkedMachine(s, "sub"+fmt.Sprint(i))
+		}
+	}
+	return f
+}
+
+// serialisations renders f in every output format.
+func serialisations(t *testing.T, f *fsm.FSM) map[string][]byte {
+	t.Helper()
+	out := make(map[string][]byte)
+
+	js, err := fsmfile.ToJSON(f, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out["json"] = js
+
+	var archive bytes.Buffer
+	positions := make(map[string][2]int)
+	for i, s := range f.States {
+		positions[s] = [2]int{i * 10, i * 3}
+	}
+	if err := fsmfile.WriteFSMWithLayout(&archive, f, true, positions, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	out["fsm"] = archive.Bytes()
+
+	records, states, inputs, outputs := fsmfile.FSMToRecords(f)
+	out["hex"] = []byte(fsmfile.FormatHex(records, 4))
+	out["labels"] = []byte(fsmfile.GenerateLabels(f, states, inputs, outputs))
+	out["layout"] = []byte(fsmfile.GenerateLayout(positions, 1, 2))
+	out["dot"] = []byte(fsmfile.GenerateDOT(f, f.Name))
+	out["tikz"] = []byte(fsmfile.GenerateTikZ(f, fsmfile.DefaultTikZOptions()))
+	out["ascii"] = []byte(fsmfile.RenderASCII(f, nil, 80, 24))
+	out["c"] = []byte(codegen.GenerateC(f))
+	out["go"] = []byte(codegen.GenerateGo(f, "det"))
+	out["tinygo"] = []byte(codegen.GenerateTinyGo(f, "det"))
+	out["rust"] = []byte(codegen.GenerateRust(f))
+	out["doc-header"] = []byte(codegen.DocHeader(f, "det.fsm"))
+	return out
+}
+
+func TestDeterministicSerialisation(t *testing.T) {
+	for _, typ := range []fsm.Type{fsm.TypeDFA, fsm.TypeNFA, fsm.TypeMoore, fsm.TypeMealy} {
+		t.Run(string(typ), func(t *testing.T) {
+			f := determinismMachine(t, typ)
+			first := serialisations(t, f)
+			// Map iteration order varies between runs, so a few repeats
+			// catch unsorted output with high probability.
+			for run := 0; run < 5; run++ {
+				for format, got := range serialisations(t, f.Clone()) {
+					if !bytes.Equal(got, first[format]) {
+						t.Fatalf("%s output differs between runs", format)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestDeterministicPNG guards the frames of trace animations: a native
+// PNG that changed between renders would make the diagram jitter.
+func TestDeterministicPNG(t *testing.T) {
+	f := determinismMachine(t, fsm.TypeMealy)
+	opts := fsmfile.DefaultPNGOptions()
+	opts.Width, opts.Height = 400, 300
+	var first bytes.Buffer
+	if err := fsmfile.RenderPNG(f, &first, opts); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 3; run++ {
+		var got bytes.Buffer
+		if err := fsmfile.RenderPNG(f, &got, opts); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), first.Bytes()) {
+			t.Fatal("native PNG differs between renders")
+		}
+	}
+}
+
+func TestResaveIsByteIdentical(t *testing.T) {
+	for _, typ := range []fsm.Type{fsm.TypeDFA, fsm.TypeNFA, fsm.TypeMoore, fsm.TypeMealy} {
+		t.Run(string(typ), func(t *testing.T) {
+			f := determinismMachine(t, typ)
+
+			var archive bytes.Buffer
+			if err := fsmfile.WriteFSM(&archive, f, true); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := fsmfile.ReadFSMBytes(archive.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var again bytes.Buffer
+			if err := fsmfile.WriteFSM(&again, loaded, true); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(archive.Bytes(), again.Bytes()) {
+				t.Error(".fsm changed when re-saved")
+			}
+
+			js, err := fsmfile.ToJSON(loaded, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Loading is deterministic too: a second load exports the same.
+			for run := 0; run < 5; run++ {
+				other, err := fsmfile.ReadFSMBytes(archive.Bytes())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if js2, _ := fsmfile.ToJSON(other, true); !bytes.Equal(js, js2) {
+					t.Fatal("JSON differs between loads of the same .fsm")
+				}
+			}
+			reloaded, err := fsmfile.ParseJSON(js)
+			if err != nil {
+				t.Fatal(err)
+			}
+			js2, err := fsmfile.ToJSON(reloaded, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(js, js2) {
+				t.Errorf("JSON changed when re-saved:\n%s\n---\n%s", js, js2)
+			}
+		})
+	}
+}
+
+func TestDeterministicBundle(t *testing.T) {
+	dir := t.TempDir()
+	machines := map[string]fsmfile.BundleMachineData{}
+	for _, typ := range []fsm.Type{fsm.TypeDFA, fsm.TypeNFA, fsm.TypeMoore, fsm.TypeMealy} {
+		f := determinismMachine(t, typ)
+		machines[f.Name] = fsmfile.BundleMachineData{FSM: f, Positions: map[string][2]int{f.States[0]: {1, 1}, f.States[1]: {5, 5}}}
+	}
+	var first []byte
+	for run := 0; run < 3; run++ {
+		path := filepath.Join(dir, fmt.Sprintf("b%d.fsm", run))
+		if err := fsmfile.WriteBundleFromData(path, machines); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run == 0 {
+			first = data
+		} else if !bytes.Equal(data, first) {
+			t.Fatal("bundle bytes differ between runs")
+		}
+	}
+}
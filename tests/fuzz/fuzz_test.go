@@ -76,6 +76,35 @@ func FuzzParseJSON(f *testing.F) {
 	})
 }
 
+// FuzzParseText tests the text format parser with arbitrary input.
+func FuzzParseText(f *testing.F) {
+	f.Add("state idle initial\nidle -> run on start / ack\n")
+	f.Add("type nfa\ns0 -> s1 s2\ns1 -> s0 on a\n  weight 2\n  meta k \"v w\"\n")
+	f.Add("type pda\nstack Z X\nstack-start Z\nq -> q on \"(\"\n  push X Z\n  pop Z\n")
+	f.Add("class led\n  property level float64\n  port A input 1 G\nstate s\n  class led\n  set level 0.5\n")
+	f.Add("net VCC U1 A U2 K\n")
+	f.Add("")
+	f.Add("  meta k v")
+	f.Add("name \"open")
+
+	f.Fuzz(func(t *testing.T, data string) {
+		// Should not panic
+		machine, err := fsmfile.ParseText([]byte(data))
+		if err != nil {
+			return
+		}
+		// What it prints reads back, and prints the same
+		text := fsmfile.ToText(machine)
+		again, err := fsmfile.ParseText(text)
+		if err != nil {
+			t.Fatalf("printed text does not parse: %v\n%s", err, text)
+		}
+		if string(fsmfile.ToText(again)) != string(text) {
+			t.Fatalf("printed text is not canonical:\n%s\nthen\n%s", text, fsmfile.ToText(again))
+		}
+	})
+}
+
 // FuzzParseRecord tests individual record parsing.
 func FuzzParseRecord(f *testing.F) {
 	f.Add("0000 0000:0000 0001:0000")
@@ -0,0 +1,193 @@
+package fuzz
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// roundTripAll converts f through JSON, a .fsm archive, and hex records
+// with labels, failing the test if any stage errors or changes behaviour.
+func roundTripAll(t *testing.T, f *fsm.FSM) {
+	t.Helper()
+
+	data, err := fsmfile.ToJSON(f, false)
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	g, err := fsmfile.ParseJSON(data)
+	if err != nil {
+		t.Fatalf("ParseJSON of own output: %v", err)
+	}
+	if eq, cex := fsm.Equivalent(f, g); !eq {
+		t.Fatalf("JSON round-trip changed behaviour, counterexample %q", cex)
+	}
+
+	var buf bytes.Buffer
+	if err := fsmfile.WriteFSM(&buf, f, true); err != nil {
+		t.Fatalf("WriteFSM: %v", err)
+	}
+	g, err = fsmfile.ReadFSMBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadFSMBytes of own output: %v", err)
+	}
+	if eq, cex := fsm.Equivalent(f, g); !eq {
+		t.Fatalf(".fsm round-trip changed behaviour, counterexample %q", cex)
+	}
+
+	records, states, inputs, outputs := fsmfile.FSMToRecords(f)
+	parsed, err := fsmfile.ParseHex(fsmfile.FormatHex(records, 4))
+	if err != nil {
+		t.Fatalf("ParseHex of own output: %v", err)
+	}
+	labels, err := fsmfile.ParseLabels(fsmfile.GenerateLabels(f, states, inputs, outputs))
+	if err != nil {
+		t.Fatalf("ParseLabels of own output: %v", err)
+	}
+	g, err = fsmfile.RecordsToFSM(parsed, labels)
+	if err != nil {
+		t.Fatalf("RecordsToFSM: %v", err)
+	}
+	if eq, cex := fsm.Equivalent(f, g); !eq {
+		t.Fatalf("hex round-trip changed behaviour, counterexample %q", cex)
+	}
+}
+
+// FuzzRoundTripRandom checks that generated machines of every type
+// survive all serialisations unchanged.
+func FuzzRoundTripRandom(f *testing.F) {
+	f.Add(uint8(5), uint8(2), uint8(80), uint8(0), int64(1))
+	f.Add(uint8(30), uint8(7), uint8(20), uint8(1), int64(2))
+	f.Add(uint8(1), uint8(1), uint8(100), uint8(2), int64(3))
+	f.Add(uint8(60), uint8(200), uint8(5), uint8(3), int64(4))
+
+	types := []fsm.Type{fsm.TypeDFA, fsm.TypeNFA, fsm.TypeMoore, fsm.TypeMealy}
+
+	f.Fuzz(func(t *testing.T, states, inputs, density, typ uint8, seed int64) {
+		m, err := fsm.Random(fsm.RandomOptions{
+			States:   int(states)%16 + 1,
+			Alphabet: int(inputs)%32 + 1,
+			Density:  float64(density%101) / 100,
+			Type:     types[int(typ)%len(types)],
+			Seed:     seed,
+		})
+		if err != nil {
+			t.Fatalf("Random: %v", err)
+		}
+		roundTripAll(t, m)
+	})
+}
+
+// FuzzRoundTripJSON checks that any valid machine accepted by the JSON
+// parser serialises back to an equivalent machine.
+func FuzzRoundTripJSON(f *testing.F) {
+	f.Add([]byte(`{"type":"dfa","states":["s0","s1"],"alphabet":["a"],"initial":"s0","accepting":["s1"],"transitions":[{"from":"s0","input":"a","to":"s1"}]}`))
+	f.Add([]byte(`{"type":"nfa","states":["q0","q1"],"alphabet":["a"],"initial":"q0","accepting":["q1"],"transitions":[{"from":"q0","input":null,"to":["q0","q1"]}]}`))
+	f.Add([]byte(`{"type":"mealy","states":["é","😀"],"alphabet":["→"],"output_alphabet":["\"q\""],"initial":"é","transitions":[{"from":"é","input":"→","to":"😀","output":"\"q\""}]}`))
+	f.Add([]byte(`{"type":"moore","states":["a b"],"alphabet":["x=y"],"output_alphabet":["#o"],"initial":"a b","state_outputs":{"a b":"#o"}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := fsmfile.ParseJSON(data)
+		if err != nil || m.Validate() != nil {
+			return
+		}
+		// The hex encoding is limited to 16-bit indices.
+		if len(m.States) > 0xFFFF || len(m.Alphabet) >= 0xFFFF || len(m.OutputAlphabet) > 0xFFFF {
+			return
+		}
+		// Hex records cannot represent duplicate names.
+		if hasDuplicates(m.States) || hasDuplicates(m.Alphabet) || hasDuplicates(m.OutputAlphabet) {
+			return
+		}
+		roundTripAll(t, m)
+	})
+}
+
+// FuzzLabelRoundTrip checks that arbitrary state, input, and output names
+// survive labels.toml exactly.
+func FuzzLabelRoundTrip(f *testing.F) {
+	for _, s := range []string{"idle", "a b", "\"quoted\"", "tab\there", "x = y", "# not a comment",
+		"[section]", "back\\slash", "λ", "😀", "new\nline", "'single'", "0x0001"} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		if name == "" || name == "other" || !utf8.ValidString(name) {
+			return
+		}
+		m := fsm.New(fsm.TypeMealy)
+		m.AddState(name)
+		m.AddState("other")
+		m.Alphabet = []string{name}
+		m.OutputAlphabet = []string{name}
+		m.SetInitial(name)
+		m.AddTransition(name, &name, []string{"other"}, &name)
+
+		records, states, inputs, outputs := fsmfile.FSMToRecords(m)
+		labels, err := fsmfile.ParseLabels(fsmfile.GenerateLabels(m, states, inputs, outputs))
+		if err != nil {
+			t.Fatalf("ParseLabels: %v", err)
+		}
+		g, err := fsmfile.RecordsToFSM(records, labels)
+		if err != nil {
+			t.Fatalf("RecordsToFSM: %v", err)
+		}
+		if g.Initial != name || len(g.Alphabet) != 1 || g.Alphabet[0] != name ||
+			len(g.OutputAlphabet) != 1 || g.OutputAlphabet[0] != name {
+			t.Fatalf("name %q not preserved: initial %q, alphabet %q, outputs %q",
+				name, g.Initial, g.Alphabet, g.OutputAlphabet)
+		}
+	})
+}
+
+// FuzzParseClipboard feeds arbitrary text to the fsmedit paste parser.
+// It must never panic, and whatever it accepts must copy back unchanged.
+func FuzzParseClipboard(f *testing.F) {
+	m := fsm.New(fsm.TypeDFA)
+	m.AddState("s0")
+	m.AddState("s1")
+	m.Alphabet = []string{"a"}
+	m.SetInitial("s0")
+	a := "a"
+	m.AddTransition("s0", &a, []string{"s1"}, nil)
+	good := fsmfile.FormatClipboard(m, map[string][2]int{"s0": {1, 2}}, 0, 0)
+
+	f.Add(good)
+	f.Add("\xef\xbb\xbf" + good)
+	f.Add("0000 0000:0000 0001:0000")
+	f.Add("# ---- layout.toml -----------------------------------\n# ---- labels.toml -----------------------------------")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		g, _, err := fsmfile.ParseClipboard(text)
+		if err != nil || g.Validate() != nil {
+			return
+		}
+		// Sparse state IDs can declare thousands of states; keep the
+		// equivalence check (a subset construction for NFAs) cheap.
+		if len(g.States) > 64 || len(g.Alphabet) > 64 {
+			return
+		}
+		h, _, err := fsmfile.ParseClipboard(fsmfile.FormatClipboard(g, nil, 0, 0))
+		if err != nil {
+			t.Fatalf("cannot paste own copy: %v", err)
+		}
+		if eq, cex := fsm.Equivalent(g, h); !eq {
+			t.Fatalf("copy/paste changed behaviour, counterexample %q", cex)
+		}
+	})
+}
+
+func hasDuplicates(list []string) bool {
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		if seen[s] {
+			return true
+		}
+		seen[s] = true
+	}
+	return false
+}
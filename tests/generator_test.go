@@ -0,0 +1,152 @@
+// Generator tests: the registry must offer the built-in targets and
+// registered ones by name, and an external program must receive the
+// machine as JSON and have its output taken as the code.
+package tests
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/codegen"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+type upperGenerator struct{}
+
+func (upperGenerator) Name() string      { return "test-upper" }
+func (upperGenerator) Extension() string { return ".txt" }
+
+func (upperGenerator) Generate(f *fsm.FSM, opts codegen.Options) (string, error) {
+	return strings.ToUpper(opts.Package + ":" + strings.Join(f.States, ",")), nil
+}
+
+func TestBuiltinGenerators(t *testing.T) {
+	f := wordMachine("letter", "[a-z]")
+	f.Name = "word"
+	for _, name := range []string{"c", "rust", "go", "tinygo"} {
+		g := codegen.GeneratorByName(name)
+		if g == nil {
+			t.Fatalf("%s is not registered", name)
+		}
+		code, err := g.Generate(f, codegen.Options{Package: "words"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if code == "" || g.Extension() == "" {
+			t.Errorf("%s: no code or extension", name)
+		}
+	}
+	code, _ := codegen.GeneratorByName("go").Generate(f, codegen.Options{Package: "words"})
+	if code != codegen.GenerateGo(f, "words") {
+		t.Error("the go generator differs from GenerateGo")
+	}
+
+	pda := fsm.New(fsm.TypePDA)
+	pda.AddState("q")
+	pda.SetInitial("q")
+	if _, err := codegen.GeneratorByName("c").Generate(pda, codegen.Options{}); err == nil {
+		t.Error("the c generator accepted a PDA")
+	}
+}
+
+func TestRegisterGenerator(t *testing.T) {
+	if codegen.GeneratorByName("test-upper") == nil { // not on a repeated run
+		codegen.Register(upperGenerator{})
+	}
+	g := codegen.GeneratorByName("test-upper")
+	if g == nil {
+		t.Fatal("registered generator not found")
+	}
+	f := wordMachine("letter", "[a-z]")
+	code, err := g.Generate(f, codegen.Options{Package: "pkg"})
+	if err != nil || code != "PKG:START,WORD" {
+		t.Errorf("Generate = %q, %v", code, err)
+	}
+
+	var names []string
+	for _, g := range codegen.Generators() {
+		names = append(names, g.Name())
+	}
+	if got := strings.Join(names, " "); got != "c go rust test-upper tinygo" {
+		t.Errorf("Generators = %s", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	codegen.Register(upperGenerator{})
+}
+
+// writeScript writes an executable shell script to a temporary
+// directory and returns its path.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "gen")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExternalGenerator(t *testing.T) {
+	dir := t.TempDir()
+	script := writeScript(t, `cat > "`+filepath.Join(dir, "in.json")+`"
+echo "package $FSM_PACKAGE from $FSM_SOURCE"
+`)
+	f := wordMachine("letter", "[a-z]")
+	f.Name = "word"
+	g := codegen.External(script)
+	if g.Name() != "external:"+script {
+		t.Errorf("Name = %q", g.Name())
+	}
+	code, err := g.Generate(f, codegen.Options{Package: "plc", Source: "word.fsm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "package plc from word.fsm\n" {
+		t.Errorf("code = %q", code)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "in.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsmfile.ParseJSON(data)
+	if err != nil {
+		t.Fatalf("the program was not sent JSON: %v", err)
+	}
+	if got.Fingerprint() != f.Fingerprint() {
+		t.Error("the program was sent a different machine")
+	}
+}
+
+func TestExternalGeneratorErrors(t *testing.T) {
+	f := wordMachine("letter", "[a-z]")
+
+	failing := writeScript(t, "echo 'unsupported construct' >&2\nexit 2\n")
+	_, err := codegen.External(failing).Generate(f, codegen.Options{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported construct") {
+		t.Errorf("failing program: err = %v", err)
+	}
+
+	silent := writeScript(t, "cat > /dev/null\n")
+	if _, err := codegen.External(silent).Generate(f, codegen.Options{}); err == nil {
+		t.Error("a program writing no code succeeded")
+	}
+
+	_, err = codegen.External("fsm-no-such-generator").Generate(f, codegen.Options{})
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("missing program: err = %v", err)
+	}
+}
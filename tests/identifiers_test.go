@@ -0,0 +1,107 @@
+// Identifier tests: state, input, and output names that are not
+// identifiers must still give generated code that compiles, with every
+// name mapped to an identifier of its own.
+package tests
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/codegen"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// awkwardMachine has names with spaces, punctuation, quotes, braces, a
+// keyword, non-ASCII letters, leading digits, and names that give the
+// same identifier.
+func awkwardMachine() *fsm.FSM {
+	f := fsm.New(fsm.TypeMealy)
+	f.Name = "2 door lock"
+	f.States = []string{"door open", "door-open", "DoorOpen", "état", "1st", "self", `say "hi" {now}`}
+	f.Initial = "door open"
+	f.Alphabet = []string{"+", "-", "a.b", "a b", "ünï"}
+	f.OutputAlphabet = []string{"beep!", "beep?", "\\"}
+	for i, s := range f.States {
+		in := f.Alphabet[i%len(f.Alphabet)]
+		out := f.OutputAlphabet[i%len(f.OutputAlphabet)]
+		f.AddTransition(s, &in, []string{f.States[(i+1)%len(f.States)]}, &out)
+	}
+	f.Accepting = []string{"état"}
+	return f
+}
+
+func TestGeneratedGoWithAwkwardNames(t *testing.T) {
+	f := awkwardMachine()
+	code := codegen.GenerateGo(f, "lock")
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "lock.go", code, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("generated Go does not parse: %v\n%s", err, code)
+	}
+	conf := types.Config{}
+	if _, err := conf.Check("lock", fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("generated Go does not type-check: %v\n%s", err, code)
+	}
+
+	for _, want := range []string{
+		"// Identifiers:",
+		`state   "door-open"`,
+		"DoorLockStateDoorOpen_2",
+		`input   "+"`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated Go lacks %q", want)
+		}
+	}
+}
+
+func TestGeneratedCWithAwkwardNames(t *testing.T) {
+	code := codegen.GenerateC(awkwardMachine())
+	define := regexp.MustCompile(`(?m)^#define (\S+)`)
+	ident := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	seen := make(map[string]bool)
+	for _, m := range define.FindAllStringSubmatch(code, -1) {
+		if !ident.MatchString(m[1]) {
+			t.Errorf("macro %q is not a C identifier", m[1])
+		}
+		if seen[m[1]] {
+			t.Errorf("macro %s defined twice", m[1])
+		}
+		seen[m[1]] = true
+	}
+	for _, want := range []string{"_2_DOOR_LOCK_STATE_U00E9_TAT", `"say \"hi\" {now}"`, `"\\"`} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated C lacks %s", want)
+		}
+	}
+}
+
+func TestGeneratedRustWithAwkwardNames(t *testing.T) {
+	for _, opts := range []codegen.RustOptions{{}, {NoStd: true, Defmt: true}} {
+		code := codegen.GenerateRustWithOptions(awkwardMachine(), opts)
+		enum := regexp.MustCompile(`(?s)pub enum (\w+) \{\n(.*?)\}`)
+		ident := regexp.MustCompile(`^[\p{L}_][\p{L}\p{Nd}_]*$`)
+		for _, m := range enum.FindAllStringSubmatch(code, -1) {
+			seen := make(map[string]bool)
+			for _, line := range strings.Split(strings.TrimSpace(m[2]), "\n") {
+				v := strings.TrimSuffix(strings.TrimSpace(line), ",")
+				if !ident.MatchString(v) || v == "Self" {
+					t.Errorf("%s variant %q is not an identifier", m[1], v)
+				}
+				if seen[v] {
+					t.Errorf("%s variant %s appears twice", m[1], v)
+				}
+				seen[v] = true
+			}
+		}
+		if !strings.Contains(code, `write!(f, "say \"hi\" {{now}}")`) {
+			t.Errorf("Display does not escape quotes and braces:\n%s", code)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
@@ -85,6 +86,38 @@ func TestNFAEpsilonClosure(t *testing.T) {
 	}
 }
 
+// TestFSMEpsilonClosure tests EpsilonClosure follows chains and cycles
+// of epsilon transitions, and not transitions on inputs
+func TestFSMEpsilonClosure(t *testing.T) {
+	f := &fsm.FSM{
+		Type:     fsm.TypeNFA,
+		States:   []string{"s0", "s1", "s2", "s3", "s4"},
+		Alphabet: []string{"a"},
+		Initial:  "s0",
+	}
+	f.Transitions = []fsm.Transition{
+		{From: "s0", Input: nil, To: []string{"s2"}},
+		{From: "s2", Input: nil, To: []string{"s1", "s0"}}, // cycle back to s0
+		{From: "s1", Input: strPtr("a"), To: []string{"s3"}},
+		{From: "s4", Input: nil, To: []string{"s3"}},
+	}
+
+	tests := []struct {
+		from []string
+		want string
+	}{
+		{[]string{"s0"}, "s0 s1 s2"},
+		{[]string{"s1"}, "s1"},
+		{[]string{"s4", "s1"}, "s1 s3 s4"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(f.EpsilonClosure(tt.from...), " "); got != tt.want {
+			t.Errorf("EpsilonClosure(%v) = %q, want %q", tt.from, got, tt.want)
+		}
+	}
+}
+
 // TestNFAToDFA tests conversion of NFA to DFA
 func TestNFAToDFA(t *testing.T) {
 	// NFA: s0 --a--> {s1, s2}, s1 --b--> s3, s2 --b--> s3
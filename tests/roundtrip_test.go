@@ -0,0 +1,140 @@
+// Round-trip property tests: converting a machine between JSON, .fsm,
+// and hex records must not change its behaviour. Behaviour is compared
+// with fsm.Equivalent, so state renaming or reordering is allowed but any
+// change in the accepted language or outputs is not.
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsmfile"
+)
+
+// viaJSON round-trips a machine through ToJSON and ParseJSON.
+func viaJSON(f *fsm.FSM) (*fsm.FSM, error) {
+	data, err := fsmfile.ToJSON(f, false)
+	if err != nil {
+		return nil, err
+	}
+	return fsmfile.ParseJSON(data)
+}
+
+// viaArchive round-trips a machine through a .fsm archive.
+func viaArchive(f *fsm.FSM) (*fsm.FSM, error) {
+	var buf bytes.Buffer
+	if err := fsmfile.WriteFSM(&buf, f, true); err != nil {
+		return nil, err
+	}
+	return fsmfile.ReadFSMBytes(buf.Bytes())
+}
+
+// viaHex round-trips a machine through hex text plus labels.toml.
+func viaHex(f *fsm.FSM) (*fsm.FSM, error) {
+	records, states, inputs, outputs := fsmfile.FSMToRecords(f)
+	parsed, err := fsmfile.ParseHex(fsmfile.FormatHex(records, 4))
+	if err != nil {
+		return nil, err
+	}
+	labels, err := fsmfile.ParseLabels(fsmfile.GenerateLabels(f, states, inputs, outputs))
+	if err != nil {
+		return nil, err
+	}
+	return fsmfile.RecordsToFSM(parsed, labels)
+}
+
+var roundTrips = []struct {
+	name string
+	fn   func(*fsm.FSM) (*fsm.FSM, error)
+}{
+	{"json", viaJSON},
+	{"fsm", viaArchive},
+	{"hex", viaHex},
+	{"json+fsm+hex", func(f *fsm.FSM) (*fsm.FSM, error) {
+		g, err := viaJSON(f)
+		if err == nil {
+			g, err = viaArchive(g)
+		}
+		if err == nil {
+			g, err = viaHex(g)
+		}
+		return g, err
+	}},
+}
+
+func checkRoundTrips(t *testing.T, label string, f *fsm.FSM) {
+	t.Helper()
+	for _, rt := range roundTrips {
+		g, err := rt.fn(f)
+		if err != nil {
+			t.Errorf("%s via %s: %v", label, rt.name, err)
+			continue
+		}
+		if g.Type != f.Type {
+			t.Errorf("%s via %s: type %s, want %s", label, rt.name, g.Type, f.Type)
+		}
+		if len(g.States) != len(f.States) || len(g.Transitions) != len(f.Transitions) {
+			t.Errorf("%s via %s: %d states/%d transitions, want %d/%d",
+				label, rt.name, len(g.States), len(g.Transitions), len(f.States), len(f.Transitions))
+		}
+		if eq, cex := fsm.Equivalent(f, g); !eq {
+			t.Errorf("%s via %s: not equivalent, counterexample %q", label, rt.name, cex)
+		}
+	}
+}
+
+func TestRoundTrip_Random(t *testing.T) {
+	for _, typ := range []fsm.Type{fsm.TypeDFA, fsm.TypeNFA, fsm.TypeMoore, fsm.TypeMealy} {
+		for seed := int64(1); seed <= 25; seed++ {
+			f, err := fsm.Random(fsm.RandomOptions{States: 12, Alphabet: 3, Density: 0.7, Type: typ, Seed: seed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRoundTrips(t, fmt.Sprintf("%s/seed=%d", typ, seed), f)
+		}
+	}
+}
+
+func TestRoundTrip_Unicode(t *testing.T) {
+	f := fsm.New(fsm.TypeMealy)
+	for _, s := range []string{"início", "状態", "λ-closure", "état \"quoted\"", "tab\there"} {
+		f.AddState(s)
+	}
+	f.Alphabet = []string{"→", "ñ", "😀", "a=b", "# hash"}
+	f.OutputAlphabet = []string{"ok ✓", "fehler", "back\\slash"}
+	f.SetInitial("início")
+	for i, from := range f.States {
+		for j, in := range f.Alphabet {
+			to := f.States[(i+j+1)%len(f.States)]
+			out := f.OutputAlphabet[(i*j)%len(f.OutputAlphabet)]
+			f.AddTransition(from, &in, []string{to}, &out)
+		}
+	}
+	checkRoundTrips(t, "unicode", f)
+}
+
+func TestRoundTrip_LargeAlphabet(t *testing.T) {
+	f, err := fsm.Random(fsm.RandomOptions{States: 40, Alphabet: 500, Density: 0.3, Seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrips(t, "500 inputs", f)
+}
+
+func TestRoundTrip_Epsilon(t *testing.T) {
+	f := fsm.New(fsm.TypeNFA)
+	for _, s := range []string{"q0", "q1", "q2", "q3"} {
+		f.AddState(s)
+	}
+	f.Alphabet = []string{"a", "b"}
+	f.SetInitial("q0")
+	f.SetAccepting([]string{"q3"})
+	a, b := "a", "b"
+	f.AddTransition("q0", nil, []string{"q1", "q2"}, nil)
+	f.AddTransition("q1", &a, []string{"q1", "q3"}, nil)
+	f.AddTransition("q2", &b, []string{"q3"}, nil)
+	f.AddTransition("q3", nil, []string{"q0"}, nil)
+	checkRoundTrips(t, "epsilon", f)
+}
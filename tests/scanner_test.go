@@ -0,0 +1,91 @@
+// Scanner tests: a scanner built from several acceptors must give Go
+// that compiles, with a next-token function, and C declaring one.
+package tests
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/fsm-toolkit/pkg/codegen"
+	"github.com/ha1tch/fsm-toolkit/pkg/fsm"
+)
+
+// wordMachine accepts one or more characters of the class [pattern].
+func wordMachine(class, pattern string) *fsm.FSM {
+	f := fsm.New(fsm.TypeDFA)
+	f.AddState("start")
+	f.AddState("word")
+	f.AddInput(class)
+	f.Metadata = map[string]string{fsm.InputClassPrefix + class: pattern}
+	f.SetInitial("start")
+	f.SetAccepting([]string{"word"})
+	f.AddTransition("start", &class, []string{"word"}, nil)
+	f.AddTransition("word", &class, []string{"word"}, nil)
+	return f
+}
+
+func testScanner(t *testing.T) *fsm.FSM {
+	t.Helper()
+	eq := fsm.New(fsm.TypeDFA)
+	eq.AddState("start")
+	eq.AddState("eq")
+	eq.AddInput("=")
+	eq.SetInitial("start")
+	eq.SetAccepting([]string{"eq"})
+	eq.AddTransition("start", strPtr("="), []string{"eq"}, nil)
+
+	s, err := fsm.BuildScanner([]fsm.ScannerRule{
+		{Token: "name", Machine: wordMachine("letter", "[a-z]")},
+		{Token: "number", Machine: wordMachine("digit", "[0-9]")},
+		{Token: "equals", Machine: eq},
+		{Token: "space", Machine: wordMachine("blank", `[ \t]`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Name = "assign"
+	return s
+}
+
+func TestGeneratedGoScanner(t *testing.T) {
+	code := codegen.GenerateGoScanner(testScanner(t), "assign")
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "assign.go", code, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("generated Go does not parse: %v\n%s", err, code)
+	}
+	conf := types.Config{}
+	if _, err := conf.Check("assign", fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("generated Go does not type-check: %v\n%s", err, code)
+	}
+	for _, want := range []string{
+		"func NextAssignToken(input string) (token AssignOutput, n int, ok bool)",
+		"func ClassifyAssignInput(c rune)",
+		"AssignOutputEquals",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated Go lacks %q", want)
+		}
+	}
+}
+
+func TestGeneratedCScanner(t *testing.T) {
+	for _, opts := range []codegen.COptions{{}, {MISRA: true}} {
+		code, _ := codegen.GenerateCScannerWithOptions(testScanner(t), opts)
+		for _, want := range []string{
+			"#include <stddef.h>",
+			"bool assign_next_token(const uint8_t *input, size_t len, assign_output_t *token, size_t *length);",
+			"bool assign_classify(uint32_t c, assign_input_t *input) {",
+			"#define ASSIGN_OUTPUT_NUMBER",
+		} {
+			if !strings.Contains(code, want) {
+				t.Errorf("generated C (MISRA %v) lacks %q", opts.MISRA, want)
+			}
+		}
+	}
+}